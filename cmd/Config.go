@@ -9,6 +9,18 @@ const (
 	KeyServerPort    = "server.port"
 	KeyServerPrefix  = "server.prefix"
 	KeyServerLogpath = "server.logpath"
+	KeyServerPprof   = "server.pprof"
+
+	KeyServerShutdownTimeout = "server.shutdown_timeout"
+	KeyServerLogLevel        = "server.log_level"
+	KeyServerCompression     = "server.compression"
+
+	KeyServerTLSCertFile     = "server.tls.cert_file"
+	KeyServerTLSKeyFile      = "server.tls.key_file"
+	KeyServerTLSACMEHosts    = "server.tls.acme_hosts"
+	KeyServerTLSACMEEmail    = "server.tls.acme_email"
+	KeyServerTLSACMECacheDir = "server.tls.acme_cache_dir"
+	KeyServerTLSHSTSMaxAge   = "server.tls.hsts_max_age"
 
 	KeyDatabaseConnection         = "database.connection"
 	KeyDatabaseDatabase           = "database.database"
@@ -17,17 +29,93 @@ const (
 	KeyDatabaseHost               = "database.host"
 	KeyDatabaseQueryTimeout       = "database.query_timeout"
 	KeyDatabaseSlowQueryThreshold = "database.slow_query_threshold"
+	KeyDatabaseConnectRetries     = "database.connect_retries"
+	KeyDatabaseConnectMaxDelay    = "database.connect_max_delay"
+	KeyDatabaseHealthInterval     = "database.health_check_interval"
+	KeyDatabaseReplicas           = "database.replicas"
 
 	KeyJWTSecret        = "jwt_secret"
 	KeyJWTAccessExpiry  = "jwt_access_expiry"
 	KeyJWTRefreshExpiry = "jwt_refresh_expiry"
+	KeyJWTStaleClaims   = "jwt_stale_claims"
+	KeyJWTIdleTimeout   = "jwt_idle_timeout"
+	KeyJWTRoles         = "jwt_roles"
+
+	KeyJWTAlgorithm        = "jwt_algorithm"
+	KeyJWTKeyFile          = "jwt_key_file"
+	KeyJWTPreviousKeyFiles = "jwt_previous_key_files"
 
 	KeyBootstrapAdminUsername = "bootstrap_admin_username"
 	KeyBootstrapAdminEmail    = "bootstrap_admin_email"
 	KeyBootstrapAdminPassword = "bootstrap_admin_password"
 
-	KeyCORSEnabled        = "cors.enabled"
-	KeyCORSAllowedOrigins = "cors.allowed_origins"
+	KeyBundleKey = "bundle_key"
+
+	KeyLimitsJWTRequestsPerMinute  = "limits.jwt_requests_per_minute"
+	KeyLimitsMaxBatchOperations    = "limits.max_batch_operations"
+	KeyLimitsMaxPerPage            = "limits.max_per_page"
+	KeyLimitsDefaultPerPage        = "limits.default_per_page"
+	KeyLimitsMaxRequestBody        = "limits.max_request_body"
+	KeyLimitsMaxConcurrentRequests = "limits.max_concurrent_requests"
+	KeyLimitsRoutes                = "limits.routes"
+
+	KeySLOObjective = "slo.objective"
+	KeySLOTargets   = "slo.targets"
+
+	KeyOIDCIssuer        = "oidc.issuer"
+	KeyOIDCClientID      = "oidc.client_id"
+	KeyOIDCClientSecret  = "oidc.client_secret"
+	KeyOIDCRedirectURI   = "oidc.redirect_uri"
+	KeyOIDCScopes        = "oidc.scopes"
+	KeyOIDCAutoProvision = "oidc.auto_provision"
+	KeyOIDCDefaultRole   = "oidc.default_role"
+
+	KeyPasswordPolicyMinLength        = "password_policy.min_length"
+	KeyPasswordPolicyRequireLowercase = "password_policy.require_lowercase"
+	KeyPasswordPolicyRequireUppercase = "password_policy.require_uppercase"
+	KeyPasswordPolicyRequireDigit     = "password_policy.require_digit"
+	KeyPasswordPolicyRequireSymbol    = "password_policy.require_symbol"
+	KeyPasswordPolicyHistory          = "password_policy.history"
+	KeyPasswordPolicyLockoutThreshold = "password_policy.lockout_threshold"
+	KeyPasswordPolicyLockoutDuration  = "password_policy.lockout_duration"
+
+	KeyMailSMTPHost     = "mail.smtp_host"
+	KeyMailSMTPPort     = "mail.smtp_port"
+	KeyMailSMTPUsername = "mail.smtp_username"
+	KeyMailSMTPPassword = "mail.smtp_password"
+	KeyMailFrom         = "mail.from"
+	KeyMailDriver       = "mail.driver"
+	KeyMailTemplateDir  = "mail.template_dir"
+
+	KeyPasswordResetURL      = "password_reset.url"
+	KeyPasswordResetTokenTTL = "password_reset.token_ttl"
+	KeyInvitationURL         = "invitation.url"
+	KeyInvitationTokenTTL    = "invitation.token_ttl"
+
+	KeyWellKnownRobotsTxt   = "well_known.robots_txt"
+	KeyWellKnownSecurityTxt = "well_known.security_txt"
+
+	KeyErrorReportingSentryDSN   = "error_reporting.sentry_dsn"
+	KeyErrorReportingEnvironment = "error_reporting.environment"
+
+	KeyCacheBackend       = "cache.backend"
+	KeyCacheRedisURL      = "cache.redis_url"
+	KeyCacheQueryTTL      = "cache.query_ttl"
+	KeyCacheQueryMaxBytes = "cache.query_max_bytes"
+
+	KeyTracingOTLPEndpoint = "tracing.otlp_endpoint"
+	KeyTracingServiceName  = "tracing.service_name"
+
+	KeyAggregatePrivacyEpsilon      = "aggregate_privacy.epsilon"
+	KeyAggregatePrivacyMinGroupSize = "aggregate_privacy.min_group_size"
+
+	KeyCORSEnabled          = "cors.enabled"
+	KeyCORSAllowedOrigins   = "cors.allowed_origins"
+	KeyCORSAllowedMethods   = "cors.allowed_methods"
+	KeyCORSAllowedHeaders   = "cors.allowed_headers"
+	KeyCORSAllowCredentials = "cors.allow_credentials"
+	KeyCORSMaxAge           = "cors.max_age"
+	KeyCORSOrigins          = "cors.origins"
 )
 
 // ---------------------------------------------------------------------------
@@ -40,6 +128,25 @@ const (
 	DBConnectionMySQL    = "mysql"
 )
 
+// MySQL connections use MySQLDefaultPort when database.host names no port
+// and are recycled after MySQLConnMaxLifetimeSeconds, ahead of the server's
+// wait_timeout. Indexes on text columns cover the first
+// MySQLIndexPrefixLength characters. Column types read from
+// information_schema are cached for MySQLColumnCacheSeconds. Unique
+// constraints are named with MySQLUniqueConstraintPrefix so they can be
+// told apart from indexes created with CREATE INDEX. Tables compare text
+// byte-wise with MySQLDefaultCollation, as SQLite does; nocase columns use
+// MySQLCaseInsensitiveCollation.
+const (
+	MySQLDefaultPort              = "3306"
+	MySQLConnMaxLifetimeSeconds   = 300
+	MySQLIndexPrefixLength        = 255
+	MySQLColumnCacheSeconds       = 5
+	MySQLUniqueConstraintPrefix   = "moon_uq_"
+	MySQLDefaultCollation         = "utf8mb4_bin"
+	MySQLCaseInsensitiveCollation = "utf8mb4_0900_as_ci"
+)
+
 // ---------------------------------------------------------------------------
 // Built-in default values
 // ---------------------------------------------------------------------------
@@ -50,20 +157,60 @@ const (
 	DefaultServerPrefix  = ""
 	DefaultServerLogpath = "/var/log/moon.log"
 
+	// DefaultServerShutdownTimeout is how many seconds in-flight requests
+	// are given to finish after SIGINT or SIGTERM.
+	DefaultServerShutdownTimeout = 15
+	DefaultServerLogLevel        = LogLevelInfo
+	DefaultServerCompression     = true
+
+	// DefaultTLSACMECacheDir is where certificates obtained over ACME are
+	// kept between restarts.
+	DefaultTLSACMECacheDir = "/opt/moon/acme"
+	// DefaultTLSHSTSMaxAge is one year, in seconds.
+	DefaultTLSHSTSMaxAge = 31536000
+
 	DefaultDatabaseConnection         = "sqlite"
 	DefaultDatabaseDatabase           = "/opt/moon/sqlite.db"
 	DefaultDatabaseQueryTimeout       = 30
 	DefaultDatabaseSlowQueryThreshold = 500
+	DefaultDatabaseConnectRetries     = 10
+	DefaultDatabaseConnectMaxDelay    = 30
+	DefaultDatabaseHealthInterval     = 15
 
 	DefaultJWTAccessExpiry  = 3600
 	DefaultJWTRefreshExpiry = 604800
+	DefaultJWTStaleClaims   = JWTStaleClaimsOverride
+	DefaultJWTIdleTimeout   = 0 // disabled
+	DefaultJWTAlgorithm     = JWTAlgorithmHS256
 
 	DefaultCORSEnabled = true
+	// DefaultCORSMaxAge is how many seconds browsers may cache a preflight
+	// response.
+	DefaultCORSMaxAge = 86400
 )
 
 // DefaultCORSAllowedOrigins is the default list of allowed CORS origins.
 var DefaultCORSAllowedOrigins = []string{"*"}
 
+// DefaultCORSAllowedMethods and DefaultCORSAllowedHeaders are the methods
+// and request headers a preflight response allows by default.
+var (
+	DefaultCORSAllowedMethods = []string{"GET", "POST", "OPTIONS"}
+	DefaultCORSAllowedHeaders = []string{"Authorization", "Content-Type"}
+)
+
+// ---------------------------------------------------------------------------
+// Log levels
+// ---------------------------------------------------------------------------
+
+// Values accepted by server.log_level.
+const (
+	LogLevelDebug = "debug"
+	LogLevelInfo  = "info"
+	LogLevelWarn  = "warn"
+	LogLevelError = "error"
+)
+
 // ---------------------------------------------------------------------------
 // Default file paths
 // ---------------------------------------------------------------------------
@@ -78,6 +225,25 @@ const (
 
 const (
 	RedactedPlaceholder = "[REDACTED]"
+
+	// RequestIDHeader carries the request correlation ID. A valid inbound
+	// value is kept; otherwise the server generates one.
+	RequestIDHeader = "X-Request-ID"
+
+	// ReadPrimaryHeader, set to "true", makes a list or get request read
+	// from the primary database instead of a replica.
+	ReadPrimaryHeader = "X-Read-Primary"
+
+	// PaginationTrailer is the HTTP trailer of an NDJSON list response. It
+	// carries the meta and links that a JSON list has in its body.
+	PaginationTrailer = "X-Pagination"
+
+	// NDJSONContentType is the media type of newline-delimited JSON, one
+	// JSON value per line, used by exports and streamed lists.
+	NDJSONContentType = "application/x-ndjson"
+
+	// MaxRequestIDLength is the longest inbound request ID that is kept.
+	MaxRequestIDLength = 128
 )
 
 // SensitiveKeys lists configuration and header keys whose values must never
@@ -89,8 +255,47 @@ var SensitiveKeys = []string{
 	"refresh_token",
 	"api_key",
 	"token",
+	"bundle_key",
+	"redis_url",
 }
 
+// ---------------------------------------------------------------------------
+// Error codes
+// ---------------------------------------------------------------------------
+
+// Error codes of the error response envelope; see SPEC/10_error.md. Every
+// error status has a generic code, used unless a specific one applies.
+const (
+	ErrCodeBadRequest         = "bad_request"
+	ErrCodeUnauthorized       = "unauthorized"
+	ErrCodeForbidden          = "forbidden"
+	ErrCodeNotFound           = "not_found"
+	ErrCodeMethodNotAllowed   = "method_not_allowed"
+	ErrCodeConflict           = "conflict"
+	ErrCodePreconditionFailed = "precondition_failed"
+	ErrCodePayloadTooLarge    = "payload_too_large"
+	ErrCodeRateLimited        = "rate_limited"
+	ErrCodeInternal           = "internal_error"
+	ErrCodeNotImplemented     = "not_implemented"
+	ErrCodeBadGateway         = "bad_gateway"
+	ErrCodeUnavailable        = "service_unavailable"
+
+	ErrCodeValidationFailed     = "validation_failed"
+	ErrCodeUnknownField         = "unknown_field"
+	ErrCodeReadOnlyField        = "read_only_field"
+	ErrCodeUnknownParameter     = "unknown_parameter"
+	ErrCodeCursorInvalid        = "cursor_invalid"
+	ErrCodeUniqueViolation      = "unique_violation"
+	ErrCodeForeignKeyViolation  = "foreign_key_violation"
+	ErrCodeCheckViolation       = "check_violation"
+	ErrCodeNotNullViolation     = "not_null_violation"
+	ErrCodeDatabaseUnavailable  = "database_unavailable"
+	ErrCodeOverloaded           = "overloaded"
+	ErrCodeVersionConflict      = "version_conflict"
+	ErrCodeConfirmCountExceeded = "confirm_count_exceeded"
+	ErrCodeCaptchaRequired      = "captcha_required"
+)
+
 // ---------------------------------------------------------------------------
 // Audit event names
 // ---------------------------------------------------------------------------
@@ -108,10 +313,22 @@ const (
 	AuditPrivilegedMutation  = "privileged.mutation"
 	AuditAPIKeyCreate        = "api_key.create"
 	AuditAPIKeyRotation      = "api_key.rotation"
+	AuditAPIKeyExpiring      = "api_key.expiring"
 	AuditAdminUserManagement = "admin.user_management"
+	AuditDataMutation        = "data.mutation"
 	AuditShutdown            = "shutdown"
+	AuditConfigReload        = "config.reload"
+	AuditSLOAtRisk           = "slo.at_risk"
+	AuditTwoFactorChange     = "auth.two_factor"
+	AuditAccountLocked       = "auth.account_locked"
+	AuditPasswordReset       = "auth.password_reset"
+	AuditInvitationAccepted  = "auth.invitation_accepted"
 )
 
+// AuditTable stores the admin actions and record mutations listed by
+// /admin:audit.
+const AuditTable = "moon_audit"
+
 // ---------------------------------------------------------------------------
 // Version
 // ---------------------------------------------------------------------------
@@ -124,13 +341,23 @@ const (
 // Fixed limits
 // ---------------------------------------------------------------------------
 
+// MaxPerPage and DefaultPerPage are the defaults of limits.max_per_page and
+// limits.default_per_page; MaxPerPage is also their ceiling and the page
+// size of internal full scans.
 const (
 	MaxPerPage             = 200
 	DefaultPerPage         = 15
 	BcryptCost             = 12
 	MinJWTSecretLength     = 32
+	MinJWTRSAKeyBits       = 2048
+	JWKSCacheMaxAge        = 300 // seconds
 	MinPasswordLength      = 8
 	DefaultAPIKeyRateLimit = 15
+	ShadowTableBatchSize   = 500
+
+	// SetupTokenBytes is the number of random bytes in the first-run
+	// setup token, which is printed hex-encoded at startup.
+	SetupTokenBytes = 32
 )
 
 // ---------------------------------------------------------------------------
@@ -140,6 +367,37 @@ const (
 const (
 	APIKeyPrefix   = "moon_live_"
 	APIKeyTotalLen = 74
+
+	// MaxPersonalAPIKeys caps the personal keys one user can create
+	// through /auth:keys.
+	MaxPersonalAPIKeys = 10
+
+	// MaxSessionUserAgentLen caps the User-Agent stored with a refresh
+	// token session; longer values are truncated.
+	MaxSessionUserAgentLen = 256
+
+	// An API key used within APIKeyExpiryWarnHours of its expires_at is
+	// reported with an api_key.expiring audit event.
+	APIKeyExpiryWarnHours = 7 * 24
+)
+
+// ---------------------------------------------------------------------------
+// Two-factor authentication constants
+// ---------------------------------------------------------------------------
+
+// TOTP codes follow RFC 6238 with the parameters most authenticator apps
+// assume: HMAC-SHA1, six digits, and a 30-second step. A code from one step
+// before or after the current one is also accepted to allow for clock skew.
+const (
+	TOTPIssuer        = "Moon"
+	TOTPSecretBytes   = 20
+	TOTPDigits        = 6
+	TOTPPeriodSeconds = 30
+	TOTPSkewSteps     = 1
+
+	// TOTPRecoveryCodes is how many single-use recovery codes are issued
+	// when two-factor authentication is enabled.
+	TOTPRecoveryCodes = 10
 )
 
 // ---------------------------------------------------------------------------
@@ -151,6 +409,22 @@ const (
 	CredentialTypeAPIKey = "apikey"
 )
 
+// JWTStaleClaimsOverride applies the stored role and can_write when an
+// access token's claims no longer match the user record.
+// JWTStaleClaimsReject rejects such a token with 401 so the client must
+// refresh it.
+const (
+	JWTStaleClaimsOverride = "override"
+	JWTStaleClaimsReject   = "reject"
+)
+
+// Access-token signing algorithms accepted by jwt_algorithm.
+const (
+	JWTAlgorithmHS256 = "HS256"
+	JWTAlgorithmRS256 = "RS256"
+	JWTAlgorithmES256 = "ES256"
+)
+
 // ---------------------------------------------------------------------------
 // Rate limiting constants
 // ---------------------------------------------------------------------------
@@ -158,10 +432,265 @@ const (
 const (
 	RateLoginFailureLimit   = 5
 	RateLoginFailureWindow  = 900 // 15 minutes in seconds
-	RateJWTRequestLimit     = 100
-	RateJWTRequestWindow    = 60 // 1 minute
+	RateJWTRequestLimit     = 100 // default of limits.jwt_requests_per_minute
+	RateJWTRequestWindow    = 60  // 1 minute
 	RateAPIKeyRequestLimit  = DefaultAPIKeyRateLimit
 	RateAPIKeyRequestWindow = 60 // 1 minute
+	RateRouteRequestWindow  = 60 // 1 minute; limits come from limits.routes
+
+	// Password reset requests per client IP and per email address.
+	RatePasswordResetLimit  = 5
+	RatePasswordResetWindow = 3600 // 1 hour
+)
+
+// Load shedding priority classes, lowest first. See LoadShedder.
+const (
+	PriorityAnonymous = iota
+	PriorityRead
+	PriorityWrite
+	PriorityAdmin
+)
+
+// LoadShedShares is the share of limits.max_concurrent_requests above which
+// requests of each priority class are shed, indexed by class. Admin
+// requests are never shed.
+var LoadShedShares = []float64{0.5, 0.75, 0.9}
+
+// LoadShedRetryAfterSeconds is the Retry-After value of a shed request.
+const LoadShedRetryAfterSeconds = 1
+
+// ---------------------------------------------------------------------------
+// Database availability
+// ---------------------------------------------------------------------------
+
+// At startup, a database that does not answer a ping is retried up to
+// database.connect_retries times. Before retry n Moon sleeps between half
+// and all of DBConnectBaseDelayMs * 2^(n-1) milliseconds, capped at
+// database.connect_max_delay seconds.
+//
+// While serving, a request that fails with 500 pings the database, within
+// DBHealthPingTimeoutSeconds; if it does not answer, the response becomes
+// 503 with Retry-After: DBUnavailableRetryAfterSeconds. Once the database
+// is marked unavailable, it is pinged again at most every
+// DBUnavailableRecheckMs until it answers.
+const (
+	DBConnectBaseDelayMs           = 500
+	DBHealthPingTimeoutSeconds     = 2
+	DBUnavailableRetryAfterSeconds = 5
+	DBUnavailableRecheckMs         = 1000
+)
+
+// LoginBackoffDelays are the progressive delays, in seconds, enforced after
+// the failed logins that precede the hard lockout at RateLoginFailureLimit.
+// With a limit of 5 they apply after the 2nd, 3rd, and 4th failures.
+var LoginBackoffDelays = []int{1, 5, 30}
+
+// LoginChallengeAfterFailures is the number of recent failed logins after
+// which the configured login challenge (CAPTCHA) must be answered.
+const LoginChallengeAfterFailures = 3
+
+// Rate limit bucket type names reported by the admin rate limit endpoint.
+const (
+	RateLimitTypeLoginFailure  = "login_failure"
+	RateLimitTypeJWT           = "jwt"
+	RateLimitTypeAPIKey        = "apikey"
+	RateLimitTypeRoute         = "route"
+	RateLimitTypePasswordReset = "password_reset"
+)
+
+// ---------------------------------------------------------------------------
+// Schema version propagation
+// ---------------------------------------------------------------------------
+
+const (
+	SchemaVersionTable        = "moon_schema_version"
+	SchemaVersionRowID        = "current"
+	SchemaVersionCheckSeconds = 2
+)
+
+// ---------------------------------------------------------------------------
+// Shadow table migrations
+// ---------------------------------------------------------------------------
+
+// ShadowTablePrefix names the shadow tables of column modifications; the
+// moon_ prefix keeps them out of the registry while they are filled.
+// ShadowBatchIntervalMs is how often the migration scheduler copies the
+// next ShadowTableBatchSize rows of each running migration, leaving the
+// write lock to other writers in between. ShadowMigrationHistory is the
+// number of finished migrations GET /collections:migrations still lists.
+const (
+	ShadowTablePrefix      = "moon_shadow_"
+	ShadowBatchIntervalMs  = 50
+	ShadowMigrationHistory = 20
+)
+
+// ---------------------------------------------------------------------------
+// System layout version
+// ---------------------------------------------------------------------------
+
+// CurrentLayoutVersion is the system table layout this binary creates and
+// expects. It increases with every migration in layoutMigrations.
+const (
+	LayoutVersionTable   = "moon_layout_version"
+	LayoutVersionRowID   = "current"
+	CurrentLayoutVersion = 1
+)
+
+// ---------------------------------------------------------------------------
+// Aggregate endpoint constants
+// ---------------------------------------------------------------------------
+
+const (
+	DefaultHistogramBuckets = 10
+	MaxHistogramBuckets     = 100
+)
+
+// MaxTimeSeriesPoints caps the number of buckets a single time-series
+// request may produce after gap filling.
+const MaxTimeSeriesPoints = 1000
+
+// MaxPivotRows and MaxPivotColumns cap the size of a pivot table. A table
+// within both limits has at most MaxPivotCells cells, so the grouped query
+// stops reading after one more.
+const (
+	MaxPivotRows    = 1000
+	MaxPivotColumns = 100
+	MaxPivotCells   = MaxPivotRows * MaxPivotColumns
+)
+
+// API keys with noisy_aggregates get counts with Laplace noise of scale
+// 1/epsilon added, and groups of fewer than DefaultAggregateMinGroupSize
+// records suppressed. Smaller epsilon values add more noise.
+const (
+	DefaultAggregateEpsilon      = 1.0
+	DefaultAggregateMinGroupSize = 5
+)
+
+// Schema inference limits for POST /collections:infer. Unique constraints
+// and category indexes are suggested only from at least InferMinSamples
+// values; unique is not suggested for strings longer than
+// InferMaxUniqueLength.
+const (
+	MaxInferSamples      = 1000
+	MaxInferBodyBytes    = 8 << 20
+	InferMinSamples      = 10
+	InferMaxUniqueLength = 64
+)
+
+// Bulk import and export limits.
+const (
+	ExportBatchSize    = 500
+	MaxImportRows      = 10000
+	MaxImportBodyBytes = 32 << 20
+	MaxImportLineBytes = 1 << 20
+)
+
+// Export bundle format. Bundles are only available when bundle_key is set,
+// and the key must be at least MinBundleKeyLength characters.
+const (
+	BundleVersion          = 1
+	BundleFileExtension    = ".moonbundle"
+	BundleChunkSize        = 64 << 10
+	MaxBundleManifestBytes = 4 << 10
+	MinBundleKeyLength     = 32
+)
+
+// MaxBatchOperations caps the operations in one POST /batch request.
+// It is the default and the ceiling for limits.max_batch_operations.
+const MaxBatchOperations = 100
+
+// MaxRequestBodyBytes is the default and the ceiling for
+// limits.max_request_body. It matches MaxImportBodyBytes, the largest body
+// any endpoint accepts; MinRequestBodyBytes is the floor.
+const (
+	MaxRequestBodyBytes = MaxImportBodyBytes
+	MinRequestBodyBytes = 1 << 10
+)
+
+// ETagHashBytes is how many bytes of a SHA-256 hash an ETag carries, hex
+// encoded.
+const ETagHashBytes = 16
+
+// CompressMinBytes is the smallest JSON response that is compressed when
+// server.compression is on. Smaller bodies are sent as is.
+const CompressMinBytes = 1 << 10
+
+// MaxUserImportRows caps a users import. It is lower than MaxImportRows
+// because every plaintext password is hashed at BcryptCost.
+const MaxUserImportRows = 1000
+
+// MaxUserBatchItems caps a users :mutate request that sets mode. Like a
+// users import, each created account costs a bcrypt hash.
+const MaxUserBatchItems = 1000
+
+// MaxUpsertItems caps the items of one :upsert request, each of which is
+// looked up by key before it is written.
+const MaxUpsertItems = 1000
+
+// HistogramPercentiles lists the percentile ranks reported by the
+// histogram endpoint.
+var HistogramPercentiles = []int{25, 50, 75, 90, 99}
+
+// ---------------------------------------------------------------------------
+// NULL ordering
+// ---------------------------------------------------------------------------
+
+// NullsFirst and NullsLast are the accepted values of the nulls query
+// parameter, which places NULL values before or after all other values.
+const (
+	NullsFirst = "first"
+	NullsLast  = "last"
+)
+
+// ---------------------------------------------------------------------------
+// Column collations
+// ---------------------------------------------------------------------------
+
+// CollationBinary is the default byte-wise comparison. CollationNocase
+// compares string columns case-insensitively for equality, sorting, and
+// unique constraints.
+const (
+	CollationBinary = "binary"
+	CollationNocase = "nocase"
+)
+
+// MaxEnumValues caps the number of values in a field's enum rule.
+const MaxEnumValues = 100
+
+// Decimal values may carry at most DecimalMaxPrecision significant digits,
+// the most a SQLite NUMERIC column stores exactly, and at most
+// DecimalMaxScale fractional digits. A decimal column declared without a
+// precision uses both limits.
+const (
+	DecimalMaxPrecision = 15
+	DecimalMaxScale     = 10
+)
+
+// ---------------------------------------------------------------------------
+// System-managed columns
+// ---------------------------------------------------------------------------
+
+// FieldCreatedAt and FieldUpdatedAt name the datetime columns that Moon
+// maintains on dynamic collections. FieldVersion names the integer column
+// used for optimistic concurrency. Its leading underscore keeps it out of
+// the client column namespace. FieldOwnerID names the string column that
+// records the creating caller's ID. FieldAttributes names the JSON column
+// holding flex attributes. A collection opts in by having the column.
+const (
+	FieldCreatedAt  = "created_at"
+	FieldUpdatedAt  = "updated_at"
+	FieldVersion    = "_version"
+	FieldOwnerID    = "owner_id"
+	FieldAttributes = "_attributes"
+)
+
+// ---------------------------------------------------------------------------
+// OpenAPI document
+// ---------------------------------------------------------------------------
+
+const (
+	OpenAPIVersion = "3.1.0"
+	OpenAPITitle   = "Moon API"
 )
 
 // ---------------------------------------------------------------------------
@@ -175,3 +704,325 @@ const (
 	CaptchaImageHeight  = 80
 	MaxCaptchaBodyBytes = 1 << 20
 )
+
+// ---------------------------------------------------------------------------
+// Collection permissions
+// ---------------------------------------------------------------------------
+
+// PermissionsTable stores per-collection access rules. Each instance
+// caches the rules and reloads them at most once every
+// PermissionReloadSeconds, so changes made through another instance
+// sharing the database take effect within that interval.
+const (
+	PermissionsTable        = "moon_permissions"
+	PermissionReloadSeconds = 30
+)
+
+// Permission rule subject types.
+const (
+	PermissionSubjectRole   = "role"
+	PermissionSubjectAPIKey = "apikey"
+)
+
+// PermissionOperations lists the operations a permission rule can grant,
+// in canonical order.
+var PermissionOperations = []string{"list", "read", "create", "update", "destroy"}
+
+// ---------------------------------------------------------------------------
+// Custom roles
+// ---------------------------------------------------------------------------
+
+// RolesTable stores the custom roles defined through /admin:roles. The
+// PermissionStore caches them with the permission rules, so they reload
+// on the same PermissionReloadSeconds interval.
+const (
+	RolesTable        = "moon_roles"
+	MaxRoleNameLength = 63
+)
+
+// RoleAllCollections in the read or write list of a custom role matches
+// every collection.
+const RoleAllCollections = "*"
+
+// BuiltinRoles lists the roles that always exist and cannot be redefined.
+var BuiltinRoles = []string{"admin", "user"}
+
+// ---------------------------------------------------------------------------
+// Collection indexes
+// ---------------------------------------------------------------------------
+
+// MaxIndexColumns caps the number of columns in an index created through
+// /collections:indexes.
+const MaxIndexColumns = 8
+
+// ---------------------------------------------------------------------------
+// Collection aliases
+// ---------------------------------------------------------------------------
+
+// CollectionAliasesTable maps the old names of renamed collections to
+// their new names. An alias lasts at most MaxCollectionAliasDays.
+const (
+	CollectionAliasesTable = "moon_collection_aliases"
+	MaxCollectionAliasDays = 90
+)
+
+// ---------------------------------------------------------------------------
+// Document templates
+// ---------------------------------------------------------------------------
+
+// TemplatesTable stores the templates rendered by /data/{resource}:render.
+// MaxTemplateBytes caps the size of a template body.
+const (
+	TemplatesTable   = "moon_templates"
+	MaxTemplateBytes = 64 << 10
+)
+
+// TemplateFormats lists the supported document template formats.
+var TemplateFormats = []string{"html", "markdown"}
+
+// ---------------------------------------------------------------------------
+// Flex attributes
+// ---------------------------------------------------------------------------
+
+// AttributesTable stores the flex attributes defined on each collection
+// through /data/{resource}:attributes. A collection has at most
+// MaxAttributesPerCollection of them.
+const (
+	AttributesTable            = "moon_attributes"
+	MaxAttributesPerCollection = 100
+)
+
+// AttributeTypes lists the types a flex attribute can have.
+var AttributeTypes = []string{MoonFieldTypeString, MoonFieldTypeInteger, MoonFieldTypeBoolean, MoonFieldTypeDatetime}
+
+// ---------------------------------------------------------------------------
+// Data quality
+// ---------------------------------------------------------------------------
+
+// A :quality request can apply up to MaxQualityRules rules, each pattern
+// at most MaxQualityPatternLen characters long. Each rule lists the ids of
+// its first MaxQualityViolations failing records.
+const (
+	MaxQualityRules      = 50
+	MaxQualityPatternLen = 256
+	MaxQualityViolations = 20
+)
+
+// ---------------------------------------------------------------------------
+// Validators
+// ---------------------------------------------------------------------------
+
+// ValidatorsTable stores the WebAssembly validator attached to each
+// collection. MaxValidatorModuleBytes caps the size of a module and
+// MaxValidatorOutputBytes the size of the result it returns.
+const (
+	ValidatorsTable         = "moon_validators"
+	MaxValidatorModuleBytes = 2 << 20
+	MaxValidatorOutputBytes = 64 << 10
+)
+
+// Each validator run is stopped after ValidatorTimeoutMs, and its memory
+// may grow to at most ValidatorMaxMemoryPages 64 KiB pages.
+const (
+	ValidatorTimeoutMs      = 200
+	ValidatorMaxMemoryPages = 256
+)
+
+// QR codes from /data/{resource}:qrcode use error correction level M and
+// at most QRCodeMaxVersion (57x57 modules, 213 bytes). PNG output draws
+// QRCodeModuleScale pixels per module; both formats add a quiet zone of
+// QRCodeQuietZone modules.
+const (
+	QRCodeMaxVersion  = 10
+	QRCodeModuleScale = 8
+	QRCodeQuietZone   = 4
+)
+
+// ---------------------------------------------------------------------------
+// Diagnostics
+// ---------------------------------------------------------------------------
+
+// DiagnosticsErrorSamples is the number of recent 5xx responses kept for
+// /admin:diagnostics.
+const DiagnosticsErrorSamples = 20
+
+// Response-time SLO tracking. Each slo.targets pattern keeps the latencies
+// of its last SLOLatencySamples requests for percentiles, and per-minute
+// counts over SLOWindowMinutes for the burn rate. A target is at risk once
+// its burn rate reaches SLOAlertBurnRate over at least SLOMinRequests
+// requests.
+const (
+	DefaultSLOObjective = 0.99
+	SLOLatencySamples   = 1000
+	SLOWindowMinutes    = 60
+	SLOAlertBurnRate    = 2.0
+	SLOMinRequests      = 20
+)
+
+// ---------------------------------------------------------------------------
+// OIDC login
+// ---------------------------------------------------------------------------
+
+// Requests to the identity provider give up after OIDCTimeoutSeconds. A
+// login must be completed within OIDCStateTTLSeconds of op=start. Signing
+// keys are refetched for an unknown key id at most every
+// OIDCKeysRefreshSeconds, and ID token times may be off by
+// OIDCClockSkewSeconds.
+const (
+	OIDCTimeoutSeconds     = 10
+	OIDCStateTTLSeconds    = 600
+	OIDCKeysRefreshSeconds = 60
+	OIDCClockSkewSeconds   = 60
+
+	DefaultOIDCAutoProvision = true
+	DefaultOIDCDefaultRole   = "user"
+)
+
+// DefaultOIDCScopes are the scopes requested when oidc.scopes is not set.
+var DefaultOIDCScopes = []string{"openid", "email", "profile"}
+
+// ---------------------------------------------------------------------------
+// Mail and password reset
+// ---------------------------------------------------------------------------
+
+// mail.driver selects how email is delivered: through the SMTP server, or
+// written to the log by the console driver for development. Templates in
+// mail.template_dir replace the built-in message of the same name.
+const (
+	MailDriverSMTP    = "smtp"
+	MailDriverConsole = "console"
+	DefaultMailDriver = MailDriverSMTP
+)
+
+// Built-in mail templates.
+const (
+	MailTemplatePasswordReset = "password_reset"
+	MailTemplateInvitation    = "invitation"
+)
+
+// MailTemplateExt is the file extension of templates in mail.template_dir.
+const MailTemplateExt = ".tmpl"
+
+// SMTP connections give up after MailTimeoutSeconds. Password reset tokens
+// are valid for password_reset.token_ttl seconds, between
+// MinPasswordResetTokenTTL and MaxPasswordResetTokenTTL.
+const (
+	DefaultMailSMTPPort          = 587
+	MailTimeoutSeconds           = 10
+	DefaultPasswordResetTokenTTL = 3600
+	MinPasswordResetTokenTTL     = 300
+	MaxPasswordResetTokenTTL     = 86400
+)
+
+// Invitation tokens are valid for invitation.token_ttl seconds, between
+// MinInvitationTokenTTL and MaxInvitationTokenTTL.
+const (
+	DefaultInvitationTokenTTL = 604800 // 7 days
+	MinInvitationTokenTTL     = 3600
+	MaxInvitationTokenTTL     = 2592000 // 30 days
+)
+
+// ---------------------------------------------------------------------------
+// Password policy
+// ---------------------------------------------------------------------------
+
+// password_policy.min_length may not go below MinPasswordLength, nor above
+// MaxPasswordLength, the most bcrypt hashes. At most MaxPasswordHistory
+// previous passwords are kept per user. Account lockout is disabled by
+// default; once enabled, an account locks for
+// DefaultPasswordLockoutDuration seconds.
+const (
+	MaxPasswordLength               = 72
+	MaxPasswordHistory              = 24
+	DefaultPasswordRequireLowercase = true
+	DefaultPasswordRequireUppercase = true
+	DefaultPasswordRequireDigit     = true
+	DefaultPasswordRequireSymbol    = false
+	DefaultPasswordHistory          = 0
+	DefaultPasswordLockoutThreshold = 0
+	DefaultPasswordLockoutDuration  = 900
+)
+
+// ---------------------------------------------------------------------------
+// Error reporting
+// ---------------------------------------------------------------------------
+
+// Recovered panics are queued for the configured error reporter. At most
+// ErrorReportQueueSize reports wait to be sent; further reports are dropped
+// until the queue drains. Each delivery gives up after
+// ErrorReportTimeoutSeconds.
+const (
+	ErrorReportQueueSize      = 64
+	ErrorReportTimeoutSeconds = 5
+)
+
+// ---------------------------------------------------------------------------
+// Cache
+// ---------------------------------------------------------------------------
+
+const (
+	CacheBackendMemory  = "memory"
+	CacheBackendRedis   = "redis"
+	DefaultCacheBackend = CacheBackendMemory
+)
+
+// The Redis cache keeps up to CacheRedisPoolSize idle connections, gives
+// each command CacheRedisTimeoutSeconds, and prefixes every key with
+// CacheRedisKeyPrefix so Moon can share a Redis database.
+const (
+	CacheRedisPoolSize       = 16
+	CacheRedisTimeoutSeconds = 2
+	CacheRedisKeyPrefix      = "moon:"
+)
+
+// The query result cache holds up to DefaultCacheQueryMaxBytes of rows,
+// estimated from their values. CacheQueryTTLDefaultKey in cache.query_ttl
+// sets the TTL of every collection not listed by name.
+const (
+	DefaultCacheQueryMaxBytes = 32 << 20
+	CacheQueryTTLDefaultKey   = "*"
+)
+
+// ---------------------------------------------------------------------------
+// Tracing
+// ---------------------------------------------------------------------------
+
+// Ended spans wait in a queue of TraceQueueSize and are exported in batches
+// of up to TraceBatchSize, at least every TraceExportIntervalSeconds. Spans
+// ended while the queue is full are dropped. Each export gives up after
+// TraceExportTimeoutSeconds.
+const (
+	DefaultTracingServiceName  = "moon"
+	TraceQueueSize             = 2048
+	TraceBatchSize             = 256
+	TraceExportIntervalSeconds = 5
+	TraceExportTimeoutSeconds  = 10
+)
+
+// ---------------------------------------------------------------------------
+// Write retries
+// ---------------------------------------------------------------------------
+
+// Writes that fail with a transient database error are retried, up to
+// WriteRetryMaxAttempts attempts in total. Before retry n the adapter
+// sleeps a random duration of up to WriteRetryBaseDelayMs * 2^(n-1)
+// milliseconds, capped at WriteRetryMaxDelayMs. Every write earns
+// WriteRetryBudgetRatio retry tokens, up to WriteRetryBudgetMax, and every
+// retry spends one, so a database that stays locked is not hit with
+// several times the normal write load.
+const (
+	WriteRetryMaxAttempts = 4
+	WriteRetryBaseDelayMs = 10
+	WriteRetryMaxDelayMs  = 250
+	WriteRetryBudgetRatio = 0.1
+	WriteRetryBudgetMax   = 20
+)
+
+// ---------------------------------------------------------------------------
+// Prepared statements
+// ---------------------------------------------------------------------------
+
+// StmtCacheSize is how many prepared statements each database connection
+// pool keeps, keyed by SQL text. The least recently used is closed when
+// the cache is full, and every schema change empties it.
+const StmtCacheSize = 256
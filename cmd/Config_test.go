@@ -12,6 +12,7 @@ func TestConfigConstants(t *testing.T) {
 		assertEqual(t, DefaultServerPort, 6006)
 		assertEqual(t, DefaultServerPrefix, "")
 		assertEqual(t, DefaultServerLogpath, "/var/log/moon.log")
+		assertEqual(t, DefaultServerShutdownTimeout, 15)
 	})
 
 	t.Run("default database values", func(t *testing.T) {
@@ -49,47 +50,187 @@ func TestConfigConstants(t *testing.T) {
 // TestConfigKeyConstants ensures key name constants are the expected YAML paths.
 func TestConfigKeyConstants(t *testing.T) {
 	keys := map[string]string{
-		"KeyServerHost":                 KeyServerHost,
-		"KeyServerPort":                 KeyServerPort,
-		"KeyServerPrefix":               KeyServerPrefix,
-		"KeyServerLogpath":              KeyServerLogpath,
-		"KeyDatabaseConnection":         KeyDatabaseConnection,
-		"KeyDatabaseDatabase":           KeyDatabaseDatabase,
-		"KeyDatabaseUser":               KeyDatabaseUser,
-		"KeyDatabasePassword":           KeyDatabasePassword,
-		"KeyDatabaseHost":               KeyDatabaseHost,
-		"KeyDatabaseQueryTimeout":       KeyDatabaseQueryTimeout,
-		"KeyDatabaseSlowQueryThreshold": KeyDatabaseSlowQueryThreshold,
-		"KeyJWTSecret":                  KeyJWTSecret,
-		"KeyJWTAccessExpiry":            KeyJWTAccessExpiry,
-		"KeyJWTRefreshExpiry":           KeyJWTRefreshExpiry,
-		"KeyBootstrapAdminUsername":     KeyBootstrapAdminUsername,
-		"KeyBootstrapAdminEmail":        KeyBootstrapAdminEmail,
-		"KeyBootstrapAdminPassword":     KeyBootstrapAdminPassword,
-		"KeyCORSEnabled":                KeyCORSEnabled,
-		"KeyCORSAllowedOrigins":         KeyCORSAllowedOrigins,
+		"KeyServerHost":                     KeyServerHost,
+		"KeyServerPort":                     KeyServerPort,
+		"KeyServerPrefix":                   KeyServerPrefix,
+		"KeyServerLogpath":                  KeyServerLogpath,
+		"KeyServerShutdownTimeout":          KeyServerShutdownTimeout,
+		"KeyServerTLSCertFile":              KeyServerTLSCertFile,
+		"KeyServerTLSKeyFile":               KeyServerTLSKeyFile,
+		"KeyServerTLSACMEHosts":             KeyServerTLSACMEHosts,
+		"KeyServerTLSACMEEmail":             KeyServerTLSACMEEmail,
+		"KeyServerTLSACMECacheDir":          KeyServerTLSACMECacheDir,
+		"KeyServerTLSHSTSMaxAge":            KeyServerTLSHSTSMaxAge,
+		"KeyDatabaseConnection":             KeyDatabaseConnection,
+		"KeyDatabaseDatabase":               KeyDatabaseDatabase,
+		"KeyDatabaseUser":                   KeyDatabaseUser,
+		"KeyDatabasePassword":               KeyDatabasePassword,
+		"KeyDatabaseHost":                   KeyDatabaseHost,
+		"KeyDatabaseQueryTimeout":           KeyDatabaseQueryTimeout,
+		"KeyDatabaseSlowQueryThreshold":     KeyDatabaseSlowQueryThreshold,
+		"KeyDatabaseConnectRetries":         KeyDatabaseConnectRetries,
+		"KeyDatabaseConnectMaxDelay":        KeyDatabaseConnectMaxDelay,
+		"KeyDatabaseHealthInterval":         KeyDatabaseHealthInterval,
+		"KeyDatabaseReplicas":               KeyDatabaseReplicas,
+		"KeyJWTSecret":                      KeyJWTSecret,
+		"KeyJWTAccessExpiry":                KeyJWTAccessExpiry,
+		"KeyJWTRefreshExpiry":               KeyJWTRefreshExpiry,
+		"KeyJWTAlgorithm":                   KeyJWTAlgorithm,
+		"KeyJWTKeyFile":                     KeyJWTKeyFile,
+		"KeyJWTPreviousKeyFiles":            KeyJWTPreviousKeyFiles,
+		"KeyBootstrapAdminUsername":         KeyBootstrapAdminUsername,
+		"KeyBootstrapAdminEmail":            KeyBootstrapAdminEmail,
+		"KeyBootstrapAdminPassword":         KeyBootstrapAdminPassword,
+		"KeyBundleKey":                      KeyBundleKey,
+		"KeyCacheBackend":                   KeyCacheBackend,
+		"KeyCacheRedisURL":                  KeyCacheRedisURL,
+		"KeyCacheQueryTTL":                  KeyCacheQueryTTL,
+		"KeyCacheQueryMaxBytes":             KeyCacheQueryMaxBytes,
+		"KeyTracingOTLPEndpoint":            KeyTracingOTLPEndpoint,
+		"KeyTracingServiceName":             KeyTracingServiceName,
+		"KeyServerPprof":                    KeyServerPprof,
+		"KeyServerLogLevel":                 KeyServerLogLevel,
+		"KeyServerCompression":              KeyServerCompression,
+		"KeyLimitsJWTRequestsPerMinute":     KeyLimitsJWTRequestsPerMinute,
+		"KeyLimitsMaxBatchOperations":       KeyLimitsMaxBatchOperations,
+		"KeyLimitsMaxPerPage":               KeyLimitsMaxPerPage,
+		"KeyLimitsDefaultPerPage":           KeyLimitsDefaultPerPage,
+		"KeyLimitsMaxRequestBody":           KeyLimitsMaxRequestBody,
+		"KeyLimitsMaxConcurrentRequests":    KeyLimitsMaxConcurrentRequests,
+		"KeyLimitsRoutes":                   KeyLimitsRoutes,
+		"KeySLOObjective":                   KeySLOObjective,
+		"KeySLOTargets":                     KeySLOTargets,
+		"KeyOIDCIssuer":                     KeyOIDCIssuer,
+		"KeyOIDCClientID":                   KeyOIDCClientID,
+		"KeyOIDCClientSecret":               KeyOIDCClientSecret,
+		"KeyOIDCRedirectURI":                KeyOIDCRedirectURI,
+		"KeyOIDCScopes":                     KeyOIDCScopes,
+		"KeyOIDCAutoProvision":              KeyOIDCAutoProvision,
+		"KeyOIDCDefaultRole":                KeyOIDCDefaultRole,
+		"KeyWellKnownRobotsTxt":             KeyWellKnownRobotsTxt,
+		"KeyWellKnownSecurityTxt":           KeyWellKnownSecurityTxt,
+		"KeyPasswordPolicyMinLength":        KeyPasswordPolicyMinLength,
+		"KeyPasswordPolicyRequireLowercase": KeyPasswordPolicyRequireLowercase,
+		"KeyPasswordPolicyRequireUppercase": KeyPasswordPolicyRequireUppercase,
+		"KeyPasswordPolicyRequireDigit":     KeyPasswordPolicyRequireDigit,
+		"KeyPasswordPolicyRequireSymbol":    KeyPasswordPolicyRequireSymbol,
+		"KeyPasswordPolicyHistory":          KeyPasswordPolicyHistory,
+		"KeyPasswordPolicyLockoutThreshold": KeyPasswordPolicyLockoutThreshold,
+		"KeyPasswordPolicyLockoutDuration":  KeyPasswordPolicyLockoutDuration,
+		"KeyMailSMTPHost":                   KeyMailSMTPHost,
+		"KeyMailSMTPPort":                   KeyMailSMTPPort,
+		"KeyMailSMTPUsername":               KeyMailSMTPUsername,
+		"KeyMailSMTPPassword":               KeyMailSMTPPassword,
+		"KeyMailFrom":                       KeyMailFrom,
+		"KeyMailDriver":                     KeyMailDriver,
+		"KeyMailTemplateDir":                KeyMailTemplateDir,
+		"KeyPasswordResetURL":               KeyPasswordResetURL,
+		"KeyPasswordResetTokenTTL":          KeyPasswordResetTokenTTL,
+		"KeyInvitationURL":                  KeyInvitationURL,
+		"KeyInvitationTokenTTL":             KeyInvitationTokenTTL,
+		"KeyErrorReportingSentryDSN":        KeyErrorReportingSentryDSN,
+		"KeyErrorReportingEnvironment":      KeyErrorReportingEnvironment,
+		"KeyCORSEnabled":                    KeyCORSEnabled,
+		"KeyAggregatePrivacyEpsilon":        KeyAggregatePrivacyEpsilon,
+		"KeyAggregatePrivacyMinGroupSize":   KeyAggregatePrivacyMinGroupSize,
+		"KeyCORSAllowedOrigins":             KeyCORSAllowedOrigins,
+		"KeyCORSAllowedMethods":             KeyCORSAllowedMethods,
+		"KeyCORSAllowedHeaders":             KeyCORSAllowedHeaders,
+		"KeyCORSAllowCredentials":           KeyCORSAllowCredentials,
+		"KeyCORSMaxAge":                     KeyCORSMaxAge,
+		"KeyCORSOrigins":                    KeyCORSOrigins,
 	}
 
 	expected := map[string]string{
-		"KeyServerHost":                 "server.host",
-		"KeyServerPort":                 "server.port",
-		"KeyServerPrefix":               "server.prefix",
-		"KeyServerLogpath":              "server.logpath",
-		"KeyDatabaseConnection":         "database.connection",
-		"KeyDatabaseDatabase":           "database.database",
-		"KeyDatabaseUser":               "database.user",
-		"KeyDatabasePassword":           "database.password",
-		"KeyDatabaseHost":               "database.host",
-		"KeyDatabaseQueryTimeout":       "database.query_timeout",
-		"KeyDatabaseSlowQueryThreshold": "database.slow_query_threshold",
-		"KeyJWTSecret":                  "jwt_secret",
-		"KeyJWTAccessExpiry":            "jwt_access_expiry",
-		"KeyJWTRefreshExpiry":           "jwt_refresh_expiry",
-		"KeyBootstrapAdminUsername":     "bootstrap_admin_username",
-		"KeyBootstrapAdminEmail":        "bootstrap_admin_email",
-		"KeyBootstrapAdminPassword":     "bootstrap_admin_password",
-		"KeyCORSEnabled":                "cors.enabled",
-		"KeyCORSAllowedOrigins":         "cors.allowed_origins",
+		"KeyServerHost":                     "server.host",
+		"KeyServerPort":                     "server.port",
+		"KeyServerPrefix":                   "server.prefix",
+		"KeyServerLogpath":                  "server.logpath",
+		"KeyServerShutdownTimeout":          "server.shutdown_timeout",
+		"KeyServerTLSCertFile":              "server.tls.cert_file",
+		"KeyServerTLSKeyFile":               "server.tls.key_file",
+		"KeyServerTLSACMEHosts":             "server.tls.acme_hosts",
+		"KeyServerTLSACMEEmail":             "server.tls.acme_email",
+		"KeyServerTLSACMECacheDir":          "server.tls.acme_cache_dir",
+		"KeyServerTLSHSTSMaxAge":            "server.tls.hsts_max_age",
+		"KeyDatabaseConnection":             "database.connection",
+		"KeyDatabaseDatabase":               "database.database",
+		"KeyDatabaseUser":                   "database.user",
+		"KeyDatabasePassword":               "database.password",
+		"KeyDatabaseHost":                   "database.host",
+		"KeyDatabaseQueryTimeout":           "database.query_timeout",
+		"KeyDatabaseSlowQueryThreshold":     "database.slow_query_threshold",
+		"KeyDatabaseConnectRetries":         "database.connect_retries",
+		"KeyDatabaseConnectMaxDelay":        "database.connect_max_delay",
+		"KeyDatabaseHealthInterval":         "database.health_check_interval",
+		"KeyDatabaseReplicas":               "database.replicas",
+		"KeyJWTSecret":                      "jwt_secret",
+		"KeyJWTAccessExpiry":                "jwt_access_expiry",
+		"KeyJWTRefreshExpiry":               "jwt_refresh_expiry",
+		"KeyJWTAlgorithm":                   "jwt_algorithm",
+		"KeyJWTKeyFile":                     "jwt_key_file",
+		"KeyJWTPreviousKeyFiles":            "jwt_previous_key_files",
+		"KeyBootstrapAdminUsername":         "bootstrap_admin_username",
+		"KeyBootstrapAdminEmail":            "bootstrap_admin_email",
+		"KeyBootstrapAdminPassword":         "bootstrap_admin_password",
+		"KeyBundleKey":                      "bundle_key",
+		"KeyCacheBackend":                   "cache.backend",
+		"KeyCacheRedisURL":                  "cache.redis_url",
+		"KeyCacheQueryTTL":                  "cache.query_ttl",
+		"KeyCacheQueryMaxBytes":             "cache.query_max_bytes",
+		"KeyTracingOTLPEndpoint":            "tracing.otlp_endpoint",
+		"KeyTracingServiceName":             "tracing.service_name",
+		"KeyServerPprof":                    "server.pprof",
+		"KeyServerLogLevel":                 "server.log_level",
+		"KeyServerCompression":              "server.compression",
+		"KeyLimitsJWTRequestsPerMinute":     "limits.jwt_requests_per_minute",
+		"KeyLimitsMaxBatchOperations":       "limits.max_batch_operations",
+		"KeyLimitsMaxPerPage":               "limits.max_per_page",
+		"KeyLimitsDefaultPerPage":           "limits.default_per_page",
+		"KeyLimitsMaxRequestBody":           "limits.max_request_body",
+		"KeyLimitsMaxConcurrentRequests":    "limits.max_concurrent_requests",
+		"KeyLimitsRoutes":                   "limits.routes",
+		"KeySLOObjective":                   "slo.objective",
+		"KeySLOTargets":                     "slo.targets",
+		"KeyOIDCIssuer":                     "oidc.issuer",
+		"KeyOIDCClientID":                   "oidc.client_id",
+		"KeyOIDCClientSecret":               "oidc.client_secret",
+		"KeyOIDCRedirectURI":                "oidc.redirect_uri",
+		"KeyOIDCScopes":                     "oidc.scopes",
+		"KeyOIDCAutoProvision":              "oidc.auto_provision",
+		"KeyOIDCDefaultRole":                "oidc.default_role",
+		"KeyWellKnownRobotsTxt":             "well_known.robots_txt",
+		"KeyWellKnownSecurityTxt":           "well_known.security_txt",
+		"KeyPasswordPolicyMinLength":        "password_policy.min_length",
+		"KeyPasswordPolicyRequireLowercase": "password_policy.require_lowercase",
+		"KeyPasswordPolicyRequireUppercase": "password_policy.require_uppercase",
+		"KeyPasswordPolicyRequireDigit":     "password_policy.require_digit",
+		"KeyPasswordPolicyRequireSymbol":    "password_policy.require_symbol",
+		"KeyPasswordPolicyHistory":          "password_policy.history",
+		"KeyPasswordPolicyLockoutThreshold": "password_policy.lockout_threshold",
+		"KeyPasswordPolicyLockoutDuration":  "password_policy.lockout_duration",
+		"KeyMailSMTPHost":                   "mail.smtp_host",
+		"KeyMailSMTPPort":                   "mail.smtp_port",
+		"KeyMailSMTPUsername":               "mail.smtp_username",
+		"KeyMailSMTPPassword":               "mail.smtp_password",
+		"KeyMailFrom":                       "mail.from",
+		"KeyMailDriver":                     "mail.driver",
+		"KeyMailTemplateDir":                "mail.template_dir",
+		"KeyPasswordResetURL":               "password_reset.url",
+		"KeyPasswordResetTokenTTL":          "password_reset.token_ttl",
+		"KeyInvitationURL":                  "invitation.url",
+		"KeyInvitationTokenTTL":             "invitation.token_ttl",
+		"KeyErrorReportingSentryDSN":        "error_reporting.sentry_dsn",
+		"KeyErrorReportingEnvironment":      "error_reporting.environment",
+		"KeyCORSEnabled":                    "cors.enabled",
+		"KeyAggregatePrivacyEpsilon":        "aggregate_privacy.epsilon",
+		"KeyAggregatePrivacyMinGroupSize":   "aggregate_privacy.min_group_size",
+		"KeyCORSAllowedOrigins":             "cors.allowed_origins",
+		"KeyCORSAllowedMethods":             "cors.allowed_methods",
+		"KeyCORSAllowedHeaders":             "cors.allowed_headers",
+		"KeyCORSAllowCredentials":           "cors.allow_credentials",
+		"KeyCORSMaxAge":                     "cors.max_age",
+		"KeyCORSOrigins":                    "cors.origins",
 	}
 
 	for name, got := range keys {
@@ -2,7 +2,12 @@ package main
 
 import (
 	"context"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"net"
+	"regexp"
+	"strings"
 	"time"
 )
 
@@ -23,28 +28,200 @@ type DatabaseAdapter interface {
 	// ExecDDL executes a raw DDL statement (CREATE TABLE, ALTER, etc.).
 	ExecDDL(ctx context.Context, ddl string) error
 
+	// ExecDDLBatch executes the statements in order inside a single
+	// transaction. Either every statement is applied or none is.
+	ExecDDLBatch(ctx context.Context, statements []string) error
+
 	// QueryRows returns rows matching the given options. It returns the
 	// result rows, the total count of matching rows (before pagination),
 	// and any error.
 	QueryRows(ctx context.Context, table string, opts QueryOptions) ([]map[string]any, int, error)
 
+	// ReadSnapshot calls read with a reader whose queries all see the
+	// database as it was when the first of them ran, so results spread over
+	// several pages are consistent with each other. The snapshot is
+	// released when read returns.
+	ReadSnapshot(ctx context.Context, read func(SnapshotReader) error) error
+
 	// InsertRow inserts a single row into the given table.
 	InsertRow(ctx context.Context, table string, data map[string]any) error
 
+	// InsertRows inserts every row inside a single transaction. Either all
+	// rows are inserted or none is.
+	InsertRows(ctx context.Context, table string, rows []map[string]any) error
+
 	// UpdateRow updates the row identified by id in the given table.
 	UpdateRow(ctx context.Context, table string, id string, data map[string]any) error
 
+	// UpdateRowVersion updates the row identified by id and increments its
+	// _version column in the same statement. When expected is non-zero, the
+	// row is only updated if its _version equals expected. It reports
+	// whether a row was updated.
+	UpdateRowVersion(ctx context.Context, table string, id string, expected int64, data map[string]any) (bool, error)
+
 	// DeleteRow deletes the row identified by id from the given table.
 	DeleteRow(ctx context.Context, table string, id string) error
 
+	// ExecWriteBatch applies the writes in order inside a single
+	// transaction. An update or delete that matches no row fails with
+	// ErrNoRowAffected. On failure nothing is applied, and the returned
+	// index identifies the failing write.
+	ExecWriteBatch(ctx context.Context, writes []BatchWrite) (int, error)
+
+	// UpdateWhere sets data on every row matching filters in one UPDATE,
+	// incrementing _version when versioned is set. DeleteWhere deletes the
+	// matching rows in one DELETE. Both return the number of rows changed.
+	// When that is more than limit, nothing is changed and they fail with
+	// ErrTooManyRows.
+	UpdateWhere(ctx context.Context, table string, filters []Filter, data map[string]any, versioned bool, limit int) (int, error)
+	DeleteWhere(ctx context.Context, table string, filters []Filter, limit int) (int, error)
+
 	// ListTables returns the names of all physical user tables.
 	ListTables(ctx context.Context) ([]string, error)
 
 	// DescribeTable returns column definitions for the given table.
 	DescribeTable(ctx context.Context, table string) ([]ColumnInfo, error)
 
+	// ListIndexes returns the indexes created with CREATE INDEX on the
+	// given table, sorted by name. Indexes that back PRIMARY KEY and
+	// UNIQUE column constraints are not included.
+	ListIndexes(ctx context.Context, table string) ([]IndexInfo, error)
+
+	// CreateIndex creates idx on the given table.
+	CreateIndex(ctx context.Context, table string, idx IndexInfo) error
+
+	// DropIndex drops the named index from the given table.
+	DropIndex(ctx context.Context, table, name string) error
+
 	// CountRows returns the number of rows in the given table.
 	CountRows(ctx context.Context, table string) (int, error)
+
+	// NumericHistogram computes summary statistics and equal-width bucket
+	// counts for a numeric column over the rows matching filters. NULL
+	// values are ignored.
+	NumericHistogram(ctx context.Context, table, field string, buckets int, filters []Filter) (*HistogramResult, error)
+
+	// TimeSeries groups rows into calendar buckets of a datetime column and
+	// aggregates a numeric column per bucket. Only non-empty buckets are
+	// returned; gap filling is the caller's responsibility.
+	TimeSeries(ctx context.Context, table string, q TimeSeriesQuery) ([]TimeSeriesPoint, error)
+
+	// Pivot groups rows by two fields and aggregates a numeric column per
+	// (row, column) pair. Only non-empty cells are returned.
+	Pivot(ctx context.Context, table string, q PivotQuery) ([]PivotCell, error)
+}
+
+// SnapshotReader runs queries against the snapshot opened by
+// DatabaseAdapter.ReadSnapshot. QueryRows behaves as on the adapter.
+type SnapshotReader interface {
+	QueryRows(ctx context.Context, table string, opts QueryOptions) ([]map[string]any, int, error)
+}
+
+// RowStreamer is implemented by adapters that can hand the rows of a
+// QueryRows page to a callback as they are scanned, so a large page is
+// never held in memory at once.
+type RowStreamer interface {
+	// StreamRows runs the query QueryRows would run and calls each for
+	// every row, in order. An error from each stops the scan and is
+	// returned. The total is the one QueryRows returns.
+	StreamRows(ctx context.Context, table string, opts QueryOptions, each func(map[string]any) error) (int, error)
+}
+
+// ShadowTable names the tables of one shadow rebuild of Table: Name is
+// the copy with the new shape, and Columns are copied from Table into it.
+// The change log, trigger, and retired table names derive from Name.
+type ShadowTable struct {
+	Table   string
+	Name    string
+	Columns []string
+}
+
+// logTable returns the table recording the ids written during the copy.
+func (s ShadowTable) logTable() string { return s.Name + "_log" }
+
+// oldTable returns the name the original table is retired under by an
+// adapter that renames it before dropping it.
+func (s ShadowTable) oldTable() string { return s.Name + "_old" }
+
+// trigger returns the name of the change-tracking trigger for op.
+func (s ShadowTable) trigger(op string) string { return s.Name + "_" + op }
+
+// columnList returns the quoted, comma-separated Columns.
+func (s ShadowTable) columnList() string {
+	cols := make([]string, len(s.Columns))
+	for i, c := range s.Columns {
+		cols[i] = quoteIdent(c)
+	}
+	return strings.Join(cols, ", ")
+}
+
+// ShadowRebuilder is implemented by adapters that can rebuild a table
+// through a shadow copy while the table stays writable. The caller
+// creates the shadow table with ExecDDL first.
+type ShadowRebuilder interface {
+	// TrackShadowChanges creates the change log of s and triggers that
+	// record in it the id of every row of s.Table written from now on.
+	TrackShadowChanges(ctx context.Context, s ShadowTable) error
+
+	// CopyShadowBatch copies the first limit rows of s.Table with an id
+	// greater than after into the shadow table, in id order. It returns
+	// the last id copied and the number of rows; 0 once the copy is done.
+	CopyShadowBatch(ctx context.Context, s ShadowTable, after string, limit int) (string, int, error)
+
+	// SwapShadowTable copies the logged rows again, replaces s.Table by
+	// the shadow table with indexes, and drops the change log, without
+	// a moment at which s.Table is missing or a write is lost.
+	SwapShadowTable(ctx context.Context, s ShadowTable, indexes []IndexInfo) error
+
+	// DropShadowTable discards the rebuild: the triggers, the change log,
+	// and the shadow table are dropped, and s.Table is left unchanged.
+	DropShadowTable(ctx context.Context, s ShadowTable) error
+}
+
+// errShadowUnsupported is returned for a shadow rebuild on an adapter
+// that is not a ShadowRebuilder.
+var errShadowUnsupported = errors.New("shadow table rebuilds are not supported by this database")
+
+// shadowBatchSQL returns the statements of one CopyShadowBatch. The first
+// selects the last id and the row count of the next batch after a bound
+// id; the second copies the rows between two bound ids.
+func shadowBatchSQL(s ShadowTable) (string, string) {
+	t, id, cols := quoteIdent(s.Table), quoteIdent("id"), s.columnList()
+	bound := fmt.Sprintf("SELECT MAX(%s), COUNT(*) FROM (SELECT %s FROM %s WHERE %s > ? ORDER BY %s LIMIT ?) AS %s",
+		id, id, t, id, id, quoteIdent("batch"))
+	copyRows := fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s WHERE %s > ? AND %s <= ?",
+		quoteIdent(s.Name), cols, cols, t, id, id)
+	return bound, copyRows
+}
+
+// shadowCatchUpSQL returns the statements that copy the rows named in
+// the change log of s into the shadow table again: rows destroyed since
+// they were copied are removed, and the current version of the others
+// replaces the copied one.
+func shadowCatchUpSQL(s ShadowTable) []string {
+	t, sh, log, id, cols := quoteIdent(s.Table), quoteIdent(s.Name), quoteIdent(s.logTable()), quoteIdent("id"), s.columnList()
+	return []string{
+		fmt.Sprintf("DELETE FROM %s WHERE %s IN (SELECT %s FROM %s)", sh, id, id, log),
+		fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s WHERE %s IN (SELECT %s FROM %s)", sh, cols, cols, t, id, id, log),
+	}
+}
+
+// streamRows calls each for every row of the QueryRows page selected by
+// opts, streaming them when db is a RowStreamer.
+func streamRows(ctx context.Context, db DatabaseAdapter, table string, opts QueryOptions, each func(map[string]any) error) (int, error) {
+	if s, ok := db.(RowStreamer); ok {
+		return s.StreamRows(ctx, table, opts, each)
+	}
+	rows, total, err := db.QueryRows(ctx, table, opts)
+	if err != nil {
+		return 0, err
+	}
+	for _, row := range rows {
+		if err := each(row); err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
 }
 
 // ---------------------------------------------------------------------------
@@ -54,14 +231,19 @@ type DatabaseAdapter interface {
 // Filter represents a single column filter.
 type Filter struct {
 	Field string
-	Op    string // "eq", "ne", "gt", "gte", "lt", "lte", "like", "in"
+	Op    string // "eq", "ne", "gt", "gte", "lt", "lte", "like", "ieq", "ilike", "in", "is_null", "not_null"
 	Value any
+
+	// Path, when set, names a key of the JSON column Field. The filter then
+	// applies to that key's value instead of the whole column.
+	Path string
 }
 
 // SortField represents a single sort directive.
 type SortField struct {
 	Field string
 	Desc  bool
+	Nulls string // NullsFirst, NullsLast, or empty for the database default
 }
 
 // QueryOptions carries filtering, sorting, pagination, and projection
@@ -76,23 +258,204 @@ type QueryOptions struct {
 	SearchFields []string
 }
 
+// Batch write operations.
+const (
+	BatchInsert = "insert"
+	BatchUpdate = "update"
+	BatchDelete = "delete"
+	BatchUpsert = "upsert"
+)
+
+// BatchWrite is one row change applied by ExecWriteBatch.
+type BatchWrite struct {
+	Op    string // BatchInsert, BatchUpdate, BatchDelete, or BatchUpsert
+	Table string
+	ID    string         // update and delete
+	Data  map[string]any // insert, update, and upsert
+
+	// Versioned makes an update or upserted update increment _version.
+	// When ExpectedVersion is non-zero the update only matches the row at
+	// that version.
+	Versioned       bool
+	ExpectedVersion int64
+
+	// Key is the unique column an upsert matches on. When a row with the
+	// same Key value exists, its Update columns are set from Data instead
+	// of inserting Data.
+	Key    string
+	Update []string
+
+	// Guard restricts an update, a delete, or an upserted update to a row
+	// whose columns hold the Guard values. A row the guard rejects fails
+	// the write with ErrNoRowAffected.
+	Guard map[string]any
+}
+
+// ErrNoRowAffected reports a batch update or delete that matched no row,
+// or a guarded write that found a row it may not change.
+var ErrNoRowAffected = errors.New("no row affected")
+
+// ErrTooManyRows reports an UpdateWhere or DeleteWhere that would change
+// more rows than its limit.
+var ErrTooManyRows = errors.New("too many rows affected")
+
+// ---------------------------------------------------------------------------
+// Aggregate result types
+// ---------------------------------------------------------------------------
+
+// HistogramResult holds summary statistics and bucketed counts for a
+// numeric column. Min, Max, Avg, and Percentiles are zero when Count is 0.
+type HistogramResult struct {
+	Count       int
+	Min         float64
+	Max         float64
+	Avg         float64
+	Percentiles map[int]float64 // keyed by percentile rank, e.g. 50 → median
+	Buckets     []HistogramBucket
+}
+
+// HistogramBucket is one equal-width bucket. Lower is inclusive; Upper is
+// exclusive except for the last bucket, which includes the maximum.
+type HistogramBucket struct {
+	Lower float64
+	Upper float64
+	Count int
+}
+
+// TimeSeriesQuery describes a time-series rollup. Rows whose DateField
+// falls in [From, To) are shifted into local time using Offsets, truncated
+// to Interval, and aggregated with Agg over ValueField.
+type TimeSeriesQuery struct {
+	DateField  string
+	ValueField string // empty when Agg is "count"
+	Interval   string // "hour", "day", "week", "month", or "year"
+	Agg        string // "sum", "avg", "min", "max", or "count"
+	From       time.Time
+	To         time.Time
+	Offsets    []UTCOffsetSpan
+	Filters    []Filter
+}
+
+// UTCOffsetSpan is a UTC offset in effect for instants before Until. The
+// final span in a list has a zero Until and applies to all later instants.
+type UTCOffsetSpan struct {
+	Until   time.Time
+	Seconds int
+}
+
+// TimeSeriesPoint is one aggregated bucket. Bucket is the local wall-clock
+// start of the bucket formatted as "2006-01-02T15:04:05".
+type TimeSeriesPoint struct {
+	Bucket string
+	Value  float64
+	Count  int
+}
+
+// PivotQuery describes a crosstab aggregation. RowInterval and
+// ColumnInterval, when set, truncate a datetime field to a UTC calendar
+// bucket using the same interval names as TimeSeriesQuery.
+type PivotQuery struct {
+	RowField       string
+	RowInterval    string
+	ColumnField    string
+	ColumnInterval string
+	ValueField     string // empty when Agg is "count"
+	Agg            string
+	Filters        []Filter
+	Limit          int // when positive, at most Limit cells are returned
+}
+
+// PivotCell is one aggregated (row, column) pair. Keys are the text form
+// of the grouped values; NULL groups use the empty string.
+type PivotCell struct {
+	Row    string
+	Column string
+	Value  float64
+	Count  int
+}
+
 // ---------------------------------------------------------------------------
 // Column introspection
 // ---------------------------------------------------------------------------
 
 // ColumnInfo describes a single column in a physical table.
 type ColumnInfo struct {
-	Name     string
-	Type     string
-	Nullable bool
-	PK       bool
-	Unique   bool // single-column UNIQUE constraint (excludes PK)
+	Name      string
+	Type      string
+	Nullable  bool
+	PK        bool
+	Unique    bool       // single-column UNIQUE constraint (excludes PK)
+	Collation string     // declared collation, lowercased; empty means binary
+	Rules     FieldRules // value rules recovered from column CHECK constraints
+}
+
+// IndexInfo describes a secondary index. Columns are listed in index order.
+type IndexInfo struct {
+	Name    string
+	Columns []string
+	Unique  bool
+}
+
+// createIndexSQL returns the CREATE INDEX statement for idx in the given
+// dialect (DBConnectionSQLite, DBConnectionPostgres, or DBConnectionMySQL).
+func createIndexSQL(dialect, table string, idx IndexInfo) string {
+	quote := dialectQuoter(dialect)
+	cols := make([]string, len(idx.Columns))
+	for i, c := range idx.Columns {
+		cols[i] = quote(c)
+	}
+	kind := "INDEX"
+	if idx.Unique {
+		kind = "UNIQUE INDEX"
+	}
+	return fmt.Sprintf("CREATE %s %s ON %s (%s)", kind, quote(idx.Name), quote(table), strings.Join(cols, ", "))
+}
+
+// dropIndexSQL returns the DROP INDEX statement for the given dialect.
+// MySQL scopes index names to a table; SQLite and PostgreSQL do not.
+func dropIndexSQL(dialect, table, name string) string {
+	quote := dialectQuoter(dialect)
+	if dialect == DBConnectionMySQL {
+		return fmt.Sprintf("DROP INDEX %s ON %s", quote(name), quote(table))
+	}
+	return fmt.Sprintf("DROP INDEX %s", quote(name))
+}
+
+// dialectQuoter returns the identifier quoting function for a dialect.
+func dialectQuoter(dialect string) func(string) string {
+	if dialect == DBConnectionMySQL {
+		return func(name string) string {
+			return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+		}
+	}
+	return quoteIdent
 }
 
 // ---------------------------------------------------------------------------
 // Adapter errors
 // ---------------------------------------------------------------------------
 
+// Sentinel errors classify database failures independently of the
+// backend. Adapters map driver-specific codes onto them, so callers test
+// with errors.Is instead of matching driver messages.
+var (
+	// ErrNotFound reports that the requested row does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrUniqueViolation reports a write that broke a unique or primary
+	// key constraint.
+	ErrUniqueViolation = errors.New("unique constraint violation")
+	// ErrForeignKey reports a write that broke a foreign key constraint.
+	ErrForeignKey = errors.New("foreign key violation")
+	// ErrCheckViolation reports a write that broke a CHECK constraint.
+	ErrCheckViolation = errors.New("check constraint violation")
+	// ErrNotNull reports a write that left a NOT NULL column without a
+	// value.
+	ErrNotNull = errors.New("not null violation")
+	// ErrUnavailable reports that the database could not be reached, such
+	// as a refused or dropped connection. A later attempt may succeed.
+	ErrUnavailable = errors.New("database unavailable")
+)
+
 // AdapterError wraps backend-specific errors so SQL details never leak
 // into API responses.
 type AdapterError struct {
@@ -100,6 +463,7 @@ type AdapterError struct {
 	Table   string
 	Message string
 	Err     error // underlying backend error
+	Kind    error // one of the sentinel errors above, or nil
 }
 
 func (e *AdapterError) Error() string {
@@ -113,14 +477,110 @@ func (e *AdapterError) Unwrap() error {
 	return e.Err
 }
 
-// newAdapterError creates an AdapterError wrapping the underlying error.
+// Is reports whether target is the sentinel the error was classified as.
+func (e *AdapterError) Is(target error) bool {
+	return e.Kind != nil && e.Kind == target
+}
+
+// newAdapterError creates an AdapterError wrapping the underlying error and
+// classifies it against the sentinel errors.
 func newAdapterError(op, table, message string, err error) *AdapterError {
 	return &AdapterError{
 		Op:      op,
 		Table:   table,
 		Message: message,
 		Err:     err,
+		Kind:    dbErrorKind(err),
+	}
+}
+
+// dbErrorKind returns the sentinel error that err maps to, or nil when the
+// error is not one of the classified failures.
+func dbErrorKind(err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, kind := range []error{ErrNotFound, ErrUniqueViolation, ErrForeignKey, ErrCheckViolation, ErrNotNull, ErrUnavailable} {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+	if kind := sqliteErrorKind(err); kind != nil {
+		return kind
+	}
+	if kind := mysqlErrorKind(err); kind != nil {
+		return kind
+	}
+	if kind := postgresErrorKind(err); kind != nil {
+		return kind
+	}
+	if isConnectionError(err) {
+		return ErrUnavailable
+	}
+	return nil
+}
+
+// connectionErrors are fragments of driver error messages for failures to
+// reach the database: dropped or refused connections, PostgreSQL
+// connection exceptions (SQLSTATE class 08) and shutdowns. MySQL's
+// connection limit is mapped by mysqlErrorKind.
+var connectionErrors = []string{
+	"bad connection",
+	"invalid connection",
+	"connection refused",
+	"connection reset",
+	"broken pipe",
+	"no such host",
+	"server closed the connection",
+	"sqlstate 08",
+	"sqlstate 57p01",
+	"sqlstate 57p03",
+	"the database system is starting up",
+}
+
+// isConnectionError reports whether err is a failure to reach the
+// database rather than a failure of the statement.
+func isConnectionError(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+	for _, msg := range errorMessages(err) {
+		lower := strings.ToLower(msg)
+		for _, fragment := range connectionErrors {
+			if strings.Contains(lower, fragment) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// postgresStates maps PostgreSQL SQLSTATE codes to sentinel errors.
+var postgresStates = map[string]error{
+	"23505": ErrUniqueViolation,
+	"23503": ErrForeignKey,
+	"23514": ErrCheckViolation,
+	"23502": ErrNotNull,
+}
+
+// postgresStateRe finds the SQLSTATE code that PostgreSQL drivers append
+// to error text.
+var postgresStateRe = regexp.MustCompile(`SQLSTATE ([0-9A-Z]{5})`)
+
+// postgresErrorKind maps the SQLSTATE code of a PostgreSQL error to a
+// sentinel error. The SQLite and MySQL drivers expose typed codes and are
+// handled by sqliteErrorKind and mysqlErrorKind.
+func postgresErrorKind(err error) error {
+	for _, msg := range errorMessages(err) {
+		if m := postgresStateRe.FindStringSubmatch(msg); m != nil {
+			return postgresStates[m[1]]
+		}
 	}
+	return nil
 }
 
 // ---------------------------------------------------------------------------
@@ -148,11 +608,14 @@ func NewDatabaseAdapter(cfg DatabaseConfig, logger *Logger) (DatabaseAdapter, er
 // ---------------------------------------------------------------------------
 
 // logSlowQuery emits a warning if duration exceeds the configured threshold.
-func logSlowQuery(logger *Logger, table, op string, start time.Time, thresholdMs int) {
+// Every adapter operation reports here, so it also records the operation's
+// span when the request is traced.
+func logSlowQuery(ctx context.Context, logger *Logger, table, op string, start time.Time, thresholdMs int) {
+	recordQuerySpan(ctx, table, op, start)
 	elapsed := time.Since(start)
 	ms := elapsed.Milliseconds()
 	if ms > int64(thresholdMs) {
-		logger.Warn("slow query",
+		logger.WarnContext(ctx, "slow query",
 			"table", table,
 			"op", op,
 			"duration_ms", ms,
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// ---------------------------------------------------------------------------
+// Handler conformance
+//
+// runHandlerConformance drives the collection, mutate, and query handlers
+// against an adapter, so every backend is held to the same behavior. It
+// always runs on SQLite. To run it on MySQL, point MOON_TEST_MYSQL_HOST,
+// MOON_TEST_MYSQL_DATABASE, MOON_TEST_MYSQL_USER, and
+// MOON_TEST_MYSQL_PASSWORD at an empty, disposable database.
+// ---------------------------------------------------------------------------
+
+func TestHandlerConformance_SQLite(t *testing.T) {
+	runHandlerConformance(t, testSQLiteAdapter(t))
+}
+
+func TestHandlerConformance_MySQL(t *testing.T) {
+	host := os.Getenv("MOON_TEST_MYSQL_HOST")
+	if host == "" {
+		t.Skip("MOON_TEST_MYSQL_HOST not set")
+	}
+	adapter, err := NewMySQLAdapter(DatabaseConfig{
+		Connection:         DBConnectionMySQL,
+		Host:               host,
+		Database:           os.Getenv("MOON_TEST_MYSQL_DATABASE"),
+		User:               os.Getenv("MOON_TEST_MYSQL_USER"),
+		Password:           os.Getenv("MOON_TEST_MYSQL_PASSWORD"),
+		QueryTimeout:       10,
+		SlowQueryThreshold: 500,
+	}, NewTestLogger(&bytes.Buffer{}))
+	if err != nil {
+		t.Fatalf("NewMySQLAdapter: %v", err)
+	}
+	t.Cleanup(func() { adapter.Close() })
+	runHandlerConformance(t, adapter)
+}
+
+func runHandlerConformance(t *testing.T, db DatabaseAdapter) {
+	ctx := context.Background()
+	if err := EnsureSystemTables(ctx, db); err != nil {
+		t.Fatalf("EnsureSystemTables: %v", err)
+	}
+	// Drop a collection left behind by an interrupted run.
+	_ = db.ExecDDL(ctx, `DROP TABLE IF EXISTS "conformance_items"`)
+
+	registry, err := NewSchemaRegistry(db)
+	if err != nil {
+		t.Fatalf("NewSchemaRegistry: %v", err)
+	}
+	cfg := &AppConfig{JWTSecret: "test-secret-key-that-is-long-enough-for-jwt"}
+	collections := NewCollectionHandler(db, registry, cfg)
+	mutate := NewResourceMutateHandler(db, registry, cfg, NewJTIRevocationStore())
+	query := NewResourceQueryHandler(db, registry, cfg)
+
+	post := func(handle http.HandlerFunc, path, body string) map[string]any {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req = req.WithContext(SetAuthIdentity(req.Context(), adminIdentity()))
+		w := httptest.NewRecorder()
+		handle(w, req)
+		if w.Code != http.StatusOK && w.Code != http.StatusCreated {
+			t.Fatalf("POST %s: expected 200 or 201, got %d: %s", path, w.Code, w.Body.String())
+		}
+		return decodeResponse(t, w)
+	}
+	get := func(path string) []map[string]any {
+		t.Helper()
+		req := makeQueryRequest(path)
+		req = req.WithContext(SetAuthIdentity(req.Context(), adminIdentity()))
+		w := httptest.NewRecorder()
+		query.HandleQuery(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: expected 200, got %d: %s", path, w.Code, w.Body.String())
+		}
+		var resp struct {
+			Data []map[string]any `json:"data"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		return resp.Data
+	}
+	titles := func(rows []map[string]any) string {
+		var out []string
+		for _, r := range rows {
+			out = append(out, r["title"].(string))
+		}
+		return strings.Join(out, ",")
+	}
+
+	post(collections.HandleMutate, "/collections:mutate", `{"op":"create","data":[{"name":"conformance_items","columns":[
+		{"name":"title","type":"string","unique":true},
+		{"name":"code","type":"string","collation":"nocase","nullable":true,"max_length":8},
+		{"name":"qty","type":"integer","min":0},
+		{"name":"price","type":"decimal","precision":10,"scale":2},
+		{"name":"active","type":"boolean"},
+		{"name":"seen_at","type":"datetime","nullable":true},
+		{"name":"meta","type":"json","nullable":true}]}]}`)
+	t.Cleanup(func() {
+		_ = db.ExecDDL(ctx, `DROP TABLE IF EXISTS "conformance_items"`)
+	})
+
+	post(mutate.HandleMutate, "/data/conformance_items:mutate", `{"op":"create","data":[
+		{"title":"Widget","code":"WG-1","qty":5,"price":"9.50","active":true,"seen_at":"2026-01-02T03:04:05Z","meta":{"color":"red"}},
+		{"title":"Gadget","code":"gd-2","qty":12,"price":"19.99","active":false,"meta":{"color":"blue"}},
+		{"title":"Doohickey","qty":0,"price":"0.10","active":true}]}`)
+
+	if got := titles(get("/data/conformance_items:query?sort=-qty")); got != "Gadget,Widget,Doohickey" {
+		t.Fatalf("sort by -qty: got %s", got)
+	}
+	if got := titles(get("/data/conformance_items:query?qty[gte]=5&sort=title")); got != "Gadget,Widget" {
+		t.Fatalf("qty[gte]: got %s", got)
+	}
+	if got := titles(get("/data/conformance_items:query?active[eq]=false")); got != "Gadget" {
+		t.Fatalf("active[eq]: got %s", got)
+	}
+	if got := titles(get("/data/conformance_items:query?seen_at[gte]=2026-01-01T00:00:00Z")); got != "Widget" {
+		t.Fatalf("seen_at[gte]: got %s", got)
+	}
+	if got := titles(get("/data/conformance_items:query?code[ieq]=GD-2")); got != "Gadget" {
+		t.Fatalf("code[ieq]: got %s", got)
+	}
+	if got := titles(get("/data/conformance_items:query?q=gadg")); got != "Gadget" {
+		t.Fatalf("q: got %s", got)
+	}
+
+	rows := get("/data/conformance_items:query?title[eq]=Widget")
+	if len(rows) != 1 {
+		t.Fatalf("expected one Widget, got %d", len(rows))
+	}
+	widget := rows[0]
+	if widget["price"] != "9.5" && widget["price"] != "9.50" {
+		t.Fatalf("price: got %#v", widget["price"])
+	}
+	if widget["seen_at"] != "2026-01-02T03:04:05Z" {
+		t.Fatalf("seen_at: got %#v", widget["seen_at"])
+	}
+
+	update, _ := json.Marshal(map[string]any{"op": "update", "data": []any{
+		map[string]any{"id": widget["id"], "qty": 6},
+	}})
+	post(mutate.HandleMutate, "/data/conformance_items:mutate", string(update))
+	if got := get("/data/conformance_items:query?title[eq]=Widget"); len(got) != 1 || got[0]["qty"] != float64(6) {
+		t.Fatalf("update qty: got %v", got)
+	}
+
+	post(collections.HandleMutate, "/collections:mutate", `{"op":"update","data":[{"name":"conformance_items",
+		"add_columns":[{"name":"sku","type":"string","nullable":true}]}]}`)
+	post(collections.HandleMutate, "/collections:mutate", `{"op":"update","data":[{"name":"conformance_items",
+		"rename_columns":[{"old_name":"code","new_name":"ref"}]}]}`)
+	post(collections.HandleMutate, "/collections:mutate", `{"op":"update","data":[{"name":"conformance_items",
+		"remove_columns":["meta"]}]}`)
+	rows = get("/data/conformance_items:query?ref[ieq]=wg-1")
+	if len(rows) != 1 || rows[0]["title"] != "Widget" {
+		t.Fatalf("renamed column filter: got %v", rows)
+	}
+	if _, ok := rows[0]["meta"]; ok {
+		t.Fatal("removed column still returned")
+	}
+
+	post(collections.HandleMutate, "/collections:mutate", `{"op":"update","data":[{"name":"conformance_items",
+		"modify_columns":[{"name":"qty","type":"integer","nullable":true}]}]}`)
+	if got := titles(get("/data/conformance_items:query?sort=qty")); got != "Doohickey,Widget,Gadget" {
+		t.Fatalf("sort after modify: got %s", got)
+	}
+
+	post(collections.HandleMutate, "/collections:mutate", `{"op":"destroy","data":[{"name":"conformance_items"}]}`)
+	tables, err := db.ListTables(ctx)
+	if err != nil {
+		t.Fatalf("ListTables: %v", err)
+	}
+	for _, name := range tables {
+		if name == "conformance_items" {
+			t.Fatal("collection still exists after destroy")
+		}
+	}
+}
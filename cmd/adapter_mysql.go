@@ -2,75 +2,1571 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
 )
 
 // ---------------------------------------------------------------------------
 // MySQL type mapping constants
 // ---------------------------------------------------------------------------
 
+// MySQL cannot index a LONGTEXT column in full, so string columns that are
+// a primary key or carry a UNIQUE constraint use MySQLTypeKey. An
+// undeclared decimal gets room for DecimalMaxPrecision integer digits and
+// DecimalMaxScale fraction digits.
 const (
-	MySQLTypeID       = "TEXT"
-	MySQLTypeString   = "TEXT"
+	MySQLTypeID       = "VARCHAR(255)"
+	MySQLTypeKey      = "VARCHAR(255)"
+	MySQLTypeString   = "LONGTEXT"
 	MySQLTypeInteger  = "BIGINT"
-	MySQLTypeDecimal  = "DECIMAL(19,2)"
+	MySQLTypeDecimal  = "DECIMAL(25,10)"
 	MySQLTypeBoolean  = "BOOLEAN"
-	MySQLTypeDatetime = "TIMESTAMP"
+	MySQLTypeDatetime = "DATETIME(6)"
 	MySQLTypeJSON     = "JSON"
 )
 
 // ---------------------------------------------------------------------------
-// MySQLAdapter is a stub implementation of DatabaseAdapter for MySQL.
+// MySQLAdapter implements DatabaseAdapter for MySQL.
 // ---------------------------------------------------------------------------
 
-// MySQLAdapter implements DatabaseAdapter for MySQL. Currently a stub
-// that returns "not implemented" errors for all operations.
+// MySQLAdapter provides a MySQL-backed implementation of the
+// DatabaseAdapter interface. It requires MySQL 8.0.16 or later. Sessions
+// run with ANSI_QUOTES, so the double-quoted identifiers and the portable
+// DDL used by the rest of Moon are accepted; ExecDDL translates the
+// SQLite column types into their MySQL equivalents.
 type MySQLAdapter struct {
-	cfg    DatabaseConfig
-	logger *Logger
+	db                 *sql.DB
+	cfg                DatabaseConfig
+	logger             *Logger
+	slowQueryThreshold atomic.Int64 // milliseconds; see SetSlowQueryThreshold
+	queryTimeout       int
+	retry              *writeRetrier
+	stmts              *stmtCache
+
+	columnsMu sync.Mutex
+	columns   map[string]mysqlColumnTypes // keyed by table; see columnTypes
+}
+
+// mysqlColumnTypes holds the information_schema DATA_TYPE of each column
+// of a table.
+type mysqlColumnTypes struct {
+	types  map[string]string
+	loaded time.Time
 }
 
-// NewMySQLAdapter creates a stub MySQL adapter.
+// NewMySQLAdapter prepares a connection pool for the database named in
+// cfg. No connection is made until the first query; call Ping to verify
+// connectivity.
 func NewMySQLAdapter(cfg DatabaseConfig, logger *Logger) (*MySQLAdapter, error) {
-	return &MySQLAdapter{cfg: cfg, logger: logger}, nil
+	connector, err := mysql.NewConnector(mysqlConnConfig(cfg))
+	if err != nil {
+		return nil, newAdapterError("NewMySQLAdapter", "", "invalid connection settings", err)
+	}
+	db := sql.OpenDB(connector)
+	db.SetConnMaxLifetime(time.Duration(MySQLConnMaxLifetimeSeconds) * time.Second)
+
+	a := &MySQLAdapter{
+		db:           db,
+		cfg:          cfg,
+		logger:       logger,
+		queryTimeout: cfg.QueryTimeout,
+		retry:        newWriteRetrier(),
+		stmts:        newStmtCache(db, StmtCacheSize),
+		columns:      make(map[string]mysqlColumnTypes),
+	}
+	a.SetSlowQueryThreshold(cfg.SlowQueryThreshold)
+	return a, nil
+}
+
+// mysqlConnConfig builds the driver configuration for cfg. Times are read
+// and written in UTC, UPDATE reports matched rather than changed rows as
+// SQLite does, and the session SQL mode makes double quotes delimit
+// identifiers and rejects invalid values instead of truncating them.
+func mysqlConnConfig(cfg DatabaseConfig) *mysql.Config {
+	c := mysql.NewConfig()
+	c.User = cfg.User
+	c.Passwd = cfg.Password
+	c.DBName = cfg.Database
+	c.Net, c.Addr = mysqlAddress(cfg.Host)
+	c.Collation = MySQLDefaultCollation
+	c.ParseTime = true
+	c.Loc = time.UTC
+	c.ClientFoundRows = true
+	c.Timeout = time.Duration(cfg.QueryTimeout) * time.Second
+	c.Params = map[string]string{
+		"sql_mode":  "'TRADITIONAL,ANSI_QUOTES,NO_BACKSLASH_ESCAPES'",
+		"time_zone": "'+00:00'",
+	}
+	return c
+}
+
+// mysqlAddress returns the network and address for database.host. A path
+// names a unix socket; a host without a port uses MySQLDefaultPort.
+func mysqlAddress(host string) (string, string) {
+	switch {
+	case host == "":
+		return "", ""
+	case strings.HasPrefix(host, "/"):
+		return "unix", host
+	}
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return "tcp", host
+	}
+	return "tcp", net.JoinHostPort(strings.Trim(host, "[]"), MySQLDefaultPort)
+}
+
+// SetSlowQueryThreshold changes the duration, in milliseconds, above which
+// a query is logged as slow. It is safe to call while queries run.
+func (a *MySQLAdapter) SetSlowQueryThreshold(ms int) {
+	a.slowQueryThreshold.Store(int64(ms))
+}
+
+// slowQueryMs returns the current slow query threshold in milliseconds.
+func (a *MySQLAdapter) slowQueryMs() int {
+	return int(a.slowQueryThreshold.Load())
+}
+
+// withTimeout derives a context with the configured query timeout.
+func (a *MySQLAdapter) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, time.Duration(a.queryTimeout)*time.Second)
 }
 
+// Ping verifies that the database is reachable.
 func (a *MySQLAdapter) Ping(ctx context.Context) error {
-	return fmt.Errorf("mysql adapter not implemented")
+	ctx2, cancel := a.withTimeout(ctx)
+	defer cancel()
+	if err := a.db.PingContext(ctx2); err != nil {
+		return newAdapterError("Ping", "", "database unreachable", err)
+	}
+	return nil
 }
 
+// Close releases the connection pool.
 func (a *MySQLAdapter) Close() error {
-	return nil
+	a.stmts.reset()
+	return a.db.Close()
+}
+
+// PoolStats returns the connection pool statistics of the underlying
+// database/sql handle.
+func (a *MySQLAdapter) PoolStats() sql.DBStats {
+	return a.db.Stats()
+}
+
+// WriteRetryStats returns the counters of the write retry policy.
+func (a *MySQLAdapter) WriteRetryStats() map[string]int64 {
+	return a.retry.stats()
 }
 
+// StatementCacheStats returns the counters of the prepared statement
+// cache.
+func (a *MySQLAdapter) StatementCacheStats() map[string]any {
+	return a.stmts.stats()
+}
+
+// ExecDDL translates and executes a DDL statement. Some statements expand
+// to several; see translateDDL.
 func (a *MySQLAdapter) ExecDDL(ctx context.Context, ddl string) error {
-	return fmt.Errorf("mysql adapter not implemented")
+	ctx2, cancel := a.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	defer logSlowQuery(ctx, a.logger, "", "ExecDDL", start, a.slowQueryMs())
+	defer a.invalidateColumns()
+
+	statements, err := a.translateDDL(ctx2, ddl)
+	if err != nil {
+		return newAdapterError("ExecDDL", "", "DDL translation failed", err)
+	}
+	for _, stmt := range statements {
+		err := a.retry.do(ctx2, func() error {
+			_, err := a.db.ExecContext(ctx2, stmt)
+			return err
+		})
+		if err != nil {
+			return newAdapterError("ExecDDL", "", "DDL execution failed", err)
+		}
+	}
+	return nil
+}
+
+// ExecDDLBatch executes the statements in order inside a single
+// transaction. MySQL commits implicitly before and after every DDL
+// statement, so only the data changes in a batch are rolled back on
+// failure; DDL that already ran stays applied.
+func (a *MySQLAdapter) ExecDDLBatch(ctx context.Context, statements []string) error {
+	ctx2, cancel := a.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	defer logSlowQuery(ctx, a.logger, "", "ExecDDLBatch", start, a.slowQueryMs())
+	defer a.invalidateColumns()
+
+	var stage string
+	err := a.retry.do(ctx2, func() error {
+		tx, err := a.db.BeginTx(ctx2, nil)
+		if err != nil {
+			stage = "begin transaction failed"
+			return err
+		}
+		for _, ddl := range statements {
+			translated, err := a.translateDDL(ctx2, ddl)
+			if err != nil {
+				tx.Rollback()
+				stage = "DDL translation failed"
+				return err
+			}
+			for _, stmt := range translated {
+				if _, err := tx.ExecContext(ctx2, stmt); err != nil {
+					tx.Rollback()
+					stage = "DDL execution failed"
+					return err
+				}
+			}
+		}
+		stage = "commit failed"
+		return tx.Commit()
+	})
+	if err != nil {
+		return newAdapterError("ExecDDLBatch", "", stage, err)
+	}
+	return nil
 }
 
+// QueryRows returns rows matching the given options.
 func (a *MySQLAdapter) QueryRows(ctx context.Context, table string, opts QueryOptions) ([]map[string]any, int, error) {
-	return nil, 0, fmt.Errorf("mysql adapter not implemented")
+	return a.queryRows(ctx, nil, table, opts)
+}
+
+// ReadSnapshot runs read inside a read-only REPEATABLE READ transaction.
+// InnoDB takes the snapshot at the transaction's first read, and writers
+// are not blocked while it is open.
+func (a *MySQLAdapter) ReadSnapshot(ctx context.Context, read func(SnapshotReader) error) error {
+	tx, err := a.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return newAdapterError("ReadSnapshot", "", "begin transaction failed", err)
+	}
+	defer tx.Rollback()
+	return read(mysqlSnapshot{adapter: a, tx: tx})
+}
+
+// mysqlSnapshot is the SnapshotReader for an open read transaction.
+type mysqlSnapshot struct {
+	adapter *MySQLAdapter
+	tx      *sql.Tx
+}
+
+func (s mysqlSnapshot) QueryRows(ctx context.Context, table string, opts QueryOptions) ([]map[string]any, int, error) {
+	return s.adapter.queryRows(ctx, s.tx, table, opts)
+}
+
+// StreamRows calls each for every row QueryRows would return, as the rows
+// are scanned.
+func (a *MySQLAdapter) StreamRows(ctx context.Context, table string, opts QueryOptions, each func(map[string]any) error) (int, error) {
+	return a.streamRows(ctx, nil, table, opts, each)
+}
+
+// queryRows implements QueryRows, inside tx when tx is not nil.
+func (a *MySQLAdapter) queryRows(ctx context.Context, tx *sql.Tx, table string, opts QueryOptions) ([]map[string]any, int, error) {
+	var results []map[string]any
+	total, err := a.streamRows(ctx, tx, table, opts, func(row map[string]any) error {
+		results = append(results, row)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return results, total, nil
+}
+
+// streamRows implements StreamRows, inside tx when tx is not nil.
+func (a *MySQLAdapter) streamRows(ctx context.Context, tx *sql.Tx, table string, opts QueryOptions, each func(map[string]any) error) (int, error) {
+	ctx2, cancel := a.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+
+	where, args := a.whereClause(ctx2, table, opts)
+
+	countSQL := fmt.Sprintf("SELECT COUNT(*) FROM %s%s", quoteIdent(table), where)
+	var total int
+	if err := a.stmts.scanRow(ctx2, tx, countSQL, args, &total); err != nil {
+		logSlowQuery(ctx, a.logger, table, "QueryRows/count", start, a.slowQueryMs())
+		return 0, newAdapterError("QueryRows", table, "count query failed", err)
+	}
+
+	fields := "*"
+	if len(opts.Fields) > 0 {
+		quoted := make([]string, len(opts.Fields))
+		for i, f := range opts.Fields {
+			quoted[i] = quoteIdent(f)
+		}
+		fields = strings.Join(quoted, ", ")
+	}
+
+	page := opts.Page
+	if page < 1 {
+		page = 1
+	}
+	perPage := opts.PerPage
+	if perPage < 1 {
+		perPage = DefaultPerPage
+	}
+	if perPage > MaxPerPage {
+		perPage = MaxPerPage
+	}
+	offset := (page - 1) * perPage
+
+	selectSQL := fmt.Sprintf("SELECT %s FROM %s%s%s LIMIT ? OFFSET ?",
+		fields, quoteIdent(table), where, mysqlOrderClause(opts.Sort))
+	selectArgs := append(args, perPage, offset)
+
+	rows, err := a.stmts.query(ctx2, tx, selectSQL, selectArgs...)
+	logSlowQuery(ctx, a.logger, table, "QueryRows", start, a.slowQueryMs())
+	if err != nil {
+		return 0, newAdapterError("QueryRows", table, "select query failed", err)
+	}
+	defer rows.Close()
+
+	if err := mysqlEachRow(rows, each); err != nil {
+		return 0, newAdapterError("QueryRows", table, "row scan failed", err)
+	}
+	return total, nil
 }
 
+// mysqlOrderClause builds the ORDER BY clause for sorts. MySQL has no
+// NULLS FIRST or NULLS LAST, so an explicit placement sorts on IS NULL
+// first.
+func mysqlOrderClause(sorts []SortField) string {
+	if len(sorts) == 0 {
+		return ""
+	}
+	var parts []string
+	for _, s := range sorts {
+		col := quoteIdent(s.Field)
+		switch s.Nulls {
+		case NullsFirst:
+			parts = append(parts, col+" IS NULL DESC")
+		case NullsLast:
+			parts = append(parts, col+" IS NULL ASC")
+		}
+		dir := "ASC"
+		if s.Desc {
+			dir = "DESC"
+		}
+		parts = append(parts, col+" "+dir)
+	}
+	return " ORDER BY " + strings.Join(parts, ", ")
+}
+
+// InsertRow inserts a single row into the given table.
 func (a *MySQLAdapter) InsertRow(ctx context.Context, table string, data map[string]any) error {
-	return fmt.Errorf("mysql adapter not implemented")
+	if len(data) == 0 {
+		return newAdapterError("InsertRow", table, "no data provided", nil)
+	}
+
+	ctx2, cancel := a.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+
+	query, values := sqliteInsertStatement(table, a.writeValues(ctx2, table, data))
+	err := a.retry.do(ctx2, func() error {
+		_, err := a.stmts.exec(ctx2, nil, query, values...)
+		return err
+	})
+	logSlowQuery(ctx, a.logger, table, "InsertRow", start, a.slowQueryMs())
+	if err != nil {
+		return newAdapterError("InsertRow", table, "insert failed", err)
+	}
+	return nil
+}
+
+// InsertRows inserts every row inside a single transaction.
+func (a *MySQLAdapter) InsertRows(ctx context.Context, table string, rows []map[string]any) error {
+	for _, data := range rows {
+		if len(data) == 0 {
+			return newAdapterError("InsertRows", table, "no data provided", nil)
+		}
+	}
+
+	ctx2, cancel := a.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	defer logSlowQuery(ctx, a.logger, table, "InsertRows", start, a.slowQueryMs())
+
+	converted := make([]map[string]any, len(rows))
+	for i, data := range rows {
+		converted[i] = a.writeValues(ctx2, table, data)
+	}
+
+	var stage string
+	err := a.retry.do(ctx2, func() error {
+		tx, err := a.db.BeginTx(ctx2, nil)
+		if err != nil {
+			stage = "begin transaction failed"
+			return err
+		}
+		stmts := a.stmts.inTx(tx)
+		defer stmts.close()
+		for _, data := range converted {
+			query, values := sqliteInsertStatement(table, data)
+			if _, err := stmts.exec(ctx2, query, values...); err != nil {
+				tx.Rollback()
+				stage = "insert failed"
+				return err
+			}
+		}
+		stage = "commit failed"
+		return tx.Commit()
+	})
+	if err != nil {
+		return newAdapterError("InsertRows", table, stage, err)
+	}
+	return nil
 }
 
+// UpdateRow updates the row identified by id in the given table.
 func (a *MySQLAdapter) UpdateRow(ctx context.Context, table string, id string, data map[string]any) error {
-	return fmt.Errorf("mysql adapter not implemented")
+	if len(data) == 0 {
+		return newAdapterError("UpdateRow", table, "no data provided", nil)
+	}
+
+	ctx2, cancel := a.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+
+	query, values := sqliteUpdateStatement(table, id, a.writeValues(ctx2, table, data), false, 0)
+	err := a.retry.do(ctx2, func() error {
+		_, err := a.stmts.exec(ctx2, nil, query, values...)
+		return err
+	})
+	logSlowQuery(ctx, a.logger, table, "UpdateRow", start, a.slowQueryMs())
+	if err != nil {
+		return newAdapterError("UpdateRow", table, "update failed", err)
+	}
+	return nil
+}
+
+// UpdateRowVersion updates the row identified by id, increments _version,
+// and, when expected is non-zero, only matches the row at that version.
+func (a *MySQLAdapter) UpdateRowVersion(ctx context.Context, table string, id string, expected int64, data map[string]any) (bool, error) {
+	ctx2, cancel := a.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+
+	query, values := sqliteUpdateStatement(table, id, a.writeValues(ctx2, table, data), true, expected)
+	var res sql.Result
+	err := a.retry.do(ctx2, func() error {
+		var err error
+		res, err = a.stmts.exec(ctx2, nil, query, values...)
+		return err
+	})
+	logSlowQuery(ctx, a.logger, table, "UpdateRowVersion", start, a.slowQueryMs())
+	if err != nil {
+		return false, newAdapterError("UpdateRowVersion", table, "update failed", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, newAdapterError("UpdateRowVersion", table, "update failed", err)
+	}
+	return n > 0, nil
 }
 
+// DeleteRow deletes the row identified by id from the given table.
 func (a *MySQLAdapter) DeleteRow(ctx context.Context, table string, id string) error {
-	return fmt.Errorf("mysql adapter not implemented")
+	ctx2, cancel := a.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s = ?", quoteIdent(table), quoteIdent("id"))
+	err := a.retry.do(ctx2, func() error {
+		_, err := a.stmts.exec(ctx2, nil, query, id)
+		return err
+	})
+	logSlowQuery(ctx, a.logger, table, "DeleteRow", start, a.slowQueryMs())
+	if err != nil {
+		return newAdapterError("DeleteRow", table, "delete failed", err)
+	}
+	return nil
+}
+
+// UpdateWhere sets data on every row matching filters in one UPDATE.
+func (a *MySQLAdapter) UpdateWhere(ctx context.Context, table string, filters []Filter, data map[string]any, versioned bool, limit int) (int, error) {
+	if len(data) == 0 {
+		return 0, newAdapterError("UpdateWhere", table, "no data provided", nil)
+	}
+	where, args := a.whereClause(ctx, table, QueryOptions{Filters: filters})
+	query, values := sqliteUpdateWhereStatement(table, where, a.writeValues(ctx, table, data), versioned)
+	return a.execWhere(ctx, "UpdateWhere", table, limit, query, append(values, args...))
 }
 
+// DeleteWhere deletes every row matching filters in one DELETE.
+func (a *MySQLAdapter) DeleteWhere(ctx context.Context, table string, filters []Filter, limit int) (int, error) {
+	where, args := a.whereClause(ctx, table, QueryOptions{Filters: filters})
+	query := fmt.Sprintf("DELETE FROM %s%s", quoteIdent(table), where)
+	return a.execWhere(ctx, "DeleteWhere", table, limit, query, args)
+}
+
+// execWhere runs the UPDATE or DELETE of UpdateWhere or DeleteWhere in a
+// transaction that is rolled back when more than limit rows change. With
+// ClientFoundRows set, an update counts every matched row, changed or not.
+func (a *MySQLAdapter) execWhere(ctx context.Context, op, table string, limit int, query string, values []any) (int, error) {
+	ctx2, cancel := a.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	defer logSlowQuery(ctx, a.logger, table, op, start, a.slowQueryMs())
+
+	var n int64
+	err := a.retry.do(ctx2, func() error {
+		tx, err := a.db.BeginTx(ctx2, nil)
+		if err != nil {
+			return err
+		}
+		res, err := a.stmts.exec(ctx2, tx, query, values...)
+		if err == nil {
+			n, err = res.RowsAffected()
+		}
+		if err == nil && n > int64(limit) {
+			err = ErrTooManyRows
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		return tx.Commit()
+	})
+	if err != nil {
+		return int(n), newAdapterError(op, table, "write failed", err)
+	}
+	return int(n), nil
+}
+
+// ExecWriteBatch applies the writes in order inside a single transaction.
+func (a *MySQLAdapter) ExecWriteBatch(ctx context.Context, writes []BatchWrite) (int, error) {
+	ctx2, cancel := a.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	defer logSlowQuery(ctx, a.logger, "", "ExecWriteBatch", start, a.slowQueryMs())
+
+	converted := make([]BatchWrite, len(writes))
+	for i, wr := range writes {
+		converted[i] = wr
+		if wr.Data != nil {
+			converted[i].Data = a.writeValues(ctx2, wr.Table, wr.Data)
+		}
+	}
+
+	var idx int
+	err := a.retry.do(ctx2, func() error {
+		var err error
+		idx, err = a.execWriteBatchTx(ctx2, converted)
+		return err
+	})
+	return idx, err
+}
+
+// execWriteBatchTx makes one attempt at ExecWriteBatch. Any failure rolls
+// the transaction back.
+func (a *MySQLAdapter) execWriteBatchTx(ctx2 context.Context, writes []BatchWrite) (int, error) {
+	tx, err := a.db.BeginTx(ctx2, nil)
+	if err != nil {
+		return 0, newAdapterError("ExecWriteBatch", "", "begin transaction failed", err)
+	}
+	stmts := a.stmts.inTx(tx)
+	defer stmts.close()
+	for i, wr := range writes {
+		var query string
+		var values []any
+		switch wr.Op {
+		case BatchInsert:
+			query, values = sqliteInsertStatement(wr.Table, wr.Data)
+		case BatchUpdate:
+			query, values = sqliteUpdateStatement(wr.Table, wr.ID, wr.Data, wr.Versioned, wr.ExpectedVersion)
+			query, values = guardStatement(query, values, wr.Guard)
+		case BatchDelete:
+			query = fmt.Sprintf("DELETE FROM %s WHERE %s = ?", quoteIdent(wr.Table), quoteIdent("id"))
+			query, values = guardStatement(query, []any{wr.ID}, wr.Guard)
+		case BatchUpsert:
+			query, values = mysqlUpsertStatement(wr.Table, wr.Key, wr.Data, wr.Update, wr.Versioned)
+		default:
+			tx.Rollback()
+			return i, newAdapterError("ExecWriteBatch", wr.Table, fmt.Sprintf("unknown batch op %q", wr.Op), nil)
+		}
+		res, err := stmts.exec(ctx2, query, values...)
+		if err != nil {
+			tx.Rollback()
+			return i, newAdapterError("ExecWriteBatch", wr.Table, wr.Op+" failed", err)
+		}
+		if wr.Op == BatchUpdate || wr.Op == BatchDelete {
+			if n, err := res.RowsAffected(); err != nil || n == 0 {
+				tx.Rollback()
+				return i, newAdapterError("ExecWriteBatch", wr.Table, wr.Op+" failed", ErrNoRowAffected)
+			}
+		}
+		if wr.Op == BatchUpsert && len(wr.Guard) > 0 {
+			// ON DUPLICATE KEY UPDATE has no WHERE, so the guard is checked
+			// on the row the statement left locked, and a row it does not
+			// admit rolls the write back.
+			query, values := mysqlGuardQuery(wr.Table, wr.Key, wr.Data[wr.Key], wr.Guard)
+			var n int
+			if err := tx.QueryRowContext(ctx2, query, values...).Scan(&n); err != nil || n == 0 {
+				tx.Rollback()
+				if err == nil {
+					err = ErrNoRowAffected
+				}
+				return i, newAdapterError("ExecWriteBatch", wr.Table, wr.Op+" failed", err)
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return len(writes), newAdapterError("ExecWriteBatch", "", "commit failed", err)
+	}
+	return 0, nil
+}
+
+// mysqlUpsertStatement returns the INSERT of data that, on a duplicate
+// key, sets the existing row's update columns instead. MySQL has no
+// conflict target: a duplicate of any unique column takes this path, not
+// only one of key. An empty update list keeps the row as it is.
+func mysqlUpsertStatement(table, key string, data map[string]any, update []string, versioned bool) (string, []any) {
+	query, values := sqliteInsertStatement(table, data)
+	setClauses := make([]string, 0, len(update)+1)
+	for _, col := range update {
+		setClauses = append(setClauses, fmt.Sprintf("%s = VALUES(%s)", quoteIdent(col), quoteIdent(col)))
+	}
+	if versioned {
+		version := quoteIdent(FieldVersion)
+		setClauses = append(setClauses, fmt.Sprintf("%s = %s + 1", version, version))
+	}
+	if len(setClauses) == 0 {
+		setClauses = append(setClauses, fmt.Sprintf("%s = %s", quoteIdent(key), quoteIdent(key)))
+	}
+	return query + " ON DUPLICATE KEY UPDATE " + strings.Join(setClauses, ", "), values
+}
+
+// mysqlGuardQuery counts the rows whose key column is value and whose
+// columns hold the guard values.
+func mysqlGuardQuery(table, key string, value any, guard map[string]any) (string, []any) {
+	conds := []string{fmt.Sprintf("%s = ?", quoteIdent(key))}
+	values := []any{value}
+	cols := make([]string, 0, len(guard))
+	for col := range guard {
+		cols = append(cols, col)
+	}
+	sort.Strings(cols)
+	for _, col := range cols {
+		conds = append(conds, fmt.Sprintf("%s = ?", quoteIdent(col)))
+		values = append(values, guard[col])
+	}
+	return fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s", quoteIdent(table), strings.Join(conds, " AND ")), values
+}
+
+// ListTables returns the names of the base tables in the current database.
 func (a *MySQLAdapter) ListTables(ctx context.Context) ([]string, error) {
-	return nil, fmt.Errorf("mysql adapter not implemented")
+	ctx2, cancel := a.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+
+	rows, err := a.db.QueryContext(ctx2,
+		"SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_TYPE = 'BASE TABLE' ORDER BY TABLE_NAME")
+	logSlowQuery(ctx, a.logger, "", "ListTables", start, a.slowQueryMs())
+	if err != nil {
+		return nil, newAdapterError("ListTables", "", "table list failed", err)
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, newAdapterError("ListTables", "", "scan failed", err)
+		}
+		tables = append(tables, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, newAdapterError("ListTables", "", "iteration failed", err)
+	}
+	return tables, nil
 }
 
+// DescribeTable returns column definitions for the given table from
+// information_schema. Types are reported with the SQLite names the schema
+// registry maps, so a collection reads the same on either backend.
 func (a *MySQLAdapter) DescribeTable(ctx context.Context, table string) ([]ColumnInfo, error) {
-	return nil, fmt.Errorf("mysql adapter not implemented")
+	ctx2, cancel := a.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+
+	rows, err := a.db.QueryContext(ctx2,
+		`SELECT COLUMN_NAME, DATA_TYPE, COLUMN_TYPE, IS_NULLABLE, COLUMN_KEY, COALESCE(COLLATION_NAME, '')
+		FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?
+		ORDER BY ORDINAL_POSITION`, table)
+	logSlowQuery(ctx, a.logger, table, "DescribeTable", start, a.slowQueryMs())
+	if err != nil {
+		return nil, newAdapterError("DescribeTable", table, "column query failed", err)
+	}
+	defer rows.Close()
+
+	var columns []ColumnInfo
+	for rows.Next() {
+		var name, dataType, columnType, nullable, key, collation string
+		if err := rows.Scan(&name, &dataType, &columnType, &nullable, &key, &collation); err != nil {
+			return nil, newAdapterError("DescribeTable", table, "scan failed", err)
+		}
+		c := ColumnInfo{
+			Name:     name,
+			Type:     mysqlPortableType(dataType, columnType),
+			Nullable: nullable == "YES",
+			PK:       key == "PRI",
+		}
+		if strings.HasSuffix(collation, "_ci") {
+			c.Collation = CollationNocase
+		}
+		columns = append(columns, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, newAdapterError("DescribeTable", table, "iteration failed", err)
+	}
+	if len(columns) == 0 {
+		return columns, nil
+	}
+
+	indexes, err := a.tableIndexes(ctx2, table)
+	if err != nil {
+		return nil, newAdapterError("DescribeTable", table, "index query failed", err)
+	}
+	checks, err := a.checkConstraints(ctx2, table)
+	if err != nil {
+		return nil, newAdapterError("DescribeTable", table, "check constraint query failed", err)
+	}
+	var checkSQL strings.Builder
+	for _, c := range checks {
+		checkSQL.WriteString(" CHECK " + mysqlCheckClauseSQL(c.Clause))
+	}
+	for i := range columns {
+		for _, idx := range indexes {
+			if idx.Unique && idx.Name != "PRIMARY" && len(idx.Columns) == 1 && idx.Columns[0] == columns[i].Name {
+				columns[i].Unique = true
+			}
+		}
+		columns[i].Rules = parseFieldRulesSQL(columns[i].Name, checkSQL.String())
+	}
+	return columns, nil
+}
+
+// mysqlPortableType maps an information_schema column type to the SQLite
+// type name that ExecDDL translated it from.
+func mysqlPortableType(dataType, columnType string) string {
+	switch strings.ToLower(dataType) {
+	case "char", "varchar", "tinytext", "text", "mediumtext", "longtext":
+		return SQLiteTypeString
+	case "tinyint":
+		if strings.HasPrefix(strings.ToLower(columnType), "tinyint(1)") {
+			return SQLiteTypeBoolean
+		}
+		return SQLiteTypeInteger
+	case "smallint", "mediumint", "int", "bigint":
+		return SQLiteTypeInteger
+	case "decimal":
+		if strings.EqualFold(columnType, MySQLTypeDecimal) {
+			return SQLiteTypeDecimal
+		}
+		precision, scale := parseDecimalType(columnType)
+		return decimalTypeSQL(precision, scale)
+	case "datetime", "timestamp":
+		return SQLiteTypeDatetime
+	case "json":
+		return SQLiteTypeJSON
+	}
+	return strings.ToUpper(columnType)
+}
+
+// ListIndexes returns the indexes of table created with CREATE INDEX. The
+// primary key and the unique constraints ExecDDL names with
+// MySQLUniqueConstraintPrefix are excluded.
+func (a *MySQLAdapter) ListIndexes(ctx context.Context, table string) ([]IndexInfo, error) {
+	ctx2, cancel := a.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+
+	all, err := a.tableIndexes(ctx2, table)
+	logSlowQuery(ctx, a.logger, table, "ListIndexes", start, a.slowQueryMs())
+	if err != nil {
+		return nil, newAdapterError("ListIndexes", table, "index query failed", err)
+	}
+	var indexes []IndexInfo
+	for _, idx := range all {
+		if idx.Name == "PRIMARY" || strings.HasPrefix(idx.Name, MySQLUniqueConstraintPrefix) {
+			continue
+		}
+		indexes = append(indexes, idx)
+	}
+	return indexes, nil
+}
+
+// tableIndexes returns every index of table, including the primary key,
+// sorted by name.
+func (a *MySQLAdapter) tableIndexes(ctx context.Context, table string) ([]IndexInfo, error) {
+	rows, err := a.db.QueryContext(ctx,
+		`SELECT INDEX_NAME, NON_UNIQUE, COLUMN_NAME
+		FROM information_schema.STATISTICS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?
+		ORDER BY INDEX_NAME, SEQ_IN_INDEX`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var indexes []IndexInfo
+	for rows.Next() {
+		var name, column string
+		var nonUnique int
+		if err := rows.Scan(&name, &nonUnique, &column); err != nil {
+			return nil, err
+		}
+		if n := len(indexes); n > 0 && indexes[n-1].Name == name {
+			indexes[n-1].Columns = append(indexes[n-1].Columns, column)
+			continue
+		}
+		indexes = append(indexes, IndexInfo{Name: name, Columns: []string{column}, Unique: nonUnique == 0})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i].Name < indexes[j].Name })
+	return indexes, nil
+}
+
+// CreateIndex creates idx on table.
+func (a *MySQLAdapter) CreateIndex(ctx context.Context, table string, idx IndexInfo) error {
+	ctx2, cancel := a.withTimeout(ctx)
+	defer cancel()
+	return a.execIndexDDL(ctx2, table, "CreateIndex", a.createIndexStatement(ctx2, table, idx))
+}
+
+// DropIndex drops the named index of table.
+func (a *MySQLAdapter) DropIndex(ctx context.Context, table, name string) error {
+	return a.execIndexDDL(ctx, table, "DropIndex", dropIndexSQL(DBConnectionMySQL, table, name))
+}
+
+// TrackShadowChanges implements ShadowRebuilder with a change log table
+// and AFTER INSERT, UPDATE, and DELETE triggers on s.Table.
+func (a *MySQLAdapter) TrackShadowChanges(ctx context.Context, s ShadowTable) error {
+	t, log, id := quoteIdent(s.Table), quoteIdent(s.logTable()), quoteIdent("id")
+	for _, ddl := range []string{
+		fmt.Sprintf("CREATE TABLE %s (%s TEXT PRIMARY KEY)", log, id),
+		fmt.Sprintf("CREATE TRIGGER %s AFTER INSERT ON %s FOR EACH ROW INSERT IGNORE INTO %s (%s) VALUES (NEW.%s)",
+			quoteIdent(s.trigger("insert")), t, log, id, id),
+		fmt.Sprintf("CREATE TRIGGER %s AFTER UPDATE ON %s FOR EACH ROW INSERT IGNORE INTO %s (%s) VALUES (OLD.%s), (NEW.%s)",
+			quoteIdent(s.trigger("update")), t, log, id, id, id),
+		fmt.Sprintf("CREATE TRIGGER %s AFTER DELETE ON %s FOR EACH ROW INSERT IGNORE INTO %s (%s) VALUES (OLD.%s)",
+			quoteIdent(s.trigger("delete")), t, log, id, id),
+	} {
+		if err := a.ExecDDL(ctx, ddl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CopyShadowBatch implements ShadowRebuilder. The batch is bounded and
+// copied in one transaction.
+func (a *MySQLAdapter) CopyShadowBatch(ctx context.Context, s ShadowTable, after string, limit int) (string, int, error) {
+	ctx2, cancel := a.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	defer logSlowQuery(ctx, a.logger, s.Table, "CopyShadowBatch", start, a.slowQueryMs())
+
+	bound, copyRows := shadowBatchSQL(s)
+	var last string
+	var n int
+	var stage string
+	err := a.retry.do(ctx2, func() error {
+		tx, err := a.db.BeginTx(ctx2, nil)
+		if err != nil {
+			stage = "begin transaction failed"
+			return err
+		}
+		defer tx.Rollback()
+		var max sql.NullString
+		if err := tx.QueryRowContext(ctx2, bound, after, limit).Scan(&max, &n); err != nil {
+			stage = "batch bound failed"
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+		if _, err := tx.ExecContext(ctx2, copyRows, after, max.String); err != nil {
+			stage = "batch copy failed"
+			return err
+		}
+		last = max.String
+		stage = "commit failed"
+		return tx.Commit()
+	})
+	if err != nil {
+		return "", 0, newAdapterError("CopyShadowBatch", s.Table, stage, err)
+	}
+	return last, n, nil
+}
+
+// SwapShadowTable implements ShadowRebuilder. MySQL commits DDL
+// implicitly, so the swap cannot be one transaction. The indexes are
+// built on the shadow table first, since MySQL scopes index names to a
+// table. The tables are then write-locked while the logged rows are
+// copied again, and one RENAME TABLE retires s.Table and moves the shadow
+// table into its place atomically; the retired table, with its triggers,
+// and the change log are dropped after the locks are released.
+func (a *MySQLAdapter) SwapShadowTable(ctx context.Context, s ShadowTable, indexes []IndexInfo) error {
+	ctx2, cancel := a.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	defer logSlowQuery(ctx, a.logger, s.Table, "SwapShadowTable", start, a.slowQueryMs())
+	defer a.invalidateColumns()
+	defer a.stmts.reset()
+
+	for _, idx := range indexes {
+		if _, err := a.db.ExecContext(ctx2, a.createIndexStatement(ctx2, s.Name, idx)); err != nil {
+			return newAdapterError("SwapShadowTable", s.Table, "index DDL failed", err)
+		}
+	}
+
+	// LOCK TABLES holds for the session, so every statement runs on one
+	// connection.
+	conn, err := a.db.Conn(ctx2)
+	if err != nil {
+		return newAdapterError("SwapShadowTable", s.Table, "connection failed", err)
+	}
+	defer conn.Close()
+
+	t, sh, log := quoteIdent(s.Table), quoteIdent(s.Name), quoteIdent(s.logTable())
+	if _, err := conn.ExecContext(ctx2, fmt.Sprintf("LOCK TABLES %s WRITE, %s WRITE, %s WRITE", t, sh, log)); err != nil {
+		return newAdapterError("SwapShadowTable", s.Table, "lock failed", err)
+	}
+	statements := append(shadowCatchUpSQL(s),
+		fmt.Sprintf("RENAME TABLE %s TO %s, %s TO %s", t, quoteIdent(s.oldTable()), sh, t))
+	for _, stmt := range statements {
+		if _, err := conn.ExecContext(ctx2, stmt); err != nil {
+			conn.ExecContext(ctx2, "UNLOCK TABLES")
+			return newAdapterError("SwapShadowTable", s.Table, "swap failed", err)
+		}
+	}
+	if _, err := conn.ExecContext(ctx2, "UNLOCK TABLES"); err != nil {
+		return newAdapterError("SwapShadowTable", s.Table, "unlock failed", err)
+	}
+
+	// The swap is done; a table left behind here is only clutter.
+	if _, err := conn.ExecContext(ctx2, fmt.Sprintf("DROP TABLE IF EXISTS %s, %s", quoteIdent(s.oldTable()), log)); err != nil {
+		a.logger.Warn("retired shadow tables not dropped", "table", s.Table, "error", err)
+	}
+	return nil
+}
+
+// DropShadowTable implements ShadowRebuilder.
+func (a *MySQLAdapter) DropShadowTable(ctx context.Context, s ShadowTable) error {
+	for _, ddl := range []string{
+		fmt.Sprintf("DROP TRIGGER IF EXISTS %s", quoteIdent(s.trigger("insert"))),
+		fmt.Sprintf("DROP TRIGGER IF EXISTS %s", quoteIdent(s.trigger("update"))),
+		fmt.Sprintf("DROP TRIGGER IF EXISTS %s", quoteIdent(s.trigger("delete"))),
+		fmt.Sprintf("DROP TABLE IF EXISTS %s, %s, %s", quoteIdent(s.logTable()), quoteIdent(s.Name), quoteIdent(s.oldTable())),
+	} {
+		if err := a.ExecDDL(ctx, ddl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *MySQLAdapter) execIndexDDL(ctx context.Context, table, op, ddl string) error {
+	ctx2, cancel := a.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	_, err := a.db.ExecContext(ctx2, ddl)
+	a.stmts.reset()
+	logSlowQuery(ctx, a.logger, table, op, start, a.slowQueryMs())
+	if err != nil {
+		return newAdapterError(op, table, "index DDL failed", err)
+	}
+	return nil
 }
 
+// CountRows returns the number of rows in the given table.
 func (a *MySQLAdapter) CountRows(ctx context.Context, table string) (int, error) {
-	return 0, fmt.Errorf("mysql adapter not implemented")
+	ctx2, cancel := a.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+
+	var count int
+	err := a.db.QueryRowContext(ctx2, fmt.Sprintf("SELECT COUNT(*) FROM %s", quoteIdent(table))).Scan(&count)
+	logSlowQuery(ctx, a.logger, table, "CountRows", start, a.slowQueryMs())
+	if err != nil {
+		return 0, newAdapterError("CountRows", table, "count failed", err)
+	}
+	return count, nil
+}
+
+// NumericHistogram computes count, min, max, average, nearest-rank
+// percentiles, and equal-width bucket counts for a numeric column. All
+// aggregation runs in SQL; only the summary rows are returned.
+func (a *MySQLAdapter) NumericHistogram(ctx context.Context, table, field string, buckets int, filters []Filter) (*HistogramResult, error) {
+	ctx2, cancel := a.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	defer logSlowQuery(ctx, a.logger, table, "NumericHistogram", start, a.slowQueryMs())
+
+	if buckets < 1 {
+		buckets = 1
+	}
+
+	value := fmt.Sprintf("CAST(%s AS DOUBLE)", quoteIdent(field))
+	where, args := a.whereClause(ctx2, table, QueryOptions{Filters: filters})
+	notNull := fmt.Sprintf("%s IS NOT NULL", quoteIdent(field))
+	if where == "" {
+		where = " WHERE " + notNull
+	} else {
+		where += " AND " + notNull
+	}
+	from := quoteIdent(table) + where
+
+	result := &HistogramResult{Percentiles: make(map[int]float64, len(HistogramPercentiles))}
+
+	var minV, maxV, avgV sql.NullFloat64
+	statsSQL := fmt.Sprintf("SELECT COUNT(*), MIN(%s), MAX(%s), AVG(%s) FROM %s", value, value, value, from)
+	if err := a.db.QueryRowContext(ctx2, statsSQL, args...).Scan(&result.Count, &minV, &maxV, &avgV); err != nil {
+		return nil, newAdapterError("NumericHistogram", table, "stats query failed", err)
+	}
+	if result.Count == 0 {
+		result.Buckets = []HistogramBucket{}
+		return result, nil
+	}
+	result.Min, result.Max, result.Avg = minV.Float64, maxV.Float64, avgV.Float64
+
+	// Nearest-rank percentiles: the value at position ceil(p/100 * count).
+	pctSQL := fmt.Sprintf("SELECT %s FROM %s ORDER BY %s LIMIT 1 OFFSET ?", value, from, value)
+	for _, p := range HistogramPercentiles {
+		rank := int(math.Ceil(float64(p) / 100 * float64(result.Count)))
+		if rank < 1 {
+			rank = 1
+		}
+		var v float64
+		if err := a.db.QueryRowContext(ctx2, pctSQL, append(args, rank-1)...).Scan(&v); err != nil {
+			return nil, newAdapterError("NumericHistogram", table, "percentile query failed", err)
+		}
+		result.Percentiles[p] = v
+	}
+
+	width := (result.Max - result.Min) / float64(buckets)
+	if width == 0 {
+		result.Buckets = []HistogramBucket{{Lower: result.Min, Upper: result.Max, Count: result.Count}}
+		return result, nil
+	}
+
+	result.Buckets = make([]HistogramBucket, buckets)
+	for i := range result.Buckets {
+		result.Buckets[i].Lower = result.Min + float64(i)*width
+		result.Buckets[i].Upper = result.Min + float64(i+1)*width
+	}
+	result.Buckets[buckets-1].Upper = result.Max
+
+	bucketSQL := fmt.Sprintf("SELECT LEAST(CAST(FLOOR((%s - ?) / ?) AS SIGNED), ?) AS bucket, COUNT(*) FROM %s GROUP BY bucket",
+		value, from)
+	bucketArgs := append([]any{result.Min, width, buckets - 1}, args...)
+	rows, err := a.db.QueryContext(ctx2, bucketSQL, bucketArgs...)
+	if err != nil {
+		return nil, newAdapterError("NumericHistogram", table, "bucket query failed", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var idx, count int
+		if err := rows.Scan(&idx, &count); err != nil {
+			return nil, newAdapterError("NumericHistogram", table, "row scan failed", err)
+		}
+		if idx >= 0 && idx < buckets {
+			result.Buckets[idx].Count += count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, newAdapterError("NumericHistogram", table, "row scan failed", err)
+	}
+	return result, nil
+}
+
+// mysqlTimeBucketExpr maps time-series intervals to MySQL expressions that
+// truncate a datetime (the %[1]s placeholder) to the bucket start. Weeks
+// start on Monday.
+var mysqlTimeBucketExpr = map[string]string{
+	"hour":  "DATE_FORMAT(%[1]s, '%%Y-%%m-%%dT%%H:00:00')",
+	"day":   "DATE_FORMAT(%[1]s, '%%Y-%%m-%%dT00:00:00')",
+	"week":  "DATE_FORMAT(DATE_SUB(%[1]s, INTERVAL WEEKDAY(%[1]s) DAY), '%%Y-%%m-%%dT00:00:00')",
+	"month": "DATE_FORMAT(%[1]s, '%%Y-%%m-01T00:00:00')",
+	"year":  "DATE_FORMAT(%[1]s, '%%Y-01-01T00:00:00')",
+}
+
+// TimeSeries aggregates rows into local-time calendar buckets. The UTC
+// offset for each row is chosen from q.Offsets so buckets stay aligned to
+// local midnight across daylight-saving transitions. The shifted time is
+// computed once in a derived table because the week bucket uses it twice.
+func (a *MySQLAdapter) TimeSeries(ctx context.Context, table string, q TimeSeriesQuery) ([]TimeSeriesPoint, error) {
+	ctx2, cancel := a.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	defer logSlowQuery(ctx, a.logger, table, "TimeSeries", start, a.slowQueryMs())
+
+	bucketTmpl, ok := mysqlTimeBucketExpr[q.Interval]
+	if !ok {
+		return nil, newAdapterError("TimeSeries", table, "unsupported interval", fmt.Errorf("interval %q", q.Interval))
+	}
+	aggTmpl, ok := sqliteAggExpr[q.Agg]
+	if !ok {
+		return nil, newAdapterError("TimeSeries", table, "unsupported aggregate", fmt.Errorf("agg %q", q.Agg))
+	}
+
+	utc := quoteIdent(q.DateField)
+
+	var selectArgs []any
+	offsetExpr := "0"
+	if len(q.Offsets) == 1 {
+		offsetExpr = fmt.Sprintf("%d", q.Offsets[0].Seconds)
+	} else if len(q.Offsets) > 1 {
+		var b strings.Builder
+		b.WriteString("CASE")
+		for _, span := range q.Offsets[:len(q.Offsets)-1] {
+			fmt.Fprintf(&b, " WHEN %s < ? THEN %d", utc, span.Seconds)
+			selectArgs = append(selectArgs, span.Until.UTC())
+		}
+		fmt.Fprintf(&b, " ELSE %d END", q.Offsets[len(q.Offsets)-1].Seconds)
+		offsetExpr = b.String()
+	}
+
+	valueExpr := "1"
+	if q.ValueField != "" {
+		valueExpr = fmt.Sprintf("CAST(%s AS DOUBLE)", quoteIdent(q.ValueField))
+	}
+
+	where, whereArgs := a.whereClause(ctx2, table, QueryOptions{Filters: q.Filters})
+	rangeCond := fmt.Sprintf("%s >= ? AND %s < ?", utc, utc)
+	if where == "" {
+		where = " WHERE " + rangeCond
+	} else {
+		where += " AND " + rangeCond
+	}
+	whereArgs = append(whereArgs, q.From.UTC(), q.To.UTC())
+
+	inner := fmt.Sprintf("SELECT DATE_ADD(%s, INTERVAL (%s) SECOND) AS local_ts, %s AS v FROM %s%s",
+		utc, offsetExpr, valueExpr, quoteIdent(table), where)
+	query := fmt.Sprintf("SELECT %s AS bucket, %s, COUNT(v) FROM (%s) AS moon_series GROUP BY bucket ORDER BY bucket",
+		fmt.Sprintf(bucketTmpl, "local_ts"), fmt.Sprintf(aggTmpl, "v"), inner)
+	args := append(selectArgs, whereArgs...)
+
+	rows, err := a.db.QueryContext(ctx2, query, args...)
+	if err != nil {
+		return nil, newAdapterError("TimeSeries", table, "select query failed", err)
+	}
+	defer rows.Close()
+
+	var points []TimeSeriesPoint
+	for rows.Next() {
+		var p TimeSeriesPoint
+		var value sql.NullFloat64
+		if err := rows.Scan(&p.Bucket, &value, &p.Count); err != nil {
+			return nil, newAdapterError("TimeSeries", table, "row scan failed", err)
+		}
+		p.Value = value.Float64
+		points = append(points, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, newAdapterError("TimeSeries", table, "row scan failed", err)
+	}
+	return points, nil
+}
+
+// Pivot aggregates rows grouped by a row key and a column key.
+func (a *MySQLAdapter) Pivot(ctx context.Context, table string, q PivotQuery) ([]PivotCell, error) {
+	ctx2, cancel := a.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	defer logSlowQuery(ctx, a.logger, table, "Pivot", start, a.slowQueryMs())
+
+	types := a.columnTypes(ctx2, table, q.RowField, q.ColumnField)
+	rowExpr, err := mysqlPivotKeyExpr(q.RowField, q.RowInterval, types[q.RowField])
+	if err != nil {
+		return nil, newAdapterError("Pivot", table, "unsupported row interval", err)
+	}
+	colExpr, err := mysqlPivotKeyExpr(q.ColumnField, q.ColumnInterval, types[q.ColumnField])
+	if err != nil {
+		return nil, newAdapterError("Pivot", table, "unsupported column interval", err)
+	}
+	aggTmpl, ok := sqliteAggExpr[q.Agg]
+	if !ok {
+		return nil, newAdapterError("Pivot", table, "unsupported aggregate", fmt.Errorf("agg %q", q.Agg))
+	}
+
+	valueExpr := "*"
+	countExpr := "COUNT(*)"
+	if q.ValueField != "" {
+		valueExpr = fmt.Sprintf("CAST(%s AS DOUBLE)", quoteIdent(q.ValueField))
+		countExpr = fmt.Sprintf("COUNT(%s)", quoteIdent(q.ValueField))
+	}
+
+	where, args := a.whereClause(ctx2, table, QueryOptions{Filters: q.Filters})
+	query := fmt.Sprintf("SELECT %s AS pivot_row, %s AS pivot_col, %s, %s FROM %s%s GROUP BY pivot_row, pivot_col ORDER BY pivot_row, pivot_col",
+		rowExpr, colExpr, fmt.Sprintf(aggTmpl, valueExpr), countExpr, quoteIdent(table), where)
+	if q.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, q.Limit)
+	}
+
+	rows, err := a.db.QueryContext(ctx2, query, args...)
+	if err != nil {
+		return nil, newAdapterError("Pivot", table, "select query failed", err)
+	}
+	defer rows.Close()
+
+	var cells []PivotCell
+	for rows.Next() {
+		var c PivotCell
+		var value sql.NullFloat64
+		if err := rows.Scan(&c.Row, &c.Column, &value, &c.Count); err != nil {
+			return nil, newAdapterError("Pivot", table, "row scan failed", err)
+		}
+		c.Value = value.Float64
+		// DECIMAL text keeps trailing zeros; SQLite stores the canonical form.
+		if types[q.RowField] == "decimal" {
+			c.Row = mysqlDecimalText(c.Row)
+		}
+		if types[q.ColumnField] == "decimal" {
+			c.Column = mysqlDecimalText(c.Column)
+		}
+		cells = append(cells, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, newAdapterError("Pivot", table, "row scan failed", err)
+	}
+	return cells, nil
+}
+
+// mysqlPivotKeyExpr returns the grouping expression for a pivot axis of a
+// column with the given information_schema data type. With an interval the
+// field is truncated to a UTC calendar bucket; otherwise its text form is
+// used, with datetimes in RFC 3339 form. NULL keys become the empty string.
+func mysqlPivotKeyExpr(field, interval, dataType string) (string, error) {
+	col := quoteIdent(field)
+	if interval == "" {
+		if mysqlIsDatetime(dataType) {
+			return fmt.Sprintf("COALESCE(DATE_FORMAT(%s, '%%Y-%%m-%%dT%%H:%%i:%%sZ'), '')", col), nil
+		}
+		return fmt.Sprintf("COALESCE(CAST(%s AS CHAR), '')", col), nil
+	}
+	tmpl, ok := mysqlTimeBucketExpr[interval]
+	if !ok {
+		return "", fmt.Errorf("interval %q", interval)
+	}
+	return fmt.Sprintf("COALESCE(%s, '')", fmt.Sprintf(tmpl, col)), nil
+}
+
+// ---------------------------------------------------------------------------
+// Column types
+// ---------------------------------------------------------------------------
+
+// columnTypes returns the information_schema DATA_TYPE of each column of
+// table. The cached types are reloaded when they are older than
+// MySQLColumnCacheSeconds or lack one of names, so a column added by
+// another instance is picked up on first use. A table that cannot be read
+// yields an empty map, and values are then passed through unconverted.
+func (a *MySQLAdapter) columnTypes(ctx context.Context, table string, names ...string) map[string]string {
+	a.columnsMu.Lock()
+	cached, ok := a.columns[table]
+	a.columnsMu.Unlock()
+	fresh := ok && time.Since(cached.loaded) < time.Duration(MySQLColumnCacheSeconds)*time.Second
+	for _, name := range names {
+		if _, known := cached.types[name]; !known && name != "" {
+			fresh = false
+		}
+	}
+	if fresh {
+		return cached.types
+	}
+
+	types, err := a.loadColumnTypes(ctx, table)
+	if err != nil {
+		if ok {
+			return cached.types
+		}
+		return map[string]string{}
+	}
+	a.columnsMu.Lock()
+	a.columns[table] = mysqlColumnTypes{types: types, loaded: time.Now()}
+	a.columnsMu.Unlock()
+	return types
+}
+
+func (a *MySQLAdapter) loadColumnTypes(ctx context.Context, table string) (map[string]string, error) {
+	rows, err := a.db.QueryContext(ctx,
+		"SELECT COLUMN_NAME, DATA_TYPE FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	types := make(map[string]string)
+	for rows.Next() {
+		var name, dataType string
+		if err := rows.Scan(&name, &dataType); err != nil {
+			return nil, err
+		}
+		types[name] = strings.ToLower(dataType)
+	}
+	return types, rows.Err()
+}
+
+// invalidateColumns drops every cached column type and prepared statement
+// after a schema change.
+func (a *MySQLAdapter) invalidateColumns() {
+	a.stmts.reset()
+	a.columnsMu.Lock()
+	a.columns = make(map[string]mysqlColumnTypes)
+	a.columnsMu.Unlock()
+}
+
+// writeValues returns data with its values converted for the columns of
+// table.
+func (a *MySQLAdapter) writeValues(ctx context.Context, table string, data map[string]any) map[string]any {
+	names := make([]string, 0, len(data))
+	for name := range data {
+		names = append(names, name)
+	}
+	types := a.columnTypes(ctx, table, names...)
+	out := make(map[string]any, len(data))
+	for name, v := range data {
+		out[name] = mysqlValue(types[name], v)
+	}
+	return out
+}
+
+// mysqlIsDatetime reports whether an information_schema data type holds
+// a datetime.
+func mysqlIsDatetime(dataType string) bool {
+	return dataType == "datetime" || dataType == "timestamp"
+}
+
+// mysqlValue converts a value bound to a column of the given data type.
+// Moon passes datetimes as RFC 3339 text, which a DATETIME column does not
+// accept, so they are bound as UTC times instead.
+func mysqlValue(dataType string, v any) any {
+	if !mysqlIsDatetime(dataType) {
+		return v
+	}
+	switch t := v.(type) {
+	case string:
+		if ts, err := time.Parse(time.RFC3339Nano, t); err == nil {
+			return ts.UTC()
+		}
+	case time.Time:
+		return t.UTC()
+	}
+	return v
+}
+
+// ---------------------------------------------------------------------------
+// SQL helpers
+// ---------------------------------------------------------------------------
+
+// whereClause builds the WHERE clause for opts on table.
+func (a *MySQLAdapter) whereClause(ctx context.Context, table string, opts QueryOptions) (string, []any) {
+	var types map[string]string
+	if len(opts.Filters) > 0 {
+		names := make([]string, len(opts.Filters))
+		for i, f := range opts.Filters {
+			names[i] = f.Field
+		}
+		types = a.columnTypes(ctx, table, names...)
+	}
+	return mysqlWhereClause(opts, types)
+}
+
+// mysqlWhereClause is buildWhereClause for MySQL. types holds the
+// information_schema data type of the filtered columns, used to convert
+// datetime values. ieq and search compare lowercased text, since string
+// columns are case-sensitive by default.
+func mysqlWhereClause(opts QueryOptions, types map[string]string) (string, []any) {
+	var conditions []string
+	var args []any
+
+	for _, f := range opts.Filters {
+		target := quoteIdent(f.Field)
+		var targetArgs []any
+		if f.Path != "" {
+			// Match json_extract in SQLite: JSON true and false compare as
+			// 1 and 0, JSON null as NULL, and other scalars as their text.
+			col := quoteIdent(f.Field)
+			target = fmt.Sprintf("(CASE JSON_TYPE(JSON_EXTRACT(%s, ?)) WHEN 'BOOLEAN' THEN IF(JSON_EXTRACT(%s, ?) = CAST('true' AS JSON), 1, 0) WHEN 'NULL' THEN NULL ELSE JSON_UNQUOTE(JSON_EXTRACT(%s, ?)) END)", col, col, col)
+			path := `$."` + f.Path + `"`
+			targetArgs = []any{path, path, path}
+		}
+		dataType := ""
+		if f.Path == "" {
+			dataType = types[f.Field]
+		}
+		if f.Op == "in" {
+			var values []any
+			switch v := f.Value.(type) {
+			case []string:
+				for _, s := range v {
+					values = append(values, s)
+				}
+			case []any:
+				values = v
+			}
+			if len(values) == 0 {
+				continue
+			}
+			args = append(args, targetArgs...)
+			placeholders := make([]string, len(values))
+			for i, v := range values {
+				placeholders[i] = "?"
+				args = append(args, mysqlValue(dataType, v))
+			}
+			conditions = append(conditions,
+				fmt.Sprintf("%s IN (%s)", target, strings.Join(placeholders, ", ")))
+			continue
+		}
+		var cond string
+		switch f.Op {
+		case "ieq":
+			cond = fmt.Sprintf("LOWER(%s) = LOWER(?)", target)
+		case "ilike":
+			cond = fmt.Sprintf("LOWER(%s) LIKE LOWER(?)", target)
+		case "is_null":
+			cond = target + " IS NULL"
+		case "not_null":
+			cond = target + " IS NOT NULL"
+		default:
+			sqlOp, ok := filterOpSQL[f.Op]
+			if !ok {
+				continue
+			}
+			cond = fmt.Sprintf("%s %s ?", target, sqlOp)
+		}
+		conditions = append(conditions, cond)
+		args = append(args, targetArgs...)
+		if f.Op != "is_null" && f.Op != "not_null" {
+			args = append(args, mysqlValue(dataType, f.Value))
+		}
+	}
+
+	if opts.Search != "" && len(opts.SearchFields) > 0 {
+		var searchConds []string
+		for _, sf := range opts.SearchFields {
+			searchConds = append(searchConds, fmt.Sprintf("LOWER(%s) LIKE LOWER(?)", quoteIdent(sf)))
+			args = append(args, "%"+opts.Search+"%")
+		}
+		conditions = append(conditions, "("+strings.Join(searchConds, " OR ")+")")
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// mysqlScanRows reads all rows into maps holding the same Go types the
+// SQLite adapter returns; see mysqlScanValue.
+func mysqlScanRows(rows *sql.Rows) ([]map[string]any, error) {
+	var results []map[string]any
+	err := mysqlEachRow(rows, func(row map[string]any) error {
+		results = append(results, row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// mysqlEachRow is eachRow with the values converted by mysqlScanValue.
+func mysqlEachRow(rows *sql.Rows, each func(map[string]any) error) error {
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		values := make([]any, len(cols))
+		ptrs := make([]any, len(cols))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return err
+		}
+		row := make(map[string]any, len(cols))
+		for i, col := range cols {
+			row[col] = mysqlScanValue(values[i], colTypes[i].DatabaseTypeName())
+		}
+		if err := each(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// mysqlScanValue converts a scanned value of the given driver type name.
+// The driver returns text, JSON, and DECIMAL values as bytes; they become
+// strings, with decimals in canonical form. Datetimes become RFC 3339
+// text, the form Moon stores in SQLite.
+func mysqlScanValue(v any, dbType string) any {
+	switch t := v.(type) {
+	case []byte:
+		switch dbType {
+		case "DECIMAL":
+			return mysqlDecimalText(string(t))
+		case "BINARY", "VARBINARY", "BLOB", "TINYBLOB", "MEDIUMBLOB", "LONGBLOB", "BIT", "GEOMETRY":
+			return t
+		}
+		return string(t)
+	case time.Time:
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+	return v
+}
+
+// mysqlDecimalText returns the canonical form of DECIMAL text, which MySQL
+// pads with zeros to the column scale.
+func mysqlDecimalText(s string) string {
+	if canonical, ok := normalizeDecimal(s); ok {
+		return canonical
+	}
+	return s
+}
+
+// mysqlErrorKind maps MySQL server error numbers to sentinel errors.
+func mysqlErrorKind(err error) error {
+	var me *mysql.MySQLError
+	if !errors.As(err, &me) {
+		return nil
+	}
+	switch me.Number {
+	case 1062: // ER_DUP_ENTRY
+		return ErrUniqueViolation
+	case 1451, 1452: // ER_ROW_IS_REFERENCED_2, ER_NO_REFERENCED_ROW_2
+		return ErrForeignKey
+	case 3819: // ER_CHECK_CONSTRAINT_VIOLATED
+		return ErrCheckViolation
+	case 1048, 1364: // ER_BAD_NULL_ERROR, ER_NO_DEFAULT_FOR_FIELD
+		return ErrNotNull
+	case 1040: // ER_CON_COUNT_ERROR
+		return ErrUnavailable
+	}
+	return nil
 }
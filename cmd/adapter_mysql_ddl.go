@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ---------------------------------------------------------------------------
+// DDL translation
+//
+// Moon writes DDL in the SQLite dialect: the column types of
+// moonTypeToSQLite, COLLATE NOCASE, inline UNIQUE, and CHECK constraints
+// from fieldRulesCheckSQL. The MySQL adapter rewrites each statement before
+// running it; statements it does not recognize run unchanged.
+// ---------------------------------------------------------------------------
+
+// mysqlIdentPattern matches a double-quoted, backquoted, or bare identifier.
+const mysqlIdentPattern = "(\"(?:[^\"]|\"\")+\"|`[^`]+`|\\w+)"
+
+var (
+	mysqlCreateTableRe  = regexp.MustCompile(`(?is)^CREATE\s+TABLE\s+(IF\s+NOT\s+EXISTS\s+)?` + mysqlIdentPattern + `\s*\((.*)\)$`)
+	mysqlAddColumnRe    = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+` + mysqlIdentPattern + `\s+ADD\s+COLUMN\s+(.*)$`)
+	mysqlRenameColumnRe = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+` + mysqlIdentPattern + `\s+RENAME\s+COLUMN\s+` + mysqlIdentPattern + `\s+TO\s+` + mysqlIdentPattern + `$`)
+	mysqlDropColumnRe   = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+` + mysqlIdentPattern + `\s+DROP\s+COLUMN\s+` + mysqlIdentPattern + `$`)
+	mysqlCreateIndexRe  = regexp.MustCompile(`(?is)^CREATE\s+(UNIQUE\s+)?INDEX\s+(IF\s+NOT\s+EXISTS\s+)?` + mysqlIdentPattern + `\s+ON\s+` + mysqlIdentPattern + `\s*\((.*)\)$`)
+	mysqlTableUniqueRe  = regexp.MustCompile(`(?is)^CONSTRAINT\s+` + mysqlIdentPattern + `\s+UNIQUE\s*\((.*)\)$`)
+	mysqlLengthCallRe   = regexp.MustCompile(`\blength\(`)
+)
+
+// translateDDL returns the MySQL statements that carry out ddl. Statements
+// that need the current schema read it from information_schema: CREATE
+// INDEX gets prefix lengths for text columns and honors IF NOT EXISTS,
+// which MySQL lacks for indexes, and renaming or dropping a column first
+// drops the CHECK constraints on it, which MySQL otherwise refuses.
+func (a *MySQLAdapter) translateDDL(ctx context.Context, ddl string) ([]string, error) {
+	stmt := strings.TrimSpace(ddl)
+
+	if m := mysqlCreateIndexRe.FindStringSubmatch(stmt); m != nil {
+		table := mysqlUnquoteIdent(m[4])
+		idx := IndexInfo{Name: mysqlUnquoteIdent(m[3]), Unique: m[1] != ""}
+		for _, c := range splitColumnDefs(m[5]) {
+			idx.Columns = append(idx.Columns, mysqlUnquoteIdent(c))
+		}
+		if m[2] != "" {
+			existing, err := a.tableIndexes(ctx, table)
+			if err != nil {
+				return nil, err
+			}
+			for _, e := range existing {
+				if e.Name == idx.Name {
+					return nil, nil
+				}
+			}
+		}
+		return []string{a.createIndexStatement(ctx, table, idx)}, nil
+	}
+
+	if m := mysqlRenameColumnRe.FindStringSubmatch(stmt); m != nil {
+		return a.withoutColumnChecks(ctx, mysqlUnquoteIdent(m[1]), mysqlUnquoteIdent(m[2]), mysqlUnquoteIdent(m[3]), stmt)
+	}
+	if m := mysqlDropColumnRe.FindStringSubmatch(stmt); m != nil {
+		return a.withoutColumnChecks(ctx, mysqlUnquoteIdent(m[1]), mysqlUnquoteIdent(m[2]), "", stmt)
+	}
+
+	return []string{mysqlTranslateDDL(stmt)}, nil
+}
+
+// createIndexStatement returns the CREATE INDEX statement for idx. Text
+// columns are indexed on their first MySQLIndexPrefixLength characters,
+// the most MySQL allows, so a unique index on a longer value only
+// enforces uniqueness of that prefix.
+func (a *MySQLAdapter) createIndexStatement(ctx context.Context, table string, idx IndexInfo) string {
+	types, err := a.loadColumnTypes(ctx, table)
+	if err != nil {
+		types = map[string]string{}
+	}
+	cols := make([]string, len(idx.Columns))
+	for i, c := range idx.Columns {
+		cols[i] = quoteIdent(c)
+		switch types[c] {
+		case "tinytext", "text", "mediumtext", "longtext":
+			cols[i] += fmt.Sprintf("(%d)", MySQLIndexPrefixLength)
+		}
+	}
+	kind := "INDEX"
+	if idx.Unique {
+		kind = "UNIQUE INDEX"
+	}
+	return fmt.Sprintf("CREATE %s %s ON %s (%s)", kind, quoteIdent(idx.Name), quoteIdent(table), strings.Join(cols, ", "))
+}
+
+// withoutColumnChecks wraps stmt, which renames column to newName or, when
+// newName is empty, drops it, so the CHECK constraints on the column are
+// dropped first. After a rename they are recreated on the new name.
+func (a *MySQLAdapter) withoutColumnChecks(ctx context.Context, table, column, newName, stmt string) ([]string, error) {
+	checks, err := a.checkConstraints(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	var before, after []string
+	ref := "`" + column + "`"
+	for _, c := range checks {
+		if !strings.Contains(c.Clause, ref) {
+			continue
+		}
+		before = append(before, fmt.Sprintf("ALTER TABLE %s DROP CHECK %s", quoteIdent(table), quoteIdent(c.Name)))
+		if newName != "" {
+			clause := strings.ReplaceAll(mysqlUnescapeClause(c.Clause), ref, "`"+newName+"`")
+			after = append(after, fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s CHECK %s", quoteIdent(table), quoteIdent(c.Name), clause))
+		}
+	}
+	return append(append(before, stmt), after...), nil
+}
+
+// mysqlCheck is a CHECK constraint as information_schema reports it.
+type mysqlCheck struct {
+	Name   string
+	Clause string
+}
+
+// checkConstraints returns the CHECK constraints of table.
+func (a *MySQLAdapter) checkConstraints(ctx context.Context, table string) ([]mysqlCheck, error) {
+	rows, err := a.db.QueryContext(ctx,
+		`SELECT cc.CONSTRAINT_NAME, cc.CHECK_CLAUSE
+		FROM information_schema.TABLE_CONSTRAINTS tc
+		JOIN information_schema.CHECK_CONSTRAINTS cc
+			ON cc.CONSTRAINT_SCHEMA = tc.CONSTRAINT_SCHEMA AND cc.CONSTRAINT_NAME = tc.CONSTRAINT_NAME
+		WHERE tc.TABLE_SCHEMA = DATABASE() AND tc.TABLE_NAME = ? AND tc.CONSTRAINT_TYPE = 'CHECK'
+		ORDER BY cc.CONSTRAINT_NAME`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var checks []mysqlCheck
+	for rows.Next() {
+		var c mysqlCheck
+		if err := rows.Scan(&c.Name, &c.Clause); err != nil {
+			return nil, err
+		}
+		checks = append(checks, c)
+	}
+	return checks, rows.Err()
+}
+
+// mysqlUnescapeClause undoes the backslash escaping of quotes in
+// CHECK_CLAUSE, giving text that can be executed again.
+func mysqlUnescapeClause(clause string) string {
+	return strings.ReplaceAll(clause, `\'`, "'")
+}
+
+// mysqlCheckClauseSQL rewrites a CHECK_CLAUSE, such as
+// (`status` in (_utf8mb4'a',_utf8mb4'b')), into the text
+// fieldRulesCheckSQL writes, so parseFieldRulesSQL can read it.
+func mysqlCheckClauseSQL(clause string) string {
+	s := mysqlUnescapeClause(clause)
+	s = strings.ReplaceAll(s, "`", `"`)
+	s = strings.ReplaceAll(s, "_utf8mb4'", "'")
+	s = strings.ReplaceAll(s, "char_length(", "length(")
+	s = strings.ReplaceAll(s, " in (", " IN (")
+	s = strings.ReplaceAll(s, "','", "', '")
+	return s
+}
+
+// mysqlTranslateDDL rewrites CREATE TABLE and ALTER TABLE ADD COLUMN
+// statements for MySQL and returns any other statement unchanged.
+func mysqlTranslateDDL(stmt string) string {
+	if m := mysqlCreateTableRe.FindStringSubmatch(stmt); m != nil {
+		return mysqlCreateTableSQL(m[1] != "", m[2], m[3])
+	}
+	if m := mysqlAddColumnRe.FindStringSubmatch(stmt); m != nil {
+		name, rest := splitColumnName(strings.TrimSpace(m[2]))
+		def, unique := mysqlColumnSQL(rest, false)
+		out := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m[1], quoteIdent(name), def)
+		if unique {
+			out += fmt.Sprintf(", ADD CONSTRAINT %s UNIQUE (%s)", quoteIdent(mysqlUniqueName()), quoteIdent(name))
+		}
+		return out
+	}
+	return stmt
+}
+
+// mysqlCreateTableSQL rebuilds a CREATE TABLE statement with MySQL column
+// definitions. Columns named in a table-level UNIQUE constraint are keys;
+// every unique constraint is renamed with MySQLUniqueConstraintPrefix.
+func mysqlCreateTableSQL(ifNotExists bool, table, body string) string {
+	defs := splitColumnDefs(body)
+	keys := make(map[string]bool)
+	for _, def := range defs {
+		if m := mysqlTableUniqueRe.FindStringSubmatch(def); m != nil {
+			for _, c := range splitColumnDefs(m[2]) {
+				keys[mysqlUnquoteIdent(c)] = true
+			}
+		}
+	}
+
+	out := make([]string, 0, len(defs))
+	for _, def := range defs {
+		if m := mysqlTableUniqueRe.FindStringSubmatch(def); m != nil {
+			out = append(out, fmt.Sprintf("CONSTRAINT %s UNIQUE (%s)", quoteIdent(mysqlUniqueName()), m[2]))
+			continue
+		}
+		upper := strings.ToUpper(def)
+		if strings.HasPrefix(upper, "CONSTRAINT ") || strings.HasPrefix(upper, "PRIMARY KEY") || strings.HasPrefix(upper, "UNIQUE") || strings.HasPrefix(upper, "CHECK") {
+			out = append(out, def)
+			continue
+		}
+		name, rest := splitColumnName(def)
+		col, unique := mysqlColumnSQL(rest, keys[name])
+		out = append(out, quoteIdent(name)+" "+col)
+		if unique {
+			out = append(out, fmt.Sprintf("CONSTRAINT %s UNIQUE (%s)", quoteIdent(mysqlUniqueName()), quoteIdent(name)))
+		}
+	}
+
+	exists := ""
+	if ifNotExists {
+		exists = "IF NOT EXISTS "
+	}
+	return fmt.Sprintf("CREATE TABLE %s%s (%s) DEFAULT CHARSET=utf8mb4 COLLATE=%s",
+		exists, table, strings.Join(out, ", "), MySQLDefaultCollation)
+}
+
+// mysqlColumnSQL translates the part of a column definition after its
+// name. key marks a column that a table-level unique constraint covers.
+// An inline UNIQUE is removed and reported, so the caller can add it as a
+// named constraint.
+func mysqlColumnSQL(rest string, key bool) (string, bool) {
+	head, checks := rest, ""
+	if i := strings.Index(strings.ToUpper(rest), " CHECK ("); i >= 0 {
+		head, checks = rest[:i], rest[i:]
+	}
+	tokens := strings.Fields(head)
+	if len(tokens) == 0 {
+		return rest, false
+	}
+
+	unique := false
+	for _, tok := range tokens[1:] {
+		switch strings.ToUpper(tok) {
+		case "UNIQUE":
+			unique = true
+		case "PRIMARY":
+			key = true
+		}
+	}
+	key = key || unique
+
+	sqlType := strings.ToUpper(tokens[0])
+	out := []string{mysqlColumnType(sqlType, key)}
+	for i := 1; i < len(tokens); i++ {
+		tok := tokens[i]
+		switch strings.ToUpper(tok) {
+		case "UNIQUE":
+			continue
+		case "COLLATE":
+			if i+1 < len(tokens) && strings.EqualFold(strings.Trim(tokens[i+1], `"'`), CollationNocase) {
+				out = append(out, "COLLATE", MySQLCaseInsensitiveCollation)
+				i++
+				continue
+			}
+		case "DEFAULT":
+			if i+1 < len(tokens) {
+				out = append(out, "DEFAULT", mysqlDefaultSQL(sqlType, key, tokens[i+1]))
+				i++
+				continue
+			}
+		}
+		out = append(out, tok)
+	}
+	return strings.Join(out, " ") + mysqlLengthCallRe.ReplaceAllString(checks, "char_length("), unique
+}
+
+// mysqlColumnType maps a SQLite column type to its MySQL equivalent. key
+// selects MySQLTypeKey for text columns that are indexed in full.
+func mysqlColumnType(sqlType string, key bool) string {
+	switch {
+	case sqlType == SQLiteTypeString:
+		if key {
+			return MySQLTypeKey
+		}
+		return MySQLTypeString
+	case sqlType == SQLiteTypeInteger || sqlType == "BIGINT":
+		return MySQLTypeInteger
+	case sqlType == SQLiteTypeDecimal:
+		return MySQLTypeDecimal
+	case strings.HasPrefix(sqlType, SQLiteTypeDecimal+"("):
+		return "DECIMAL" + strings.TrimPrefix(sqlType, SQLiteTypeDecimal)
+	case sqlType == SQLiteTypeBoolean:
+		return MySQLTypeBoolean
+	case sqlType == SQLiteTypeDatetime:
+		return MySQLTypeDatetime
+	case sqlType == SQLiteTypeJSON:
+		return MySQLTypeJSON
+	}
+	return sqlType
+}
+
+// mysqlDefaultSQL translates a DEFAULT value. LONGTEXT and JSON columns
+// only take expression defaults, and the empty string that SQLite accepts
+// for any type is not a valid JSON or DATETIME value, so those columns
+// default to JSON null and the Unix epoch instead.
+func mysqlDefaultSQL(sqlType string, key bool, value string) string {
+	switch {
+	case sqlType == SQLiteTypeJSON && value == "''":
+		return "('null')"
+	case sqlType == SQLiteTypeJSON, sqlType == SQLiteTypeString && !key:
+		return "(" + value + ")"
+	case sqlType == SQLiteTypeDatetime && value == "''":
+		return "'1970-01-01 00:00:00'"
+	}
+	return value
+}
+
+// mysqlUniqueName returns a fresh name for a unique constraint. MySQL
+// scopes the names to a table, but a renamed column keeps its constraint,
+// so names derived from the column could collide.
+func mysqlUniqueName() string {
+	return MySQLUniqueConstraintPrefix + strings.ToLower(GenerateULID())
+}
+
+// mysqlUnquoteIdent strips double or back quotes from an identifier.
+func mysqlUnquoteIdent(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return strings.ReplaceAll(s[1:len(s)-1], `""`, `"`)
+	}
+	if len(s) >= 2 && s[0] == '`' && s[len(s)-1] == '`' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
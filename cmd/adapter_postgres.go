@@ -47,18 +47,46 @@ func (a *PostgresAdapter) ExecDDL(ctx context.Context, ddl string) error {
 	return fmt.Errorf("postgres adapter not implemented")
 }
 
+func (a *PostgresAdapter) ExecDDLBatch(ctx context.Context, statements []string) error {
+	return fmt.Errorf("postgres adapter not implemented")
+}
+
 func (a *PostgresAdapter) QueryRows(ctx context.Context, table string, opts QueryOptions) ([]map[string]any, int, error) {
 	return nil, 0, fmt.Errorf("postgres adapter not implemented")
 }
 
+func (a *PostgresAdapter) ReadSnapshot(ctx context.Context, read func(SnapshotReader) error) error {
+	return fmt.Errorf("postgres adapter not implemented")
+}
+
 func (a *PostgresAdapter) InsertRow(ctx context.Context, table string, data map[string]any) error {
 	return fmt.Errorf("postgres adapter not implemented")
 }
 
+func (a *PostgresAdapter) InsertRows(ctx context.Context, table string, rows []map[string]any) error {
+	return fmt.Errorf("postgres adapter not implemented")
+}
+
 func (a *PostgresAdapter) UpdateRow(ctx context.Context, table string, id string, data map[string]any) error {
 	return fmt.Errorf("postgres adapter not implemented")
 }
 
+func (a *PostgresAdapter) UpdateRowVersion(ctx context.Context, table string, id string, expected int64, data map[string]any) (bool, error) {
+	return false, fmt.Errorf("postgres adapter not implemented")
+}
+
+func (a *PostgresAdapter) ExecWriteBatch(ctx context.Context, writes []BatchWrite) (int, error) {
+	return 0, fmt.Errorf("postgres adapter not implemented")
+}
+
+func (a *PostgresAdapter) UpdateWhere(ctx context.Context, table string, filters []Filter, data map[string]any, versioned bool, limit int) (int, error) {
+	return 0, fmt.Errorf("postgres adapter not implemented")
+}
+
+func (a *PostgresAdapter) DeleteWhere(ctx context.Context, table string, filters []Filter, limit int) (int, error) {
+	return 0, fmt.Errorf("postgres adapter not implemented")
+}
+
 func (a *PostgresAdapter) DeleteRow(ctx context.Context, table string, id string) error {
 	return fmt.Errorf("postgres adapter not implemented")
 }
@@ -71,6 +99,30 @@ func (a *PostgresAdapter) DescribeTable(ctx context.Context, table string) ([]Co
 	return nil, fmt.Errorf("postgres adapter not implemented")
 }
 
+func (a *PostgresAdapter) ListIndexes(ctx context.Context, table string) ([]IndexInfo, error) {
+	return nil, fmt.Errorf("postgres adapter not implemented")
+}
+
+func (a *PostgresAdapter) CreateIndex(ctx context.Context, table string, idx IndexInfo) error {
+	return fmt.Errorf("postgres adapter not implemented")
+}
+
+func (a *PostgresAdapter) DropIndex(ctx context.Context, table, name string) error {
+	return fmt.Errorf("postgres adapter not implemented")
+}
+
 func (a *PostgresAdapter) CountRows(ctx context.Context, table string) (int, error) {
 	return 0, fmt.Errorf("postgres adapter not implemented")
 }
+
+func (a *PostgresAdapter) NumericHistogram(ctx context.Context, table, field string, buckets int, filters []Filter) (*HistogramResult, error) {
+	return nil, fmt.Errorf("postgres adapter not implemented")
+}
+
+func (a *PostgresAdapter) TimeSeries(ctx context.Context, table string, q TimeSeriesQuery) ([]TimeSeriesPoint, error) {
+	return nil, fmt.Errorf("postgres adapter not implemented")
+}
+
+func (a *PostgresAdapter) Pivot(ctx context.Context, table string, q PivotQuery) ([]PivotCell, error) {
+	return nil, fmt.Errorf("postgres adapter not implemented")
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"sync/atomic"
+)
+
+// ---------------------------------------------------------------------------
+// Read replicas
+//
+// With database.replicas set, the reads of list and get requests go to the
+// replicas, in turn, skipping any that does not answer its health pings.
+// Every other read, every write, and every transaction uses the primary,
+// so the server never acts on a replica that lags behind. A list or get
+// request can still see its own writes by sending X-Read-Primary: true.
+// ---------------------------------------------------------------------------
+
+// replicaReadKey marks a context whose QueryRows calls a replica may serve.
+type replicaReadKey struct{}
+
+// WithReplicaRead returns a copy of ctx whose QueryRows calls a replica may
+// serve.
+func WithReplicaRead(ctx context.Context) context.Context {
+	return context.WithValue(ctx, replicaReadKey{}, true)
+}
+
+// replicaReadAllowed reports whether ctx was marked by WithReplicaRead.
+func replicaReadAllowed(ctx context.Context) bool {
+	ok, _ := ctx.Value(replicaReadKey{}).(bool)
+	return ok
+}
+
+// readContext returns the context for the reads of a list or get request,
+// which a replica or the query result cache may serve unless the request
+// sets ReadPrimaryHeader.
+func readContext(r *http.Request) context.Context {
+	ctx := r.Context()
+	if r.Header.Get(ReadPrimaryHeader) == "true" {
+		return ctx
+	}
+	return WithCachedRead(WithReplicaRead(ctx))
+}
+
+// ReplicatedAdapter is a DatabaseAdapter for a primary database and its
+// read replicas. QueryRows calls on a context marked by WithReplicaRead go
+// to a replica; all other calls go to the primary.
+type ReplicatedAdapter struct {
+	DatabaseAdapter // the primary
+
+	replicas []*replica
+	next     atomic.Uint64
+	logger   *Logger
+}
+
+// replica is one read replica and the monitor of its availability.
+type replica struct {
+	host   string
+	db     DatabaseAdapter
+	health *DBHealth
+}
+
+// ConnectReplicas opens the replicas in cfg and returns primary wrapped in
+// a ReplicatedAdapter, or primary itself when there are none. A replica
+// that does not answer yet is marked unavailable rather than failing
+// startup; its health pings, every cfg.HealthInterval seconds, bring it
+// into use once it answers.
+func ConnectReplicas(ctx context.Context, primary DatabaseAdapter, cfg DatabaseConfig, logger *Logger) (DatabaseAdapter, error) {
+	if len(cfg.Replicas) == 0 {
+		return primary, nil
+	}
+	a := &ReplicatedAdapter{DatabaseAdapter: primary, logger: logger}
+	for _, rc := range cfg.ReplicaConfigs() {
+		db, err := NewDatabaseAdapter(rc, logger)
+		if err != nil {
+			a.Close()
+			return nil, err
+		}
+		r := &replica{host: rc.Host, db: db, health: NewDBHealth(db, logger)}
+		a.replicas = append(a.replicas, r)
+		if !r.health.check(ctx) {
+			logger.Warn("database replica not reachable; reads use the primary until it answers", "host", rc.Host)
+		}
+		r.health.Start(cfg.HealthInterval)
+	}
+	return a, nil
+}
+
+// QueryRows reads from a replica when ctx allows it and one is available,
+// and from the primary otherwise. A replica that fails is not retried for
+// this call; the primary answers instead, so a replica that lags behind a
+// schema change does not fail the request.
+func (a *ReplicatedAdapter) QueryRows(ctx context.Context, table string, opts QueryOptions) ([]map[string]any, int, error) {
+	if replicaReadAllowed(ctx) {
+		if r := a.pick(); r != nil {
+			rows, total, err := r.db.QueryRows(ctx, table, opts)
+			if err == nil {
+				return rows, total, nil
+			}
+			a.logger.Warn("replica read failed; reading from the primary", "host", r.host, "table", table, "error", err)
+			if errors.Is(err, ErrUnavailable) {
+				r.health.check(ctx)
+			}
+		}
+	}
+	return a.DatabaseAdapter.QueryRows(ctx, table, opts)
+}
+
+// StreamRows streams from a replica like QueryRows reads from one. A
+// replica that fails before passing on a row is replaced by the primary;
+// once rows have been passed on, the error is returned.
+func (a *ReplicatedAdapter) StreamRows(ctx context.Context, table string, opts QueryOptions, each func(map[string]any) error) (int, error) {
+	if replicaReadAllowed(ctx) {
+		if r := a.pick(); r != nil {
+			sent := false
+			total, err := streamRows(ctx, r.db, table, opts, func(row map[string]any) error {
+				sent = true
+				return each(row)
+			})
+			if err == nil || sent {
+				return total, err
+			}
+			a.logger.Warn("replica read failed; reading from the primary", "host", r.host, "table", table, "error", err)
+			if errors.Is(err, ErrUnavailable) {
+				r.health.check(ctx)
+			}
+		}
+	}
+	return streamRows(ctx, a.DatabaseAdapter, table, opts, each)
+}
+
+// pick returns the next available replica in round-robin order, or nil
+// when none is available.
+func (a *ReplicatedAdapter) pick() *replica {
+	n := uint64(len(a.replicas))
+	start := a.next.Add(1)
+	for i := range n {
+		if r := a.replicas[(start+i)%n]; r.health.Available() {
+			return r
+		}
+	}
+	return nil
+}
+
+// Close stops the replica health pings and closes the replicas and the
+// primary.
+func (a *ReplicatedAdapter) Close() error {
+	for _, r := range a.replicas {
+		r.health.Close()
+		r.db.Close()
+	}
+	return a.DatabaseAdapter.Close()
+}
+
+// SetSlowQueryThreshold applies ms to the primary and every replica.
+func (a *ReplicatedAdapter) SetSlowQueryThreshold(ms int) {
+	for _, db := range a.all() {
+		if s, ok := db.(slowQueryThresholdSetter); ok {
+			s.SetSlowQueryThreshold(ms)
+		}
+	}
+}
+
+// PoolStats returns the connection pool statistics of the primary.
+func (a *ReplicatedAdapter) PoolStats() sql.DBStats {
+	if ps, ok := a.DatabaseAdapter.(poolStatser); ok {
+		return ps.PoolStats()
+	}
+	return sql.DBStats{}
+}
+
+// WriteRetryStats returns the write retry counters of the primary, which
+// takes every write.
+func (a *ReplicatedAdapter) WriteRetryStats() map[string]int64 {
+	if rs, ok := a.DatabaseAdapter.(writeRetryStatser); ok {
+		return rs.WriteRetryStats()
+	}
+	return nil
+}
+
+// StatementCacheStats returns the prepared statement cache counters of
+// the primary.
+func (a *ReplicatedAdapter) StatementCacheStats() map[string]any {
+	if sc, ok := a.DatabaseAdapter.(statementCacheStatser); ok {
+		return sc.StatementCacheStats()
+	}
+	return nil
+}
+
+// ReplicaStats reports each replica's host and whether it is in use, for
+// /admin:diagnostics.
+func (a *ReplicatedAdapter) ReplicaStats() []map[string]any {
+	stats := make([]map[string]any, len(a.replicas))
+	for i, r := range a.replicas {
+		stats[i] = map[string]any{"host": r.host, "available": r.health.Available()}
+	}
+	return stats
+}
+
+// TrackShadowChanges implements ShadowRebuilder on the primary.
+func (a *ReplicatedAdapter) TrackShadowChanges(ctx context.Context, s ShadowTable) error {
+	rb, ok := a.DatabaseAdapter.(ShadowRebuilder)
+	if !ok {
+		return errShadowUnsupported
+	}
+	return rb.TrackShadowChanges(ctx, s)
+}
+
+// CopyShadowBatch implements ShadowRebuilder on the primary.
+func (a *ReplicatedAdapter) CopyShadowBatch(ctx context.Context, s ShadowTable, after string, limit int) (string, int, error) {
+	rb, ok := a.DatabaseAdapter.(ShadowRebuilder)
+	if !ok {
+		return "", 0, errShadowUnsupported
+	}
+	return rb.CopyShadowBatch(ctx, s, after, limit)
+}
+
+// SwapShadowTable implements ShadowRebuilder on the primary.
+func (a *ReplicatedAdapter) SwapShadowTable(ctx context.Context, s ShadowTable, indexes []IndexInfo) error {
+	rb, ok := a.DatabaseAdapter.(ShadowRebuilder)
+	if !ok {
+		return errShadowUnsupported
+	}
+	return rb.SwapShadowTable(ctx, s, indexes)
+}
+
+// DropShadowTable implements ShadowRebuilder on the primary.
+func (a *ReplicatedAdapter) DropShadowTable(ctx context.Context, s ShadowTable) error {
+	rb, ok := a.DatabaseAdapter.(ShadowRebuilder)
+	if !ok {
+		return errShadowUnsupported
+	}
+	return rb.DropShadowTable(ctx, s)
+}
+
+// all returns the primary followed by the replicas.
+func (a *ReplicatedAdapter) all() []DatabaseAdapter {
+	dbs := []DatabaseAdapter{a.DatabaseAdapter}
+	for _, r := range a.replicas {
+		dbs = append(dbs, r.db)
+	}
+	return dbs
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// replicaTestDB creates a SQLite database at path holding a products table
+// with one row titled title.
+func replicaTestDB(t *testing.T, path, title string) DatabaseAdapter {
+	t.Helper()
+	db, err := NewSQLiteAdapter(DatabaseConfig{
+		Connection: DBConnectionSQLite, Database: path, QueryTimeout: 5, SlowQueryThreshold: 500,
+	}, NewTestLogger(&bytes.Buffer{}))
+	if err != nil {
+		t.Fatalf("NewSQLiteAdapter: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	ctx := context.Background()
+	if err := db.ExecDDL(ctx, `CREATE TABLE products (id TEXT PRIMARY KEY, title TEXT NOT NULL)`); err != nil {
+		t.Fatalf("ExecDDL: %v", err)
+	}
+	if err := db.InsertRow(ctx, "products", map[string]any{"id": "01P", "title": title}); err != nil {
+		t.Fatalf("InsertRow: %v", err)
+	}
+	return db
+}
+
+// newTestReplicatedAdapter wraps primary with replicas whose availability
+// the test controls.
+func newTestReplicatedAdapter(primary DatabaseAdapter, replicas ...*pingAdapter) *ReplicatedAdapter {
+	logger := NewTestLogger(&bytes.Buffer{})
+	a := &ReplicatedAdapter{DatabaseAdapter: primary, logger: logger}
+	for i, db := range replicas {
+		a.replicas = append(a.replicas, &replica{
+			host:   fmt.Sprintf("replica-%d", i),
+			db:     db,
+			health: NewDBHealth(db, logger),
+		})
+	}
+	return a
+}
+
+func readTitle(t *testing.T, db DatabaseAdapter, ctx context.Context) string {
+	t.Helper()
+	rows, _, err := db.QueryRows(ctx, "products", QueryOptions{Page: 1, PerPage: 1})
+	if err != nil || len(rows) != 1 {
+		t.Fatalf("QueryRows: %v, %d rows", err, len(rows))
+	}
+	return rows[0]["title"].(string)
+}
+
+func TestReplicatedAdapter_RoutesMarkedReads(t *testing.T) {
+	dir := t.TempDir()
+	primary := replicaTestDB(t, filepath.Join(dir, "primary.db"), "primary")
+	a := newTestReplicatedAdapter(primary,
+		&pingAdapter{DatabaseAdapter: replicaTestDB(t, filepath.Join(dir, "a.db"), "a")},
+		&pingAdapter{DatabaseAdapter: replicaTestDB(t, filepath.Join(dir, "b.db"), "b")},
+	)
+
+	if got := readTitle(t, a, context.Background()); got != "primary" {
+		t.Fatalf("unmarked read: got %q, want primary", got)
+	}
+
+	seen := map[string]int{}
+	for range 4 {
+		seen[readTitle(t, a, WithReplicaRead(context.Background()))]++
+	}
+	if seen["a"] != 2 || seen["b"] != 2 {
+		t.Fatalf("expected reads to alternate between replicas, got %v", seen)
+	}
+
+	// Writes always go to the primary.
+	if err := a.InsertRow(context.Background(), "products", map[string]any{"id": "02P", "title": "new"}); err != nil {
+		t.Fatalf("InsertRow: %v", err)
+	}
+	if _, n, _ := primary.QueryRows(context.Background(), "products", QueryOptions{Page: 1, PerPage: 10}); n != 2 {
+		t.Fatalf("expected the write on the primary, got %d rows", n)
+	}
+}
+
+func TestReplicatedAdapter_SkipsUnavailableReplica(t *testing.T) {
+	dir := t.TempDir()
+	primary := replicaTestDB(t, filepath.Join(dir, "primary.db"), "primary")
+	down := &pingAdapter{DatabaseAdapter: replicaTestDB(t, filepath.Join(dir, "a.db"), "a")}
+	up := &pingAdapter{DatabaseAdapter: replicaTestDB(t, filepath.Join(dir, "b.db"), "b")}
+	a := newTestReplicatedAdapter(primary, down, up)
+
+	down.down.Store(true)
+	a.replicas[0].health.check(context.Background())
+	for range 3 {
+		if got := readTitle(t, a, WithReplicaRead(context.Background())); got != "b" {
+			t.Fatalf("expected the available replica, got %q", got)
+		}
+	}
+
+	up.down.Store(true)
+	a.replicas[1].health.check(context.Background())
+	if got := readTitle(t, a, WithReplicaRead(context.Background())); got != "primary" {
+		t.Fatalf("expected the primary with no replica available, got %q", got)
+	}
+}
+
+func TestReplicatedAdapter_FallsBackOnReplicaError(t *testing.T) {
+	dir := t.TempDir()
+	primary := replicaTestDB(t, filepath.Join(dir, "primary.db"), "primary")
+	lagging := replicaTestDB(t, filepath.Join(dir, "a.db"), "a")
+	if err := lagging.ExecDDL(context.Background(), `DROP TABLE products`); err != nil {
+		t.Fatalf("ExecDDL: %v", err)
+	}
+	a := newTestReplicatedAdapter(primary, &pingAdapter{DatabaseAdapter: lagging})
+
+	if got := readTitle(t, a, WithReplicaRead(context.Background())); got != "primary" {
+		t.Fatalf("expected the primary to answer, got %q", got)
+	}
+}
+
+func TestReplicatedAdapter_StreamFallsBackOnReplicaError(t *testing.T) {
+	dir := t.TempDir()
+	primary := replicaTestDB(t, filepath.Join(dir, "primary.db"), "primary")
+	lagging := replicaTestDB(t, filepath.Join(dir, "a.db"), "a")
+	if err := lagging.ExecDDL(context.Background(), `DROP TABLE products`); err != nil {
+		t.Fatalf("ExecDDL: %v", err)
+	}
+	a := newTestReplicatedAdapter(primary, &pingAdapter{DatabaseAdapter: lagging})
+
+	var titles []any
+	total, err := a.StreamRows(WithReplicaRead(context.Background()), "products", QueryOptions{Page: 1, PerPage: 10}, func(row map[string]any) error {
+		titles = append(titles, row["title"])
+		return nil
+	})
+	if err != nil || total != 1 || len(titles) != 1 || titles[0] != "primary" {
+		t.Fatalf("StreamRows = %d, %v, %v; want the primary's row", total, titles, err)
+	}
+}
+
+func TestConnectReplicas(t *testing.T) {
+	dir := t.TempDir()
+	primary := replicaTestDB(t, filepath.Join(dir, "primary.db"), "primary")
+	replicaTestDB(t, filepath.Join(dir, "a.db"), "a")
+
+	cfg := DatabaseConfig{Connection: DBConnectionSQLite, QueryTimeout: 5, SlowQueryThreshold: 500}
+	db, err := ConnectReplicas(context.Background(), primary, cfg, NewTestLogger(&bytes.Buffer{}))
+	if err != nil || db != primary {
+		t.Fatalf("expected the primary itself without replicas, got %T, %v", db, err)
+	}
+
+	cfg.Replicas = []ReplicaConfig{{Host: "replica-a", Database: filepath.Join(dir, "a.db")}}
+	db, err = ConnectReplicas(context.Background(), primary, cfg, NewTestLogger(&bytes.Buffer{}))
+	if err != nil {
+		t.Fatalf("ConnectReplicas: %v", err)
+	}
+	a, ok := db.(*ReplicatedAdapter)
+	if !ok {
+		t.Fatalf("expected a ReplicatedAdapter, got %T", db)
+	}
+	defer func() {
+		for _, r := range a.replicas {
+			r.health.Close()
+			r.db.Close()
+		}
+	}()
+	if got := readTitle(t, a, WithReplicaRead(context.Background())); got != "a" {
+		t.Fatalf("expected the replica to answer, got %q", got)
+	}
+	if stats := a.ReplicaStats(); len(stats) != 1 || stats[0]["host"] != "replica-a" || stats[0]["available"] != true {
+		t.Fatalf("unexpected replica stats: %v", stats)
+	}
+}
+
+func TestDatabaseConfig_ReplicaConfigs(t *testing.T) {
+	cfg := DatabaseConfig{
+		Connection: DBConnectionMySQL, Host: "primary", Database: "moon", User: "moon", Password: "secret",
+		QueryTimeout: 7,
+		Replicas: []ReplicaConfig{
+			{Host: "replica-1"},
+			{Host: "replica-2", User: "reader", Password: "other"},
+		},
+	}
+	got := cfg.ReplicaConfigs()
+	if len(got) != 2 {
+		t.Fatalf("expected 2 configs, got %d", len(got))
+	}
+	if got[0].Host != "replica-1" || got[0].User != "moon" || got[0].Password != "secret" || got[0].Database != "moon" || got[0].QueryTimeout != 7 {
+		t.Fatalf("replica 1 did not inherit the primary settings: %+v", got[0])
+	}
+	if got[1].User != "reader" || got[1].Password != "other" || got[1].Replicas != nil {
+		t.Fatalf("unexpected replica 2 settings: %+v", got[1])
+	}
+}
+
+func TestResourceQuery_ReadPrimaryHeader(t *testing.T) {
+	dir := t.TempDir()
+	primary := replicaTestDB(t, filepath.Join(dir, "primary.db"), "primary")
+	a := newTestReplicatedAdapter(primary,
+		&pingAdapter{DatabaseAdapter: replicaTestDB(t, filepath.Join(dir, "a.db"), "a")})
+	registry, err := NewSchemaRegistry(primary)
+	if err != nil {
+		t.Fatalf("NewSchemaRegistry: %v", err)
+	}
+	h := NewResourceQueryHandler(a, registry, &AppConfig{})
+
+	query := func(path string, readPrimary bool) string {
+		t.Helper()
+		r := makeQueryRequest(path)
+		if readPrimary {
+			r.Header.Set(ReadPrimaryHeader, "true")
+		}
+		w := httptest.NewRecorder()
+		h.HandleQuery(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", path, w.Code, w.Body.String())
+		}
+		data := decodeRQResponse(t, w)["data"].([]any)
+		return data[0].(map[string]any)["title"].(string)
+	}
+
+	for _, path := range []string{"/data/products:query", "/data/products:query?id=01P", "/data/products:query?after="} {
+		if got := query(path, false); got != "a" {
+			t.Errorf("%s: expected the replica, got %q", path, got)
+		}
+		if got := query(path, true); got != "primary" {
+			t.Errorf("%s with %s: expected the primary, got %q", path, ReadPrimaryHeader, got)
+		}
+	}
+}
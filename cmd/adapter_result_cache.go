@@ -0,0 +1,431 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ---------------------------------------------------------------------------
+// Query result cache
+//
+// With cache.query_ttl set, the rows read by list and get requests are kept
+// in memory for the TTL of their collection, up to cache.query_max_bytes,
+// least recently used out first. A write through this instance drops the
+// cached results of its table, and a schema change drops them all. Writes
+// made by other instances show once the TTL has passed.
+// ---------------------------------------------------------------------------
+
+// cachedReadKey marks a context whose QueryRows calls the query result
+// cache may answer.
+type cachedReadKey struct{}
+
+// WithCachedRead returns a copy of ctx whose QueryRows calls the query
+// result cache may answer.
+func WithCachedRead(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cachedReadKey{}, true)
+}
+
+// cachedReadAllowed reports whether ctx was marked by WithCachedRead.
+func cachedReadAllowed(ctx context.Context) bool {
+	ok, _ := ctx.Value(cachedReadKey{}).(bool)
+	return ok
+}
+
+// CachedAdapter is a DatabaseAdapter that answers QueryRows calls on a
+// context marked by WithCachedRead from a cache of earlier results. Every
+// other call goes to the wrapped adapter.
+type CachedAdapter struct {
+	DatabaseAdapter
+
+	ttls     map[string]time.Duration // by table; CacheQueryTTLDefaultKey for the rest
+	maxBytes int64
+	now      func() time.Time
+	counter  cacheCounter
+
+	mu      sync.Mutex
+	entries map[string]*list.Element // of *resultEntry
+	order   *list.List               // most recently used first
+	bytes   int64
+	epoch   uint64            // bumped by every schema change
+	writes  map[string]uint64 // by table, bumped by every write
+}
+
+// resultEntry is one cached QueryRows result.
+type resultEntry struct {
+	key     string
+	table   string
+	rows    []map[string]any
+	total   int
+	size    int64
+	expires time.Time
+}
+
+// NewCachedAdapter wraps db with the query result cache configured by cfg.
+// It returns db itself when cfg sets no TTL.
+func NewCachedAdapter(db DatabaseAdapter, cfg CacheConfig) DatabaseAdapter {
+	if len(cfg.QueryTTL) == 0 {
+		return db
+	}
+	ttls := make(map[string]time.Duration, len(cfg.QueryTTL))
+	for name, seconds := range cfg.QueryTTL {
+		ttls[name] = time.Duration(seconds) * time.Second
+	}
+	return &CachedAdapter{
+		DatabaseAdapter: db,
+		ttls:            ttls,
+		maxBytes:        cfg.QueryMaxBytes,
+		now:             time.Now,
+		entries:         make(map[string]*list.Element),
+		order:           list.New(),
+		writes:          make(map[string]uint64),
+	}
+}
+
+// ttl returns how long results of table are cached, or 0 when they are
+// not.
+func (a *CachedAdapter) ttl(table string) time.Duration {
+	if ttl, ok := a.ttls[table]; ok {
+		return ttl
+	}
+	return a.ttls[CacheQueryTTLDefaultKey]
+}
+
+// QueryRows answers from the cache when ctx allows it and the result is
+// cached, and caches what it reads otherwise.
+func (a *CachedAdapter) QueryRows(ctx context.Context, table string, opts QueryOptions) ([]map[string]any, int, error) {
+	var rows []map[string]any
+	total, err := a.StreamRows(ctx, table, opts, func(row map[string]any) error {
+		rows = append(rows, row)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return rows, total, nil
+}
+
+// StreamRows is QueryRows for RowStreamer. A result is cached only when
+// every row was passed on and it fits in the cache.
+func (a *CachedAdapter) StreamRows(ctx context.Context, table string, opts QueryOptions, each func(map[string]any) error) (int, error) {
+	ttl := a.ttl(table)
+	key, ok := resultKey(table, opts)
+	if !cachedReadAllowed(ctx) || ttl <= 0 || !ok {
+		return streamRows(ctx, a.DatabaseAdapter, table, opts, each)
+	}
+
+	if e := a.lookup(key); e != nil {
+		a.counter.record(true)
+		for _, row := range e.rows {
+			if err := each(row); err != nil {
+				return 0, err
+			}
+		}
+		return e.total, nil
+	}
+	a.counter.record(false)
+
+	epoch, writes := a.generation(table)
+	var rows []map[string]any
+	var size int64
+	total, err := streamRows(ctx, a.DatabaseAdapter, table, opts, func(row map[string]any) error {
+		if size <= a.maxBytes {
+			rows = append(rows, row)
+			size += rowSize(row)
+		}
+		return each(row)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if size <= a.maxBytes {
+		a.store(&resultEntry{key: key, table: table, rows: rows, total: total, size: size + int64(len(key)),
+			expires: a.now().Add(ttl)}, epoch, writes)
+	}
+	return total, nil
+}
+
+// resultKey returns the cache key of a query: the table and the options
+// with the filters in a canonical order, since the order of query
+// parameters does not change the result. ok is false when a filter value
+// cannot be encoded.
+func resultKey(table string, opts QueryOptions) (string, bool) {
+	filters := make([]string, len(opts.Filters))
+	for i, f := range opts.Filters {
+		b, err := json.Marshal(f)
+		if err != nil {
+			return "", false
+		}
+		filters[i] = string(b)
+	}
+	slices.Sort(filters)
+	opts.Filters = nil
+	b, err := json.Marshal(struct {
+		Table   string
+		Filters []string
+		Opts    QueryOptions
+	}{table, filters, opts})
+	if err != nil {
+		return "", false
+	}
+	return string(b), true
+}
+
+// rowSize estimates the memory held by row.
+func rowSize(row map[string]any) int64 {
+	size := int64(48)
+	for k, v := range row {
+		size += int64(len(k)) + 32
+		switch t := v.(type) {
+		case string:
+			size += int64(len(t))
+		case []byte:
+			size += int64(len(t))
+		}
+	}
+	return size
+}
+
+// lookup returns the unexpired entry cached under key, or nil.
+func (a *CachedAdapter) lookup(key string) *resultEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	el, ok := a.entries[key]
+	if !ok {
+		return nil
+	}
+	e := el.Value.(*resultEntry)
+	if !a.now().Before(e.expires) {
+		a.removeLocked(el)
+		return nil
+	}
+	a.order.MoveToFront(el)
+	return e
+}
+
+// generation returns the counters that a write to table or a schema
+// change bumps. A result read between two calls that return the same
+// counters is still current.
+func (a *CachedAdapter) generation(table string) (epoch, writes uint64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.epoch, a.writes[table]
+}
+
+// store caches e unless its table was written or the schema changed since
+// generation returned epoch and writes.
+func (a *CachedAdapter) store(e *resultEntry, epoch, writes uint64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.epoch != epoch || a.writes[e.table] != writes {
+		return
+	}
+	if el, ok := a.entries[e.key]; ok {
+		a.removeLocked(el)
+	}
+	a.entries[e.key] = a.order.PushFront(e)
+	a.bytes += e.size
+	for a.bytes > a.maxBytes {
+		a.removeLocked(a.order.Back())
+	}
+}
+
+// removeLocked drops el from the cache. a.mu must be held.
+func (a *CachedAdapter) removeLocked(el *list.Element) {
+	e := a.order.Remove(el).(*resultEntry)
+	delete(a.entries, e.key)
+	a.bytes -= e.size
+}
+
+// invalidate drops the cached results of tables.
+func (a *CachedAdapter) invalidate(tables ...string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, table := range tables {
+		a.writes[table]++
+	}
+	for el := a.order.Front(); el != nil; {
+		next := el.Next()
+		if slices.Contains(tables, el.Value.(*resultEntry).table) {
+			a.removeLocked(el)
+		}
+		el = next
+	}
+}
+
+// reset drops every cached result after a schema change.
+func (a *CachedAdapter) reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.epoch++
+	a.entries = make(map[string]*list.Element)
+	a.order.Init()
+	a.bytes = 0
+}
+
+// QueryResultCacheStats reports the hits, misses, entries, and estimated
+// bytes of the cache for /admin:diagnostics.
+func (a *CachedAdapter) QueryResultCacheStats() map[string]any {
+	stats := a.counter.stats()
+	a.mu.Lock()
+	stats["entries"] = a.order.Len()
+	stats["bytes"] = a.bytes
+	a.mu.Unlock()
+	return stats
+}
+
+// ---------------------------------------------------------------------------
+// Writes and schema changes
+// ---------------------------------------------------------------------------
+
+func (a *CachedAdapter) ExecDDL(ctx context.Context, ddl string) error {
+	defer a.reset()
+	return a.DatabaseAdapter.ExecDDL(ctx, ddl)
+}
+
+func (a *CachedAdapter) ExecDDLBatch(ctx context.Context, statements []string) error {
+	defer a.reset()
+	return a.DatabaseAdapter.ExecDDLBatch(ctx, statements)
+}
+
+func (a *CachedAdapter) CreateIndex(ctx context.Context, table string, idx IndexInfo) error {
+	defer a.reset()
+	return a.DatabaseAdapter.CreateIndex(ctx, table, idx)
+}
+
+func (a *CachedAdapter) DropIndex(ctx context.Context, table, name string) error {
+	defer a.reset()
+	return a.DatabaseAdapter.DropIndex(ctx, table, name)
+}
+
+func (a *CachedAdapter) InsertRow(ctx context.Context, table string, data map[string]any) error {
+	defer a.invalidate(table)
+	return a.DatabaseAdapter.InsertRow(ctx, table, data)
+}
+
+func (a *CachedAdapter) InsertRows(ctx context.Context, table string, rows []map[string]any) error {
+	defer a.invalidate(table)
+	return a.DatabaseAdapter.InsertRows(ctx, table, rows)
+}
+
+func (a *CachedAdapter) UpdateRow(ctx context.Context, table string, id string, data map[string]any) error {
+	defer a.invalidate(table)
+	return a.DatabaseAdapter.UpdateRow(ctx, table, id, data)
+}
+
+func (a *CachedAdapter) UpdateRowVersion(ctx context.Context, table string, id string, expected int64, data map[string]any) (bool, error) {
+	defer a.invalidate(table)
+	return a.DatabaseAdapter.UpdateRowVersion(ctx, table, id, expected, data)
+}
+
+func (a *CachedAdapter) DeleteRow(ctx context.Context, table string, id string) error {
+	defer a.invalidate(table)
+	return a.DatabaseAdapter.DeleteRow(ctx, table, id)
+}
+
+func (a *CachedAdapter) UpdateWhere(ctx context.Context, table string, filters []Filter, data map[string]any, versioned bool, limit int) (int, error) {
+	defer a.invalidate(table)
+	return a.DatabaseAdapter.UpdateWhere(ctx, table, filters, data, versioned, limit)
+}
+
+func (a *CachedAdapter) DeleteWhere(ctx context.Context, table string, filters []Filter, limit int) (int, error) {
+	defer a.invalidate(table)
+	return a.DatabaseAdapter.DeleteWhere(ctx, table, filters, limit)
+}
+
+func (a *CachedAdapter) ExecWriteBatch(ctx context.Context, writes []BatchWrite) (int, error) {
+	tables := make([]string, 0, len(writes))
+	for _, wr := range writes {
+		if !slices.Contains(tables, wr.Table) {
+			tables = append(tables, wr.Table)
+		}
+	}
+	defer a.invalidate(tables...)
+	return a.DatabaseAdapter.ExecWriteBatch(ctx, writes)
+}
+
+// ---------------------------------------------------------------------------
+// Optional interfaces of the wrapped adapter
+// ---------------------------------------------------------------------------
+
+// TrackShadowChanges implements ShadowRebuilder for the wrapped adapter.
+func (a *CachedAdapter) TrackShadowChanges(ctx context.Context, s ShadowTable) error {
+	rb, ok := a.DatabaseAdapter.(ShadowRebuilder)
+	if !ok {
+		return errShadowUnsupported
+	}
+	return rb.TrackShadowChanges(ctx, s)
+}
+
+// CopyShadowBatch implements ShadowRebuilder for the wrapped adapter.
+func (a *CachedAdapter) CopyShadowBatch(ctx context.Context, s ShadowTable, after string, limit int) (string, int, error) {
+	rb, ok := a.DatabaseAdapter.(ShadowRebuilder)
+	if !ok {
+		return "", 0, errShadowUnsupported
+	}
+	return rb.CopyShadowBatch(ctx, s, after, limit)
+}
+
+// SwapShadowTable implements ShadowRebuilder for the wrapped adapter and
+// drops the cached results, which describe the replaced table.
+func (a *CachedAdapter) SwapShadowTable(ctx context.Context, s ShadowTable, indexes []IndexInfo) error {
+	rb, ok := a.DatabaseAdapter.(ShadowRebuilder)
+	if !ok {
+		return errShadowUnsupported
+	}
+	defer a.reset()
+	return rb.SwapShadowTable(ctx, s, indexes)
+}
+
+// DropShadowTable implements ShadowRebuilder for the wrapped adapter.
+func (a *CachedAdapter) DropShadowTable(ctx context.Context, s ShadowTable) error {
+	rb, ok := a.DatabaseAdapter.(ShadowRebuilder)
+	if !ok {
+		return errShadowUnsupported
+	}
+	return rb.DropShadowTable(ctx, s)
+}
+
+// SetSlowQueryThreshold applies ms to the wrapped adapter.
+func (a *CachedAdapter) SetSlowQueryThreshold(ms int) {
+	if s, ok := a.DatabaseAdapter.(slowQueryThresholdSetter); ok {
+		s.SetSlowQueryThreshold(ms)
+	}
+}
+
+// PoolStats returns the connection pool statistics of the wrapped adapter.
+func (a *CachedAdapter) PoolStats() sql.DBStats {
+	if ps, ok := a.DatabaseAdapter.(poolStatser); ok {
+		return ps.PoolStats()
+	}
+	return sql.DBStats{}
+}
+
+// WriteRetryStats returns the write retry counters of the wrapped adapter.
+func (a *CachedAdapter) WriteRetryStats() map[string]int64 {
+	if rs, ok := a.DatabaseAdapter.(writeRetryStatser); ok {
+		return rs.WriteRetryStats()
+	}
+	return nil
+}
+
+// StatementCacheStats returns the prepared statement cache counters of the
+// wrapped adapter.
+func (a *CachedAdapter) StatementCacheStats() map[string]any {
+	if sc, ok := a.DatabaseAdapter.(statementCacheStatser); ok {
+		return sc.StatementCacheStats()
+	}
+	return nil
+}
+
+// ReplicaStats returns the replicas of the wrapped adapter.
+func (a *CachedAdapter) ReplicaStats() []map[string]any {
+	if rs, ok := a.DatabaseAdapter.(replicaStatser); ok {
+		return rs.ReplicaStats()
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestCachedAdapter wraps a products database with a query result cache
+// of the given TTLs.
+func newTestCachedAdapter(t *testing.T, ttl map[string]int, maxBytes int64) *CachedAdapter {
+	t.Helper()
+	db := replicaTestDB(t, filepath.Join(t.TempDir(), "cache.db"), "first")
+	return NewCachedAdapter(db, CacheConfig{QueryTTL: ttl, QueryMaxBytes: maxBytes}).(*CachedAdapter)
+}
+
+func cacheHits(a *CachedAdapter) int64 {
+	return a.QueryResultCacheStats()["hits"].(int64)
+}
+
+func TestNewCachedAdapter_DisabledWithoutTTL(t *testing.T) {
+	db := replicaTestDB(t, filepath.Join(t.TempDir(), "cache.db"), "first")
+	if got := NewCachedAdapter(db, CacheConfig{QueryMaxBytes: DefaultCacheQueryMaxBytes}); got != db {
+		t.Fatalf("expected the adapter itself without TTLs, got %T", got)
+	}
+}
+
+func TestCachedAdapter_HitsOnlyMarkedReads(t *testing.T) {
+	a := newTestCachedAdapter(t, map[string]int{"products": 60}, DefaultCacheQueryMaxBytes)
+	marked := WithCachedRead(context.Background())
+
+	readTitle(t, a, marked)
+	readTitle(t, a, marked)
+	if got := cacheHits(a); got != 1 {
+		t.Fatalf("hits = %d, want 1", got)
+	}
+	readTitle(t, a, context.Background())
+	if got := cacheHits(a); got != 1 {
+		t.Fatalf("hits = %d after an unmarked read, want 1", got)
+	}
+}
+
+func TestCachedAdapter_TTLPerCollection(t *testing.T) {
+	tests := []struct {
+		ttl  map[string]int
+		want int64
+	}{
+		{map[string]int{"products": 60}, 1},
+		{map[string]int{"*": 60}, 1},
+		{map[string]int{"*": 60, "products": 0}, 0},
+		{map[string]int{"orders": 60}, 0},
+	}
+	for _, tt := range tests {
+		a := newTestCachedAdapter(t, tt.ttl, DefaultCacheQueryMaxBytes)
+		ctx := WithCachedRead(context.Background())
+		readTitle(t, a, ctx)
+		readTitle(t, a, ctx)
+		if got := cacheHits(a); got != tt.want {
+			t.Errorf("ttl %v: hits = %d, want %d", tt.ttl, got, tt.want)
+		}
+	}
+}
+
+func TestCachedAdapter_Expires(t *testing.T) {
+	a := newTestCachedAdapter(t, map[string]int{"products": 10}, DefaultCacheQueryMaxBytes)
+	now := time.Now()
+	a.now = func() time.Time { return now }
+	ctx := WithCachedRead(context.Background())
+
+	readTitle(t, a, ctx)
+	now = now.Add(11 * time.Second)
+	readTitle(t, a, ctx)
+	if got := cacheHits(a); got != 0 {
+		t.Fatalf("hits = %d after the TTL, want 0", got)
+	}
+}
+
+func TestCachedAdapter_WriteInvalidatesTable(t *testing.T) {
+	a := newTestCachedAdapter(t, map[string]int{"*": 60}, DefaultCacheQueryMaxBytes)
+	ctx := WithCachedRead(context.Background())
+	bg := context.Background()
+	if err := a.ExecDDL(bg, `CREATE TABLE orders (id TEXT PRIMARY KEY)`); err != nil {
+		t.Fatalf("ExecDDL: %v", err)
+	}
+
+	readTitle(t, a, ctx)
+	if _, _, err := a.QueryRows(ctx, "orders", QueryOptions{}); err != nil {
+		t.Fatalf("QueryRows: %v", err)
+	}
+	if err := a.UpdateRow(bg, "products", "01P", map[string]any{"title": "second"}); err != nil {
+		t.Fatalf("UpdateRow: %v", err)
+	}
+	if got := readTitle(t, a, ctx); got != "second" {
+		t.Fatalf("title = %q after the write, want second", got)
+	}
+	if _, _, err := a.QueryRows(ctx, "orders", QueryOptions{}); err != nil {
+		t.Fatalf("QueryRows: %v", err)
+	}
+	if got := cacheHits(a); got != 1 {
+		t.Fatalf("hits = %d, want 1 for the unwritten orders table", got)
+	}
+
+	writes := []BatchWrite{{Op: BatchUpdate, Table: "products", ID: "01P", Data: map[string]any{"title": "third"}}}
+	if _, err := a.ExecWriteBatch(bg, writes); err != nil {
+		t.Fatalf("ExecWriteBatch: %v", err)
+	}
+	if got := readTitle(t, a, ctx); got != "third" {
+		t.Fatalf("title = %q after the batch, want third", got)
+	}
+}
+
+func TestCachedAdapter_SchemaChangeResets(t *testing.T) {
+	a := newTestCachedAdapter(t, map[string]int{"products": 60}, DefaultCacheQueryMaxBytes)
+	ctx := WithCachedRead(context.Background())
+
+	readTitle(t, a, ctx)
+	if err := a.ExecDDL(context.Background(), `ALTER TABLE products ADD COLUMN note TEXT`); err != nil {
+		t.Fatalf("ExecDDL: %v", err)
+	}
+	rows, _, err := a.QueryRows(ctx, "products", QueryOptions{})
+	if err != nil {
+		t.Fatalf("QueryRows: %v", err)
+	}
+	if _, ok := rows[0]["note"]; !ok {
+		t.Fatalf("row = %v, want the new note column", rows[0])
+	}
+}
+
+func TestCachedAdapter_SkipsResultReadDuringWrite(t *testing.T) {
+	a := newTestCachedAdapter(t, map[string]int{"products": 60}, DefaultCacheQueryMaxBytes)
+	ctx := WithCachedRead(context.Background())
+
+	// A write that lands while a read is in flight makes that read's
+	// result stale, so it must not be cached.
+	_, err := a.StreamRows(ctx, "products", QueryOptions{}, func(map[string]any) error {
+		return a.UpdateRow(context.Background(), "products", "01P", map[string]any{"title": "second"})
+	})
+	if err != nil {
+		t.Fatalf("StreamRows: %v", err)
+	}
+	if got := readTitle(t, a, ctx); got != "second" {
+		t.Fatalf("title = %q, want second", got)
+	}
+}
+
+func TestCachedAdapter_EvictsBeyondMaxBytes(t *testing.T) {
+	a := newTestCachedAdapter(t, map[string]int{"products": 60}, DefaultCacheQueryMaxBytes)
+	ctx := WithCachedRead(context.Background())
+	read := func(perPage int) {
+		t.Helper()
+		if _, _, err := a.QueryRows(ctx, "products", QueryOptions{Page: 1, PerPage: perPage}); err != nil {
+			t.Fatalf("QueryRows: %v", err)
+		}
+	}
+
+	read(11)
+	entry := a.QueryResultCacheStats()["bytes"].(int64)
+	a.maxBytes = 2*entry + 1
+	for perPage := 12; perPage <= 14; perPage++ {
+		read(perPage)
+	}
+	stats := a.QueryResultCacheStats()
+	if stats["entries"].(int) != 2 || stats["bytes"].(int64) != 2*entry {
+		t.Fatalf("stats = %v, want the 2 most recent entries", stats)
+	}
+	read(14)
+	if got := cacheHits(a); got != 1 {
+		t.Fatalf("hits = %d, want the most recent entry kept", got)
+	}
+}
+
+func TestResultKey_FilterOrder(t *testing.T) {
+	a := QueryOptions{Filters: []Filter{{Field: "a", Op: "eq", Value: "1"}, {Field: "b", Op: "gt", Value: 2}}}
+	b := QueryOptions{Filters: []Filter{{Field: "b", Op: "gt", Value: 2}, {Field: "a", Op: "eq", Value: "1"}}}
+	ka, _ := resultKey("t", a)
+	kb, _ := resultKey("t", b)
+	if ka != kb {
+		t.Fatalf("keys differ for reordered filters:\n%s\n%s", ka, kb)
+	}
+	a.Page = 2
+	if kp, _ := resultKey("t", a); kp == ka {
+		t.Fatal("expected a different key for another page")
+	}
+}
+
+func TestResourceQuery_UsesQueryResultCache(t *testing.T) {
+	h, adapter, _ := setupResourceQueryTest(t)
+	seedProducts(t, adapter)
+	cached := NewCachedAdapter(adapter, CacheConfig{QueryTTL: map[string]int{"products": 60}, QueryMaxBytes: DefaultCacheQueryMaxBytes}).(*CachedAdapter)
+	h.db = cached
+
+	get := func(path string, primary bool) string {
+		r := makeQueryRequest(path)
+		if primary {
+			r.Header.Set(ReadPrimaryHeader, "true")
+		}
+		w := httptest.NewRecorder()
+		h.HandleQuery(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", path, w.Code, w.Body.String())
+		}
+		return w.Body.String()
+	}
+
+	first := get("/data/products:query?per_page=2", false)
+	if again := get("/data/products:query?per_page=2", false); again != first {
+		t.Fatalf("cached response differs:\n%s\n%s", first, again)
+	}
+	get("/data/products:query?id=01J0001", false)
+	get("/data/products:query?id=01J0001", false)
+	get("/data/products:query?per_page=2", true)
+	if got := cacheHits(cached); got != 2 {
+		t.Fatalf("hits = %d, want 2", got)
+	}
+}
@@ -3,13 +3,21 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"maps"
+	"math"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
 // ---------------------------------------------------------------------------
@@ -37,8 +45,10 @@ type SQLiteAdapter struct {
 	db                 *sql.DB
 	cfg                DatabaseConfig
 	logger             *Logger
-	slowQueryThreshold int
+	slowQueryThreshold atomic.Int64 // milliseconds; see SetSlowQueryThreshold
 	queryTimeout       int
+	retry              *writeRetrier
+	stmts              *stmtCache
 }
 
 // NewSQLiteAdapter opens a SQLite database at the path specified in
@@ -83,13 +93,27 @@ func NewSQLiteAdapter(cfg DatabaseConfig, logger *Logger) (*SQLiteAdapter, error
 		}
 	}
 
-	return &SQLiteAdapter{
-		db:                 db,
-		cfg:                cfg,
-		logger:             logger,
-		slowQueryThreshold: cfg.SlowQueryThreshold,
-		queryTimeout:       cfg.QueryTimeout,
-	}, nil
+	a := &SQLiteAdapter{
+		db:           db,
+		cfg:          cfg,
+		logger:       logger,
+		queryTimeout: cfg.QueryTimeout,
+		retry:        newWriteRetrier(),
+		stmts:        newStmtCache(db, StmtCacheSize),
+	}
+	a.SetSlowQueryThreshold(cfg.SlowQueryThreshold)
+	return a, nil
+}
+
+// SetSlowQueryThreshold changes the duration, in milliseconds, above which
+// a query is logged as slow. It is safe to call while queries run.
+func (a *SQLiteAdapter) SetSlowQueryThreshold(ms int) {
+	a.slowQueryThreshold.Store(int64(ms))
+}
+
+// slowQueryMs returns the current slow query threshold in milliseconds.
+func (a *SQLiteAdapter) slowQueryMs() int {
+	return int(a.slowQueryThreshold.Load())
 }
 
 // withTimeout derives a context with the configured query timeout.
@@ -109,24 +133,124 @@ func (a *SQLiteAdapter) Ping(ctx context.Context) error {
 
 // Close releases the underlying database connection.
 func (a *SQLiteAdapter) Close() error {
+	a.stmts.reset()
 	return a.db.Close()
 }
 
+// PoolStats returns the connection pool statistics of the underlying
+// database/sql handle.
+func (a *SQLiteAdapter) PoolStats() sql.DBStats {
+	return a.db.Stats()
+}
+
+// WriteRetryStats returns the counters of the write retry policy.
+func (a *SQLiteAdapter) WriteRetryStats() map[string]int64 {
+	return a.retry.stats()
+}
+
+// StatementCacheStats returns the counters of the prepared statement
+// cache.
+func (a *SQLiteAdapter) StatementCacheStats() map[string]any {
+	return a.stmts.stats()
+}
+
 // ExecDDL executes a raw DDL statement.
 func (a *SQLiteAdapter) ExecDDL(ctx context.Context, ddl string) error {
 	ctx2, cancel := a.withTimeout(ctx)
 	defer cancel()
+	defer a.stmts.reset()
 	start := time.Now()
-	_, err := a.db.ExecContext(ctx2, ddl)
-	logSlowQuery(a.logger, "", "ExecDDL", start, a.slowQueryThreshold)
+	err := a.retry.do(ctx2, func() error {
+		_, err := a.db.ExecContext(ctx2, ddl)
+		return err
+	})
+	logSlowQuery(ctx, a.logger, "", "ExecDDL", start, a.slowQueryMs())
 	if err != nil {
 		return newAdapterError("ExecDDL", "", "DDL execution failed", err)
 	}
 	return nil
 }
 
+// ExecDDLBatch executes the statements in order inside a single transaction.
+// SQLite DDL is transactional, so a failure rolls back every prior statement.
+func (a *SQLiteAdapter) ExecDDLBatch(ctx context.Context, statements []string) error {
+	ctx2, cancel := a.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	defer logSlowQuery(ctx, a.logger, "", "ExecDDLBatch", start, a.slowQueryMs())
+	defer a.stmts.reset()
+
+	var stage string
+	err := a.retry.do(ctx2, func() error {
+		tx, err := a.db.BeginTx(ctx2, nil)
+		if err != nil {
+			stage = "begin transaction failed"
+			return err
+		}
+		for _, stmt := range statements {
+			if _, err := tx.ExecContext(ctx2, stmt); err != nil {
+				tx.Rollback()
+				stage = "DDL execution failed"
+				return err
+			}
+		}
+		stage = "commit failed"
+		return tx.Commit()
+	})
+	if err != nil {
+		return newAdapterError("ExecDDLBatch", "", stage, err)
+	}
+	return nil
+}
+
 // QueryRows returns rows matching the given options.
 func (a *SQLiteAdapter) QueryRows(ctx context.Context, table string, opts QueryOptions) ([]map[string]any, int, error) {
+	return a.queryRows(ctx, nil, table, opts)
+}
+
+// ReadSnapshot runs read inside a read transaction. In WAL mode the
+// transaction sees the database as of its first read, and writers are not
+// blocked while it is open.
+func (a *SQLiteAdapter) ReadSnapshot(ctx context.Context, read func(SnapshotReader) error) error {
+	tx, err := a.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return newAdapterError("ReadSnapshot", "", "begin transaction failed", err)
+	}
+	defer tx.Rollback()
+	return read(sqliteSnapshot{adapter: a, tx: tx})
+}
+
+// sqliteSnapshot is the SnapshotReader for an open read transaction.
+type sqliteSnapshot struct {
+	adapter *SQLiteAdapter
+	tx      *sql.Tx
+}
+
+func (s sqliteSnapshot) QueryRows(ctx context.Context, table string, opts QueryOptions) ([]map[string]any, int, error) {
+	return s.adapter.queryRows(ctx, s.tx, table, opts)
+}
+
+// StreamRows calls each for every row QueryRows would return, as the rows
+// are scanned.
+func (a *SQLiteAdapter) StreamRows(ctx context.Context, table string, opts QueryOptions, each func(map[string]any) error) (int, error) {
+	return a.streamRows(ctx, nil, table, opts, each)
+}
+
+// queryRows implements QueryRows, inside tx when tx is not nil.
+func (a *SQLiteAdapter) queryRows(ctx context.Context, tx *sql.Tx, table string, opts QueryOptions) ([]map[string]any, int, error) {
+	var results []map[string]any
+	total, err := a.streamRows(ctx, tx, table, opts, func(row map[string]any) error {
+		results = append(results, row)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return results, total, nil
+}
+
+// streamRows implements StreamRows, inside tx when tx is not nil.
+func (a *SQLiteAdapter) streamRows(ctx context.Context, tx *sql.Tx, table string, opts QueryOptions, each func(map[string]any) error) (int, error) {
 	ctx2, cancel := a.withTimeout(ctx)
 	defer cancel()
 	start := time.Now()
@@ -136,9 +260,9 @@ func (a *SQLiteAdapter) QueryRows(ctx context.Context, table string, opts QueryO
 	// Total count query.
 	countSQL := fmt.Sprintf("SELECT COUNT(*) FROM %s%s", quoteIdent(table), where)
 	var total int
-	if err := a.db.QueryRowContext(ctx2, countSQL, args...).Scan(&total); err != nil {
-		logSlowQuery(a.logger, table, "QueryRows/count", start, a.slowQueryThreshold)
-		return nil, 0, newAdapterError("QueryRows", table, "count query failed", err)
+	if err := a.stmts.scanRow(ctx2, tx, countSQL, args, &total); err != nil {
+		logSlowQuery(ctx, a.logger, table, "QueryRows/count", start, a.slowQueryMs())
+		return 0, newAdapterError("QueryRows", table, "count query failed", err)
 	}
 
 	// Build SELECT.
@@ -160,6 +284,12 @@ func (a *SQLiteAdapter) QueryRows(ctx context.Context, table string, opts QueryO
 				dir = "DESC"
 			}
 			parts[i] = fmt.Sprintf("%s %s", quoteIdent(s.Field), dir)
+			switch s.Nulls {
+			case NullsFirst:
+				parts[i] += " NULLS FIRST"
+			case NullsLast:
+				parts[i] += " NULLS LAST"
+			}
 		}
 		orderClause = " ORDER BY " + strings.Join(parts, ", ")
 	}
@@ -181,19 +311,17 @@ func (a *SQLiteAdapter) QueryRows(ctx context.Context, table string, opts QueryO
 		fields, quoteIdent(table), where, orderClause)
 	selectArgs := append(args, perPage, offset)
 
-	rows, err := a.db.QueryContext(ctx2, selectSQL, selectArgs...)
-	logSlowQuery(a.logger, table, "QueryRows", start, a.slowQueryThreshold)
+	rows, err := a.stmts.query(ctx2, tx, selectSQL, selectArgs...)
+	logSlowQuery(ctx, a.logger, table, "QueryRows", start, a.slowQueryMs())
 	if err != nil {
-		return nil, 0, newAdapterError("QueryRows", table, "select query failed", err)
+		return 0, newAdapterError("QueryRows", table, "select query failed", err)
 	}
 	defer rows.Close()
 
-	results, err := scanRows(rows)
-	if err != nil {
-		return nil, 0, newAdapterError("QueryRows", table, "row scan failed", err)
+	if err := eachRow(rows, each); err != nil {
+		return 0, newAdapterError("QueryRows", table, "row scan failed", err)
 	}
-
-	return results, total, nil
+	return total, nil
 }
 
 // InsertRow inserts a single row into the given table.
@@ -206,26 +334,109 @@ func (a *SQLiteAdapter) InsertRow(ctx context.Context, table string, data map[st
 	defer cancel()
 	start := time.Now()
 
+	query, values := sqliteInsertStatement(table, data)
+	err := a.retry.do(ctx2, func() error {
+		_, err := a.stmts.exec(ctx2, nil, query, values...)
+		return err
+	})
+	logSlowQuery(ctx, a.logger, table, "InsertRow", start, a.slowQueryMs())
+	if err != nil {
+		return newAdapterError("InsertRow", table, "insert failed", err)
+	}
+	return nil
+}
+
+// InsertRows inserts every row inside a single transaction.
+func (a *SQLiteAdapter) InsertRows(ctx context.Context, table string, rows []map[string]any) error {
+	for _, data := range rows {
+		if len(data) == 0 {
+			return newAdapterError("InsertRows", table, "no data provided", nil)
+		}
+	}
+
+	ctx2, cancel := a.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	defer logSlowQuery(ctx, a.logger, table, "InsertRows", start, a.slowQueryMs())
+
+	var stage string
+	err := a.retry.do(ctx2, func() error {
+		tx, err := a.db.BeginTx(ctx2, nil)
+		if err != nil {
+			stage = "begin transaction failed"
+			return err
+		}
+		stmts := a.stmts.inTx(tx)
+		defer stmts.close()
+		for _, data := range rows {
+			query, values := sqliteInsertStatement(table, data)
+			if _, err := stmts.exec(ctx2, query, values...); err != nil {
+				tx.Rollback()
+				stage = "insert failed"
+				return err
+			}
+		}
+		stage = "commit failed"
+		return tx.Commit()
+	})
+	if err != nil {
+		return newAdapterError("InsertRows", table, stage, err)
+	}
+	return nil
+}
+
+// sqliteInsertStatement builds a parameterized INSERT for one row.
+func sqliteInsertStatement(table string, data map[string]any) (string, []any) {
 	columns := make([]string, 0, len(data))
 	placeholders := make([]string, 0, len(data))
 	values := make([]any, 0, len(data))
-	for col, val := range data {
+	// Sorted columns give equal rows the same SQL text, so the prepared
+	// statement cache can reuse it.
+	for _, col := range slices.Sorted(maps.Keys(data)) {
 		columns = append(columns, quoteIdent(col))
 		placeholders = append(placeholders, "?")
-		values = append(values, val)
+		values = append(values, data[col])
 	}
 
 	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
 		quoteIdent(table),
 		strings.Join(columns, ", "),
 		strings.Join(placeholders, ", "))
+	return query, values
+}
 
-	_, err := a.db.ExecContext(ctx2, query, values...)
-	logSlowQuery(a.logger, table, "InsertRow", start, a.slowQueryThreshold)
-	if err != nil {
-		return newAdapterError("InsertRow", table, "insert failed", err)
+// sqliteUpsertStatement returns the INSERT of data that, when a row with
+// the same key exists, sets that row's update columns instead, provided
+// the row holds the guard values. PostgreSQL accepts the same ON CONFLICT
+// clause.
+func sqliteUpsertStatement(table, key string, data map[string]any, update []string, versioned bool, guard map[string]any) (string, []any) {
+	query, values := sqliteInsertStatement(table, data)
+	setClauses := make([]string, 0, len(update)+1)
+	for _, col := range update {
+		setClauses = append(setClauses, fmt.Sprintf("%s = excluded.%s", quoteIdent(col), quoteIdent(col)))
 	}
-	return nil
+	if versioned {
+		version := quoteIdent(FieldVersion)
+		setClauses = append(setClauses, fmt.Sprintf("%s = %s.%s + 1", version, quoteIdent(table), version))
+	}
+	if len(setClauses) == 0 {
+		if len(guard) == 0 {
+			return query + fmt.Sprintf(" ON CONFLICT (%s) DO NOTHING", quoteIdent(key)), values
+		}
+		// A no-op update, so a row the guard admits still counts as
+		// affected.
+		setClauses = append(setClauses, fmt.Sprintf("%s = excluded.%s", quoteIdent(key), quoteIdent(key)))
+	}
+	query += fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s", quoteIdent(key), strings.Join(setClauses, ", "))
+	if len(guard) > 0 {
+		conds := make([]string, 0, len(guard))
+		for _, col := range slices.Sorted(maps.Keys(guard)) {
+			conds = append(conds, fmt.Sprintf("%s.%s = ?", quoteIdent(table), quoteIdent(col)))
+			values = append(values, guard[col])
+		}
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	return query, values
 }
 
 // UpdateRow updates the row identified by id in the given table.
@@ -238,11 +449,56 @@ func (a *SQLiteAdapter) UpdateRow(ctx context.Context, table string, id string,
 	defer cancel()
 	start := time.Now()
 
-	setClauses := make([]string, 0, len(data))
-	values := make([]any, 0, len(data)+1)
-	for col, val := range data {
+	query, values := sqliteUpdateStatement(table, id, data, false, 0)
+	err := a.retry.do(ctx2, func() error {
+		_, err := a.stmts.exec(ctx2, nil, query, values...)
+		return err
+	})
+	logSlowQuery(ctx, a.logger, table, "UpdateRow", start, a.slowQueryMs())
+	if err != nil {
+		return newAdapterError("UpdateRow", table, "update failed", err)
+	}
+	return nil
+}
+
+// UpdateRowVersion updates the row identified by id, increments _version,
+// and, when expected is non-zero, only matches the row at that version.
+func (a *SQLiteAdapter) UpdateRowVersion(ctx context.Context, table string, id string, expected int64, data map[string]any) (bool, error) {
+	ctx2, cancel := a.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+
+	query, values := sqliteUpdateStatement(table, id, data, true, expected)
+	var res sql.Result
+	err := a.retry.do(ctx2, func() error {
+		var err error
+		res, err = a.stmts.exec(ctx2, nil, query, values...)
+		return err
+	})
+	logSlowQuery(ctx, a.logger, table, "UpdateRowVersion", start, a.slowQueryMs())
+	if err != nil {
+		return false, newAdapterError("UpdateRowVersion", table, "update failed", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, newAdapterError("UpdateRowVersion", table, "update failed", err)
+	}
+	return n > 0, nil
+}
+
+// sqliteUpdateStatement builds a parameterized UPDATE for one row. When
+// versioned is set it also increments _version and, for a non-zero
+// expected, only matches the row at that version.
+func sqliteUpdateStatement(table, id string, data map[string]any, versioned bool, expected int64) (string, []any) {
+	setClauses := make([]string, 0, len(data)+1)
+	values := make([]any, 0, len(data)+2)
+	for _, col := range slices.Sorted(maps.Keys(data)) {
 		setClauses = append(setClauses, fmt.Sprintf("%s = ?", quoteIdent(col)))
-		values = append(values, val)
+		values = append(values, data[col])
+	}
+	version := quoteIdent(FieldVersion)
+	if versioned {
+		setClauses = append(setClauses, fmt.Sprintf("%s = %s + 1", version, version))
 	}
 	values = append(values, id)
 
@@ -250,13 +506,22 @@ func (a *SQLiteAdapter) UpdateRow(ctx context.Context, table string, id string,
 		quoteIdent(table),
 		strings.Join(setClauses, ", "),
 		quoteIdent("id"))
+	if versioned && expected != 0 {
+		query += fmt.Sprintf(" AND %s = ?", version)
+		values = append(values, expected)
+	}
+	return query, values
+}
 
-	_, err := a.db.ExecContext(ctx2, query, values...)
-	logSlowQuery(a.logger, table, "UpdateRow", start, a.slowQueryThreshold)
-	if err != nil {
-		return newAdapterError("UpdateRow", table, "update failed", err)
+// guardStatement appends the guard to the WHERE clause of a single-row
+// UPDATE or DELETE, so the statement only matches a row that holds the
+// guard values.
+func guardStatement(query string, values []any, guard map[string]any) (string, []any) {
+	for _, col := range slices.Sorted(maps.Keys(guard)) {
+		query += fmt.Sprintf(" AND %s = ?", quoteIdent(col))
+		values = append(values, guard[col])
 	}
-	return nil
+	return query, values
 }
 
 // DeleteRow deletes the row identified by id from the given table.
@@ -268,14 +533,145 @@ func (a *SQLiteAdapter) DeleteRow(ctx context.Context, table string, id string)
 	query := fmt.Sprintf("DELETE FROM %s WHERE %s = ?",
 		quoteIdent(table), quoteIdent("id"))
 
-	_, err := a.db.ExecContext(ctx2, query, id)
-	logSlowQuery(a.logger, table, "DeleteRow", start, a.slowQueryThreshold)
+	err := a.retry.do(ctx2, func() error {
+		_, err := a.stmts.exec(ctx2, nil, query, id)
+		return err
+	})
+	logSlowQuery(ctx, a.logger, table, "DeleteRow", start, a.slowQueryMs())
 	if err != nil {
 		return newAdapterError("DeleteRow", table, "delete failed", err)
 	}
 	return nil
 }
 
+// UpdateWhere sets data on every row matching filters in one UPDATE.
+func (a *SQLiteAdapter) UpdateWhere(ctx context.Context, table string, filters []Filter, data map[string]any, versioned bool, limit int) (int, error) {
+	if len(data) == 0 {
+		return 0, newAdapterError("UpdateWhere", table, "no data provided", nil)
+	}
+	where, args := buildWhereClause(QueryOptions{Filters: filters})
+	query, values := sqliteUpdateWhereStatement(table, where, data, versioned)
+	return a.execWhere(ctx, "UpdateWhere", table, limit, query, append(values, args...))
+}
+
+// DeleteWhere deletes every row matching filters in one DELETE.
+func (a *SQLiteAdapter) DeleteWhere(ctx context.Context, table string, filters []Filter, limit int) (int, error) {
+	where, args := buildWhereClause(QueryOptions{Filters: filters})
+	query := fmt.Sprintf("DELETE FROM %s%s", quoteIdent(table), where)
+	return a.execWhere(ctx, "DeleteWhere", table, limit, query, args)
+}
+
+// execWhere runs the UPDATE or DELETE of UpdateWhere or DeleteWhere in a
+// transaction that is rolled back when more than limit rows change.
+func (a *SQLiteAdapter) execWhere(ctx context.Context, op, table string, limit int, query string, values []any) (int, error) {
+	ctx2, cancel := a.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	defer logSlowQuery(ctx, a.logger, table, op, start, a.slowQueryMs())
+
+	var n int64
+	err := a.retry.do(ctx2, func() error {
+		tx, err := a.db.BeginTx(ctx2, nil)
+		if err != nil {
+			return err
+		}
+		res, err := a.stmts.exec(ctx2, tx, query, values...)
+		if err == nil {
+			n, err = res.RowsAffected()
+		}
+		if err == nil && n > int64(limit) {
+			err = ErrTooManyRows
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		return tx.Commit()
+	})
+	if err != nil {
+		return int(n), newAdapterError(op, table, "write failed", err)
+	}
+	return int(n), nil
+}
+
+// sqliteUpdateWhereStatement builds a parameterized UPDATE of the rows
+// selected by where, as built by buildWhereClause, whose arguments follow
+// the returned values. When versioned is set it also increments _version.
+func sqliteUpdateWhereStatement(table, where string, data map[string]any, versioned bool) (string, []any) {
+	setClauses := make([]string, 0, len(data)+1)
+	values := make([]any, 0, len(data))
+	for _, col := range slices.Sorted(maps.Keys(data)) {
+		setClauses = append(setClauses, fmt.Sprintf("%s = ?", quoteIdent(col)))
+		values = append(values, data[col])
+	}
+	if versioned {
+		version := quoteIdent(FieldVersion)
+		setClauses = append(setClauses, fmt.Sprintf("%s = %s + 1", version, version))
+	}
+	return fmt.Sprintf("UPDATE %s SET %s%s", quoteIdent(table), strings.Join(setClauses, ", "), where), values
+}
+
+// ExecWriteBatch applies the writes in order inside a single transaction.
+func (a *SQLiteAdapter) ExecWriteBatch(ctx context.Context, writes []BatchWrite) (int, error) {
+	ctx2, cancel := a.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	defer logSlowQuery(ctx, a.logger, "", "ExecWriteBatch", start, a.slowQueryMs())
+
+	var idx int
+	err := a.retry.do(ctx2, func() error {
+		var err error
+		idx, err = a.execWriteBatchTx(ctx2, writes)
+		return err
+	})
+	return idx, err
+}
+
+// execWriteBatchTx makes one attempt at ExecWriteBatch. Any failure rolls
+// the transaction back.
+func (a *SQLiteAdapter) execWriteBatchTx(ctx2 context.Context, writes []BatchWrite) (int, error) {
+	tx, err := a.db.BeginTx(ctx2, nil)
+	if err != nil {
+		return 0, newAdapterError("ExecWriteBatch", "", "begin transaction failed", err)
+	}
+	stmts := a.stmts.inTx(tx)
+	defer stmts.close()
+	for i, wr := range writes {
+		var query string
+		var values []any
+		switch wr.Op {
+		case BatchInsert:
+			query, values = sqliteInsertStatement(wr.Table, wr.Data)
+		case BatchUpdate:
+			query, values = sqliteUpdateStatement(wr.Table, wr.ID, wr.Data, wr.Versioned, wr.ExpectedVersion)
+			query, values = guardStatement(query, values, wr.Guard)
+		case BatchDelete:
+			query = fmt.Sprintf("DELETE FROM %s WHERE %s = ?", quoteIdent(wr.Table), quoteIdent("id"))
+			query, values = guardStatement(query, []any{wr.ID}, wr.Guard)
+		case BatchUpsert:
+			query, values = sqliteUpsertStatement(wr.Table, wr.Key, wr.Data, wr.Update, wr.Versioned, wr.Guard)
+		default:
+			tx.Rollback()
+			return i, newAdapterError("ExecWriteBatch", wr.Table, fmt.Sprintf("unknown batch op %q", wr.Op), nil)
+		}
+		res, err := stmts.exec(ctx2, query, values...)
+		if err != nil {
+			tx.Rollback()
+			return i, newAdapterError("ExecWriteBatch", wr.Table, wr.Op+" failed", err)
+		}
+		if wr.Op == BatchUpdate || wr.Op == BatchDelete || len(wr.Guard) > 0 {
+			if n, err := res.RowsAffected(); err != nil || n == 0 {
+				tx.Rollback()
+				return i, newAdapterError("ExecWriteBatch", wr.Table, wr.Op+" failed", ErrNoRowAffected)
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return len(writes), newAdapterError("ExecWriteBatch", "", "commit failed", err)
+	}
+	return 0, nil
+}
+
 // ListTables returns the names of all physical user tables. Internal SQLite
 // tables and those prefixed with "sqlite_" are excluded.
 func (a *SQLiteAdapter) ListTables(ctx context.Context) ([]string, error) {
@@ -284,7 +680,7 @@ func (a *SQLiteAdapter) ListTables(ctx context.Context) ([]string, error) {
 	start := time.Now()
 
 	rows, err := a.db.QueryContext(ctx2, "PRAGMA table_list")
-	logSlowQuery(a.logger, "", "ListTables", start, a.slowQueryThreshold)
+	logSlowQuery(ctx, a.logger, "", "ListTables", start, a.slowQueryMs())
 	if err != nil {
 		return nil, newAdapterError("ListTables", "", "table list failed", err)
 	}
@@ -349,7 +745,7 @@ func (a *SQLiteAdapter) DescribeTable(ctx context.Context, table string) ([]Colu
 
 	query := fmt.Sprintf("PRAGMA table_info(%s)", quoteIdent(table))
 	rows, err := a.db.QueryContext(ctx2, query)
-	logSlowQuery(a.logger, table, "DescribeTable", start, a.slowQueryThreshold)
+	logSlowQuery(ctx, a.logger, table, "DescribeTable", start, a.slowQueryMs())
 	if err != nil {
 		return nil, newAdapterError("DescribeTable", table, "table_info failed", err)
 	}
@@ -376,15 +772,177 @@ func (a *SQLiteAdapter) DescribeTable(ctx context.Context, table string) ([]Colu
 	}
 
 	uniqueCols := a.detectUniqueColumns(ctx2, table)
+	defs := a.columnDefinitions(ctx2, table)
 	for i := range columns {
 		if uniqueCols[columns[i].Name] {
 			columns[i].Unique = true
 		}
+		if def, ok := defs[columns[i].Name]; ok {
+			columns[i].Collation = parseColumnCollation(def)
+			columns[i].Rules = parseFieldRulesSQL(columns[i].Name, def)
+		}
 	}
 
 	return columns, nil
 }
 
+// ListIndexes returns the indexes of table created with CREATE INDEX,
+// that is those PRAGMA index_list reports with origin "c".
+func (a *SQLiteAdapter) ListIndexes(ctx context.Context, table string) ([]IndexInfo, error) {
+	ctx2, cancel := a.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+
+	rows, err := a.db.QueryContext(ctx2, fmt.Sprintf("PRAGMA index_list(%s)", quoteIdent(table)))
+	logSlowQuery(ctx, a.logger, table, "ListIndexes", start, a.slowQueryMs())
+	if err != nil {
+		return nil, newAdapterError("ListIndexes", table, "index_list failed", err)
+	}
+	var indexes []IndexInfo
+	for rows.Next() {
+		var seq, isUnique, partial int
+		var name, origin string
+		if err := rows.Scan(&seq, &name, &isUnique, &origin, &partial); err != nil {
+			rows.Close()
+			return nil, newAdapterError("ListIndexes", table, "scan failed", err)
+		}
+		if origin == "c" {
+			indexes = append(indexes, IndexInfo{Name: name, Unique: isUnique == 1})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, newAdapterError("ListIndexes", table, "iteration failed", err)
+	}
+
+	for i := range indexes {
+		infoRows, err := a.db.QueryContext(ctx2, fmt.Sprintf("PRAGMA index_info(%s)", quoteIdent(indexes[i].Name)))
+		if err != nil {
+			return nil, newAdapterError("ListIndexes", table, "index_info failed", err)
+		}
+		for infoRows.Next() {
+			var seqno, cid int
+			var colName string
+			if err := infoRows.Scan(&seqno, &cid, &colName); err != nil {
+				infoRows.Close()
+				return nil, newAdapterError("ListIndexes", table, "scan failed", err)
+			}
+			indexes[i].Columns = append(indexes[i].Columns, colName)
+		}
+		infoRows.Close()
+	}
+
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i].Name < indexes[j].Name })
+	return indexes, nil
+}
+
+// CreateIndex creates idx on table.
+func (a *SQLiteAdapter) CreateIndex(ctx context.Context, table string, idx IndexInfo) error {
+	return a.execIndexDDL(ctx, table, "CreateIndex", createIndexSQL(DBConnectionSQLite, table, idx))
+}
+
+// DropIndex drops the named index of table.
+func (a *SQLiteAdapter) DropIndex(ctx context.Context, table, name string) error {
+	return a.execIndexDDL(ctx, table, "DropIndex", dropIndexSQL(DBConnectionSQLite, table, name))
+}
+
+// TrackShadowChanges implements ShadowRebuilder with a change log table
+// and AFTER INSERT, UPDATE, and DELETE triggers on s.Table.
+func (a *SQLiteAdapter) TrackShadowChanges(ctx context.Context, s ShadowTable) error {
+	t, log, id := quoteIdent(s.Table), quoteIdent(s.logTable()), quoteIdent("id")
+	return a.ExecDDLBatch(ctx, []string{
+		fmt.Sprintf("CREATE TABLE %s (%s TEXT PRIMARY KEY)", log, id),
+		fmt.Sprintf("CREATE TRIGGER %s AFTER INSERT ON %s BEGIN INSERT OR IGNORE INTO %s (%s) VALUES (NEW.%s); END",
+			quoteIdent(s.trigger("insert")), t, log, id, id),
+		fmt.Sprintf("CREATE TRIGGER %s AFTER UPDATE ON %s BEGIN INSERT OR IGNORE INTO %s (%s) VALUES (OLD.%s), (NEW.%s); END",
+			quoteIdent(s.trigger("update")), t, log, id, id, id),
+		fmt.Sprintf("CREATE TRIGGER %s AFTER DELETE ON %s BEGIN INSERT OR IGNORE INTO %s (%s) VALUES (OLD.%s); END",
+			quoteIdent(s.trigger("delete")), t, log, id, id),
+	})
+}
+
+// CopyShadowBatch implements ShadowRebuilder. The batch is bounded and
+// copied in one transaction, which holds the write lock for that batch
+// only.
+func (a *SQLiteAdapter) CopyShadowBatch(ctx context.Context, s ShadowTable, after string, limit int) (string, int, error) {
+	ctx2, cancel := a.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	defer logSlowQuery(ctx, a.logger, s.Table, "CopyShadowBatch", start, a.slowQueryMs())
+
+	bound, copyRows := shadowBatchSQL(s)
+	var last string
+	var n int
+	var stage string
+	err := a.retry.do(ctx2, func() error {
+		tx, err := a.db.BeginTx(ctx2, nil)
+		if err != nil {
+			stage = "begin transaction failed"
+			return err
+		}
+		defer tx.Rollback()
+		var max sql.NullString
+		if err := tx.QueryRowContext(ctx2, bound, after, limit).Scan(&max, &n); err != nil {
+			stage = "batch bound failed"
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+		if _, err := tx.ExecContext(ctx2, copyRows, after, max.String); err != nil {
+			stage = "batch copy failed"
+			return err
+		}
+		last = max.String
+		stage = "commit failed"
+		return tx.Commit()
+	})
+	if err != nil {
+		return "", 0, newAdapterError("CopyShadowBatch", s.Table, stage, err)
+	}
+	return last, n, nil
+}
+
+// SwapShadowTable implements ShadowRebuilder in a single transaction,
+// which holds the write lock while the logged rows are copied again.
+// Dropping s.Table drops its indexes and triggers, so the indexes are
+// recreated on the renamed shadow table in the same transaction.
+func (a *SQLiteAdapter) SwapShadowTable(ctx context.Context, s ShadowTable, indexes []IndexInfo) error {
+	statements := append(shadowCatchUpSQL(s),
+		fmt.Sprintf("DROP TABLE %s", quoteIdent(s.Table)),
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s", quoteIdent(s.Name), quoteIdent(s.Table)),
+	)
+	for _, idx := range indexes {
+		statements = append(statements, createIndexSQL(DBConnectionSQLite, s.Table, idx))
+	}
+	statements = append(statements, fmt.Sprintf("DROP TABLE %s", quoteIdent(s.logTable())))
+	return a.ExecDDLBatch(ctx, statements)
+}
+
+// DropShadowTable implements ShadowRebuilder.
+func (a *SQLiteAdapter) DropShadowTable(ctx context.Context, s ShadowTable) error {
+	return a.ExecDDLBatch(ctx, []string{
+		fmt.Sprintf("DROP TRIGGER IF EXISTS %s", quoteIdent(s.trigger("insert"))),
+		fmt.Sprintf("DROP TRIGGER IF EXISTS %s", quoteIdent(s.trigger("update"))),
+		fmt.Sprintf("DROP TRIGGER IF EXISTS %s", quoteIdent(s.trigger("delete"))),
+		fmt.Sprintf("DROP TABLE IF EXISTS %s", quoteIdent(s.logTable())),
+		fmt.Sprintf("DROP TABLE IF EXISTS %s", quoteIdent(s.Name)),
+	})
+}
+
+func (a *SQLiteAdapter) execIndexDDL(ctx context.Context, table, op, ddl string) error {
+	ctx2, cancel := a.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	_, err := a.db.ExecContext(ctx2, ddl)
+	a.stmts.reset()
+	logSlowQuery(ctx, a.logger, table, op, start, a.slowQueryMs())
+	if err != nil {
+		return newAdapterError(op, table, "index DDL failed", err)
+	}
+	return nil
+}
+
 // detectUniqueColumns returns the set of column names that have a
 // single-column UNIQUE constraint or index, excluding primary keys.
 func (a *SQLiteAdapter) detectUniqueColumns(ctx context.Context, table string) map[string]bool {
@@ -437,6 +995,146 @@ func (a *SQLiteAdapter) detectUniqueColumns(ctx context.Context, table string) m
 	return result
 }
 
+// columnDefinitions returns the text after the column name of each column
+// definition in the stored CREATE TABLE statement. SQLite exposes no pragma
+// for column collations or CHECK constraints, so they are read from here.
+func (a *SQLiteAdapter) columnDefinitions(ctx context.Context, table string) map[string]string {
+	result := make(map[string]string)
+
+	var ddl string
+	err := a.db.QueryRowContext(ctx,
+		"SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&ddl)
+	if err != nil {
+		return result
+	}
+	open := strings.Index(ddl, "(")
+	end := strings.LastIndex(ddl, ")")
+	if open < 0 || end <= open {
+		return result
+	}
+
+	for _, def := range splitColumnDefs(ddl[open+1 : end]) {
+		name, rest := splitColumnName(def)
+		result[name] = rest
+	}
+	return result
+}
+
+// parseColumnCollation returns the declared COLLATE name of a column
+// definition, lowercased, or "" when none is declared.
+func parseColumnCollation(def string) string {
+	tokens := strings.Fields(strings.ToUpper(def))
+	for i := 0; i+1 < len(tokens); i++ {
+		if tokens[i] == "COLLATE" {
+			return strings.ToLower(strings.Trim(tokens[i+1], `"'`))
+		}
+	}
+	return ""
+}
+
+// fieldRulesCheckSQL renders field rules as column CHECK constraints. The
+// exact text is parsed back by parseFieldRulesSQL, so the two must agree.
+func fieldRulesCheckSQL(name string, r FieldRules) string {
+	col := quoteIdent(name)
+	var sb strings.Builder
+	if r.Min != nil {
+		fmt.Fprintf(&sb, " CHECK (%s >= %d)", col, *r.Min)
+	}
+	if r.Max != nil {
+		fmt.Fprintf(&sb, " CHECK (%s <= %d)", col, *r.Max)
+	}
+	if r.MinLength != nil {
+		fmt.Fprintf(&sb, " CHECK (length(%s) >= %d)", col, *r.MinLength)
+	}
+	if r.MaxLength != nil {
+		fmt.Fprintf(&sb, " CHECK (length(%s) <= %d)", col, *r.MaxLength)
+	}
+	if len(r.Enum) > 0 {
+		quoted := make([]string, len(r.Enum))
+		for i, v := range r.Enum {
+			quoted[i] = "'" + strings.ReplaceAll(v, "'", "''") + "'"
+		}
+		fmt.Fprintf(&sb, " CHECK (%s IN (%s))", col, strings.Join(quoted, ", "))
+	}
+	return sb.String()
+}
+
+// parseFieldRulesSQL recovers field rules from the CHECK constraints that
+// fieldRulesCheckSQL writes. Other CHECK constraints are ignored.
+func parseFieldRulesSQL(name, def string) FieldRules {
+	var r FieldRules
+	col := regexp.QuoteMeta(quoteIdent(name))
+	bound := func(expr, op string) *int64 {
+		m := regexp.MustCompile(`CHECK \(` + expr + ` ` + op + ` (-?\d+)\)`).FindStringSubmatch(def)
+		if m == nil {
+			return nil
+		}
+		n, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil
+		}
+		return &n
+	}
+	r.Min = bound(col, ">=")
+	r.Max = bound(col, "<=")
+	lengthExpr := `length\(` + col + `\)`
+	if n := bound(lengthExpr, ">="); n != nil {
+		v := int(*n)
+		r.MinLength = &v
+	}
+	if n := bound(lengthExpr, "<="); n != nil {
+		v := int(*n)
+		r.MaxLength = &v
+	}
+	if m := regexp.MustCompile(`CHECK \(` + col + ` IN \(((?:'(?:[^']|'')*'(?:, )?)+)\)\)`).FindStringSubmatch(def); m != nil {
+		for _, lit := range regexp.MustCompile(`'((?:[^']|'')*)'`).FindAllStringSubmatch(m[1], -1) {
+			r.Enum = append(r.Enum, strings.ReplaceAll(lit[1], "''", "'"))
+		}
+	}
+	return r
+}
+
+// splitColumnDefs splits the body of a CREATE TABLE statement on top-level
+// commas, ignoring commas inside parentheses and quoted text.
+func splitColumnDefs(body string) []string {
+	var defs []string
+	depth, start := 0, 0
+	var quote rune
+	for i, c := range body {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`' || c == '[':
+			quote = c
+			if c == '[' {
+				quote = ']'
+			}
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			defs = append(defs, strings.TrimSpace(body[start:i]))
+			start = i + 1
+		}
+	}
+	return append(defs, strings.TrimSpace(body[start:]))
+}
+
+// splitColumnName returns the unquoted column name of a column definition
+// and the remainder of the definition.
+func splitColumnName(def string) (string, string) {
+	if strings.HasPrefix(def, `"`) {
+		if end := strings.Index(def[1:], `"`); end >= 0 {
+			return def[1 : end+1], def[end+2:]
+		}
+	}
+	name, rest, _ := strings.Cut(def, " ")
+	return name, rest
+}
+
 // CountRows returns the number of rows in the given table.
 func (a *SQLiteAdapter) CountRows(ctx context.Context, table string) (int, error) {
 	ctx2, cancel := a.withTimeout(ctx)
@@ -446,13 +1144,297 @@ func (a *SQLiteAdapter) CountRows(ctx context.Context, table string) (int, error
 	query := fmt.Sprintf("SELECT COUNT(*) FROM %s", quoteIdent(table))
 	var count int
 	err := a.db.QueryRowContext(ctx2, query).Scan(&count)
-	logSlowQuery(a.logger, table, "CountRows", start, a.slowQueryThreshold)
+	logSlowQuery(ctx, a.logger, table, "CountRows", start, a.slowQueryMs())
 	if err != nil {
 		return 0, newAdapterError("CountRows", table, "count failed", err)
 	}
 	return count, nil
 }
 
+// NumericHistogram computes count, min, max, average, nearest-rank
+// percentiles, and equal-width bucket counts for a numeric column. All
+// aggregation runs in SQL; only the summary rows are returned.
+func (a *SQLiteAdapter) NumericHistogram(ctx context.Context, table, field string, buckets int, filters []Filter) (*HistogramResult, error) {
+	ctx2, cancel := a.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	defer logSlowQuery(ctx, a.logger, table, "NumericHistogram", start, a.slowQueryMs())
+
+	if buckets < 1 {
+		buckets = 1
+	}
+
+	value := fmt.Sprintf("CAST(%s AS REAL)", quoteIdent(field))
+	where, args := buildWhereClause(QueryOptions{Filters: filters})
+	notNull := fmt.Sprintf("%s IS NOT NULL", quoteIdent(field))
+	if where == "" {
+		where = " WHERE " + notNull
+	} else {
+		where += " AND " + notNull
+	}
+	from := quoteIdent(table) + where
+
+	result := &HistogramResult{Percentiles: make(map[int]float64, len(HistogramPercentiles))}
+
+	var minV, maxV, avgV sql.NullFloat64
+	statsSQL := fmt.Sprintf("SELECT COUNT(*), MIN(%s), MAX(%s), AVG(%s) FROM %s", value, value, value, from)
+	if err := a.db.QueryRowContext(ctx2, statsSQL, args...).Scan(&result.Count, &minV, &maxV, &avgV); err != nil {
+		return nil, newAdapterError("NumericHistogram", table, "stats query failed", err)
+	}
+	if result.Count == 0 {
+		result.Buckets = []HistogramBucket{}
+		return result, nil
+	}
+	result.Min, result.Max, result.Avg = minV.Float64, maxV.Float64, avgV.Float64
+
+	// Nearest-rank percentiles: the value at position ceil(p/100 * count).
+	pctSQL := fmt.Sprintf("SELECT %s FROM %s ORDER BY %s LIMIT 1 OFFSET ?", value, from, value)
+	for _, p := range HistogramPercentiles {
+		rank := int(math.Ceil(float64(p) / 100 * float64(result.Count)))
+		if rank < 1 {
+			rank = 1
+		}
+		var v float64
+		if err := a.db.QueryRowContext(ctx2, pctSQL, append(args, rank-1)...).Scan(&v); err != nil {
+			return nil, newAdapterError("NumericHistogram", table, "percentile query failed", err)
+		}
+		result.Percentiles[p] = v
+	}
+
+	width := (result.Max - result.Min) / float64(buckets)
+	if width == 0 {
+		result.Buckets = []HistogramBucket{{Lower: result.Min, Upper: result.Max, Count: result.Count}}
+		return result, nil
+	}
+
+	result.Buckets = make([]HistogramBucket, buckets)
+	for i := range result.Buckets {
+		result.Buckets[i].Lower = result.Min + float64(i)*width
+		result.Buckets[i].Upper = result.Min + float64(i+1)*width
+	}
+	result.Buckets[buckets-1].Upper = result.Max
+
+	bucketSQL := fmt.Sprintf("SELECT MIN(CAST((%s - ?) / ? AS INTEGER), ?) AS bucket, COUNT(*) FROM %s GROUP BY bucket",
+		value, from)
+	bucketArgs := append([]any{result.Min, width, buckets - 1}, args...)
+	rows, err := a.db.QueryContext(ctx2, bucketSQL, bucketArgs...)
+	if err != nil {
+		return nil, newAdapterError("NumericHistogram", table, "bucket query failed", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var idx, count int
+		if err := rows.Scan(&idx, &count); err != nil {
+			return nil, newAdapterError("NumericHistogram", table, "row scan failed", err)
+		}
+		if idx >= 0 && idx < buckets {
+			result.Buckets[idx].Count += count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, newAdapterError("NumericHistogram", table, "row scan failed", err)
+	}
+	return result, nil
+}
+
+// sqliteTimeBucketExpr maps time-series intervals to SQLite expressions that
+// truncate a local datetime (the %s placeholder) to the bucket start.
+var sqliteTimeBucketExpr = map[string]string{
+	"hour":  "strftime('%%Y-%%m-%%dT%%H:00:00', %s)",
+	"day":   "strftime('%%Y-%%m-%%dT00:00:00', %s)",
+	"week":  "strftime('%%Y-%%m-%%dT00:00:00', %s, 'start of day', '-6 days', 'weekday 1')",
+	"month": "strftime('%%Y-%%m-01T00:00:00', %s)",
+	"year":  "strftime('%%Y-01-01T00:00:00', %s)",
+}
+
+// sqliteAggExpr maps time-series aggregate names to SQL aggregate templates
+// applied to a REAL value expression (the %s placeholder).
+var sqliteAggExpr = map[string]string{
+	"sum":   "SUM(%s)",
+	"avg":   "AVG(%s)",
+	"min":   "MIN(%s)",
+	"max":   "MAX(%s)",
+	"count": "COUNT(%s)",
+}
+
+// sqliteDatetimeLayout is the canonical text form produced by SQLite's
+// datetime() function, used for range and offset comparisons.
+const sqliteDatetimeLayout = "2006-01-02 15:04:05"
+
+// TimeSeries aggregates rows into local-time calendar buckets. The UTC
+// offset for each row is chosen from q.Offsets so buckets stay aligned to
+// local midnight across daylight-saving transitions.
+func (a *SQLiteAdapter) TimeSeries(ctx context.Context, table string, q TimeSeriesQuery) ([]TimeSeriesPoint, error) {
+	ctx2, cancel := a.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	defer logSlowQuery(ctx, a.logger, table, "TimeSeries", start, a.slowQueryMs())
+
+	bucketTmpl, ok := sqliteTimeBucketExpr[q.Interval]
+	if !ok {
+		return nil, newAdapterError("TimeSeries", table, "unsupported interval", fmt.Errorf("interval %q", q.Interval))
+	}
+	aggTmpl, ok := sqliteAggExpr[q.Agg]
+	if !ok {
+		return nil, newAdapterError("TimeSeries", table, "unsupported aggregate", fmt.Errorf("agg %q", q.Agg))
+	}
+
+	utc := fmt.Sprintf("datetime(%s)", quoteIdent(q.DateField))
+
+	// Build the per-row offset as a CASE over the offset spans.
+	var selectArgs []any
+	offsetExpr := "0"
+	if len(q.Offsets) == 1 {
+		offsetExpr = fmt.Sprintf("%d", q.Offsets[0].Seconds)
+	} else if len(q.Offsets) > 1 {
+		var b strings.Builder
+		b.WriteString("CASE")
+		for _, span := range q.Offsets[:len(q.Offsets)-1] {
+			fmt.Fprintf(&b, " WHEN %s < ? THEN %d", utc, span.Seconds)
+			selectArgs = append(selectArgs, span.Until.UTC().Format(sqliteDatetimeLayout))
+		}
+		fmt.Fprintf(&b, " ELSE %d END", q.Offsets[len(q.Offsets)-1].Seconds)
+		offsetExpr = b.String()
+	}
+	local := fmt.Sprintf("datetime(%s, (%s) || ' seconds')", utc, offsetExpr)
+	bucketExpr := fmt.Sprintf(bucketTmpl, local)
+
+	valueExpr := "*"
+	if q.ValueField != "" {
+		valueExpr = fmt.Sprintf("CAST(%s AS REAL)", quoteIdent(q.ValueField))
+	}
+	aggExpr := fmt.Sprintf(aggTmpl, valueExpr)
+	countExpr := "COUNT(*)"
+	if q.ValueField != "" {
+		countExpr = fmt.Sprintf("COUNT(%s)", quoteIdent(q.ValueField))
+	}
+
+	where, whereArgs := buildWhereClause(QueryOptions{Filters: q.Filters})
+	rangeCond := fmt.Sprintf("%s >= ? AND %s < ?", utc, utc)
+	if where == "" {
+		where = " WHERE " + rangeCond
+	} else {
+		where += " AND " + rangeCond
+	}
+	whereArgs = append(whereArgs,
+		q.From.UTC().Format(sqliteDatetimeLayout), q.To.UTC().Format(sqliteDatetimeLayout))
+
+	query := fmt.Sprintf("SELECT %s AS bucket, %s, %s FROM %s%s GROUP BY bucket ORDER BY bucket",
+		bucketExpr, aggExpr, countExpr, quoteIdent(table), where)
+	args := append(selectArgs, whereArgs...)
+
+	rows, err := a.db.QueryContext(ctx2, query, args...)
+	if err != nil {
+		return nil, newAdapterError("TimeSeries", table, "select query failed", err)
+	}
+	defer rows.Close()
+
+	var points []TimeSeriesPoint
+	for rows.Next() {
+		var p TimeSeriesPoint
+		var value sql.NullFloat64
+		if err := rows.Scan(&p.Bucket, &value, &p.Count); err != nil {
+			return nil, newAdapterError("TimeSeries", table, "row scan failed", err)
+		}
+		p.Value = value.Float64
+		points = append(points, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, newAdapterError("TimeSeries", table, "row scan failed", err)
+	}
+	return points, nil
+}
+
+// Pivot aggregates rows grouped by a row key and a column key.
+func (a *SQLiteAdapter) Pivot(ctx context.Context, table string, q PivotQuery) ([]PivotCell, error) {
+	ctx2, cancel := a.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	defer logSlowQuery(ctx, a.logger, table, "Pivot", start, a.slowQueryMs())
+
+	rowExpr, err := sqlitePivotKeyExpr(q.RowField, q.RowInterval)
+	if err != nil {
+		return nil, newAdapterError("Pivot", table, "unsupported row interval", err)
+	}
+	colExpr, err := sqlitePivotKeyExpr(q.ColumnField, q.ColumnInterval)
+	if err != nil {
+		return nil, newAdapterError("Pivot", table, "unsupported column interval", err)
+	}
+	aggTmpl, ok := sqliteAggExpr[q.Agg]
+	if !ok {
+		return nil, newAdapterError("Pivot", table, "unsupported aggregate", fmt.Errorf("agg %q", q.Agg))
+	}
+
+	valueExpr := "*"
+	countExpr := "COUNT(*)"
+	if q.ValueField != "" {
+		valueExpr = fmt.Sprintf("CAST(%s AS REAL)", quoteIdent(q.ValueField))
+		countExpr = fmt.Sprintf("COUNT(%s)", quoteIdent(q.ValueField))
+	}
+
+	where, args := buildWhereClause(QueryOptions{Filters: q.Filters})
+	query := fmt.Sprintf("SELECT %s AS pivot_row, %s AS pivot_col, %s, %s FROM %s%s GROUP BY pivot_row, pivot_col ORDER BY pivot_row, pivot_col",
+		rowExpr, colExpr, fmt.Sprintf(aggTmpl, valueExpr), countExpr, quoteIdent(table), where)
+	if q.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, q.Limit)
+	}
+
+	rows, err := a.db.QueryContext(ctx2, query, args...)
+	if err != nil {
+		return nil, newAdapterError("Pivot", table, "select query failed", err)
+	}
+	defer rows.Close()
+
+	var cells []PivotCell
+	for rows.Next() {
+		var c PivotCell
+		var value sql.NullFloat64
+		if err := rows.Scan(&c.Row, &c.Column, &value, &c.Count); err != nil {
+			return nil, newAdapterError("Pivot", table, "row scan failed", err)
+		}
+		c.Value = value.Float64
+		cells = append(cells, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, newAdapterError("Pivot", table, "row scan failed", err)
+	}
+	return cells, nil
+}
+
+// sqlitePivotKeyExpr returns the grouping expression for a pivot axis.
+// With an interval the field is truncated to a UTC calendar bucket;
+// otherwise its text form is used. NULL keys become the empty string.
+func sqlitePivotKeyExpr(field, interval string) (string, error) {
+	if interval == "" {
+		return fmt.Sprintf("COALESCE(CAST(%s AS TEXT), '')", quoteIdent(field)), nil
+	}
+	tmpl, ok := sqliteTimeBucketExpr[interval]
+	if !ok {
+		return "", fmt.Errorf("interval %q", interval)
+	}
+	return fmt.Sprintf("COALESCE(%s, '')", fmt.Sprintf(tmpl, fmt.Sprintf("datetime(%s)", quoteIdent(field)))), nil
+}
+
+// sqliteErrorKind maps SQLite extended result codes to sentinel errors.
+func sqliteErrorKind(err error) error {
+	var se sqlite3.Error
+	if !errors.As(err, &se) {
+		return nil
+	}
+	switch se.ExtendedCode {
+	case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+		return ErrUniqueViolation
+	case sqlite3.ErrConstraintForeignKey:
+		return ErrForeignKey
+	case sqlite3.ErrConstraintCheck:
+		return ErrCheckViolation
+	case sqlite3.ErrConstraintNotNull:
+		return ErrNotNull
+	}
+	return nil
+}
+
 // ---------------------------------------------------------------------------
 // SQL helpers
 // ---------------------------------------------------------------------------
@@ -483,26 +1465,59 @@ func buildWhereClause(opts QueryOptions) (string, []any) {
 	var args []any
 
 	for _, f := range opts.Filters {
+		target := quoteIdent(f.Field)
+		var targetArgs []any
+		if f.Path != "" {
+			// json_extract returns SQL values, so JSON true and false
+			// compare as 1 and 0.
+			target = fmt.Sprintf("json_extract(%s, ?)", quoteIdent(f.Field))
+			targetArgs = []any{`$."` + f.Path + `"`}
+		}
 		if f.Op == "in" {
-			values, ok := f.Value.([]string)
-			if !ok || len(values) == 0 {
+			var values []any
+			switch v := f.Value.(type) {
+			case []string:
+				for _, s := range v {
+					values = append(values, s)
+				}
+			case []any:
+				values = v
+			}
+			if len(values) == 0 {
 				continue
 			}
+			args = append(args, targetArgs...)
 			placeholders := make([]string, len(values))
 			for i, v := range values {
 				placeholders[i] = "?"
 				args = append(args, v)
 			}
 			conditions = append(conditions,
-				fmt.Sprintf("%s IN (%s)", quoteIdent(f.Field), strings.Join(placeholders, ", ")))
+				fmt.Sprintf("%s IN (%s)", target, strings.Join(placeholders, ", ")))
 			continue
 		}
-		sqlOp, ok := filterOpSQL[f.Op]
-		if !ok {
-			continue
+		var cond string
+		switch f.Op {
+		case "ieq":
+			cond = target + " = ? COLLATE NOCASE"
+		case "ilike":
+			cond = fmt.Sprintf("LOWER(%s) LIKE LOWER(?)", target)
+		case "is_null":
+			cond = target + " IS NULL"
+		case "not_null":
+			cond = target + " IS NOT NULL"
+		default:
+			sqlOp, ok := filterOpSQL[f.Op]
+			if !ok {
+				continue
+			}
+			cond = fmt.Sprintf("%s %s ?", target, sqlOp)
+		}
+		conditions = append(conditions, cond)
+		args = append(args, targetArgs...)
+		if f.Op != "is_null" && f.Op != "not_null" {
+			args = append(args, f.Value)
 		}
-		conditions = append(conditions, fmt.Sprintf("%s %s ?", quoteIdent(f.Field), sqlOp))
-		args = append(args, f.Value)
 	}
 
 	if opts.Search != "" && len(opts.SearchFields) > 0 {
@@ -522,12 +1537,25 @@ func buildWhereClause(opts QueryOptions) (string, []any) {
 
 // scanRows reads all rows from a *sql.Rows into a slice of maps.
 func scanRows(rows *sql.Rows) ([]map[string]any, error) {
-	cols, err := rows.Columns()
+	var results []map[string]any
+	err := eachRow(rows, func(row map[string]any) error {
+		results = append(results, row)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	return results, nil
+}
+
+// eachRow scans rows one at a time and calls each with every row as a map
+// of column name to value.
+func eachRow(rows *sql.Rows, each func(map[string]any) error) error {
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
 
-	var results []map[string]any
 	for rows.Next() {
 		values := make([]any, len(cols))
 		ptrs := make([]any, len(cols))
@@ -535,13 +1563,15 @@ func scanRows(rows *sql.Rows) ([]map[string]any, error) {
 			ptrs[i] = &values[i]
 		}
 		if err := rows.Scan(ptrs...); err != nil {
-			return nil, err
+			return err
 		}
 		row := make(map[string]any, len(cols))
 		for i, col := range cols {
 			row[col] = values[i]
 		}
-		results = append(results, row)
+		if err := each(row); err != nil {
+			return err
+		}
 	}
-	return results, nil
+	return rows.Err()
 }
@@ -3,12 +3,16 @@ package main
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/go-sql-driver/mysql"
 )
 
 // ---------------------------------------------------------------------------
@@ -191,6 +195,48 @@ func TestSQLiteAdapter_ExecDDL_InvalidSQL(t *testing.T) {
 	}
 }
 
+func TestSQLiteAdapter_ExecDDLBatch(t *testing.T) {
+	adapter := testSQLiteAdapter(t)
+	ctx := context.Background()
+
+	err := adapter.ExecDDLBatch(ctx, []string{
+		`CREATE TABLE batch_a (id TEXT PRIMARY KEY)`,
+		`CREATE TABLE batch_b (id TEXT PRIMARY KEY)`,
+	})
+	if err != nil {
+		t.Fatalf("ExecDDLBatch: %v", err)
+	}
+
+	tables, err := adapter.ListTables(ctx)
+	if err != nil {
+		t.Fatalf("ListTables: %v", err)
+	}
+	if len(tables) != 2 {
+		t.Fatalf("expected 2 tables, got %v", tables)
+	}
+}
+
+func TestSQLiteAdapter_ExecDDLBatch_RollsBackOnError(t *testing.T) {
+	adapter := testSQLiteAdapter(t)
+	ctx := context.Background()
+
+	err := adapter.ExecDDLBatch(ctx, []string{
+		`CREATE TABLE batch_ok (id TEXT PRIMARY KEY)`,
+		"NOT VALID SQL",
+	})
+	if err == nil {
+		t.Fatal("expected error for invalid statement")
+	}
+
+	tables, err := adapter.ListTables(ctx)
+	if err != nil {
+		t.Fatalf("ListTables: %v", err)
+	}
+	if len(tables) != 0 {
+		t.Fatalf("expected rollback to leave no tables, got %v", tables)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // InsertRow / QueryRows
 // ---------------------------------------------------------------------------
@@ -221,6 +267,135 @@ func TestSQLiteAdapter_InsertRow_EmptyData(t *testing.T) {
 	}
 }
 
+func TestSQLiteAdapter_InsertRows(t *testing.T) {
+	adapter := testSQLiteAdapter(t)
+	seedTestTable(t, adapter)
+	ctx := context.Background()
+
+	err := adapter.InsertRows(ctx, "items", []map[string]any{
+		{"id": "004", "name": "delta", "quantity": int64(40)},
+		{"id": "005", "name": "echo", "quantity": int64(50)},
+	})
+	if err != nil {
+		t.Fatalf("InsertRows: %v", err)
+	}
+	if n, _ := adapter.CountRows(ctx, "items"); n != 5 {
+		t.Fatalf("expected 5 rows, got %d", n)
+	}
+}
+
+func TestSQLiteAdapter_InsertRows_RollsBackOnError(t *testing.T) {
+	adapter := testSQLiteAdapter(t)
+	seedTestTable(t, adapter)
+	ctx := context.Background()
+
+	err := adapter.InsertRows(ctx, "items", []map[string]any{
+		{"id": "004", "name": "delta", "quantity": int64(40)},
+		{"id": "001", "name": "duplicate", "quantity": int64(1)},
+	})
+	if err == nil {
+		t.Fatal("expected duplicate primary key error")
+	}
+	if n, _ := adapter.CountRows(ctx, "items"); n != 3 {
+		t.Fatalf("expected rollback to leave 3 rows, got %d", n)
+	}
+}
+
+func TestSQLiteAdapter_ConstraintErrorsAreClassified(t *testing.T) {
+	adapter := testSQLiteAdapter(t)
+	ctx := context.Background()
+	if err := adapter.ExecDDL(ctx, `CREATE TABLE "things" ("id" TEXT PRIMARY KEY, "code" TEXT UNIQUE, "qty" INTEGER NOT NULL CHECK ("qty" >= 0))`); err != nil {
+		t.Fatalf("ExecDDL: %v", err)
+	}
+	if err := adapter.InsertRow(ctx, "things", map[string]any{"id": "1", "code": "a", "qty": int64(1)}); err != nil {
+		t.Fatalf("InsertRow: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		row  map[string]any
+		want error
+	}{
+		{"primary key", map[string]any{"id": "1", "code": "b", "qty": int64(1)}, ErrUniqueViolation},
+		{"unique", map[string]any{"id": "2", "code": "a", "qty": int64(1)}, ErrUniqueViolation},
+		{"check", map[string]any{"id": "3", "code": "c", "qty": int64(-1)}, ErrCheckViolation},
+		{"not null", map[string]any{"id": "4", "code": "d", "qty": nil}, ErrNotNull},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := adapter.InsertRow(ctx, "things", tt.row)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestDBErrorKind_DriverErrors(t *testing.T) {
+	tests := []struct {
+		err  error
+		want error
+	}{
+		{errors.New(`ERROR: duplicate key value violates unique constraint "t_pkey" (SQLSTATE 23505)`), ErrUniqueViolation},
+		{errors.New(`ERROR: insert or update on table "orders" violates foreign key constraint (SQLSTATE 23503)`), ErrForeignKey},
+		{errors.New(`ERROR: new row violates check constraint "qty_positive" (SQLSTATE 23514)`), ErrCheckViolation},
+		{errors.New(`ERROR: null value in column "name" of relation "items" violates not-null constraint (SQLSTATE 23502)`), ErrNotNull},
+		{&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'a' for key 'code'"}, ErrUniqueViolation},
+		{&mysql.MySQLError{Number: 1452, Message: "Cannot add or update a child row"}, ErrForeignKey},
+		{&mysql.MySQLError{Number: 3819, Message: "Check constraint 'qty_positive' is violated."}, ErrCheckViolation},
+		{&mysql.MySQLError{Number: 1048, Message: "Column 'name' cannot be null"}, ErrNotNull},
+		{fmt.Errorf("exec: %w", &mysql.MySQLError{Number: 1364, Message: "Field 'name' doesn't have a default value"}), ErrNotNull},
+		{&mysql.MySQLError{Number: 1146, Message: "Table 'moon.nope' doesn't exist"}, nil},
+		{errors.New("Error 1062 (23000): Duplicate entry 'a' for key 'code'"), nil},
+		{errors.New("dial tcp 127.0.0.1:5432: connect: connection refused"), ErrUnavailable},
+		{errors.New(`ERROR: syntax error at or near "SELEC" (SQLSTATE 42601)`), nil},
+	}
+	for _, tt := range tests {
+		if got := dbErrorKind(tt.err); got != tt.want {
+			t.Errorf("dbErrorKind(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestDBErrorResponse(t *testing.T) {
+	tests := []struct {
+		err        error
+		wantStatus int
+	}{
+		{newAdapterError("InsertRow", "t", "insert failed", fmt.Errorf("SQLSTATE 23505")), 409},
+		{newAdapterError("InsertRow", "t", "insert failed", fmt.Errorf("SQLSTATE 23503")), 409},
+		{newAdapterError("InsertRow", "t", "insert failed", fmt.Errorf("SQLSTATE 23514")), 400},
+		{newAdapterError("InsertRow", "t", "insert failed", fmt.Errorf("SQLSTATE 23502")), 400},
+		{fmt.Errorf("user: %w", ErrNotFound), 404},
+		{newAdapterError("QueryRows", "t", "select query failed", errors.New("disk I/O error")), 500},
+	}
+	for _, tt := range tests {
+		if status, _ := dbErrorResponse(tt.err); status != tt.wantStatus {
+			t.Errorf("dbErrorResponse(%v) status = %d, want %d", tt.err, status, tt.wantStatus)
+		}
+	}
+}
+
+func TestNotNullViolationMessage(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("%w: NOT NULL constraint failed: items.name", ErrNotNull), "Missing required field: name"},
+		{errors.New(`ERROR: null value in column "name" of relation "items" violates not-null constraint (SQLSTATE 23502)`), "Missing required field: name"},
+		{&mysql.MySQLError{Number: 1048, Message: "Column 'name' cannot be null"}, "Missing required field: name"},
+		{&mysql.MySQLError{Number: 1364, Message: "Field 'name' doesn't have a default value"}, "Missing required field: name"},
+		{errors.New("SQLSTATE 23502"), "Missing required field"},
+	}
+	for _, tt := range tests {
+		err := newAdapterError("InsertRow", "items", "insert failed", tt.err)
+		status, msg := dbErrorResponse(err)
+		if status != 400 || msg != tt.want {
+			t.Errorf("dbErrorResponse(%v) = %d %q, want 400 %q", tt.err, status, msg, tt.want)
+		}
+	}
+}
+
 // ---------------------------------------------------------------------------
 // QueryRows – filters
 // ---------------------------------------------------------------------------
@@ -429,6 +604,50 @@ func TestSQLiteAdapter_QueryRows_FieldProjection(t *testing.T) {
 	}
 }
 
+// ---------------------------------------------------------------------------
+// ReadSnapshot
+// ---------------------------------------------------------------------------
+
+func TestSQLiteAdapter_ReadSnapshot_IgnoresConcurrentWrites(t *testing.T) {
+	adapter := testSQLiteAdapter(t)
+	seedTestTable(t, adapter)
+	ctx := context.Background()
+	opts := QueryOptions{Sort: []SortField{{Field: "id"}}, Page: 1, PerPage: 2}
+
+	err := adapter.ReadSnapshot(ctx, func(snap SnapshotReader) error {
+		if _, total, err := snap.QueryRows(ctx, "items", opts); err != nil || total != 3 {
+			t.Fatalf("first page: total %d, err %v", total, err)
+		}
+		// Writes made while the snapshot is open must not be visible to it.
+		if err := adapter.InsertRow(ctx, "items", map[string]any{"id": "000", "name": "zero", "quantity": int64(0)}); err != nil {
+			t.Fatalf("InsertRow: %v", err)
+		}
+		if err := adapter.DeleteRow(ctx, "items", "003"); err != nil {
+			t.Fatalf("DeleteRow: %v", err)
+		}
+		opts.Page = 2
+		rows, total, err := snap.QueryRows(ctx, "items", opts)
+		if err != nil {
+			t.Fatalf("second page: %v", err)
+		}
+		if total != 3 || len(rows) != 1 || rows[0]["id"] != "003" {
+			t.Fatalf("expected snapshot page [003] of 3, got %v of %d", rows, total)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReadSnapshot: %v", err)
+	}
+
+	rows, _, err := adapter.QueryRows(ctx, "items", QueryOptions{Sort: []SortField{{Field: "id"}}})
+	if err != nil {
+		t.Fatalf("QueryRows: %v", err)
+	}
+	if len(rows) != 3 || rows[0]["id"] != "000" {
+		t.Fatalf("expected writes visible after snapshot, got %v", rows)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // QueryRows – search
 // ---------------------------------------------------------------------------
@@ -493,6 +712,170 @@ func TestSQLiteAdapter_UpdateRow_EmptyData(t *testing.T) {
 	}
 }
 
+func TestSQLiteAdapter_UpdateRowVersion(t *testing.T) {
+	adapter := testSQLiteAdapter(t)
+	ctx := context.Background()
+	if err := adapter.ExecDDL(ctx, `CREATE TABLE docs (id TEXT PRIMARY KEY, title TEXT NOT NULL, "_version" INTEGER NOT NULL DEFAULT 1)`); err != nil {
+		t.Fatalf("ExecDDL: %v", err)
+	}
+	if err := adapter.InsertRow(ctx, "docs", map[string]any{"id": "d1", "title": "a"}); err != nil {
+		t.Fatalf("InsertRow: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		expected int64
+		updated  bool
+		version  int64
+	}{
+		{"matching version", 1, true, 2},
+		{"stale version", 1, false, 2},
+		{"any version", 0, true, 3},
+	}
+	for _, tt := range tests {
+		updated, err := adapter.UpdateRowVersion(ctx, "docs", "d1", tt.expected, map[string]any{"title": tt.name})
+		if err != nil {
+			t.Fatalf("%s: UpdateRowVersion: %v", tt.name, err)
+		}
+		if updated != tt.updated {
+			t.Errorf("%s: expected updated=%v, got %v", tt.name, tt.updated, updated)
+		}
+		rows, _, _ := adapter.QueryRows(ctx, "docs", QueryOptions{Page: 1, PerPage: 1})
+		if rows[0][FieldVersion] != tt.version {
+			t.Errorf("%s: expected version %d, got %v", tt.name, tt.version, rows[0][FieldVersion])
+		}
+	}
+}
+
+func TestSQLiteAdapter_ExecWriteBatch(t *testing.T) {
+	adapter := testSQLiteAdapter(t)
+	seedTestTable(t, adapter)
+	ctx := context.Background()
+
+	writes := []BatchWrite{
+		{Op: BatchInsert, Table: "items", ID: "004", Data: map[string]any{"id": "004", "name": "delta", "quantity": int64(40)}},
+		{Op: BatchUpdate, Table: "items", ID: "001", Data: map[string]any{"quantity": int64(11)}},
+		{Op: BatchDelete, Table: "items", ID: "002"},
+	}
+	if _, err := adapter.ExecWriteBatch(ctx, writes); err != nil {
+		t.Fatalf("ExecWriteBatch: %v", err)
+	}
+	if count, _ := adapter.CountRows(ctx, "items"); count != 3 {
+		t.Fatalf("expected 3 rows, got %d", count)
+	}
+
+	// A write that matches no row rolls back the earlier writes.
+	writes = []BatchWrite{
+		{Op: BatchUpdate, Table: "items", ID: "001", Data: map[string]any{"quantity": int64(99)}},
+		{Op: BatchDelete, Table: "items", ID: "002"},
+	}
+	idx, err := adapter.ExecWriteBatch(ctx, writes)
+	if !errors.Is(err, ErrNoRowAffected) || idx != 1 {
+		t.Fatalf("expected ErrNoRowAffected at index 1, got %d, %v", idx, err)
+	}
+	rows, _, _ := adapter.QueryRows(ctx, "items", QueryOptions{
+		Filters: []Filter{{Field: "id", Op: "eq", Value: "001"}}, Page: 1, PerPage: 1,
+	})
+	if rows[0]["quantity"] != int64(11) {
+		t.Errorf("expected rolled-back quantity 11, got %v", rows[0]["quantity"])
+	}
+}
+
+func TestSQLiteAdapter_ExecWriteBatch_Upsert(t *testing.T) {
+	adapter := testSQLiteAdapter(t)
+	ctx := context.Background()
+	ddl := `CREATE TABLE parts (id TEXT PRIMARY KEY, sku TEXT NOT NULL UNIQUE, name TEXT NOT NULL, _version INTEGER NOT NULL DEFAULT 1)`
+	if err := adapter.ExecDDL(ctx, ddl); err != nil {
+		t.Fatalf("ExecDDL: %v", err)
+	}
+	upsert := func(id, name string) BatchWrite {
+		return BatchWrite{Op: BatchUpsert, Table: "parts", ID: id, Key: "sku", Update: []string{"name"}, Versioned: true,
+			Data: map[string]any{"id": id, "sku": "SP-1", "name": name}}
+	}
+
+	if _, err := adapter.ExecWriteBatch(ctx, []BatchWrite{upsert("p1", "sprocket")}); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	// The second write matches on sku and keeps the stored id.
+	if _, err := adapter.ExecWriteBatch(ctx, []BatchWrite{upsert("p2", "big sprocket")}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	rows, total, err := adapter.QueryRows(ctx, "parts", QueryOptions{Page: 1, PerPage: 10})
+	if err != nil {
+		t.Fatalf("QueryRows: %v", err)
+	}
+	if total != 1 {
+		t.Fatalf("expected 1 row, got %d", total)
+	}
+	if rows[0]["id"] != "p1" || rows[0]["name"] != "big sprocket" || rows[0]["_version"] != int64(2) {
+		t.Errorf("unexpected row %v", rows[0])
+	}
+}
+
+func TestSQLiteAdapter_ExecWriteBatch_GuardedUpsert(t *testing.T) {
+	adapter := testSQLiteAdapter(t)
+	ctx := context.Background()
+	ddl := `CREATE TABLE parts (id TEXT PRIMARY KEY, sku TEXT NOT NULL UNIQUE, name TEXT NOT NULL, owner_id TEXT NOT NULL)`
+	if err := adapter.ExecDDL(ctx, ddl); err != nil {
+		t.Fatalf("ExecDDL: %v", err)
+	}
+	upsert := func(owner, name string, update []string) BatchWrite {
+		id := GenerateULID()
+		return BatchWrite{Op: BatchUpsert, Table: "parts", ID: id, Key: "sku", Update: update,
+			Data:  map[string]any{"id": id, "sku": "SP-1", "name": name, "owner_id": owner},
+			Guard: map[string]any{"owner_id": owner}}
+	}
+
+	if _, err := adapter.ExecWriteBatch(ctx, []BatchWrite{upsert("alice", "sprocket", []string{"name"})}); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	for _, update := range [][]string{{"name"}, nil} {
+		if _, err := adapter.ExecWriteBatch(ctx, []BatchWrite{upsert("bob", "stolen", update)}); !errors.Is(err, ErrNoRowAffected) {
+			t.Errorf("update %v: expected ErrNoRowAffected for another owner's row, got %v", update, err)
+		}
+	}
+	if _, err := adapter.ExecWriteBatch(ctx, []BatchWrite{upsert("alice", "big sprocket", nil)}); err != nil {
+		t.Errorf("expected the owner's no-op upsert to succeed, got %v", err)
+	}
+	if _, err := adapter.ExecWriteBatch(ctx, []BatchWrite{upsert("alice", "big sprocket", []string{"name"})}); err != nil {
+		t.Fatalf("owner update: %v", err)
+	}
+	rows, _, err := adapter.QueryRows(ctx, "parts", QueryOptions{Page: 1, PerPage: 10})
+	if err != nil || len(rows) != 1 {
+		t.Fatalf("expected 1 row, got %d (%v)", len(rows), err)
+	}
+	if rows[0]["owner_id"] != "alice" || rows[0]["name"] != "big sprocket" {
+		t.Errorf("unexpected row %v", rows[0])
+	}
+}
+
+func TestSQLiteAdapter_UpdateWhereDeleteWhere(t *testing.T) {
+	adapter := testSQLiteAdapter(t)
+	seedTestTable(t, adapter)
+	ctx := context.Background()
+	filters := []Filter{{Field: "quantity", Op: "gt", Value: int64(15)}}
+
+	// Two rows match, so a limit of one changes nothing.
+	n, err := adapter.UpdateWhere(ctx, "items", filters, map[string]any{"name": "bulk"}, false, 1)
+	if !errors.Is(err, ErrTooManyRows) || n != 2 {
+		t.Fatalf("expected ErrTooManyRows after 2 rows, got %d, %v", n, err)
+	}
+	rows, _, _ := adapter.QueryRows(ctx, "items", QueryOptions{Filters: []Filter{{Field: "name", Op: "eq", Value: "bulk"}}})
+	if len(rows) != 0 {
+		t.Fatalf("expected the update to roll back, got %v", rows)
+	}
+
+	if n, err := adapter.UpdateWhere(ctx, "items", filters, map[string]any{"name": "bulk"}, false, 2); err != nil || n != 2 {
+		t.Fatalf("UpdateWhere: %d, %v", n, err)
+	}
+	if n, err := adapter.DeleteWhere(ctx, "items", []Filter{{Field: "name", Op: "eq", Value: "bulk"}}, 5); err != nil || n != 2 {
+		t.Fatalf("DeleteWhere: %d, %v", n, err)
+	}
+	if count, _ := adapter.CountRows(ctx, "items"); count != 1 {
+		t.Errorf("expected 1 row, got %d", count)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // DeleteRow
 // ---------------------------------------------------------------------------
@@ -617,6 +1000,47 @@ func TestSQLiteAdapter_DescribeTable(t *testing.T) {
 	}
 }
 
+func TestSQLiteAdapter_DescribeTable_FieldRules(t *testing.T) {
+	adapter := testSQLiteAdapter(t)
+	ctx := context.Background()
+
+	lo, hi := int64(-5), int64(10)
+	minLen, maxLen := 2, 8
+	status := FieldRules{MinLength: &minLen, MaxLength: &maxLen, Enum: []string{"draft", "o'neil", "a, b"}}
+	ddl := "CREATE TABLE rules_test (id TEXT PRIMARY KEY, " +
+		`"score" INTEGER NOT NULL` + fieldRulesCheckSQL("score", FieldRules{Min: &lo, Max: &hi}) + ", " +
+		`"status" TEXT COLLATE NOCASE` + fieldRulesCheckSQL("status", status) + ", " +
+		`"plain" TEXT)`
+	if err := adapter.ExecDDL(ctx, ddl); err != nil {
+		t.Fatal(err)
+	}
+
+	cols, err := adapter.DescribeTable(ctx, "rules_test")
+	if err != nil {
+		t.Fatalf("DescribeTable: %v", err)
+	}
+	byName := make(map[string]ColumnInfo)
+	for _, c := range cols {
+		byName[c.Name] = c
+	}
+	if got := byName["score"].Rules; !got.Equal(FieldRules{Min: &lo, Max: &hi}) {
+		t.Errorf("score rules not recovered: %+v", got)
+	}
+	if got := byName["status"].Rules; !got.Equal(status) {
+		t.Errorf("status rules not recovered: %+v (enum %q)", got, got.Enum)
+	}
+	if byName["status"].Collation != CollationNocase {
+		t.Errorf("expected nocase collation, got %q", byName["status"].Collation)
+	}
+	if !byName["plain"].Rules.IsZero() || byName["plain"].Collation != "" {
+		t.Errorf("expected no rules or collation on plain, got %+v", byName["plain"])
+	}
+
+	if err := adapter.InsertRow(ctx, "rules_test", map[string]any{"id": "R1", "score": int64(11)}); err == nil {
+		t.Error("expected database to enforce the max rule")
+	}
+}
+
 // ---------------------------------------------------------------------------
 // CountRows
 // ---------------------------------------------------------------------------
@@ -734,63 +1158,46 @@ func TestPostgresAdapter_Stubs(t *testing.T) {
 	if err := a.ExecDDL(ctx, "CREATE TABLE x (id TEXT)"); err == nil {
 		t.Fatal("expected not-implemented error")
 	}
-	if _, _, err := a.QueryRows(ctx, "x", QueryOptions{}); err == nil {
+	if err := a.ExecDDLBatch(ctx, []string{"CREATE TABLE x (id TEXT)"}); err == nil {
 		t.Fatal("expected not-implemented error")
 	}
-	if err := a.InsertRow(ctx, "x", map[string]any{}); err == nil {
+	if _, _, err := a.QueryRows(ctx, "x", QueryOptions{}); err == nil {
 		t.Fatal("expected not-implemented error")
 	}
-	if err := a.UpdateRow(ctx, "x", "1", map[string]any{}); err == nil {
+	if err := a.InsertRow(ctx, "x", map[string]any{}); err == nil {
 		t.Fatal("expected not-implemented error")
 	}
-	if err := a.DeleteRow(ctx, "x", "1"); err == nil {
+	if err := a.InsertRows(ctx, "x", []map[string]any{{"id": "1"}}); err == nil {
 		t.Fatal("expected not-implemented error")
 	}
-	if _, err := a.ListTables(ctx); err == nil {
-		t.Fatal("expected not-implemented error")
-	}
-	if _, err := a.DescribeTable(ctx, "x"); err == nil {
+	if err := a.UpdateRow(ctx, "x", "1", map[string]any{}); err == nil {
 		t.Fatal("expected not-implemented error")
 	}
-	if _, err := a.CountRows(ctx, "x"); err == nil {
+	if _, err := a.UpdateRowVersion(ctx, "x", "1", 1, map[string]any{}); err == nil {
 		t.Fatal("expected not-implemented error")
 	}
-	if err := a.Close(); err != nil {
-		t.Fatalf("Close should succeed: %v", err)
-	}
-}
-
-func TestMySQLAdapter_Stubs(t *testing.T) {
-	cfg := DatabaseConfig{Connection: DBConnectionMySQL}
-	logger := NewTestLogger(&bytes.Buffer{})
-	a, _ := NewMySQLAdapter(cfg, logger)
-	ctx := context.Background()
-
-	if err := a.Ping(ctx); err == nil {
-		t.Fatal("expected not-implemented error")
-	}
-	if err := a.ExecDDL(ctx, "CREATE TABLE x (id TEXT)"); err == nil {
+	if err := a.DeleteRow(ctx, "x", "1"); err == nil {
 		t.Fatal("expected not-implemented error")
 	}
-	if _, _, err := a.QueryRows(ctx, "x", QueryOptions{}); err == nil {
+	if _, err := a.ExecWriteBatch(ctx, nil); err == nil {
 		t.Fatal("expected not-implemented error")
 	}
-	if err := a.InsertRow(ctx, "x", map[string]any{}); err == nil {
+	if _, err := a.ListTables(ctx); err == nil {
 		t.Fatal("expected not-implemented error")
 	}
-	if err := a.UpdateRow(ctx, "x", "1", map[string]any{}); err == nil {
+	if _, err := a.DescribeTable(ctx, "x"); err == nil {
 		t.Fatal("expected not-implemented error")
 	}
-	if err := a.DeleteRow(ctx, "x", "1"); err == nil {
+	if _, err := a.CountRows(ctx, "x"); err == nil {
 		t.Fatal("expected not-implemented error")
 	}
-	if _, err := a.ListTables(ctx); err == nil {
+	if _, err := a.NumericHistogram(ctx, "x", "n", 10, nil); err == nil {
 		t.Fatal("expected not-implemented error")
 	}
-	if _, err := a.DescribeTable(ctx, "x"); err == nil {
+	if _, err := a.TimeSeries(ctx, "x", TimeSeriesQuery{}); err == nil {
 		t.Fatal("expected not-implemented error")
 	}
-	if _, err := a.CountRows(ctx, "x"); err == nil {
+	if _, err := a.Pivot(ctx, "x", PivotQuery{}); err == nil {
 		t.Fatal("expected not-implemented error")
 	}
 	if err := a.Close(); err != nil {
@@ -824,9 +1231,12 @@ func TestPostgresTypeMappingConstants(t *testing.T) {
 }
 
 func TestMySQLTypeMappingConstants(t *testing.T) {
-	if MySQLTypeDecimal != "DECIMAL(19,2)" {
+	if MySQLTypeDecimal != "DECIMAL(25,10)" {
 		t.Fatalf("MySQLTypeDecimal: got %q", MySQLTypeDecimal)
 	}
+	if MySQLTypeDatetime != "DATETIME(6)" {
+		t.Fatalf("MySQLTypeDatetime: got %q", MySQLTypeDatetime)
+	}
 	if MySQLTypeJSON != "JSON" {
 		t.Fatalf("MySQLTypeJSON: got %q", MySQLTypeJSON)
 	}
@@ -965,7 +1375,7 @@ func TestLogSlowQuery_BelowThreshold(t *testing.T) {
 	logger := NewTestLogger(&buf)
 
 	start := time.Now().Add(-10 * time.Millisecond) // 10ms elapsed
-	logSlowQuery(logger, "products", "select", start, 500)
+	logSlowQuery(context.Background(), logger, "products", "select", start, 500)
 
 	if buf.Len() > 0 {
 		t.Errorf("expected no log output for fast query, got: %s", buf.String())
@@ -978,9 +1388,323 @@ func TestLogSlowQuery_AboveThreshold(t *testing.T) {
 	logger := NewTestLogger(&buf)
 
 	start := time.Now().Add(-1 * time.Second) // 1s elapsed
-	logSlowQuery(logger, "products", "select", start, 500)
+	logSlowQuery(context.Background(), logger, "products", "select", start, 500)
 
 	if !strings.Contains(buf.String(), "slow query") {
 		t.Errorf("expected slow query warning, got: %s", buf.String())
 	}
 }
+
+// ---------------------------------------------------------------------------
+// MySQL translation
+// ---------------------------------------------------------------------------
+
+// mysqlUniqueNameRe matches the generated unique constraint names, which
+// differ on every call.
+var mysqlUniqueNameRe = regexp.MustCompile(`moon_uq_[0-9a-z]+`)
+
+func TestMySQLAddress(t *testing.T) {
+	tests := []struct {
+		host, network, addr string
+	}{
+		{"", "", ""},
+		{"db.local", "tcp", "db.local:3306"},
+		{"db.local:3307", "tcp", "db.local:3307"},
+		{"::1", "tcp", "[::1]:3306"},
+		{"[::1]:3307", "tcp", "[::1]:3307"},
+		{"/var/run/mysqld/mysqld.sock", "unix", "/var/run/mysqld/mysqld.sock"},
+	}
+	for _, tt := range tests {
+		network, addr := mysqlAddress(tt.host)
+		if network != tt.network || addr != tt.addr {
+			t.Errorf("mysqlAddress(%q) = %q, %q; want %q, %q", tt.host, network, addr, tt.network, tt.addr)
+		}
+	}
+}
+
+func TestMySQLConnConfig(t *testing.T) {
+	c := mysqlConnConfig(DatabaseConfig{
+		Host: "db.local", Database: "moon", User: "moon", Password: "secret", QueryTimeout: 7,
+	})
+	if c.Addr != "db.local:3306" || c.DBName != "moon" || c.User != "moon" || c.Passwd != "secret" {
+		t.Fatalf("unexpected connection fields: %+v", c)
+	}
+	if !c.ParseTime || !c.ClientFoundRows || c.Loc != time.UTC {
+		t.Fatal("expected ParseTime, ClientFoundRows, and UTC location")
+	}
+	if c.Timeout != 7*time.Second {
+		t.Fatalf("Timeout: got %v", c.Timeout)
+	}
+	if !strings.Contains(c.Params["sql_mode"], "ANSI_QUOTES") {
+		t.Fatalf("sql_mode must enable ANSI_QUOTES, got %q", c.Params["sql_mode"])
+	}
+}
+
+func TestMySQLTranslateDDL(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{
+			"create table",
+			`CREATE TABLE IF NOT EXISTS "products" ("id" TEXT PRIMARY KEY, "title" TEXT NOT NULL UNIQUE, "price" NUMERIC(10,2) NULL, "tags" JSON NOT NULL DEFAULT '[]', "note" TEXT NOT NULL DEFAULT '' COLLATE NOCASE CHECK (length("note") <= 20))`,
+			`CREATE TABLE IF NOT EXISTS "products" ("id" VARCHAR(255) PRIMARY KEY, "title" VARCHAR(255) NOT NULL, CONSTRAINT "moon_uq_X" UNIQUE ("title"), "price" DECIMAL(10,2) NULL, "tags" JSON NOT NULL DEFAULT ('[]'), "note" LONGTEXT NOT NULL DEFAULT ('') COLLATE utf8mb4_0900_as_ci CHECK (char_length("note") <= 20)) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin`,
+		},
+		{
+			"table unique constraint",
+			`CREATE TABLE users (id TEXT PRIMARY KEY, username TEXT NOT NULL, CONSTRAINT users_username_unique UNIQUE (username))`,
+			`CREATE TABLE users ("id" VARCHAR(255) PRIMARY KEY, "username" VARCHAR(255) NOT NULL, CONSTRAINT "moon_uq_X" UNIQUE (username)) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin`,
+		},
+		{
+			"add column",
+			`ALTER TABLE "products" ADD COLUMN "sku" TEXT NOT NULL DEFAULT '' UNIQUE`,
+			`ALTER TABLE "products" ADD COLUMN "sku" VARCHAR(255) NOT NULL DEFAULT '', ADD CONSTRAINT "moon_uq_X" UNIQUE ("sku")`,
+		},
+		{
+			"add datetime column",
+			`ALTER TABLE "products" ADD COLUMN "seen_at" TIMESTAMP NOT NULL DEFAULT ''`,
+			`ALTER TABLE "products" ADD COLUMN "seen_at" DATETIME(6) NOT NULL DEFAULT '1970-01-01 00:00:00'`,
+		},
+		{
+			"pass through",
+			`ALTER TABLE "products" RENAME TO "items"`,
+			`ALTER TABLE "products" RENAME TO "items"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mysqlUniqueNameRe.ReplaceAllString(mysqlTranslateDDL(tt.in), "moon_uq_X")
+			if got != tt.want {
+				t.Fatalf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMySQLColumnType(t *testing.T) {
+	tests := []struct {
+		in   string
+		key  bool
+		want string
+	}{
+		{"TEXT", false, "LONGTEXT"},
+		{"TEXT", true, "VARCHAR(255)"},
+		{"INTEGER", false, "BIGINT"},
+		{"NUMERIC", false, "DECIMAL(25,10)"},
+		{"NUMERIC(12,4)", false, "DECIMAL(12,4)"},
+		{"BOOLEAN", false, "BOOLEAN"},
+		{"TIMESTAMP", false, "DATETIME(6)"},
+		{"JSON", false, "JSON"},
+	}
+	for _, tt := range tests {
+		if got := mysqlColumnType(tt.in, tt.key); got != tt.want {
+			t.Errorf("mysqlColumnType(%q, %v) = %q, want %q", tt.in, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestMySQLPortableType(t *testing.T) {
+	tests := []struct {
+		dataType, columnType, want string
+	}{
+		{"varchar", "varchar(255)", "TEXT"},
+		{"longtext", "longtext", "TEXT"},
+		{"bigint", "bigint", "INTEGER"},
+		{"tinyint", "tinyint(1)", "BOOLEAN"},
+		{"decimal", "decimal(25,10)", "NUMERIC"},
+		{"decimal", "decimal(12,4)", "NUMERIC(12,4)"},
+		{"datetime", "datetime(6)", "TIMESTAMP"},
+		{"json", "json", "JSON"},
+	}
+	for _, tt := range tests {
+		if got := mysqlPortableType(tt.dataType, tt.columnType); got != tt.want {
+			t.Errorf("mysqlPortableType(%q, %q) = %q, want %q", tt.dataType, tt.columnType, got, tt.want)
+		}
+	}
+}
+
+func TestMySQLCheckClauseSQL_RoundTrip(t *testing.T) {
+	clauses := []string{
+		"(`qty` >= 1)",
+		"(`qty` <= 9)",
+		"(char_length(`code`) <= 8)",
+		"(`status` in (_utf8mb4\\'open\\',_utf8mb4\\'closed\\'))",
+	}
+	var def strings.Builder
+	for _, c := range clauses {
+		def.WriteString(" CHECK " + mysqlCheckClauseSQL(c))
+	}
+
+	qty := parseFieldRulesSQL("qty", def.String())
+	if qty.Min == nil || *qty.Min != 1 || qty.Max == nil || *qty.Max != 9 {
+		t.Fatalf("qty rules: %+v", qty)
+	}
+	code := parseFieldRulesSQL("code", def.String())
+	if code.MaxLength == nil || *code.MaxLength != 8 {
+		t.Fatalf("code rules: %+v", code)
+	}
+	status := parseFieldRulesSQL("status", def.String())
+	if strings.Join(status.Enum, ",") != "open,closed" {
+		t.Fatalf("status rules: %+v", status)
+	}
+}
+
+func TestMySQLWhereClause(t *testing.T) {
+	opts := QueryOptions{
+		Filters: []Filter{
+			{Field: "created_at", Op: "gte", Value: "2026-01-02T03:04:05Z"},
+			{Field: "title", Op: "ieq", Value: "Widget"},
+			{Field: "meta", Op: "eq", Value: "red", Path: "color"},
+		},
+		Search:       "gad",
+		SearchFields: []string{"title"},
+	}
+	where, args := mysqlWhereClause(opts, map[string]string{"created_at": "datetime", "title": "longtext"})
+
+	for _, frag := range []string{
+		`"created_at" >= ?`,
+		`LOWER("title") = LOWER(?)`,
+		`JSON_EXTRACT("meta", ?)`,
+		`(LOWER("title") LIKE LOWER(?))`,
+	} {
+		if !strings.Contains(where, frag) {
+			t.Errorf("where clause missing %q: %s", frag, where)
+		}
+	}
+	if len(args) != 7 {
+		t.Fatalf("expected 7 args, got %d: %v", len(args), args)
+	}
+	if ts, ok := args[0].(time.Time); !ok || !ts.Equal(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Fatalf("datetime filter value not converted: %#v", args[0])
+	}
+	if args[2] != `$."color"` || args[5] != "red" || args[6] != "%gad%" {
+		t.Fatalf("unexpected args: %v", args)
+	}
+}
+
+func TestMySQLOrderClause(t *testing.T) {
+	got := mysqlOrderClause([]SortField{
+		{Field: "price", Desc: true, Nulls: NullsLast},
+		{Field: "title"},
+	})
+	want := ` ORDER BY "price" IS NULL ASC, "price" DESC, "title" ASC`
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestMySQLScanValue(t *testing.T) {
+	if got := mysqlScanValue([]byte("12.5000000000"), "DECIMAL"); got != "12.5" {
+		t.Errorf("decimal: got %#v", got)
+	}
+	if got := mysqlScanValue([]byte("hello"), "LONGTEXT"); got != "hello" {
+		t.Errorf("text: got %#v", got)
+	}
+	if got := mysqlScanValue([]byte{1, 2}, "BLOB"); !bytes.Equal(got.([]byte), []byte{1, 2}) {
+		t.Errorf("blob: got %#v", got)
+	}
+	ts := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	if got := mysqlScanValue(ts, "DATETIME"); got != "2026-01-02T03:04:05Z" {
+		t.Errorf("datetime: got %#v", got)
+	}
+	if got := mysqlScanValue(int64(3), "BIGINT"); got != int64(3) {
+		t.Errorf("integer: got %#v", got)
+	}
+}
+
+func TestSQLiteAdapter_PivotLimit(t *testing.T) {
+	adapter := testSQLiteAdapter(t)
+	seedTestTable(t, adapter)
+	ctx := context.Background()
+
+	q := PivotQuery{RowField: "name", ColumnField: "active", Agg: "count"}
+	all, err := adapter.Pivot(ctx, "items", q)
+	if err != nil {
+		t.Fatalf("Pivot: %v", err)
+	}
+	q.Limit = 2
+	limited, err := adapter.Pivot(ctx, "items", q)
+	if err != nil {
+		t.Fatalf("Pivot: %v", err)
+	}
+	if len(all) <= 2 || len(limited) != 2 || limited[0] != all[0] || limited[1] != all[1] {
+		t.Errorf("expected the first 2 of %v, got %v", all, limited)
+	}
+}
+
+func TestSQLiteAdapter_SwapShadowTableCopiesOnlyLoggedRows(t *testing.T) {
+	adapter := testSQLiteAdapter(t)
+	ctx := context.Background()
+	if err := adapter.ExecDDL(ctx, `CREATE TABLE notes (id TEXT PRIMARY KEY, body TEXT NOT NULL)`); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		if err := adapter.InsertRow(ctx, "notes", map[string]any{"id": id, "body": id}); err != nil {
+			t.Fatalf("insert %s: %v", id, err)
+		}
+	}
+
+	s := ShadowTable{Table: "notes", Name: ShadowTablePrefix + "test", Columns: []string{"id", "body"}}
+	if err := adapter.ExecDDL(ctx, `CREATE TABLE "moon_shadow_test" (id TEXT PRIMARY KEY, body TEXT NOT NULL)`); err != nil {
+		t.Fatalf("create shadow: %v", err)
+	}
+	if err := adapter.TrackShadowChanges(ctx, s); err != nil {
+		t.Fatalf("TrackShadowChanges: %v", err)
+	}
+	last, n, err := adapter.CopyShadowBatch(ctx, s, "", 2)
+	if err != nil || last != "b" || n != 2 {
+		t.Fatalf("first batch = %q, %d, %v; want b, 2", last, n, err)
+	}
+	last, n, err = adapter.CopyShadowBatch(ctx, s, last, 2)
+	if err != nil || last != "c" || n != 1 {
+		t.Fatalf("second batch = %q, %d, %v; want c, 1", last, n, err)
+	}
+	if _, n, err = adapter.CopyShadowBatch(ctx, s, last, 2); err != nil || n != 0 {
+		t.Fatalf("final batch = %d, %v; want 0", n, err)
+	}
+
+	// The shadow copy of a is changed behind the triggers' back, so it is
+	// re-copied only if the swap copies rows that were not logged.
+	if err := adapter.ExecDDL(ctx, `UPDATE "moon_shadow_test" SET body = 'untouched' WHERE id = 'a'`); err != nil {
+		t.Fatalf("update shadow: %v", err)
+	}
+	if err := adapter.UpdateRow(ctx, "notes", "b", map[string]any{"body": "changed"}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := adapter.DeleteRow(ctx, "notes", "c"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	idx := IndexInfo{Name: "idx_notes_body", Columns: []string{"body"}}
+	if err := adapter.SwapShadowTable(ctx, s, []IndexInfo{idx}); err != nil {
+		t.Fatalf("SwapShadowTable: %v", err)
+	}
+
+	rows, _, err := adapter.QueryRows(ctx, "notes", QueryOptions{Sort: []SortField{{Field: "id"}}})
+	if err != nil {
+		t.Fatalf("QueryRows: %v", err)
+	}
+	got := make(map[string]any)
+	for _, row := range rows {
+		got[stringVal(row, "id")] = row["body"]
+	}
+	if want := map[string]any{"a": "untouched", "b": "changed"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("rows = %v, want %v", got, want)
+	}
+	indexes, err := adapter.ListIndexes(ctx, "notes")
+	if err != nil || len(indexes) != 1 || indexes[0].Name != idx.Name {
+		t.Errorf("indexes = %v, %v; want %s", indexes, err, idx.Name)
+	}
+	tables, err := adapter.ListTables(ctx)
+	if err != nil {
+		t.Fatalf("ListTables: %v", err)
+	}
+	for _, tbl := range tables {
+		if strings.HasPrefix(tbl, ShadowTablePrefix) {
+			t.Errorf("table %q left behind", tbl)
+		}
+	}
+	// The triggers went with the original table.
+	if err := adapter.InsertRow(ctx, "notes", map[string]any{"id": "d", "body": "d"}); err != nil {
+		t.Errorf("insert after swap: %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// AdminPermissionHandler implements GET /admin:permissions and
+// POST /admin:permissions for managing per-collection access rules.
+type AdminPermissionHandler struct {
+	store    *PermissionStore
+	registry *SchemaRegistry
+	logger   *Logger
+	audit    *AuditLog
+}
+
+// NewAdminPermissionHandler creates an AdminPermissionHandler. logger may
+// be nil.
+func NewAdminPermissionHandler(store *PermissionStore, registry *SchemaRegistry, logger *Logger) *AdminPermissionHandler {
+	return &AdminPermissionHandler{store: store, registry: registry, logger: logger}
+}
+
+// SetAuditLog records each permission change in audit.
+func (h *AdminPermissionHandler) SetAuditLog(audit *AuditLog) {
+	h.audit = audit
+}
+
+// adminPermissionMutateRequest is the JSON body for POST /admin:permissions.
+type adminPermissionMutateRequest struct {
+	Op   string           `json:"op"`
+	Data []PermissionRule `json:"data"`
+}
+
+// HandleQuery lists the permission rules, optionally limited to the
+// collection named by the collection query parameter.
+func (h *AdminPermissionHandler) HandleQuery(w http.ResponseWriter, r *http.Request) {
+	identity, ok := GetAuthIdentity(r.Context())
+	if !ok || identity.Role != "admin" {
+		WriteError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	rules := h.store.Rules(r.URL.Query().Get("collection"))
+	data := make([]any, 0, len(rules))
+	for _, rule := range rules {
+		data = append(data, rule)
+	}
+	meta := map[string]any{"total": len(data)}
+
+	WriteSuccessFull(w, http.StatusOK, "Permissions retrieved successfully", data, meta, nil)
+}
+
+// HandleMutate sets or destroys permission rules. op=set creates a rule
+// or replaces its operations; op=destroy removes it.
+func (h *AdminPermissionHandler) HandleMutate(w http.ResponseWriter, r *http.Request) {
+	identity, ok := GetAuthIdentity(r.Context())
+	if !ok || identity.Role != "admin" {
+		WriteError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	var req adminPermissionMutateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Op != "set" && req.Op != "destroy" {
+		WriteError(w, http.StatusBadRequest, "Invalid op: must be set or destroy")
+		return
+	}
+	if len(req.Data) == 0 {
+		WriteError(w, http.StatusBadRequest, "Missing required field: data")
+		return
+	}
+	for _, rule := range req.Data {
+		if err := h.validateRule(rule, req.Op == "set"); err != nil {
+			WriteErrorFrom(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	ctx := r.Context()
+	results := make([]any, 0, len(req.Data))
+	success, failed := 0, 0
+	for _, rule := range req.Data {
+		if req.Op == "set" {
+			saved, err := h.store.Set(ctx, rule)
+			if err != nil {
+				failed++
+				continue
+			}
+			results = append(results, saved)
+		} else {
+			removed, err := h.store.Remove(ctx, rule.Collection, rule.SubjectType, rule.Subject)
+			if err != nil || !removed {
+				failed++
+				continue
+			}
+			results = append(results, map[string]any{
+				"collection":   rule.Collection,
+				"subject_type": rule.SubjectType,
+				"subject":      rule.Subject,
+			})
+		}
+		success++
+		if h.logger != nil {
+			h.logger.AuditEventContext(r.Context(), AuditPrivilegedMutation,
+				"action", "permission."+req.Op,
+				"actor", identity.CallerID,
+				"collection", rule.Collection,
+				"target", rule.SubjectType+":"+rule.Subject,
+				"timestamp", time.Now().UTC().Format(time.RFC3339),
+			)
+		}
+		h.audit.Record(ctx, AuditEntry{
+			Event:      AuditPrivilegedMutation,
+			Actor:      identity.CallerID,
+			Action:     "permission." + req.Op,
+			Collection: rule.Collection,
+			RecordID:   rule.SubjectType + ":" + rule.Subject,
+			RequestID:  requestID(w),
+		})
+	}
+
+	meta := map[string]any{"success": success, "failed": failed}
+	WriteSuccessFull(w, http.StatusOK, "Permissions updated successfully", results, meta, nil)
+}
+
+// validateRule checks the rule key and, for op=set, its operations.
+func (h *AdminPermissionHandler) validateRule(rule PermissionRule, withOperations bool) error {
+	if rule.Collection == "" {
+		return fmt.Errorf("Missing required field: data.collection")
+	}
+	if _, ok := h.registry.Get(rule.Collection); !ok {
+		return fmt.Errorf("Collection '%s' not found", rule.Collection)
+	}
+	switch rule.SubjectType {
+	case PermissionSubjectRole:
+		// Admins always have full access, so only the user role can be
+		// restricted.
+		if rule.Subject != "user" {
+			return fmt.Errorf("Invalid subject: role rules apply only to the user role")
+		}
+	case PermissionSubjectAPIKey:
+		if rule.Subject == "" {
+			return fmt.Errorf("Missing required field: data.subject")
+		}
+	default:
+		return fmt.Errorf("Invalid subject_type: must be role or apikey")
+	}
+	if !withOperations {
+		return nil
+	}
+	if rule.Operations == nil {
+		return fmt.Errorf("Missing required field: data.operations")
+	}
+	for _, op := range rule.Operations {
+		if !stringInSlice(op, PermissionOperations) {
+			return fmt.Errorf("Invalid operation '%s': must be one of list, read, create, update, destroy", op)
+		}
+	}
+	return nil
+}
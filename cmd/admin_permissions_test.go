@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func doAdminPermissionMutate(t *testing.T, h *AdminPermissionHandler, body any, identity *AuthIdentity) *httptest.ResponseRecorder {
+	t.Helper()
+	b, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, "/admin:permissions", strings.NewReader(string(b)))
+	req = req.WithContext(SetAuthIdentity(req.Context(), identity))
+	w := httptest.NewRecorder()
+	h.HandleMutate(w, req)
+	return w
+}
+
+func TestAdminPermissions_SetQueryDestroy(t *testing.T) {
+	store, registry := setupPermissionTest(t)
+	h := NewAdminPermissionHandler(store, registry, nil)
+
+	rule := map[string]any{
+		"collection": "products", "subject_type": "role", "subject": "user",
+		"operations": []string{"list", "read"},
+	}
+	w := doAdminPermissionMutate(t, h, map[string]any{"op": "set", "data": []any{rule}}, adminIdentity())
+	if w.Code != http.StatusOK {
+		t.Fatalf("set: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin:permissions?collection=products", nil)
+	req = req.WithContext(SetAuthIdentity(req.Context(), adminIdentity()))
+	w = httptest.NewRecorder()
+	h.HandleQuery(w, req)
+	resp := decodeResponse(t, w)
+	data := resp["data"].([]any)
+	if len(data) != 1 || data[0].(map[string]any)["subject"] != "user" {
+		t.Fatalf("unexpected query result: %v", resp)
+	}
+
+	w = doAdminPermissionMutate(t, h, map[string]any{"op": "destroy", "data": []any{rule}}, adminIdentity())
+	meta := decodeResponse(t, w)["meta"].(map[string]any)
+	if meta["success"] != float64(1) || store.HasRules("products") {
+		t.Fatalf("expected rule to be destroyed, meta %v", meta)
+	}
+
+	w = doAdminPermissionMutate(t, h, map[string]any{"op": "destroy", "data": []any{rule}}, adminIdentity())
+	meta = decodeResponse(t, w)["meta"].(map[string]any)
+	if meta["failed"] != float64(1) {
+		t.Errorf("expected missing rule to fail, meta %v", meta)
+	}
+}
+
+func TestAdminPermissions_Validation(t *testing.T) {
+	store, registry := setupPermissionTest(t)
+	h := NewAdminPermissionHandler(store, registry, nil)
+
+	tests := []struct {
+		name string
+		body map[string]any
+	}{
+		{"bad op", map[string]any{"op": "create", "data": []any{map[string]any{}}}},
+		{"missing data", map[string]any{"op": "set"}},
+		{"unknown collection", map[string]any{"op": "set", "data": []any{map[string]any{
+			"collection": "nope", "subject_type": "role", "subject": "user", "operations": []string{"list"}}}}},
+		{"admin role", map[string]any{"op": "set", "data": []any{map[string]any{
+			"collection": "products", "subject_type": "role", "subject": "admin", "operations": []string{"list"}}}}},
+		{"bad subject type", map[string]any{"op": "set", "data": []any{map[string]any{
+			"collection": "products", "subject_type": "group", "subject": "x", "operations": []string{"list"}}}}},
+		{"bad operation", map[string]any{"op": "set", "data": []any{map[string]any{
+			"collection": "products", "subject_type": "apikey", "subject": "k1", "operations": []string{"write"}}}}},
+		{"missing operations", map[string]any{"op": "set", "data": []any{map[string]any{
+			"collection": "products", "subject_type": "apikey", "subject": "k1"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := doAdminPermissionMutate(t, h, tt.body, adminIdentity()); w.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+
+	w := doAdminPermissionMutate(t, h, map[string]any{"op": "set", "data": []any{}}, userWriteIdentity())
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for non-admin, got %d", w.Code)
+	}
+}
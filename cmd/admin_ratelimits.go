@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// AdminRateLimitHandler implements GET /admin:ratelimits and
+// POST /admin:ratelimits for inspecting and resetting rate limit buckets.
+type AdminRateLimitHandler struct {
+	rateLimiter *RateLimiter
+	logger      *Logger
+	audit       *AuditLog
+}
+
+// NewAdminRateLimitHandler creates an AdminRateLimitHandler. logger may be nil.
+func NewAdminRateLimitHandler(rl *RateLimiter, logger *Logger) *AdminRateLimitHandler {
+	return &AdminRateLimitHandler{rateLimiter: rl, logger: logger}
+}
+
+// SetAuditLog records each bucket reset in audit.
+func (h *AdminRateLimitHandler) SetAuditLog(audit *AuditLog) {
+	h.audit = audit
+}
+
+// adminRateLimitMutateRequest is the JSON body for POST /admin:ratelimits.
+type adminRateLimitMutateRequest struct {
+	Op   string                 `json:"op"`
+	Data []adminRateLimitTarget `json:"data"`
+}
+
+// adminRateLimitTarget identifies one bucket to reset.
+type adminRateLimitTarget struct {
+	Type   string `json:"type"`
+	Entity string `json:"entity"`
+}
+
+// HandleQuery lists every rate limit bucket with activity in its current
+// window, most saturated first within each type.
+func (h *AdminRateLimitHandler) HandleQuery(w http.ResponseWriter, r *http.Request) {
+	identity, ok := GetAuthIdentity(r.Context())
+	if !ok || identity.Role != "admin" {
+		WriteError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	buckets := h.rateLimiter.Buckets()
+	data := make([]any, 0, len(buckets))
+	for _, b := range buckets {
+		data = append(data, b)
+	}
+	meta := map[string]any{"total": len(data)}
+
+	WriteSuccessFull(w, http.StatusOK, "Rate limits retrieved successfully", data, meta, nil)
+}
+
+// HandleMutate resets the requested buckets. Only op=reset is supported.
+func (h *AdminRateLimitHandler) HandleMutate(w http.ResponseWriter, r *http.Request) {
+	identity, ok := GetAuthIdentity(r.Context())
+	if !ok || identity.Role != "admin" {
+		WriteError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	var req adminRateLimitMutateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Op != "reset" {
+		WriteError(w, http.StatusBadRequest, "Invalid op: must be reset")
+		return
+	}
+	if len(req.Data) == 0 {
+		WriteError(w, http.StatusBadRequest, "Missing required field: data")
+		return
+	}
+	for _, t := range req.Data {
+		if _, ok := h.rateLimiter.limiterFor(t.Type); !ok {
+			WriteError(w, http.StatusBadRequest, "Invalid rate limit type: must be login_failure, jwt, apikey, or route")
+			return
+		}
+		if t.Entity == "" {
+			WriteError(w, http.StatusBadRequest, "Missing required field: data.entity")
+			return
+		}
+	}
+
+	results := make([]any, 0, len(req.Data))
+	success, failed := 0, 0
+	for _, t := range req.Data {
+		if !h.rateLimiter.ResetBucket(t.Type, t.Entity) {
+			failed++
+			continue
+		}
+		success++
+		results = append(results, map[string]any{"type": t.Type, "entity": t.Entity})
+		if h.logger != nil {
+			h.logger.AuditEventContext(r.Context(), AuditPrivilegedMutation,
+				"action", "rate_limit.reset",
+				"actor", identity.CallerID,
+				"limit_type", t.Type,
+				"target", t.Entity,
+				"timestamp", time.Now().UTC().Format(time.RFC3339),
+			)
+		}
+		h.audit.Record(r.Context(), AuditEntry{
+			Event:     AuditPrivilegedMutation,
+			Actor:     identity.CallerID,
+			Action:    "rate_limit.reset",
+			RecordID:  t.Type + ":" + t.Entity,
+			RequestID: requestID(w),
+		})
+	}
+
+	meta := map[string]any{"success": success, "failed": failed}
+	WriteSuccessFull(w, http.StatusOK, "Rate limits reset successfully", results, meta, nil)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func adminRateLimitRequest(method, body string, role string) *http.Request {
+	var req *http.Request
+	if body == "" {
+		req = httptest.NewRequest(method, "/admin:ratelimits", nil)
+	} else {
+		req = httptest.NewRequest(method, "/admin:ratelimits", strings.NewReader(body))
+	}
+	identity := &AuthIdentity{CredentialType: CredentialTypeJWT, CallerID: "admin-001", Role: role}
+	return req.WithContext(SetAuthIdentity(req.Context(), identity))
+}
+
+func TestAdminRateLimits_Query(t *testing.T) {
+	rl := NewRateLimiter()
+	rl.AllowJWT("user-001")
+	h := NewAdminRateLimitHandler(rl, nil)
+
+	w := httptest.NewRecorder()
+	h.HandleQuery(w, adminRateLimitRequest(http.MethodGet, "", "admin"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	resp := decodeResponse(t, w)
+	data := resp["data"].([]any)
+	if len(data) != 1 {
+		t.Fatalf("expected 1 bucket, got %v", data)
+	}
+	bucket := data[0].(map[string]any)
+	if bucket["type"] != "jwt" || bucket["entity"] != "user-001" {
+		t.Errorf("unexpected bucket: %v", bucket)
+	}
+	if bucket["remaining"] != float64(RateJWTRequestLimit-1) {
+		t.Errorf("remaining: got %v", bucket["remaining"])
+	}
+}
+
+func TestAdminRateLimits_Reset(t *testing.T) {
+	rl := NewRateLimiter()
+	rl.AllowJWT("user-001")
+	h := NewAdminRateLimitHandler(rl, nil)
+
+	body := `{"op":"reset","data":[{"type":"jwt","entity":"user-001"},{"type":"jwt","entity":"idle"}]}`
+	w := httptest.NewRecorder()
+	h.HandleMutate(w, adminRateLimitRequest(http.MethodPost, body, "admin"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	meta := decodeResponse(t, w)["meta"].(map[string]any)
+	if meta["success"] != float64(1) || meta["failed"] != float64(1) {
+		t.Errorf("unexpected meta: %v", meta)
+	}
+	if len(rl.Buckets()) != 0 {
+		t.Error("bucket should be cleared")
+	}
+}
+
+func TestAdminRateLimits_ResetValidation(t *testing.T) {
+	h := NewAdminRateLimitHandler(NewRateLimiter(), nil)
+
+	for _, body := range []string{
+		`not json`,
+		`{"op":"clear","data":[{"type":"jwt","entity":"u"}]}`,
+		`{"op":"reset","data":[]}`,
+		`{"op":"reset","data":[{"type":"bogus","entity":"u"}]}`,
+		`{"op":"reset","data":[{"type":"jwt"}]}`,
+	} {
+		w := httptest.NewRecorder()
+		h.HandleMutate(w, adminRateLimitRequest(http.MethodPost, body, "admin"))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("body %s: expected 400, got %d", body, w.Code)
+		}
+	}
+}
+
+func TestAdminRateLimits_RequiresAdmin(t *testing.T) {
+	h := NewAdminRateLimitHandler(NewRateLimiter(), nil)
+
+	w := httptest.NewRecorder()
+	h.HandleQuery(w, adminRateLimitRequest(http.MethodGet, "", "user"))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", w.Code)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// AdminRoleHandler implements GET /admin:roles and POST /admin:roles for
+// managing custom roles.
+type AdminRoleHandler struct {
+	store  *PermissionStore
+	db     DatabaseAdapter
+	logger *Logger
+	audit  *AuditLog
+}
+
+// NewAdminRoleHandler creates an AdminRoleHandler. logger may be nil.
+func NewAdminRoleHandler(store *PermissionStore, db DatabaseAdapter, logger *Logger) *AdminRoleHandler {
+	return &AdminRoleHandler{store: store, db: db, logger: logger}
+}
+
+// SetAuditLog records each role change in audit.
+func (h *AdminRoleHandler) SetAuditLog(audit *AuditLog) {
+	h.audit = audit
+}
+
+// adminRoleMutateRequest is the JSON body for POST /admin:roles.
+type adminRoleMutateRequest struct {
+	Op   string `json:"op"`
+	Data []Role `json:"data"`
+}
+
+// HandleQuery lists the custom roles ordered by name.
+func (h *AdminRoleHandler) HandleQuery(w http.ResponseWriter, r *http.Request) {
+	identity, ok := GetAuthIdentity(r.Context())
+	if !ok || identity.Role != "admin" {
+		WriteError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	h.store.reloadIfStale(r.Context())
+	roles := h.store.Roles()
+	data := make([]any, 0, len(roles))
+	for _, role := range roles {
+		data = append(data, role)
+	}
+	meta := map[string]any{"total": len(data)}
+
+	WriteSuccessFull(w, http.StatusOK, "Roles retrieved successfully", data, meta, nil)
+}
+
+// HandleMutate sets or destroys custom roles. op=set creates a role or
+// replaces its description and permissions; op=destroy removes a role no
+// user or API key holds.
+func (h *AdminRoleHandler) HandleMutate(w http.ResponseWriter, r *http.Request) {
+	identity, ok := GetAuthIdentity(r.Context())
+	if !ok || identity.Role != "admin" {
+		WriteError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	var req adminRoleMutateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Op != "set" && req.Op != "destroy" {
+		WriteError(w, http.StatusBadRequest, "Invalid op: must be set or destroy")
+		return
+	}
+	if len(req.Data) == 0 {
+		WriteError(w, http.StatusBadRequest, "Missing required field: data")
+		return
+	}
+	for _, role := range req.Data {
+		if req.Op == "destroy" {
+			if role.Name == "" {
+				WriteError(w, http.StatusBadRequest, "Missing required field: data.name")
+				return
+			}
+			continue
+		}
+		if err := validateRole(role); err != nil {
+			WriteErrorFrom(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	ctx := r.Context()
+	results := make([]any, 0, len(req.Data))
+	success, failed := 0, 0
+	for _, role := range req.Data {
+		if req.Op == "set" {
+			saved, err := h.store.SetRole(ctx, role)
+			if err != nil {
+				failed++
+				continue
+			}
+			results = append(results, saved)
+		} else {
+			// A held role stays, so no account is left with a role that
+			// grants nothing.
+			inUse, err := roleInUse(ctx, h.db, role.Name)
+			if err != nil || inUse {
+				failed++
+				continue
+			}
+			removed, err := h.store.RemoveRole(ctx, role.Name)
+			if err != nil || !removed {
+				failed++
+				continue
+			}
+			results = append(results, map[string]any{"name": role.Name})
+		}
+		success++
+		if h.logger != nil {
+			h.logger.AuditEventContext(r.Context(), AuditPrivilegedMutation,
+				"action", "role."+req.Op,
+				"actor", identity.CallerID,
+				"target", role.Name,
+				"timestamp", time.Now().UTC().Format(time.RFC3339),
+			)
+		}
+		h.audit.Record(ctx, AuditEntry{
+			Event:     AuditPrivilegedMutation,
+			Actor:     identity.CallerID,
+			Action:    "role." + req.Op,
+			RecordID:  role.Name,
+			RequestID: requestID(w),
+		})
+	}
+
+	meta := map[string]any{"success": success, "failed": failed}
+	WriteSuccessFull(w, http.StatusOK, "Roles updated successfully", results, meta, nil)
+}
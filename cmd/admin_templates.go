@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// AdminTemplateHandler implements GET /admin:templates and
+// POST /admin:templates for managing document templates.
+type AdminTemplateHandler struct {
+	db       DatabaseAdapter
+	registry *SchemaRegistry
+	logger   *Logger
+	audit    *AuditLog
+}
+
+// NewAdminTemplateHandler creates an AdminTemplateHandler. logger may be
+// nil.
+func NewAdminTemplateHandler(db DatabaseAdapter, registry *SchemaRegistry, logger *Logger) *AdminTemplateHandler {
+	return &AdminTemplateHandler{db: db, registry: registry, logger: logger}
+}
+
+// SetAuditLog records each template change in audit.
+func (h *AdminTemplateHandler) SetAuditLog(audit *AuditLog) {
+	h.audit = audit
+}
+
+// adminTemplateMutateRequest is the JSON body for POST /admin:templates.
+type adminTemplateMutateRequest struct {
+	Op   string             `json:"op"`
+	Data []DocumentTemplate `json:"data"`
+}
+
+// HandleQuery lists the templates ordered by name, optionally limited to
+// the collection named by the collection query parameter.
+func (h *AdminTemplateHandler) HandleQuery(w http.ResponseWriter, r *http.Request) {
+	identity, ok := GetAuthIdentity(r.Context())
+	if !ok || identity.Role != "admin" {
+		WriteError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	var filters []Filter
+	if collection := r.URL.Query().Get("collection"); collection != "" {
+		filters = []Filter{{Field: "collection", Op: "eq", Value: collection}}
+	}
+	ctx := r.Context()
+	data := make([]any, 0)
+	for page := 1; ; page++ {
+		rows, _, err := h.db.QueryRows(ctx, TemplatesTable, QueryOptions{
+			Filters: filters,
+			Sort:    []SortField{{Field: "name"}},
+			Page:    page,
+			PerPage: MaxPerPage,
+		})
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		for _, row := range rows {
+			data = append(data, documentTemplateFromRow(row))
+		}
+		if len(rows) < MaxPerPage {
+			break
+		}
+	}
+	meta := map[string]any{"total": len(data)}
+
+	WriteSuccessFull(w, http.StatusOK, "Templates retrieved successfully", data, meta, nil)
+}
+
+// HandleMutate sets or destroys templates by name. op=set creates a
+// template or replaces its collection, format, and body; op=destroy
+// removes it.
+func (h *AdminTemplateHandler) HandleMutate(w http.ResponseWriter, r *http.Request) {
+	identity, ok := GetAuthIdentity(r.Context())
+	if !ok || identity.Role != "admin" {
+		WriteError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	var req adminTemplateMutateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Op != "set" && req.Op != "destroy" {
+		WriteError(w, http.StatusBadRequest, "Invalid op: must be set or destroy")
+		return
+	}
+	if len(req.Data) == 0 {
+		WriteError(w, http.StatusBadRequest, "Missing required field: data")
+		return
+	}
+	for _, t := range req.Data {
+		if err := h.validateTemplate(t, req.Op == "set"); err != nil {
+			WriteErrorFrom(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	ctx := r.Context()
+	results := make([]any, 0, len(req.Data))
+	success, failed := 0, 0
+	for _, t := range req.Data {
+		existing, err := findTemplate(ctx, h.db, t.Name)
+		if err != nil {
+			failed++
+			continue
+		}
+		if req.Op == "set" {
+			saved, err := h.save(ctx, t, existing)
+			if err != nil {
+				failed++
+				continue
+			}
+			results = append(results, saved)
+		} else {
+			if existing == nil || h.db.DeleteRow(ctx, TemplatesTable, existing.ID) != nil {
+				failed++
+				continue
+			}
+			results = append(results, map[string]any{"name": t.Name})
+		}
+		success++
+		if h.logger != nil {
+			h.logger.AuditEventContext(r.Context(), AuditPrivilegedMutation,
+				"action", "template."+req.Op,
+				"actor", identity.CallerID,
+				"target", t.Name,
+				"timestamp", time.Now().UTC().Format(time.RFC3339),
+			)
+		}
+		h.audit.Record(ctx, AuditEntry{
+			Event:      AuditPrivilegedMutation,
+			Actor:      identity.CallerID,
+			Action:     "template." + req.Op,
+			Collection: t.Collection,
+			RecordID:   t.Name,
+			RequestID:  requestID(w),
+		})
+	}
+
+	meta := map[string]any{"success": success, "failed": failed}
+	WriteSuccessFull(w, http.StatusOK, "Templates updated successfully", results, meta, nil)
+}
+
+// save inserts t, or updates existing when a template with its name is
+// already stored.
+func (h *AdminTemplateHandler) save(ctx context.Context, t DocumentTemplate, existing *DocumentTemplate) (DocumentTemplate, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	t.UpdatedAt = now
+	if existing != nil {
+		t.ID, t.CreatedAt = existing.ID, existing.CreatedAt
+		return t, h.db.UpdateRow(ctx, TemplatesTable, t.ID, map[string]any{
+			"collection": t.Collection,
+			"format":     t.Format,
+			"body":       t.Body,
+			"updated_at": now,
+		})
+	}
+	t.ID, t.CreatedAt = GenerateULID(), now
+	return t, h.db.InsertRow(ctx, TemplatesTable, map[string]any{
+		"id":         t.ID,
+		"name":       t.Name,
+		"collection": t.Collection,
+		"format":     t.Format,
+		"body":       t.Body,
+		"created_at": now,
+		"updated_at": now,
+	})
+}
+
+// validateTemplate checks the template name and, for op=set, its
+// collection, format, and body. The body must parse.
+func (h *AdminTemplateHandler) validateTemplate(t DocumentTemplate, full bool) error {
+	if t.Name == "" {
+		return fmt.Errorf("Missing required field: data.name")
+	}
+	if !namePattern.MatchString(t.Name) || len(t.Name) > MaxCollectionNameLen {
+		return fmt.Errorf("Invalid template name '%s': must be lowercase snake_case", t.Name)
+	}
+	if !full {
+		return nil
+	}
+	col, ok := h.registry.Get(t.Collection)
+	if !ok {
+		return fmt.Errorf("Collection '%s' not found", t.Collection)
+	}
+	if col.System {
+		return fmt.Errorf("Templates are not supported for '%s'", t.Collection)
+	}
+	if !stringInSlice(t.Format, TemplateFormats) {
+		return fmt.Errorf("Invalid format: must be html or markdown")
+	}
+	if t.Body == "" {
+		return fmt.Errorf("Missing required field: data.body")
+	}
+	if len(t.Body) > MaxTemplateBytes {
+		return fmt.Errorf("Template body exceeds %d bytes", MaxTemplateBytes)
+	}
+	if _, err := t.parse(); err != nil {
+		return fmt.Errorf("Invalid template body: %v", err)
+	}
+	return nil
+}
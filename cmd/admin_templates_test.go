@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// setupTemplateTest returns the products fixture from setupResourceQueryTest
+// with the moon_templates table created.
+func setupTemplateTest(t *testing.T) (*SQLiteAdapter, *SchemaRegistry) {
+	t.Helper()
+	_, adapter, registry := setupResourceQueryTest(t)
+	if err := adapter.ExecDDL(context.Background(), ddlTemplatesTable); err != nil {
+		t.Fatalf("ExecDDL templates: %v", err)
+	}
+	return adapter, registry
+}
+
+func doAdminTemplateMutate(t *testing.T, h *AdminTemplateHandler, body any, identity *AuthIdentity) *httptest.ResponseRecorder {
+	t.Helper()
+	b, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, "/admin:templates", strings.NewReader(string(b)))
+	req = req.WithContext(SetAuthIdentity(req.Context(), identity))
+	w := httptest.NewRecorder()
+	h.HandleMutate(w, req)
+	return w
+}
+
+func TestAdminTemplates_SetQueryDestroy(t *testing.T) {
+	adapter, registry := setupTemplateTest(t)
+	h := NewAdminTemplateHandler(adapter, registry, nil)
+
+	tmpl := map[string]any{"name": "receipt", "collection": "products", "format": "markdown", "body": "# {{.Record.title}}"}
+	w := doAdminTemplateMutate(t, h, map[string]any{"op": "set", "data": []any{tmpl}}, adminIdentity())
+	if w.Code != http.StatusOK {
+		t.Fatalf("set: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	tmpl["body"] = "## {{.Record.title}}"
+	doAdminTemplateMutate(t, h, map[string]any{"op": "set", "data": []any{tmpl}}, adminIdentity())
+
+	req := httptest.NewRequest(http.MethodGet, "/admin:templates?collection=products", nil)
+	req = req.WithContext(SetAuthIdentity(req.Context(), adminIdentity()))
+	w = httptest.NewRecorder()
+	h.HandleQuery(w, req)
+	data := decodeResponse(t, w)["data"].([]any)
+	if len(data) != 1 || data[0].(map[string]any)["body"] != "## {{.Record.title}}" {
+		t.Fatalf("expected set to replace the template, got %v", data)
+	}
+
+	destroy := map[string]any{"op": "destroy", "data": []any{map[string]any{"name": "receipt"}}}
+	w = doAdminTemplateMutate(t, h, destroy, adminIdentity())
+	if meta := decodeResponse(t, w)["meta"].(map[string]any); meta["success"] != float64(1) {
+		t.Fatalf("expected destroy to succeed, meta %v", meta)
+	}
+	w = doAdminTemplateMutate(t, h, destroy, adminIdentity())
+	if meta := decodeResponse(t, w)["meta"].(map[string]any); meta["failed"] != float64(1) {
+		t.Errorf("expected missing template to fail, meta %v", meta)
+	}
+}
+
+func TestAdminTemplates_Validation(t *testing.T) {
+	adapter, registry := setupTemplateTest(t)
+	h := NewAdminTemplateHandler(adapter, registry, nil)
+
+	valid := func() map[string]any {
+		return map[string]any{"name": "invoice", "collection": "products", "format": "html", "body": "<p>{{.Record.title}}</p>"}
+	}
+	tests := []struct {
+		name  string
+		field string
+		value any
+	}{
+		{"missing name", "name", ""},
+		{"invalid name", "name", "Invoice-1"},
+		{"unknown collection", "collection", "missing"},
+		{"system collection", "collection", "users"},
+		{"unknown format", "format", "pdf"},
+		{"empty body", "body", ""},
+		{"unparsable body", "body", "{{.Record.title"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := valid()
+			item[tt.field] = tt.value
+			w := doAdminTemplateMutate(t, h, map[string]any{"op": "set", "data": []any{item}}, adminIdentity())
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+
+	w := doAdminTemplateMutate(t, h, map[string]any{"op": "set", "data": []any{valid()}}, userWriteIdentity())
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a non-admin, got %d", w.Code)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"time"
+)
+
+// apiKeyExpired reports whether the apikeys row has an expires_at at or
+// before now. Keys without expires_at never expire; an unparsable value
+// counts as expired.
+func apiKeyExpired(row map[string]any, now time.Time) bool {
+	s := stringVal(row, "expires_at")
+	if s == "" {
+		return false
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	return err != nil || !now.Before(t)
+}
+
+// expiredAPIKeyFilters selects apikeys rows that have expired by now.
+// expires_at is stored in UTC RFC 3339 form, so it compares as a string.
+func expiredAPIKeyFilters(now time.Time) []Filter {
+	return []Filter{
+		{Field: "expires_at", Op: "not_null"},
+		{Field: "expires_at", Op: "lte", Value: now.UTC().Format(time.RFC3339)},
+	}
+}
+
+// reportExpiringKey logs an api_key.expiring audit event when the key in
+// row expires within APIKeyExpiryWarnHours of now, so operators can rotate
+// it in time. Each key is reported once per expiry and process; the check
+// runs when the key authenticates, so unused keys are not reported.
+func (m *AuthMiddleware) reportExpiringKey(row map[string]any, now time.Time) {
+	expiresAt := stringVal(row, "expires_at")
+	if m.logger == nil || expiresAt == "" {
+		return
+	}
+	t, err := time.Parse(time.RFC3339, expiresAt)
+	if err != nil || t.Sub(now) > APIKeyExpiryWarnHours*time.Hour {
+		return
+	}
+	id := stringVal(row, "id")
+	if prev, loaded := m.expiring.Swap(id, expiresAt); loaded && prev == expiresAt {
+		return
+	}
+	m.logger.AuditEvent(AuditAPIKeyExpiring,
+		"target", id,
+		"name", stringVal(row, "name"),
+		"expires_at", expiresAt,
+	)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIKeyExpired(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		expiresAt any
+		want      bool
+	}{
+		{"no expiry", nil, false},
+		{"future", "2026-06-01T12:00:01Z", false},
+		{"exactly now", "2026-06-01T12:00:00Z", true},
+		{"past", "2026-05-31T00:00:00Z", true},
+		{"unparsable", "soon", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := apiKeyExpired(map[string]any{"expires_at": tt.expiresAt}, now); got != tt.want {
+				t.Errorf("apiKeyExpired(%v) = %v, want %v", tt.expiresAt, got, tt.want)
+			}
+		})
+	}
+}
+
+func insertExpiryTestKey(t *testing.T, db DatabaseAdapter, name string, expiresAt any) string {
+	t.Helper()
+	id := GenerateULID()
+	now := time.Now().UTC().Format(time.RFC3339)
+	if err := db.InsertRow(context.Background(), "apikeys", map[string]any{
+		"id": id, "name": name, "role": "user", "key_hash": "hash-" + name,
+		"enabled": boolToInt(true), "expires_at": expiresAt,
+		"created_at": now, "updated_at": now,
+	}); err != nil {
+		t.Fatalf("insert %s: %v", name, err)
+	}
+	return id
+}
+
+func TestReportExpiringKey(t *testing.T) {
+	var buf bytes.Buffer
+	am := NewAuthMiddleware(nil, testJWTSecret(), "", NewJTIRevocationStore())
+	am.SetLogger(NewTestLogger(&buf))
+	now := time.Now().UTC()
+	at := func(d time.Duration) string { return now.Add(d).Format(time.RFC3339) }
+
+	rows := []map[string]any{
+		{"id": "k1", "name": "soon", "expires_at": at(24 * time.Hour)},
+		{"id": "k1", "name": "soon", "expires_at": at(24 * time.Hour)},
+		{"id": "k2", "name": "later", "expires_at": at(30 * 24 * time.Hour)},
+		{"id": "k3", "name": "forever"},
+	}
+	for _, row := range rows {
+		am.reportExpiringKey(row, now)
+	}
+	if n := strings.Count(buf.String(), AuditAPIKeyExpiring); n != 1 {
+		t.Fatalf("expected one %s event, got %d: %s", AuditAPIKeyExpiring, n, buf.String())
+	}
+
+	// A new expiry, as set by a rotation, is reported again.
+	am.reportExpiringKey(map[string]any{"id": "k1", "name": "soon", "expires_at": at(48 * time.Hour)}, now)
+	if n := strings.Count(buf.String(), AuditAPIKeyExpiring); n != 2 {
+		t.Fatalf("expected a second %s event, got %d", AuditAPIKeyExpiring, n)
+	}
+}
+
+func TestAPIKeyExpiry_MutateAndQuery(t *testing.T) {
+	handler, adapter, registry := setupMutateTest(t)
+	admin := adminIdentity()
+
+	create := func(expiresAt any) *httptest.ResponseRecorder {
+		body := map[string]any{"op": "create", "data": []any{map[string]any{
+			"name": "svc-" + GenerateULID(), "role": "user", "collections": []any{"products"},
+			"is_website": false, "expires_at": expiresAt,
+		}}}
+		return doMutateRequest(t, handler, "apikeys", body, admin)
+	}
+	for _, bad := range []any{"2020-01-01T00:00:00Z", "tomorrow", float64(1)} {
+		if w := create(bad); w.Code != http.StatusBadRequest {
+			t.Errorf("expires_at %v: expected 400, got %d", bad, w.Code)
+		}
+	}
+	future := time.Now().Add(48 * time.Hour).In(time.FixedZone("UTC+2", 2*3600)).Format(time.RFC3339)
+	w := create(future)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	got := parseResponse(t, w)["data"].([]any)[0].(map[string]any)["expires_at"].(string)
+	if !strings.HasSuffix(got, "Z") {
+		t.Errorf("expected expires_at in UTC, got %q", got)
+	}
+
+	expiredID := insertExpiryTestKey(t, adapter, "old", time.Now().Add(-time.Hour).UTC().Format(time.RFC3339))
+
+	qh := NewResourceQueryHandler(adapter, registry, &AppConfig{})
+	rec := httptest.NewRecorder()
+	qh.HandleQuery(rec, makeQueryRequest("/data/apikeys:query?expired=true"))
+	data := parseResponse(t, rec)["data"].([]any)
+	if len(data) != 1 || data[0].(map[string]any)["id"] != expiredID {
+		t.Fatalf("expected only the expired key, got %v", data)
+	}
+
+	rec = httptest.NewRecorder()
+	qh.HandleQuery(rec, makeQueryRequest("/data/apikeys:query?expired=yes"))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for expired=yes, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	qh.HandleQuery(rec, makeQueryRequest("/data/products:query?expired=true"))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for expired on products, got %d", rec.Code)
+	}
+}
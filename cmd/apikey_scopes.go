@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// scopePattern matches an API key scope: a collection name or *, a colon,
+// and an operation or *.
+var scopePattern = regexp.MustCompile(`^(\*|[a-z][a-z0-9_]*):(\*|read|write|create|update|destroy)$`)
+
+// scopeOperations maps a scope operation to the data route operations,
+// as returned by dataRouteOperation, that it grants.
+var scopeOperations = map[string][]string{
+	"read":    {"list", "read"},
+	"write":   {"create", "update", "destroy"},
+	"create":  {"create"},
+	"update":  {"update"},
+	"destroy": {"destroy"},
+}
+
+// validateScopes checks an API key scopes value: null, which leaves the key
+// unrestricted beyond its collections, or an array of scopes such as
+// "products:read" or "orders:*".
+func validateScopes(value any) ([]string, error) {
+	scopes, err := validateStringArrayField("scopes", value, false)
+	if err != nil || scopes == nil {
+		return nil, err
+	}
+	for _, s := range scopes {
+		if !scopePattern.MatchString(s) {
+			return nil, fmt.Errorf("Invalid scope '%s': must be collection:operation with operation read, write, create, update, destroy, or *", s)
+		}
+	}
+	return scopes, nil
+}
+
+// scopeAllows reports whether scopes grant op on resource. Nil scopes grant
+// everything. An empty op, for a request whose operation is unknown, is
+// only granted by a * operation.
+func scopeAllows(scopes []string, resource, op string) bool {
+	if scopes == nil {
+		return true
+	}
+	for _, s := range scopes {
+		collection, scopeOp, _ := strings.Cut(s, ":")
+		if collection != "*" && collection != resource {
+			continue
+		}
+		if scopeOp == "*" || (op != "" && stringInSlice(op, scopeOperations[scopeOp])) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestValidateScopes(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   any
+		wantErr bool
+	}{
+		{"null", nil, false},
+		{"empty", []any{}, false},
+		{"valid", []any{"products:read", "orders:*", "*:write", "logs:destroy"}, false},
+		{"no operation", []any{"products"}, true},
+		{"unknown operation", []any{"products:list"}, true},
+		{"bad collection", []any{"Products:read"}, true},
+		{"not strings", []any{1}, true},
+		{"not an array", "products:read", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := validateScopes(tt.value); (err != nil) != tt.wantErr {
+				t.Errorf("validateScopes(%v) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScopeAllows(t *testing.T) {
+	scopes := []string{"products:read", "orders:*", "*:create"}
+	tests := []struct {
+		resource, op string
+		want         bool
+	}{
+		{"products", "list", true},
+		{"products", "read", true},
+		{"products", "update", false},
+		{"products", "create", true},
+		{"orders", "destroy", true},
+		{"orders", "", true},
+		{"products", "", false},
+		{"invoices", "list", false},
+	}
+	for _, tt := range tests {
+		if got := scopeAllows(scopes, tt.resource, tt.op); got != tt.want {
+			t.Errorf("scopeAllows(%s, %q) = %v, want %v", tt.resource, tt.op, got, tt.want)
+		}
+	}
+	if !scopeAllows(nil, "anything", "destroy") {
+		t.Error("expected nil scopes to allow everything")
+	}
+	if scopeAllows([]string{}, "products", "list") {
+		t.Error("expected empty scopes to allow nothing")
+	}
+}
+
+func TestMutate_APIKeyScopes(t *testing.T) {
+	handler, _, _ := setupMutateTest(t)
+	body := func(scopes any) map[string]any {
+		return map[string]any{"op": "create", "data": []any{map[string]any{
+			"name": "scoped-" + GenerateULID(), "role": "user", "collections": []any{"products"},
+			"is_website": false, "scopes": scopes,
+		}}}
+	}
+
+	w := doMutateRequest(t, handler, "apikeys", body([]any{"products:read"}), adminIdentity())
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	scopes, _ := parseResponse(t, w)["data"].([]any)[0].(map[string]any)["scopes"].([]any)
+	if len(scopes) != 1 || scopes[0] != "products:read" {
+		t.Fatalf("expected scopes [products:read], got %v", scopes)
+	}
+
+	w = doMutateRequest(t, handler, "apikeys", body([]any{"products:list"}), adminIdentity())
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid scope, got %d", w.Code)
+	}
+}
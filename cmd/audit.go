@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// AuditLog persists admin actions and record mutations to AuditTable so
+// they can be listed through /admin:audit. It complements, and does not
+// replace, the audit events written to the shared logger. A nil *AuditLog
+// records nothing.
+type AuditLog struct {
+	db     DatabaseAdapter
+	logger *Logger
+}
+
+// NewAuditLog creates an AuditLog backed by db. logger may be nil.
+func NewAuditLog(db DatabaseAdapter, logger *Logger) *AuditLog {
+	return &AuditLog{db: db, logger: logger}
+}
+
+// AuditEntry is one row of the audit table.
+type AuditEntry struct {
+	Event      string // AuditDataMutation or AuditPrivilegedMutation
+	Actor      string
+	Action     string // e.g. "create", "template.set"
+	Collection string
+	RecordID   string
+	Changes    map[string]AuditChange
+	RequestID  string
+}
+
+// AuditChange holds the value of one field before and after a change.
+// Before is nil for created records and After is nil for destroyed ones.
+type AuditChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// Record stores e. A failed write is logged and otherwise ignored, so
+// auditing never fails the request that caused it.
+func (a *AuditLog) Record(ctx context.Context, e AuditEntry) {
+	if a == nil {
+		return
+	}
+	changes, err := json.Marshal(e.Changes)
+	if err != nil || e.Changes == nil {
+		changes = []byte("{}")
+	}
+	// A write that committed is audited even if its client has gone.
+	ctx = context.WithoutCancel(ctx)
+	// ulid.Make is monotonic within the process, so entries written in the
+	// same millisecond still list in the order they were recorded.
+	err = a.db.InsertRow(ctx, AuditTable, map[string]any{
+		"id":         ulid.Make().String(),
+		"event":      e.Event,
+		"actor":      e.Actor,
+		"action":     e.Action,
+		"collection": e.Collection,
+		"record_id":  e.RecordID,
+		"changes":    string(changes),
+		"request_id": e.RequestID,
+		"created_at": time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil && a.logger != nil {
+		a.logger.WarnContext(ctx, "audit entry not stored", "action", e.Action, "collection", e.Collection, "error", err.Error())
+	}
+}
+
+// auditDiff returns the fields whose values differ between before and
+// after. Either record may be nil. Values of sensitive keys are redacted.
+func auditDiff(before, after map[string]any) map[string]AuditChange {
+	changes := make(map[string]AuditChange)
+	for field, b := range before {
+		a, ok := after[field]
+		if !ok || !reflect.DeepEqual(a, b) {
+			changes[field] = auditChange(field, b, a)
+		}
+	}
+	for field, a := range after {
+		if _, ok := before[field]; !ok {
+			changes[field] = auditChange(field, nil, a)
+		}
+	}
+	return changes
+}
+
+func auditChange(field string, before, after any) AuditChange {
+	if isSensitiveKey(field) || field == "key" {
+		if before != nil {
+			before = RedactedPlaceholder
+		}
+		if after != nil {
+			after = RedactedPlaceholder
+		}
+	}
+	return AuditChange{Before: before, After: after}
+}
+
+// requestID returns the X-Request-ID set on w by requestIDMiddleware.
+func requestID(w http.ResponseWriter) string {
+	return w.Header().Get(RequestIDHeader)
+}
+
+// ---------------------------------------------------------------------------
+// GET /admin:audit
+// ---------------------------------------------------------------------------
+
+// AdminAuditHandler implements GET /admin:audit.
+type AdminAuditHandler struct {
+	db     DatabaseAdapter
+	prefix string
+}
+
+// NewAdminAuditHandler creates an AdminAuditHandler.
+func NewAdminAuditHandler(db DatabaseAdapter, prefix string) *AdminAuditHandler {
+	return &AdminAuditHandler{db: db, prefix: prefix}
+}
+
+// auditFilterParams lists the columns /admin:audit filters on by equality.
+var auditFilterParams = []string{"event", "actor", "action", "collection", "record_id"}
+
+// HandleQuery lists audit entries by cursor, oldest first. Entries can be
+// filtered by event, actor, action, collection, record_id, and a since and
+// until time range.
+func (h *AdminAuditHandler) HandleQuery(w http.ResponseWriter, r *http.Request) {
+	identity, ok := GetAuthIdentity(r.Context())
+	if !ok || identity.Role != "admin" {
+		WriteError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	q := r.URL.Query()
+	if q.Has("after") && q.Has("before") {
+		WriteError(w, http.StatusBadRequest, "Parameters after and before are mutually exclusive")
+		return
+	}
+	filters, err := auditFilters(q)
+	if err != nil {
+		WriteErrorFrom(w, http.StatusBadRequest, err)
+		return
+	}
+	_, perPage := parsePagination(r)
+
+	rows, prev, next, err := queryCursorPage(r.Context(), h.db, AuditTable, q, QueryOptions{Filters: filters, PerPage: perPage})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	data := make([]any, 0, len(rows))
+	for _, row := range rows {
+		data = append(data, auditEntryFromRow(row))
+	}
+
+	meta, links := buildCursorPagination(h.prefix+"/admin:audit", q, len(data), perPage, prev, next)
+	WriteSuccessFull(w, http.StatusOK, "Audit entries retrieved successfully", data, meta, links)
+}
+
+// auditFilters builds the query filters for the /admin:audit parameters.
+func auditFilters(q url.Values) ([]Filter, error) {
+	var filters []Filter
+	for _, key := range auditFilterParams {
+		if v := q.Get(key); v != "" {
+			filters = append(filters, Filter{Field: key, Op: "eq", Value: v})
+		}
+	}
+	for key, op := range map[string]string{"since": "gte", "until": "lte"} {
+		v := q.Get(key)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("Parameter %s must be an RFC 3339 timestamp", key)
+		}
+		filters = append(filters, Filter{Field: "created_at", Op: op, Value: t.UTC().Format(time.RFC3339)})
+	}
+	return filters, nil
+}
+
+// auditEntryFromRow converts an audit table row to its API form.
+func auditEntryFromRow(row map[string]any) map[string]any {
+	var raw []byte
+	switch v := row["changes"].(type) {
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	}
+	var changes map[string]any
+	_ = json.Unmarshal(raw, &changes)
+	if changes == nil {
+		changes = map[string]any{}
+	}
+	return map[string]any{
+		"id":         stringVal(row, "id"),
+		"event":      stringVal(row, "event"),
+		"actor":      stringVal(row, "actor"),
+		"action":     stringVal(row, "action"),
+		"collection": stringVal(row, "collection"),
+		"record_id":  stringVal(row, "record_id"),
+		"changes":    changes,
+		"request_id": stringVal(row, "request_id"),
+		"created_at": stringVal(row, "created_at"),
+	}
+}
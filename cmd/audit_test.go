@@ -0,0 +1,130 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func doAuditQuery(t *testing.T, h *AdminAuditHandler, target string, identity *AuthIdentity) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if identity != nil {
+		req = req.WithContext(SetAuthIdentity(req.Context(), identity))
+	}
+	w := httptest.NewRecorder()
+	h.HandleQuery(w, req)
+	return w
+}
+
+func TestAuditDiff(t *testing.T) {
+	changes := auditDiff(
+		map[string]any{"title": "Old", "price": "1.00", "password": "a"},
+		map[string]any{"title": "New", "price": "1.00", "password": "b", "key": "moon_live_x"},
+	)
+	if len(changes) != 3 {
+		t.Fatalf("expected 3 changes, got %v", changes)
+	}
+	if c := changes["title"]; c.Before != "Old" || c.After != "New" {
+		t.Fatalf("unexpected title change %+v", c)
+	}
+	if c := changes["password"]; c.Before != RedactedPlaceholder || c.After != RedactedPlaceholder {
+		t.Fatalf("expected redacted password, got %+v", c)
+	}
+	if c := changes["key"]; c.Before != nil || c.After != RedactedPlaceholder {
+		t.Fatalf("expected redacted key, got %+v", c)
+	}
+}
+
+func TestAudit_RecordsMutationsAndLists(t *testing.T) {
+	handler, adapter, _ := setupMutateTest(t)
+	handler.SetAuditLog(NewAuditLog(adapter, nil))
+	audit := NewAdminAuditHandler(adapter, "")
+
+	w := doMutateRequest(t, handler, "products", map[string]any{
+		"op":   "create",
+		"data": []any{map[string]any{"title": "Mouse", "price": "9.99"}},
+	}, userWriteIdentity())
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	id := decodeResponse(t, w)["data"].([]any)[0].(map[string]any)["id"].(string)
+
+	w = doMutateRequest(t, handler, "products", map[string]any{
+		"op":   "update",
+		"data": []any{map[string]any{"id": id, "title": "Trackball"}},
+	}, userWriteIdentity())
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	w = doMutateRequest(t, handler, "products", map[string]any{
+		"op":   "destroy",
+		"data": []any{map[string]any{"id": id}},
+	}, adminIdentity())
+	if w.Code != http.StatusOK {
+		t.Fatalf("destroy: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = doAuditQuery(t, audit, "/admin:audit?collection=products&record_id="+id, adminIdentity())
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	data := decodeResponse(t, w)["data"].([]any)
+	if len(data) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(data))
+	}
+	for i, action := range []string{"create", "update", "destroy"} {
+		entry := data[i].(map[string]any)
+		if entry["action"] != action || entry["event"] != AuditDataMutation {
+			t.Fatalf("entry %d: unexpected %v", i, entry)
+		}
+	}
+	update := data[1].(map[string]any)
+	if update["actor"] != "user-id" {
+		t.Fatalf("expected actor user-id, got %v", update["actor"])
+	}
+	title := update["changes"].(map[string]any)["title"].(map[string]any)
+	if title["before"] != "Mouse" || title["after"] != "Trackball" {
+		t.Fatalf("unexpected title change %v", title)
+	}
+	destroy := data[2].(map[string]any)["changes"].(map[string]any)["title"].(map[string]any)
+	if destroy["before"] != "Trackball" || destroy["after"] != nil {
+		t.Fatalf("unexpected destroy change %v", destroy)
+	}
+
+	// Cursor pagination
+	w = doAuditQuery(t, audit, "/admin:audit?per_page=2", adminIdentity())
+	resp := decodeResponse(t, w)
+	meta := resp["meta"].(map[string]any)
+	if len(resp["data"].([]any)) != 2 || meta["next_cursor"] == nil {
+		t.Fatalf("expected first page with next cursor, got %v", resp)
+	}
+	w = doAuditQuery(t, audit, "/admin:audit?per_page=2&after="+meta["next_cursor"].(string), adminIdentity())
+	resp = decodeResponse(t, w)
+	if len(resp["data"].([]any)) != 1 || resp["meta"].(map[string]any)["next_cursor"] != nil {
+		t.Fatalf("expected last page with one entry, got %v", resp)
+	}
+
+	w = doAuditQuery(t, audit, "/admin:audit?actor=nobody", adminIdentity())
+	if n := decodeResponse(t, w)["meta"].(map[string]any)["count"]; n != float64(0) {
+		t.Fatalf("expected no entries for unknown actor, got %v", n)
+	}
+}
+
+func TestAdminAudit_Validation(t *testing.T) {
+	_, adapter, _ := setupMutateTest(t)
+	audit := NewAdminAuditHandler(adapter, "")
+
+	if w := doAuditQuery(t, audit, "/admin:audit", userWriteIdentity()); w.Code != http.StatusForbidden {
+		t.Fatalf("non-admin: expected 403, got %d", w.Code)
+	}
+	if w := doAuditQuery(t, audit, "/admin:audit?since=yesterday", adminIdentity()); w.Code != http.StatusBadRequest {
+		t.Fatalf("bad since: expected 400, got %d", w.Code)
+	}
+	if w := doAuditQuery(t, audit, "/admin:audit?after=a&before=b", adminIdentity()); w.Code != http.StatusBadRequest {
+		t.Fatalf("after and before: expected 400, got %d", w.Code)
+	}
+	if w := doAuditQuery(t, audit, "/admin:audit?since=2020-01-01T00:00:00Z", adminIdentity()); w.Code != http.StatusOK {
+		t.Fatalf("valid since: expected 200, got %d", w.Code)
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// AuthTwoFactorHandler implements GET /auth:2fa and POST /auth:2fa, which
+// let a signed-in user enable and disable TOTP two-factor authentication.
+// Enrollment state lives in the internal moon_auth_totp table, keyed by
+// user id; once enabled, op=login on /auth:session also requires a TOTP or
+// recovery code.
+type AuthTwoFactorHandler struct {
+	db     DatabaseAdapter
+	cfg    *AppConfig
+	logger *Logger
+}
+
+// NewAuthTwoFactorHandler creates an AuthTwoFactorHandler. logger may be nil.
+func NewAuthTwoFactorHandler(db DatabaseAdapter, cfg *AppConfig, logger *Logger) *AuthTwoFactorHandler {
+	return &AuthTwoFactorHandler{db: db, cfg: cfg, logger: logger}
+}
+
+// HandleQuery reports whether the caller has two-factor authentication
+// enabled and how many recovery codes remain.
+func (h *AuthTwoFactorHandler) HandleQuery(w http.ResponseWriter, r *http.Request) {
+	identity, ok := GetAuthIdentity(r.Context())
+	if !ok || identity.CredentialType != CredentialTypeJWT {
+		WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	row, err := loadTOTP(r.Context(), h.db, identity.UserID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	status := map[string]any{"enabled": totpEnabled(row), "recovery_codes_remaining": 0}
+	if totpEnabled(row) {
+		status["enabled_at"] = row["enabled_at"]
+		status["recovery_codes_remaining"] = len(recoveryHashes(row))
+	}
+	WriteSuccess(w, http.StatusOK, "Two-factor status retrieved successfully", []any{status})
+}
+
+// HandleMutate applies op=setup, op=verify, or op=disable.
+func (h *AuthTwoFactorHandler) HandleMutate(w http.ResponseWriter, r *http.Request) {
+	identity, ok := GetAuthIdentity(r.Context())
+	if !ok || identity.CredentialType != CredentialTypeJWT {
+		WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req authSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	ctx := r.Context()
+	row, err := loadTOTP(ctx, h.db, identity.UserID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	switch req.Op {
+	case "setup":
+		h.setup(ctx, w, identity, row)
+	case "verify":
+		h.verify(ctx, w, identity, row, req.Data)
+	case "disable":
+		h.disable(ctx, w, identity, row, req.Data)
+	default:
+		WriteError(w, http.StatusBadRequest, "Invalid op: must be setup, verify, or disable")
+	}
+}
+
+// setup stores a new pending secret, replacing any earlier pending one, and
+// returns it with its provisioning URI. It is not enforced until verified.
+func (h *AuthTwoFactorHandler) setup(ctx context.Context, w http.ResponseWriter, identity *AuthIdentity, row map[string]any) {
+	if totpEnabled(row) {
+		WriteError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+	users, _, err := h.db.QueryRows(ctx, "users", QueryOptions{
+		Filters: []Filter{{Field: "id", Op: "eq", Value: identity.UserID}},
+		Page:    1,
+		PerPage: 1,
+	})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if len(users) == 0 {
+		WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	sealed, err := sealSecret(h.cfg.JWTSecret, "totp", secret)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if row != nil {
+		if err := h.db.DeleteRow(ctx, "moon_auth_totp", identity.UserID); err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	if err := h.db.InsertRow(ctx, "moon_auth_totp", map[string]any{
+		"id":         identity.UserID,
+		"secret":     sealed,
+		"created_at": now,
+		"updated_at": now,
+	}); err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	WriteSuccess(w, http.StatusOK, "Two-factor setup started", []any{map[string]any{
+		"secret": totpEncoding.EncodeToString(secret),
+		"uri":    totpURI(stringVal(users[0], "username"), secret),
+	}})
+}
+
+// verify enables a pending secret once the caller proves their
+// authenticator produces its codes, and issues the recovery codes.
+func (h *AuthTwoFactorHandler) verify(ctx context.Context, w http.ResponseWriter, identity *AuthIdentity, row, data map[string]any) {
+	if row == nil || totpEnabled(row) {
+		WriteError(w, http.StatusBadRequest, "No two-factor setup is pending")
+		return
+	}
+	code, _ := data["totp_code"].(string)
+	if code == "" {
+		WriteError(w, http.StatusBadRequest, "Missing required field: data.totp_code")
+		return
+	}
+	secret, err := openSecret(h.cfg.JWTSecret, "totp", stringVal(row, "secret"))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "No two-factor setup is pending")
+		return
+	}
+	step, ok := verifyTOTP(secret, code, time.Now().UTC(), 0)
+	if !ok {
+		WriteError(w, http.StatusUnauthorized, "Invalid two-factor code")
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	if err := h.db.UpdateRow(ctx, "moon_auth_totp", identity.UserID, map[string]any{
+		"recovery_codes": strings.Join(hashes, ","),
+		"last_step":      step,
+		"enabled_at":     now,
+		"updated_at":     now,
+	}); err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	auditTwoFactor(ctx, h.logger, "enable", identity.CallerID, identity.UserID)
+
+	WriteSuccess(w, http.StatusOK, "Two-factor authentication enabled", []any{map[string]any{
+		"recovery_codes": codes,
+	}})
+}
+
+// disable turns two-factor authentication off. It needs a current TOTP or
+// recovery code so that a stolen access token alone cannot remove it.
+func (h *AuthTwoFactorHandler) disable(ctx context.Context, w http.ResponseWriter, identity *AuthIdentity, row, data map[string]any) {
+	if !totpEnabled(row) {
+		WriteError(w, http.StatusBadRequest, "Two-factor authentication is not enabled")
+		return
+	}
+	code, _ := data["totp_code"].(string)
+	recovery, _ := data["recovery_code"].(string)
+	if code == "" && recovery == "" {
+		WriteError(w, http.StatusBadRequest, "Missing required field: data.totp_code or data.recovery_code")
+		return
+	}
+	ok, err := consumeSecondFactor(ctx, h.db, h.cfg.JWTSecret, row, code, recovery)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if !ok {
+		WriteError(w, http.StatusUnauthorized, "Invalid two-factor code")
+		return
+	}
+	if err := h.db.DeleteRow(ctx, "moon_auth_totp", identity.UserID); err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	auditTwoFactor(ctx, h.logger, "disable", identity.CallerID, identity.UserID)
+
+	WriteMessage(w, http.StatusOK, "Two-factor authentication disabled")
+}
+
+// loadTOTP returns the moon_auth_totp row of userID, or nil when the user
+// has never started two-factor setup.
+func loadTOTP(ctx context.Context, db DatabaseAdapter, userID string) (map[string]any, error) {
+	rows, _, err := db.QueryRows(ctx, "moon_auth_totp", QueryOptions{
+		Filters: []Filter{{Field: "id", Op: "eq", Value: userID}},
+		Page:    1,
+		PerPage: 1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("load totp: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return rows[0], nil
+}
+
+// totpEnabled reports whether row is a verified enrollment. A pending setup
+// is not enforced.
+func totpEnabled(row map[string]any) bool {
+	return row != nil && row["enabled_at"] != nil
+}
+
+// recoveryHashes returns the hashes of row's unused recovery codes.
+func recoveryHashes(row map[string]any) []string {
+	stored := stringVal(row, "recovery_codes")
+	if stored == "" {
+		return nil
+	}
+	return strings.Split(stored, ",")
+}
+
+// consumeSecondFactor checks a TOTP code or, when code is empty, a recovery
+// code against an enabled row and records its use: the TOTP step so that
+// the code cannot be replayed, or the removal of the recovery code. When
+// the stored secret cannot be decrypted, only recovery codes are accepted.
+func consumeSecondFactor(ctx context.Context, db DatabaseAdapter, jwtSecret string, row map[string]any, code, recovery string) (bool, error) {
+	id := stringVal(row, "id")
+	now := time.Now().UTC()
+
+	if code != "" {
+		secret, err := openSecret(jwtSecret, "totp", stringVal(row, "secret"))
+		if errors.Is(err, errSealedValue) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		lastStep, _ := toInt64(row["last_step"])
+		step, ok := verifyTOTP(secret, code, now, lastStep)
+		if !ok {
+			return false, nil
+		}
+		return true, db.UpdateRow(ctx, "moon_auth_totp", id, map[string]any{
+			"last_step":  step,
+			"updated_at": now.Format(time.RFC3339),
+		})
+	}
+
+	hashes := recoveryHashes(row)
+	want := hashRecoveryCode(recovery)
+	for i, hash := range hashes {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(want)) != 1 {
+			continue
+		}
+		remaining := append(hashes[:i:i], hashes[i+1:]...)
+		return true, db.UpdateRow(ctx, "moon_auth_totp", id, map[string]any{
+			"recovery_codes": strings.Join(remaining, ","),
+			"updated_at":     now.Format(time.RFC3339),
+		})
+	}
+	return false, nil
+}
+
+// auditTwoFactor records two-factor authentication being enabled or
+// disabled for userID. The secret and codes are never logged.
+func auditTwoFactor(ctx context.Context, logger *Logger, op, actor, userID string) {
+	if logger == nil {
+		return
+	}
+	logger.AuditEventContext(ctx, AuditTwoFactorChange,
+		"action", "two_factor."+op,
+		"actor", actor,
+		"target", userID,
+		"timestamp", time.Now().UTC().Format(time.RFC3339),
+	)
+}
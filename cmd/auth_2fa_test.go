@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const authTwoFactorTestUser = "01TESTUSER000000000000001"
+
+func doTwoFactorRequest(t *testing.T, h *AuthTwoFactorHandler, method string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+	}
+	req := reqWithJWT(method, "/auth:2fa", payload, authTwoFactorTestUser, "admin", true)
+	identity, _ := GetAuthIdentity(req.Context())
+	identity.UserID = authTwoFactorTestUser
+	w := httptest.NewRecorder()
+	if method == http.MethodGet {
+		h.HandleQuery(w, req)
+	} else {
+		h.HandleMutate(w, req)
+	}
+	return w
+}
+
+// enableTwoFactor runs setup and verify for the setupAuthTest user and
+// returns the secret and recovery codes.
+func enableTwoFactor(t *testing.T, h *AuthTwoFactorHandler) ([]byte, []any) {
+	t.Helper()
+	w := doTwoFactorRequest(t, h, http.MethodPost, map[string]any{"op": "setup"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("setup: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	setup := decodeResponse(t, w)["data"].([]any)[0].(map[string]any)
+	secret, err := totpEncoding.DecodeString(setup["secret"].(string))
+	if err != nil {
+		t.Fatalf("decode secret: %v", err)
+	}
+
+	code := totpCode(secret, totpStep(time.Now()))
+	w = doTwoFactorRequest(t, h, http.MethodPost, map[string]any{"op": "verify", "data": map[string]any{"totp_code": code}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("verify: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	codes := decodeResponse(t, w)["data"].([]any)[0].(map[string]any)["recovery_codes"].([]any)
+	return secret, codes
+}
+
+func TestAuthTwoFactor_Login(t *testing.T) {
+	auth, db := setupAuthTest(t)
+	h := NewAuthTwoFactorHandler(db, auth.cfg, nil)
+
+	// A pending setup is not enforced.
+	doTwoFactorRequest(t, h, http.MethodPost, map[string]any{"op": "setup"})
+	login := map[string]any{"username": "testuser", "password": "TestPass1"}
+	if w := doAuthRequest(t, auth, map[string]any{"op": "login", "data": login}); w.Code != http.StatusOK {
+		t.Fatalf("expected login without 2FA to succeed, got %d", w.Code)
+	}
+
+	secret, codes := enableTwoFactor(t, h)
+	if len(codes) != TOTPRecoveryCodes {
+		t.Fatalf("expected %d recovery codes, got %d", TOTPRecoveryCodes, len(codes))
+	}
+	if w := doTwoFactorRequest(t, h, http.MethodPost, map[string]any{"op": "setup"}); w.Code != http.StatusConflict {
+		t.Errorf("expected 409 for setup while enabled, got %d", w.Code)
+	}
+
+	loginWith := func(extra map[string]any) int {
+		data := map[string]any{"username": "testuser", "password": "TestPass1"}
+		for k, v := range extra {
+			data[k] = v
+		}
+		return doAuthRequest(t, auth, map[string]any{"op": "login", "data": data}).Code
+	}
+	if code := loginWith(nil); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a code, got %d", code)
+	}
+	if code := loginWith(map[string]any{"totp_code": "000000"}); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a wrong code, got %d", code)
+	}
+
+	// verify used the current step, so the next one is the first valid code.
+	next := totpCode(secret, totpStep(time.Now())+1)
+	if code := loginWith(map[string]any{"totp_code": next}); code != http.StatusOK {
+		t.Errorf("expected 200 with a TOTP code, got %d", code)
+	}
+	if code := loginWith(map[string]any{"totp_code": next}); code != http.StatusUnauthorized {
+		t.Errorf("expected a replayed code to be rejected, got %d", code)
+	}
+
+	recovery := codes[0].(string)
+	if code := loginWith(map[string]any{"recovery_code": recovery}); code != http.StatusOK {
+		t.Errorf("expected 200 with a recovery code, got %d", code)
+	}
+	if code := loginWith(map[string]any{"recovery_code": recovery}); code != http.StatusUnauthorized {
+		t.Errorf("expected a used recovery code to be rejected, got %d", code)
+	}
+
+	status := decodeResponse(t, doTwoFactorRequest(t, h, http.MethodGet, nil))["data"].([]any)[0].(map[string]any)
+	if status["enabled"] != true || status["recovery_codes_remaining"] != float64(TOTPRecoveryCodes-1) {
+		t.Errorf("unexpected status: %v", status)
+	}
+
+	// Disabling needs a valid code; afterwards login needs only the password.
+	if w := doTwoFactorRequest(t, h, http.MethodPost, map[string]any{"op": "disable", "data": map[string]any{"recovery_code": recovery}}); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for disable with a used code, got %d", w.Code)
+	}
+	if w := doTwoFactorRequest(t, h, http.MethodPost, map[string]any{"op": "disable", "data": map[string]any{"recovery_code": codes[1]}}); w.Code != http.StatusOK {
+		t.Fatalf("disable: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if code := loginWith(nil); code != http.StatusOK {
+		t.Errorf("expected login after disable to succeed, got %d", code)
+	}
+}
+
+func TestAuthTwoFactor_Errors(t *testing.T) {
+	auth, db := setupAuthTest(t)
+	h := NewAuthTwoFactorHandler(db, auth.cfg, nil)
+
+	for _, tt := range []struct {
+		body map[string]any
+		want int
+	}{
+		{map[string]any{"op": "enable"}, http.StatusBadRequest},
+		{map[string]any{"op": "verify", "data": map[string]any{"totp_code": "123456"}}, http.StatusBadRequest},
+		{map[string]any{"op": "disable", "data": map[string]any{"totp_code": "123456"}}, http.StatusBadRequest},
+	} {
+		if w := doTwoFactorRequest(t, h, http.MethodPost, tt.body); w.Code != tt.want {
+			t.Errorf("%v: expected %d, got %d", tt.body, tt.want, w.Code)
+		}
+	}
+
+	doTwoFactorRequest(t, h, http.MethodPost, map[string]any{"op": "setup"})
+	if w := doTwoFactorRequest(t, h, http.MethodPost, map[string]any{"op": "verify", "data": map[string]any{"totp_code": "abcdef"}}); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a wrong verify code, got %d", w.Code)
+	}
+
+	req := reqWithAPIKey(http.MethodGet, "/auth:2fa", nil)
+	w := httptest.NewRecorder()
+	h.HandleQuery(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for an API key, got %d", w.Code)
+	}
+}
+
+func TestMutate_Action_DisableTwoFactor(t *testing.T) {
+	handler, adapter, _ := setupMutateTest(t)
+	userID := seedAdminUser(t, adapter)
+	now := time.Now().UTC().Format(time.RFC3339)
+	if err := adapter.InsertRow(context.Background(), "moon_auth_totp", map[string]any{
+		"id":         userID,
+		"secret":     "x",
+		"enabled_at": now,
+		"created_at": now,
+		"updated_at": now,
+	}); err != nil {
+		t.Fatalf("seed totp: %v", err)
+	}
+
+	body := map[string]any{
+		"op":     "action",
+		"action": "disable_2fa",
+		"data":   []any{map[string]any{"id": userID}, map[string]any{"id": "01NOTOTP"}},
+	}
+	w := doMutateRequest(t, handler, "users", body, adminIdentity())
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if meta := decodeResponse(t, w)["meta"].(map[string]any); meta["success"] != float64(1) || meta["failed"] != float64(1) {
+		t.Errorf("unexpected meta: %v", meta)
+	}
+	if row, err := loadTOTP(context.Background(), adapter, userID); err != nil || row != nil {
+		t.Errorf("expected the enrollment to be removed, got %v %v", row, err)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// AuthInvitationHandler implements POST /auth:accept_invite, which sets the
+// password of a user invited with the invite action on users and activates
+// the account. A user is pending while it has a row in the internal
+// moon_auth_invitations table; pending users cannot sign in. Only the
+// SHA-256 hash of each invitation token is kept.
+type AuthInvitationHandler struct {
+	db     DatabaseAdapter
+	cfg    *AppConfig
+	logger *Logger
+}
+
+// NewAuthInvitationHandler creates an AuthInvitationHandler with its
+// dependencies.
+func NewAuthInvitationHandler(db DatabaseAdapter, cfg *AppConfig, logger *Logger) *AuthInvitationHandler {
+	return &AuthInvitationHandler{db: db, cfg: cfg, logger: logger}
+}
+
+// HandleAccept handles POST /auth:accept_invite.
+func (h *AuthInvitationHandler) HandleAccept(w http.ResponseWriter, r *http.Request) {
+	data, ok := decodeResetRequest(w, r)
+	if !ok {
+		return
+	}
+	token, _ := data["token"].(string)
+	if token == "" {
+		WriteError(w, http.StatusBadRequest, "Missing required field: data.token")
+		return
+	}
+	password, _ := data["password"].(string)
+	if password == "" {
+		WriteError(w, http.StatusBadRequest, "Missing required field: data.password")
+		return
+	}
+
+	ctx := r.Context()
+	rows, _, err := h.db.QueryRows(ctx, "moon_auth_invitations", QueryOptions{
+		Filters: []Filter{{Field: "token_hash", Op: "eq", Value: HashRefreshToken(token)}},
+		Page:    1,
+		PerPage: 1,
+	})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if len(rows) == 0 {
+		WriteError(w, http.StatusUnauthorized, "Invalid or expired invitation")
+		return
+	}
+	invitation := rows[0]
+	expiresAt, err := time.Parse(time.RFC3339, stringVal(invitation, "expires_at"))
+	if err != nil || !time.Now().Before(expiresAt) {
+		WriteError(w, http.StatusUnauthorized, "Invalid or expired invitation")
+		return
+	}
+
+	userID := stringVal(invitation, "user_id")
+	user, err := lookupUser(ctx, h.db, "id", userID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if user == nil {
+		WriteError(w, http.StatusUnauthorized, "Invalid or expired invitation")
+		return
+	}
+	// A user disabled while the invitation was pending is refused as login
+	// refuses it, and the invitation is left in place.
+	if !enabledValue(user) {
+		WriteError(w, http.StatusForbidden, "Account is disabled")
+		return
+	}
+	if err := h.cfg.Passwords().Validate(password); err != nil {
+		WriteError(w, http.StatusBadRequest, passwordPolicyViolation(err))
+		return
+	}
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	if err := h.db.UpdateRow(ctx, "users", userID, map[string]any{
+		"password_hash": hash,
+		"updated_at":    now,
+	}); err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if err := deleteInvitations(ctx, h.db, userID); err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	if h.logger != nil {
+		h.logger.AuditEventContext(ctx, AuditInvitationAccepted,
+			"actor", userID,
+			"target", stringVal(user, "username"),
+			"invited_by", stringVal(invitation, "invited_by"),
+			"timestamp", now,
+		)
+	}
+	WriteSuccess(w, http.StatusOK, "Invitation accepted. Sign in with the new password.", []any{})
+}
+
+// errInvitationPending is reported for a sign-in by a user who has not
+// accepted their invitation.
+var errInvitationPending = errors.New("invitation not accepted")
+
+// checkInvitationAccepted returns errInvitationPending when userID has an
+// outstanding invitation.
+func checkInvitationAccepted(ctx context.Context, db DatabaseAdapter, userID string) error {
+	rows, _, err := db.QueryRows(ctx, "moon_auth_invitations", QueryOptions{
+		Filters: []Filter{{Field: "user_id", Op: "eq", Value: userID}},
+		Page:    1,
+		PerPage: 1,
+	})
+	if err != nil {
+		return err
+	}
+	if len(rows) > 0 {
+		return errInvitationPending
+	}
+	return nil
+}
+
+// createInvitation replaces any invitation of userID with a new one and
+// returns its raw token and expiry.
+func createInvitation(ctx context.Context, db DatabaseAdapter, cfg *AppConfig, userID, invitedBy string) (string, string, error) {
+	if err := deleteInvitations(ctx, db, userID); err != nil {
+		return "", "", err
+	}
+	raw, hash, err := GenerateRefreshToken()
+	if err != nil {
+		return "", "", err
+	}
+	now := time.Now().UTC()
+	expiresAt := now.Add(time.Duration(cfg.Invitation.TokenTTL) * time.Second).Format(time.RFC3339)
+	return raw, expiresAt, db.InsertRow(ctx, "moon_auth_invitations", map[string]any{
+		"id":         GenerateULID(),
+		"user_id":    userID,
+		"token_hash": hash,
+		"expires_at": expiresAt,
+		"invited_by": invitedBy,
+		"created_at": now.Format(time.RFC3339),
+	})
+}
+
+// deleteInvitations removes the invitations of userID.
+func deleteInvitations(ctx context.Context, db DatabaseAdapter, userID string) error {
+	rows, _, err := db.QueryRows(ctx, "moon_auth_invitations", QueryOptions{
+		Filters: []Filter{{Field: "user_id", Op: "eq", Value: userID}},
+		Page:    1,
+		PerPage: MaxPerPage,
+	})
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := db.DeleteRow(ctx, "moon_auth_invitations", stringVal(row, "id")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// invitationMessage renders the invitation email for user. With
+// invitation.url set, the email links to it with the token in the token
+// query parameter.
+func invitationMessage(cfg *AppConfig, user map[string]any, token string) (MailMessage, error) {
+	data := InvitationMail{
+		Username:  stringVal(user, "username"),
+		Email:     stringVal(user, "email"),
+		Role:      stringVal(user, "role"),
+		Token:     token,
+		ExpiresIn: (time.Duration(cfg.Invitation.TokenTTL) * time.Second).String(),
+	}
+	if cfg.Invitation.URL != "" {
+		link, _ := url.Parse(cfg.Invitation.URL)
+		q := link.Query()
+		q.Set("token", token)
+		link.RawQuery = q.Encode()
+		data.URL = link.String()
+	}
+	return cfg.Mail.templates().Render(MailTemplateInvitation, data.Email, data)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// failingMailer rejects every message.
+type failingMailer struct{}
+
+func (failingMailer) Send(context.Context, MailMessage) error {
+	return errors.New("smtp unavailable")
+}
+
+func setupInvitationTest(t *testing.T) (*ResourceMutateHandler, *fakeMailer, *SQLiteAdapter) {
+	t.Helper()
+	h, db, _ := setupMutateTest(t)
+	h.cfg.JWTAccessExpiry = 3600
+	h.cfg.JWTRefreshExpiry = 604800
+	h.cfg.Invitation = InvitationConfig{URL: "https://app.example.com/invite", TokenTTL: DefaultInvitationTokenTTL}
+	mailer := &fakeMailer{sent: make(chan MailMessage, 4)}
+	h.SetMailer(mailer)
+	return h, mailer, db
+}
+
+func inviteUsers(t *testing.T, h *ResourceMutateHandler, items ...map[string]any) map[string]any {
+	t.Helper()
+	data := make([]any, len(items))
+	for i, item := range items {
+		data[i] = item
+	}
+	w := doMutateRequest(t, h, "users", map[string]any{"op": "action", "action": "invite", "data": data}, adminIdentity())
+	if w.Code != http.StatusOK {
+		t.Fatalf("invite: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	return decodeResponse(t, w)
+}
+
+func TestUsersAction_Invite(t *testing.T) {
+	h, mailer, db := setupInvitationTest(t)
+	ctx := context.Background()
+
+	body := inviteUsers(t, h, map[string]any{"email": "Ada@Example.com", "role": "user", "can_write": true})
+	user := body["data"].([]any)[0].(map[string]any)
+	if user["username"] != "ada@example.com" || user["role"] != "user" || user["can_write"] != true || user["invitation_expires_at"] == "" {
+		t.Errorf("unexpected result %v", user)
+	}
+	msg := <-mailer.sent
+	if msg.To != "ada@example.com" || !strings.Contains(msg.Body, "https://app.example.com/invite?token=") {
+		t.Fatalf("unexpected email %+v", msg)
+	}
+	token := resetTokenRegex.FindStringSubmatch(msg.Body)[1]
+
+	// The pending user cannot sign in, even with a password set by an admin.
+	id := user["id"].(string)
+	hash, _ := HashPassword("AdminSet1")
+	if err := db.UpdateRow(ctx, "users", id, map[string]any{"password_hash": hash}); err != nil {
+		t.Fatal(err)
+	}
+	sessions := &AuthSessionHandler{db: db, cfg: h.cfg}
+	login := func(password string) int {
+		return doAuthRequest(t, sessions, map[string]any{
+			"op":   "login",
+			"data": map[string]any{"username": "ada@example.com", "password": password},
+		}).Code
+	}
+	if code := login("AdminSet1"); code != http.StatusForbidden {
+		t.Fatalf("expected a pending user to be refused, got %d", code)
+	}
+
+	accept := NewAuthInvitationHandler(db, h.cfg, nil)
+	if w := doResetRequest(t, accept.HandleAccept, "/auth:accept_invite", map[string]any{"token": token, "password": "weak"}); w.Code != http.StatusBadRequest {
+		t.Errorf("expected a weak password to be rejected, got %d", w.Code)
+	}
+	if w := doResetRequest(t, accept.HandleAccept, "/auth:accept_invite", map[string]any{"token": token, "password": "Accepted1"}); w.Code != http.StatusOK {
+		t.Fatalf("accept: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if code := login("Accepted1"); code != http.StatusOK {
+		t.Errorf("expected login after accepting, got %d", code)
+	}
+	if w := doResetRequest(t, accept.HandleAccept, "/auth:accept_invite", map[string]any{"token": token, "password": "Accepted2"}); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected an accepted invitation to be single-use, got %d", w.Code)
+	}
+
+	// An active user cannot be invited again.
+	body = inviteUsers(t, h, map[string]any{"email": "ada@example.com", "role": "user"})
+	if meta := body["meta"].(map[string]any); meta["success"] != float64(0) || meta["failed"] != float64(1) {
+		t.Errorf("expected an active user to fail, got %v", meta)
+	}
+}
+
+func TestUsersAction_InviteResend(t *testing.T) {
+	h, mailer, db := setupInvitationTest(t)
+	inviteUsers(t, h, map[string]any{"email": "bob@example.com", "role": "admin", "username": "bob"})
+	first := resetTokenRegex.FindStringSubmatch((<-mailer.sent).Body)[1]
+	inviteUsers(t, h, map[string]any{"email": "bob@example.com", "role": "admin"})
+	second := resetTokenRegex.FindStringSubmatch((<-mailer.sent).Body)[1]
+
+	accept := NewAuthInvitationHandler(db, h.cfg, nil)
+	if w := doResetRequest(t, accept.HandleAccept, "/auth:accept_invite", map[string]any{"token": first, "password": "Accepted1"}); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected the replaced invitation to be rejected, got %d", w.Code)
+	}
+
+	ctx := context.Background()
+	rows, _, _ := db.QueryRows(ctx, "moon_auth_invitations", QueryOptions{Page: 1, PerPage: 10})
+	if len(rows) != 1 {
+		t.Fatalf("expected 1 invitation, got %d", len(rows))
+	}
+	if err := db.UpdateRow(ctx, "moon_auth_invitations", stringVal(rows[0], "id"), map[string]any{
+		"expires_at": time.Now().Add(-time.Second).UTC().Format(time.RFC3339),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if w := doResetRequest(t, accept.HandleAccept, "/auth:accept_invite", map[string]any{"token": second, "password": "Accepted1"}); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected an expired invitation to be rejected, got %d", w.Code)
+	}
+}
+
+func TestAuthInvitation_AcceptDisabled(t *testing.T) {
+	h, mailer, db := setupInvitationTest(t)
+	ctx := context.Background()
+
+	body := inviteUsers(t, h, map[string]any{"email": "bo@example.com", "role": "user"})
+	id := body["data"].([]any)[0].(map[string]any)["id"].(string)
+	token := resetTokenRegex.FindStringSubmatch((<-mailer.sent).Body)[1]
+	if err := db.UpdateRow(ctx, "users", id, map[string]any{"enabled": false}); err != nil {
+		t.Fatal(err)
+	}
+
+	accept := NewAuthInvitationHandler(db, h.cfg, nil)
+	w := doResetRequest(t, accept.HandleAccept, "/auth:accept_invite", map[string]any{"token": token, "password": "Accepted1"})
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "Account is disabled") {
+		t.Fatalf("expected 403 for a disabled user, got %d: %s", w.Code, w.Body.String())
+	}
+	if err := checkInvitationAccepted(ctx, db, id); !errors.Is(err, errInvitationPending) {
+		t.Errorf("expected the invitation to stay pending, got %v", err)
+	}
+	user, err := lookupUser(ctx, db, "id", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(stringVal(user, "password_hash")), []byte("Accepted1")) == nil {
+		t.Error("expected the password not to be set")
+	}
+}
+
+func TestUsersAction_InviteErrors(t *testing.T) {
+	h, _, db := setupInvitationTest(t)
+	for _, tt := range []struct {
+		item map[string]any
+		want string
+	}{
+		{map[string]any{"role": "user"}, "'email' is required"},
+		{map[string]any{"email": "nope", "role": "user"}, "Invalid email"},
+		{map[string]any{"email": "c@example.com", "role": "owner"}, "'role' must be"},
+	} {
+		w := doMutateRequest(t, h, "users", map[string]any{"op": "action", "action": "invite", "data": []any{tt.item}}, adminIdentity())
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.want) {
+			t.Errorf("expected 400 with %q, got %d: %s", tt.want, w.Code, w.Body.String())
+		}
+	}
+
+	// A failed email undoes the invitation.
+	h.SetMailer(failingMailer{})
+	w := doMutateRequest(t, h, "users", map[string]any{"op": "action", "action": "invite", "data": []any{
+		map[string]any{"email": "c@example.com", "role": "user"},
+	}}, adminIdentity())
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("expected 502, got %d", w.Code)
+	}
+	if user, _ := lookupUser(context.Background(), db, "email", "c@example.com"); user != nil {
+		t.Error("expected the pending user to be removed")
+	}
+
+	h.SetMailer(nil)
+	w = doMutateRequest(t, h, "users", map[string]any{"op": "action", "action": "invite", "data": []any{
+		map[string]any{"email": "c@example.com", "role": "user"},
+	}}, adminIdentity())
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without email, got %d", w.Code)
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// AuthKeysHandler implements GET /auth:keys and POST /auth:keys, which let
+// a signed-in user manage personal API keys. A personal key records its
+// owner in apikeys.user_id and is checked against the owner's current role,
+// can_write, and enabled state on every request (see validateAPIKey).
+type AuthKeysHandler struct {
+	db     DatabaseAdapter
+	logger *Logger
+}
+
+// NewAuthKeysHandler creates an AuthKeysHandler. logger may be nil.
+func NewAuthKeysHandler(db DatabaseAdapter, logger *Logger) *AuthKeysHandler {
+	return &AuthKeysHandler{db: db, logger: logger}
+}
+
+// authKeysMutateRequest is the JSON body for POST /auth:keys.
+type authKeysMutateRequest struct {
+	Op   string           `json:"op"`
+	Data []map[string]any `json:"data"`
+}
+
+// personalKeyFields are the fields accepted by op=create.
+var personalKeyFields = map[string]bool{
+	"name":        true,
+	"collections": true,
+	"can_write":   true,
+}
+
+// HandleQuery lists the caller's personal keys. Admins may pass all=true
+// to list every user's personal keys.
+func (h *AuthKeysHandler) HandleQuery(w http.ResponseWriter, r *http.Request) {
+	identity, ok := GetAuthIdentity(r.Context())
+	if !ok || identity.CredentialType != CredentialTypeJWT {
+		WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	filter := Filter{Field: "user_id", Op: "eq", Value: identity.UserID}
+	switch r.URL.Query().Get("all") {
+	case "", "false":
+	case "true":
+		if identity.Role != "admin" {
+			WriteError(w, http.StatusForbidden, "Forbidden")
+			return
+		}
+		filter = Filter{Field: "user_id", Op: "not_null"}
+	default:
+		WriteError(w, http.StatusBadRequest, "Invalid value for 'all': must be true or false")
+		return
+	}
+
+	ctx := r.Context()
+	data := make([]any, 0)
+	for page := 1; ; page++ {
+		rows, _, err := h.db.QueryRows(ctx, "apikeys", QueryOptions{
+			Filters: []Filter{filter},
+			Sort:    []SortField{{Field: "id"}},
+			Page:    page,
+			PerPage: MaxPerPage,
+		})
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		for _, row := range rows {
+			data = append(data, personalKeyResponse(row))
+		}
+		if len(rows) < MaxPerPage {
+			break
+		}
+	}
+
+	meta := map[string]any{"total": len(data)}
+	WriteSuccessFull(w, http.StatusOK, "API keys retrieved successfully", data, meta, nil)
+}
+
+// HandleMutate creates, rotates, or destroys personal keys. Rotate and
+// destroy items name a key by id; a key owned by someone else counts as
+// failed, except for admins, who may rotate or destroy any personal key.
+func (h *AuthKeysHandler) HandleMutate(w http.ResponseWriter, r *http.Request) {
+	identity, ok := GetAuthIdentity(r.Context())
+	if !ok || identity.CredentialType != CredentialTypeJWT {
+		WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req authKeysMutateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Op != "create" && req.Op != "rotate" && req.Op != "destroy" {
+		WriteError(w, http.StatusBadRequest, "Invalid op: must be create, rotate, or destroy")
+		return
+	}
+	if len(req.Data) == 0 {
+		WriteError(w, http.StatusBadRequest, "Missing required field: data")
+		return
+	}
+
+	ctx := r.Context()
+	user, err := h.lookupUser(ctx, identity.UserID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			WriteError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	if req.Op == "create" {
+		h.create(ctx, w, identity, user, req.Data)
+		return
+	}
+	h.rotateOrDestroy(ctx, w, identity, req.Op, req.Data)
+}
+
+// create validates every item before inserting any key, so a batch with an
+// invalid item creates none.
+func (h *AuthKeysHandler) create(ctx context.Context, w http.ResponseWriter, identity *AuthIdentity, user map[string]any, items []map[string]any) {
+	userCanWrite := stringVal(user, "role") == "admin" || toBool(user["can_write"])
+	type personalKey struct {
+		name        string
+		collections []string
+		canWrite    bool
+	}
+	keys := make([]personalKey, 0, len(items))
+	for _, item := range items {
+		for field := range item {
+			if !personalKeyFields[field] {
+				WriteError(w, http.StatusBadRequest, fmt.Sprintf("Unknown field '%s'", field))
+				return
+			}
+		}
+		name, _ := item["name"].(string)
+		if name == "" {
+			WriteError(w, http.StatusBadRequest, "Field 'name' is required")
+			return
+		}
+		collections, err := validateCollections(item["collections"], true)
+		if err != nil {
+			WriteErrorFrom(w, http.StatusBadRequest, err)
+			return
+		}
+		canWrite := false
+		if value, ok := item["can_write"]; ok {
+			if canWrite, ok = value.(bool); !ok {
+				WriteError(w, http.StatusBadRequest, "Field 'can_write' must be a boolean")
+				return
+			}
+		}
+		if canWrite && !userCanWrite {
+			WriteError(w, http.StatusForbidden, "Field 'can_write' cannot exceed your own access")
+			return
+		}
+		keys = append(keys, personalKey{name: name, collections: collections, canWrite: canWrite})
+	}
+
+	_, total, err := h.db.QueryRows(ctx, "apikeys", QueryOptions{
+		Filters: []Filter{{Field: "user_id", Op: "eq", Value: identity.UserID}},
+		Page:    1,
+		PerPage: 1,
+	})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if total+len(keys) > MaxPersonalAPIKeys {
+		WriteError(w, http.StatusBadRequest, fmt.Sprintf("A user can hold at most %d personal API keys", MaxPersonalAPIKeys))
+		return
+	}
+
+	results := make([]any, 0, len(keys))
+	for _, key := range keys {
+		rawKey, keyHash := GenerateAPIKey()
+		now := time.Now().UTC().Format(time.RFC3339)
+		row := map[string]any{
+			"id":               GenerateULID(),
+			"name":             key.name,
+			"role":             stringVal(user, "role"),
+			"can_write":        boolToInt(key.canWrite),
+			"collections":      prepareValueForDB(key.collections, MoonFieldTypeJSON),
+			"is_website":       boolToInt(false),
+			"rate_limit":       int64(DefaultAPIKeyRateLimit),
+			"captcha_required": boolToInt(false),
+			"enabled":          boolToInt(true),
+			"user_id":          identity.UserID,
+			"key_hash":         keyHash,
+			"created_at":       now,
+			"updated_at":       now,
+		}
+		if err := h.db.InsertRow(ctx, "apikeys", row); err != nil {
+			writeDBError(w, err)
+			return
+		}
+		h.audit(ctx, AuditAPIKeyCreate, "create", identity, row["id"].(string))
+
+		record := personalKeyResponse(row)
+		record["key"] = rawKey
+		results = append(results, record)
+	}
+
+	meta := map[string]any{"success": len(results), "failed": 0}
+	WriteSuccessFull(w, http.StatusCreated, "API keys created successfully", results, meta, nil)
+}
+
+// rotateOrDestroy applies op=rotate or op=destroy to each item.
+func (h *AuthKeysHandler) rotateOrDestroy(ctx context.Context, w http.ResponseWriter, identity *AuthIdentity, op string, items []map[string]any) {
+	for _, item := range items {
+		if id, _ := item["id"].(string); id == "" {
+			WriteError(w, http.StatusBadRequest, "Each item must include 'id'")
+			return
+		}
+	}
+
+	results := make([]any, 0, len(items))
+	failed := 0
+	for _, item := range items {
+		id := item["id"].(string)
+		filters := []Filter{{Field: "id", Op: "eq", Value: id}, {Field: "user_id", Op: "not_null"}}
+		if identity.Role != "admin" {
+			filters[1] = Filter{Field: "user_id", Op: "eq", Value: identity.UserID}
+		}
+		rows, _, err := h.db.QueryRows(ctx, "apikeys", QueryOptions{Filters: filters, Page: 1, PerPage: 1})
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		if len(rows) == 0 {
+			failed++
+			continue
+		}
+
+		if op == "destroy" {
+			if err := h.db.DeleteRow(ctx, "apikeys", id); err != nil {
+				failed++
+				continue
+			}
+			h.audit(ctx, AuditPrivilegedMutation, "destroy", identity, id)
+			results = append(results, map[string]any{"id": id})
+			continue
+		}
+
+		rawKey, keyHash := GenerateAPIKey()
+		now := time.Now().UTC().Format(time.RFC3339)
+		if err := h.db.UpdateRow(ctx, "apikeys", id, map[string]any{
+			"key_hash":   keyHash,
+			"updated_at": now,
+		}); err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		h.audit(ctx, AuditAPIKeyRotation, "rotate", identity, id)
+
+		record := personalKeyResponse(rows[0])
+		record["updated_at"] = now
+		record["key"] = rawKey
+		results = append(results, record)
+	}
+
+	meta := map[string]any{"success": len(results), "failed": failed}
+	WriteSuccessFull(w, http.StatusOK, "API keys updated successfully", results, meta, nil)
+}
+
+// lookupUser fetches the caller's user row.
+func (h *AuthKeysHandler) lookupUser(ctx context.Context, userID string) (map[string]any, error) {
+	rows, _, err := h.db.QueryRows(ctx, "users", QueryOptions{
+		Filters: []Filter{{Field: "id", Op: "eq", Value: userID}},
+		Page:    1,
+		PerPage: 1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("user %q: %w", userID, ErrNotFound)
+	}
+	return rows[0], nil
+}
+
+// audit records a personal key change. Keys are audited by id; the raw
+// key is never logged.
+func (h *AuthKeysHandler) audit(ctx context.Context, event, op string, identity *AuthIdentity, keyID string) {
+	if h.logger == nil {
+		return
+	}
+	h.logger.AuditEventContext(ctx, event,
+		"action", "personal_key."+op,
+		"actor", identity.CallerID,
+		"target", keyID,
+		"timestamp", time.Now().UTC().Format(time.RFC3339),
+	)
+}
+
+// personalKeyResponse converts an apikeys row to the /auth:keys record.
+func personalKeyResponse(row map[string]any) map[string]any {
+	return map[string]any{
+		"id":           stringVal(row, "id"),
+		"name":         stringVal(row, "name"),
+		"user_id":      stringVal(row, "user_id"),
+		"role":         stringVal(row, "role"),
+		"can_write":    toBool(row["can_write"]),
+		"collections":  apiKeyCollectionsValue(row["collections"]),
+		"enabled":      enabledValue(row),
+		"expires_at":   row["expires_at"],
+		"created_at":   row["created_at"],
+		"updated_at":   row["updated_at"],
+		"last_used_at": row["last_used_at"],
+	}
+}
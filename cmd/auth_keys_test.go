@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const authKeysTestUser = "01TESTUSER000000000000002"
+
+// setupAuthKeysTest returns an AuthKeysHandler over a database holding the
+// admin from setupAuthMeTest and a read-only user with id authKeysTestUser.
+func setupAuthKeysTest(t *testing.T) (*AuthKeysHandler, DatabaseAdapter) {
+	t.Helper()
+	_, _, db := setupAuthMeTest(t)
+	now := time.Now().UTC().Format(time.RFC3339)
+	if err := db.InsertRow(context.Background(), "users", map[string]any{
+		"id":            authKeysTestUser,
+		"username":      "reader",
+		"email":         "reader@example.com",
+		"password_hash": "x",
+		"role":          "user",
+		"can_write":     int64(0),
+		"created_at":    now,
+		"updated_at":    now,
+	}); err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+	return NewAuthKeysHandler(db, nil), db
+}
+
+func doAuthKeysRequest(t *testing.T, h *AuthKeysHandler, method, target string, body any, userID, role string) *httptest.ResponseRecorder {
+	t.Helper()
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+	}
+	req := reqWithJWT(method, target, payload, userID, role, false)
+	identity, _ := GetAuthIdentity(req.Context())
+	identity.UserID = userID
+	w := httptest.NewRecorder()
+	if method == http.MethodGet {
+		h.HandleQuery(w, req)
+	} else {
+		h.HandleMutate(w, req)
+	}
+	return w
+}
+
+// authenticateKey runs rawKey through the auth middleware and returns the
+// response status and, on success, the resolved identity.
+func authenticateKey(t *testing.T, db DatabaseAdapter, rawKey string) (int, map[string]any) {
+	t.Helper()
+	am := NewAuthMiddleware(db, "this-is-a-test-secret-that-is-long-enough", "", NewJTIRevocationStore())
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set("Authorization", "Bearer "+rawKey)
+	w := httptest.NewRecorder()
+	am.Authenticate(testAuthHandler()).ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		return w.Code, nil
+	}
+	var identity map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &identity); err != nil {
+		t.Fatalf("decode identity: %v", err)
+	}
+	return w.Code, identity
+}
+
+func TestAuthKeys_Lifecycle(t *testing.T) {
+	h, db := setupAuthKeysTest(t)
+
+	create := map[string]any{"op": "create", "data": []any{
+		map[string]any{"name": "laptop", "collections": []any{"products"}, "can_write": true},
+	}}
+	if w := doAuthKeysRequest(t, h, http.MethodPost, "/auth:keys", create, authKeysTestUser, "user"); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for can_write beyond the user's access, got %d", w.Code)
+	}
+
+	create = map[string]any{"op": "create", "data": []any{
+		map[string]any{"name": "laptop", "collections": []any{"products"}},
+	}}
+	w := doAuthKeysRequest(t, h, http.MethodPost, "/auth:keys", create, authKeysTestUser, "user")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	key := decodeResponse(t, w)["data"].([]any)[0].(map[string]any)
+	if key["user_id"] != authKeysTestUser || key["role"] != "user" {
+		t.Fatalf("unexpected key record: %v", key)
+	}
+	id, rawKey := key["id"].(string), key["key"].(string)
+
+	status, identity := authenticateKey(t, db, rawKey)
+	if status != http.StatusOK || identity["role"] != "user" || identity["caller_id"] != id {
+		t.Fatalf("personal key auth: status %d, identity %v", status, identity)
+	}
+
+	w = doAuthKeysRequest(t, h, http.MethodGet, "/auth:keys", nil, authKeysTestUser, "user")
+	if data := decodeResponse(t, w)["data"].([]any); len(data) != 1 {
+		t.Fatalf("expected 1 key, got %d", len(data))
+	} else if _, leaked := data[0].(map[string]any)["key"]; leaked {
+		t.Fatal("list must not return the raw key")
+	}
+	if w := doAuthKeysRequest(t, h, http.MethodGet, "/auth:keys?all=true", nil, authKeysTestUser, "user"); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for all=true as a user, got %d", w.Code)
+	}
+	w = doAuthKeysRequest(t, h, http.MethodGet, "/auth:keys?all=true", nil, "01TESTUSER000000000000001", "admin")
+	if data := decodeResponse(t, w)["data"].([]any); len(data) != 1 {
+		t.Fatalf("expected admin to see 1 personal key, got %d", len(data))
+	}
+
+	w = doAuthKeysRequest(t, h, http.MethodPost, "/auth:keys", map[string]any{"op": "rotate", "data": []any{map[string]any{"id": id}}}, authKeysTestUser, "user")
+	rotated := decodeResponse(t, w)["data"].([]any)[0].(map[string]any)["key"].(string)
+	if status, _ := authenticateKey(t, db, rawKey); status != http.StatusUnauthorized {
+		t.Errorf("expected old key to be rejected after rotate, got %d", status)
+	}
+	if status, _ := authenticateKey(t, db, rotated); status != http.StatusOK {
+		t.Errorf("expected rotated key to authenticate, got %d", status)
+	}
+
+	destroy := map[string]any{"op": "destroy", "data": []any{map[string]any{"id": id}}}
+	w = doAuthKeysRequest(t, h, http.MethodPost, "/auth:keys", destroy, "01OTHERUSER00000000000001", "user")
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for an unknown user, got %d", w.Code)
+	}
+	w = doAuthKeysRequest(t, h, http.MethodPost, "/auth:keys", destroy, authKeysTestUser, "user")
+	if meta := decodeResponse(t, w)["meta"].(map[string]any); meta["success"] != float64(1) {
+		t.Fatalf("expected destroy to succeed, got %v", meta)
+	}
+	if status, _ := authenticateKey(t, db, rotated); status != http.StatusUnauthorized {
+		t.Errorf("expected destroyed key to be rejected, got %d", status)
+	}
+}
+
+func TestAuthKeys_FollowsOwner(t *testing.T) {
+	h, db := setupAuthKeysTest(t)
+	ctx := context.Background()
+	admin := "01TESTUSER000000000000001"
+
+	create := map[string]any{"op": "create", "data": []any{
+		map[string]any{"name": "ci", "collections": []any{"products"}, "can_write": true},
+	}}
+	w := doAuthKeysRequest(t, h, http.MethodPost, "/auth:keys", create, admin, "admin")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	rawKey := decodeResponse(t, w)["data"].([]any)[0].(map[string]any)["key"].(string)
+
+	if _, identity := authenticateKey(t, db, rawKey); identity["role"] != "admin" || identity["can_write"] != true {
+		t.Fatalf("expected admin key with write access, got %v", identity)
+	}
+
+	if err := db.UpdateRow(ctx, "users", admin, map[string]any{"role": "user", "can_write": int64(0)}); err != nil {
+		t.Fatalf("demote: %v", err)
+	}
+	if _, identity := authenticateKey(t, db, rawKey); identity["role"] != "user" || identity["can_write"] != false {
+		t.Fatalf("expected key to follow the demoted owner, got %v", identity)
+	}
+
+	if err := db.UpdateRow(ctx, "users", admin, map[string]any{"enabled": int64(0)}); err != nil {
+		t.Fatalf("disable: %v", err)
+	}
+	if status, _ := authenticateKey(t, db, rawKey); status != http.StatusUnauthorized {
+		t.Fatalf("expected 401 after the owner is disabled, got %d", status)
+	}
+}
+
+func TestAuthKeys_Limit(t *testing.T) {
+	h, _ := setupAuthKeysTest(t)
+	items := make([]any, 0, MaxPersonalAPIKeys+1)
+	for i := 0; i <= MaxPersonalAPIKeys; i++ {
+		items = append(items, map[string]any{"name": "key-" + string(rune('a'+i)), "collections": []any{"products"}})
+	}
+	w := doAuthKeysRequest(t, h, http.MethodPost, "/auth:keys", map[string]any{"op": "create", "data": items}, authKeysTestUser, "user")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 over the key limit, got %d", w.Code)
+	}
+}
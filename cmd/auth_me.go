@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -28,6 +29,7 @@ var nonWritableFields = map[string]bool{
 	"username":      true,
 	"role":          true,
 	"can_write":     true,
+	"enabled":       true,
 	"created_at":    true,
 	"updated_at":    true,
 	"last_login_at": true,
@@ -50,7 +52,11 @@ func (h *AuthMeHandler) GetMe(w http.ResponseWriter, r *http.Request) {
 
 	user, err := h.lookupUser(r.Context(), identity.CallerID)
 	if err != nil {
-		WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		if errors.Is(err, ErrNotFound) {
+			WriteError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
@@ -103,7 +109,11 @@ func (h *AuthMeHandler) UpdateMe(w http.ResponseWriter, r *http.Request) {
 
 	user, err := h.lookupUser(r.Context(), identity.CallerID)
 	if err != nil {
-		WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		if errors.Is(err, ErrNotFound) {
+			WriteError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
@@ -132,8 +142,16 @@ func (h *AuthMeHandler) UpdateMe(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		if err := validatePasswordPolicy(newPassword); err != nil {
-			WriteError(w, http.StatusBadRequest, fmt.Sprintf("Password policy violation: %s", err.Error()))
+		policy := h.cfg.Passwords()
+		if err := policy.Validate(newPassword); err != nil {
+			WriteError(w, http.StatusBadRequest, passwordPolicyViolation(err))
+			return
+		}
+		if err := policy.CheckHistory(ctx, h.db, user, newPassword); errors.Is(err, errPasswordReused) {
+			WriteError(w, http.StatusBadRequest, passwordPolicyViolation(err))
+			return
+		} else if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
 			return
 		}
 
@@ -152,6 +170,10 @@ func (h *AuthMeHandler) UpdateMe(w http.ResponseWriter, r *http.Request) {
 			WriteError(w, http.StatusInternalServerError, "Internal server error")
 			return
 		}
+		if err := policy.RecordHistory(ctx, h.db, userID, storedHash); err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
 
 		// Revoke all active refresh tokens for this user.
 		if err := h.revokeAllRefreshTokens(ctx, userID, "password_changed"); err != nil {
@@ -198,7 +220,7 @@ func (h *AuthMeHandler) UpdateMe(w http.ResponseWriter, r *http.Request) {
 	if len(existing) > 0 {
 		existingID, _ := existing[0]["id"].(string)
 		if existingID != userID {
-			WriteError(w, http.StatusConflict, "Email already in use")
+			WriteErrorCode(w, http.StatusConflict, ErrCodeUniqueViolation, "Email already in use")
 			return
 		}
 	}
@@ -228,8 +250,11 @@ func (h *AuthMeHandler) lookupUser(ctx context.Context, userID string) (map[stri
 		Page:    1,
 		PerPage: 1,
 	})
-	if err != nil || len(rows) == 0 {
-		return nil, fmt.Errorf("user not found")
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("user %q: %w", userID, ErrNotFound)
 	}
 	return rows[0], nil
 }
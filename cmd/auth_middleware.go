@@ -11,8 +11,6 @@ import (
 	"strings"
 	"sync"
 	"time"
-
-	"github.com/golang-jwt/jwt/v5"
 )
 
 // ---------------------------------------------------------------------------
@@ -23,15 +21,19 @@ import (
 type AuthIdentity struct {
 	CredentialType  string // "jwt" or "apikey"
 	CallerID        string // user id or api key id
-	Role            string // "admin" or "user"
+	UserID          string // user id, or the owner of a personal api key
+	Role            string // "admin", "user", or a custom role
 	CanWrite        bool
 	JTI             string // only for JWT credentials
 	Collections     []string
+	Scopes          []string // nil when the api key has no scopes
 	IsWebsite       bool
 	AllowedOrigins  []string
 	RateLimit       int
 	CaptchaRequired bool
+	NoisyAggregates bool
 	Enabled         bool
+	Permissions     *RolePermissions // a custom role's, set by the authorization middleware
 }
 
 type contextKey string
@@ -46,6 +48,27 @@ func SetAuthIdentity(ctx context.Context, id *AuthIdentity) context.Context {
 	return context.WithValue(ctx, authIdentityKey, id)
 }
 
+// OwnerID returns the id recorded as owner_id on rows the caller creates:
+// the user id for a session or a personal API key, otherwise the key id.
+func (id *AuthIdentity) OwnerID() string {
+	if id.UserID != "" {
+		return id.UserID
+	}
+	return id.CallerID
+}
+
+// ManagesUsers reports whether the caller may manage users and API keys:
+// an admin or a custom role with the users permission.
+func (id *AuthIdentity) ManagesUsers() bool {
+	return id.Role == "admin" || (id.Permissions != nil && id.Permissions.Users)
+}
+
+// ManagesCollections reports whether the caller may change collection
+// schemas: an admin or a custom role with the collections permission.
+func (id *AuthIdentity) ManagesCollections() bool {
+	return id.Role == "admin" || (id.Permissions != nil && id.Permissions.Collections)
+}
+
 // GetAuthIdentity retrieves the identity from the request context.
 func GetAuthIdentity(ctx context.Context) (*AuthIdentity, bool) {
 	id, ok := ctx.Value(authIdentityKey).(*AuthIdentity)
@@ -90,24 +113,47 @@ func (s *JTIRevocationStore) IsRevoked(jti string) bool {
 
 // AuthMiddleware extracts and validates bearer credentials.
 type AuthMiddleware struct {
-	db        DatabaseAdapter
-	jwtSecret string
-	jtiStore  *JTIRevocationStore
-	prefix    string
+	db          DatabaseAdapter
+	keys        *TokenKeys
+	jtiStore    *JTIRevocationStore
+	prefix      string
+	staleClaims string
+	logger      *Logger
+	expiring    sync.Map // key id -> the expires_at it was reported for
 }
 
 // NewAuthMiddleware creates a new authentication middleware.
 func NewAuthMiddleware(db DatabaseAdapter, jwtSecret, prefix string, jtiStore *JTIRevocationStore) *AuthMiddleware {
 	return &AuthMiddleware{
-		db:        db,
-		jwtSecret: jwtSecret,
-		jtiStore:  jtiStore,
-		prefix:    strings.TrimRight(prefix, "/"),
+		db:          db,
+		keys:        NewHMACTokenKeys(jwtSecret),
+		jtiStore:    jtiStore,
+		prefix:      strings.TrimRight(prefix, "/"),
+		staleClaims: DefaultJWTStaleClaims,
 	}
 }
 
+// SetStaleClaims sets how access tokens whose role or can_write claims no
+// longer match the user record are handled: JWTStaleClaimsOverride or
+// JWTStaleClaimsReject.
+func (m *AuthMiddleware) SetStaleClaims(mode string) {
+	m.staleClaims = mode
+}
+
+// SetTokenKeys sets the keys that verify access tokens, replacing the
+// HS256 secret passed to NewAuthMiddleware.
+func (m *AuthMiddleware) SetTokenKeys(keys *TokenKeys) {
+	m.keys = keys
+}
+
+// SetLogger sets the logger that receives api_key.expiring audit events.
+func (m *AuthMiddleware) SetLogger(logger *Logger) {
+	m.logger = logger
+}
+
 // Authenticate wraps the next handler with bearer credential validation.
-// Public routes (/, /health, POST /auth:session) bypass authentication.
+// Public routes (/, /health, POST /auth:session, and the configured
+// well-known files) bypass authentication.
 func (m *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if m.isPublicRoute(r) {
@@ -123,6 +169,13 @@ func (m *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
 
 		identity, err := m.validateCredential(r.Context(), token)
 		if err != nil {
+			// A failed credential lookup is a server error, not a
+			// rejected credential.
+			var adapterErr *AdapterError
+			if errors.As(err, &adapterErr) {
+				WriteError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
 			WriteError(w, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
@@ -142,6 +195,24 @@ func (m *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
 	})
 }
 
+// publicFiles are the well-known files served without authentication when
+// configured.
+var publicFiles = map[string]bool{
+	"/robots.txt":               true,
+	"/.well-known/security.txt": true,
+	"/.well-known/jwks.json":    true,
+}
+
+// publicAuthRoutes are the POST routes that take credentials in the
+// request body instead of a bearer token.
+var publicAuthRoutes = map[string]bool{
+	"/auth:session":       true,
+	"/auth:oidc":          true,
+	"/auth:forgot":        true,
+	"/auth:reset":         true,
+	"/auth:accept_invite": true,
+}
+
 // isPublicRoute returns true for routes that don't require authentication.
 func (m *AuthMiddleware) isPublicRoute(r *http.Request) bool {
 	path := r.URL.Path
@@ -153,10 +224,13 @@ func (m *AuthMiddleware) isPublicRoute(r *http.Request) bool {
 	}
 
 	if m.prefix == "" {
-		if method == http.MethodGet && (path == "/" || path == "/health") {
+		if method == http.MethodGet && (path == "/" || path == "/health" || publicFiles[path]) {
 			return true
 		}
-		if method == http.MethodPost && path == "/auth:session" {
+		if method == http.MethodPost && publicAuthRoutes[path] {
+			return true
+		}
+		if (method == http.MethodGet || method == http.MethodPost) && path == "/setup" {
 			return true
 		}
 		return false
@@ -165,7 +239,13 @@ func (m *AuthMiddleware) isPublicRoute(r *http.Request) bool {
 	if method == http.MethodGet && (path == m.prefix || path == m.prefix+"/" || path == m.prefix+"/health") {
 		return true
 	}
-	if method == http.MethodPost && path == m.prefix+"/auth:session" {
+	if rest, ok := strings.CutPrefix(path, m.prefix); ok && method == http.MethodGet && publicFiles[rest] {
+		return true
+	}
+	if rest, ok := strings.CutPrefix(path, m.prefix); ok && method == http.MethodPost && publicAuthRoutes[rest] {
+		return true
+	}
+	if (method == http.MethodGet || method == http.MethodPost) && path == m.prefix+"/setup" {
 		return true
 	}
 	return false
@@ -215,21 +295,11 @@ func (m *AuthMiddleware) validateCredential(ctx context.Context, token string) (
 
 // validateJWT parses and verifies a JWT token.
 func (m *AuthMiddleware) validateJWT(ctx context.Context, tokenStr string) (*AuthIdentity, error) {
-	token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (any, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
-		}
-		return []byte(m.jwtSecret), nil
-	}, jwt.WithExpirationRequired())
+	claims, err := m.keys.Parse(tokenStr)
 	if err != nil {
 		return nil, fmt.Errorf("jwt parse: %w", err)
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok || !token.Valid {
-		return nil, fmt.Errorf("invalid jwt claims")
-	}
-
 	sub, _ := claims["sub"].(string)
 	jti, _ := claims["jti"].(string)
 	role, _ := claims["role"].(string)
@@ -249,13 +319,30 @@ func (m *AuthMiddleware) validateJWT(ctx context.Context, tokenStr string) (*Aut
 		Page:    1,
 		PerPage: 1,
 	})
-	if err != nil || len(rows) == 0 {
-		return nil, fmt.Errorf("user not found")
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("user: %w", ErrNotFound)
+	}
+	if !enabledValue(rows[0]) {
+		return nil, fmt.Errorf("user disabled")
+	}
+
+	// The user row is read on every request, so a role or can_write
+	// change applies to outstanding tokens immediately.
+	storedRole, storedCanWrite := stringVal(rows[0], "role"), toBool(rows[0]["can_write"])
+	if storedRole != role || storedCanWrite != canWrite {
+		if m.staleClaims == JWTStaleClaimsReject {
+			return nil, fmt.Errorf("stale jwt claims")
+		}
+		role, canWrite = storedRole, storedCanWrite
 	}
 
 	return &AuthIdentity{
 		CredentialType: CredentialTypeJWT,
 		CallerID:       sub,
+		UserID:         sub,
 		Role:           role,
 		CanWrite:       canWrite,
 		JTI:            jti,
@@ -276,8 +363,11 @@ func (m *AuthMiddleware) validateAPIKey(ctx context.Context, key string) (*AuthI
 		Page:    1,
 		PerPage: 1,
 	})
-	if err != nil || len(rows) == 0 {
-		return nil, fmt.Errorf("api key not found")
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("api key: %w", ErrNotFound)
 	}
 
 	row := rows[0]
@@ -288,6 +378,10 @@ func (m *AuthMiddleware) validateAPIKey(ctx context.Context, key string) (*AuthI
 	if err != nil {
 		return nil, fmt.Errorf("parse collections: %w", err)
 	}
+	scopes, err := parseStringArrayValue(row["scopes"], "scopes")
+	if err != nil {
+		return nil, fmt.Errorf("parse scopes: %w", err)
+	}
 	isWebsite := toBool(row["is_website"])
 	allowedOrigins, err := parseAllowedOrigins(row["allowed_origins"])
 	if err != nil {
@@ -297,13 +391,39 @@ func (m *AuthMiddleware) validateAPIKey(ctx context.Context, key string) (*AuthI
 	if err != nil {
 		return nil, fmt.Errorf("parse rate limit: %w", err)
 	}
-	enabled := true
-	if rawEnabled, ok := row["enabled"]; ok {
-		enabled = toBool(rawEnabled)
-	}
+	enabled := enabledValue(row)
 	if !enabled {
 		return nil, fmt.Errorf("api key disabled")
 	}
+	if apiKeyExpired(row, time.Now()) {
+		return nil, fmt.Errorf("api key expired")
+	}
+	m.reportExpiringKey(row, time.Now())
+
+	// A personal key never exceeds its owner's current access and stops
+	// working when the owner is disabled or deleted.
+	userID := stringVal(row, "user_id")
+	if userID != "" {
+		users, _, err := m.db.QueryRows(ctx, "users", QueryOptions{
+			Filters: []Filter{{Field: "id", Op: "eq", Value: userID}},
+			Page:    1,
+			PerPage: 1,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(users) == 0 {
+			return nil, fmt.Errorf("api key owner: %w", ErrNotFound)
+		}
+		if !enabledValue(users[0]) {
+			return nil, fmt.Errorf("api key owner disabled")
+		}
+		if ownerRole := stringVal(users[0], "role"); ownerRole != "admin" {
+			role = ownerRole
+			canWrite = canWrite && toBool(users[0]["can_write"])
+		}
+	}
+
 	captchaRequired := false
 	if rawCaptcha, ok := row["captcha_required"]; ok {
 		captchaRequired = toBool(rawCaptcha)
@@ -318,13 +438,16 @@ func (m *AuthMiddleware) validateAPIKey(ctx context.Context, key string) (*AuthI
 	return &AuthIdentity{
 		CredentialType:  CredentialTypeAPIKey,
 		CallerID:        id,
+		UserID:          userID,
 		Role:            role,
 		CanWrite:        canWrite,
 		Collections:     collections,
+		Scopes:          scopes,
 		IsWebsite:       isWebsite,
 		AllowedOrigins:  allowedOrigins,
 		RateLimit:       rateLimit,
 		CaptchaRequired: captchaRequired,
+		NoisyAggregates: toBool(row["noisy_aggregates"]),
 		Enabled:         enabled,
 	}, nil
 }
@@ -417,6 +540,14 @@ func parseAPIKeyRateLimit(value any) (int, error) {
 
 // Authorize enforces role-based access control after authentication.
 func Authorize(prefix string, next http.Handler) http.Handler {
+	return AuthorizeWithPermissions(prefix, nil, next)
+}
+
+// AuthorizeWithPermissions enforces role-based access control like
+// Authorize and, when perms is non-nil, resolves custom roles and applies
+// the per-collection rules for data routes. Rules only narrow access:
+// write operations still require can_write.
+func AuthorizeWithPermissions(prefix string, perms *PermissionStore, next http.Handler) http.Handler {
 	p := strings.TrimRight(prefix, "/")
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		identity, ok := GetAuthIdentity(r.Context())
@@ -428,11 +559,30 @@ func Authorize(prefix string, next http.Handler) http.Handler {
 
 		path := r.URL.Path
 
+		if perms != nil && identity.Role != "admin" {
+			perms.reloadIfStale(r.Context())
+			perms.resolveRole(identity)
+		}
+
 		if !isAPIKeyResourceAllowed(identity, path) {
 			WriteError(w, http.StatusForbidden, "Forbidden")
 			return
 		}
 
+		if resource := extractResource(path); resource != "" && identity.Scopes != nil {
+			_, op, err := dataRouteOperation(r, p)
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, "Invalid request body")
+				return
+			}
+			for _, op := range routeOperations(op) {
+				if !scopeAllows(identity.Scopes, resource, op) {
+					WriteError(w, http.StatusForbidden, "Forbidden")
+					return
+				}
+			}
+		}
+
 		// Determine what kind of operation this is
 		if isAdminOnlyRoute(path, r.Method, p) {
 			if identity.Role != "admin" {
@@ -441,6 +591,11 @@ func Authorize(prefix string, next http.Handler) http.Handler {
 			}
 		}
 
+		if isUserManagementRoute(path, r.Method, p) && !identity.ManagesUsers() {
+			WriteError(w, http.StatusForbidden, "Forbidden")
+			return
+		}
+
 		if isCollectionMutateRoute(path, r.Method, p) {
 			if err := authorizeCollectionMutate(identity); err != nil {
 				if errors.Is(err, errBadRequest) {
@@ -459,6 +614,22 @@ func Authorize(prefix string, next http.Handler) http.Handler {
 			}
 		}
 
+		if perms != nil && identity.Role != "admin" {
+			if resource := extractResource(path); resource != "" && (identity.Permissions != nil || perms.HasRules(resource)) {
+				_, op, err := dataRouteOperation(r, p)
+				if err != nil {
+					WriteError(w, http.StatusBadRequest, "Invalid request body")
+					return
+				}
+				for _, op := range routeOperations(op) {
+					if op != "" && !perms.Allowed(identity, resource, op) {
+						WriteError(w, http.StatusForbidden, "Forbidden")
+						return
+					}
+				}
+			}
+		}
+
 		next.ServeHTTP(w, r)
 	})
 }
@@ -487,7 +658,15 @@ func stringInSlice(value string, items []string) bool {
 
 // isAdminOnlyRoute returns true for routes that require admin role.
 func isAdminOnlyRoute(path, method, prefix string) bool {
-	// Manage users/apikeys via data endpoints
+	if path == prefix+"/admin:ratelimits" || path == prefix+"/admin:permissions" || path == prefix+"/admin:roles" {
+		return true
+	}
+	return path == prefix+"/admin:diagnostics" || path == prefix+"/admin:audit" || strings.HasPrefix(path, prefix+"/admin:pprof/")
+}
+
+// isUserManagementRoute returns true for the data routes that manage users
+// and API keys, which require ManagesUsers.
+func isUserManagementRoute(path, method, prefix string) bool {
 	dataPrefix := prefix + "/data/"
 	if strings.HasPrefix(path, dataPrefix) {
 		rest := path[len(dataPrefix):]
@@ -498,20 +677,29 @@ func isAdminOnlyRoute(path, method, prefix string) bool {
 			if (resource == "users" || resource == "apikeys") && action == "mutate" && method == http.MethodPost {
 				return true
 			}
+			if resource == "users" && (action == "import" || action == "export") {
+				return true
+			}
 		}
 	}
 
 	return false
 }
 
-// isCollectionMutateRoute returns true for POST /collections:mutate.
+// isCollectionMutateRoute returns true for POST /collections:mutate,
+// POST /collections:refresh, and POST /collections:indexes, all of which
+// change the schema registry.
 func isCollectionMutateRoute(path, method, prefix string) bool {
-	return method == http.MethodPost && path == prefix+"/collections:mutate"
+	if method != http.MethodPost {
+		return false
+	}
+	return path == prefix+"/collections:mutate" || path == prefix+"/collections:refresh" ||
+		path == prefix+"/collections:indexes"
 }
 
 // authorizeCollectionMutate checks collection mutation authorization.
 func authorizeCollectionMutate(identity *AuthIdentity) error {
-	if identity.Role != "admin" {
+	if !identity.ManagesCollections() {
 		return fmt.Errorf("forbidden")
 	}
 	return nil
@@ -529,7 +717,10 @@ func isWriteRoute(path, method, prefix string) bool {
 		colonIdx := strings.LastIndex(rest, ":")
 		if colonIdx > 0 {
 			action := rest[colonIdx+1:]
-			return action == "mutate"
+			switch action {
+			case "mutate", "import", "upsert", "updateWhere", "destroyWhere":
+				return true
+			}
 		}
 	}
 	return false
@@ -32,6 +32,14 @@ type mockUpdate struct {
 func (m *mockAuthDB) Ping(_ context.Context) error              { return nil }
 func (m *mockAuthDB) Close() error                              { return nil }
 func (m *mockAuthDB) ExecDDL(_ context.Context, _ string) error { return nil }
+func (m *mockAuthDB) ExecDDLBatch(_ context.Context, _ []string) error {
+	return nil
+}
+
+func (m *mockAuthDB) InsertRows(_ context.Context, _ string, _ []map[string]any) error {
+	return nil
+}
+
 func (m *mockAuthDB) InsertRow(_ context.Context, _ string, _ map[string]any) error {
 	return nil
 }
@@ -39,12 +47,37 @@ func (m *mockAuthDB) UpdateRow(_ context.Context, table, id string, data map[str
 	m.updates = append(m.updates, mockUpdate{table: table, id: id, data: data})
 	return nil
 }
-func (m *mockAuthDB) DeleteRow(_ context.Context, _ string, _ string) error { return nil }
-func (m *mockAuthDB) ListTables(_ context.Context) ([]string, error)        { return nil, nil }
+func (m *mockAuthDB) UpdateRowVersion(_ context.Context, table, id string, _ int64, data map[string]any) (bool, error) {
+	m.updates = append(m.updates, mockUpdate{table: table, id: id, data: data})
+	return true, nil
+}
+func (m *mockAuthDB) DeleteRow(_ context.Context, _ string, _ string) error         { return nil }
+func (m *mockAuthDB) ExecWriteBatch(_ context.Context, _ []BatchWrite) (int, error) { return 0, nil }
+func (m *mockAuthDB) ListTables(_ context.Context) ([]string, error)                { return nil, nil }
 func (m *mockAuthDB) DescribeTable(_ context.Context, _ string) ([]ColumnInfo, error) {
 	return nil, nil
 }
-func (m *mockAuthDB) CountRows(_ context.Context, _ string) (int, error) { return 0, nil }
+func (m *mockAuthDB) UpdateWhere(_ context.Context, _ string, _ []Filter, _ map[string]any, _ bool, _ int) (int, error) {
+	return 0, nil
+}
+func (m *mockAuthDB) DeleteWhere(_ context.Context, _ string, _ []Filter, _ int) (int, error) {
+	return 0, nil
+}
+func (m *mockAuthDB) ListIndexes(_ context.Context, _ string) ([]IndexInfo, error) {
+	return nil, nil
+}
+func (m *mockAuthDB) CreateIndex(_ context.Context, _ string, _ IndexInfo) error { return nil }
+func (m *mockAuthDB) DropIndex(_ context.Context, _, _ string) error             { return nil }
+func (m *mockAuthDB) CountRows(_ context.Context, _ string) (int, error)         { return 0, nil }
+func (m *mockAuthDB) NumericHistogram(_ context.Context, _, _ string, _ int, _ []Filter) (*HistogramResult, error) {
+	return &HistogramResult{}, nil
+}
+func (m *mockAuthDB) TimeSeries(_ context.Context, _ string, _ TimeSeriesQuery) ([]TimeSeriesPoint, error) {
+	return nil, nil
+}
+func (m *mockAuthDB) Pivot(_ context.Context, _ string, _ PivotQuery) ([]PivotCell, error) {
+	return nil, nil
+}
 
 func (m *mockAuthDB) QueryRows(_ context.Context, table string, opts QueryOptions) ([]map[string]any, int, error) {
 	switch table {
@@ -70,6 +103,10 @@ func (m *mockAuthDB) QueryRows(_ context.Context, table string, opts QueryOption
 	return nil, 0, nil
 }
 
+func (m *mockAuthDB) ReadSnapshot(_ context.Context, read func(SnapshotReader) error) error {
+	return read(m)
+}
+
 // ---------------------------------------------------------------------------
 // Test helpers
 // ---------------------------------------------------------------------------
@@ -280,6 +317,15 @@ func TestAuthenticate_PublicRoutes(t *testing.T) {
 		{http.MethodGet, "/"},
 		{http.MethodGet, "/health"},
 		{http.MethodPost, "/auth:session"},
+		{http.MethodPost, "/auth:oidc"},
+		{http.MethodPost, "/auth:forgot"},
+		{http.MethodPost, "/auth:reset"},
+		{http.MethodPost, "/auth:accept_invite"},
+		{http.MethodGet, "/setup"},
+		{http.MethodPost, "/setup"},
+		{http.MethodGet, "/robots.txt"},
+		{http.MethodGet, "/.well-known/security.txt"},
+		{http.MethodGet, "/.well-known/jwks.json"},
 	}
 
 	for _, route := range publicRoutes {
@@ -308,6 +354,13 @@ func TestAuthenticate_PublicRoutesWithPrefix(t *testing.T) {
 		{http.MethodGet, "/api/"},
 		{http.MethodGet, "/api/health"},
 		{http.MethodPost, "/api/auth:session"},
+		{http.MethodPost, "/api/auth:oidc"},
+		{http.MethodPost, "/api/auth:forgot"},
+		{http.MethodPost, "/api/auth:reset"},
+		{http.MethodPost, "/api/auth:accept_invite"},
+		{http.MethodPost, "/api/setup"},
+		{http.MethodGet, "/api/robots.txt"},
+		{http.MethodGet, "/api/.well-known/jwks.json"},
 	}
 
 	for _, route := range publicRoutes {
@@ -339,6 +392,7 @@ func TestAuthenticate_ProtectedRouteWithoutToken(t *testing.T) {
 		{http.MethodPost, "/auth:me"},
 		{http.MethodGet, "/collections:query"},
 		{http.MethodPost, "/collections:mutate"},
+		{http.MethodPost, "/collections:refresh"},
 		{http.MethodGet, "/data/products:query"},
 		{http.MethodPost, "/data/products:mutate"},
 	}
@@ -428,6 +482,68 @@ func TestAuthenticate_ValidJWT(t *testing.T) {
 	}
 }
 
+func TestAuthenticate_JWT_StaleClaims(t *testing.T) {
+	userID := GenerateULID()
+	db := &mockAuthDB{
+		users: []map[string]any{
+			{"id": userID, "role": "user", "can_write": int64(0)},
+		},
+	}
+	token := createTestJWT(t, userID, "test-jti", "admin", true, 3600)
+
+	tests := []struct {
+		mode   string
+		status int
+	}{
+		{JWTStaleClaimsOverride, http.StatusOK},
+		{JWTStaleClaimsReject, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			am := NewAuthMiddleware(db, testJWTSecret(), "", NewJTIRevocationStore())
+			am.SetStaleClaims(tt.mode)
+			handler := am.Authenticate(testAuthHandler())
+
+			req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Fatalf("expected %d, got %d", tt.status, w.Code)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var body map[string]any
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body["role"] != "user" || body["can_write"] != false {
+				t.Errorf("expected stored role and can_write, got %v", body)
+			}
+		})
+	}
+}
+
+func TestAuthenticate_JWT_DisabledUser(t *testing.T) {
+	userID := GenerateULID()
+	db := &mockAuthDB{
+		users: []map[string]any{
+			{"id": userID, "role": "admin", "can_write": true, "enabled": int64(0)},
+		},
+	}
+	am := NewAuthMiddleware(db, testJWTSecret(), "", NewJTIRevocationStore())
+	handler := am.Authenticate(testAuthHandler())
+
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set("Authorization", "Bearer "+createTestJWT(t, userID, "test-jti", "admin", true, 3600))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", w.Code)
+	}
+}
+
 func TestAuthenticate_ExpiredJWT(t *testing.T) {
 	userID := GenerateULID()
 	db := &mockAuthDB{
@@ -687,6 +803,28 @@ func TestAuthenticate_APIKey_Disabled(t *testing.T) {
 	}
 }
 
+func TestAuthenticate_APIKey_Expired(t *testing.T) {
+	raw, hash := createTestAPIKey()
+	db := &mockAuthDB{
+		apikeys: []map[string]any{
+			{"id": GenerateULID(), "key_hash": hash, "role": "user", "enabled": true,
+				"expires_at": time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)},
+		},
+	}
+
+	am := NewAuthMiddleware(db, testJWTSecret(), "", NewJTIRevocationStore())
+	handler := am.Authenticate(testAuthHandler())
+
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set("Authorization", "Bearer "+raw)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", w.Code)
+	}
+}
+
 func TestParseAllowedOrigins(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -1092,6 +1230,42 @@ func TestAuthorize_APIKeyCollectionsRestricted(t *testing.T) {
 	}
 }
 
+func TestAuthorize_APIKeyScopes(t *testing.T) {
+	identity := &AuthIdentity{
+		CredentialType: CredentialTypeAPIKey,
+		CallerID:       "key1",
+		Role:           "admin",
+		CanWrite:       true,
+		Collections:    []string{"products", "orders"},
+		Scopes:         []string{"products:read", "orders:*"},
+	}
+
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := Authorize("", inner)
+
+	tests := []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodGet, "/data/products:query", "", http.StatusOK},
+		{http.MethodGet, "/data/products:schema", "", http.StatusOK},
+		{http.MethodPost, "/data/products:mutate", `{"op":"create","data":[{}]}`, http.StatusForbidden},
+		{http.MethodPost, "/data/products:import", "", http.StatusForbidden},
+		{http.MethodPost, "/data/orders:mutate", `{"op":"destroy","data":[{"id":"x"}]}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		req = req.WithContext(SetAuthIdentity(req.Context(), identity))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s %s: expected %d, got %d", tt.method, tt.path, tt.want, w.Code)
+		}
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Integration tests - full middleware chain
 // ---------------------------------------------------------------------------
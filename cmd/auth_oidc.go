@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AuthOIDCHandler implements POST /auth:oidc, which signs users in through
+// the OpenID Connect provider in the oidc config section. op=start returns
+// the provider URL to send the user to; op=callback redeems the code the
+// provider returns and issues the same session as op=login on
+// /auth:session. External identities are linked to local users in the
+// internal moon_auth_identities table.
+type AuthOIDCHandler struct {
+	sessions *AuthSessionHandler
+	provider *OIDCProvider
+}
+
+// NewAuthOIDCHandler creates an AuthOIDCHandler that issues sessions through
+// sessions.
+func NewAuthOIDCHandler(sessions *AuthSessionHandler, provider *OIDCProvider) *AuthOIDCHandler {
+	return &AuthOIDCHandler{sessions: sessions, provider: provider}
+}
+
+// HandleOIDC dispatches op=start and op=callback.
+func (h *AuthOIDCHandler) HandleOIDC(w http.ResponseWriter, r *http.Request) {
+	var req authSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	switch req.Op {
+	case "start":
+		h.handleStart(w, r)
+	case "callback":
+		h.handleCallback(w, r, req.Data)
+	case "":
+		WriteError(w, http.StatusBadRequest, "Missing required field: op")
+	default:
+		WriteError(w, http.StatusBadRequest, "Invalid op: must be start or callback")
+	}
+}
+
+func (h *AuthOIDCHandler) handleStart(w http.ResponseWriter, r *http.Request) {
+	authURL, state, err := h.provider.AuthorizationURL(r.Context(), time.Now())
+	if err != nil {
+		h.logError(r.Context(), err)
+		WriteError(w, http.StatusBadGateway, "Identity provider unavailable")
+		return
+	}
+	WriteSuccess(w, http.StatusOK, "Login started", []any{map[string]any{
+		"authorization_url": authURL,
+		"state":             state,
+	}})
+}
+
+func (h *AuthOIDCHandler) handleCallback(w http.ResponseWriter, r *http.Request, data map[string]any) {
+	code, _ := data["code"].(string)
+	if code == "" {
+		WriteError(w, http.StatusBadRequest, "Missing required field: data.code")
+		return
+	}
+	state, _ := data["state"].(string)
+	if state == "" {
+		WriteError(w, http.StatusBadRequest, "Missing required field: data.state")
+		return
+	}
+
+	ctx := r.Context()
+	claims, err := h.provider.Exchange(ctx, code, state, time.Now())
+	if errors.Is(err, errOIDCLogin) {
+		WriteError(w, http.StatusUnauthorized, "Invalid credentials")
+		return
+	}
+	if err != nil {
+		h.logError(ctx, err)
+		WriteError(w, http.StatusBadGateway, "Identity provider unavailable")
+		return
+	}
+
+	user, status, msg := h.resolveUser(ctx, claims)
+	if user == nil {
+		WriteError(w, status, msg)
+		return
+	}
+
+	// The provider stands in for the password only; the lockout and
+	// two-factor checks of a password login still apply.
+	policy := h.sessions.cfg.Passwords()
+	until, err := policy.LockedUntil(ctx, h.sessions.db, stringVal(user, "id"), time.Now())
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if !until.IsZero() {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(until).Seconds()))))
+		WriteError(w, http.StatusForbidden, "Account is locked")
+		return
+	}
+	totp, err := loadTOTP(ctx, h.sessions.db, stringVal(user, "id"))
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if totpEnabled(totp) {
+		code, _ := data["totp_code"].(string)
+		recovery, _ := data["recovery_code"].(string)
+		if code == "" && recovery == "" {
+			WriteError(w, http.StatusUnauthorized, "Two-factor code required")
+			return
+		}
+		passed, err := consumeSecondFactor(ctx, h.sessions.db, h.sessions.cfg.JWTSecret, totp, code, recovery)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		if !passed {
+			if err := h.sessions.recordAccountFailure(ctx, policy, user); err != nil {
+				WriteError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			WriteError(w, http.StatusUnauthorized, "Invalid two-factor code")
+			return
+		}
+	}
+	if policy.LockoutThreshold > 0 {
+		if err := ClearLockout(ctx, h.sessions.db, stringVal(user, "id")); err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+	}
+
+	if !enabledValue(user) {
+		WriteError(w, http.StatusForbidden, "Account is disabled")
+		return
+	}
+	if err := checkInvitationAccepted(ctx, h.sessions.db, stringVal(user, "id")); errors.Is(err, errInvitationPending) {
+		WriteError(w, http.StatusForbidden, "Account invitation has not been accepted")
+		return
+	} else if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	userID := stringVal(user, "id")
+	role := stringVal(user, "role")
+	payload, err := h.sessions.issueSession(ctx, userID, role, toBool(user["can_write"]), user, newClientSession(r))
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	_ = h.sessions.db.UpdateRow(ctx, "users", userID, map[string]any{
+		"last_login_at": now,
+		"updated_at":    now,
+	})
+	payload.User.LastLoginAt = &now
+
+	if logger := h.sessions.logger; logger != nil {
+		logger.AuditEventContext(ctx, AuditAuthSuccess,
+			"method", "oidc",
+			"actor", userID,
+			"timestamp", now,
+		)
+	}
+	WriteSuccess(w, http.StatusOK, "Login successful", []any{payload})
+}
+
+// resolveUser returns the local user for the external identity in claims,
+// linking or provisioning one as configured. When no user is returned,
+// status and msg describe the error response.
+func (h *AuthOIDCHandler) resolveUser(ctx context.Context, claims *oidcClaims) (map[string]any, int, string) {
+	db := h.sessions.db
+	cfg := h.sessions.cfg.OIDC
+	email := strings.ToLower(claims.Email)
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	identities, _, err := db.QueryRows(ctx, "moon_auth_identities", QueryOptions{
+		Filters: []Filter{
+			{Field: "issuer", Op: "eq", Value: cfg.Issuer},
+			{Field: "subject", Op: "eq", Value: claims.Subject},
+		},
+		Page:    1,
+		PerPage: 1,
+	})
+	if err != nil {
+		return nil, http.StatusInternalServerError, "Internal server error"
+	}
+	if len(identities) > 0 {
+		user, err := lookupUser(ctx, db, "id", stringVal(identities[0], "user_id"))
+		if err != nil {
+			return nil, http.StatusInternalServerError, "Internal server error"
+		}
+		if user == nil {
+			return nil, http.StatusUnauthorized, "Invalid credentials"
+		}
+		_ = db.UpdateRow(ctx, "moon_auth_identities", stringVal(identities[0], "id"), map[string]any{
+			"email":         email,
+			"last_login_at": now,
+		})
+		return user, 0, ""
+	}
+
+	// A verified email links the identity to the existing account with
+	// that address, unless the account is an admin or uses two-factor
+	// authentication: control of the email must not be enough to take
+	// those over.
+	var user map[string]any
+	if email != "" && claims.EmailVerified {
+		if user, err = lookupUser(ctx, db, "email", email); err != nil {
+			return nil, http.StatusInternalServerError, "Internal server error"
+		}
+	}
+	if user != nil {
+		totp, err := loadTOTP(ctx, db, stringVal(user, "id"))
+		if err != nil {
+			return nil, http.StatusInternalServerError, "Internal server error"
+		}
+		if stringVal(user, "role") == "admin" || totpEnabled(totp) {
+			return nil, http.StatusForbidden, "This account cannot be linked to an identity provider"
+		}
+	}
+	if user == nil {
+		if !cfg.AutoProvision {
+			return nil, http.StatusForbidden, "No account is linked to this identity"
+		}
+		var status int
+		var msg string
+		if user, status, msg = h.provisionUser(ctx, claims, email); user == nil {
+			return nil, status, msg
+		}
+	}
+
+	if err := db.InsertRow(ctx, "moon_auth_identities", map[string]any{
+		"id":            GenerateULID(),
+		"user_id":       stringVal(user, "id"),
+		"issuer":        cfg.Issuer,
+		"subject":       claims.Subject,
+		"email":         email,
+		"created_at":    now,
+		"last_login_at": now,
+	}); err != nil {
+		return nil, http.StatusInternalServerError, "Internal server error"
+	}
+	return user, 0, ""
+}
+
+// provisionUser creates a local user for a new external identity. The
+// username is the provider's preferred_username, or the email when that is
+// missing or taken. The account gets a random password, so it can only
+// sign in through the provider until an admin resets it.
+func (h *AuthOIDCHandler) provisionUser(ctx context.Context, claims *oidcClaims, email string) (map[string]any, int, string) {
+	db := h.sessions.db
+	if !isValidEmail(email) {
+		return nil, http.StatusForbidden, "Identity provider did not return an email address"
+	}
+	if existing, err := lookupUser(ctx, db, "email", email); err != nil {
+		return nil, http.StatusInternalServerError, "Internal server error"
+	} else if existing != nil {
+		return nil, http.StatusConflict, "An account with this email already exists"
+	}
+
+	username := strings.ToLower(claims.PreferredUsername)
+	if username != "" {
+		if taken, err := lookupUser(ctx, db, "username", username); err != nil {
+			return nil, http.StatusInternalServerError, "Internal server error"
+		} else if taken != nil {
+			username = ""
+		}
+	}
+	if username == "" {
+		username = email
+	}
+
+	hash, err := HashPassword(randomURLString())
+	if err != nil {
+		return nil, http.StatusInternalServerError, "Internal server error"
+	}
+	row := newUserRow(username, email, h.sessions.cfg.OIDC.DefaultRole, false, hash)
+	if err := db.InsertRow(ctx, "users", row); err != nil {
+		return nil, http.StatusConflict, "An account with this username already exists"
+	}
+	if logger := h.sessions.logger; logger != nil {
+		logger.AuditEventContext(ctx, AuditAdminUserManagement,
+			"action", "oidc.provision",
+			"actor", row["id"],
+			"target", row["username"],
+		)
+	}
+	return row, 0, ""
+}
+
+func (h *AuthOIDCHandler) logError(ctx context.Context, err error) {
+	if logger := h.sessions.logger; logger != nil {
+		logger.ErrorContext(ctx, "oidc provider request failed", "error", err)
+	}
+}
+
+// lookupUser returns the user whose field equals value, or nil.
+func lookupUser(ctx context.Context, db DatabaseAdapter, field, value string) (map[string]any, error) {
+	rows, _, err := db.QueryRows(ctx, "users", QueryOptions{
+		Filters: []Filter{{Field: field, Op: "eq", Value: value}},
+		Page:    1,
+		PerPage: 1,
+	})
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	return rows[0], nil
+}
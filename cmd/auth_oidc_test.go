@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeIdP is an OpenID provider that issues an ID token for each code
+// registered by login.
+type fakeIdP struct {
+	srv   *httptest.Server
+	key   *rsa.PrivateKey
+	mu    sync.Mutex
+	codes map[string]fakeGrant
+}
+
+type fakeGrant struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &fakeIdP{key: key, codes: map[string]fakeGrant{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                 idp.srv.URL,
+			"authorization_endpoint": idp.srv.URL + "/authorize",
+			"token_endpoint":         idp.srv.URL + "/token",
+			"jwks_uri":               idp.srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []any{map[string]any{
+			"kty": "RSA",
+			"kid": "k1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		grant, ok := idp.codes[r.PostFormValue("code")]
+		idp.mu.Unlock()
+		sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, grant.claims)
+		token.Header["kid"] = "k1"
+		signed, err := token.SignedString(key)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"id_token": signed})
+	})
+	idp.srv = httptest.NewServer(mux)
+	t.Cleanup(idp.srv.Close)
+	return idp
+}
+
+func setupOIDCTest(t *testing.T) (*AuthOIDCHandler, DatabaseAdapter, *fakeIdP) {
+	t.Helper()
+	auth, db := setupAuthTest(t)
+	idp := newFakeIdP(t)
+	auth.cfg.OIDC = OIDCConfig{
+		Issuer:        idp.srv.URL,
+		ClientID:      "moon",
+		RedirectURI:   "https://app.example.com/callback",
+		Scopes:        DefaultOIDCScopes,
+		AutoProvision: true,
+		DefaultRole:   "user",
+	}
+	return NewAuthOIDCHandler(auth, NewOIDCProvider(auth.cfg.OIDC, auth.cfg.JWTSecret)), db, idp
+}
+
+func doOIDCRequest(t *testing.T, h *AuthOIDCHandler, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	payload, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/auth:oidc", bytes.NewReader(payload))
+	w := httptest.NewRecorder()
+	h.HandleOIDC(w, req)
+	return w
+}
+
+// oidcLogin runs op=start, lets the fake provider authorize the login with
+// claims, and returns the op=callback response. modify may change the
+// claims after the nonce is filled in.
+func oidcLogin(t *testing.T, h *AuthOIDCHandler, idp *fakeIdP, claims jwt.MapClaims, modify func(jwt.MapClaims)) *httptest.ResponseRecorder {
+	t.Helper()
+	return oidcLoginWith(t, h, idp, claims, modify, nil)
+}
+
+// oidcLoginWith is oidcLogin with extra fields in the callback data.
+func oidcLoginWith(t *testing.T, h *AuthOIDCHandler, idp *fakeIdP, claims jwt.MapClaims, modify func(jwt.MapClaims), extra map[string]any) *httptest.ResponseRecorder {
+	t.Helper()
+	w := doOIDCRequest(t, h, map[string]any{"op": "start"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("start: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	start := decodeResponse(t, w)["data"].([]any)[0].(map[string]any)
+	authURL, err := url.Parse(start["authorization_url"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := authURL.Query()
+	if q.Get("state") != start["state"] || q.Get("client_id") != "moon" || q.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected authorization url %s", authURL)
+	}
+
+	full := jwt.MapClaims{
+		"iss":   idp.srv.URL,
+		"aud":   "moon",
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": q.Get("nonce"),
+	}
+	for k, v := range claims {
+		full[k] = v
+	}
+	if modify != nil {
+		modify(full)
+	}
+	code := GenerateULID()
+	idp.mu.Lock()
+	idp.codes[code] = fakeGrant{challenge: q.Get("code_challenge"), claims: full}
+	idp.mu.Unlock()
+
+	data := map[string]any{"code": code, "state": start["state"]}
+	for k, v := range extra {
+		data[k] = v
+	}
+	return doOIDCRequest(t, h, map[string]any{"op": "callback", "data": data})
+}
+
+func TestAuthOIDC_ProvisionAndLink(t *testing.T) {
+	h, db, idp := setupOIDCTest(t)
+	ctx := context.Background()
+
+	claims := jwt.MapClaims{"sub": "ext-1", "email": "Jane@Example.com", "preferred_username": "jane"}
+	w := oidcLogin(t, h, idp, claims, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	session := decodeResponse(t, w)["data"].([]any)[0].(map[string]any)
+	user := session["user"].(map[string]any)
+	if user["username"] != "jane" || user["email"] != "jane@example.com" || user["role"] != "user" || user["can_write"] != false {
+		t.Errorf("unexpected provisioned user: %v", user)
+	}
+	if session["access_token"] == "" || session["refresh_token"] == "" {
+		t.Error("expected a token pair")
+	}
+
+	// The identity stays linked when the provider's email changes.
+	claims["email"] = "jane.doe@example.com"
+	w = oidcLogin(t, h, idp, claims, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("second login: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := decodeResponse(t, w)["data"].([]any)[0].(map[string]any)["user"].(map[string]any)["id"]; got != user["id"] {
+		t.Errorf("expected the linked user %v, got %v", user["id"], got)
+	}
+
+	// A verified email links a new identity to the existing account.
+	bob := newUserRow("bob", "bob@example.com", "user", false, "hash")
+	if err := db.InsertRow(ctx, "users", bob); err != nil {
+		t.Fatal(err)
+	}
+	w = oidcLogin(t, h, idp, jwt.MapClaims{"sub": "ext-2", "email": "bob@example.com", "email_verified": true}, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("link: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := decodeResponse(t, w)["data"].([]any)[0].(map[string]any)["user"].(map[string]any)["id"]; got != bob["id"] {
+		t.Errorf("expected the existing user, got %v", got)
+	}
+
+	// An admin account is never linked by email.
+	w = oidcLogin(t, h, idp, jwt.MapClaims{"sub": "ext-4", "email": "test@example.com", "email_verified": true}, nil)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for linking an admin, got %d", w.Code)
+	}
+
+	// An unverified email matching an account is not trusted.
+	w = oidcLogin(t, h, idp, jwt.MapClaims{"sub": "ext-3", "email": "test@example.com"}, nil)
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected 409 for an unverified existing email, got %d", w.Code)
+	}
+
+	rows, _, err := db.QueryRows(ctx, "moon_auth_identities", QueryOptions{Page: 1, PerPage: 10})
+	if err != nil || len(rows) != 2 {
+		t.Fatalf("expected 2 identities, got %d (%v)", len(rows), err)
+	}
+}
+
+func TestAuthOIDC_Rejections(t *testing.T) {
+	h, db, idp := setupOIDCTest(t)
+	claims := jwt.MapClaims{"sub": "ext-1", "email": "jane@example.com"}
+
+	for _, tt := range []struct {
+		name   string
+		modify func(jwt.MapClaims)
+	}{
+		{"wrong nonce", func(c jwt.MapClaims) { c["nonce"] = "other" }},
+		{"wrong audience", func(c jwt.MapClaims) { c["aud"] = "another-client" }},
+		{"wrong issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{"no subject", func(c jwt.MapClaims) { delete(c, "sub") }},
+	} {
+		if w := oidcLogin(t, h, idp, claims, tt.modify); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got %d", tt.name, w.Code)
+		}
+	}
+
+	if w := doOIDCRequest(t, h, map[string]any{"op": "callback", "data": map[string]any{"code": "x", "state": "forged"}}); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a forged state, got %d", w.Code)
+	}
+	if w := doOIDCRequest(t, h, map[string]any{"op": "callback", "data": map[string]any{"state": "x"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without a code, got %d", w.Code)
+	}
+
+	h.sessions.cfg.OIDC.AutoProvision = false
+	if w := oidcLogin(t, h, idp, claims, nil); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 without auto-provisioning, got %d", w.Code)
+	}
+
+	linkIdentity(t, db, idp, "ext-2", authTwoFactorTestUser)
+	if err := db.UpdateRow(context.Background(), "users", authTwoFactorTestUser, map[string]any{"enabled": 0}); err != nil {
+		t.Fatal(err)
+	}
+	if w := oidcLogin(t, h, idp, jwt.MapClaims{"sub": "ext-2", "email": "test@example.com", "email_verified": true}, nil); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a disabled account, got %d", w.Code)
+	}
+}
+
+// linkIdentity links subject at the fake provider to userID, as an
+// explicit link would.
+func linkIdentity(t *testing.T, db DatabaseAdapter, idp *fakeIdP, subject, userID string) {
+	t.Helper()
+	now := time.Now().UTC().Format(time.RFC3339)
+	if err := db.InsertRow(context.Background(), "moon_auth_identities", map[string]any{
+		"id":            GenerateULID(),
+		"user_id":       userID,
+		"issuer":        idp.srv.URL,
+		"subject":       subject,
+		"email":         "",
+		"created_at":    now,
+		"last_login_at": now,
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuthOIDC_TwoFactorAndLockout(t *testing.T) {
+	h, db, idp := setupOIDCTest(t)
+	policy := DefaultPasswordPolicy()
+	policy.LockoutThreshold = 1
+	h.sessions.cfg.PasswordPolicy = policy
+	secret, _ := enableTwoFactor(t, NewAuthTwoFactorHandler(db, h.sessions.cfg, nil))
+	linkIdentity(t, db, idp, "ext-1", authTwoFactorTestUser)
+	claims := jwt.MapClaims{"sub": "ext-1", "email": "test@example.com", "email_verified": true}
+
+	// A two-factor account is not linked by email either.
+	if w := oidcLogin(t, h, idp, jwt.MapClaims{"sub": "ext-2", "email": "test@example.com", "email_verified": true}, nil); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for linking a two-factor account, got %d", w.Code)
+	}
+
+	if w := oidcLogin(t, h, idp, claims, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a two-factor code, got %d", w.Code)
+	}
+	// verify used the current step, so the next one is the first valid code.
+	code := totpCode(secret, totpStep(time.Now())+1)
+	if w := oidcLoginWith(t, h, idp, claims, nil, map[string]any{"totp_code": code}); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 with a two-factor code, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// A wrong code counts as a failure and locks the account.
+	if w := oidcLoginWith(t, h, idp, claims, nil, map[string]any{"totp_code": "000000"}); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a wrong code, got %d", w.Code)
+	}
+	if w := oidcLoginWith(t, h, idp, claims, nil, map[string]any{"totp_code": code}); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a locked account, got %d", w.Code)
+	}
+}
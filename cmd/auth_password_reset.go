@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// AuthPasswordResetHandler implements POST /auth:forgot and POST
+// /auth:reset. /auth:forgot emails a single-use reset token to the address
+// of an account; /auth:reset redeems it for a new password. Only the
+// SHA-256 hash of each token is kept, in the internal
+// moon_auth_password_resets table.
+type AuthPasswordResetHandler struct {
+	db          DatabaseAdapter
+	cfg         *AppConfig
+	mailer      Mailer
+	logger      *Logger
+	rateLimiter *RateLimiter
+}
+
+// NewAuthPasswordResetHandler creates an AuthPasswordResetHandler that
+// sends reset emails through mailer.
+func NewAuthPasswordResetHandler(db DatabaseAdapter, cfg *AppConfig, mailer Mailer, logger *Logger, rl *RateLimiter) *AuthPasswordResetHandler {
+	return &AuthPasswordResetHandler{db: db, cfg: cfg, mailer: mailer, logger: logger, rateLimiter: rl}
+}
+
+// forgotMessage is returned by /auth:forgot whether or not the email
+// belongs to an account, so the endpoint cannot be used to find accounts.
+const forgotMessage = "If an account with that email exists, a password reset email has been sent"
+
+// HandleForgot handles POST /auth:forgot.
+func (h *AuthPasswordResetHandler) HandleForgot(w http.ResponseWriter, r *http.Request) {
+	data, ok := decodeResetRequest(w, r)
+	if !ok {
+		return
+	}
+	email, _ := data["email"].(string)
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		WriteError(w, http.StatusBadRequest, "Missing required field: data.email")
+		return
+	}
+	if !isValidEmail(email) {
+		WriteError(w, http.StatusBadRequest, "Invalid email address")
+		return
+	}
+
+	ctx := r.Context()
+	ip := clientIP(r)
+	if h.rateLimiter != nil && !h.rateLimiter.AllowPasswordReset(ip, email) {
+		if h.logger != nil {
+			h.logger.AuditEventContext(ctx, AuditRateLimitViolation,
+				"limit_type", RateLimitTypePasswordReset,
+				"actor", ip,
+				"timestamp", time.Now().UTC().Format(time.RFC3339),
+			)
+		}
+		WriteError(w, http.StatusTooManyRequests, "Too many requests")
+		return
+	}
+
+	user, err := lookupUser(ctx, h.db, "email", email)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if user == nil || !enabledValue(user) {
+		WriteSuccess(w, http.StatusOK, forgotMessage, []any{})
+		return
+	}
+	// A pending user sets a password by accepting the invitation.
+	if err := checkInvitationAccepted(ctx, h.db, stringVal(user, "id")); errors.Is(err, errInvitationPending) {
+		WriteSuccess(w, http.StatusOK, forgotMessage, []any{})
+		return
+	} else if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	raw, err := h.createToken(ctx, stringVal(user, "id"))
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	msg, err := h.resetMessage(user, raw)
+	if err != nil {
+		if h.logger != nil {
+			h.logger.ErrorContext(ctx, "password reset email failed", "error", err)
+		}
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	// The email is sent after responding, so the response time does not
+	// reveal whether the account exists.
+	go func() {
+		sendCtx := context.WithoutCancel(ctx)
+		if err := h.mailer.Send(sendCtx, msg); err != nil && h.logger != nil {
+			h.logger.ErrorContext(sendCtx, "password reset email failed", "error", err)
+		}
+	}()
+	WriteSuccess(w, http.StatusOK, forgotMessage, []any{})
+}
+
+// HandleReset handles POST /auth:reset.
+func (h *AuthPasswordResetHandler) HandleReset(w http.ResponseWriter, r *http.Request) {
+	data, ok := decodeResetRequest(w, r)
+	if !ok {
+		return
+	}
+	token, _ := data["token"].(string)
+	if token == "" {
+		WriteError(w, http.StatusBadRequest, "Missing required field: data.token")
+		return
+	}
+	password, _ := data["password"].(string)
+	if password == "" {
+		WriteError(w, http.StatusBadRequest, "Missing required field: data.password")
+		return
+	}
+
+	ctx := r.Context()
+	rows, _, err := h.db.QueryRows(ctx, "moon_auth_password_resets", QueryOptions{
+		Filters: []Filter{{Field: "token_hash", Op: "eq", Value: HashRefreshToken(token)}},
+		Page:    1,
+		PerPage: 1,
+	})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if len(rows) == 0 || rows[0]["used_at"] != nil {
+		WriteError(w, http.StatusUnauthorized, "Invalid or expired reset token")
+		return
+	}
+	reset := rows[0]
+	expiresAt, err := time.Parse(time.RFC3339, stringVal(reset, "expires_at"))
+	if err != nil || !time.Now().Before(expiresAt) {
+		WriteError(w, http.StatusUnauthorized, "Invalid or expired reset token")
+		return
+	}
+
+	userID := stringVal(reset, "user_id")
+	user, err := lookupUser(ctx, h.db, "id", userID)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if user == nil || !enabledValue(user) {
+		WriteError(w, http.StatusUnauthorized, "Invalid or expired reset token")
+		return
+	}
+
+	policy := h.cfg.Passwords()
+	if err := policy.Validate(password); err != nil {
+		WriteError(w, http.StatusBadRequest, passwordPolicyViolation(err))
+		return
+	}
+	if err := policy.CheckHistory(ctx, h.db, user, password); errors.Is(err, errPasswordReused) {
+		WriteError(w, http.StatusBadRequest, passwordPolicyViolation(err))
+		return
+	} else if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	// The token is claimed before the password changes, so of two requests
+	// redeeming it at once only one can succeed.
+	now := time.Now().UTC().Format(time.RFC3339)
+	claimed, err := h.db.UpdateWhere(ctx, "moon_auth_password_resets", []Filter{
+		{Field: "id", Op: "eq", Value: stringVal(reset, "id")},
+		{Field: "used_at", Op: "is_null"},
+	}, map[string]any{"used_at": now}, false, 1)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if claimed != 1 {
+		WriteError(w, http.StatusUnauthorized, "Invalid or expired reset token")
+		return
+	}
+	if err := h.db.UpdateRow(ctx, "users", userID, map[string]any{
+		"password_hash": hash,
+		"updated_at":    now,
+	}); err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if err := policy.RecordHistory(ctx, h.db, userID, stringVal(user, "password_hash")); err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if err := h.deleteUnusedTokens(ctx, userID); err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if err := h.revokeAllRefreshTokens(ctx, userID, "password_reset"); err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if err := ClearLockout(ctx, h.db, userID); err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	if h.logger != nil {
+		h.logger.AuditEventContext(ctx, AuditPasswordReset,
+			"actor", userID,
+			"target", stringVal(user, "username"),
+			"timestamp", now,
+		)
+	}
+	WriteSuccess(w, http.StatusOK, "Password reset successfully. Sign in with the new password.", []any{})
+}
+
+// decodeResetRequest reads the data object of a /auth:forgot or
+// /auth:reset body, writing a 400 response when it is missing.
+func decodeResetRequest(w http.ResponseWriter, r *http.Request) (map[string]any, bool) {
+	var body struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid JSON body")
+		return nil, false
+	}
+	if body.Data == nil {
+		WriteError(w, http.StatusBadRequest, "Missing required field: data")
+		return nil, false
+	}
+	return body.Data, true
+}
+
+// createToken stores a new reset token for userID, replacing any unused
+// one, and returns the raw token.
+func (h *AuthPasswordResetHandler) createToken(ctx context.Context, userID string) (string, error) {
+	if err := h.deleteUnusedTokens(ctx, userID); err != nil {
+		return "", err
+	}
+	raw, hash, err := GenerateRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().UTC()
+	return raw, h.db.InsertRow(ctx, "moon_auth_password_resets", map[string]any{
+		"id":         GenerateULID(),
+		"user_id":    userID,
+		"token_hash": hash,
+		"expires_at": now.Add(time.Duration(h.cfg.PasswordReset.TokenTTL) * time.Second).Format(time.RFC3339),
+		"used_at":    nil,
+		"created_at": now.Format(time.RFC3339),
+	})
+}
+
+// deleteUnusedTokens removes the reset tokens of userID that were never
+// redeemed. Deleted rows leave the filter, so the first page is read
+// until it comes back short.
+func (h *AuthPasswordResetHandler) deleteUnusedTokens(ctx context.Context, userID string) error {
+	for {
+		rows, _, err := h.db.QueryRows(ctx, "moon_auth_password_resets", QueryOptions{
+			Filters: []Filter{{Field: "user_id", Op: "eq", Value: userID}, {Field: "used_at", Op: "is_null"}},
+			Sort:    []SortField{{Field: "id"}},
+			Page:    1,
+			PerPage: MaxPerPage,
+		})
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if err := h.db.DeleteRow(ctx, "moon_auth_password_resets", stringVal(row, "id")); err != nil {
+				return err
+			}
+		}
+		if len(rows) < MaxPerPage {
+			return nil
+		}
+	}
+}
+
+// resetMessage renders the reset email for token. With password_reset.url
+// set, the email links to it with the token in the token query parameter.
+func (h *AuthPasswordResetHandler) resetMessage(user map[string]any, token string) (MailMessage, error) {
+	data := PasswordResetMail{
+		Username:  stringVal(user, "username"),
+		Email:     stringVal(user, "email"),
+		Token:     token,
+		ExpiresIn: (time.Duration(h.cfg.PasswordReset.TokenTTL) * time.Second).String(),
+	}
+	if h.cfg.PasswordReset.URL != "" {
+		link, _ := url.Parse(h.cfg.PasswordReset.URL)
+		q := link.Query()
+		q.Set("token", token)
+		link.RawQuery = q.Encode()
+		data.URL = link.String()
+	}
+	return h.cfg.Mail.templates().Render(MailTemplatePasswordReset, data.Email, data)
+}
+
+// revokeAllRefreshTokens revokes all non-revoked refresh tokens for a user.
+// Revoked rows leave the filter, so the first page is read until it comes
+// back short.
+func (h *AuthPasswordResetHandler) revokeAllRefreshTokens(ctx context.Context, userID, reason string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	for {
+		rows, _, err := h.db.QueryRows(ctx, "moon_auth_refresh_tokens", QueryOptions{
+			Filters: []Filter{{Field: "user_id", Op: "eq", Value: userID}, {Field: "revoked_at", Op: "is_null"}},
+			Sort:    []SortField{{Field: "id"}},
+			Page:    1,
+			PerPage: MaxPerPage,
+		})
+		if err != nil {
+			return fmt.Errorf("revoke tokens: query: %w", err)
+		}
+		for _, row := range rows {
+			if err := h.db.UpdateRow(ctx, "moon_auth_refresh_tokens", stringVal(row, "id"), map[string]any{
+				"revoked_at":        now,
+				"revocation_reason": reason,
+			}); err != nil {
+				return fmt.Errorf("revoke tokens: update: %w", err)
+			}
+		}
+		if len(rows) < MaxPerPage {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fakeMailer records sent messages on a channel.
+type fakeMailer struct {
+	sent chan MailMessage
+}
+
+func (m *fakeMailer) Send(_ context.Context, msg MailMessage) error {
+	m.sent <- msg
+	return nil
+}
+
+func setupPasswordResetTest(t *testing.T) (*AuthPasswordResetHandler, *fakeMailer, DatabaseAdapter) {
+	t.Helper()
+	sessions, db := setupAuthTest(t)
+	sessions.cfg.PasswordReset = PasswordResetConfig{URL: "https://app.example.com/reset", TokenTTL: DefaultPasswordResetTokenTTL}
+	mailer := &fakeMailer{sent: make(chan MailMessage, 4)}
+	return NewAuthPasswordResetHandler(db, sessions.cfg, mailer, nil, NewRateLimiter()), mailer, db
+}
+
+func doResetRequest(t *testing.T, handle http.HandlerFunc, path string, data map[string]any) *httptest.ResponseRecorder {
+	t.Helper()
+	body, _ := json.Marshal(map[string]any{"data": data})
+	w := httptest.NewRecorder()
+	handle(w, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body)))
+	return w
+}
+
+var resetTokenRegex = regexp.MustCompile(`token=([A-Za-z0-9_-]+)`)
+
+// requestResetToken asks for a reset email and returns the token it carries.
+func requestResetToken(t *testing.T, h *AuthPasswordResetHandler, mailer *fakeMailer) string {
+	t.Helper()
+	if w := doResetRequest(t, h.HandleForgot, "/auth:forgot", map[string]any{"email": "Test@Example.com"}); w.Code != http.StatusOK {
+		t.Fatalf("forgot: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	select {
+	case msg := <-mailer.sent:
+		if msg.To != "test@example.com" || !strings.HasPrefix(msg.Body[strings.Index(msg.Body, "https://"):], "https://app.example.com/reset?token=") {
+			t.Fatalf("unexpected email %+v", msg)
+		}
+		return resetTokenRegex.FindStringSubmatch(msg.Body)[1]
+	case <-time.After(2 * time.Second):
+		t.Fatal("no email sent")
+	}
+	return ""
+}
+
+func TestPasswordReset_Flow(t *testing.T) {
+	h, mailer, db := setupPasswordResetTest(t)
+	ctx := context.Background()
+	if err := db.InsertRow(ctx, "moon_auth_refresh_tokens", map[string]any{
+		"id":                 "01REFRESH0000000000000001",
+		"user_id":            "01TESTUSER000000000000001",
+		"refresh_token_hash": "hash",
+		"expires_at":         time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+		"created_at":         time.Now().UTC().Format(time.RFC3339),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	token := requestResetToken(t, h, mailer)
+	rows, _, err := db.QueryRows(ctx, "moon_auth_password_resets", QueryOptions{Page: 1, PerPage: 10})
+	if err != nil || len(rows) != 1 {
+		t.Fatalf("expected 1 reset row, got %d (%v)", len(rows), err)
+	}
+	if stringVal(rows[0], "token_hash") == token {
+		t.Fatal("the token must be stored hashed")
+	}
+
+	if w := doResetRequest(t, h.HandleReset, "/auth:reset", map[string]any{"token": token, "password": "short"}); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected a weak password to be rejected, got %d", w.Code)
+	}
+	if w := doResetRequest(t, h.HandleReset, "/auth:reset", map[string]any{"token": token, "password": "NewPass22"}); w.Code != http.StatusOK {
+		t.Fatalf("reset: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	user, _ := lookupUser(ctx, db, "id", "01TESTUSER000000000000001")
+	if err := bcrypt.CompareHashAndPassword([]byte(stringVal(user, "password_hash")), []byte("NewPass22")); err != nil {
+		t.Error("expected the password to be changed")
+	}
+	refresh, _, _ := db.QueryRows(ctx, "moon_auth_refresh_tokens", QueryOptions{Page: 1, PerPage: 10})
+	if len(refresh) != 1 || stringVal(refresh[0], "revocation_reason") != "password_reset" {
+		t.Errorf("expected the refresh token to be revoked, got %v", refresh)
+	}
+
+	// Tokens are single-use.
+	if w := doResetRequest(t, h.HandleReset, "/auth:reset", map[string]any{"token": token, "password": "Other333"}); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected a used token to be rejected, got %d", w.Code)
+	}
+}
+
+func TestPasswordReset_RevokesEveryRefreshToken(t *testing.T) {
+	h, mailer, db := setupPasswordResetTest(t)
+	ctx := context.Background()
+	n := MaxPerPage + 5
+	for i := 0; i < n; i++ {
+		if err := db.InsertRow(ctx, "moon_auth_refresh_tokens", map[string]any{
+			"id":                 GenerateULID(),
+			"user_id":            "01TESTUSER000000000000001",
+			"refresh_token_hash": fmt.Sprintf("hash-%d", i),
+			"expires_at":         time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+			"created_at":         time.Now().UTC().Format(time.RFC3339),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	token := requestResetToken(t, h, mailer)
+	if w := doResetRequest(t, h.HandleReset, "/auth:reset", map[string]any{"token": token, "password": "NewPass22"}); w.Code != http.StatusOK {
+		t.Fatalf("reset: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	_, active, err := db.QueryRows(ctx, "moon_auth_refresh_tokens", QueryOptions{
+		Filters: []Filter{{Field: "revoked_at", Op: "is_null"}},
+		Page:    1,
+		PerPage: 1,
+	})
+	if err != nil || active != 0 {
+		t.Errorf("expected all %d refresh tokens revoked, %d left (%v)", n, active, err)
+	}
+}
+
+func TestPasswordReset_ConcurrentRedemption(t *testing.T) {
+	h, mailer, _ := setupPasswordResetTest(t)
+	token := requestResetToken(t, h, mailer)
+
+	const attempts = 5
+	codes := make(chan int, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := doResetRequest(t, h.HandleReset, "/auth:reset", map[string]any{"token": token, "password": fmt.Sprintf("NewPass%d2", i)})
+			codes <- w.Code
+		}(i)
+	}
+	wg.Wait()
+	close(codes)
+	succeeded := 0
+	for code := range codes {
+		if code == http.StatusOK {
+			succeeded++
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("expected exactly one redemption to succeed, got %d", succeeded)
+	}
+}
+
+func TestPasswordReset_InvalidTokens(t *testing.T) {
+	h, mailer, db := setupPasswordResetTest(t)
+	ctx := context.Background()
+
+	if w := doResetRequest(t, h.HandleReset, "/auth:reset", map[string]any{"token": "bogus", "password": "NewPass22"}); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected an unknown token to be rejected, got %d", w.Code)
+	}
+
+	// A new request replaces the previous unused token.
+	first := requestResetToken(t, h, mailer)
+	second := requestResetToken(t, h, mailer)
+	if w := doResetRequest(t, h.HandleReset, "/auth:reset", map[string]any{"token": first, "password": "NewPass22"}); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected a replaced token to be rejected, got %d", w.Code)
+	}
+
+	rows, _, _ := db.QueryRows(ctx, "moon_auth_password_resets", QueryOptions{Page: 1, PerPage: 10})
+	if len(rows) != 1 {
+		t.Fatalf("expected 1 reset row, got %d", len(rows))
+	}
+	if err := db.UpdateRow(ctx, "moon_auth_password_resets", stringVal(rows[0], "id"), map[string]any{
+		"expires_at": time.Now().Add(-time.Second).UTC().Format(time.RFC3339),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if w := doResetRequest(t, h.HandleReset, "/auth:reset", map[string]any{"token": second, "password": "NewPass22"}); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected an expired token to be rejected, got %d", w.Code)
+	}
+}
+
+func TestPasswordForgot_UnknownEmail(t *testing.T) {
+	h, mailer, db := setupPasswordResetTest(t)
+
+	w := doResetRequest(t, h.HandleForgot, "/auth:forgot", map[string]any{"email": "nobody@example.com"})
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), forgotMessage) {
+		t.Fatalf("expected the generic response, got %d: %s", w.Code, w.Body.String())
+	}
+	select {
+	case msg := <-mailer.sent:
+		t.Errorf("expected no email, got %+v", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+	rows, _, _ := db.QueryRows(context.Background(), "moon_auth_password_resets", QueryOptions{Page: 1, PerPage: 10})
+	if len(rows) != 0 {
+		t.Errorf("expected no reset rows, got %d", len(rows))
+	}
+
+	if w := doResetRequest(t, h.HandleForgot, "/auth:forgot", map[string]any{"email": "not-an-email"}); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid email, got %d", w.Code)
+	}
+}
+
+func TestPasswordForgot_RateLimit(t *testing.T) {
+	h, mailer, _ := setupPasswordResetTest(t)
+	for i := 0; i < RatePasswordResetLimit; i++ {
+		if w := doResetRequest(t, h.HandleForgot, "/auth:forgot", map[string]any{"email": "nobody@example.com"}); w.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i+1, w.Code)
+		}
+	}
+	if w := doResetRequest(t, h.HandleForgot, "/auth:forgot", map[string]any{"email": "test@example.com"}); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the IP to be limited, got %d", w.Code)
+	}
+	select {
+	case msg := <-mailer.sent:
+		t.Errorf("expected no email, got %+v", msg)
+	default:
+	}
+
+	// The per-email limit applies across IPs.
+	if !h.rateLimiter.AllowPasswordReset("203.0.113.9", "other@example.com") {
+		t.Fatal("expected a new IP and email to be allowed")
+	}
+	for i := 1; i < RatePasswordResetLimit; i++ {
+		h.rateLimiter.AllowPasswordReset("203.0.113.10", "other@example.com")
+	}
+	if h.rateLimiter.AllowPasswordReset("203.0.113.11", "Other@example.com") {
+		t.Error("expected the email to be limited from any IP")
+	}
+}
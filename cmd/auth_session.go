@@ -3,8 +3,11 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -103,7 +106,7 @@ func (h *AuthSessionHandler) handleLogin(w http.ResponseWriter, r *http.Request,
 	ip := clientIP(r)
 	if h.rateLimiter != nil && h.rateLimiter.LoginFailureExceeded(ip, username) {
 		if h.logger != nil {
-			h.logger.AuditEvent(AuditRateLimitViolation,
+			h.logger.AuditEventContext(r.Context(), AuditRateLimitViolation,
 				"limit_type", "login_failure",
 				"actor", loginFailureKey(ip, username),
 				"timestamp", time.Now().UTC().Format(time.RFC3339),
@@ -113,6 +116,26 @@ func (h *AuthSessionHandler) handleLogin(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
+	// Progressive backoff and the challenge hook apply before the lockout.
+	if h.rateLimiter != nil {
+		if wait := h.rateLimiter.LoginBackoff(ip, username); wait > 0 {
+			if h.logger != nil {
+				h.logger.AuditEventContext(r.Context(), AuditRateLimitViolation,
+					"limit_type", "login_backoff",
+					"actor", loginFailureKey(ip, username),
+					"timestamp", time.Now().UTC().Format(time.RFC3339),
+				)
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			WriteError(w, http.StatusTooManyRequests, "Too many requests")
+			return
+		}
+		if challenge := h.rateLimiter.LoginChallengeFor(ip, username); challenge != nil && !challenge.Verify(data) {
+			challenge.Challenge(w)
+			return
+		}
+	}
+
 	rows, _, err := h.db.QueryRows(ctx, "users", QueryOptions{
 		Filters: []Filter{{Field: "username", Op: "eq", Value: username}},
 		Page:    1,
@@ -131,25 +154,102 @@ func (h *AuthSessionHandler) handleLogin(w http.ResponseWriter, r *http.Request,
 	}
 
 	user := rows[0]
+	policy := h.cfg.Passwords()
+
+	until, err := policy.LockedUntil(ctx, h.db, stringVal(user, "id"), time.Now())
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	// The password is checked before the lockout so that a wrong password
+	// gets the same 401 whether or not the account is locked; only a
+	// caller who knows the password learns about the lockout. Failures
+	// while locked are not counted, as counting would end the lockout.
 	storedHash, _ := user["password_hash"].(string)
 	if err := bcrypt.CompareHashAndPassword([]byte(storedHash), []byte(password)); err != nil {
 		if h.rateLimiter != nil {
 			h.rateLimiter.RecordLoginFailure(ip, username)
 		}
+		if until.IsZero() {
+			if err := h.recordAccountFailure(ctx, policy, user); err != nil {
+				WriteError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+		}
 		WriteError(w, http.StatusUnauthorized, "Invalid credentials")
 		return
 	}
 
-	// Successful login: reset the failure counter.
+	// A locked account rejects even the correct password until the lockout
+	// ends, so guessing cannot continue from other addresses or after a
+	// restart.
+	if !until.IsZero() {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(until).Seconds()))))
+		WriteError(w, http.StatusForbidden, "Account is locked")
+		return
+	}
+
+	// A user with two-factor authentication enabled must also present a
+	// TOTP or recovery code. A wrong code counts as a login failure.
+	totp, err := loadTOTP(ctx, h.db, stringVal(user, "id"))
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if totpEnabled(totp) {
+		code, _ := data["totp_code"].(string)
+		recovery, _ := data["recovery_code"].(string)
+		if code == "" && recovery == "" {
+			WriteError(w, http.StatusUnauthorized, "Two-factor code required")
+			return
+		}
+		passed, err := consumeSecondFactor(ctx, h.db, h.cfg.JWTSecret, totp, code, recovery)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		if !passed {
+			if h.rateLimiter != nil {
+				h.rateLimiter.RecordLoginFailure(ip, username)
+			}
+			if err := h.recordAccountFailure(ctx, policy, user); err != nil {
+				WriteError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			WriteError(w, http.StatusUnauthorized, "Invalid two-factor code")
+			return
+		}
+	}
+
+	// Successful login: reset the failure counters.
 	if h.rateLimiter != nil {
 		h.rateLimiter.ResetLoginFailures(ip, username)
 	}
+	if policy.LockoutThreshold > 0 {
+		if err := ClearLockout(ctx, h.db, stringVal(user, "id")); err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+	}
+
+	if !enabledValue(user) {
+		WriteError(w, http.StatusForbidden, "Account is disabled")
+		return
+	}
+	if err := checkInvitationAccepted(ctx, h.db, stringVal(user, "id")); errors.Is(err, errInvitationPending) {
+		WriteError(w, http.StatusForbidden, "Account invitation has not been accepted")
+		return
+	} else if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
 
 	userID, _ := user["id"].(string)
 	role, _ := user["role"].(string)
 	canWrite := toBool(user["can_write"])
 
-	payload, err := h.issueSession(ctx, userID, role, canWrite, user)
+	payload, err := h.issueSession(ctx, userID, role, canWrite, user, newClientSession(r))
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, "Internal server error")
 		return
@@ -166,6 +266,24 @@ func (h *AuthSessionHandler) handleLogin(w http.ResponseWriter, r *http.Request,
 	WriteSuccess(w, http.StatusOK, "Login successful", []any{payload})
 }
 
+// recordAccountFailure counts a failed login against the account when
+// lockout is enabled, and logs an audit event when it locks the account.
+func (h *AuthSessionHandler) recordAccountFailure(ctx context.Context, policy PasswordPolicy, user map[string]any) error {
+	locked, err := policy.RecordFailure(ctx, h.db, stringVal(user, "id"), time.Now())
+	if err != nil {
+		return err
+	}
+	if locked && h.logger != nil {
+		h.logger.AuditEventContext(ctx, AuditAccountLocked,
+			"actor", stringVal(user, "id"),
+			"target", stringVal(user, "username"),
+			"duration", policy.LockoutDuration,
+			"timestamp", time.Now().UTC().Format(time.RFC3339),
+		)
+	}
+	return nil
+}
+
 func (h *AuthSessionHandler) handleRefresh(w http.ResponseWriter, r *http.Request, data map[string]any) {
 	tokenRaw, ok := data["refresh_token"]
 	if !ok {
@@ -229,10 +347,20 @@ func (h *AuthSessionHandler) handleRefresh(w http.ResponseWriter, r *http.Reques
 	}
 
 	user := userRows[0]
+	if !enabledValue(user) {
+		WriteError(w, http.StatusUnauthorized, "Invalid or expired refresh token")
+		return
+	}
 	role, _ := user["role"].(string)
 	canWrite := toBool(user["can_write"])
 
-	payload, err := h.issueSession(ctx, userID, role, canWrite, user)
+	session := newClientSession(r)
+	session.ID, session.Started = sessionID(tokenRow), sessionStart(tokenRow)
+	payload, err := h.issueSession(ctx, userID, role, canWrite, user, session)
+	if errors.Is(err, errSessionExhausted) {
+		WriteError(w, http.StatusUnauthorized, "Invalid or expired refresh token")
+		return
+	}
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, "Internal server error")
 		return
@@ -276,11 +404,86 @@ func (h *AuthSessionHandler) handleLogout(w http.ResponseWriter, r *http.Request
 	WriteMessage(w, http.StatusOK, "Logged out successfully")
 }
 
-// issueSession creates a new JWT + refresh token pair and stores the refresh token.
-func (h *AuthSessionHandler) issueSession(ctx context.Context, userID, role string, canWrite bool, user map[string]any) (*sessionPayload, error) {
+// errSessionExhausted reports that a session has reached its absolute
+// lifetime and cannot be refreshed again.
+var errSessionExhausted = errors.New("session lifetime exhausted")
+
+// sessionStart returns when the session of a refresh token row began.
+// Rows stored before session_started_at existed fall back to created_at.
+func sessionStart(tokenRow map[string]any) time.Time {
+	for _, key := range []string{"session_started_at", "created_at"} {
+		if s, _ := tokenRow[key].(string); s != "" {
+			if t, err := time.Parse(time.RFC3339, s); err == nil {
+				return t
+			}
+		}
+	}
+	return time.Now().UTC()
+}
+
+// sessionID returns the session a refresh token row belongs to. Rows stored
+// before session_id existed start their own session, named by the row id.
+func sessionID(tokenRow map[string]any) string {
+	if id := stringVal(tokenRow, "session_id"); id != "" {
+		return id
+	}
+	return stringVal(tokenRow, "id")
+}
+
+// clientSession describes the session a refresh token is issued for: which
+// session it continues, when that session began, and the client that
+// requested the token.
+type clientSession struct {
+	ID        string
+	Started   time.Time
+	UserAgent string
+	ClientIP  string
+}
+
+// newClientSession starts a new session for the client of r.
+func newClientSession(r *http.Request) clientSession {
+	ua := r.UserAgent()
+	if len(ua) > MaxSessionUserAgentLen {
+		ua = ua[:MaxSessionUserAgentLen]
+	}
+	return clientSession{
+		ID:        GenerateULID(),
+		Started:   time.Now().UTC(),
+		UserAgent: ua,
+		ClientIP:  clientIP(r),
+	}
+}
+
+// refreshTokenExpiry returns when a refresh token issued at now expires.
+// Without an idle timeout every refresh extends the session by the full
+// refresh lifetime. With one, refresh_expiry caps the session from its
+// start and each refresh extends it by at most the idle timeout.
+func refreshTokenExpiry(lt SessionLifetime, started, now time.Time) time.Time {
+	expiry := now.Add(time.Duration(lt.RefreshExpiry) * time.Second)
+	if lt.IdleTimeout > 0 {
+		expiry = now.Add(time.Duration(lt.IdleTimeout) * time.Second)
+		if limit := started.Add(time.Duration(lt.RefreshExpiry) * time.Second); limit.Before(expiry) {
+			expiry = limit
+		}
+	}
+	return expiry
+}
+
+// issueSession creates a new JWT + refresh token pair and stores the refresh
+// token with its session. session.Started is when the session began: now
+// for a login, the original login time for a refresh. Lifetimes come from
+// the role's configuration.
+func (h *AuthSessionHandler) issueSession(ctx context.Context, userID, role string, canWrite bool, user map[string]any, session clientSession) (*sessionPayload, error) {
+	lt := h.cfg.SessionLifetimeFor(role)
+	now := time.Now().UTC()
+	refreshExpiry := refreshTokenExpiry(lt, session.Started, now)
+	if !refreshExpiry.After(now) {
+		return nil, errSessionExhausted
+	}
+
 	jti := GenerateULID()
 
-	accessToken, expiresAt, err := CreateAccessToken(userID, jti, role, canWrite, h.cfg.JWTSecret, h.cfg.JWTAccessExpiry)
+	accessToken, expiresAt, err := h.cfg.TokenKeys().CreateAccessToken(userID, jti, role, canWrite, lt.AccessExpiry)
 	if err != nil {
 		return nil, fmt.Errorf("issue session: %w", err)
 	}
@@ -290,15 +493,16 @@ func (h *AuthSessionHandler) issueSession(ctx context.Context, userID, role stri
 		return nil, fmt.Errorf("issue session: %w", err)
 	}
 
-	now := time.Now().UTC()
-	refreshExpiry := now.Add(time.Duration(h.cfg.JWTRefreshExpiry) * time.Second)
-
 	err = h.db.InsertRow(ctx, "moon_auth_refresh_tokens", map[string]any{
 		"id":                 GenerateULID(),
 		"user_id":            userID,
 		"refresh_token_hash": refreshHash,
 		"expires_at":         refreshExpiry.Format(time.RFC3339),
 		"created_at":         now.Format(time.RFC3339),
+		"session_started_at": session.Started.UTC().Format(time.RFC3339),
+		"session_id":         session.ID,
+		"user_agent":         session.UserAgent,
+		"client_ip":          session.ClientIP,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("issue session: store refresh token: %w", err)
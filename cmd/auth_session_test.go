@@ -6,6 +6,8 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strconv"
 	"testing"
 	"time"
 )
@@ -14,7 +16,7 @@ func setupAuthTest(t *testing.T) (*AuthSessionHandler, DatabaseAdapter) {
 	t.Helper()
 	db, err := NewSQLiteAdapter(DatabaseConfig{
 		Connection:         "sqlite",
-		Database:           ":memory:",
+		Database:           filepath.Join(t.TempDir(), "auth_test.db"),
 		QueryTimeout:       30,
 		SlowQueryThreshold: 500,
 	}, NewTestLogger(&bytes.Buffer{}))
@@ -259,6 +261,113 @@ func TestRefresh_Success(t *testing.T) {
 	}
 }
 
+func TestSession_DisabledUser(t *testing.T) {
+	handler, db := setupAuthTest(t)
+	ctx := context.Background()
+
+	loginW := doAuthRequest(t, handler, map[string]any{
+		"op":   "login",
+		"data": map[string]any{"username": "testuser", "password": "TestPass1"},
+	})
+	var loginResp SuccessResponse
+	json.NewDecoder(loginW.Body).Decode(&loginResp)
+	refreshToken := loginResp.Data[0].(map[string]any)["refresh_token"].(string)
+
+	if err := db.UpdateRow(ctx, "users", "01TESTUSER000000000000001", map[string]any{"enabled": int64(0)}); err != nil {
+		t.Fatalf("disable user: %v", err)
+	}
+
+	w := doAuthRequest(t, handler, map[string]any{
+		"op":   "login",
+		"data": map[string]any{"username": "testuser", "password": "TestPass1"},
+	})
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("login: expected 403, got %d", w.Code)
+	}
+
+	w = doAuthRequest(t, handler, map[string]any{
+		"op":   "refresh",
+		"data": map[string]any{"refresh_token": refreshToken},
+	})
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("refresh: expected 401, got %d", w.Code)
+	}
+}
+
+func TestRefreshTokenExpiry(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	sliding := SessionLifetime{AccessExpiry: 60, RefreshExpiry: 3600}
+	idle := SessionLifetime{AccessExpiry: 60, RefreshExpiry: 3600, IdleTimeout: 600}
+
+	tests := []struct {
+		name string
+		lt   SessionLifetime
+		now  time.Time
+		want time.Time
+	}{
+		{"sliding from login", sliding, start, start.Add(time.Hour)},
+		{"sliding extends on refresh", sliding, start.Add(50 * time.Minute), start.Add(110 * time.Minute)},
+		{"idle from login", idle, start, start.Add(10 * time.Minute)},
+		{"idle extends on refresh", idle, start.Add(20 * time.Minute), start.Add(30 * time.Minute)},
+		{"idle capped by refresh lifetime", idle, start.Add(55 * time.Minute), start.Add(time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := refreshTokenExpiry(tt.lt, start, tt.now); !got.Equal(tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSession_RoleLifetimes(t *testing.T) {
+	handler, db := setupAuthTest(t)
+	handler.cfg.JWTRoles = map[string]SessionLifetime{
+		"admin": {AccessExpiry: 300, RefreshExpiry: 7200, IdleTimeout: 900},
+	}
+
+	w := doAuthRequest(t, handler, map[string]any{
+		"op":   "login",
+		"data": map[string]any{"username": "testuser", "password": "TestPass1"},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("login: expected 200, got %d", w.Code)
+	}
+	var resp SuccessResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	payload := resp.Data[0].(map[string]any)
+
+	expiresAt, _ := time.Parse(time.RFC3339, payload["expires_at"].(string))
+	if d := time.Until(expiresAt); d > 300*time.Second || d < 290*time.Second {
+		t.Errorf("expected admin access token to last 300s, got %v", d)
+	}
+
+	rows, _, _ := db.QueryRows(context.Background(), "moon_auth_refresh_tokens", QueryOptions{Page: 1, PerPage: 1})
+	refreshExpiry, _ := time.Parse(time.RFC3339, rows[0]["expires_at"].(string))
+	if d := time.Until(refreshExpiry); d > 900*time.Second || d < 890*time.Second {
+		t.Errorf("expected refresh token to expire after the idle timeout, got %v", d)
+	}
+	if rows[0]["session_started_at"] == nil {
+		t.Error("expected session_started_at to be recorded")
+	}
+
+	// A session past its absolute lifetime cannot be refreshed.
+	old := time.Now().UTC().Add(-2 * time.Hour).Format(time.RFC3339)
+	tokenID := rows[0]["id"].(string)
+	if err := db.UpdateRow(context.Background(), "moon_auth_refresh_tokens", tokenID, map[string]any{
+		"session_started_at": old,
+	}); err != nil {
+		t.Fatalf("age session: %v", err)
+	}
+	w = doAuthRequest(t, handler, map[string]any{
+		"op":   "refresh",
+		"data": map[string]any{"refresh_token": payload["refresh_token"]},
+	})
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("refresh: expected 401 for exhausted session, got %d", w.Code)
+	}
+}
+
 func TestRefresh_ReuseRevoked(t *testing.T) {
 	handler, _ := setupAuthTest(t)
 
@@ -383,6 +492,15 @@ func setupAuthTestWithRateLimiter(t *testing.T) *AuthSessionHandler {
 	return handler
 }
 
+// waitOutLoginBackoff moves the login failure clock past the longest
+// progressive delay so the next attempt is not rejected by backoff.
+func waitOutLoginBackoff(h *AuthSessionHandler) {
+	limiter := h.rateLimiter.loginFailure
+	prev := limiter.now
+	skip := time.Duration(LoginBackoffDelays[len(LoginBackoffDelays)-1]) * time.Second
+	limiter.now = func() time.Time { return prev().Add(skip) }
+}
+
 func TestLogin_RateLimit_BlocksAfterLimit(t *testing.T) {
 	handler := setupAuthTestWithRateLimiter(t)
 
@@ -395,6 +513,7 @@ func TestLogin_RateLimit_BlocksAfterLimit(t *testing.T) {
 		if w.Code != http.StatusUnauthorized {
 			t.Fatalf("attempt %d: expected 401, got %d", i+1, w.Code)
 		}
+		waitOutLoginBackoff(handler)
 	}
 
 	// The next attempt must be rate-limited (429).
@@ -411,11 +530,12 @@ func TestLogin_RateLimit_ResetOnSuccess(t *testing.T) {
 	handler := setupAuthTestWithRateLimiter(t)
 
 	// Exhaust failures (one less than the limit so the correct password still works).
-	for range RateLoginFailureLimit - 1 {
+	for range LoginChallengeAfterFailures - 1 {
 		doAuthRequest(t, handler, map[string]any{
 			"op":   "login",
 			"data": map[string]any{"username": "testuser", "password": "WrongPass"},
 		})
+		waitOutLoginBackoff(handler)
 	}
 
 	// Successful login must reset the counter.
@@ -437,6 +557,78 @@ func TestLogin_RateLimit_ResetOnSuccess(t *testing.T) {
 	}
 }
 
+func TestLogin_RateLimit_ProgressiveBackoff(t *testing.T) {
+	handler := setupAuthTestWithRateLimiter(t)
+	wrong := map[string]any{
+		"op":   "login",
+		"data": map[string]any{"username": "testuser", "password": "WrongPass"},
+	}
+
+	// The first failure carries no delay; the second starts the backoff.
+	for range 2 {
+		if w := doAuthRequest(t, handler, wrong); w.Code != http.StatusUnauthorized {
+			t.Fatalf("expected 401, got %d", w.Code)
+		}
+	}
+
+	w := doAuthRequest(t, handler, wrong)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 during backoff, got %d", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != strconv.Itoa(LoginBackoffDelays[0]) {
+		t.Errorf("expected Retry-After %d, got %q", LoginBackoffDelays[0], got)
+	}
+
+	waitOutLoginBackoff(handler)
+	if w := doAuthRequest(t, handler, wrong); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 after backoff elapsed, got %d", w.Code)
+	}
+}
+
+func TestLogin_RateLimit_ChallengeAfterFailures(t *testing.T) {
+	handler := setupAuthTestWithRateLimiter(t)
+	store := NewCaptchaStore()
+	handler.rateLimiter.SetLoginChallenge(NewCaptchaLoginChallenge(store))
+
+	for range LoginChallengeAfterFailures {
+		doAuthRequest(t, handler, map[string]any{
+			"op":   "login",
+			"data": map[string]any{"username": "testuser", "password": "WrongPass"},
+		})
+		waitOutLoginBackoff(handler)
+	}
+
+	w := doAuthRequest(t, handler, map[string]any{
+		"op":   "login",
+		"data": map[string]any{"username": "testuser", "password": "TestPass1"},
+	})
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 challenge, got %d %s", w.Code, w.Body.String())
+	}
+	var resp CaptchaChallengeResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode challenge: %v", err)
+	}
+	if resp.Message != "Captcha required" || resp.Captcha.ID == "" {
+		t.Fatalf("unexpected challenge body: %s", w.Body.String())
+	}
+
+	answer := captchaAnswer(t, store, resp.Captcha.ID)
+
+	w = doAuthRequest(t, handler, map[string]any{
+		"op": "login",
+		"data": map[string]any{
+			"username":      "testuser",
+			"password":      "TestPass1",
+			"captcha_id":    resp.Captcha.ID,
+			"captcha_value": answer,
+		},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 with valid captcha, got %d %s", w.Code, w.Body.String())
+	}
+}
+
 // ---------------------------------------------------------------------------
 // toBool helper tests
 // ---------------------------------------------------------------------------
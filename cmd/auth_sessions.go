@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// AuthSessionsHandler implements GET /auth:sessions and POST /auth:sessions,
+// which let a signed-in user see where they are signed in and sign out
+// individual sessions. A session is the chain of refresh tokens that starts
+// at a login; every refresh carries its session_id forward, so the session
+// is represented by its one unrevoked, unexpired refresh token row.
+type AuthSessionsHandler struct {
+	db     DatabaseAdapter
+	logger *Logger
+}
+
+// NewAuthSessionsHandler creates an AuthSessionsHandler. logger may be nil.
+func NewAuthSessionsHandler(db DatabaseAdapter, logger *Logger) *AuthSessionsHandler {
+	return &AuthSessionsHandler{db: db, logger: logger}
+}
+
+// authSessionsMutateRequest is the JSON body for POST /auth:sessions.
+type authSessionsMutateRequest struct {
+	Op   string           `json:"op"`
+	Data []map[string]any `json:"data"`
+}
+
+// HandleQuery lists the caller's active sessions, most recently used
+// first. Admins may pass user_id to list another user's sessions.
+func (h *AuthSessionsHandler) HandleQuery(w http.ResponseWriter, r *http.Request) {
+	identity, ok := GetAuthIdentity(r.Context())
+	if !ok || identity.CredentialType != CredentialTypeJWT {
+		WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	userID := identity.UserID
+	if v := r.URL.Query().Get("user_id"); v != "" && v != identity.UserID {
+		if identity.Role != "admin" {
+			WriteError(w, http.StatusForbidden, "Forbidden")
+			return
+		}
+		userID = v
+	}
+
+	rows, err := h.activeTokens(r.Context(), Filter{Field: "user_id", Op: "eq", Value: userID})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	data := make([]any, 0, len(rows))
+	for _, row := range rows {
+		data = append(data, sessionResponse(row))
+	}
+
+	meta := map[string]any{"total": len(data)}
+	WriteSuccessFull(w, http.StatusOK, "Sessions retrieved successfully", data, meta, nil)
+}
+
+// HandleMutate applies op=revoke to each item, which names a session by
+// id. A session owned by someone else counts as failed, except for admins,
+// who may revoke any session. Access tokens already issued for a revoked
+// session stay valid until they expire.
+func (h *AuthSessionsHandler) HandleMutate(w http.ResponseWriter, r *http.Request) {
+	identity, ok := GetAuthIdentity(r.Context())
+	if !ok || identity.CredentialType != CredentialTypeJWT {
+		WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req authSessionsMutateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Op != "revoke" {
+		WriteError(w, http.StatusBadRequest, "Invalid op: must be revoke")
+		return
+	}
+	if len(req.Data) == 0 {
+		WriteError(w, http.StatusBadRequest, "Missing required field: data")
+		return
+	}
+	for _, item := range req.Data {
+		if id, _ := item["id"].(string); id == "" {
+			WriteError(w, http.StatusBadRequest, "Each item must include 'id'")
+			return
+		}
+	}
+
+	ctx := r.Context()
+	results := make([]any, 0, len(req.Data))
+	failed := 0
+	for _, item := range req.Data {
+		id := item["id"].(string)
+		rows, err := h.sessionTokens(ctx, identity, id)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		if len(rows) == 0 {
+			failed++
+			continue
+		}
+
+		now := time.Now().UTC().Format(time.RFC3339)
+		for _, row := range rows {
+			if err := h.db.UpdateRow(ctx, "moon_auth_refresh_tokens", stringVal(row, "id"), map[string]any{
+				"revoked_at":        now,
+				"revocation_reason": "session_revoked",
+			}); err != nil {
+				WriteError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+		}
+		h.audit(ctx, identity, id, stringVal(rows[0], "user_id"))
+		results = append(results, map[string]any{"id": id})
+	}
+
+	meta := map[string]any{"success": len(results), "failed": failed}
+	WriteSuccessFull(w, http.StatusOK, "Sessions revoked successfully", results, meta, nil)
+}
+
+// activeTokens returns the unrevoked, unexpired refresh token rows matching
+// filter, most recently issued first.
+func (h *AuthSessionsHandler) activeTokens(ctx context.Context, filter Filter) ([]map[string]any, error) {
+	now := time.Now().UTC()
+	var active []map[string]any
+	for page := 1; ; page++ {
+		rows, _, err := h.db.QueryRows(ctx, "moon_auth_refresh_tokens", QueryOptions{
+			Filters: []Filter{filter, {Field: "revoked_at", Op: "is_null"}},
+			Sort:    []SortField{{Field: "id"}},
+			Page:    page,
+			PerPage: MaxPerPage,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			if expiresAt, err := time.Parse(time.RFC3339, stringVal(row, "expires_at")); err == nil && expiresAt.After(now) {
+				active = append(active, row)
+			}
+		}
+		if len(rows) < MaxPerPage {
+			break
+		}
+	}
+	sort.SliceStable(active, func(i, j int) bool {
+		return stringVal(active[i], "created_at") > stringVal(active[j], "created_at")
+	})
+	return active, nil
+}
+
+// sessionTokens returns the active refresh token rows of session id that
+// identity may revoke. Rows stored before session_id existed are their own
+// session, named by the row id.
+func (h *AuthSessionsHandler) sessionTokens(ctx context.Context, identity *AuthIdentity, id string) ([]map[string]any, error) {
+	rows, err := h.activeTokens(ctx, Filter{Field: "session_id", Op: "eq", Value: id})
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		legacy, err := h.activeTokens(ctx, Filter{Field: "id", Op: "eq", Value: id})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range legacy {
+			if row["session_id"] == nil {
+				rows = append(rows, row)
+			}
+		}
+	}
+	if identity.Role == "admin" {
+		return rows, nil
+	}
+	owned := rows[:0]
+	for _, row := range rows {
+		if stringVal(row, "user_id") == identity.UserID {
+			owned = append(owned, row)
+		}
+	}
+	return owned, nil
+}
+
+// audit records a session revocation.
+func (h *AuthSessionsHandler) audit(ctx context.Context, identity *AuthIdentity, sessionID, userID string) {
+	if h.logger == nil {
+		return
+	}
+	h.logger.AuditEventContext(ctx, AuditLogout,
+		"action", "session.revoke",
+		"actor", identity.CallerID,
+		"target", sessionID,
+		"user_id", userID,
+		"timestamp", time.Now().UTC().Format(time.RFC3339),
+	)
+}
+
+// sessionResponse converts an active refresh token row to the
+// /auth:sessions record. last_used_at is when the session was last
+// refreshed, which is when its current token was issued.
+func sessionResponse(row map[string]any) map[string]any {
+	return map[string]any{
+		"id":           sessionID(row),
+		"user_id":      stringVal(row, "user_id"),
+		"user_agent":   row["user_agent"],
+		"client_ip":    row["client_ip"],
+		"started_at":   sessionStart(row).Format(time.RFC3339),
+		"last_used_at": row["created_at"],
+		"expires_at":   row["expires_at"],
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const authSessionsTestUser = "01TESTUSER000000000000002"
+
+// setupAuthSessionsTest returns the session and sessions handlers over a
+// database holding the admin from setupAuthTest and a user with id
+// authSessionsTestUser, username "reader", and password TestPass1.
+func setupAuthSessionsTest(t *testing.T) (*AuthSessionHandler, *AuthSessionsHandler) {
+	t.Helper()
+	auth, db := setupAuthTest(t)
+	hash, err := HashPassword("TestPass1")
+	if err != nil {
+		t.Fatalf("hash password: %v", err)
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	if err := db.InsertRow(context.Background(), "users", map[string]any{
+		"id":            authSessionsTestUser,
+		"username":      "reader",
+		"email":         "reader@example.com",
+		"password_hash": hash,
+		"role":          "user",
+		"can_write":     int64(0),
+		"created_at":    now,
+		"updated_at":    now,
+	}); err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+	return auth, NewAuthSessionsHandler(db, nil)
+}
+
+// sessionRequest posts an /auth:session op from a client with userAgent and
+// returns the issued refresh token, or "" when the request failed.
+func sessionRequest(t *testing.T, h *AuthSessionHandler, userAgent string, body map[string]any) string {
+	t.Helper()
+	b, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, "/auth:session", strings.NewReader(string(b)))
+	req.Header.Set("User-Agent", userAgent)
+	w := httptest.NewRecorder()
+	h.HandleSession(w, req)
+	if w.Code != http.StatusOK {
+		return ""
+	}
+	var resp SuccessResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	token, _ := resp.Data[0].(map[string]any)["refresh_token"].(string)
+	return token
+}
+
+func doAuthSessionsRequest(t *testing.T, h *AuthSessionsHandler, method, target string, body any, userID, role string) *httptest.ResponseRecorder {
+	t.Helper()
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+	}
+	req := reqWithJWT(method, target, payload, userID, role, false)
+	identity, _ := GetAuthIdentity(req.Context())
+	identity.UserID = userID
+	w := httptest.NewRecorder()
+	if method == http.MethodGet {
+		h.HandleQuery(w, req)
+	} else {
+		h.HandleMutate(w, req)
+	}
+	return w
+}
+
+func TestAuthSessions_ListAndRevoke(t *testing.T) {
+	auth, h := setupAuthSessionsTest(t)
+	login := map[string]any{"op": "login", "data": map[string]any{"username": "reader", "password": "TestPass1"}}
+
+	laptop := sessionRequest(t, auth, "laptop", login)
+	phone := sessionRequest(t, auth, "phone", login)
+	if laptop == "" || phone == "" {
+		t.Fatal("login failed")
+	}
+
+	// A refresh continues the laptop session rather than starting a new one.
+	laptop = sessionRequest(t, auth, "laptop/2", map[string]any{"op": "refresh", "data": map[string]any{"refresh_token": laptop}})
+	if laptop == "" {
+		t.Fatal("refresh failed")
+	}
+
+	w := doAuthSessionsRequest(t, h, http.MethodGet, "/auth:sessions", nil, authSessionsTestUser, "user")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	resp := decodeResponse(t, w)
+	data := resp["data"].([]any)
+	if len(data) != 2 {
+		t.Fatalf("expected 2 sessions, got %v", data)
+	}
+	agents := map[string]map[string]any{}
+	for _, item := range data {
+		s := item.(map[string]any)
+		agents[s["user_agent"].(string)] = s
+		if s["client_ip"] != "192.0.2.1" || s["user_id"] != authSessionsTestUser || s["started_at"] == "" {
+			t.Errorf("unexpected session: %v", s)
+		}
+	}
+	if agents["laptop/2"] == nil || agents["phone"] == nil {
+		t.Fatalf("expected the refreshed laptop and phone sessions, got %v", data)
+	}
+	phoneID := agents["phone"]["id"].(string)
+
+	// Other users can neither list nor revoke the session; admins can list it.
+	if w := doAuthSessionsRequest(t, h, http.MethodGet, "/auth:sessions?user_id="+authSessionsTestUser, nil, "01OTHER", "user"); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for another user's sessions, got %d", w.Code)
+	}
+	w = doAuthSessionsRequest(t, h, http.MethodGet, "/auth:sessions?user_id="+authSessionsTestUser, nil, "01TESTUSER000000000000001", "admin")
+	if got := decodeResponse(t, w)["meta"].(map[string]any)["total"]; got != float64(2) {
+		t.Errorf("expected the admin to see 2 sessions, got %v", got)
+	}
+	revoke := map[string]any{"op": "revoke", "data": []any{map[string]any{"id": phoneID}}}
+	w = doAuthSessionsRequest(t, h, http.MethodPost, "/auth:sessions", revoke, "01OTHER", "user")
+	if meta := decodeResponse(t, w)["meta"].(map[string]any); meta["failed"] != float64(1) {
+		t.Errorf("expected another user's revoke to fail, got %v", meta)
+	}
+
+	w = doAuthSessionsRequest(t, h, http.MethodPost, "/auth:sessions", revoke, authSessionsTestUser, "user")
+	if meta := decodeResponse(t, w)["meta"].(map[string]any); meta["success"] != float64(1) {
+		t.Fatalf("expected revoke to succeed, got %v", meta)
+	}
+	if sessionRequest(t, auth, "phone", map[string]any{"op": "refresh", "data": map[string]any{"refresh_token": phone}}) != "" {
+		t.Error("expected the revoked session's refresh token to be rejected")
+	}
+	if sessionRequest(t, auth, "laptop/2", map[string]any{"op": "refresh", "data": map[string]any{"refresh_token": laptop}}) == "" {
+		t.Error("expected the other session to stay valid")
+	}
+	w = doAuthSessionsRequest(t, h, http.MethodGet, "/auth:sessions", nil, authSessionsTestUser, "user")
+	if got := decodeResponse(t, w)["meta"].(map[string]any)["total"]; got != float64(1) {
+		t.Errorf("expected 1 session after revoke, got %v", got)
+	}
+}
+
+func TestAuthSessions_Errors(t *testing.T) {
+	_, h := setupAuthSessionsTest(t)
+
+	req := reqWithAPIKey(http.MethodGet, "/auth:sessions", nil)
+	w := httptest.NewRecorder()
+	h.HandleQuery(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for an API key, got %d", w.Code)
+	}
+
+	for _, body := range []any{
+		map[string]any{"op": "destroy", "data": []any{map[string]any{"id": "x"}}},
+		map[string]any{"op": "revoke"},
+		map[string]any{"op": "revoke", "data": []any{map[string]any{}}},
+	} {
+		if w := doAuthSessionsRequest(t, h, http.MethodPost, "/auth:sessions", body, authSessionsTestUser, "user"); w.Code != http.StatusBadRequest {
+			t.Errorf("%v: expected 400, got %d", body, w.Code)
+		}
+	}
+}
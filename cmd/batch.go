@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// BatchHandler implements POST /batch, which applies an ordered list of
+// record changes across dynamic collections in one database transaction.
+type BatchHandler struct {
+	db          DatabaseAdapter
+	registry    *SchemaRegistry
+	permissions *PermissionStore
+	audit       *AuditLog
+	validators  *ValidatorStore
+}
+
+// NewBatchHandler creates a BatchHandler with its dependencies.
+func NewBatchHandler(db DatabaseAdapter, registry *SchemaRegistry) *BatchHandler {
+	return &BatchHandler{db: db, registry: registry}
+}
+
+// SetPermissions sets the store whose per-collection rules each operation
+// is checked against. A nil store applies only the role and can_write
+// checks.
+func (h *BatchHandler) SetPermissions(store *PermissionStore) {
+	h.permissions = store
+}
+
+// SetAuditLog records each applied operation in audit.
+func (h *BatchHandler) SetAuditLog(audit *AuditLog) {
+	h.audit = audit
+}
+
+// SetValidators runs the validator attached to a collection, if any, on
+// each record a batch creates or updates.
+func (h *BatchHandler) SetValidators(validators *ValidatorStore) {
+	h.validators = validators
+}
+
+// batchRequest is the JSON body for POST /batch.
+type batchRequest struct {
+	Data []batchOperation `json:"data"`
+}
+
+// batchOperation is one record change. Data is the record for op=create
+// and the id plus changed fields for op=update; op=destroy needs only the
+// id.
+type batchOperation struct {
+	Resource string         `json:"resource"`
+	Op       string         `json:"op"`
+	Data     map[string]any `json:"data"`
+}
+
+// batchError is an operation rejected before the transaction starts. code
+// and details are set when a specific error code applies.
+type batchError struct {
+	status  int
+	msg     string
+	code    string
+	details []ErrorDetail
+}
+
+// newBatchError returns the batchError of err, keeping the code and
+// details of an APIError.
+func newBatchError(status int, err error) *batchError {
+	be := &batchError{status: status, msg: err.Error()}
+	var ae *APIError
+	if errors.As(err, &ae) {
+		be.code, be.details = ae.Code, ae.Details
+	}
+	return be
+}
+
+// write writes the error response, with prefix before the message.
+func (e *batchError) write(w http.ResponseWriter, prefix string) {
+	WriteErrorCode(w, e.status, e.code, prefix+e.msg, e.details...)
+}
+
+// HandleBatch validates and authorizes every operation, then applies them
+// all in one transaction. Any failure rejects the whole batch; the error
+// message names the 1-based position of the failing operation.
+func (h *BatchHandler) HandleBatch(w http.ResponseWriter, r *http.Request) {
+	identity, ok := GetAuthIdentity(r.Context())
+	if !ok {
+		WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req batchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Data == nil {
+		WriteError(w, http.StatusBadRequest, "Missing required field: data")
+		return
+	}
+	if len(req.Data) == 0 {
+		WriteError(w, http.StatusBadRequest, "Data must not be empty")
+		return
+	}
+	if limit := requestLimits().MaxBatchOperations; len(req.Data) > limit {
+		WriteError(w, http.StatusBadRequest, fmt.Sprintf("Batch exceeds %d operations", limit))
+		return
+	}
+
+	ctx := r.Context()
+	writes := make([]BatchWrite, 0, len(req.Data))
+	for i, op := range req.Data {
+		wr, err := h.prepare(ctx, r, identity, op)
+		if err != nil {
+			err.write(w, fmt.Sprintf("Operation %d: ", i+1))
+			return
+		}
+		writes = append(writes, wr)
+	}
+
+	if idx, err := h.db.ExecWriteBatch(ctx, writes); err != nil {
+		switch {
+		case idx < len(writes) && errors.Is(err, ErrNoRowAffected) && len(writes[idx].Guard) > 0 && writes[idx].ExpectedVersion == 0:
+			// Only the owner guard could have rejected the row: it is gone
+			// or now belongs to someone else.
+			WriteErrorCode(w, http.StatusNotFound, ErrCodeNotFound, fmt.Sprintf("Operation %d: Record '%s' not found", idx+1, writes[idx].ID))
+		case idx < len(writes) && errors.Is(err, ErrNoRowAffected):
+			WriteErrorCode(w, http.StatusConflict, ErrCodeVersionConflict, fmt.Sprintf("Operation %d: Record '%s' was changed or deleted before it could be written", idx+1, writes[idx].ID))
+		case idx < len(writes) && isConstraintViolation(err):
+			status, msg := dbErrorResponse(err)
+			WriteErrorCode(w, status, dbErrorCode(err), fmt.Sprintf("Operation %d: %s", idx+1, msg))
+		default:
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+		}
+		return
+	}
+
+	// Records are read back after the commit, so a record destroyed by a
+	// later operation in the batch is reported without data.
+	results := make([]any, 0, len(writes))
+	for i, wr := range writes {
+		result := map[string]any{"resource": wr.Table, "op": req.Data[i].Op, "id": wr.ID}
+		if wr.Op != BatchDelete {
+			col, _ := h.registry.Get(wr.Table)
+			rows, _, err := h.db.QueryRows(ctx, wr.Table, QueryOptions{
+				Filters: []Filter{{Field: "id", Op: "eq", Value: wr.ID}},
+				Page:    1,
+				PerPage: 1,
+			})
+			if err == nil && len(rows) > 0 {
+				result["data"] = filterHiddenFields(wr.Table, formatRecord(rows[0], col))
+			}
+		}
+		results = append(results, result)
+		h.auditWrite(w, r, identity, req.Data[i].Op, wr)
+	}
+
+	meta := map[string]any{"success": len(results), "failed": 0}
+	WriteSuccessFull(w, http.StatusOK, "Batch applied successfully", results, meta, nil)
+}
+
+// auditWrite records one applied operation. Previous values are not read
+// inside the transaction, so entries carry only the written values.
+func (h *BatchHandler) auditWrite(w http.ResponseWriter, r *http.Request, identity *AuthIdentity, op string, wr BatchWrite) {
+	if h.audit == nil {
+		return
+	}
+	written := make(map[string]any, len(wr.Data))
+	for k, v := range wr.Data {
+		if k != "id" {
+			written[k] = v
+		}
+	}
+	h.audit.Record(r.Context(), AuditEntry{
+		Event:      AuditDataMutation,
+		Actor:      identity.CallerID,
+		Action:     "batch." + op,
+		Collection: wr.Table,
+		RecordID:   wr.ID,
+		Changes:    auditDiff(nil, written),
+		RequestID:  requestID(w),
+	})
+}
+
+// prepare checks one operation with the same rules as :mutate and turns it
+// into a BatchWrite. Records named by update and destroy must exist and,
+// in an owned collection, belong to the caller.
+func (h *BatchHandler) prepare(ctx context.Context, r *http.Request, identity *AuthIdentity, op batchOperation) (BatchWrite, *batchError) {
+	if op.Resource == "" {
+		return BatchWrite{}, &batchError{status: http.StatusBadRequest, msg: "Missing required field: resource"}
+	}
+	col, ok := h.registry.Get(op.Resource)
+	if !ok {
+		return BatchWrite{}, &batchError{status: http.StatusNotFound, msg: fmt.Sprintf("Resource '%s' not found", op.Resource)}
+	}
+	if col.System {
+		return BatchWrite{}, &batchError{status: http.StatusBadRequest, msg: fmt.Sprintf("Resource '%s' cannot be changed in a batch", op.Resource)}
+	}
+	if op.Op != "create" && op.Op != "update" && op.Op != "destroy" {
+		return BatchWrite{}, &batchError{status: http.StatusBadRequest, msg: fmt.Sprintf("Unknown op: %s", op.Op)}
+	}
+	if !h.allowed(identity, op.Resource, op.Op) {
+		return BatchWrite{}, &batchError{status: http.StatusForbidden, msg: "Forbidden"}
+	}
+	if op.Data == nil {
+		return BatchWrite{}, &batchError{status: http.StatusBadRequest, msg: "Missing required field: data"}
+	}
+
+	fieldMap := buildFieldMap(col)
+	if op.Op == "create" {
+		if _, hasID := op.Data["id"]; hasID {
+			return BatchWrite{}, &batchError{status: http.StatusBadRequest, msg: "Field 'id' must not be provided for create"}
+		}
+		if err := validateBatchFields(op.Data, col, fieldMap); err != nil {
+			return BatchWrite{}, err
+		}
+		if err := h.checkValidator(ctx, "create", op.Resource, op.Data); err != nil {
+			return BatchWrite{}, err
+		}
+		row := newDynamicRow(op.Data, col, identity.OwnerID())
+		return BatchWrite{Op: BatchInsert, Table: op.Resource, ID: row["id"].(string), Data: row}, nil
+	}
+
+	id, _ := op.Data["id"].(string)
+	if id == "" {
+		return BatchWrite{}, &batchError{status: http.StatusBadRequest, msg: "Field 'id' must be a non-empty string"}
+	}
+	owner := ownerFilters(r, col)
+	existing, _, err := h.db.QueryRows(ctx, op.Resource, QueryOptions{
+		Filters: append([]Filter{{Field: "id", Op: "eq", Value: id}}, owner...),
+		Page:    1,
+		PerPage: 1,
+	})
+	if err != nil {
+		return BatchWrite{}, &batchError{status: http.StatusInternalServerError, msg: "Internal server error"}
+	}
+	if len(existing) == 0 {
+		return BatchWrite{}, &batchError{status: http.StatusNotFound, msg: fmt.Sprintf("Record '%s' not found", id)}
+	}
+	// The read above happens before the transaction, so the ownership
+	// check is repeated by the statement itself through the guard.
+	var guard map[string]any
+	for _, f := range owner {
+		if guard == nil {
+			guard = make(map[string]any)
+		}
+		guard[f.Field] = f.Value
+	}
+	if op.Op == "destroy" {
+		return BatchWrite{Op: BatchDelete, Table: op.Resource, ID: id, Guard: guard}, nil
+	}
+
+	updateData := make(map[string]any, len(op.Data))
+	for k, v := range op.Data {
+		if k != "id" {
+			updateData[k] = v
+		}
+	}
+	expected, verr := takeExpectedVersion(updateData, fieldMap)
+	if verr != nil {
+		return BatchWrite{}, newBatchError(http.StatusBadRequest, verr)
+	}
+	if len(updateData) == 0 {
+		return BatchWrite{}, &batchError{status: http.StatusBadRequest, msg: "No updatable fields provided"}
+	}
+	if err := validateBatchFields(updateData, col, fieldMap); err != nil {
+		return BatchWrite{}, err
+	}
+	candidate := formatRecord(existing[0], col)
+	for k, v := range updateData {
+		candidate[k] = v
+	}
+	if err := h.checkValidator(ctx, "update", op.Resource, candidate); err != nil {
+		return BatchWrite{}, err
+	}
+
+	dbData := make(map[string]any, len(updateData)+1)
+	for k, v := range updateData {
+		dbData[k] = prepareValueForDB(v, fieldMap[k].Type)
+	}
+	setTimestampFields(dbData, fieldMap, false)
+
+	wr := BatchWrite{Op: BatchUpdate, Table: op.Resource, ID: id, Data: dbData, Guard: guard}
+	if f, ok := fieldMap[FieldVersion]; ok && isVersionField(f) {
+		if current, _ := toInt64(existing[0][FieldVersion]); expected != 0 && current != expected {
+			return BatchWrite{}, &batchError{status: http.StatusConflict, msg: fmt.Sprintf("Version conflict for record '%s'", id), code: ErrCodeVersionConflict}
+		}
+		wr.Versioned, wr.ExpectedVersion = true, expected
+	}
+	return wr, nil
+}
+
+// checkValidator runs the validator of resource on the candidate record.
+// Batches only change dynamic collections.
+func (h *BatchHandler) checkValidator(ctx context.Context, op, resource string, record map[string]any) *batchError {
+	messages, err := h.validators.Check(ctx, op, resource, record)
+	if err != nil {
+		return &batchError{status: http.StatusInternalServerError, msg: "Internal server error"}
+	}
+	if len(messages) > 0 {
+		return &batchError{status: http.StatusBadRequest, msg: validatorRejection(messages), code: ErrCodeValidationFailed}
+	}
+	return nil
+}
+
+// allowed applies the checks AuthorizeWithPermissions makes for a
+// :mutate request to one batch operation.
+func (h *BatchHandler) allowed(identity *AuthIdentity, resource, op string) bool {
+	if identity.CredentialType == CredentialTypeAPIKey && !stringInSlice(resource, identity.Collections) {
+		return false
+	}
+	if !scopeAllows(identity.Scopes, resource, op) {
+		return false
+	}
+	if identity.Role == "admin" {
+		return true
+	}
+	if !identity.CanWrite {
+		return false
+	}
+	return h.permissions == nil || h.permissions.Allowed(identity, resource, op)
+}
+
+// validateBatchFields applies the :mutate field checks to a create or
+// update item.
+func validateBatchFields(item map[string]any, col *Collection, fieldMap map[string]Field) *batchError {
+	if err := validateWritableFields(item, col, col.Name); err != nil {
+		return newBatchError(http.StatusBadRequest, err)
+	}
+	if err := validateFieldsExist(item, fieldMap, col.Name); err != nil {
+		return newBatchError(http.StatusBadRequest, err)
+	}
+	if err := validateFieldTypes(item, fieldMap); err != nil {
+		return newBatchError(http.StatusBadRequest, err)
+	}
+	if err := validateAttributes(item, col); err != nil {
+		return newBatchError(http.StatusBadRequest, err)
+	}
+	return nil
+}
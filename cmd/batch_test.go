@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// setupBatchTest returns a BatchHandler over the products table from
+// setupMutateTest, seeded with products p1 and p2, plus a skus table with
+// a unique code column.
+func setupBatchTest(t *testing.T) (*BatchHandler, *SQLiteAdapter) {
+	t.Helper()
+	_, adapter, registry := setupMutateTest(t)
+	ctx := context.Background()
+	if err := adapter.ExecDDL(ctx, `CREATE TABLE skus (id TEXT PRIMARY KEY, code TEXT NOT NULL UNIQUE)`); err != nil {
+		t.Fatalf("ExecDDL skus: %v", err)
+	}
+	for _, id := range []string{"p1", "p2"} {
+		if err := adapter.InsertRow(ctx, "products", map[string]any{"id": id, "title": "Widget", "quantity": int64(5)}); err != nil {
+			t.Fatalf("InsertRow: %v", err)
+		}
+	}
+	if err := registry.Refresh(); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	return NewBatchHandler(adapter, registry), adapter
+}
+
+func doBatchRequest(t *testing.T, h *BatchHandler, body any, identity *AuthIdentity) *httptest.ResponseRecorder {
+	t.Helper()
+	b, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("marshal body: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/batch", bytes.NewReader(b))
+	req = req.WithContext(SetAuthIdentity(req.Context(), identity))
+	w := httptest.NewRecorder()
+	h.HandleBatch(w, req)
+	return w
+}
+
+func TestBatch_AppliesAllOperations(t *testing.T) {
+	h, adapter := setupBatchTest(t)
+
+	body := map[string]any{"data": []any{
+		map[string]any{"resource": "skus", "op": "create", "data": map[string]any{"code": "W-1"}},
+		map[string]any{"resource": "products", "op": "update", "data": map[string]any{"id": "p1", "quantity": 4}},
+		map[string]any{"resource": "products", "op": "create", "data": map[string]any{"title": "Gadget"}},
+		map[string]any{"resource": "products", "op": "destroy", "data": map[string]any{"id": "p2"}},
+	}}
+	w := doBatchRequest(t, h, body, userWriteIdentity())
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	resp := parseResponse(t, w)
+	results := resp["data"].([]any)
+	if len(results) != 4 {
+		t.Fatalf("expected 4 results, got %d", len(results))
+	}
+	updated := results[1].(map[string]any)
+	if updated["op"] != "update" || updated["data"].(map[string]any)["quantity"] != float64(4) {
+		t.Errorf("unexpected update result: %v", updated)
+	}
+	if _, ok := results[3].(map[string]any)["data"]; ok {
+		t.Error("destroy result must not include data")
+	}
+	if count, _ := adapter.CountRows(context.Background(), "products"); count != 2 {
+		t.Errorf("expected 2 products after batch, got %d", count)
+	}
+}
+
+func TestBatch_RollsBackOnFailure(t *testing.T) {
+	h, adapter := setupBatchTest(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		ops     []any
+		status  int
+		message string
+	}{
+		{
+			name: "unique violation",
+			ops: []any{
+				map[string]any{"resource": "products", "op": "create", "data": map[string]any{"title": "Gadget"}},
+				map[string]any{"resource": "skus", "op": "create", "data": map[string]any{"code": "A"}},
+				map[string]any{"resource": "skus", "op": "create", "data": map[string]any{"code": "A"}},
+			},
+			status:  http.StatusConflict,
+			message: "Operation 3:",
+		},
+		{
+			name: "update after destroy",
+			ops: []any{
+				map[string]any{"resource": "products", "op": "destroy", "data": map[string]any{"id": "p1"}},
+				map[string]any{"resource": "products", "op": "update", "data": map[string]any{"id": "p1", "title": "Gone"}},
+			},
+			status:  http.StatusConflict,
+			message: "Operation 2:",
+		},
+		{
+			name: "validation failure",
+			ops: []any{
+				map[string]any{"resource": "products", "op": "create", "data": map[string]any{"title": "Gadget"}},
+				map[string]any{"resource": "products", "op": "update", "data": map[string]any{"id": "missing", "title": "X"}},
+			},
+			status:  http.StatusNotFound,
+			message: "Operation 2: Record 'missing' not found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doBatchRequest(t, h, map[string]any{"data": tt.ops}, userWriteIdentity())
+			if w.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if msg := parseResponse(t, w)["message"].(string); !strings.HasPrefix(msg, tt.message) {
+				t.Errorf("expected message starting %q, got %q", tt.message, msg)
+			}
+			if count, _ := adapter.CountRows(ctx, "products"); count != 2 {
+				t.Errorf("expected products to be unchanged, got %d rows", count)
+			}
+			if count, _ := adapter.CountRows(ctx, "skus"); count != 0 {
+				t.Errorf("expected skus to be unchanged, got %d rows", count)
+			}
+		})
+	}
+}
+
+func TestBatch_Authorization(t *testing.T) {
+	h, _ := setupBatchTest(t)
+	create := func(resource string) map[string]any {
+		return map[string]any{"data": []any{
+			map[string]any{"resource": resource, "op": "create", "data": map[string]any{"code": "X"}},
+		}}
+	}
+
+	readOnly := &AuthIdentity{CredentialType: CredentialTypeJWT, CallerID: "u2", Role: "user"}
+	if w := doBatchRequest(t, h, create("skus"), readOnly); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 without can_write, got %d", w.Code)
+	}
+
+	key := &AuthIdentity{CredentialType: CredentialTypeAPIKey, CallerID: "k1", Role: "admin", CanWrite: true, Collections: []string{"products"}}
+	if w := doBatchRequest(t, h, create("skus"), key); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a collection outside the key's list, got %d", w.Code)
+	}
+
+	if w := doBatchRequest(t, h, create("users"), adminIdentity()); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a system collection, got %d", w.Code)
+	}
+
+	ops := make([]any, MaxBatchOperations+1)
+	for i := range ops {
+		ops[i] = map[string]any{"resource": "skus", "op": "create", "data": map[string]any{"code": "X"}}
+	}
+	if w := doBatchRequest(t, h, map[string]any{"data": ops}, adminIdentity()); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 over the operation limit, got %d", w.Code)
+	}
+}
+
+func TestBatch_OwnerGuardedInStatement(t *testing.T) {
+	for _, op := range []string{"update", "destroy"} {
+		t.Run(op, func(t *testing.T) {
+			h, adapter := setupBatchTest(t)
+			ctx := context.Background()
+			if err := adapter.ExecDDL(ctx, `CREATE TABLE notes (id TEXT PRIMARY KEY, body TEXT NOT NULL, owner_id TEXT)`); err != nil {
+				t.Fatalf("ExecDDL notes: %v", err)
+			}
+			if err := h.registry.Refresh(); err != nil {
+				t.Fatalf("Refresh: %v", err)
+			}
+			id := GenerateULID()
+			if err := adapter.InsertRow(ctx, "notes", map[string]any{"id": id, "body": "mine", "owner_id": "user-id"}); err != nil {
+				t.Fatalf("InsertRow: %v", err)
+			}
+			// The record changes hands between the ownership read and the
+			// write.
+			h.db = &racingWriteDB{DatabaseAdapter: adapter, before: func() {
+				if err := adapter.UpdateRow(ctx, "notes", id, map[string]any{"owner_id": "bob-id"}); err != nil {
+					t.Fatalf("UpdateRow: %v", err)
+				}
+			}}
+
+			data := map[string]any{"id": id}
+			if op == "update" {
+				data["body"] = "taken"
+			}
+			w := doBatchRequest(t, h, map[string]any{"data": []any{
+				map[string]any{"resource": "notes", "op": op, "data": data},
+			}}, userWriteIdentity())
+			if w.Code != http.StatusNotFound {
+				t.Fatalf("expected 404, got %d: %s", w.Code, w.Body.String())
+			}
+			rows, _, err := adapter.QueryRows(ctx, "notes", QueryOptions{Page: 1, PerPage: 10})
+			if err != nil || len(rows) != 1 || rows[0]["body"] != "mine" {
+				t.Errorf("expected bob's record unchanged, got %v (%v)", rows, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ---------------------------------------------------------------------------
+// Export bundles
+//
+// A bundle is an export encrypted and authenticated with AES-256-GCM under a
+// key derived from bundle_key. Its layout is:
+//
+//	"MOONBNDL" | uint32 manifest length | manifest JSON | chunk...
+//	chunk: final flag (1 byte) | uint32 sealed length | sealed bytes
+//
+// Each chunk holds up to BundleChunkSize bytes of the export. Its nonce is
+// the manifest's random nonce prefix followed by the chunk sequence number,
+// and its additional data is the manifest followed by the final flag. A
+// bundle whose manifest, chunks, or chunk order was altered, or that was
+// cut short, fails to open.
+// ---------------------------------------------------------------------------
+
+var bundleMagic = []byte("MOONBNDL")
+
+// errBundleInvalid is returned for any bundle that fails authentication.
+// The cause is deliberately not reported.
+var errBundleInvalid = errors.New("Bundle is corrupt, truncated, or was not created with this server's bundle_key")
+
+// bundleManifest describes the export held by a bundle. It is stored in
+// clear text but authenticated with every chunk.
+type bundleManifest struct {
+	Version     int    `json:"version"`
+	Collection  string `json:"collection"`
+	Format      string `json:"format"`
+	CreatedAt   string `json:"created_at"`
+	NoncePrefix []byte `json:"nonce_prefix"`
+}
+
+// deriveBundleKey derives the AES-256 bundle key from the bundle_key
+// configuration value.
+func deriveBundleKey(secret string) []byte {
+	// hkdf.Key only fails for lengths above 255 hash sizes.
+	key, _ := hkdf.Key(sha256.New, []byte(secret), nil, "moon export bundle v1", 32)
+	return key
+}
+
+func newBundleAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// bundleWriter encrypts an export into a bundle written to w. The manifest
+// is written with the first chunk. Close must be called after the last
+// write; a bundle that is not closed does not open.
+type bundleWriter struct {
+	w        io.Writer
+	aead     cipher.AEAD
+	manifest []byte
+	prefix   []byte
+	seq      uint32
+	buf      []byte
+	started  bool
+}
+
+// newBundleWriter returns a bundleWriter for an export of collection in
+// format.
+func newBundleWriter(w io.Writer, key []byte, collection, format string) (*bundleWriter, error) {
+	aead, err := newBundleAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, aead.NonceSize()-4)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	manifest, err := json.Marshal(bundleManifest{
+		Version:     BundleVersion,
+		Collection:  collection,
+		Format:      format,
+		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+		NoncePrefix: prefix,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &bundleWriter{w: w, aead: aead, manifest: manifest, prefix: prefix}, nil
+}
+
+// Write buffers p and writes every full chunk.
+func (b *bundleWriter) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	for len(b.buf) >= BundleChunkSize {
+		if err := b.seal(b.buf[:BundleChunkSize], false); err != nil {
+			return 0, err
+		}
+		b.buf = b.buf[BundleChunkSize:]
+	}
+	return len(p), nil
+}
+
+// Close writes the remaining data as the final chunk.
+func (b *bundleWriter) Close() error {
+	err := b.seal(b.buf, true)
+	b.buf = nil
+	return err
+}
+
+func (b *bundleWriter) seal(chunk []byte, final bool) error {
+	if !b.started {
+		b.started = true
+		head := append([]byte{}, bundleMagic...)
+		head = binary.BigEndian.AppendUint32(head, uint32(len(b.manifest)))
+		if _, err := b.w.Write(append(head, b.manifest...)); err != nil {
+			return err
+		}
+	}
+	sealed := b.aead.Seal(nil, bundleNonce(b.prefix, b.seq), chunk, bundleAAD(b.manifest, final))
+	b.seq++
+	head := []byte{bundleFinalFlag(final)}
+	head = binary.BigEndian.AppendUint32(head, uint32(len(sealed)))
+	if _, err := b.w.Write(head); err != nil {
+		return err
+	}
+	_, err := b.w.Write(sealed)
+	return err
+}
+
+// openBundle reads, authenticates, and decrypts a whole bundle from r. No
+// data is returned unless every chunk, through the final one, is valid.
+func openBundle(r io.Reader, key []byte) (bundleManifest, []byte, error) {
+	var m bundleManifest
+	head := make([]byte, len(bundleMagic)+4)
+	if _, err := io.ReadFull(r, head); err != nil || !bytes.Equal(head[:len(bundleMagic)], bundleMagic) {
+		return m, nil, bundleReadError(err, errors.New("Body is not an export bundle"))
+	}
+	n := binary.BigEndian.Uint32(head[len(bundleMagic):])
+	if n > MaxBundleManifestBytes {
+		return m, nil, errBundleInvalid
+	}
+	manifest := make([]byte, n)
+	if _, err := io.ReadFull(r, manifest); err != nil {
+		return m, nil, bundleReadError(err, errBundleInvalid)
+	}
+	if err := json.Unmarshal(manifest, &m); err != nil {
+		return m, nil, errBundleInvalid
+	}
+	if m.Version != BundleVersion {
+		return m, nil, fmt.Errorf("Unsupported bundle version %d", m.Version)
+	}
+
+	aead, err := newBundleAEAD(key)
+	if err != nil {
+		return m, nil, err
+	}
+	if len(m.NoncePrefix) != aead.NonceSize()-4 {
+		return m, nil, errBundleInvalid
+	}
+
+	var out bytes.Buffer
+	chunkHead := make([]byte, 5)
+	for seq := uint32(0); ; seq++ {
+		if _, err := io.ReadFull(r, chunkHead); err != nil {
+			return m, nil, bundleReadError(err, errBundleInvalid)
+		}
+		final := chunkHead[0] == bundleFinalFlag(true)
+		size := binary.BigEndian.Uint32(chunkHead[1:])
+		if size > BundleChunkSize+uint32(aead.Overhead()) {
+			return m, nil, errBundleInvalid
+		}
+		sealed := make([]byte, size)
+		if _, err := io.ReadFull(r, sealed); err != nil {
+			return m, nil, bundleReadError(err, errBundleInvalid)
+		}
+		plain, err := aead.Open(sealed[:0], bundleNonce(m.NoncePrefix, seq), sealed, bundleAAD(manifest, final))
+		if err != nil {
+			return m, nil, errBundleInvalid
+		}
+		out.Write(plain)
+		if final {
+			break
+		}
+	}
+	// Data after the final chunk was not produced by bundleWriter.
+	if _, err := io.ReadFull(r, make([]byte, 1)); err != io.EOF {
+		return m, nil, bundleReadError(err, errBundleInvalid)
+	}
+	return m, out.Bytes(), nil
+}
+
+// bundleReadError keeps read errors that callers report specially, such as
+// an oversized body, and otherwise returns fallback.
+func bundleReadError(err, fallback error) error {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return err
+	}
+	return fallback
+}
+
+func bundleNonce(prefix []byte, seq uint32) []byte {
+	return binary.BigEndian.AppendUint32(append([]byte{}, prefix...), seq)
+}
+
+func bundleAAD(manifest []byte, final bool) []byte {
+	return append(append([]byte{}, manifest...), bundleFinalFlag(final))
+}
+
+func bundleFinalFlag(final bool) byte {
+	if final {
+		return 1
+	}
+	return 0
+}
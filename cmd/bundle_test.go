@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func sealTestBundle(t *testing.T, key []byte, payload []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	bw, err := newBundleWriter(&buf, key, "products", "ndjson")
+	if err != nil {
+		t.Fatalf("newBundleWriter: %v", err)
+	}
+	if _, err := bw.Write(payload); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := bw.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestBundle_RoundTrip(t *testing.T) {
+	key := deriveBundleKey(strings.Repeat("k", MinBundleKeyLength))
+	for _, size := range []int{0, 10, BundleChunkSize, 2*BundleChunkSize + 17} {
+		payload := bytes.Repeat([]byte("x"), size)
+		m, got, err := openBundle(bytes.NewReader(sealTestBundle(t, key, payload)), key)
+		if err != nil {
+			t.Fatalf("size %d: openBundle: %v", size, err)
+		}
+		if !bytes.Equal(got, payload) {
+			t.Fatalf("size %d: payload mismatch", size)
+		}
+		if m.Collection != "products" || m.Format != "ndjson" || m.Version != BundleVersion {
+			t.Fatalf("unexpected manifest %+v", m)
+		}
+	}
+}
+
+func TestBundle_RejectsTampering(t *testing.T) {
+	key := deriveBundleKey(strings.Repeat("k", MinBundleKeyLength))
+	sealed := sealTestBundle(t, key, bytes.Repeat([]byte("y"), BundleChunkSize+100))
+	manifestEnd := bytes.IndexByte(sealed, '}') + 1
+
+	tests := map[string]func([]byte) []byte{
+		"flipped payload byte": func(b []byte) []byte { b[len(b)-20] ^= 1; return b },
+		"edited manifest": func(b []byte) []byte {
+			return bytes.Replace(b, []byte(`"products"`), []byte(`"customer"`), 1)
+		},
+		"truncated": func(b []byte) []byte { return b[:len(b)-30] },
+		"final chunk dropped": func(b []byte) []byte {
+			// The first chunk spans a full BundleChunkSize plus the GCM tag.
+			return b[:manifestEnd+5+BundleChunkSize+16]
+		},
+		"trailing data": func(b []byte) []byte { return append(b, 0) },
+		"not a bundle":  func(b []byte) []byte { return []byte("id,title\n") },
+	}
+	for name, tamper := range tests {
+		t.Run(name, func(t *testing.T) {
+			b := tamper(append([]byte{}, sealed...))
+			if _, _, err := openBundle(bytes.NewReader(b), key); err == nil {
+				t.Fatal("expected tampered bundle to be rejected")
+			}
+		})
+	}
+
+	other := deriveBundleKey(strings.Repeat("o", MinBundleKeyLength))
+	if _, _, err := openBundle(bytes.NewReader(sealed), other); err != errBundleInvalid {
+		t.Fatalf("wrong key: expected errBundleInvalid, got %v", err)
+	}
+}
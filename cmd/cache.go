@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache stores short-lived values shared by the request handlers. With the
+// memory backend values live in this process; with the Redis backend they
+// are shared by every Moon instance using the same Redis server.
+type Cache interface {
+	// Get returns the value stored under key. ok is false if there is none
+	// or it has expired.
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+
+	// Set stores value under key for ttl, replacing any previous value.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+
+	// Take returns the value stored under key and removes it in one step,
+	// so of several concurrent callers only one receives the value.
+	Take(ctx context.Context, key string) (value []byte, ok bool, err error)
+
+	// Delete removes the value stored under key, if any.
+	Delete(ctx context.Context, key string) error
+
+	// Close releases the cache's connections.
+	Close() error
+}
+
+// NewCache creates the cache selected by cfg.
+func NewCache(cfg CacheConfig) (Cache, error) {
+	switch cfg.Backend {
+	case CacheBackendMemory:
+		return NewMemoryCache(), nil
+	case CacheBackendRedis:
+		return NewRedisCache(cfg.RedisURL)
+	default:
+		return nil, fmt.Errorf("unsupported cache backend %q", cfg.Backend)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Memory
+// ---------------------------------------------------------------------------
+
+// MemoryCache is a Cache held in process memory. Expired values are
+// removed when they are read and whenever a value is set.
+type MemoryCache struct {
+	mu      sync.Mutex
+	entries map[string]memoryCacheEntry
+	now     func() time.Time
+}
+
+type memoryCacheEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// NewMemoryCache creates an empty MemoryCache.
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{entries: make(map[string]memoryCacheEntry), now: time.Now}
+}
+
+// Get implements Cache.
+func (c *MemoryCache) Get(_ context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	value, ok := c.getLocked(key)
+	return value, ok, nil
+}
+
+// Set implements Cache.
+func (c *MemoryCache) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	for k, e := range c.entries {
+		if !e.expiresAt.After(now) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = memoryCacheEntry{value: append([]byte(nil), value...), expiresAt: now.Add(ttl)}
+	return nil
+}
+
+// Take implements Cache.
+func (c *MemoryCache) Take(_ context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	value, ok := c.getLocked(key)
+	delete(c.entries, key)
+	return value, ok, nil
+}
+
+// Delete implements Cache.
+func (c *MemoryCache) Delete(_ context.Context, key string) error {
+	c.mu.Lock()
+	delete(c.entries, key)
+	c.mu.Unlock()
+	return nil
+}
+
+// Close implements Cache.
+func (c *MemoryCache) Close() error { return nil }
+
+func (c *MemoryCache) getLocked(key string) ([]byte, bool) {
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !e.expiresAt.After(c.now()) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return append([]byte(nil), e.value...), true
+}
+
+// ---------------------------------------------------------------------------
+// Redis
+// ---------------------------------------------------------------------------
+
+// RedisCache is a Cache stored on a Redis server, spoken to over RESP.
+// Keys are prefixed with CacheRedisKeyPrefix. Up to CacheRedisPoolSize idle
+// connections are kept for reuse, and each command gives up after
+// CacheRedisTimeoutSeconds. Take uses GETDEL and needs Redis 6.2 or later.
+type RedisCache struct {
+	addr     string
+	tls      *tls.Config
+	password string
+	username string
+	db       int
+	idle     chan *redisConn
+}
+
+// errRedisNil is returned by redisConn.do for a nil reply.
+var errRedisNil = errors.New("redis: nil reply")
+
+// NewRedisCache creates a RedisCache for a URL of the form
+// redis://[[user]:password@]host[:port][/db], or rediss:// for TLS, and
+// checks that the server answers.
+func NewRedisCache(rawURL string) (*RedisCache, error) {
+	c, err := parseRedisURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), CacheRedisTimeoutSeconds*time.Second)
+	defer cancel()
+	if _, err := c.do(ctx, "PING"); err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	return c, nil
+}
+
+// parseRedisURL returns an unconnected RedisCache for rawURL.
+func parseRedisURL(rawURL string) (*RedisCache, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") || u.Host == "" {
+		return nil, fmt.Errorf("invalid Redis URL: must be a redis:// or rediss:// URL")
+	}
+	c := &RedisCache{addr: u.Host, idle: make(chan *redisConn, CacheRedisPoolSize)}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.Scheme == "rediss" {
+		c.tls = &tls.Config{ServerName: u.Hostname()}
+	}
+	if u.User != nil {
+		c.username = u.User.Username()
+		c.password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		c.db, err = strconv.Atoi(db)
+		if err != nil || c.db < 0 {
+			return nil, fmt.Errorf("invalid Redis URL: database must be a non-negative number")
+		}
+	}
+	return c, nil
+}
+
+// Get implements Cache.
+func (c *RedisCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	return c.bulk(ctx, "GET", CacheRedisKeyPrefix+key)
+}
+
+// Set implements Cache.
+func (c *RedisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	ms := max(ttl.Milliseconds(), 1)
+	_, err := c.do(ctx, "SET", CacheRedisKeyPrefix+key, string(value), "PX", strconv.FormatInt(ms, 10))
+	return err
+}
+
+// Take implements Cache.
+func (c *RedisCache) Take(ctx context.Context, key string) ([]byte, bool, error) {
+	return c.bulk(ctx, "GETDEL", CacheRedisKeyPrefix+key)
+}
+
+// Delete implements Cache.
+func (c *RedisCache) Delete(ctx context.Context, key string) error {
+	_, err := c.do(ctx, "DEL", CacheRedisKeyPrefix+key)
+	return err
+}
+
+// Close closes the idle connections.
+func (c *RedisCache) Close() error {
+	for {
+		select {
+		case conn := <-c.idle:
+			conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// bulk runs a command whose reply is a bulk string or nil.
+func (c *RedisCache) bulk(ctx context.Context, args ...string) ([]byte, bool, error) {
+	reply, err := c.do(ctx, args...)
+	if errors.Is(err, errRedisNil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("redis: unexpected %s reply %v", args[0], reply)
+	}
+	return value, true, nil
+}
+
+// do runs one command on a pooled connection. A connection that fails is
+// discarded rather than returned to the pool.
+func (c *RedisCache) do(ctx context.Context, args ...string) (any, error) {
+	conn, err := c.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := conn.do(ctx, args...)
+	var serverErr redisError
+	if err != nil && !errors.Is(err, errRedisNil) && !errors.As(err, &serverErr) {
+		conn.Close()
+		return nil, err
+	}
+	select {
+	case c.idle <- conn:
+	default:
+		conn.Close()
+	}
+	return reply, err
+}
+
+// conn returns an idle connection or dials, authenticates, and selects
+// the database on a new one.
+func (c *RedisCache) conn(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn := <-c.idle:
+		return conn, nil
+	default:
+	}
+	ctx, cancel := context.WithTimeout(ctx, CacheRedisTimeoutSeconds*time.Second)
+	defer cancel()
+	var d net.Dialer
+	raw, err := d.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, err
+	}
+	if c.tls != nil {
+		tc := tls.Client(raw, c.tls)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			raw.Close()
+			return nil, err
+		}
+		raw = tc
+	}
+	conn := &redisConn{Conn: raw, r: bufio.NewReader(raw)}
+	if c.password != "" {
+		args := []string{"AUTH", c.password}
+		if c.username != "" {
+			args = []string{"AUTH", c.username, c.password}
+		}
+		if _, err := conn.do(ctx, args...); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if c.db != 0 {
+		if _, err := conn.do(ctx, "SELECT", strconv.Itoa(c.db)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// redisConn is one connection to a Redis server.
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// redisError is an error reply from the server.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// do writes a command as a RESP array of bulk strings and reads its reply.
+func (c *redisConn) do(ctx context.Context, args ...string) (any, error) {
+	deadline := time.Now().Add(CacheRedisTimeoutSeconds * time.Second)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := c.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := c.Write([]byte(b.String())); err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+// read reads one RESP2 reply. Simple strings and integers are returned as
+// string and int64, bulk strings as []byte, and arrays as []any.
+func (c *redisConn) read() (any, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed reply %q", line)
+		}
+		if n < 0 {
+			return nil, errRedisNil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed reply %q", line)
+		}
+		if n < 0 {
+			return nil, errRedisNil
+		}
+		items := make([]any, n)
+		for i := range items {
+			items[i], err = c.read()
+			if err != nil && !errors.Is(err, errRedisNil) {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryCache(t *testing.T) {
+	c := NewMemoryCache()
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if err := c.Set(ctx, "a", []byte("1"), time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if v, ok, _ := c.Get(ctx, "a"); !ok || string(v) != "1" {
+		t.Fatalf("Get: got %q, %v", v, ok)
+	}
+	if v, ok, _ := c.Take(ctx, "a"); !ok || string(v) != "1" {
+		t.Fatalf("Take: got %q, %v", v, ok)
+	}
+	if _, ok, _ := c.Get(ctx, "a"); ok {
+		t.Fatal("expected Take to remove the value")
+	}
+
+	_ = c.Set(ctx, "b", []byte("2"), time.Minute)
+	now = now.Add(time.Minute)
+	if _, ok, _ := c.Get(ctx, "b"); ok {
+		t.Fatal("expected the value to expire")
+	}
+}
+
+// fakeRedis serves GET, SET with PX, GETDEL, DEL, PING, AUTH, and SELECT
+// from a map, recording every command it receives.
+type fakeRedis struct {
+	mu       sync.Mutex
+	data     map[string]string
+	commands [][]string
+}
+
+func startFakeRedis(t *testing.T) (*fakeRedis, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	f := &fakeRedis{data: make(map[string]string)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f, ln.Addr().String()
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readRESPCommand(r)
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.commands = append(f.commands, args)
+		var reply string
+		switch strings.ToUpper(args[0]) {
+		case "PING":
+			reply = "+PONG\r\n"
+		case "AUTH", "SELECT":
+			reply = "+OK\r\n"
+		case "SET":
+			f.data[args[1]] = args[2]
+			reply = "+OK\r\n"
+		case "GET", "GETDEL":
+			v, ok := f.data[args[1]]
+			if strings.ToUpper(args[0]) == "GETDEL" {
+				delete(f.data, args[1])
+			}
+			reply = "$-1\r\n"
+			if ok {
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+			}
+		case "DEL":
+			delete(f.data, args[1])
+			reply = ":1\r\n"
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		f.mu.Unlock()
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func readRESPCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		if _, err := r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args[i] = strings.TrimSuffix(arg, "\r\n")
+	}
+	return args, nil
+}
+
+func TestRedisCache(t *testing.T) {
+	f, addr := startFakeRedis(t)
+	c, err := NewRedisCache("redis://:secret@" + addr + "/2")
+	if err != nil {
+		t.Fatalf("NewRedisCache: %v", err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	if err := c.Set(ctx, "captcha:1", []byte("42"), 1500*time.Millisecond); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if v, ok, err := c.Get(ctx, "captcha:1"); err != nil || !ok || string(v) != "42" {
+		t.Fatalf("Get: got %q, %v, %v", v, ok, err)
+	}
+	if v, ok, err := c.Take(ctx, "captcha:1"); err != nil || !ok || string(v) != "42" {
+		t.Fatalf("Take: got %q, %v, %v", v, ok, err)
+	}
+	if _, ok, err := c.Get(ctx, "captcha:1"); err != nil || ok {
+		t.Fatalf("expected no value after Take, got %v, %v", ok, err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	want := []string{
+		"AUTH secret",
+		"SELECT 2",
+		"PING",
+		"SET moon:captcha:1 42 PX 1500",
+		"GET moon:captcha:1",
+		"GETDEL moon:captcha:1",
+		"GET moon:captcha:1",
+	}
+	if len(f.commands) != len(want) {
+		t.Fatalf("expected %d commands on one connection, got %v", len(want), f.commands)
+	}
+	for i, args := range f.commands {
+		if got := strings.Join(args, " "); got != want[i] {
+			t.Errorf("command %d: got %q; want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestParseRedisURL(t *testing.T) {
+	c, err := parseRedisURL("rediss://user:pw@cache.internal")
+	if err != nil {
+		t.Fatalf("parseRedisURL: %v", err)
+	}
+	if c.addr != "cache.internal:6379" || c.tls == nil || c.username != "user" || c.password != "pw" || c.db != 0 {
+		t.Fatalf("unexpected cache %+v", c)
+	}
+	for _, bad := range []string{"", "http://cache:6379", "redis://", "redis://cache/x"} {
+		if _, err := parseRedisURL(bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"fmt"
+	"net/http"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 )
 
@@ -16,43 +18,41 @@ type CaptchaChallengeDTO struct {
 	ExpiresIn   int    `json:"expires_in"`
 }
 
-type captchaChallenge struct {
-	answer    string
-	expiresAt time.Time
-}
-
-// CaptchaStore stores short-lived CAPTCHA challenges in memory.
+// CaptchaStore stores short-lived CAPTCHA challenges in a Cache. With a
+// shared cache, a challenge issued by one Moon instance can be answered on
+// another.
 type CaptchaStore struct {
-	mu         sync.Mutex
-	challenges map[string]captchaChallenge
-	now        func() time.Time
+	cache Cache
+	now   func() time.Time
 }
 
-// NewCaptchaStore creates a new empty CAPTCHA store.
+// NewCaptchaStore creates a CAPTCHA store backed by a new MemoryCache.
 func NewCaptchaStore() *CaptchaStore {
 	return &CaptchaStore{
-		challenges: make(map[string]captchaChallenge),
-		now:        time.Now,
+		cache: NewMemoryCache(),
+		now:   time.Now,
 	}
 }
 
+// SetCache replaces the cache the store keeps challenges in. It must be
+// called before the store is used.
+func (s *CaptchaStore) SetCache(c Cache) {
+	s.cache = c
+}
+
 // Issue creates and stores a new CAPTCHA challenge.
 func (s *CaptchaStore) Issue() (CaptchaChallengeDTO, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	now := s.now().UTC()
-	s.cleanupExpiredLocked(now)
-
 	answer, err := randomDigits(CaptchaCodeLength)
 	if err != nil {
 		return CaptchaChallengeDTO{}, err
 	}
 
 	id := GenerateULID()
-	s.challenges[id] = captchaChallenge{
-		answer:    answer,
-		expiresAt: now.Add(time.Duration(CaptchaTTLSeconds) * time.Second),
+	ttl := time.Duration(CaptchaTTLSeconds) * time.Second
+	expiresAt := s.now().UTC().Add(ttl)
+	value := strconv.FormatInt(expiresAt.UnixNano(), 10) + ":" + answer
+	if err := s.cache.Set(context.Background(), captchaCacheKey(id), []byte(value), ttl); err != nil {
+		return CaptchaChallengeDTO{}, fmt.Errorf("store captcha: %w", err)
 	}
 
 	return CaptchaChallengeDTO{
@@ -62,29 +62,26 @@ func (s *CaptchaStore) Issue() (CaptchaChallengeDTO, error) {
 	}, nil
 }
 
-// Validate verifies and consumes a CAPTCHA challenge.
+// Validate verifies and consumes a CAPTCHA challenge. A challenge that
+// cannot be read from the cache does not validate.
 func (s *CaptchaStore) Validate(id, answer string) bool {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	now := s.now().UTC()
-	s.cleanupExpiredLocked(now)
-
-	challenge, ok := s.challenges[id]
+	value, ok, err := s.cache.Take(context.Background(), captchaCacheKey(id))
+	if err != nil || !ok {
+		return false
+	}
+	expires, want, ok := strings.Cut(string(value), ":")
 	if !ok {
 		return false
 	}
-	delete(s.challenges, id)
-
-	return challenge.expiresAt.After(now) && strings.EqualFold(strings.TrimSpace(answer), challenge.answer)
+	nanos, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return false
+	}
+	return time.Unix(0, nanos).After(s.now()) && strings.EqualFold(strings.TrimSpace(answer), want)
 }
 
-func (s *CaptchaStore) cleanupExpiredLocked(now time.Time) {
-	for id, challenge := range s.challenges {
-		if !challenge.expiresAt.After(now) {
-			delete(s.challenges, id)
-		}
-	}
+func captchaCacheKey(id string) string {
+	return "captcha:" + id
 }
 
 func randomDigits(length int) (string, error) {
@@ -141,3 +138,34 @@ func renderCaptchaSVG(answer string) string {
 		textBuilder.String(),
 	)
 }
+
+// captchaLoginChallenge adapts a CaptchaStore to the LoginChallenge hook.
+// Answers are read from data.captcha_id and data.captcha_value.
+type captchaLoginChallenge struct {
+	store *CaptchaStore
+}
+
+// NewCaptchaLoginChallenge returns a LoginChallenge backed by store.
+func NewCaptchaLoginChallenge(store *CaptchaStore) LoginChallenge {
+	return &captchaLoginChallenge{store: store}
+}
+
+// Verify validates and consumes the CAPTCHA answer in data.
+func (c *captchaLoginChallenge) Verify(data map[string]any) bool {
+	id, _ := data["captcha_id"].(string)
+	value, _ := data["captcha_value"].(string)
+	if id == "" || value == "" {
+		return false
+	}
+	return c.store.Validate(id, value)
+}
+
+// Challenge issues a new CAPTCHA and writes it as a 403 challenge response.
+func (c *captchaLoginChallenge) Challenge(w http.ResponseWriter) {
+	challenge, err := c.store.Issue()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	WriteCaptchaChallenge(w, http.StatusForbidden, challenge)
+}
@@ -2,8 +2,10 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -25,7 +27,7 @@ func TestCaptchaStore_IssueAndValidate(t *testing.T) {
 		t.Fatal("expected image data")
 	}
 
-	answer := store.challenges[challenge.ID].answer
+	answer := captchaAnswer(t, store, challenge.ID)
 	if !store.Validate(challenge.ID, answer) {
 		t.Fatal("expected challenge to validate")
 	}
@@ -45,7 +47,7 @@ func TestCaptchaStore_ExpiredChallenge(t *testing.T) {
 	}
 
 	now = now.Add(time.Duration(CaptchaTTLSeconds+1) * time.Second)
-	answer := store.challenges[challenge.ID].answer
+	answer := captchaAnswer(t, store, challenge.ID)
 	if store.Validate(challenge.ID, answer) {
 		t.Fatal("expected expired challenge to fail")
 	}
@@ -93,7 +95,7 @@ func TestCaptchaMiddleware(t *testing.T) {
 		if err != nil {
 			t.Fatalf("Issue: %v", err)
 		}
-		answer := store.challenges[challenge.ID].answer
+		answer := captchaAnswer(t, store, challenge.ID)
 
 		innerCalled = false
 		req := httptest.NewRequest(http.MethodPost, "/data/contact:mutate", bytes.NewBufferString(`{"captcha_id":"`+challenge.ID+`","captcha_value":"`+answer+`","op":"create","data":[{}]}`))
@@ -131,3 +133,15 @@ func TestCaptchaMiddleware(t *testing.T) {
 		}
 	})
 }
+
+// captchaAnswer returns the answer to the stored challenge id without
+// consuming it.
+func captchaAnswer(t *testing.T, store *CaptchaStore, id string) string {
+	t.Helper()
+	value, ok, err := store.cache.Get(context.Background(), captchaCacheKey(id))
+	if err != nil || !ok {
+		t.Fatalf("challenge %s not stored: %v", id, err)
+	}
+	_, answer, _ := strings.Cut(string(value), ":")
+	return answer
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Collection aliases keep the old name of a renamed collection working for
+// a grace period. Data requests for an alias are redirected to the new name
+// with 308 Permanent Redirect, which preserves the method and body.
+
+// setCollectionAlias points alias at target until expiresAt, replacing any
+// previous alias with that name.
+func setCollectionAlias(ctx context.Context, db DatabaseAdapter, alias, target string, expiresAt time.Time) error {
+	if err := removeCollectionAlias(ctx, db, alias); err != nil {
+		return err
+	}
+	return db.InsertRow(ctx, CollectionAliasesTable, map[string]any{
+		"id":         GenerateULID(),
+		"name":       alias,
+		"target":     target,
+		"expires_at": expiresAt.UTC().Format(time.RFC3339),
+		"created_at": time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// removeCollectionAlias deletes the alias named name, if any.
+func removeCollectionAlias(ctx context.Context, db DatabaseAdapter, name string) error {
+	rows, _, err := db.QueryRows(ctx, CollectionAliasesTable, QueryOptions{
+		Filters: []Filter{{Field: "name", Op: "eq", Value: name}},
+		Page:    1,
+		PerPage: 1,
+	})
+	if err != nil || len(rows) == 0 {
+		return err
+	}
+	return db.DeleteRow(ctx, CollectionAliasesTable, stringVal(rows[0], "id"))
+}
+
+// retargetCollectionAliases points every alias of from at to, so aliases
+// left by an earlier rename follow the collection.
+func retargetCollectionAliases(ctx context.Context, db DatabaseAdapter, from, to string) error {
+	for {
+		rows, _, err := db.QueryRows(ctx, CollectionAliasesTable, QueryOptions{
+			Filters: []Filter{{Field: "target", Op: "eq", Value: from}},
+			Page:    1,
+			PerPage: MaxPerPage,
+		})
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if err := db.UpdateRow(ctx, CollectionAliasesTable, stringVal(row, "id"), map[string]any{"target": to}); err != nil {
+				return err
+			}
+		}
+		if len(rows) < MaxPerPage {
+			return nil
+		}
+	}
+}
+
+// lookupCollectionAlias returns the target of an unexpired alias, or "".
+func lookupCollectionAlias(ctx context.Context, db DatabaseAdapter, name string) (string, error) {
+	rows, _, err := db.QueryRows(ctx, CollectionAliasesTable, QueryOptions{
+		Filters: []Filter{
+			{Field: "name", Op: "eq", Value: name},
+			{Field: "expires_at", Op: "gt", Value: time.Now().UTC().Format(time.RFC3339)},
+		},
+		Page:    1,
+		PerPage: 1,
+	})
+	if err != nil || len(rows) == 0 {
+		return "", err
+	}
+	return stringVal(rows[0], "target"), nil
+}
+
+// collectionAliasMiddleware redirects /data/{alias}:{action} requests to
+// the collection the alias points at. Only names missing from the registry
+// are looked up, so a real collection always wins over an alias.
+func collectionAliasMiddleware(prefix string, db DatabaseAdapter, registry *SchemaRegistry, next http.Handler) http.Handler {
+	dataPrefix := strings.TrimRight(prefix, "/") + "/data/"
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rest, ok := strings.CutPrefix(r.URL.Path, dataPrefix)
+		colonIdx := strings.LastIndex(rest, ":")
+		if !ok || colonIdx <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		resource := rest[:colonIdx]
+		if _, exists := registry.Get(resource); exists {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		target, err := lookupCollectionAlias(r.Context(), db, resource)
+		if err != nil || target == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		location := dataPrefix + target + rest[colonIdx:]
+		if r.URL.RawQuery != "" {
+			location += "?" + r.URL.RawQuery
+		}
+		w.Header().Set("Deprecation", "true")
+		http.Redirect(w, r, location, http.StatusPermanentRedirect)
+	})
+}
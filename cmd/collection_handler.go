@@ -3,19 +3,25 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"math"
 	"net/http"
-	"strconv"
 	"strings"
+	"time"
 )
 
-// CollectionHandler implements GET /collections:query and POST /collections:mutate.
+// CollectionHandler implements GET /collections:query, POST /collections:mutate,
+// POST /collections:refresh, POST /collections:rename,
+// POST /collections:infer, and GET /collections:migrations.
 type CollectionHandler struct {
 	db       DatabaseAdapter
 	registry *SchemaRegistry
 	cfg      *AppConfig
 	prefix   string
+
+	// permissions, when set, drops the rules of destroyed collections and
+	// moves the rules of renamed ones.
+	permissions *PermissionStore
 }
 
 // NewCollectionHandler creates a CollectionHandler with the given dependencies.
@@ -28,6 +34,12 @@ func NewCollectionHandler(db DatabaseAdapter, registry *SchemaRegistry, cfg *App
 	}
 }
 
+// SetPermissions sets the store whose rules are removed when a collection
+// is destroyed. A nil store disables the cleanup.
+func (h *CollectionHandler) SetPermissions(store *PermissionStore) {
+	h.permissions = store
+}
+
 // ---------------------------------------------------------------------------
 // GET /collections:query
 // ---------------------------------------------------------------------------
@@ -59,7 +71,7 @@ func (h *CollectionHandler) handleGetOne(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	count, err := h.db.CountRows(context.Background(), col.Name)
+	count, err := h.db.CountRows(r.Context(), col.Name)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, "Internal server error")
 		return
@@ -74,10 +86,6 @@ func (h *CollectionHandler) handleList(w http.ResponseWriter, r *http.Request) {
 
 	allCollections := filterCollectionsByIdentity(r.Context(), h.registry.List())
 	total := len(allCollections)
-	totalPages := 1
-	if total > 0 {
-		totalPages = int(math.Ceil(float64(total) / float64(perPage)))
-	}
 
 	start := (page - 1) * perPage
 	end := start + perPage
@@ -91,7 +99,7 @@ func (h *CollectionHandler) handleList(w http.ResponseWriter, r *http.Request) {
 
 	data := make([]any, 0, len(pageItems))
 	for _, col := range pageItems {
-		count, err := h.db.CountRows(context.Background(), col.Name)
+		count, err := h.db.CountRows(r.Context(), col.Name)
 		if err != nil {
 			WriteError(w, http.StatusInternalServerError, "Internal server error")
 			return
@@ -99,15 +107,7 @@ func (h *CollectionHandler) handleList(w http.ResponseWriter, r *http.Request) {
 		data = append(data, map[string]any{"name": col.Name, "count": count, "system": col.System})
 	}
 
-	basePath := h.prefix + "/collections:query"
-	meta := map[string]any{
-		"total":        total,
-		"count":        len(data),
-		"per_page":     perPage,
-		"current_page": page,
-		"total_pages":  totalPages,
-	}
-	links := buildPaginationLinks(basePath, page, perPage, totalPages)
+	meta, links := buildPagination(h.prefix+"/collections:query", r.URL.Query(), total, len(data), page, perPage)
 
 	WriteSuccessFull(w, http.StatusOK, "Collections retrieved successfully", data, meta, links)
 }
@@ -133,6 +133,198 @@ func isCollectionVisibleToIdentity(ctx context.Context, name string) bool {
 	return stringInSlice(name, identity.Collections)
 }
 
+// ---------------------------------------------------------------------------
+// POST /collections:refresh
+// ---------------------------------------------------------------------------
+
+// HandleRefresh re-introspects the database, atomically swaps the schema
+// registry, and reports which collections were added, removed, or changed.
+// It is used after the database has been altered outside of Moon.
+func (h *CollectionHandler) HandleRefresh(w http.ResponseWriter, r *http.Request) {
+	identity, ok := GetAuthIdentity(r.Context())
+	if !ok || !identity.ManagesCollections() {
+		WriteError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	diff, err := h.registry.RefreshWithDiff()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Failed to refresh collections")
+		return
+	}
+
+	h.publishSchemaVersion()
+
+	WriteSuccess(w, http.StatusOK, "Collections refreshed successfully", []any{diff})
+}
+
+// publishSchemaVersion announces a schema change to other Moon instances
+// sharing the database. The local registry is already correct, so a
+// failure does not fail the request; the registry logs it and retries.
+func (h *CollectionHandler) publishSchemaVersion() {
+	h.registry.AnnounceChange(context.Background())
+}
+
+// ---------------------------------------------------------------------------
+// POST /collections:rename
+// ---------------------------------------------------------------------------
+
+// collectionRenameRequest is the JSON body for POST /collections:rename.
+type collectionRenameRequest struct {
+	Data []collectionRenameItem `json:"data"`
+}
+
+// collectionRenameItem renames one collection. AliasDays, when positive,
+// keeps the old name as a redirecting alias for that many days.
+type collectionRenameItem struct {
+	Name      string `json:"name"`
+	NewName   string `json:"new_name"`
+	AliasDays int    `json:"alias_days,omitempty"`
+}
+
+// HandleRename renames collections. Rows, permission rules, templates, and
+// API key collection lists move to the new name.
+func (h *CollectionHandler) HandleRename(w http.ResponseWriter, r *http.Request) {
+	identity, ok := GetAuthIdentity(r.Context())
+	if !ok || !identity.ManagesCollections() {
+		WriteError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	var req collectionRenameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if len(req.Data) == 0 {
+		WriteError(w, http.StatusBadRequest, "Data must not be empty")
+		return
+	}
+
+	ctx := r.Context()
+	var results []any
+	for _, item := range req.Data {
+		if err := h.validateRenameItem(item); err != nil {
+			writeCollectionError(w, err)
+			return
+		}
+
+		ddl := fmt.Sprintf("ALTER TABLE %s RENAME TO %s", quoteIdent(item.Name), quoteIdent(item.NewName))
+		if err := h.db.ExecDDL(ctx, ddl); err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		if err := h.moveCollectionReferences(ctx, item); err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		if err := h.registry.Refresh(); err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		h.publishSchemaVersion()
+
+		result := map[string]any{"name": item.NewName, "old_name": item.Name, "alias_expires_at": nil}
+		if item.AliasDays > 0 {
+			expiresAt := time.Now().UTC().AddDate(0, 0, item.AliasDays)
+			if err := setCollectionAlias(ctx, h.db, item.Name, item.NewName, expiresAt); err != nil {
+				WriteError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			result["alias_expires_at"] = expiresAt.Format(time.RFC3339)
+		}
+		results = append(results, result)
+	}
+
+	meta := map[string]any{"success": len(results), "failed": 0}
+	WriteSuccessFull(w, http.StatusOK, "Collection renamed successfully", results, meta, nil)
+}
+
+func (h *CollectionHandler) validateRenameItem(item collectionRenameItem) *collectionError {
+	if item.Name == "" || item.NewName == "" {
+		return &collectionError{Status: http.StatusBadRequest, Message: "Collection name and new_name are required"}
+	}
+	if strings.HasPrefix(item.Name, "moon_") {
+		return &collectionError{Status: http.StatusBadRequest, Message: "Collection name is reserved"}
+	}
+	if item.Name == "users" || item.Name == "apikeys" {
+		return &collectionError{Status: http.StatusForbidden, Message: "Forbidden"}
+	}
+	if _, exists := h.registry.Get(item.Name); !exists {
+		return &collectionError{Status: http.StatusNotFound, Message: fmt.Sprintf("Collection '%s' not found", item.Name)}
+	}
+	if err := h.migrationConflict(item.Name); err != nil {
+		return err
+	}
+	if err := ValidateCollectionName(item.NewName); err != nil {
+		return &collectionError{Status: http.StatusBadRequest, Message: err.Error()}
+	}
+	if _, exists := h.registry.Get(item.NewName); exists {
+		return &collectionError{Status: http.StatusConflict, Message: fmt.Sprintf("Collection '%s' already exists", item.NewName)}
+	}
+	if item.AliasDays < 0 || item.AliasDays > MaxCollectionAliasDays {
+		return &collectionError{Status: http.StatusBadRequest, Message: fmt.Sprintf("alias_days must be between 0 and %d", MaxCollectionAliasDays)}
+	}
+	return nil
+}
+
+// moveCollectionReferences points everything that names a renamed
+// collection at its new name. An alias with the new name is dropped, since
+// the real collection now owns that name.
+func (h *CollectionHandler) moveCollectionReferences(ctx context.Context, item collectionRenameItem) error {
+	if h.permissions != nil {
+		if err := h.permissions.RenameCollection(ctx, item.Name, item.NewName); err != nil {
+			return err
+		}
+	}
+	if err := renameCollectionTemplates(ctx, h.db, item.Name, item.NewName); err != nil {
+		return err
+	}
+	if err := renameCollectionValidator(ctx, h.db, item.Name, item.NewName); err != nil {
+		return err
+	}
+	if err := renameCollectionAttributes(ctx, h.db, item.Name, item.NewName); err != nil {
+		return err
+	}
+	if err := retargetCollectionAliases(ctx, h.db, item.Name, item.NewName); err != nil {
+		return err
+	}
+	if err := removeCollectionAlias(ctx, h.db, item.NewName); err != nil {
+		return err
+	}
+
+	for page := 1; ; page++ {
+		rows, _, err := h.db.QueryRows(ctx, "apikeys", QueryOptions{
+			Sort:    []SortField{{Field: "id"}},
+			Page:    page,
+			PerPage: MaxPerPage,
+		})
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			collections, err := parseCollections(row["collections"])
+			if err != nil || !stringInSlice(item.Name, collections) {
+				continue
+			}
+			for i, name := range collections {
+				if name == item.Name {
+					collections[i] = item.NewName
+				}
+			}
+			if err := h.db.UpdateRow(ctx, "apikeys", stringVal(row, "id"), map[string]any{
+				"collections": prepareValueForDB(collections, MoonFieldTypeJSON),
+			}); err != nil {
+				return err
+			}
+		}
+		if len(rows) < MaxPerPage {
+			return nil
+		}
+	}
+}
+
 // ---------------------------------------------------------------------------
 // POST /collections:mutate
 // ---------------------------------------------------------------------------
@@ -145,16 +337,24 @@ type collectionMutateRequest struct {
 
 // collectionCreateItem is a single item in op=create.
 type collectionCreateItem struct {
-	Name    string             `json:"name"`
-	Columns []collectionColumn `json:"columns"`
+	Name       string             `json:"name"`
+	Columns    []collectionColumn `json:"columns"`
+	Timestamps bool               `json:"timestamps,omitempty"`
+	Versioned  bool               `json:"versioned,omitempty"`
+	Owned      bool               `json:"owned,omitempty"`
+	Attributes bool               `json:"attributes,omitempty"`
 }
 
 // collectionColumn is a column definition for create/add_columns.
 type collectionColumn struct {
-	Name     string `json:"name"`
-	Type     string `json:"type"`
-	Nullable *bool  `json:"nullable,omitempty"`
-	Unique   *bool  `json:"unique,omitempty"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Nullable  *bool  `json:"nullable,omitempty"`
+	Unique    *bool  `json:"unique,omitempty"`
+	Collation string `json:"collation,omitempty"`
+	Precision *int   `json:"precision,omitempty"`
+	Scale     *int   `json:"scale,omitempty"`
+	FieldRules
 }
 
 // collectionUpdateItem is a single item in op=update.
@@ -180,7 +380,7 @@ type collectionDestroyItem struct {
 // HandleMutate dispatches collection mutation operations.
 func (h *CollectionHandler) HandleMutate(w http.ResponseWriter, r *http.Request) {
 	identity, ok := GetAuthIdentity(r.Context())
-	if !ok || identity.Role != "admin" {
+	if !ok || !identity.ManagesCollections() {
 		WriteError(w, http.StatusForbidden, "Forbidden")
 		return
 	}
@@ -222,10 +422,34 @@ func (h *CollectionHandler) handleCreate(w http.ResponseWriter, rawItems []json.
 			return
 		}
 
+		if item.Timestamps {
+			item.Columns = append(item.Columns,
+				collectionColumn{Name: FieldCreatedAt, Type: MoonFieldTypeDatetime},
+				collectionColumn{Name: FieldUpdatedAt, Type: MoonFieldTypeDatetime},
+			)
+		}
+
+		if item.Owned {
+			// Nullable so that rows created without an authenticated
+			// caller remain valid; only admins can see them.
+			nullable := true
+			item.Columns = append(item.Columns,
+				collectionColumn{Name: FieldOwnerID, Type: MoonFieldTypeString, Nullable: &nullable})
+		}
+
 		if err := h.validateCreateItem(item); err != nil {
 			writeCollectionError(w, err)
 			return
 		}
+		if item.Versioned {
+			// Appended after validation: _version is outside the client
+			// column namespace, so it cannot collide with a declared column.
+			item.Columns = append(item.Columns, collectionColumn{Name: FieldVersion, Type: MoonFieldTypeInteger})
+		}
+		if item.Attributes {
+			nullable := true
+			item.Columns = append(item.Columns, collectionColumn{Name: FieldAttributes, Type: MoonFieldTypeJSON, Nullable: &nullable})
+		}
 
 		ddl := h.buildCreateDDL(item)
 		if err := h.db.ExecDDL(context.Background(), ddl); err != nil {
@@ -237,15 +461,24 @@ func (h *CollectionHandler) handleCreate(w http.ResponseWriter, rawItems []json.
 			WriteError(w, http.StatusInternalServerError, "Internal server error")
 			return
 		}
+		h.publishSchemaVersion()
 
 		cols := make([]map[string]any, 0, len(item.Columns))
 		for _, c := range item.Columns {
-			cols = append(cols, map[string]any{
+			desc := map[string]any{
 				"name":     c.Name,
 				"type":     c.Type,
 				"nullable": boolVal(c.Nullable, false),
 				"unique":   boolVal(c.Unique, false),
-			})
+			}
+			if c.Collation == CollationNocase {
+				desc["collation"] = c.Collation
+			}
+			if c.Precision != nil {
+				addDecimalKeys(desc, *c.Precision, intVal(c.Scale))
+			}
+			addFieldRuleKeys(desc, c.FieldRules)
+			cols = append(cols, desc)
 		}
 		results = append(results, map[string]any{
 			"name":    item.Name,
@@ -270,8 +503,8 @@ func (h *CollectionHandler) validateCreateItem(item collectionCreateItem) *colle
 		return &collectionError{Status: http.StatusForbidden, Message: "Forbidden"}
 	}
 
-	if !IsValidCollectionName(item.Name) {
-		return &collectionError{Status: http.StatusBadRequest, Message: fmt.Sprintf("Invalid collection name %q", item.Name)}
+	if err := ValidateCollectionName(item.Name); err != nil {
+		return &collectionError{Status: http.StatusBadRequest, Message: err.Error()}
 	}
 
 	if _, exists := h.registry.Get(item.Name); exists {
@@ -287,12 +520,21 @@ func (h *CollectionHandler) validateCreateItem(item collectionCreateItem) *colle
 		if col.Name == "id" {
 			return &collectionError{Status: http.StatusBadRequest, Message: "Column 'id' is managed by the server"}
 		}
-		if !IsValidFieldName(col.Name) {
-			return &collectionError{Status: http.StatusBadRequest, Message: fmt.Sprintf("Invalid column name %q", col.Name)}
+		if err := ValidateFieldName(col.Name); err != nil {
+			return &collectionError{Status: http.StatusBadRequest, Message: err.Error()}
 		}
 		if !isValidMoonType(col.Type) {
 			return &collectionError{Status: http.StatusBadRequest, Message: fmt.Sprintf("Invalid column type %q", col.Type)}
 		}
+		if err := validateColumnCollation(col); err != nil {
+			return err
+		}
+		if err := validateColumnDecimal(col); err != nil {
+			return err
+		}
+		if err := validateColumnRules(col); err != nil {
+			return err
+		}
 		if seen[col.Name] {
 			return &collectionError{Status: http.StatusBadRequest, Message: fmt.Sprintf("Duplicate column name %q", col.Name)}
 		}
@@ -309,13 +551,15 @@ func (h *CollectionHandler) buildCreateDDL(item collectionCreateItem) string {
 		sb.WriteString(", ")
 		sb.WriteString(quoteIdent(col.Name))
 		sb.WriteString(" ")
-		sb.WriteString(moonTypeToSQLite(col.Type))
+		sb.WriteString(columnTypeSQL(col))
 		if !boolVal(col.Nullable, false) {
 			sb.WriteString(" NOT NULL")
 		}
+		sb.WriteString(collationClause(col.Collation))
 		if boolVal(col.Unique, false) {
 			sb.WriteString(" UNIQUE")
 		}
+		sb.WriteString(fieldRulesCheckSQL(col.Name, col.FieldRules))
 	}
 	sb.WriteString(")")
 	return sb.String()
@@ -332,6 +576,7 @@ func (h *CollectionHandler) handleUpdate(w http.ResponseWriter, rawItems []json.
 	}
 
 	var results []any
+	migrating := 0
 	for _, raw := range rawItems {
 		var item collectionUpdateItem
 		if err := json.Unmarshal(raw, &item); err != nil {
@@ -353,6 +598,7 @@ func (h *CollectionHandler) handleUpdate(w http.ResponseWriter, rawItems []json.
 			WriteError(w, http.StatusInternalServerError, "Internal server error")
 			return
 		}
+		h.publishSchemaVersion()
 
 		col, ok := h.registry.Get(item.Name)
 		if !ok {
@@ -366,20 +612,36 @@ func (h *CollectionHandler) handleUpdate(w http.ResponseWriter, rawItems []json.
 			if f.Name == "id" {
 				continue
 			}
-			cols = append(cols, map[string]any{
+			desc := map[string]any{
 				"name":     f.Name,
 				"type":     f.Type,
 				"nullable": f.Nullable,
 				"unique":   f.Unique,
-			})
+			}
+			if f.Collation != "" {
+				desc["collation"] = f.Collation
+			}
+			addDecimalKeys(desc, f.Precision, f.Scale)
+			addFieldRuleKeys(desc, f.Rules)
+			cols = append(cols, desc)
 		}
-		results = append(results, map[string]any{
+		result := map[string]any{
 			"name":    item.Name,
 			"columns": cols,
-		})
+		}
+		// A scheduled migration has not changed the columns yet.
+		if m, ok := h.registry.Migrations().Active(item.Name); ok {
+			result["migration"] = m
+			migrating++
+		}
+		results = append(results, result)
 	}
 
 	meta := map[string]any{"success": len(results), "failed": 0}
+	if migrating > 0 {
+		WriteSuccessFull(w, http.StatusAccepted, "Collection update accepted; migration in progress", results, meta, nil)
+		return
+	}
 	WriteSuccessFull(w, http.StatusOK, "Collection updated successfully", results, meta, nil)
 }
 
@@ -397,6 +659,9 @@ func (h *CollectionHandler) validateUpdateItem(item collectionUpdateItem) *colle
 	if _, exists := h.registry.Get(item.Name); !exists {
 		return &collectionError{Status: http.StatusNotFound, Message: fmt.Sprintf("Collection '%s' not found", item.Name)}
 	}
+	if err := h.migrationConflict(item.Name); err != nil {
+		return err
+	}
 
 	opCount := 0
 	if len(item.AddColumns) > 0 {
@@ -447,12 +712,27 @@ func (h *CollectionHandler) executeAddColumns(ctx context.Context, table string,
 		if c.Name == "id" {
 			return &collectionError{Status: http.StatusBadRequest, Message: "Column 'id' is managed by the server"}
 		}
-		if !IsValidFieldName(c.Name) {
-			return &collectionError{Status: http.StatusBadRequest, Message: fmt.Sprintf("Invalid column name %q", c.Name)}
+		if err := ValidateFieldName(c.Name); err != nil {
+			return &collectionError{Status: http.StatusBadRequest, Message: err.Error()}
 		}
 		if !isValidMoonType(c.Type) {
 			return &collectionError{Status: http.StatusBadRequest, Message: fmt.Sprintf("Invalid column type %q", c.Type)}
 		}
+		if err := validateColumnCollation(c); err != nil {
+			return err
+		}
+		if err := validateColumnDecimal(c); err != nil {
+			return err
+		}
+		if err := validateColumnRules(c); err != nil {
+			return err
+		}
+		if !boolVal(c.Nullable, false) && !c.FieldRules.IsZero() {
+			// Existing rows receive the type default, which must satisfy the rules.
+			if c.FieldRules.Check(c.Name, defaultValueForType(c.Type)) != nil {
+				return &collectionError{Status: http.StatusBadRequest, Message: fmt.Sprintf("Column '%s' must be nullable because its rules reject the default value for existing rows", c.Name)}
+			}
+		}
 		if existing[c.Name] {
 			return &collectionError{Status: http.StatusConflict, Message: fmt.Sprintf("Column '%s' already exists", c.Name)}
 		}
@@ -469,7 +749,7 @@ func (h *CollectionHandler) executeAddColumns(ctx context.Context, table string,
 func (h *CollectionHandler) buildAddColumnDDL(table string, c collectionColumn) string {
 	var sb strings.Builder
 	sb.WriteString(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s",
-		quoteIdent(table), quoteIdent(c.Name), moonTypeToSQLite(c.Type)))
+		quoteIdent(table), quoteIdent(c.Name), columnTypeSQL(c)))
 
 	nullable := boolVal(c.Nullable, false)
 	if !nullable {
@@ -477,9 +757,11 @@ func (h *CollectionHandler) buildAddColumnDDL(table string, c collectionColumn)
 		// to satisfy existing rows. This is a safety/compatibility choice.
 		sb.WriteString(fmt.Sprintf(" NOT NULL DEFAULT %s", defaultForType(c.Type)))
 	}
+	sb.WriteString(collationClause(c.Collation))
 	if boolVal(c.Unique, false) {
 		sb.WriteString(" UNIQUE")
 	}
+	sb.WriteString(fieldRulesCheckSQL(c.Name, c.FieldRules))
 	return sb.String()
 }
 
@@ -497,8 +779,8 @@ func (h *CollectionHandler) executeRenameColumns(ctx context.Context, table stri
 		if !existing[r.OldName] {
 			return &collectionError{Status: http.StatusBadRequest, Message: fmt.Sprintf("Column '%s' does not exist", r.OldName)}
 		}
-		if !IsValidFieldName(r.NewName) {
-			return &collectionError{Status: http.StatusBadRequest, Message: fmt.Sprintf("Invalid column name %q", r.NewName)}
+		if err := ValidateFieldName(r.NewName); err != nil {
+			return &collectionError{Status: http.StatusBadRequest, Message: err.Error()}
 		}
 
 		ddl := fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s",
@@ -530,31 +812,56 @@ func (h *CollectionHandler) executeModifyColumns(ctx context.Context, table stri
 		if !isValidMoonType(c.Type) {
 			return &collectionError{Status: http.StatusBadRequest, Message: fmt.Sprintf("Invalid column type %q", c.Type)}
 		}
+		if err := validateColumnCollation(c); err != nil {
+			return err
+		}
+		if err := validateColumnDecimal(c); err != nil {
+			return err
+		}
+		if err := validateColumnRules(c); err != nil {
+			return err
+		}
 	}
 
-	// SQLite does not support ALTER COLUMN. Recreate the table with
-	// modified column definitions, copy data, drop the original, and rename.
-	if err := h.recreateTableWithModifications(ctx, table, col, cols); err != nil {
+	// SQLite does not support ALTER COLUMN. Rebuild the table through a
+	// shadow table with the new shape. A collection that fits in one batch
+	// is rebuilt before the response; a larger one by the migration
+	// scheduler, whose progress GET /collections:migrations reports.
+	shadow, createDDL := shadowTableFor(table, col, cols)
+	migrations := h.registry.Migrations()
+	count, err := h.db.CountRows(ctx, table)
+	if err != nil {
+		return &collectionError{Status: http.StatusInternalServerError, Message: "Internal server error"}
+	}
+	if count > ShadowTableBatchSize && migrations.Running() {
+		_, err = migrations.Schedule(ctx, shadow, createDDL)
+	} else {
+		_, err = migrations.Run(ctx, shadow, createDDL)
+	}
+	switch {
+	case errors.Is(err, errMigrationInProgress):
+		return migrationConflictError(table)
+	case err != nil:
 		return &collectionError{Status: http.StatusInternalServerError, Message: "Internal server error"}
 	}
 	return nil
 }
 
-func (h *CollectionHandler) recreateTableWithModifications(ctx context.Context, table string, col *Collection, mods []collectionColumn) error {
+// shadowTableFor returns the shadow table that gives table the column
+// modifications mods, and the DDL creating it.
+func shadowTableFor(table string, col *Collection, mods []collectionColumn) (ShadowTable, string) {
 	modMap := make(map[string]collectionColumn)
 	for _, m := range mods {
 		modMap[m.Name] = m
 	}
 
-	tempTable := table + "_moon_tmp_" + GenerateULID()
-
+	shadow := ShadowTable{Table: table, Name: ShadowTablePrefix + strings.ToLower(GenerateULID())}
 	var colDefs []string
-	var colNames []string
 
 	for _, f := range col.Fields {
+		shadow.Columns = append(shadow.Columns, f.Name)
 		if f.Name == "id" {
 			colDefs = append(colDefs, fmt.Sprintf("%s TEXT PRIMARY KEY", quoteIdent("id")))
-			colNames = append(colNames, quoteIdent("id"))
 			continue
 		}
 
@@ -562,39 +869,35 @@ func (h *CollectionHandler) recreateTableWithModifications(ctx context.Context,
 		fieldType := f.Type
 		nullable := f.Nullable
 		unique := f.Unique
+		collation := f.Collation
+		rules := f.Rules
+		sqlType := moonTypeToSQLite(fieldType)
+		if fieldType == MoonFieldTypeDecimal {
+			sqlType = decimalTypeSQL(f.Precision, f.Scale)
+		}
 
 		if isModified {
 			fieldType = mod.Type
 			nullable = boolVal(mod.Nullable, false)
 			unique = boolVal(mod.Unique, false)
+			collation = mod.Collation
+			rules = mod.FieldRules
+			sqlType = columnTypeSQL(mod)
 		}
 
-		def := fmt.Sprintf("%s %s", quoteIdent(f.Name), moonTypeToSQLite(fieldType))
+		def := fmt.Sprintf("%s %s", quoteIdent(f.Name), sqlType)
 		if !nullable {
 			def += " NOT NULL"
 		}
+		def += collationClause(collation)
 		if unique {
 			def += " UNIQUE"
 		}
+		def += fieldRulesCheckSQL(f.Name, rules)
 		colDefs = append(colDefs, def)
-		colNames = append(colNames, quoteIdent(f.Name))
 	}
 
-	colNameStr := strings.Join(colNames, ", ")
-
-	steps := []string{
-		fmt.Sprintf("CREATE TABLE %s (%s)", quoteIdent(tempTable), strings.Join(colDefs, ", ")),
-		fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s", quoteIdent(tempTable), colNameStr, colNameStr, quoteIdent(table)),
-		fmt.Sprintf("DROP TABLE %s", quoteIdent(table)),
-		fmt.Sprintf("ALTER TABLE %s RENAME TO %s", quoteIdent(tempTable), quoteIdent(table)),
-	}
-
-	for _, ddl := range steps {
-		if err := h.db.ExecDDL(ctx, ddl); err != nil {
-			return err
-		}
-	}
-	return nil
+	return shadow, fmt.Sprintf("CREATE TABLE %s (%s)", quoteIdent(shadow.Name), strings.Join(colDefs, ", "))
 }
 
 func (h *CollectionHandler) executeRemoveColumns(ctx context.Context, table string, colNames []string) *collectionError {
@@ -611,6 +914,9 @@ func (h *CollectionHandler) executeRemoveColumns(ctx context.Context, table stri
 		if !existing[name] {
 			return &collectionError{Status: http.StatusBadRequest, Message: fmt.Sprintf("Column '%s' does not exist", name)}
 		}
+		if indexes := indexesUsingColumn(col, name); len(indexes) > 0 {
+			return &collectionError{Status: http.StatusConflict, Message: fmt.Sprintf("Column '%s' is used by index '%s'; drop the index first", name, indexes[0])}
+		}
 
 		ddl := fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", quoteIdent(table), quoteIdent(name))
 		if err := h.db.ExecDDL(ctx, ddl); err != nil {
@@ -655,17 +961,40 @@ func (h *CollectionHandler) handleDestroy(w http.ResponseWriter, rawItems []json
 			WriteError(w, http.StatusNotFound, fmt.Sprintf("Collection '%s' not found", item.Name))
 			return
 		}
+		if err := h.migrationConflict(item.Name); err != nil {
+			writeCollectionError(w, err)
+			return
+		}
 
 		ddl := fmt.Sprintf("DROP TABLE %s", quoteIdent(item.Name))
 		if err := h.db.ExecDDL(context.Background(), ddl); err != nil {
 			WriteError(w, http.StatusInternalServerError, "Internal server error")
 			return
 		}
+		if h.permissions != nil {
+			if err := h.permissions.RemoveCollection(context.Background(), item.Name); err != nil {
+				WriteError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+		}
+		if err := removeCollectionTemplates(context.Background(), h.db, item.Name); err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		if err := removeCollectionValidator(context.Background(), h.db, item.Name); err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		if err := removeCollectionAttributes(context.Background(), h.db, item.Name); err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
 
 		if err := h.registry.Refresh(); err != nil {
 			WriteError(w, http.StatusInternalServerError, "Internal server error")
 			return
 		}
+		h.publishSchemaVersion()
 
 		results = append(results, map[string]any{"name": item.Name})
 	}
@@ -718,6 +1047,15 @@ func moonTypeToSQLite(t string) string {
 	}
 }
 
+// columnTypeSQL returns the SQLite column type for a column definition,
+// including the precision and scale of a decimal column.
+func columnTypeSQL(c collectionColumn) string {
+	if c.Type == MoonFieldTypeDecimal && c.Precision != nil {
+		return decimalTypeSQL(*c.Precision, intVal(c.Scale))
+	}
+	return moonTypeToSQLite(c.Type)
+}
+
 // defaultForType returns a SQL default literal for ADD COLUMN NOT NULL in SQLite.
 func defaultForType(t string) string {
 	switch t {
@@ -728,57 +1066,146 @@ func defaultForType(t string) string {
 	}
 }
 
-// boolVal returns the value pointed to by p, or the fallback if p is nil.
-func boolVal(p *bool, fallback bool) bool {
-	if p == nil {
-		return fallback
+// validateColumnCollation checks the optional collation of a column
+// definition. Only string columns may use a non-binary collation.
+func validateColumnCollation(c collectionColumn) *collectionError {
+	switch c.Collation {
+	case "", CollationBinary:
+		return nil
+	case CollationNocase:
+		if c.Type != MoonFieldTypeString {
+			return &collectionError{Status: http.StatusBadRequest, Message: fmt.Sprintf("Collation %q is only valid for string columns", c.Collation)}
+		}
+		return nil
+	default:
+		return &collectionError{Status: http.StatusBadRequest, Message: fmt.Sprintf("Invalid collation %q", c.Collation)}
 	}
-	return *p
 }
 
-// parsePagination extracts page and per_page from query parameters.
-func parsePagination(r *http.Request) (page, perPage int) {
-	page = 1
-	perPage = DefaultPerPage
-
-	if v := r.URL.Query().Get("page"); v != "" {
-		if n, err := strconv.Atoi(v); err == nil && n >= 1 {
-			page = n
-		}
+// validateColumnRules checks the optional value rules of a column
+// definition against its type and against each other.
+func validateColumnRules(c collectionColumn) *collectionError {
+	r := c.FieldRules
+	bad := func(format string, args ...any) *collectionError {
+		return &collectionError{Status: http.StatusBadRequest, Message: fmt.Sprintf(format, args...)}
 	}
-	if v := r.URL.Query().Get("per_page"); v != "" {
-		if n, err := strconv.Atoi(v); err == nil && n >= 1 {
-			perPage = n
-			if perPage > MaxPerPage {
-				perPage = MaxPerPage
-			}
+	if (r.Min != nil || r.Max != nil) && c.Type != MoonFieldTypeInteger {
+		return bad("Rules min and max are only valid for integer columns")
+	}
+	if (r.MinLength != nil || r.MaxLength != nil || len(r.Enum) > 0) && c.Type != MoonFieldTypeString {
+		return bad("Rules min_length, max_length, and enum are only valid for string columns")
+	}
+	if r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+		return bad("Rule min must not be greater than max for column '%s'", c.Name)
+	}
+	if (r.MinLength != nil && *r.MinLength < 0) || (r.MaxLength != nil && *r.MaxLength < 0) {
+		return bad("Rules min_length and max_length must not be negative for column '%s'", c.Name)
+	}
+	if r.MinLength != nil && r.MaxLength != nil && *r.MinLength > *r.MaxLength {
+		return bad("Rule min_length must not be greater than max_length for column '%s'", c.Name)
+	}
+	if r.Enum != nil && len(r.Enum) == 0 {
+		return bad("Rule enum must not be empty for column '%s'", c.Name)
+	}
+	if len(r.Enum) > MaxEnumValues {
+		return bad("Rule enum must have at most %d values for column '%s'", MaxEnumValues, c.Name)
+	}
+	seen := make(map[string]bool, len(r.Enum))
+	for _, v := range r.Enum {
+		if seen[v] {
+			return bad("Duplicate enum value %q for column '%s'", v, c.Name)
+		}
+		seen[v] = true
+		if err := r.Check(c.Name, v); err != nil && (r.MinLength != nil || r.MaxLength != nil) {
+			return bad("Enum value %q does not satisfy the length rules for column '%s'", v, c.Name)
 		}
 	}
-	return page, perPage
+	return nil
 }
 
-// buildPaginationLinks builds the standard pagination links map.
-func buildPaginationLinks(basePath string, page, perPage, totalPages int) map[string]any {
-	linkURL := func(p int) string {
-		return fmt.Sprintf("%s?page=%d&per_page=%d", basePath, p, perPage)
+// validateColumnDecimal checks the optional precision and scale of a
+// column definition. Scale defaults to 0 and requires a precision.
+func validateColumnDecimal(c collectionColumn) *collectionError {
+	bad := func(format string, args ...any) *collectionError {
+		return &collectionError{Status: http.StatusBadRequest, Message: fmt.Sprintf(format, args...)}
+	}
+	if c.Precision == nil && c.Scale == nil {
+		return nil
+	}
+	if c.Type != MoonFieldTypeDecimal {
+		return bad("Precision and scale are only valid for decimal columns")
+	}
+	if c.Precision == nil {
+		return bad("Scale requires precision for column '%s'", c.Name)
+	}
+	if *c.Precision < 1 || *c.Precision > DecimalMaxPrecision {
+		return bad("Precision must be between 1 and %d for column '%s'", DecimalMaxPrecision, c.Name)
+	}
+	if maxScale := min(*c.Precision, DecimalMaxScale); intVal(c.Scale) < 0 || intVal(c.Scale) > maxScale {
+		return bad("Scale must be between 0 and %d for column '%s'", maxScale, c.Name)
 	}
+	return nil
+}
 
-	links := map[string]any{
-		"first": linkURL(1),
-		"last":  linkURL(totalPages),
+// addDecimalKeys adds the precision and scale of a decimal field to a
+// column descriptor. Precision 0 means none was declared.
+func addDecimalKeys(desc map[string]any, precision, scale int) {
+	if precision > 0 {
+		desc["precision"] = precision
+		desc["scale"] = scale
 	}
+}
 
-	if page > 1 {
-		links["prev"] = linkURL(page - 1)
-	} else {
-		links["prev"] = nil
+// addFieldRuleKeys adds the set rules of a field to a column descriptor.
+func addFieldRuleKeys(desc map[string]any, r FieldRules) {
+	if r.Min != nil {
+		desc["min"] = *r.Min
+	}
+	if r.Max != nil {
+		desc["max"] = *r.Max
+	}
+	if r.MinLength != nil {
+		desc["min_length"] = *r.MinLength
+	}
+	if r.MaxLength != nil {
+		desc["max_length"] = *r.MaxLength
 	}
+	if len(r.Enum) > 0 {
+		desc["enum"] = r.Enum
+	}
+}
 
-	if page < totalPages {
-		links["next"] = linkURL(page + 1)
-	} else {
-		links["next"] = nil
+// collationClause returns the SQLite COLLATE clause for a column collation.
+func collationClause(collation string) string {
+	if collation == CollationNocase {
+		return " COLLATE NOCASE"
+	}
+	return ""
+}
+
+// defaultValueForType is the Go value of defaultForType, used to check that
+// existing rows would satisfy the rules of a new NOT NULL column.
+func defaultValueForType(t string) any {
+	switch t {
+	case MoonFieldTypeInteger, MoonFieldTypeDecimal, MoonFieldTypeBoolean:
+		return int64(0)
+	default:
+		return ""
 	}
+}
+
+// intVal returns the value pointed to by p, or 0 if p is nil.
+func intVal(p *int) int {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
 
-	return links
+// boolVal returns the value pointed to by p, or the fallback if p is nil.
+func boolVal(p *bool, fallback bool) bool {
+	if p == nil {
+		return fallback
+	}
+	return *p
 }
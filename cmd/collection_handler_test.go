@@ -66,6 +66,18 @@ func setupCollectionTest(t *testing.T) (*SQLiteAdapter, *SchemaRegistry, *AppCon
 	)`); err != nil {
 		t.Fatalf("create apikeys: %v", err)
 	}
+	if err := adapter.ExecDDL(ctx, ddlTemplatesTable); err != nil {
+		t.Fatalf("create moon_templates: %v", err)
+	}
+	if err := adapter.ExecDDL(ctx, ddlValidatorsTable); err != nil {
+		t.Fatalf("create moon_validators: %v", err)
+	}
+	if err := adapter.ExecDDL(ctx, ddlCollectionAliasesTable); err != nil {
+		t.Fatalf("create moon_collection_aliases: %v", err)
+	}
+	if err := adapter.ExecDDL(ctx, ddlAttributesTable); err != nil {
+		t.Fatalf("create moon_attributes: %v", err)
+	}
 
 	registry, err := NewSchemaRegistry(adapter)
 	if err != nil {
@@ -505,6 +517,50 @@ func TestCollectionQuery_SystemField_GetOne_Dynamic(t *testing.T) {
 	}
 }
 
+// ---------------------------------------------------------------------------
+// POST /collections:refresh
+// ---------------------------------------------------------------------------
+
+func TestCollectionRefresh_ReportsOutOfBandChanges(t *testing.T) {
+	handler, adapter, registry := buildAuthenticatedCollectionHandler(t)
+
+	if err := adapter.ExecDDL(context.Background(), `CREATE TABLE orders (id TEXT PRIMARY KEY, total TEXT NOT NULL)`); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/collections:refresh", nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken(t, collectionTestSecret))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	resp := decodeResponse(t, w)
+	item := resp["data"].([]any)[0].(map[string]any)
+	added := item["added"].([]any)
+	if len(added) != 1 || added[0] != "orders" {
+		t.Fatalf("expected added=[orders], got %v", item["added"])
+	}
+	if _, ok := registry.Get("orders"); !ok {
+		t.Fatal("orders should be in the registry after refresh")
+	}
+}
+
+func TestCollectionRefresh_RequiresAdmin(t *testing.T) {
+	handler, _, _ := buildAuthenticatedCollectionHandler(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/collections:refresh", nil)
+	req.Header.Set("Authorization", "Bearer "+userToken(t, collectionTestSecret))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
 // ---------------------------------------------------------------------------
 // POST /collections:mutate — Authorization
 // ---------------------------------------------------------------------------
@@ -583,6 +639,216 @@ func TestCollectionMutate_Create_Success(t *testing.T) {
 	}
 }
 
+func TestCollectionMutate_Create_Timestamps(t *testing.T) {
+	handler, _, registry := buildAuthenticatedCollectionHandler(t)
+
+	body := `{"op":"create","data":[{"name":"notes","timestamps":true,"columns":[{"name":"body","type":"string"}]}]}`
+	req := httptest.NewRequest(http.MethodPost, "/collections:mutate", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+adminToken(t, collectionTestSecret))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	col, ok := registry.Get("notes")
+	if !ok {
+		t.Fatal("notes not in registry after create")
+	}
+	fields := buildFieldMap(col)
+	for _, name := range []string{"created_at", "updated_at"} {
+		f, ok := fields[name]
+		if !ok || f.Type != MoonFieldTypeDatetime || f.Nullable || !f.ReadOnly {
+			t.Errorf("expected read-only datetime %s, got %+v", name, f)
+		}
+	}
+
+	body = `{"op":"create","data":[{"name":"notes2","timestamps":true,"columns":[{"name":"created_at","type":"datetime"}]}]}`
+	req = httptest.NewRequest(http.MethodPost, "/collections:mutate", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+adminToken(t, collectionTestSecret))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for duplicate timestamp column, got %d", w.Code)
+	}
+}
+
+func TestCollectionMutate_Create_Versioned(t *testing.T) {
+	handler, _, registry := buildAuthenticatedCollectionHandler(t)
+
+	body := `{"op":"create","data":[{"name":"docs","versioned":true,"columns":[{"name":"title","type":"string"}]}]}`
+	req := httptest.NewRequest(http.MethodPost, "/collections:mutate", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+adminToken(t, collectionTestSecret))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	col, ok := registry.Get("docs")
+	if !ok {
+		t.Fatal("docs not in registry after create")
+	}
+	if f, ok := buildFieldMap(col)[FieldVersion]; !ok || !isVersionField(f) || !f.ReadOnly {
+		t.Errorf("expected read-only _version column, got %+v", f)
+	}
+}
+
+func TestCollectionMutate_Create_Owned(t *testing.T) {
+	handler, _, registry := buildAuthenticatedCollectionHandler(t)
+
+	body := `{"op":"create","data":[{"name":"tasks","owned":true,"columns":[{"name":"title","type":"string"}]}]}`
+	req := httptest.NewRequest(http.MethodPost, "/collections:mutate", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+adminToken(t, collectionTestSecret))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	col, ok := registry.Get("tasks")
+	if !ok {
+		t.Fatal("tasks not in registry after create")
+	}
+	if f, ok := buildFieldMap(col)[FieldOwnerID]; !ok || !isOwnerField(f) || !f.ReadOnly || !f.Nullable {
+		t.Errorf("expected read-only nullable owner_id column, got %+v", f)
+	}
+}
+
+func TestCollectionMutate_Create_NocaseCollation(t *testing.T) {
+	handler, db, registry := buildAuthenticatedCollectionHandler(t)
+
+	body := `{"op":"create","data":[{"name":"people","columns":[{"name":"email","type":"string","unique":true,"collation":"nocase"},{"name":"nickname","type":"string","nullable":true}]}]}`
+	req := httptest.NewRequest(http.MethodPost, "/collections:mutate", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+adminToken(t, collectionTestSecret))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	col, ok := registry.Get("people")
+	if !ok {
+		t.Fatal("people not in registry after create")
+	}
+	fields := buildFieldMap(col)
+	if fields["email"].Collation != CollationNocase {
+		t.Errorf("expected email collation %q, got %q", CollationNocase, fields["email"].Collation)
+	}
+	if fields["nickname"].Collation != "" {
+		t.Errorf("expected default collation for nickname, got %q", fields["nickname"].Collation)
+	}
+
+	ctx := context.Background()
+	if err := db.InsertRow(ctx, "people", map[string]any{"id": "P1", "email": "Ann@Example.com"}); err != nil {
+		t.Fatalf("InsertRow: %v", err)
+	}
+	if err := db.InsertRow(ctx, "people", map[string]any{"id": "P2", "email": "ann@example.com"}); err == nil {
+		t.Error("expected unique violation for case-only difference")
+	}
+	rows, _, err := db.QueryRows(ctx, "people", QueryOptions{
+		Filters: []Filter{{Field: "email", Op: "eq", Value: "ANN@EXAMPLE.COM"}},
+	})
+	if err != nil || len(rows) != 1 {
+		t.Fatalf("expected eq to match case-insensitively, got %d rows (err %v)", len(rows), err)
+	}
+}
+
+func TestCollectionMutate_ModifyColumns_KeepsCollation(t *testing.T) {
+	handler, _, registry := buildAuthenticatedCollectionHandler(t)
+
+	for _, body := range []string{
+		`{"op":"create","data":[{"name":"people","columns":[{"name":"email","type":"string","collation":"nocase"},{"name":"age","type":"integer"}]}]}`,
+		`{"op":"update","data":[{"name":"people","modify_columns":[{"name":"age","type":"integer","nullable":true}]}]}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/collections:mutate", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+adminToken(t, collectionTestSecret))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusCreated && w.Code != http.StatusOK {
+			t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	col, _ := registry.Get("people")
+	if got := buildFieldMap(col)["email"].Collation; got != CollationNocase {
+		t.Errorf("expected email to keep collation %q after rebuild, got %q", CollationNocase, got)
+	}
+}
+
+func TestCollectionMutate_Create_FieldRules(t *testing.T) {
+	handler, _, registry := buildAuthenticatedCollectionHandler(t)
+
+	body := `{"op":"create","data":[{"name":"tickets","columns":[{"name":"priority","type":"integer","min":1,"max":5},{"name":"state","type":"string","max_length":10,"enum":["open","closed"]}]}]}`
+	req := httptest.NewRequest(http.MethodPost, "/collections:mutate", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+adminToken(t, collectionTestSecret))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	cols := decodeResponse(t, w)["data"].([]any)[0].(map[string]any)["columns"].([]any)
+	if first := cols[0].(map[string]any); first["min"] != float64(1) || first["max"] != float64(5) {
+		t.Errorf("expected min and max in response, got %v", first)
+	}
+
+	col, _ := registry.Get("tickets")
+	fields := buildFieldMap(col)
+	if r := fields["priority"].Rules; r.Min == nil || *r.Min != 1 || r.Max == nil || *r.Max != 5 {
+		t.Errorf("unexpected priority rules: %+v", r)
+	}
+	if r := fields["state"].Rules; r.MaxLength == nil || *r.MaxLength != 10 || len(r.Enum) != 2 {
+		t.Errorf("unexpected state rules: %+v", r)
+	}
+}
+
+func TestCollectionMutate_Create_InvalidFieldRules(t *testing.T) {
+	handler, _, _ := buildAuthenticatedCollectionHandler(t)
+
+	for _, col := range []string{
+		`{"name":"title","type":"string","min":1}`,
+		`{"name":"total","type":"integer","enum":["1"]}`,
+		`{"name":"total","type":"integer","min":5,"max":1}`,
+		`{"name":"title","type":"string","min_length":-1}`,
+		`{"name":"title","type":"string","min_length":5,"max_length":2}`,
+		`{"name":"title","type":"string","enum":[]}`,
+		`{"name":"title","type":"string","enum":["a","a"]}`,
+		`{"name":"title","type":"string","max_length":3,"enum":["long"]}`,
+	} {
+		body := `{"op":"create","data":[{"name":"things","columns":[` + col + `]}]}`
+		req := httptest.NewRequest(http.MethodPost, "/collections:mutate", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+adminToken(t, collectionTestSecret))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d: %s", col, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestCollectionMutate_Create_InvalidCollation(t *testing.T) {
+	handler, _, _ := buildAuthenticatedCollectionHandler(t)
+
+	for _, col := range []string{
+		`{"name":"title","type":"string","collation":"utf8mb4_0900_ai_ci"}`,
+		`{"name":"total","type":"integer","collation":"nocase"}`,
+	} {
+		body := `{"op":"create","data":[{"name":"things","columns":[` + col + `]}]}`
+		req := httptest.NewRequest(http.MethodPost, "/collections:mutate", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+adminToken(t, collectionTestSecret))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d: %s", col, w.Code, w.Body.String())
+		}
+	}
+}
+
 func TestCollectionMutate_Create_SystemName_Forbidden(t *testing.T) {
 	handler, _, _ := buildAuthenticatedCollectionHandler(t)
 
@@ -1021,6 +1287,125 @@ func TestCollectionMutate_Update_ModifyColumns(t *testing.T) {
 	t.Fatal("price column not found")
 }
 
+func TestCollectionMutate_Update_ModifyColumns_BackfillsInBatches(t *testing.T) {
+	handler, adapter, registry := buildAuthenticatedCollectionHandler(t)
+
+	ctx := context.Background()
+	if err := adapter.ExecDDL(ctx, `CREATE TABLE products (id TEXT PRIMARY KEY, price TEXT NOT NULL)`); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	rowCount := ShadowTableBatchSize*2 + 7
+	seed := fmt.Sprintf(`WITH RECURSIVE seq(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM seq WHERE n < %d)
+		INSERT INTO products (id, price) SELECT printf('p%%06d', n), n || '.50' FROM seq`, rowCount)
+	if err := adapter.ExecDDL(ctx, seed); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	if err := registry.Refresh(); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	body := `{"op":"update","data":[{"name":"products","modify_columns":[{"name":"price","type":"decimal"}]}]}`
+	req := httptest.NewRequest(http.MethodPost, "/collections:mutate", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+adminToken(t, collectionTestSecret))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	count, err := adapter.CountRows(ctx, "products")
+	if err != nil {
+		t.Fatalf("CountRows: %v", err)
+	}
+	if count != rowCount {
+		t.Fatalf("expected %d rows after rebuild, got %d", rowCount, count)
+	}
+
+	tables, err := adapter.ListTables(ctx)
+	if err != nil {
+		t.Fatalf("ListTables: %v", err)
+	}
+	for _, tbl := range tables {
+		if strings.HasPrefix(tbl, ShadowTablePrefix) {
+			t.Fatalf("shadow table %q left behind", tbl)
+		}
+	}
+}
+
+func TestRecreateTable_KeepsWritesMadeDuringBackfill(t *testing.T) {
+	adapter, registry, _, _ := setupCollectionTest(t)
+	ctx := context.Background()
+	if err := adapter.ExecDDL(ctx, `CREATE TABLE products (id TEXT PRIMARY KEY, price TEXT NOT NULL)`); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	rowCount := ShadowTableBatchSize*2 + 7
+	seed := fmt.Sprintf(`WITH RECURSIVE seq(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM seq WHERE n < %d)
+		INSERT INTO products (id, price) SELECT printf('p%%06d', n), n || '.50' FROM seq`, rowCount)
+	if err := adapter.ExecDDL(ctx, seed); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	if err := registry.Refresh(); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	// Between batches, insert a row ahead of the copied range and one after
+	// it, change a copied row, and destroy another.
+	migrations := registry.Migrations()
+	batch := 0
+	migrations.batchDone = func() {
+		batch++
+		if batch != 1 {
+			return
+		}
+		for _, id := range []string{"a-early", "z-late"} {
+			if err := adapter.InsertRow(ctx, "products", map[string]any{"id": id, "price": "9.50"}); err != nil {
+				t.Fatalf("insert %s: %v", id, err)
+			}
+		}
+		if err := adapter.UpdateRow(ctx, "products", "p000001", map[string]any{"price": "7.25"}); err != nil {
+			t.Fatalf("update: %v", err)
+		}
+		if err := adapter.DeleteRow(ctx, "products", "p000002"); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+	}
+	col, _ := registry.Get("products")
+	shadow, createDDL := shadowTableFor("products", col, []collectionColumn{{Name: "price", Type: MoonFieldTypeDecimal}})
+	m, err := migrations.Run(ctx, shadow, createDDL)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if batch < 2 {
+		t.Fatalf("expected several batches, got %d", batch)
+	}
+	// a-early sorts before the copied range, so only the change log
+	// brings it over; z-late is copied by the last batch.
+	if m.State != ShadowMigrationDone || m.RowsTotal != rowCount || m.RowsCopied != rowCount+1 {
+		t.Errorf("migration = %+v, want done with %d of %d rows copied", m, rowCount+1, rowCount)
+	}
+
+	if count, _ := adapter.CountRows(ctx, "products"); count != rowCount+1 {
+		t.Fatalf("expected %d rows after rebuild, got %d", rowCount+1, count)
+	}
+	rows, _, err := adapter.QueryRows(ctx, "products", QueryOptions{
+		Filters: []Filter{{Field: "id", Op: "in", Value: []string{"a-early", "z-late", "p000001", "p000002"}}},
+		Sort:    []SortField{{Field: "id"}},
+	})
+	if err != nil {
+		t.Fatalf("QueryRows: %v", err)
+	}
+	got := make(map[string]string)
+	for _, row := range rows {
+		got[stringVal(row, "id")] = fmt.Sprint(row["price"])
+	}
+	want := map[string]string{"a-early": "9.5", "z-late": "9.5", "p000001": "7.25"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("rows = %v, want %v", got, want)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // POST /collections:mutate — op=update — mixed sub-ops
 // ---------------------------------------------------------------------------
@@ -1255,56 +1640,6 @@ func TestBoolVal(t *testing.T) {
 	}
 }
 
-func TestParsePagination(t *testing.T) {
-	tests := []struct {
-		url     string
-		page    int
-		perPage int
-	}{
-		{"/test", 1, DefaultPerPage},
-		{"/test?page=2", 2, DefaultPerPage},
-		{"/test?per_page=50", 1, 50},
-		{"/test?page=3&per_page=10", 3, 10},
-		{"/test?page=0", 1, DefaultPerPage},
-		{"/test?per_page=999", 1, MaxPerPage},
-		{"/test?page=abc", 1, DefaultPerPage},
-	}
-	for _, tt := range tests {
-		r := httptest.NewRequest(http.MethodGet, tt.url, nil)
-		page, perPage := parsePagination(r)
-		if page != tt.page {
-			t.Fatalf("url=%q: page=%d, want %d", tt.url, page, tt.page)
-		}
-		if perPage != tt.perPage {
-			t.Fatalf("url=%q: perPage=%d, want %d", tt.url, perPage, tt.perPage)
-		}
-	}
-}
-
-func TestBuildPaginationLinks(t *testing.T) {
-	links := buildPaginationLinks("/collections:query", 1, 15, 3)
-	if links["first"] != "/collections:query?page=1&per_page=15" {
-		t.Fatalf("unexpected first: %v", links["first"])
-	}
-	if links["last"] != "/collections:query?page=3&per_page=15" {
-		t.Fatalf("unexpected last: %v", links["last"])
-	}
-	if links["prev"] != nil {
-		t.Fatalf("expected prev=nil, got %v", links["prev"])
-	}
-	if links["next"] != "/collections:query?page=2&per_page=15" {
-		t.Fatalf("unexpected next: %v", links["next"])
-	}
-
-	links2 := buildPaginationLinks("/collections:query", 3, 15, 3)
-	if links2["prev"] != "/collections:query?page=2&per_page=15" {
-		t.Fatalf("unexpected prev: %v", links2["prev"])
-	}
-	if links2["next"] != nil {
-		t.Fatalf("expected next=nil, got %v", links2["next"])
-	}
-}
-
 // ---------------------------------------------------------------------------
 // Integration: Create then query
 // ---------------------------------------------------------------------------
@@ -1937,3 +2272,97 @@ func TestCollectionMutate_Create_ReservedName_Users(t *testing.T) {
 		t.Fatalf("expected 403, got %d: %s", w.Code, w.Body.String())
 	}
 }
+
+// ---------------------------------------------------------------------------
+// POST /collections:rename
+// ---------------------------------------------------------------------------
+
+func TestCollectionRename(t *testing.T) {
+	adapter, registry, cfg, logger := setupCollectionTest(t)
+	cfg.JWTSecret = collectionTestSecret
+	ctx := context.Background()
+	if err := adapter.InsertRow(ctx, "users", map[string]any{
+		"id": "admin-001", "username": "admin", "email": "admin@test.com",
+		"password_hash": "hash", "role": "admin",
+		"created_at": "2024-01-01T00:00:00Z", "updated_at": "2024-01-01T00:00:00Z",
+	}); err != nil {
+		t.Fatalf("insert admin: %v", err)
+	}
+	if err := adapter.ExecDDL(ctx, `CREATE TABLE products (id TEXT PRIMARY KEY, title TEXT NOT NULL)`); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := adapter.InsertRow(ctx, "products", map[string]any{"id": "p1", "title": "Widget"}); err != nil {
+		t.Fatalf("insert product: %v", err)
+	}
+	if err := adapter.InsertRow(ctx, "apikeys", map[string]any{
+		"id": "key-001", "name": "shop", "key_hash": "x", "collections": `["products","orders"]`,
+		"created_at": "2024-01-01T00:00:00Z", "updated_at": "2024-01-01T00:00:00Z",
+	}); err != nil {
+		t.Fatalf("insert key: %v", err)
+	}
+	if err := registry.Refresh(); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	am := NewAuthMiddleware(adapter, cfg.JWTSecret, cfg.Server.Prefix, NewJTIRevocationStore())
+	mux := NewRouter(cfg.Server.Prefix, logger, adapter, cfg, registry)
+	handler := BuildHandler(mux, cfg, logger, WithAuthMiddleware(am), WithCollectionAliases(adapter, registry))
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+adminToken(t, collectionTestSecret))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	for body, want := range map[string]int{
+		`{"data":[{"name":"missing","new_name":"catalog"}]}`:                  http.StatusNotFound,
+		`{"data":[{"name":"products","new_name":"users"}]}`:                   http.StatusBadRequest,
+		`{"data":[{"name":"users","new_name":"people"}]}`:                     http.StatusForbidden,
+		`{"data":[{"name":"products","new_name":"catalog","alias_days":91}]}`: http.StatusBadRequest,
+	} {
+		if w := do(http.MethodPost, "/collections:rename", body); w.Code != want {
+			t.Errorf("%s: expected %d, got %d", body, want, w.Code)
+		}
+	}
+
+	w := do(http.MethodPost, "/collections:rename", `{"data":[{"name":"products","new_name":"catalog","alias_days":30}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	result := decodeResponse(t, w)["data"].([]any)[0].(map[string]any)
+	if result["name"] != "catalog" || result["old_name"] != "products" || result["alias_expires_at"] == nil {
+		t.Fatalf("unexpected result: %v", result)
+	}
+	if _, ok := registry.Get("products"); ok {
+		t.Fatal("products should be gone from the registry")
+	}
+
+	w = do(http.MethodGet, "/data/catalog:query?id=p1", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected rows to be preserved, got %d: %s", w.Code, w.Body.String())
+	}
+	w = do(http.MethodGet, "/data/products:query?id=p1", "")
+	if w.Code != http.StatusPermanentRedirect || w.Header().Get("Location") != "/data/catalog:query?id=p1" {
+		t.Fatalf("expected 308 to the new name, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+
+	rows, _, err := adapter.QueryRows(ctx, "apikeys", QueryOptions{Page: 1, PerPage: 1})
+	if err != nil {
+		t.Fatalf("query apikeys: %v", err)
+	}
+	if collections, _ := parseCollections(rows[0]["collections"]); strings.Join(collections, ",") != "catalog,orders" {
+		t.Errorf("expected API key collections to follow the rename, got %v", collections)
+	}
+
+	// Renaming back drops the alias, since the real collection owns the name.
+	if w := do(http.MethodPost, "/collections:rename", `{"data":[{"name":"catalog","new_name":"products"}]}`); w.Code != http.StatusOK {
+		t.Fatalf("rename back: %d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodGet, "/data/products:query?id=p1", ""); w.Code != http.StatusOK {
+		t.Fatalf("expected the real collection to win over the alias, got %d", w.Code)
+	}
+	if target, _ := lookupCollectionAlias(ctx, adapter, "products"); target != "" {
+		t.Errorf("expected the alias to be removed, got %q", target)
+	}
+}
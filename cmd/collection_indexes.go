@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ---------------------------------------------------------------------------
+// GET|POST /collections:indexes
+// ---------------------------------------------------------------------------
+
+// collectionIndexesRequest is the JSON body for POST /collections:indexes.
+type collectionIndexesRequest struct {
+	Op   string                `json:"op"`
+	Data []collectionIndexItem `json:"data"`
+}
+
+// collectionIndexItem names one index. Columns and Unique are used only by
+// op=create.
+type collectionIndexItem struct {
+	Collection string   `json:"collection"`
+	Name       string   `json:"name"`
+	Columns    []string `json:"columns,omitempty"`
+	Unique     bool     `json:"unique,omitempty"`
+}
+
+// HandleIndexes lists the indexes of the collection named by ?name=.
+func (h *CollectionHandler) HandleIndexes(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		WriteError(w, http.StatusBadRequest, "Missing required parameter: name")
+		return
+	}
+	if strings.HasPrefix(name, "moon_") {
+		WriteError(w, http.StatusBadRequest, "Collection name is reserved")
+		return
+	}
+	if !isCollectionVisibleToIdentity(r.Context(), name) {
+		WriteError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+	col, ok := h.registry.Get(name)
+	if !ok {
+		WriteError(w, http.StatusNotFound, fmt.Sprintf("Collection '%s' not found", name))
+		return
+	}
+
+	data := make([]any, 0, len(col.Indexes))
+	for _, idx := range indexDescriptors(col.Indexes) {
+		data = append(data, idx)
+	}
+	meta := map[string]any{"total": len(data)}
+	WriteSuccessFull(w, http.StatusOK, "Indexes retrieved successfully", data, meta, nil)
+}
+
+// HandleIndexesMutate creates or drops indexes. Every item is validated
+// before any DDL runs.
+func (h *CollectionHandler) HandleIndexesMutate(w http.ResponseWriter, r *http.Request) {
+	identity, ok := GetAuthIdentity(r.Context())
+	if !ok || !identity.ManagesCollections() {
+		WriteError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	var req collectionIndexesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Op != "create" && req.Op != "destroy" {
+		WriteError(w, http.StatusBadRequest, "Invalid operation")
+		return
+	}
+	if len(req.Data) == 0 {
+		WriteError(w, http.StatusBadRequest, "Data must not be empty")
+		return
+	}
+	for _, item := range req.Data {
+		if err := h.validateIndexItem(req.Op, item); err != nil {
+			writeCollectionError(w, err)
+			return
+		}
+	}
+
+	if req.Op == "create" {
+		h.createIndexes(w, req.Data)
+		return
+	}
+	h.dropIndexes(w, req.Data)
+}
+
+func (h *CollectionHandler) createIndexes(w http.ResponseWriter, items []collectionIndexItem) {
+	ctx := context.Background()
+	results := make([]any, 0, len(items))
+	for _, item := range items {
+		idx := IndexInfo{Name: item.Name, Columns: item.Columns, Unique: item.Unique}
+		if err := h.db.CreateIndex(ctx, item.Collection, idx); err != nil {
+			// Indexes created before the failure stay in place.
+			h.refreshIndexes(len(results))
+			switch {
+			case isUniqueViolation(err):
+				WriteError(w, http.StatusConflict, fmt.Sprintf("Cannot create unique index '%s': existing values are not unique", item.Name))
+			case isAlreadyExists(err):
+				WriteError(w, http.StatusConflict, fmt.Sprintf("Name '%s' is already in use", item.Name))
+			default:
+				WriteError(w, http.StatusInternalServerError, "Internal server error")
+			}
+			return
+		}
+		results = append(results, map[string]any{
+			"collection": item.Collection,
+			"name":       idx.Name,
+			"columns":    idx.Columns,
+			"unique":     idx.Unique,
+		})
+	}
+	if err := h.refreshIndexes(len(results)); err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	meta := map[string]any{"success": len(results), "failed": 0}
+	WriteSuccessFull(w, http.StatusCreated, "Indexes created successfully", results, meta, nil)
+}
+
+func (h *CollectionHandler) dropIndexes(w http.ResponseWriter, items []collectionIndexItem) {
+	ctx := context.Background()
+	results := make([]any, 0, len(items))
+	failed := 0
+	for _, item := range items {
+		col, _ := h.registry.Get(item.Collection)
+		if findIndex(col, item.Name) == nil {
+			failed++
+			continue
+		}
+		if err := h.db.DropIndex(ctx, item.Collection, item.Name); err != nil {
+			h.refreshIndexes(len(results))
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		results = append(results, map[string]any{"collection": item.Collection, "name": item.Name})
+	}
+	if err := h.refreshIndexes(len(results)); err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	meta := map[string]any{"success": len(results), "failed": failed}
+	WriteSuccessFull(w, http.StatusOK, "Indexes destroyed successfully", results, meta, nil)
+}
+
+// refreshIndexes reloads the registry after applied index changes so
+// :schema reports them, and announces the change to other instances.
+// Nothing is done when no change was applied.
+func (h *CollectionHandler) refreshIndexes(applied int) error {
+	if applied == 0 {
+		return nil
+	}
+	if err := h.registry.Refresh(); err != nil {
+		return err
+	}
+	h.publishSchemaVersion()
+	return nil
+}
+
+func (h *CollectionHandler) validateIndexItem(op string, item collectionIndexItem) *collectionError {
+	if item.Collection == "" || item.Name == "" {
+		return &collectionError{Status: http.StatusBadRequest, Message: "Index collection and name are required"}
+	}
+	if strings.HasPrefix(item.Collection, "moon_") {
+		return &collectionError{Status: http.StatusBadRequest, Message: "Collection name is reserved"}
+	}
+	if item.Collection == "users" || item.Collection == "apikeys" {
+		return &collectionError{Status: http.StatusForbidden, Message: "Forbidden"}
+	}
+	col, exists := h.registry.Get(item.Collection)
+	if !exists {
+		return &collectionError{Status: http.StatusNotFound, Message: fmt.Sprintf("Collection '%s' not found", item.Collection)}
+	}
+	if err := h.migrationConflict(item.Collection); err != nil {
+		return err
+	}
+	if op == "destroy" {
+		if len(item.Columns) > 0 || item.Unique {
+			return &collectionError{Status: http.StatusBadRequest, Message: "op=destroy takes only collection and name"}
+		}
+		return nil
+	}
+
+	if !namePattern.MatchString(item.Name) || len(item.Name) > MaxCollectionNameLen ||
+		strings.HasPrefix(item.Name, "moon_") || strings.HasPrefix(item.Name, "sqlite_") {
+		return &collectionError{Status: http.StatusBadRequest, Message: fmt.Sprintf("Invalid index name %q: must be lowercase snake_case and must not start with moon_ or sqlite_", item.Name)}
+	}
+	if findIndex(col, item.Name) != nil {
+		return &collectionError{Status: http.StatusConflict, Message: fmt.Sprintf("Index '%s' already exists", item.Name)}
+	}
+	if _, taken := h.registry.Get(item.Name); taken {
+		return &collectionError{Status: http.StatusConflict, Message: fmt.Sprintf("Name '%s' is already in use", item.Name)}
+	}
+	if len(item.Columns) == 0 || len(item.Columns) > MaxIndexColumns {
+		return &collectionError{Status: http.StatusBadRequest, Message: fmt.Sprintf("Index columns must list 1 to %d columns", MaxIndexColumns)}
+	}
+	fieldMap := buildFieldMap(col)
+	seen := make(map[string]bool, len(item.Columns))
+	for _, c := range item.Columns {
+		if _, ok := fieldMap[c]; !ok {
+			return &collectionError{Status: http.StatusBadRequest, Message: fmt.Sprintf("Column '%s' does not exist", c)}
+		}
+		if seen[c] {
+			return &collectionError{Status: http.StatusBadRequest, Message: fmt.Sprintf("Column '%s' is listed more than once", c)}
+		}
+		seen[c] = true
+	}
+	return nil
+}
+
+// findIndex returns the index of col with the given name, or nil.
+func findIndex(col *Collection, name string) *IndexInfo {
+	for i := range col.Indexes {
+		if col.Indexes[i].Name == name {
+			return &col.Indexes[i]
+		}
+	}
+	return nil
+}
+
+// indexesUsingColumn returns the names of the indexes of col that include
+// column.
+func indexesUsingColumn(col *Collection, column string) []string {
+	var names []string
+	for _, idx := range col.Indexes {
+		if stringInSlice(column, idx.Columns) {
+			names = append(names, idx.Name)
+		}
+	}
+	return names
+}
+
+// isAlreadyExists reports whether err is a database error for a name that
+// is already taken by another index or table.
+func isAlreadyExists(err error) bool {
+	for _, msg := range errorMessages(err) {
+		if strings.Contains(msg, "already exists") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// setupIndexTest returns a CollectionHandler over a products collection
+// holding two rows that share a category.
+func setupIndexTest(t *testing.T) (*CollectionHandler, *SQLiteAdapter, *SchemaRegistry) {
+	t.Helper()
+	adapter, registry, cfg, _ := setupCollectionTest(t)
+	ctx := context.Background()
+	if err := adapter.ExecDDL(ctx, `CREATE TABLE products (id TEXT PRIMARY KEY, title TEXT NOT NULL, category TEXT NOT NULL, price NUMERIC NOT NULL)`); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	for _, row := range []map[string]any{
+		{"id": "p1", "title": "Widget", "category": "tools", "price": "1.00"},
+		{"id": "p2", "title": "Gadget", "category": "tools", "price": "2.00"},
+	} {
+		if err := adapter.InsertRow(ctx, "products", row); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+	}
+	if err := registry.Refresh(); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	return NewCollectionHandler(adapter, registry, cfg), adapter, registry
+}
+
+func doIndexRequest(h *CollectionHandler, method, target, body string, identity *AuthIdentity) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req = req.WithContext(SetAuthIdentity(context.Background(), identity))
+	w := httptest.NewRecorder()
+	switch {
+	case method == http.MethodGet:
+		h.HandleIndexes(w, req)
+	case strings.HasSuffix(target, ":mutate"):
+		h.HandleMutate(w, req)
+	default:
+		h.HandleIndexesMutate(w, req)
+	}
+	return w
+}
+
+func TestCollectionIndexes_Lifecycle(t *testing.T) {
+	h, _, registry := setupIndexTest(t)
+	admin := adminIdentity()
+
+	create := `{"op":"create","data":[
+		{"collection":"products","name":"products_category_price","columns":["category","price"]},
+		{"collection":"products","name":"products_title","columns":["title"],"unique":true}]}`
+	w := doIndexRequest(h, http.MethodPost, "/collections:indexes", create, admin)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := doIndexRequest(h, http.MethodPost, "/collections:indexes", create, admin); w.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for an existing index, got %d", w.Code)
+	}
+
+	w = doIndexRequest(h, http.MethodGet, "/collections:indexes?name=products", "", userWriteIdentity())
+	data := decodeResponse(t, w)["data"].([]any)
+	if len(data) != 2 {
+		t.Fatalf("expected 2 indexes, got %v", data)
+	}
+	first := data[0].(map[string]any)
+	if first["name"] != "products_category_price" || first["unique"] != false || len(first["columns"].([]any)) != 2 {
+		t.Errorf("unexpected index: %v", first)
+	}
+
+	sh := NewResourceSchemaHandler(registry, "")
+	sw := httptest.NewRecorder()
+	sh.HandleSchema(sw, httptest.NewRequest(http.MethodGet, "/data/products:schema", nil))
+	schema := decodeResponse(t, sw)["data"].([]any)[0].(map[string]any)
+	if indexes := schema["indexes"].([]any); len(indexes) != 2 {
+		t.Errorf("expected :schema to report 2 indexes, got %v", indexes)
+	}
+
+	// A column rebuild drops and recreates the table; its indexes must survive.
+	modify := `{"op":"update","data":[{"name":"products","modify_columns":[{"name":"price","type":"decimal","nullable":true}]}]}`
+	if w := doIndexRequest(h, http.MethodPost, "/collections:mutate", modify, admin); w.Code != http.StatusOK {
+		t.Fatalf("modify: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if col, _ := registry.Get("products"); len(col.Indexes) != 2 {
+		t.Fatalf("expected indexes to survive the rebuild, got %v", col.Indexes)
+	}
+
+	remove := `{"op":"update","data":[{"name":"products","remove_columns":["category"]}]}`
+	if w := doIndexRequest(h, http.MethodPost, "/collections:mutate", remove, admin); w.Code != http.StatusConflict {
+		t.Fatalf("expected 409 when removing an indexed column, got %d", w.Code)
+	}
+
+	destroy := `{"op":"destroy","data":[{"collection":"products","name":"products_category_price"},{"collection":"products","name":"missing"}]}`
+	w = doIndexRequest(h, http.MethodPost, "/collections:indexes", destroy, admin)
+	if meta := decodeResponse(t, w)["meta"].(map[string]any); meta["success"] != float64(1) || meta["failed"] != float64(1) {
+		t.Fatalf("unexpected destroy meta: %v", meta)
+	}
+	if w := doIndexRequest(h, http.MethodPost, "/collections:mutate", remove, admin); w.Code != http.StatusOK {
+		t.Fatalf("expected remove to succeed once the index is dropped, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestCollectionIndexes_Validation(t *testing.T) {
+	h, _, _ := setupIndexTest(t)
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"bad op", `{"op":"rebuild","data":[{"collection":"products","name":"a","columns":["title"]}]}`, http.StatusBadRequest},
+		{"empty data", `{"op":"create","data":[]}`, http.StatusBadRequest},
+		{"missing collection", `{"op":"create","data":[{"collection":"orders","name":"a","columns":["title"]}]}`, http.StatusNotFound},
+		{"system collection", `{"op":"create","data":[{"collection":"users","name":"a","columns":["email"]}]}`, http.StatusForbidden},
+		{"reserved name", `{"op":"create","data":[{"collection":"products","name":"sqlite_a","columns":["title"]}]}`, http.StatusBadRequest},
+		{"name of a collection", `{"op":"create","data":[{"collection":"products","name":"products","columns":["title"]}]}`, http.StatusConflict},
+		{"no columns", `{"op":"create","data":[{"collection":"products","name":"a"}]}`, http.StatusBadRequest},
+		{"unknown column", `{"op":"create","data":[{"collection":"products","name":"a","columns":["color"]}]}`, http.StatusBadRequest},
+		{"repeated column", `{"op":"create","data":[{"collection":"products","name":"a","columns":["title","title"]}]}`, http.StatusBadRequest},
+		{"unique over duplicates", `{"op":"create","data":[{"collection":"products","name":"a","columns":["category"],"unique":true}]}`, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doIndexRequest(h, http.MethodPost, "/collections:indexes", tt.body, adminIdentity())
+			if w.Code != tt.want {
+				t.Fatalf("expected %d, got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	if w := doIndexRequest(h, http.MethodPost, "/collections:indexes", `{"op":"create","data":[{"collection":"products","name":"a","columns":["title"]}]}`, userWriteIdentity()); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a non-admin, got %d", w.Code)
+	}
+	if w := doIndexRequest(h, http.MethodGet, "/collections:indexes", "", adminIdentity()); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without name, got %d", w.Code)
+	}
+}
+
+func TestIndexSQL(t *testing.T) {
+	idx := IndexInfo{Name: "by_sku", Columns: []string{"sku", "region"}, Unique: true}
+	tests := []struct {
+		dialect, create, drop string
+	}{
+		{DBConnectionSQLite, `CREATE UNIQUE INDEX "by_sku" ON "products" ("sku", "region")`, `DROP INDEX "by_sku"`},
+		{DBConnectionPostgres, `CREATE UNIQUE INDEX "by_sku" ON "products" ("sku", "region")`, `DROP INDEX "by_sku"`},
+		{DBConnectionMySQL, "CREATE UNIQUE INDEX `by_sku` ON `products` (`sku`, `region`)", "DROP INDEX `by_sku` ON `products`"},
+	}
+	for _, tt := range tests {
+		if got := createIndexSQL(tt.dialect, "products", idx); got != tt.create {
+			t.Errorf("%s create: got %s", tt.dialect, got)
+		}
+		if got := dropIndexSQL(tt.dialect, "products", "by_sku"); got != tt.drop {
+			t.Errorf("%s drop: got %s", tt.dialect, got)
+		}
+	}
+	if got := createIndexSQL(DBConnectionSQLite, "products", IndexInfo{Name: "i", Columns: []string{"a"}}); got != `CREATE INDEX "i" ON "products" ("a")` {
+		t.Errorf("non-unique create: got %s", got)
+	}
+}
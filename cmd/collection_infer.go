@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ---------------------------------------------------------------------------
+// POST /collections:infer
+// ---------------------------------------------------------------------------
+
+// collectionInferRequest is the JSON body for POST /collections:infer.
+type collectionInferRequest struct {
+	Name string            `json:"name"`
+	Data []json.RawMessage `json:"data"`
+}
+
+// inferredColumn is a proposed column. It has the shape :create accepts.
+type inferredColumn struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Nullable bool   `json:"nullable"`
+	Unique   bool   `json:"unique"`
+}
+
+// inferredCollection is the proposed definition. Without indexes and
+// notes it is a valid op=create item; indexes are op=create items for
+// /collections:indexes.
+type inferredCollection struct {
+	Name       string                `json:"name"`
+	Columns    []inferredColumn      `json:"columns"`
+	Timestamps bool                  `json:"timestamps,omitempty"`
+	Indexes    []collectionIndexItem `json:"indexes"`
+	Notes      []string              `json:"notes"`
+}
+
+// inferredField accumulates what the samples show about one key.
+type inferredField struct {
+	key      string
+	types    []string // distinct value types, in the order first seen
+	present  int      // samples with a non-null value
+	distinct map[string]bool
+	maxLen   int
+}
+
+func (f *inferredField) addType(t string) {
+	for _, seen := range f.types {
+		if seen == t {
+			return
+		}
+	}
+	f.types = append(f.types, t)
+}
+
+// HandleInfer proposes a collection definition from sample records. It
+// reads the samples only; nothing is created.
+func (h *CollectionHandler) HandleInfer(w http.ResponseWriter, r *http.Request) {
+	identity, ok := GetAuthIdentity(r.Context())
+	if !ok || !identity.ManagesCollections() {
+		WriteError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, MaxInferBodyBytes)
+	var req collectionInferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Name == "" {
+		WriteError(w, http.StatusBadRequest, "Collection name is required")
+		return
+	}
+	if len(req.Data) == 0 {
+		WriteError(w, http.StatusBadRequest, "Data must not be empty")
+		return
+	}
+	if len(req.Data) > MaxInferSamples {
+		WriteError(w, http.StatusBadRequest, fmt.Sprintf("At most %d samples are allowed", MaxInferSamples))
+		return
+	}
+
+	var fields []*inferredField
+	byKey := make(map[string]*inferredField)
+	for i, raw := range req.Data {
+		sample, err := decodeOrderedObject(raw)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, fmt.Sprintf("Sample %d must be a JSON object", i+1))
+			return
+		}
+		for _, kv := range sample {
+			f, ok := byKey[kv.key]
+			if !ok {
+				f = &inferredField{key: kv.key, distinct: make(map[string]bool)}
+				byKey[kv.key] = f
+				fields = append(fields, f)
+			}
+			if kv.value == nil {
+				continue
+			}
+			f.present++
+			f.addType(inferValueType(kv.value))
+			if s, ok := kv.value.(string); ok && len(s) > f.maxLen {
+				f.maxLen = len(s)
+			}
+			if len(f.distinct) <= len(req.Data) {
+				f.distinct[fmt.Sprint(kv.value)] = true
+			}
+		}
+	}
+
+	proposal := inferCollection(req.Name, fields, len(req.Data))
+	item := collectionCreateItem{Name: proposal.Name, Timestamps: proposal.Timestamps}
+	for _, c := range proposal.Columns {
+		item.Columns = append(item.Columns, collectionColumn{Name: c.Name, Type: c.Type, Nullable: &c.Nullable, Unique: &c.Unique})
+	}
+	if len(item.Columns) == 0 {
+		WriteError(w, http.StatusBadRequest, "Samples contain no usable fields")
+		return
+	}
+	if item.Timestamps {
+		item.Columns = append(item.Columns,
+			collectionColumn{Name: FieldCreatedAt, Type: MoonFieldTypeDatetime},
+			collectionColumn{Name: FieldUpdatedAt, Type: MoonFieldTypeDatetime},
+		)
+	}
+	if err := h.validateCreateItem(item); err != nil {
+		writeCollectionError(w, err)
+		return
+	}
+
+	meta := map[string]any{"samples": len(req.Data)}
+	WriteSuccessFull(w, http.StatusOK, "Collection definition inferred successfully", []any{proposal}, meta, nil)
+}
+
+// inferCollection turns the accumulated fields into a proposal for a
+// collection named name, built from n samples.
+func inferCollection(name string, fields []*inferredField, n int) inferredCollection {
+	out := inferredCollection{Name: name, Columns: []inferredColumn{}, Indexes: []collectionIndexItem{}, Notes: []string{}}
+	note := func(format string, args ...any) { out.Notes = append(out.Notes, fmt.Sprintf(format, args...)) }
+
+	created, updated := byKeyType(fields, FieldCreatedAt), byKeyType(fields, FieldUpdatedAt)
+	out.Timestamps = created == MoonFieldTypeDatetime && updated == MoonFieldTypeDatetime
+	if out.Timestamps {
+		note("Fields '%s' and '%s' are proposed as timestamps: true", FieldCreatedAt, FieldUpdatedAt)
+	}
+
+	taken := make(map[string]bool)
+	for _, f := range fields {
+		if f.key == "id" {
+			note("Field 'id' is managed by the server and is left out")
+			continue
+		}
+		if out.Timestamps && (f.key == FieldCreatedAt || f.key == FieldUpdatedAt) {
+			continue
+		}
+		column, ok := inferFieldName(f.key)
+		if !ok {
+			note("Field %q has no valid column name and is left out", f.key)
+			continue
+		}
+		if taken[column] {
+			note("Field %q would also be column '%s' and is left out", f.key, column)
+			continue
+		}
+		taken[column] = true
+		if column != f.key {
+			note("Field %q is proposed as column '%s'", f.key, column)
+		}
+
+		c := inferredColumn{Name: column, Type: mergeInferredTypes(f.types), Nullable: f.present < n}
+		switch {
+		case len(f.types) == 0:
+			note("Column '%s' is null in every sample and is proposed as string", column)
+		case len(f.types) > 1 && c.Type == MoonFieldTypeString && !onlyStringTypes(f.types):
+			note("Column '%s' mixes %s values and is proposed as string", column, strings.Join(f.types, " and "))
+		}
+
+		// Unique and category indexes need enough values to mean anything.
+		enough := f.present >= InferMinSamples
+		if enough && !c.Nullable && len(f.distinct) == n && f.maxLen <= InferMaxUniqueLength &&
+			(c.Type == MoonFieldTypeString || c.Type == MoonFieldTypeInteger) {
+			c.Unique = true
+		}
+		out.Columns = append(out.Columns, c)
+
+		var reason string
+		switch {
+		case c.Unique:
+		case strings.HasSuffix(column, "_id"):
+			reason = "looks like a reference"
+		case c.Type == MoonFieldTypeDatetime:
+			reason = "is a datetime, often filtered or sorted by range"
+		case enough && c.Type == MoonFieldTypeString && len(f.distinct) > 1 && len(f.distinct)*2 <= f.present:
+			reason = "has few distinct values, like a category"
+		}
+		if indexName := name + "_" + column; reason != "" && len(indexName) <= MaxCollectionNameLen {
+			out.Indexes = append(out.Indexes, collectionIndexItem{Collection: name, Name: indexName, Columns: []string{column}})
+			note("Column '%s' %s; an index is suggested", column, reason)
+		}
+	}
+	return out
+}
+
+// byKeyType returns the type inferred for key, or "" if no field has
+// that key.
+func byKeyType(fields []*inferredField, key string) string {
+	for _, f := range fields {
+		if f.key == key {
+			return mergeInferredTypes(f.types)
+		}
+	}
+	return ""
+}
+
+// inferValueType returns the Moon type of a sample value decoded with
+// UseNumber. Strings are datetime when they parse as RFC3339; numeric
+// strings stay strings, since codes and zip codes often look like numbers.
+func inferValueType(v any) string {
+	switch v := v.(type) {
+	case bool:
+		return MoonFieldTypeBoolean
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return MoonFieldTypeInteger
+		}
+		return MoonFieldTypeDecimal
+	case string:
+		if _, err := time.Parse(time.RFC3339, v); err == nil {
+			return MoonFieldTypeDatetime
+		}
+		return MoonFieldTypeString
+	default:
+		return MoonFieldTypeJSON
+	}
+}
+
+// mergeInferredTypes returns the one type that fits every type seen.
+// Integers widen to decimal and datetimes to string; any other mix falls
+// back to string.
+func mergeInferredTypes(types []string) string {
+	switch len(types) {
+	case 0:
+		return MoonFieldTypeString
+	case 1:
+		return types[0]
+	}
+	numeric := true
+	for _, t := range types {
+		if t != MoonFieldTypeInteger && t != MoonFieldTypeDecimal {
+			numeric = false
+		}
+	}
+	if numeric {
+		return MoonFieldTypeDecimal
+	}
+	return MoonFieldTypeString
+}
+
+// onlyStringTypes reports whether types are all string or datetime, whose
+// mix is expected and needs no note.
+func onlyStringTypes(types []string) bool {
+	for _, t := range types {
+		if t != MoonFieldTypeString && t != MoonFieldTypeDatetime {
+			return false
+		}
+	}
+	return true
+}
+
+// inferFieldName returns a valid column name for a sample key: the key
+// itself, its snake_case form, or that form with a _value suffix when it
+// is a reserved word.
+func inferFieldName(key string) (string, bool) {
+	snake := toSnakeCase(key)
+	for _, c := range []string{key, snake, snake + "_value"} {
+		if IsValidFieldName(c) {
+			return c, true
+		}
+	}
+	return "", false
+}
+
+// orderedValue is one key of a JSON object with its decoded value.
+type orderedValue struct {
+	key   string
+	value any
+}
+
+// decodeOrderedObject decodes a JSON object keeping its keys in document
+// order, so proposed columns follow the samples. Numbers are json.Number.
+func decodeOrderedObject(raw json.RawMessage) ([]orderedValue, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, fmt.Errorf("not an object")
+	}
+	var out []orderedValue
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var v any
+		if err := dec.Decode(&v); err != nil {
+			return nil, err
+		}
+		out = append(out, orderedValue{key: tok.(string), value: v})
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("trailing data")
+	}
+	return out, nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func doInferRequest(h *CollectionHandler, body string, identity *AuthIdentity) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/collections:infer", strings.NewReader(body))
+	req = req.WithContext(SetAuthIdentity(context.Background(), identity))
+	w := httptest.NewRecorder()
+	h.HandleInfer(w, req)
+	return w
+}
+
+// inferSamples returns n order records as a JSON array.
+func inferSamples(n int) string {
+	var rows []string
+	for i := range n {
+		note := `null`
+		if i%2 == 0 {
+			note = `"fragile"`
+		}
+		rows = append(rows, fmt.Sprintf(`{"id":%d,"sku":"SKU-%03d","customerId":"c%d","status":"%s","total":%d,"weight":1.5,
+			"note":%s,"tags":["a"],"shippedAt":"2024-01-0%dT10:00:00Z","order":"o",
+			"created_at":"2024-01-01T00:00:00Z","updated_at":"2024-01-02T00:00:00Z"}`,
+			i, i, i%3, []string{"open", "paid"}[i%2], i*10, note, i%9+1))
+	}
+	return "[" + strings.Join(rows, ",") + "]"
+}
+
+func TestCollectionInfer_Proposal(t *testing.T) {
+	h, _, _ := setupIndexTest(t)
+	w := doInferRequest(h, `{"name":"orders","data":`+inferSamples(12)+`}`, adminIdentity())
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data []inferredCollection `json:"data"`
+		Meta map[string]any       `json:"meta"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Meta["samples"] != float64(12) {
+		t.Errorf("expected meta.samples 12, got %v", resp.Meta["samples"])
+	}
+	got := resp.Data[0]
+	if got.Name != "orders" || !got.Timestamps {
+		t.Errorf("expected orders with timestamps, got %+v", got)
+	}
+
+	want := []inferredColumn{
+		{Name: "sku", Type: MoonFieldTypeString, Unique: true},
+		{Name: "customer_id", Type: MoonFieldTypeString},
+		{Name: "status", Type: MoonFieldTypeString},
+		{Name: "total", Type: MoonFieldTypeInteger, Unique: true},
+		{Name: "weight", Type: MoonFieldTypeDecimal},
+		{Name: "note", Type: MoonFieldTypeString, Nullable: true},
+		{Name: "tags", Type: MoonFieldTypeJSON},
+		{Name: "shipped_at", Type: MoonFieldTypeDatetime},
+		{Name: "order_value", Type: MoonFieldTypeString},
+	}
+	if len(got.Columns) != len(want) {
+		t.Fatalf("expected %d columns, got %+v", len(want), got.Columns)
+	}
+	for i, c := range want {
+		if got.Columns[i] != c {
+			t.Errorf("column %d: expected %+v, got %+v", i, c, got.Columns[i])
+		}
+	}
+
+	var indexes []string
+	for _, ix := range got.Indexes {
+		indexes = append(indexes, ix.Name)
+	}
+	if strings.Join(indexes, ",") != "orders_customer_id,orders_status,orders_shipped_at" {
+		t.Errorf("unexpected indexes %v", indexes)
+	}
+}
+
+func TestCollectionInfer_SubmitsToCreate(t *testing.T) {
+	h, _, registry := setupIndexTest(t)
+	w := doInferRequest(h, `{"name":"orders","data":`+inferSamples(3)+`}`, adminIdentity())
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data []json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	create := `{"op":"create","data":[` + string(resp.Data[0]) + `]}`
+	if w := doIndexRequest(h, http.MethodPost, "/collections:mutate", create, adminIdentity()); w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if _, ok := registry.Get("orders"); !ok {
+		t.Fatal("expected orders to exist")
+	}
+
+	if w := doInferRequest(h, `{"name":"orders","data":`+inferSamples(3)+`}`, adminIdentity()); w.Code != http.StatusConflict {
+		t.Errorf("expected 409 for an existing collection, got %d", w.Code)
+	}
+}
+
+func TestCollectionInfer_MixedTypes(t *testing.T) {
+	h, _, _ := setupIndexTest(t)
+	body := `{"name":"readings","data":[{"value":1,"label":"a","empty":null},{"value":2.5,"label":7}]}`
+	w := doInferRequest(h, body, adminIdentity())
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data []inferredCollection `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	got := resp.Data[0]
+	types := map[string]string{}
+	for _, c := range got.Columns {
+		types[c.Name] = c.Type
+	}
+	if types["value"] != MoonFieldTypeDecimal || types["label"] != MoonFieldTypeString || types["empty"] != MoonFieldTypeString {
+		t.Errorf("unexpected types %v", types)
+	}
+	if len(got.Notes) != 2 {
+		t.Errorf("expected notes for label and empty, got %v", got.Notes)
+	}
+}
+
+func TestCollectionInfer_Errors(t *testing.T) {
+	h, _, _ := setupIndexTest(t)
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"invalid body", `{`, http.StatusBadRequest},
+		{"missing name", `{"data":[{"a":1}]}`, http.StatusBadRequest},
+		{"empty data", `{"name":"things","data":[]}`, http.StatusBadRequest},
+		{"not an object", `{"name":"things","data":[[1]]}`, http.StatusBadRequest},
+		{"only id", `{"name":"things","data":[{"id":1}]}`, http.StatusBadRequest},
+		{"reserved name", `{"name":"moon_things","data":[{"a":1}]}`, http.StatusBadRequest},
+		{"existing collection", `{"name":"products","data":[{"a":1}]}`, http.StatusConflict},
+		{"too many samples", `{"name":"things","data":[` + strings.Repeat(`{"a":1},`, MaxInferSamples) + `{"a":1}]}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := doInferRequest(h, tt.body, adminIdentity()); w.Code != tt.want {
+				t.Errorf("expected %d, got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	user := &AuthIdentity{CredentialType: CredentialTypeJWT, CallerID: "u1", Role: "user"}
+	if w := doInferRequest(h, `{"name":"things","data":[{"a":1}]}`, user); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for non-admin, got %d", w.Code)
+	}
+}
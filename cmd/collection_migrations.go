@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ---------------------------------------------------------------------------
+// GET /collections:migrations
+// ---------------------------------------------------------------------------
+
+// HandleMigrations reports the progress of the shadow-table migrations
+// started by modify_columns: those in progress and the last
+// ShadowMigrationHistory finished ones, oldest first. ?name= limits the
+// list to one collection.
+func (h *CollectionHandler) HandleMigrations(w http.ResponseWriter, r *http.Request) {
+	identity, ok := GetAuthIdentity(r.Context())
+	if !ok || !identity.ManagesCollections() {
+		WriteError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	data := make([]any, 0)
+	for _, m := range h.registry.Migrations().List() {
+		if name == "" || m.Collection == name {
+			data = append(data, m)
+		}
+	}
+	meta := map[string]any{"total": len(data)}
+	WriteSuccessFull(w, http.StatusOK, "Migrations retrieved successfully", data, meta, nil)
+}
+
+// migrationConflict returns a 409 error when collection has a shadow
+// migration in progress, whose swap would undo any other schema change
+// made to it meanwhile.
+func (h *CollectionHandler) migrationConflict(collection string) *collectionError {
+	if _, ok := h.registry.Migrations().Active(collection); !ok {
+		return nil
+	}
+	return migrationConflictError(collection)
+}
+
+// migrationConflictError is the error for a schema change to collection
+// while it has a shadow migration in progress.
+func migrationConflictError(collection string) *collectionError {
+	return &collectionError{Status: http.StatusConflict, Message: fmt.Sprintf("Collection '%s' has a schema migration in progress", collection)}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ---------------------------------------------------------------------------
+// Response compression
+//
+// JSON responses of at least CompressMinBytes are gzip- or deflate-encoded
+// when the client's Accept-Encoding allows it. Large list pages shrink the
+// most. Other content types, such as CSV exports and bundles, are sent as is.
+// ---------------------------------------------------------------------------
+
+// compressionMiddleware compresses JSON responses for clients that accept
+// gzip or deflate.
+func compressionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cw := &compressWriter{ResponseWriter: w, encoding: negotiateEncoding(r.Header.Get("Accept-Encoding"))}
+		next.ServeHTTP(cw, r)
+		cw.close()
+	})
+}
+
+// negotiateEncoding returns "gzip" or "deflate", whichever the
+// Accept-Encoding header value prefers, or "" if it accepts neither.
+// gzip wins a tie, and "*" counts as gzip.
+func negotiateEncoding(header string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "*" {
+			name = "gzip"
+		}
+		if name != "gzip" && name != "deflate" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q > 0 && (q > bestQ || (q == bestQ && name == "gzip")) {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// compressWriter holds back a JSON response until CompressMinBytes have
+// been written, then switches to compressing it. A response that ends
+// sooner, or is not JSON, is sent unchanged.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string // "" when the client accepts no supported encoding
+
+	status  int
+	held    bool   // the header is held back while buf fills
+	done    bool   // the header has been sent
+	buf     []byte // body held back while held
+	encoder io.WriteCloser
+}
+
+func (c *compressWriter) WriteHeader(status int) {
+	if c.held || c.done {
+		return
+	}
+	if status >= 100 && status < http.StatusOK {
+		c.ResponseWriter.WriteHeader(status)
+		return
+	}
+	c.status = status
+	h := c.Header()
+	if !isJSONResponse(h) {
+		c.done = true
+		c.ResponseWriter.WriteHeader(status)
+		return
+	}
+	h.Add("Vary", "Accept-Encoding")
+	if c.encoding == "" || h.Get("Content-Encoding") != "" ||
+		status == http.StatusNoContent || status == http.StatusNotModified {
+		c.done = true
+		c.ResponseWriter.WriteHeader(status)
+		return
+	}
+	c.held = true
+}
+
+func (c *compressWriter) Write(p []byte) (int, error) {
+	if !c.held && !c.done {
+		c.WriteHeader(http.StatusOK)
+	}
+	switch {
+	case c.encoder != nil:
+		return c.encoder.Write(p)
+	case !c.held:
+		return c.ResponseWriter.Write(p)
+	}
+	c.buf = append(c.buf, p...)
+	if len(c.buf) >= CompressMinBytes {
+		if err := c.startCompression(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush sends what has been written so far, compressing it if the
+// response is still held back.
+func (c *compressWriter) Flush() {
+	if c.held && c.encoder == nil {
+		if err := c.startCompression(); err != nil {
+			return
+		}
+	}
+	if f, ok := c.encoder.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (c *compressWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// startCompression sends the held header with Content-Encoding set and
+// writes the held body through the encoder.
+func (c *compressWriter) startCompression() error {
+	h := c.Header()
+	h.Set("Content-Encoding", c.encoding)
+	h.Del("Content-Length")
+	// The encoded bytes differ from those a strong ETag names.
+	if etag := h.Get("ETag"); strings.HasPrefix(etag, `"`) {
+		h.Set("ETag", "W/"+etag)
+	}
+	c.ResponseWriter.WriteHeader(c.status)
+	c.done = true
+	if c.encoding == "gzip" {
+		c.encoder = gzip.NewWriter(c.ResponseWriter)
+	} else {
+		c.encoder = zlib.NewWriter(c.ResponseWriter)
+	}
+	buf := c.buf
+	c.buf = nil
+	_, err := c.encoder.Write(buf)
+	return err
+}
+
+// close ends the response: it finishes the compressed stream, or sends a
+// held-back response that stayed below CompressMinBytes as is.
+func (c *compressWriter) close() {
+	if c.encoder != nil {
+		c.encoder.Close()
+		return
+	}
+	if c.held && !c.done {
+		c.done = true
+		c.ResponseWriter.WriteHeader(c.status)
+		c.ResponseWriter.Write(c.buf)
+	}
+}
+
+// isJSONResponse reports whether the response Content-Type is JSON.
+func isJSONResponse(h http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"br", ""},
+		{"gzip", "gzip"},
+		{"deflate", "deflate"},
+		{"deflate, gzip", "gzip"},
+		{"gzip;q=0.5, deflate", "deflate"},
+		{"gzip;q=0, deflate;q=0", ""},
+		{"*", "gzip"},
+		{"GZIP ; q=0.8", "gzip"},
+	}
+	for _, tt := range tests {
+		if got := negotiateEncoding(tt.header); got != tt.want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	large := `{"data":[` + strings.Repeat(`{"name":"widget"},`, 200) + `{}]}`
+	serve := func(contentType, body, acceptEncoding string) *httptest.ResponseRecorder {
+		handler := compressionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", contentType)
+			w.Header().Set("ETag", `"abc"`)
+			w.WriteHeader(http.StatusOK)
+			io.WriteString(w, body)
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/data/products:list", nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, encoding := range []string{"gzip", "deflate"} {
+		w := serve("application/json", large, encoding)
+		if got := w.Header().Get("Content-Encoding"); got != encoding {
+			t.Fatalf("expected Content-Encoding %s, got %q", encoding, got)
+		}
+		if got := w.Header().Get("ETag"); got != `W/"abc"` {
+			t.Errorf("%s: expected a weak ETag, got %q", encoding, got)
+		}
+		if w.Body.Len() >= len(large) {
+			t.Errorf("%s: expected a smaller body, got %d bytes", encoding, w.Body.Len())
+		}
+		var r io.Reader
+		var err error
+		if encoding == "gzip" {
+			r, err = gzip.NewReader(w.Body)
+		} else {
+			r, err = zlib.NewReader(w.Body)
+		}
+		if err != nil {
+			t.Fatalf("%s reader: %v", encoding, err)
+		}
+		if got, _ := io.ReadAll(r); string(got) != large {
+			t.Errorf("%s: body did not round-trip", encoding)
+		}
+	}
+
+	tests := []struct {
+		name, contentType, body, accept string
+	}{
+		{"no accept-encoding", "application/json", large, ""},
+		{"small body", "application/json", `{"data":[]}`, "gzip"},
+		{"not JSON", "text/csv", large, "gzip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(tt.contentType, tt.body, tt.accept)
+			if got := w.Header().Get("Content-Encoding"); got != "" {
+				t.Errorf("expected no Content-Encoding, got %q", got)
+			}
+			if w.Body.String() != tt.body || w.Code != http.StatusOK || w.Header().Get("ETag") != `"abc"` {
+				t.Errorf("expected the body unchanged with 200, got %d", w.Code)
+			}
+			wantVary := tt.contentType == "application/json"
+			if got := w.Header().Get("Vary") == "Accept-Encoding"; got != wantVary {
+				t.Errorf("expected Vary set %v, got %q", wantVary, w.Header().Get("Vary"))
+			}
+		})
+	}
+}
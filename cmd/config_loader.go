@@ -1,12 +1,16 @@
 package main
 
 import (
+	"crypto/tls"
 	"fmt"
+	"math"
 	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"regexp"
+	"slices"
 	"strings"
-	"unicode"
 
 	"gopkg.in/yaml.v3"
 )
@@ -20,6 +24,22 @@ type rawServerConfig struct {
 	Port    *int    `yaml:"port"`
 	Prefix  *string `yaml:"prefix"`
 	Logpath *string `yaml:"logpath"`
+	Pprof   *bool   `yaml:"pprof"`
+
+	ShutdownTimeout *int    `yaml:"shutdown_timeout"`
+	LogLevel        *string `yaml:"log_level"`
+	Compression     *bool   `yaml:"compression"`
+
+	TLS *rawTLSConfig `yaml:"tls"`
+}
+
+type rawTLSConfig struct {
+	CertFile     *string  `yaml:"cert_file"`
+	KeyFile      *string  `yaml:"key_file"`
+	ACMEHosts    []string `yaml:"acme_hosts"`
+	ACMEEmail    *string  `yaml:"acme_email"`
+	ACMECacheDir *string  `yaml:"acme_cache_dir"`
+	HSTSMaxAge   *int     `yaml:"hsts_max_age"`
 }
 
 type rawDatabaseConfig struct {
@@ -30,11 +50,122 @@ type rawDatabaseConfig struct {
 	Host               *string `yaml:"host"`
 	QueryTimeout       *int    `yaml:"query_timeout"`
 	SlowQueryThreshold *int    `yaml:"slow_query_threshold"`
+	ConnectRetries     *int    `yaml:"connect_retries"`
+	ConnectMaxDelay    *int    `yaml:"connect_max_delay"`
+	HealthInterval     *int    `yaml:"health_check_interval"`
+
+	Replicas []rawReplicaConfig `yaml:"replicas"`
+}
+
+type rawReplicaConfig struct {
+	Host     string `yaml:"host"`
+	Database string `yaml:"database"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
 }
 
 type rawCORSConfig struct {
 	Enabled        *bool    `yaml:"enabled"`
 	AllowedOrigins []string `yaml:"allowed_origins"`
+
+	rawCORSRules `yaml:",inline"`
+	Origins      map[string]*rawCORSRules `yaml:"origins"`
+}
+
+type rawCORSRules struct {
+	AllowedMethods   []string `yaml:"allowed_methods"`
+	AllowedHeaders   []string `yaml:"allowed_headers"`
+	AllowCredentials *bool    `yaml:"allow_credentials"`
+	MaxAge           *int     `yaml:"max_age"`
+}
+
+type rawLimitsConfig struct {
+	JWTRequestsPerMinute  *int           `yaml:"jwt_requests_per_minute"`
+	MaxBatchOperations    *int           `yaml:"max_batch_operations"`
+	MaxPerPage            *int           `yaml:"max_per_page"`
+	DefaultPerPage        *int           `yaml:"default_per_page"`
+	MaxRequestBody        *int           `yaml:"max_request_body"`
+	MaxConcurrentRequests *int           `yaml:"max_concurrent_requests"`
+	Routes                map[string]int `yaml:"routes"`
+}
+
+type rawWellKnownConfig struct {
+	RobotsTxt   *string `yaml:"robots_txt"`
+	SecurityTxt *string `yaml:"security_txt"`
+}
+
+type rawErrorReportingConfig struct {
+	SentryDSN   *string `yaml:"sentry_dsn"`
+	Environment *string `yaml:"environment"`
+}
+
+type rawCacheConfig struct {
+	Backend       *string        `yaml:"backend"`
+	RedisURL      *string        `yaml:"redis_url"`
+	QueryTTL      map[string]int `yaml:"query_ttl"`
+	QueryMaxBytes *int64         `yaml:"query_max_bytes"`
+}
+
+type rawTracingConfig struct {
+	OTLPEndpoint *string `yaml:"otlp_endpoint"`
+	ServiceName  *string `yaml:"service_name"`
+}
+
+type rawAggregatePrivacyConfig struct {
+	Epsilon      *float64 `yaml:"epsilon"`
+	MinGroupSize *int     `yaml:"min_group_size"`
+}
+
+type rawSLOConfig struct {
+	Objective *float64       `yaml:"objective"`
+	Targets   map[string]int `yaml:"targets"`
+}
+
+type rawOIDCConfig struct {
+	Issuer        *string  `yaml:"issuer"`
+	ClientID      *string  `yaml:"client_id"`
+	ClientSecret  *string  `yaml:"client_secret"`
+	RedirectURI   *string  `yaml:"redirect_uri"`
+	Scopes        []string `yaml:"scopes"`
+	AutoProvision *bool    `yaml:"auto_provision"`
+	DefaultRole   *string  `yaml:"default_role"`
+}
+
+type rawMailConfig struct {
+	SMTPHost     *string `yaml:"smtp_host"`
+	SMTPPort     *int    `yaml:"smtp_port"`
+	SMTPUsername *string `yaml:"smtp_username"`
+	SMTPPassword *string `yaml:"smtp_password"`
+	From         *string `yaml:"from"`
+	Driver       *string `yaml:"driver"`
+	TemplateDir  *string `yaml:"template_dir"`
+}
+
+type rawPasswordResetConfig struct {
+	URL      *string `yaml:"url"`
+	TokenTTL *int    `yaml:"token_ttl"`
+}
+
+type rawInvitationConfig struct {
+	URL      *string `yaml:"url"`
+	TokenTTL *int    `yaml:"token_ttl"`
+}
+
+type rawPasswordPolicyConfig struct {
+	MinLength        *int  `yaml:"min_length"`
+	RequireLowercase *bool `yaml:"require_lowercase"`
+	RequireUppercase *bool `yaml:"require_uppercase"`
+	RequireDigit     *bool `yaml:"require_digit"`
+	RequireSymbol    *bool `yaml:"require_symbol"`
+	History          *int  `yaml:"history"`
+	LockoutThreshold *int  `yaml:"lockout_threshold"`
+	LockoutDuration  *int  `yaml:"lockout_duration"`
+}
+
+type rawRoleSessionConfig struct {
+	AccessExpiry  *int `yaml:"access_expiry"`
+	RefreshExpiry *int `yaml:"refresh_expiry"`
+	IdleTimeout   *int `yaml:"idle_timeout"`
 }
 
 type rawConfig struct {
@@ -44,12 +175,46 @@ type rawConfig struct {
 	JWTSecret        *string `yaml:"jwt_secret"`
 	JWTAccessExpiry  *int    `yaml:"jwt_access_expiry"`
 	JWTRefreshExpiry *int    `yaml:"jwt_refresh_expiry"`
+	JWTStaleClaims   *string `yaml:"jwt_stale_claims"`
+	JWTIdleTimeout   *int    `yaml:"jwt_idle_timeout"`
+
+	JWTAlgorithm        *string  `yaml:"jwt_algorithm"`
+	JWTKeyFile          *string  `yaml:"jwt_key_file"`
+	JWTPreviousKeyFiles []string `yaml:"jwt_previous_key_files"`
+
+	JWTRoles map[string]*rawRoleSessionConfig `yaml:"jwt_roles"`
 
 	BootstrapAdminUsername *string `yaml:"bootstrap_admin_username"`
 	BootstrapAdminEmail    *string `yaml:"bootstrap_admin_email"`
 	BootstrapAdminPassword *string `yaml:"bootstrap_admin_password"`
 
+	BundleKey *string `yaml:"bundle_key"`
+
 	CORS *rawCORSConfig `yaml:"cors"`
+
+	Limits *rawLimitsConfig `yaml:"limits"`
+
+	WellKnown *rawWellKnownConfig `yaml:"well_known"`
+
+	ErrorReporting *rawErrorReportingConfig `yaml:"error_reporting"`
+
+	Cache *rawCacheConfig `yaml:"cache"`
+
+	Tracing *rawTracingConfig `yaml:"tracing"`
+
+	AggregatePrivacy *rawAggregatePrivacyConfig `yaml:"aggregate_privacy"`
+
+	SLO *rawSLOConfig `yaml:"slo"`
+
+	OIDC *rawOIDCConfig `yaml:"oidc"`
+
+	PasswordPolicy *rawPasswordPolicyConfig `yaml:"password_policy"`
+
+	Mail *rawMailConfig `yaml:"mail"`
+
+	PasswordReset *rawPasswordResetConfig `yaml:"password_reset"`
+
+	Invitation *rawInvitationConfig `yaml:"invitation"`
 }
 
 // ---------------------------------------------------------------------------
@@ -62,6 +227,39 @@ type ServerConfig struct {
 	Port    int
 	Prefix  string
 	Logpath string
+	Pprof   bool
+
+	// ShutdownTimeout is how many seconds in-flight requests are given to
+	// finish during a graceful shutdown.
+	ShutdownTimeout int
+
+	// LogLevel is the lowest level written to the log: one of the LogLevel*
+	// constants.
+	LogLevel string
+
+	// Compression gzip- or deflate-encodes JSON responses for clients that
+	// accept it.
+	Compression bool
+
+	TLS TLSConfig
+}
+
+// TLSConfig holds the HTTPS settings. HTTPS is served with the certificate
+// in CertFile and KeyFile, or with certificates obtained over ACME for
+// ACMEHosts; with neither, the server speaks plain HTTP. HSTSMaxAge is the
+// Strict-Transport-Security max-age in seconds; 0 omits the header.
+type TLSConfig struct {
+	CertFile     string
+	KeyFile      string
+	ACMEHosts    []string
+	ACMEEmail    string
+	ACMECacheDir string
+	HSTSMaxAge   int
+}
+
+// Enabled reports whether the server serves HTTPS.
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || len(c.ACMEHosts) > 0
 }
 
 // DatabaseConfig holds resolved database settings.
@@ -73,12 +271,237 @@ type DatabaseConfig struct {
 	Host               string
 	QueryTimeout       int
 	SlowQueryThreshold int
+
+	// ConnectRetries is how many times startup retries a database that
+	// does not answer, waiting at most ConnectMaxDelay seconds between
+	// attempts.
+	ConnectRetries  int
+	ConnectMaxDelay int
+
+	// HealthInterval is the number of seconds between background pings of
+	// the database. Zero disables them.
+	HealthInterval int
+
+	// Replicas are read replicas of the database. They serve the reads of
+	// list and get requests; everything else uses the primary.
+	Replicas []ReplicaConfig
+}
+
+// ReplicaConfig is a read replica. Empty fields take the primary's value.
+type ReplicaConfig struct {
+	Host     string
+	Database string
+	User     string
+	Password string
+}
+
+// ReplicaConfigs returns the full connection settings of each replica.
+func (d DatabaseConfig) ReplicaConfigs() []DatabaseConfig {
+	configs := make([]DatabaseConfig, len(d.Replicas))
+	for i, r := range d.Replicas {
+		c := d
+		c.Replicas = nil
+		c.Host = r.Host
+		if r.Database != "" {
+			c.Database = r.Database
+		}
+		if r.User != "" {
+			c.User = r.User
+		}
+		if r.Password != "" {
+			c.Password = r.Password
+		}
+		configs[i] = c
+	}
+	return configs
+}
+
+// LimitsConfig holds the request limits that a configuration reload can
+// change while the server runs.
+type LimitsConfig struct {
+	JWTRequestsPerMinute int
+	MaxBatchOperations   int
+	MaxPerPage           int
+	DefaultPerPage       int
+
+	// MaxRequestBody is the largest request body accepted, in bytes.
+	MaxRequestBody int
+
+	// MaxConcurrentRequests is the in-flight request count that load
+	// shedding is measured against. Zero disables load shedding.
+	MaxConcurrentRequests int
+
+	// Routes maps route patterns such as "*:mutate" or "auth:session" to
+	// requests per minute per caller; see matchRoutePattern.
+	Routes map[string]int
+}
+
+// WellKnownConfig holds the bodies of the public /robots.txt and
+// /.well-known/security.txt files. An empty body disables the route.
+type WellKnownConfig struct {
+	RobotsTxt   string
+	SecurityTxt string
+}
+
+// ErrorReportingConfig holds the destination for recovered panics. An
+// empty SentryDSN disables error reporting.
+type ErrorReportingConfig struct {
+	SentryDSN   string
+	Environment string
+}
+
+// CacheConfig selects the backend of the shared cache. RedisURL is only
+// used by the redis backend. QueryTTL maps collection names, or "*" for
+// the rest, to the seconds their list and get results stay in the query
+// result cache of this instance, which holds up to QueryMaxBytes. No TTLs
+// disables the query result cache.
+type CacheConfig struct {
+	Backend       string
+	RedisURL      string
+	QueryTTL      map[string]int
+	QueryMaxBytes int64
+}
+
+// TracingConfig holds the OTLP/HTTP destination for request and query
+// spans. An empty OTLPEndpoint disables tracing.
+type TracingConfig struct {
+	OTLPEndpoint string
+	ServiceName  string
+}
+
+// AggregatePrivacyConfig holds the noise scale and suppression threshold
+// applied to aggregates requested with a noisy_aggregates API key.
+type AggregatePrivacyConfig struct {
+	Epsilon      float64
+	MinGroupSize int
+}
+
+// SLOConfig holds the response-time targets tracked for
+// /admin:diagnostics. Targets maps route patterns, as in limits.routes, to
+// a latency in milliseconds that Objective of requests must meet. No
+// targets disables tracking.
+type SLOConfig struct {
+	Objective float64
+	Targets   map[string]int
+}
+
+// OIDCConfig holds the OpenID Connect provider users may sign in with. An
+// empty Issuer disables OIDC login. Users signing in for the first time
+// are created with DefaultRole when AutoProvision is set.
+type OIDCConfig struct {
+	Issuer        string
+	ClientID      string
+	ClientSecret  string
+	RedirectURI   string
+	Scopes        []string
+	AutoProvision bool
+	DefaultRole   string
+}
+
+// MailConfig holds how Moon sends email. With the smtp driver an empty
+// SMTPHost disables email, and with it password reset; the console driver
+// writes messages to the log instead.
+type MailConfig struct {
+	Driver       string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	From         string
+	TemplateDir  string
+
+	// Templates are the parsed messages, loaded during validation.
+	Templates *MailTemplates
+}
+
+// Enabled reports whether Moon can send email.
+func (m MailConfig) Enabled() bool {
+	return m.Driver == MailDriverConsole || m.SMTPHost != ""
+}
+
+// templates returns the loaded templates, or the built-in ones when the
+// config was not loaded from a file.
+func (m MailConfig) templates() *MailTemplates {
+	if m.Templates != nil {
+		return m.Templates
+	}
+	mt, _ := LoadMailTemplates("")
+	return mt
+}
+
+// PasswordResetConfig holds the self-service password reset settings. When
+// URL is set, reset emails link to it with the token in the token query
+// parameter.
+type PasswordResetConfig struct {
+	URL      string
+	TokenTTL int
+}
+
+// InvitationConfig holds the user invitation settings. When URL is set,
+// invitation emails link to it with the token in the token query
+// parameter.
+type InvitationConfig struct {
+	URL      string
+	TokenTTL int
+}
+
+// PasswordPolicy holds the rules for new passwords and failed logins.
+// History is the number of previous passwords a user may not reuse, besides
+// the current one. After LockoutThreshold consecutive failed logins an
+// account is locked for LockoutDuration seconds; a threshold of 0 disables
+// lockout.
+type PasswordPolicy struct {
+	MinLength        int
+	RequireLowercase bool
+	RequireUppercase bool
+	RequireDigit     bool
+	RequireSymbol    bool
+	History          int
+	LockoutThreshold int
+	LockoutDuration  int
+}
+
+// DefaultPasswordPolicy returns the policy used when password_policy is not
+// configured.
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:        MinPasswordLength,
+		RequireLowercase: DefaultPasswordRequireLowercase,
+		RequireUppercase: DefaultPasswordRequireUppercase,
+		RequireDigit:     DefaultPasswordRequireDigit,
+		RequireSymbol:    DefaultPasswordRequireSymbol,
+		History:          DefaultPasswordHistory,
+		LockoutThreshold: DefaultPasswordLockoutThreshold,
+		LockoutDuration:  DefaultPasswordLockoutDuration,
+	}
 }
 
 // CORSConfig holds resolved CORS settings.
 type CORSConfig struct {
 	Enabled        bool
 	AllowedOrigins []string
+	CORSRules
+
+	// Origins holds the rules for origins listed under cors.origins. These
+	// origins are allowed whether or not AllowedOrigins lists them.
+	Origins map[string]CORSRules
+}
+
+// CORSRules holds what CORS responses grant an allowed origin. MaxAge is
+// in seconds; 0 omits Access-Control-Max-Age.
+type CORSRules struct {
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	AllowCredentials bool
+	MaxAge           int
+}
+
+// SessionLifetime holds the token lifetimes, in seconds, applied to the
+// sessions of one role. IdleTimeout 0 disables the idle timeout.
+type SessionLifetime struct {
+	AccessExpiry  int
+	RefreshExpiry int
+	IdleTimeout   int
 }
 
 // AppConfig is the fully validated application configuration.
@@ -89,12 +512,92 @@ type AppConfig struct {
 	JWTSecret        string
 	JWTAccessExpiry  int
 	JWTRefreshExpiry int
+	JWTStaleClaims   string
+	JWTIdleTimeout   int
+
+	// JWTAlgorithm signs access tokens: HS256 with JWTSecret, or RS256 or
+	// ES256 with the private key in JWTKeyFile. Tokens signed by the keys
+	// in JWTPreviousKeyFiles are still accepted.
+	JWTAlgorithm        string
+	JWTKeyFile          string
+	JWTPreviousKeyFiles []string
+
+	// JWTKeys holds the keys loaded from the settings above. Use
+	// TokenKeys rather than reading it directly.
+	JWTKeys *TokenKeys
+
+	// JWTRoles holds the resolved lifetimes of roles listed under
+	// jwt_roles. Use SessionLifetimeFor rather than reading it directly.
+	JWTRoles map[string]SessionLifetime
 
 	BootstrapAdminUsername string
 	BootstrapAdminEmail    string
 	BootstrapAdminPassword string
 
+	// BundleKey is the secret export bundles are encrypted with. Empty
+	// disables bundles.
+	BundleKey string
+
 	CORS CORSConfig
+
+	Limits LimitsConfig
+
+	WellKnown WellKnownConfig
+
+	ErrorReporting ErrorReportingConfig
+
+	Cache CacheConfig
+
+	Tracing TracingConfig
+
+	AggregatePrivacy AggregatePrivacyConfig
+
+	SLO SLOConfig
+
+	OIDC OIDCConfig
+
+	PasswordPolicy PasswordPolicy
+
+	Mail MailConfig
+
+	PasswordReset PasswordResetConfig
+
+	Invitation InvitationConfig
+
+	// Path is the file the configuration was loaded from, reread on
+	// SIGHUP. It is empty for configurations built in code.
+	Path string
+}
+
+// TokenKeys returns the keys that sign and verify access tokens. A
+// configuration built in code without JWTKeys uses HS256 with JWTSecret.
+func (c *AppConfig) TokenKeys() *TokenKeys {
+	if c.JWTKeys != nil {
+		return c.JWTKeys
+	}
+	return NewHMACTokenKeys(c.JWTSecret)
+}
+
+// Passwords returns the password policy. A configuration built in code
+// without one, or a nil configuration, uses DefaultPasswordPolicy.
+func (c *AppConfig) Passwords() PasswordPolicy {
+	if c == nil || c.PasswordPolicy.MinLength == 0 {
+		return DefaultPasswordPolicy()
+	}
+	return c.PasswordPolicy
+}
+
+// SessionLifetimeFor returns the token lifetimes for role: its jwt_roles
+// entry if there is one, otherwise the global jwt_* values.
+func (c *AppConfig) SessionLifetimeFor(role string) SessionLifetime {
+	if lt, ok := c.JWTRoles[role]; ok {
+		return lt
+	}
+	return SessionLifetime{
+		AccessExpiry:  c.JWTAccessExpiry,
+		RefreshExpiry: c.JWTRefreshExpiry,
+		IdleTimeout:   c.JWTIdleTimeout,
+	}
 }
 
 // ---------------------------------------------------------------------------
@@ -123,6 +626,7 @@ func LoadConfig(path string) (*AppConfig, error) {
 		return nil, err
 	}
 
+	cfg.Path = path
 	return cfg, nil
 }
 
@@ -137,24 +641,124 @@ var knownTopLevel = map[string]bool{
 	"jwt_secret":               true,
 	"jwt_access_expiry":        true,
 	"jwt_refresh_expiry":       true,
+	"jwt_stale_claims":         true,
+	"jwt_idle_timeout":         true,
+	"jwt_algorithm":            true,
+	"jwt_key_file":             true,
+	"jwt_previous_key_files":   true,
+	"jwt_roles":                true,
 	"bootstrap_admin_username": true,
 	"bootstrap_admin_email":    true,
 	"bootstrap_admin_password": true,
+	"bundle_key":               true,
 	"cors":                     true,
+	"limits":                   true,
+	"well_known":               true,
+	"error_reporting":          true,
+	"cache":                    true,
+	"aggregate_privacy":        true,
+	"slo":                      true,
+	"tracing":                  true,
+	"oidc":                     true,
+	"password_policy":          true,
+	"mail":                     true,
+	"password_reset":           true,
+	"invitation":               true,
 }
 
 var knownServerKeys = map[string]bool{
-	"host": true, "port": true, "prefix": true, "logpath": true,
+	"host": true, "port": true, "prefix": true, "logpath": true, "pprof": true,
+	"shutdown_timeout": true, "log_level": true, "compression": true, "tls": true,
+}
+
+var knownTLSKeys = map[string]bool{
+	"cert_file": true, "key_file": true, "acme_hosts": true,
+	"acme_email": true, "acme_cache_dir": true, "hsts_max_age": true,
 }
 
 var knownDatabaseKeys = map[string]bool{
 	"connection": true, "database": true, "user": true,
 	"password": true, "host": true, "query_timeout": true,
-	"slow_query_threshold": true,
+	"slow_query_threshold": true, "connect_retries": true,
+	"connect_max_delay": true, "health_check_interval": true,
+	"replicas": true,
+}
+
+var knownReplicaKeys = map[string]bool{
+	"host": true, "database": true, "user": true, "password": true,
+}
+
+var knownJWTRoles = map[string]bool{
+	"admin": true, "user": true,
+}
+
+var knownJWTRoleKeys = map[string]bool{
+	"access_expiry": true, "refresh_expiry": true, "idle_timeout": true,
 }
 
 var knownCORSKeys = map[string]bool{
-	"enabled": true, "allowed_origins": true,
+	"enabled": true, "allowed_origins": true, "allowed_methods": true,
+	"allowed_headers": true, "allow_credentials": true, "max_age": true,
+	"origins": true,
+}
+
+var knownCORSOriginKeys = map[string]bool{
+	"allowed_methods": true, "allowed_headers": true,
+	"allow_credentials": true, "max_age": true,
+}
+
+var knownLimitsKeys = map[string]bool{
+	"jwt_requests_per_minute": true, "max_batch_operations": true,
+	"max_per_page": true, "default_per_page": true, "max_request_body": true,
+	"max_concurrent_requests": true, "routes": true,
+}
+
+var knownWellKnownKeys = map[string]bool{
+	"robots_txt": true, "security_txt": true,
+}
+
+var knownErrorReportingKeys = map[string]bool{
+	"sentry_dsn": true, "environment": true,
+}
+
+var knownAggregatePrivacyKeys = map[string]bool{
+	"epsilon": true, "min_group_size": true,
+}
+
+var knownSLOKeys = map[string]bool{
+	"objective": true, "targets": true,
+}
+
+var knownOIDCKeys = map[string]bool{
+	"issuer": true, "client_id": true, "client_secret": true, "redirect_uri": true,
+	"scopes": true, "auto_provision": true, "default_role": true,
+}
+
+var knownPasswordPolicyKeys = map[string]bool{
+	"min_length": true, "require_lowercase": true, "require_uppercase": true,
+	"require_digit": true, "require_symbol": true, "history": true,
+	"lockout_threshold": true, "lockout_duration": true,
+}
+
+var knownMailKeys = map[string]bool{
+	"smtp_host": true, "smtp_port": true, "smtp_username": true,
+	"smtp_password": true, "from": true, "driver": true, "template_dir": true,
+}
+
+var knownPasswordResetKeys = map[string]bool{
+	"url": true, "token_ttl": true,
+}
+
+var knownInvitationKeys = map[string]bool{
+	"url": true, "token_ttl": true,
+}
+
+var knownCacheKeys = map[string]bool{
+	"backend": true, "redis_url": true, "query_ttl": true, "query_max_bytes": true,
+}
+
+var knownTracingKeys = map[string]bool{
+	"otlp_endpoint": true, "service_name": true,
 }
 
 func rejectUnknownKeys(data []byte) error {
@@ -172,14 +776,90 @@ func rejectUnknownKeys(data []byte) error {
 			if err := checkSubKeys(val, knownServerKeys, "server"); err != nil {
 				return err
 			}
+			server, _ := val.(map[string]interface{})
+			if err := checkSubKeys(server["tls"], knownTLSKeys, "server.tls"); err != nil {
+				return err
+			}
 		case "database":
 			if err := checkSubKeys(val, knownDatabaseKeys, "database"); err != nil {
 				return err
 			}
+			database, _ := val.(map[string]interface{})
+			replicas, _ := database["replicas"].([]interface{})
+			for i, replica := range replicas {
+				if err := checkSubKeys(replica, knownReplicaKeys, fmt.Sprintf("database.replicas[%d]", i)); err != nil {
+					return err
+				}
+			}
 		case "cors":
 			if err := checkSubKeys(val, knownCORSKeys, "cors"); err != nil {
 				return err
 			}
+			cors, _ := val.(map[string]interface{})
+			origins, _ := cors["origins"].(map[string]interface{})
+			for origin, sub := range origins {
+				if err := checkSubKeys(sub, knownCORSOriginKeys, "cors.origins."+origin); err != nil {
+					return err
+				}
+			}
+		case "limits":
+			if err := checkSubKeys(val, knownLimitsKeys, "limits"); err != nil {
+				return err
+			}
+		case "well_known":
+			if err := checkSubKeys(val, knownWellKnownKeys, "well_known"); err != nil {
+				return err
+			}
+		case "error_reporting":
+			if err := checkSubKeys(val, knownErrorReportingKeys, "error_reporting"); err != nil {
+				return err
+			}
+		case "cache":
+			if err := checkSubKeys(val, knownCacheKeys, "cache"); err != nil {
+				return err
+			}
+		case "aggregate_privacy":
+			if err := checkSubKeys(val, knownAggregatePrivacyKeys, "aggregate_privacy"); err != nil {
+				return err
+			}
+		case "tracing":
+			if err := checkSubKeys(val, knownTracingKeys, "tracing"); err != nil {
+				return err
+			}
+		case "slo":
+			if err := checkSubKeys(val, knownSLOKeys, "slo"); err != nil {
+				return err
+			}
+		case "oidc":
+			if err := checkSubKeys(val, knownOIDCKeys, "oidc"); err != nil {
+				return err
+			}
+		case "mail":
+			if err := checkSubKeys(val, knownMailKeys, "mail"); err != nil {
+				return err
+			}
+		case "password_reset":
+			if err := checkSubKeys(val, knownPasswordResetKeys, "password_reset"); err != nil {
+				return err
+			}
+		case "invitation":
+			if err := checkSubKeys(val, knownInvitationKeys, "invitation"); err != nil {
+				return err
+			}
+		case "password_policy":
+			if err := checkSubKeys(val, knownPasswordPolicyKeys, "password_policy"); err != nil {
+				return err
+			}
+		case "jwt_roles":
+			if err := checkSubKeys(val, knownJWTRoles, "jwt_roles"); err != nil {
+				return err
+			}
+			roles, _ := val.(map[string]interface{})
+			for role, sub := range roles {
+				if err := checkSubKeys(sub, knownJWTRoleKeys, "jwt_roles."+role); err != nil {
+					return err
+				}
+			}
 		}
 	}
 	return nil
@@ -209,18 +889,75 @@ func applyDefaults(raw *rawConfig) *AppConfig {
 			Port:    DefaultServerPort,
 			Prefix:  DefaultServerPrefix,
 			Logpath: DefaultServerLogpath,
+
+			ShutdownTimeout: DefaultServerShutdownTimeout,
+			LogLevel:        DefaultServerLogLevel,
+			Compression:     DefaultServerCompression,
+
+			TLS: TLSConfig{
+				ACMECacheDir: DefaultTLSACMECacheDir,
+				HSTSMaxAge:   DefaultTLSHSTSMaxAge,
+			},
 		},
 		Database: DatabaseConfig{
 			Connection:         DefaultDatabaseConnection,
 			Database:           DefaultDatabaseDatabase,
 			QueryTimeout:       DefaultDatabaseQueryTimeout,
 			SlowQueryThreshold: DefaultDatabaseSlowQueryThreshold,
+			ConnectRetries:     DefaultDatabaseConnectRetries,
+			ConnectMaxDelay:    DefaultDatabaseConnectMaxDelay,
+			HealthInterval:     DefaultDatabaseHealthInterval,
 		},
 		JWTAccessExpiry:  DefaultJWTAccessExpiry,
 		JWTRefreshExpiry: DefaultJWTRefreshExpiry,
+		JWTStaleClaims:   DefaultJWTStaleClaims,
+		JWTIdleTimeout:   DefaultJWTIdleTimeout,
+		JWTAlgorithm:     DefaultJWTAlgorithm,
 		CORS: CORSConfig{
 			Enabled:        DefaultCORSEnabled,
 			AllowedOrigins: DefaultCORSAllowedOrigins,
+			CORSRules: CORSRules{
+				AllowedMethods: DefaultCORSAllowedMethods,
+				AllowedHeaders: DefaultCORSAllowedHeaders,
+				MaxAge:         DefaultCORSMaxAge,
+			},
+		},
+		Limits: LimitsConfig{
+			JWTRequestsPerMinute: RateJWTRequestLimit,
+			MaxBatchOperations:   MaxBatchOperations,
+			MaxPerPage:           MaxPerPage,
+			DefaultPerPage:       DefaultPerPage,
+			MaxRequestBody:       MaxRequestBodyBytes,
+		},
+		AggregatePrivacy: AggregatePrivacyConfig{
+			Epsilon:      DefaultAggregateEpsilon,
+			MinGroupSize: DefaultAggregateMinGroupSize,
+		},
+		Cache: CacheConfig{
+			Backend:       DefaultCacheBackend,
+			QueryMaxBytes: DefaultCacheQueryMaxBytes,
+		},
+		Tracing: TracingConfig{
+			ServiceName: DefaultTracingServiceName,
+		},
+		SLO: SLOConfig{
+			Objective: DefaultSLOObjective,
+		},
+		OIDC: OIDCConfig{
+			Scopes:        DefaultOIDCScopes,
+			AutoProvision: DefaultOIDCAutoProvision,
+			DefaultRole:   DefaultOIDCDefaultRole,
+		},
+		PasswordPolicy: DefaultPasswordPolicy(),
+		Mail: MailConfig{
+			Driver:   DefaultMailDriver,
+			SMTPPort: DefaultMailSMTPPort,
+		},
+		PasswordReset: PasswordResetConfig{
+			TokenTTL: DefaultPasswordResetTokenTTL,
+		},
+		Invitation: InvitationConfig{
+			TokenTTL: DefaultInvitationTokenTTL,
 		},
 	}
 
@@ -238,6 +975,38 @@ func applyDefaults(raw *rawConfig) *AppConfig {
 		if s.Logpath != nil {
 			cfg.Server.Logpath = *s.Logpath
 		}
+		if s.Pprof != nil {
+			cfg.Server.Pprof = *s.Pprof
+		}
+		if s.ShutdownTimeout != nil {
+			cfg.Server.ShutdownTimeout = *s.ShutdownTimeout
+		}
+		if s.LogLevel != nil {
+			cfg.Server.LogLevel = *s.LogLevel
+		}
+		if s.Compression != nil {
+			cfg.Server.Compression = *s.Compression
+		}
+		if t := s.TLS; t != nil {
+			if t.CertFile != nil {
+				cfg.Server.TLS.CertFile = *t.CertFile
+			}
+			if t.KeyFile != nil {
+				cfg.Server.TLS.KeyFile = *t.KeyFile
+			}
+			if t.ACMEHosts != nil {
+				cfg.Server.TLS.ACMEHosts = t.ACMEHosts
+			}
+			if t.ACMEEmail != nil {
+				cfg.Server.TLS.ACMEEmail = *t.ACMEEmail
+			}
+			if t.ACMECacheDir != nil {
+				cfg.Server.TLS.ACMECacheDir = *t.ACMECacheDir
+			}
+			if t.HSTSMaxAge != nil {
+				cfg.Server.TLS.HSTSMaxAge = *t.HSTSMaxAge
+			}
+		}
 	}
 
 	if raw.Database != nil {
@@ -263,6 +1032,18 @@ func applyDefaults(raw *rawConfig) *AppConfig {
 		if d.SlowQueryThreshold != nil {
 			cfg.Database.SlowQueryThreshold = *d.SlowQueryThreshold
 		}
+		if d.ConnectRetries != nil {
+			cfg.Database.ConnectRetries = *d.ConnectRetries
+		}
+		if d.ConnectMaxDelay != nil {
+			cfg.Database.ConnectMaxDelay = *d.ConnectMaxDelay
+		}
+		if d.HealthInterval != nil {
+			cfg.Database.HealthInterval = *d.HealthInterval
+		}
+		for _, r := range d.Replicas {
+			cfg.Database.Replicas = append(cfg.Database.Replicas, ReplicaConfig(r))
+		}
 	}
 
 	// Clear sqlite default database when using non-sqlite backend without
@@ -282,6 +1063,43 @@ func applyDefaults(raw *rawConfig) *AppConfig {
 	if raw.JWTRefreshExpiry != nil {
 		cfg.JWTRefreshExpiry = *raw.JWTRefreshExpiry
 	}
+	if raw.JWTStaleClaims != nil {
+		cfg.JWTStaleClaims = *raw.JWTStaleClaims
+	}
+	if raw.JWTIdleTimeout != nil {
+		cfg.JWTIdleTimeout = *raw.JWTIdleTimeout
+	}
+	if raw.JWTAlgorithm != nil {
+		cfg.JWTAlgorithm = *raw.JWTAlgorithm
+	}
+	if raw.JWTKeyFile != nil {
+		cfg.JWTKeyFile = *raw.JWTKeyFile
+	}
+	cfg.JWTPreviousKeyFiles = raw.JWTPreviousKeyFiles
+	if len(raw.JWTRoles) > 0 {
+		// Unset role values fall back to the global values, which are
+		// final at this point.
+		cfg.JWTRoles = make(map[string]SessionLifetime, len(raw.JWTRoles))
+		for role, r := range raw.JWTRoles {
+			lt := SessionLifetime{
+				AccessExpiry:  cfg.JWTAccessExpiry,
+				RefreshExpiry: cfg.JWTRefreshExpiry,
+				IdleTimeout:   cfg.JWTIdleTimeout,
+			}
+			if r != nil {
+				if r.AccessExpiry != nil {
+					lt.AccessExpiry = *r.AccessExpiry
+				}
+				if r.RefreshExpiry != nil {
+					lt.RefreshExpiry = *r.RefreshExpiry
+				}
+				if r.IdleTimeout != nil {
+					lt.IdleTimeout = *r.IdleTimeout
+				}
+			}
+			cfg.JWTRoles[role] = lt
+		}
+	}
 
 	if raw.BootstrapAdminUsername != nil {
 		cfg.BootstrapAdminUsername = *raw.BootstrapAdminUsername
@@ -292,6 +1110,9 @@ func applyDefaults(raw *rawConfig) *AppConfig {
 	if raw.BootstrapAdminPassword != nil {
 		cfg.BootstrapAdminPassword = *raw.BootstrapAdminPassword
 	}
+	if raw.BundleKey != nil {
+		cfg.BundleKey = *raw.BundleKey
+	}
 
 	if raw.CORS != nil {
 		c := raw.CORS
@@ -301,11 +1122,219 @@ func applyDefaults(raw *rawConfig) *AppConfig {
 		if c.AllowedOrigins != nil {
 			cfg.CORS.AllowedOrigins = c.AllowedOrigins
 		}
+		cfg.CORS.CORSRules = c.rawCORSRules.resolve(cfg.CORS.CORSRules)
+		if len(c.Origins) > 0 {
+			// Unset origin values fall back to the cors values, which are
+			// final at this point.
+			cfg.CORS.Origins = make(map[string]CORSRules, len(c.Origins))
+			for origin, r := range c.Origins {
+				rules := cfg.CORS.CORSRules
+				if r != nil {
+					rules = r.resolve(rules)
+				}
+				cfg.CORS.Origins[origin] = rules
+			}
+		}
+	}
+
+	if raw.Limits != nil {
+		l := raw.Limits
+		if l.JWTRequestsPerMinute != nil {
+			cfg.Limits.JWTRequestsPerMinute = *l.JWTRequestsPerMinute
+		}
+		if l.MaxBatchOperations != nil {
+			cfg.Limits.MaxBatchOperations = *l.MaxBatchOperations
+		}
+		if l.MaxPerPage != nil {
+			cfg.Limits.MaxPerPage = *l.MaxPerPage
+		}
+		if l.DefaultPerPage != nil {
+			cfg.Limits.DefaultPerPage = *l.DefaultPerPage
+		}
+		if l.MaxRequestBody != nil {
+			cfg.Limits.MaxRequestBody = *l.MaxRequestBody
+		}
+		if l.MaxConcurrentRequests != nil {
+			cfg.Limits.MaxConcurrentRequests = *l.MaxConcurrentRequests
+		}
+		if l.Routes != nil {
+			cfg.Limits.Routes = l.Routes
+		}
+	}
+
+	if raw.WellKnown != nil {
+		if raw.WellKnown.RobotsTxt != nil {
+			cfg.WellKnown.RobotsTxt = *raw.WellKnown.RobotsTxt
+		}
+		if raw.WellKnown.SecurityTxt != nil {
+			cfg.WellKnown.SecurityTxt = *raw.WellKnown.SecurityTxt
+		}
+	}
+
+	if raw.ErrorReporting != nil {
+		if raw.ErrorReporting.SentryDSN != nil {
+			cfg.ErrorReporting.SentryDSN = *raw.ErrorReporting.SentryDSN
+		}
+		if raw.ErrorReporting.Environment != nil {
+			cfg.ErrorReporting.Environment = *raw.ErrorReporting.Environment
+		}
+	}
+
+	if raw.Cache != nil {
+		if raw.Cache.Backend != nil {
+			cfg.Cache.Backend = *raw.Cache.Backend
+		}
+		if raw.Cache.RedisURL != nil {
+			cfg.Cache.RedisURL = *raw.Cache.RedisURL
+		}
+		if raw.Cache.QueryTTL != nil {
+			cfg.Cache.QueryTTL = raw.Cache.QueryTTL
+		}
+		if raw.Cache.QueryMaxBytes != nil {
+			cfg.Cache.QueryMaxBytes = *raw.Cache.QueryMaxBytes
+		}
+	}
+
+	if raw.AggregatePrivacy != nil {
+		if raw.AggregatePrivacy.Epsilon != nil {
+			cfg.AggregatePrivacy.Epsilon = *raw.AggregatePrivacy.Epsilon
+		}
+		if raw.AggregatePrivacy.MinGroupSize != nil {
+			cfg.AggregatePrivacy.MinGroupSize = *raw.AggregatePrivacy.MinGroupSize
+		}
+	}
+
+	if raw.Tracing != nil {
+		if raw.Tracing.OTLPEndpoint != nil {
+			cfg.Tracing.OTLPEndpoint = *raw.Tracing.OTLPEndpoint
+		}
+		if raw.Tracing.ServiceName != nil {
+			cfg.Tracing.ServiceName = *raw.Tracing.ServiceName
+		}
+	}
+
+	if raw.SLO != nil {
+		if raw.SLO.Objective != nil {
+			cfg.SLO.Objective = *raw.SLO.Objective
+		}
+		if raw.SLO.Targets != nil {
+			cfg.SLO.Targets = raw.SLO.Targets
+		}
+	}
+
+	if o := raw.OIDC; o != nil {
+		if o.Issuer != nil {
+			cfg.OIDC.Issuer = strings.TrimRight(*o.Issuer, "/")
+		}
+		if o.ClientID != nil {
+			cfg.OIDC.ClientID = *o.ClientID
+		}
+		if o.ClientSecret != nil {
+			cfg.OIDC.ClientSecret = *o.ClientSecret
+		}
+		if o.RedirectURI != nil {
+			cfg.OIDC.RedirectURI = *o.RedirectURI
+		}
+		if o.Scopes != nil {
+			cfg.OIDC.Scopes = o.Scopes
+		}
+		if o.AutoProvision != nil {
+			cfg.OIDC.AutoProvision = *o.AutoProvision
+		}
+		if o.DefaultRole != nil {
+			cfg.OIDC.DefaultRole = *o.DefaultRole
+		}
+	}
+
+	if m := raw.Mail; m != nil {
+		if m.SMTPHost != nil {
+			cfg.Mail.SMTPHost = *m.SMTPHost
+		}
+		if m.SMTPPort != nil {
+			cfg.Mail.SMTPPort = *m.SMTPPort
+		}
+		if m.SMTPUsername != nil {
+			cfg.Mail.SMTPUsername = *m.SMTPUsername
+		}
+		if m.SMTPPassword != nil {
+			cfg.Mail.SMTPPassword = *m.SMTPPassword
+		}
+		if m.From != nil {
+			cfg.Mail.From = *m.From
+		}
+		if m.Driver != nil {
+			cfg.Mail.Driver = *m.Driver
+		}
+		if m.TemplateDir != nil {
+			cfg.Mail.TemplateDir = *m.TemplateDir
+		}
+	}
+
+	if p := raw.PasswordReset; p != nil {
+		if p.URL != nil {
+			cfg.PasswordReset.URL = *p.URL
+		}
+		if p.TokenTTL != nil {
+			cfg.PasswordReset.TokenTTL = *p.TokenTTL
+		}
+	}
+
+	if inv := raw.Invitation; inv != nil {
+		if inv.URL != nil {
+			cfg.Invitation.URL = *inv.URL
+		}
+		if inv.TokenTTL != nil {
+			cfg.Invitation.TokenTTL = *inv.TokenTTL
+		}
+	}
+
+	if p := raw.PasswordPolicy; p != nil {
+		if p.MinLength != nil {
+			cfg.PasswordPolicy.MinLength = *p.MinLength
+		}
+		if p.RequireLowercase != nil {
+			cfg.PasswordPolicy.RequireLowercase = *p.RequireLowercase
+		}
+		if p.RequireUppercase != nil {
+			cfg.PasswordPolicy.RequireUppercase = *p.RequireUppercase
+		}
+		if p.RequireDigit != nil {
+			cfg.PasswordPolicy.RequireDigit = *p.RequireDigit
+		}
+		if p.RequireSymbol != nil {
+			cfg.PasswordPolicy.RequireSymbol = *p.RequireSymbol
+		}
+		if p.History != nil {
+			cfg.PasswordPolicy.History = *p.History
+		}
+		if p.LockoutThreshold != nil {
+			cfg.PasswordPolicy.LockoutThreshold = *p.LockoutThreshold
+		}
+		if p.LockoutDuration != nil {
+			cfg.PasswordPolicy.LockoutDuration = *p.LockoutDuration
+		}
 	}
 
 	return cfg
 }
 
+// resolve returns base with the values set in r applied.
+func (r rawCORSRules) resolve(base CORSRules) CORSRules {
+	if r.AllowedMethods != nil {
+		base.AllowedMethods = r.AllowedMethods
+	}
+	if r.AllowedHeaders != nil {
+		base.AllowedHeaders = r.AllowedHeaders
+	}
+	if r.AllowCredentials != nil {
+		base.AllowCredentials = *r.AllowCredentials
+	}
+	if r.MaxAge != nil {
+		base.MaxAge = *r.MaxAge
+	}
+	return base
+}
+
 // ---------------------------------------------------------------------------
 // Validation
 // ---------------------------------------------------------------------------
@@ -320,9 +1349,322 @@ func validate(cfg *AppConfig) error {
 	if err := validateJWT(cfg); err != nil {
 		return err
 	}
+	if err := validatePasswordPolicyConfig(cfg.PasswordPolicy); err != nil {
+		return err
+	}
 	if err := validateBootstrapAdmin(cfg); err != nil {
 		return err
 	}
+	if cfg.BundleKey != "" && len(cfg.BundleKey) < MinBundleKeyLength {
+		return fmt.Errorf("bundle_key must be at least %d characters", MinBundleKeyLength)
+	}
+	if err := validateLimits(cfg); err != nil {
+		return err
+	}
+	if err := validateWellKnown(cfg); err != nil {
+		return err
+	}
+	if dsn := cfg.ErrorReporting.SentryDSN; dsn != "" {
+		if _, _, err := parseSentryDSN(dsn); err != nil {
+			return fmt.Errorf("error_reporting.sentry_dsn: %w", err)
+		}
+	}
+	if err := validateCache(cfg); err != nil {
+		return err
+	}
+	if err := validateCORS(cfg.CORS); err != nil {
+		return err
+	}
+	if e := cfg.AggregatePrivacy.Epsilon; !(e > 0) || math.IsInf(e, 1) {
+		return fmt.Errorf("aggregate_privacy.epsilon must be a positive number, got %v", e)
+	}
+	if cfg.AggregatePrivacy.MinGroupSize < 1 {
+		return fmt.Errorf("aggregate_privacy.min_group_size must be at least 1, got %d", cfg.AggregatePrivacy.MinGroupSize)
+	}
+	if endpoint := cfg.Tracing.OTLPEndpoint; endpoint != "" {
+		if err := validateOTLPEndpoint(endpoint); err != nil {
+			return fmt.Errorf("tracing.otlp_endpoint: %w", err)
+		}
+	}
+	if o := cfg.SLO.Objective; !(o > 0 && o < 1) {
+		return fmt.Errorf("slo.objective must be between 0 and 1, got %v", o)
+	}
+	for pattern, ms := range cfg.SLO.Targets {
+		if !routePatternRegex.MatchString(pattern) {
+			return fmt.Errorf("slo.targets key %q must be name:action, where either may be *", pattern)
+		}
+		if ms < 1 {
+			return fmt.Errorf("slo.targets.%s must be at least 1 millisecond, got %d", pattern, ms)
+		}
+	}
+	if err := validateOIDC(cfg.OIDC); err != nil {
+		return err
+	}
+	if err := validateMail(&cfg.Mail); err != nil {
+		return err
+	}
+	if err := validatePasswordReset(cfg.PasswordReset); err != nil {
+		return err
+	}
+	if err := validateInvitation(cfg.Invitation); err != nil {
+		return err
+	}
+	return nil
+}
+
+// validateMail checks the mail section and loads its templates.
+func validateMail(m *MailConfig) error {
+	if m.Driver != MailDriverSMTP && m.Driver != MailDriverConsole {
+		return fmt.Errorf("mail.driver must be %q or %q, got %q", MailDriverSMTP, MailDriverConsole, m.Driver)
+	}
+	templates, err := LoadMailTemplates(m.TemplateDir)
+	if err != nil {
+		return fmt.Errorf("mail.template_dir: %w", err)
+	}
+	m.Templates = templates
+	if !m.Enabled() {
+		return nil
+	}
+	if m.Driver == MailDriverSMTP {
+		if m.SMTPPort < 1 || m.SMTPPort > 65535 {
+			return fmt.Errorf("mail.smtp_port must be between 1 and 65535, got %d", m.SMTPPort)
+		}
+		if m.SMTPPassword != "" && m.SMTPUsername == "" {
+			return fmt.Errorf("mail.smtp_password requires mail.smtp_username")
+		}
+	}
+	if !isValidEmail(m.From) {
+		return fmt.Errorf("mail.from must be a valid email address when email is enabled")
+	}
+	return nil
+}
+
+// validatePasswordReset checks the password_reset section.
+func validatePasswordReset(p PasswordResetConfig) error {
+	if p.URL != "" {
+		if u, err := url.Parse(p.URL); err != nil || !u.IsAbs() {
+			return fmt.Errorf("password_reset.url must be an absolute URL")
+		}
+	}
+	if p.TokenTTL < MinPasswordResetTokenTTL || p.TokenTTL > MaxPasswordResetTokenTTL {
+		return fmt.Errorf("password_reset.token_ttl must be between %d and %d seconds, got %d", MinPasswordResetTokenTTL, MaxPasswordResetTokenTTL, p.TokenTTL)
+	}
+	return nil
+}
+
+// validateInvitation checks the invitation section.
+func validateInvitation(inv InvitationConfig) error {
+	if inv.URL != "" {
+		if u, err := url.Parse(inv.URL); err != nil || !u.IsAbs() {
+			return fmt.Errorf("invitation.url must be an absolute URL")
+		}
+	}
+	if inv.TokenTTL < MinInvitationTokenTTL || inv.TokenTTL > MaxInvitationTokenTTL {
+		return fmt.Errorf("invitation.token_ttl must be between %d and %d seconds, got %d", MinInvitationTokenTTL, MaxInvitationTokenTTL, inv.TokenTTL)
+	}
+	return nil
+}
+
+// validatePasswordPolicyConfig checks the password_policy section.
+func validatePasswordPolicyConfig(p PasswordPolicy) error {
+	if p.MinLength < MinPasswordLength || p.MinLength > MaxPasswordLength {
+		return fmt.Errorf("password_policy.min_length must be between %d and %d, got %d", MinPasswordLength, MaxPasswordLength, p.MinLength)
+	}
+	if p.History < 0 || p.History > MaxPasswordHistory {
+		return fmt.Errorf("password_policy.history must be between 0 and %d, got %d", MaxPasswordHistory, p.History)
+	}
+	if p.LockoutThreshold < 0 {
+		return fmt.Errorf("password_policy.lockout_threshold must be 0 (disabled) or positive, got %d", p.LockoutThreshold)
+	}
+	if p.LockoutDuration < 1 {
+		return fmt.Errorf("password_policy.lockout_duration must be at least 1 second, got %d", p.LockoutDuration)
+	}
+	return nil
+}
+
+// validateOIDC checks the oidc section when an issuer is set. The issuer
+// must use https except on a loopback host, since its signing keys are
+// fetched from it.
+func validateOIDC(o OIDCConfig) error {
+	if o.Issuer == "" {
+		return nil
+	}
+	u, err := url.Parse(o.Issuer)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && !(u.Scheme == "http" && isLoopbackHost(u.Hostname()))) {
+		return fmt.Errorf("oidc.issuer must be an https URL")
+	}
+	if o.ClientID == "" {
+		return fmt.Errorf("oidc.client_id is required when oidc.issuer is set")
+	}
+	if u, err := url.Parse(o.RedirectURI); err != nil || !u.IsAbs() {
+		return fmt.Errorf("oidc.redirect_uri must be an absolute URL")
+	}
+	if !slices.Contains(o.Scopes, "openid") {
+		return fmt.Errorf("oidc.scopes must include openid")
+	}
+	if o.DefaultRole != "admin" && o.DefaultRole != "user" {
+		return fmt.Errorf("oidc.default_role must be admin or user, got %q", o.DefaultRole)
+	}
+	return nil
+}
+
+// isLoopbackHost reports whether host is localhost or a loopback address.
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// validateCORS checks the cors rules and the origins they are keyed by.
+// Credentials cannot be granted through the "*" origin, since that would
+// let any site make authenticated requests.
+func validateCORS(c CORSConfig) error {
+	if err := validateCORSRules(c.CORSRules, "cors."); err != nil {
+		return err
+	}
+	if c.AllowCredentials && slices.Contains(c.AllowedOrigins, "*") {
+		return fmt.Errorf("cors.allow_credentials cannot be used with the \"*\" origin; list origins explicitly")
+	}
+	for origin, rules := range c.Origins {
+		if !validCORSOrigin(origin) {
+			return fmt.Errorf("cors.origins: %q must be a scheme and host, such as https://app.example.com", origin)
+		}
+		if err := validateCORSRules(rules, "cors.origins."+origin+"."); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateCORSRules(r CORSRules, prefix string) error {
+	for _, m := range r.AllowedMethods {
+		switch m {
+		case http.MethodGet, http.MethodPost, http.MethodOptions:
+		default:
+			return fmt.Errorf("%sallowed_methods: %q is not one of GET, POST, OPTIONS", prefix, m)
+		}
+	}
+	for _, h := range r.AllowedHeaders {
+		if !validHeaderName(h) {
+			return fmt.Errorf("%sallowed_headers: %q is not a valid header name", prefix, h)
+		}
+	}
+	if r.MaxAge < 0 {
+		return fmt.Errorf("%smax_age must not be negative, got %d", prefix, r.MaxAge)
+	}
+	return nil
+}
+
+// validCORSOrigin reports whether origin is in the form browsers send in
+// the Origin header: an http or https scheme and a host, with no path.
+func validCORSOrigin(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.Path == "" &&
+		u.User == nil && u.RawQuery == "" && u.Fragment == "" && !strings.Contains(u.Host, "*")
+}
+
+// validHeaderName reports whether name is an HTTP token.
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if c > 0x7E || c <= ' ' || strings.ContainsRune("\"(),/:;<=>?@[\\]{}", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateCache checks the backend name and that the redis backend has a
+// valid URL, then the query result cache settings. Whether the server
+// answers is checked at startup.
+func validateCache(cfg *AppConfig) error {
+	for name, ttl := range cfg.Cache.QueryTTL {
+		if name != CacheQueryTTLDefaultKey && !namePattern.MatchString(name) {
+			return fmt.Errorf("cache.query_ttl key %q must be a collection name or %q", name, CacheQueryTTLDefaultKey)
+		}
+		if ttl < 0 {
+			return fmt.Errorf("cache.query_ttl.%s must be at least 0 seconds, got %d", name, ttl)
+		}
+	}
+	if cfg.Cache.QueryMaxBytes < 1 {
+		return fmt.Errorf("cache.query_max_bytes must be at least 1, got %d", cfg.Cache.QueryMaxBytes)
+	}
+	switch cfg.Cache.Backend {
+	case CacheBackendMemory:
+		return nil
+	case CacheBackendRedis:
+		if cfg.Cache.RedisURL == "" {
+			return fmt.Errorf("cache.redis_url is required when cache.backend is %q", CacheBackendRedis)
+		}
+		if _, err := parseRedisURL(cfg.Cache.RedisURL); err != nil {
+			return fmt.Errorf("cache.redis_url: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("cache.backend must be %q or %q, got %q", CacheBackendMemory, CacheBackendRedis, cfg.Cache.Backend)
+	}
+}
+
+// validateLimits checks each limit against its ceiling, and that the
+// default page size fits within the maximum.
+func validateLimits(cfg *AppConfig) error {
+	l := cfg.Limits
+	if l.JWTRequestsPerMinute < 1 {
+		return fmt.Errorf("limits.jwt_requests_per_minute must be at least 1, got %d", l.JWTRequestsPerMinute)
+	}
+	if l.MaxBatchOperations < 1 || l.MaxBatchOperations > MaxBatchOperations {
+		return fmt.Errorf("limits.max_batch_operations must be between 1 and %d, got %d", MaxBatchOperations, l.MaxBatchOperations)
+	}
+	if l.MaxPerPage < 1 || l.MaxPerPage > MaxPerPage {
+		return fmt.Errorf("limits.max_per_page must be between 1 and %d, got %d", MaxPerPage, l.MaxPerPage)
+	}
+	if l.DefaultPerPage < 1 || l.DefaultPerPage > l.MaxPerPage {
+		return fmt.Errorf("limits.default_per_page must be between 1 and limits.max_per_page (%d), got %d", l.MaxPerPage, l.DefaultPerPage)
+	}
+	if l.MaxRequestBody < MinRequestBodyBytes || l.MaxRequestBody > MaxRequestBodyBytes {
+		return fmt.Errorf("limits.max_request_body must be between %d and %d, got %d", MinRequestBodyBytes, MaxRequestBodyBytes, l.MaxRequestBody)
+	}
+	if l.MaxConcurrentRequests < 0 {
+		return fmt.Errorf("limits.max_concurrent_requests must be 0 or more, got %d", l.MaxConcurrentRequests)
+	}
+	for pattern, limit := range l.Routes {
+		if !routePatternRegex.MatchString(pattern) {
+			return fmt.Errorf("limits.routes key %q must be name:action, where either may be *", pattern)
+		}
+		if limit < 1 {
+			return fmt.Errorf("limits.routes.%s must be at least 1, got %d", pattern, limit)
+		}
+	}
+	return nil
+}
+
+// validateWellKnown checks that security.txt carries the Contact and
+// Expires fields RFC 9116 requires.
+func validateWellKnown(cfg *AppConfig) error {
+	body := cfg.WellKnown.SecurityTxt
+	if body == "" {
+		return nil
+	}
+	for _, field := range []string{"Contact", "Expires"} {
+		found := false
+		for _, line := range strings.Split(body, "\n") {
+			name, _, ok := strings.Cut(line, ":")
+			if ok && strings.EqualFold(strings.TrimSpace(name), field) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("well_known.security_txt must contain a %s field", field)
+		}
+	}
 	return nil
 }
 
@@ -348,9 +1690,68 @@ func validateServer(cfg *AppConfig) error {
 		return err
 	}
 
+	if cfg.Server.ShutdownTimeout < 1 {
+		return fmt.Errorf("server.shutdown_timeout must be at least 1 second, got %d", cfg.Server.ShutdownTimeout)
+	}
+
+	if _, ok := parseLogLevel(cfg.Server.LogLevel); !ok {
+		return fmt.Errorf("server.log_level must be one of %s, %s, %s, or %s, got %q",
+			LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError, cfg.Server.LogLevel)
+	}
+
+	return validateTLS(cfg.Server.TLS)
+}
+
+// validateTLS checks that one certificate source is configured: a
+// certificate and key that load, or valid ACME host names.
+func validateTLS(t TLSConfig) error {
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return fmt.Errorf("server.tls.cert_file and server.tls.key_file must be set together")
+	}
+	if t.CertFile != "" && len(t.ACMEHosts) > 0 {
+		return fmt.Errorf("server.tls.cert_file and server.tls.acme_hosts cannot both be set")
+	}
+	if t.CertFile != "" {
+		if _, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile); err != nil {
+			return fmt.Errorf("server.tls.cert_file: cannot load certificate: %w", err)
+		}
+	}
+	for _, host := range t.ACMEHosts {
+		if !validACMEHost(host) {
+			return fmt.Errorf("server.tls.acme_hosts: %q is not a valid host name", host)
+		}
+	}
+	if len(t.ACMEHosts) > 0 && t.ACMECacheDir == "" {
+		return fmt.Errorf("server.tls.acme_cache_dir must not be empty")
+	}
+	if t.HSTSMaxAge < 0 {
+		return fmt.Errorf("server.tls.hsts_max_age must not be negative, got %d", t.HSTSMaxAge)
+	}
 	return nil
 }
 
+// acmeHostLabel matches one DNS label.
+var acmeHostLabel = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// validACMEHost reports whether host is a lowercase DNS name with at least
+// two labels. IP addresses, ports, and wildcards are rejected, since ACME
+// cannot issue certificates for them over TLS-ALPN-01.
+func validACMEHost(host string) bool {
+	if len(host) > 253 || net.ParseIP(host) != nil {
+		return false
+	}
+	labels := strings.Split(host, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, l := range labels {
+		if !acmeHostLabel.MatchString(l) {
+			return false
+		}
+	}
+	return true
+}
+
 func validateLogpath(path string) error {
 	if path == "" {
 		return fmt.Errorf("server.logpath must not be empty")
@@ -391,6 +1792,23 @@ func validateDatabase(cfg *AppConfig) error {
 	if cfg.Database.SlowQueryThreshold <= 0 {
 		return fmt.Errorf("database.slow_query_threshold must be a positive integer, got %d", cfg.Database.SlowQueryThreshold)
 	}
+	if cfg.Database.ConnectRetries < 0 {
+		return fmt.Errorf("database.connect_retries must be 0 or a positive integer, got %d", cfg.Database.ConnectRetries)
+	}
+	if cfg.Database.ConnectMaxDelay <= 0 {
+		return fmt.Errorf("database.connect_max_delay must be a positive integer, got %d", cfg.Database.ConnectMaxDelay)
+	}
+	if cfg.Database.HealthInterval < 0 {
+		return fmt.Errorf("database.health_check_interval must be 0 or a positive integer, got %d", cfg.Database.HealthInterval)
+	}
+	if len(cfg.Database.Replicas) > 0 && cfg.Database.Connection == DBConnectionSQLite {
+		return fmt.Errorf("database.replicas is not supported for sqlite")
+	}
+	for i, r := range cfg.Database.Replicas {
+		if r.Host == "" {
+			return fmt.Errorf("database.replicas[%d].host is required", i)
+		}
+	}
 
 	return nil
 }
@@ -402,15 +1820,56 @@ func validateJWT(cfg *AppConfig) error {
 	if len(cfg.JWTSecret) < MinJWTSecretLength {
 		return fmt.Errorf("jwt_secret must be at least %d characters", MinJWTSecretLength)
 	}
-	if cfg.JWTAccessExpiry <= 0 {
-		return fmt.Errorf("jwt_access_expiry must be a positive integer")
+	global := SessionLifetime{
+		AccessExpiry:  cfg.JWTAccessExpiry,
+		RefreshExpiry: cfg.JWTRefreshExpiry,
+		IdleTimeout:   cfg.JWTIdleTimeout,
+	}
+	if err := validateSessionLifetime(global, "jwt_"); err != nil {
+		return err
+	}
+	for _, role := range []string{"admin", "user"} {
+		if lt, ok := cfg.JWTRoles[role]; ok {
+			if err := validateSessionLifetime(lt, "jwt_roles."+role+"."); err != nil {
+				return err
+			}
+		}
+	}
+	if cfg.JWTStaleClaims != JWTStaleClaimsOverride && cfg.JWTStaleClaims != JWTStaleClaimsReject {
+		return fmt.Errorf("jwt_stale_claims must be %q or %q", JWTStaleClaimsOverride, JWTStaleClaimsReject)
 	}
-	if cfg.JWTRefreshExpiry <= 0 {
-		return fmt.Errorf("jwt_refresh_expiry must be a positive integer")
+	if cfg.JWTAlgorithm == JWTAlgorithmHS256 && cfg.JWTKeyFile != "" {
+		return fmt.Errorf("jwt_key_file requires jwt_algorithm %s or %s", JWTAlgorithmRS256, JWTAlgorithmES256)
 	}
-	if cfg.JWTRefreshExpiry <= cfg.JWTAccessExpiry {
-		return fmt.Errorf("jwt_refresh_expiry (%d) must be greater than jwt_access_expiry (%d)",
-			cfg.JWTRefreshExpiry, cfg.JWTAccessExpiry)
+	// The keys are loaded here, as server.tls certificates are, so that a
+	// missing or mismatched key file fails startup and reload.
+	keys, err := LoadTokenKeys(cfg.JWTAlgorithm, cfg.JWTKeyFile, cfg.JWTPreviousKeyFiles, cfg.JWTSecret)
+	if err != nil {
+		return err
+	}
+	cfg.JWTKeys = keys
+	return nil
+}
+
+// validateSessionLifetime checks one set of lifetimes. prefix is
+// prepended to the key names in error messages.
+func validateSessionLifetime(lt SessionLifetime, prefix string) error {
+	if lt.AccessExpiry <= 0 {
+		return fmt.Errorf("%saccess_expiry must be a positive integer", prefix)
+	}
+	if lt.RefreshExpiry <= 0 {
+		return fmt.Errorf("%srefresh_expiry must be a positive integer", prefix)
+	}
+	if lt.RefreshExpiry <= lt.AccessExpiry {
+		return fmt.Errorf("%srefresh_expiry (%d) must be greater than %saccess_expiry (%d)",
+			prefix, lt.RefreshExpiry, prefix, lt.AccessExpiry)
+	}
+	if lt.IdleTimeout == 0 {
+		return nil
+	}
+	if lt.IdleTimeout <= lt.AccessExpiry || lt.IdleTimeout > lt.RefreshExpiry {
+		return fmt.Errorf("%sidle_timeout (%d) must be 0 or greater than %saccess_expiry (%d) and at most %srefresh_expiry (%d)",
+			prefix, lt.IdleTimeout, prefix, lt.AccessExpiry, prefix, lt.RefreshExpiry)
 	}
 	return nil
 }
@@ -442,7 +1901,7 @@ func validateBootstrapAdmin(cfg *AppConfig) error {
 		return fmt.Errorf("bootstrap_admin_email %q is not a valid email address", cfg.BootstrapAdminEmail)
 	}
 
-	if err := validatePasswordPolicy(cfg.BootstrapAdminPassword); err != nil {
+	if err := cfg.PasswordPolicy.Validate(cfg.BootstrapAdminPassword); err != nil {
 		return fmt.Errorf("bootstrap_admin_password: %w", err)
 	}
 
@@ -454,33 +1913,3 @@ var emailRegexp = regexp.MustCompile(`^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA
 func isValidEmail(email string) bool {
 	return emailRegexp.MatchString(email)
 }
-
-func validatePasswordPolicy(password string) error {
-	if len(password) < MinPasswordLength {
-		return fmt.Errorf("must be at least %d characters", MinPasswordLength)
-	}
-
-	var hasLower, hasUpper, hasDigit bool
-	for _, r := range password {
-		switch {
-		case unicode.IsLower(r):
-			hasLower = true
-		case unicode.IsUpper(r):
-			hasUpper = true
-		case unicode.IsDigit(r):
-			hasDigit = true
-		}
-	}
-
-	if !hasLower {
-		return fmt.Errorf("must contain at least one lowercase letter")
-	}
-	if !hasUpper {
-		return fmt.Errorf("must contain at least one uppercase letter")
-	}
-	if !hasDigit {
-		return fmt.Errorf("must contain at least one digit")
-	}
-
-	return nil
-}
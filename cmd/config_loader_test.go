@@ -1,8 +1,10 @@
 package main
 
 import (
+	"crypto/elliptic"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -192,6 +194,62 @@ cors:
 	}
 }
 
+func TestLoadConfig_CORSRules(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "test.log")
+	base := `jwt_secret: "this-is-a-very-long-secret-that-is-at-least-32-chars!"
+server:
+  logpath: "` + logPath + `"
+`
+	cfg, err := LoadConfig(writeTempConfig(t, base))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if strings.Join(cfg.CORS.AllowedMethods, ",") != "GET,POST,OPTIONS" || cfg.CORS.MaxAge != DefaultCORSMaxAge || cfg.CORS.AllowCredentials {
+		t.Fatalf("unexpected default cors rules %+v", cfg.CORS.CORSRules)
+	}
+
+	cfg, err = LoadConfig(writeTempConfig(t, base+`cors:
+  allowed_origins: ["https://www.example.com"]
+  allowed_headers: ["Authorization"]
+  max_age: 600
+  origins:
+    "https://app.example.com":
+      allowed_methods: ["POST"]
+      allow_credentials: true
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	app := cfg.CORS.Origins["https://app.example.com"]
+	if cfg.CORS.MaxAge != 600 || strings.Join(app.AllowedMethods, ",") != "POST" || !app.AllowCredentials ||
+		strings.Join(app.AllowedHeaders, ",") != "Authorization" || app.MaxAge != 600 {
+		t.Fatalf("expected unset origin values to fall back to cors, got %+v / %+v", cfg.CORS.CORSRules, app)
+	}
+
+	tests := []struct {
+		name string
+		cors string
+		want string
+	}{
+		{"unsupported method", "  allowed_methods: [\"PUT\"]\n", "cors.allowed_methods"},
+		{"bad header", "  allowed_headers: [\"Bad Header\"]\n", "cors.allowed_headers"},
+		{"negative max age", "  max_age: -1\n", "cors.max_age"},
+		{"credentials with wildcard", "  allow_credentials: true\n", "cors.allow_credentials"},
+		{"origin with path", "  origins:\n    \"https://app.example.com/x\": {}\n", "cors.origins"},
+		{"wildcard origin", "  origins:\n    \"*\": {}\n", "cors.origins"},
+		{"bad origin method", "  origins:\n    \"https://app.example.com\":\n      allowed_methods: [\"DELETE\"]\n", "cors.origins.https://app.example.com.allowed_methods"},
+		{"unknown origin key", "  origins:\n    \"https://app.example.com\":\n      enabled: true\n", "cors.origins.https://app.example.com.enabled"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadConfig(writeTempConfig(t, base+"cors:\n"+tt.cors))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
 // ---------------------------------------------------------------------------
 // JWT validation
 // ---------------------------------------------------------------------------
@@ -229,6 +287,325 @@ server:
 	}
 }
 
+func TestLoadConfig_BundleKey(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "test.log")
+	base := `jwt_secret: "this-is-a-very-long-secret-that-is-at-least-32-chars!"
+server:
+  logpath: "` + logPath + `"
+`
+	if _, err := LoadConfig(writeTempConfig(t, base+`bundle_key: "short"`+"\n")); err == nil || !strings.Contains(err.Error(), "bundle_key") {
+		t.Fatalf("expected short bundle_key error, got %v", err)
+	}
+	cfg, err := LoadConfig(writeTempConfig(t, base+`bundle_key: "another-long-secret-used-for-export-bundles"`+"\n"))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.BundleKey != "another-long-secret-used-for-export-bundles" {
+		t.Fatalf("unexpected bundle key %q", cfg.BundleKey)
+	}
+}
+
+func TestLoadConfig_Tracing(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "test.log")
+	base := `jwt_secret: "this-is-a-very-long-secret-that-is-at-least-32-chars!"
+server:
+  logpath: "` + logPath + `"
+`
+	cfg, err := LoadConfig(writeTempConfig(t, base))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.Tracing.OTLPEndpoint != "" || cfg.Tracing.ServiceName != DefaultTracingServiceName {
+		t.Fatalf("unexpected default tracing config %+v", cfg.Tracing)
+	}
+	if _, err := LoadConfig(writeTempConfig(t, base+"tracing:\n  otlp_endpoint: \"collector:4318\"\n")); err == nil || !strings.Contains(err.Error(), "tracing.otlp_endpoint") {
+		t.Fatalf("expected invalid endpoint error, got %v", err)
+	}
+	cfg, err = LoadConfig(writeTempConfig(t, base+"tracing:\n  otlp_endpoint: \"http://collector:4318/v1/traces\"\n  service_name: \"api\"\n"))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.Tracing.OTLPEndpoint != "http://collector:4318/v1/traces" || cfg.Tracing.ServiceName != "api" {
+		t.Fatalf("unexpected tracing config %+v", cfg.Tracing)
+	}
+}
+
+func TestLoadConfig_AggregatePrivacy(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "test.log")
+	base := `jwt_secret: "this-is-a-very-long-secret-that-is-at-least-32-chars!"
+server:
+  logpath: "` + logPath + `"
+`
+	cfg, err := LoadConfig(writeTempConfig(t, base))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.AggregatePrivacy.Epsilon != DefaultAggregateEpsilon || cfg.AggregatePrivacy.MinGroupSize != DefaultAggregateMinGroupSize {
+		t.Fatalf("unexpected default aggregate privacy %+v", cfg.AggregatePrivacy)
+	}
+	cfg, err = LoadConfig(writeTempConfig(t, base+"aggregate_privacy:\n  epsilon: 0.1\n  min_group_size: 20\n"))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.AggregatePrivacy.Epsilon != 0.1 || cfg.AggregatePrivacy.MinGroupSize != 20 {
+		t.Fatalf("unexpected aggregate privacy %+v", cfg.AggregatePrivacy)
+	}
+	for _, bad := range []string{"  epsilon: 0\n", "  epsilon: -1\n", "  min_group_size: 0\n"} {
+		if _, err := LoadConfig(writeTempConfig(t, base+"aggregate_privacy:\n"+bad)); err == nil || !strings.Contains(err.Error(), "aggregate_privacy.") {
+			t.Errorf("%q: expected an aggregate_privacy error, got %v", bad, err)
+		}
+	}
+}
+
+func TestLoadConfig_LimitsAndLogLevel(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "test.log")
+	base := `jwt_secret: "this-is-a-very-long-secret-that-is-at-least-32-chars!"
+`
+	cfg, err := LoadConfig(writeTempConfig(t, base+"server:\n  logpath: \""+logPath+"\"\n"))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	want := LimitsConfig{JWTRequestsPerMinute: RateJWTRequestLimit, MaxBatchOperations: MaxBatchOperations, MaxPerPage: MaxPerPage, DefaultPerPage: DefaultPerPage, MaxRequestBody: MaxRequestBodyBytes}
+	if !reflect.DeepEqual(cfg.Limits, want) || cfg.Server.LogLevel != LogLevelInfo || !cfg.Server.Compression {
+		t.Fatalf("unexpected defaults %+v, log level %q, compression %v", cfg.Limits, cfg.Server.LogLevel, cfg.Server.Compression)
+	}
+
+	cfg, err = LoadConfig(writeTempConfig(t, base+"server:\n  logpath: \""+logPath+"\"\n  log_level: debug\n  compression: false\n"+
+		"limits:\n  jwt_requests_per_minute: 300\n  max_batch_operations: 20\n  max_per_page: 50\n  default_per_page: 10\n  max_request_body: 65536\n  max_concurrent_requests: 200\n  routes:\n    \"*:mutate\": 30\n"))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	want = LimitsConfig{JWTRequestsPerMinute: 300, MaxBatchOperations: 20, MaxPerPage: 50, DefaultPerPage: 10, MaxRequestBody: 65536, MaxConcurrentRequests: 200, Routes: map[string]int{"*:mutate": 30}}
+	if !reflect.DeepEqual(cfg.Limits, want) || cfg.Server.LogLevel != LogLevelDebug || cfg.Server.Compression {
+		t.Fatalf("unexpected limits %+v, log level %q, compression %v", cfg.Limits, cfg.Server.LogLevel, cfg.Server.Compression)
+	}
+
+	for _, tc := range []struct{ yaml, key string }{
+		{"server:\n  logpath: \"" + logPath + "\"\n  log_level: verbose\n", "server.log_level"},
+		{"limits:\n  jwt_requests_per_minute: 0\n", "limits.jwt_requests_per_minute"},
+		{"limits:\n  max_batch_operations: 101\n", "limits.max_batch_operations"},
+		{"limits:\n  max_per_page: 500\n", "limits.max_per_page"},
+		{"limits:\n  max_per_page: 10\n", "limits.default_per_page"},
+		{"limits:\n  max_request_body: 512\n", "limits.max_request_body"},
+		{"limits:\n  max_request_body: 1073741824\n", "limits.max_request_body"},
+		{"limits:\n  max_concurrent_requests: -1\n", "limits.max_concurrent_requests"},
+		{"limits:\n  routes:\n    orders: 5\n", "limits.routes"},
+		{"limits:\n  routes:\n    \"*:mutate\": 0\n", "limits.routes"},
+		{"limits:\n  burst: 5\n", "limits.burst"},
+		{"slo:\n  objective: 1\n", "slo.objective"},
+		{"slo:\n  targets:\n    query: 100\n", "slo.targets"},
+		{"slo:\n  targets:\n    \"*:query\": 0\n", "slo.targets"},
+	} {
+		yaml := base + tc.yaml
+		if !strings.Contains(tc.yaml, "server:") {
+			yaml += "server:\n  logpath: \"" + logPath + "\"\n"
+		}
+		if _, err := LoadConfig(writeTempConfig(t, yaml)); err == nil || !strings.Contains(err.Error(), tc.key) {
+			t.Errorf("expected %s error, got %v", tc.key, err)
+		}
+	}
+}
+
+func TestLoadConfig_JWTStaleClaims(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "test.log")
+	base := `jwt_secret: "this-is-a-very-long-secret-that-is-at-least-32-chars!"
+server:
+  logpath: "` + logPath + `"
+`
+	cfg, err := LoadConfig(writeTempConfig(t, base))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.JWTStaleClaims != JWTStaleClaimsOverride {
+		t.Errorf("expected default %q, got %q", JWTStaleClaimsOverride, cfg.JWTStaleClaims)
+	}
+
+	cfg, err = LoadConfig(writeTempConfig(t, base+"jwt_stale_claims: reject\n"))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.JWTStaleClaims != JWTStaleClaimsReject {
+		t.Errorf("expected %q, got %q", JWTStaleClaimsReject, cfg.JWTStaleClaims)
+	}
+
+	if _, err := LoadConfig(writeTempConfig(t, base+"jwt_stale_claims: ignore\n")); err == nil {
+		t.Fatal("expected error for invalid jwt_stale_claims")
+	}
+}
+
+func TestLoadConfig_ServerPprof(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "test.log")
+	base := `jwt_secret: "this-is-a-very-long-secret-that-is-at-least-32-chars!"
+server:
+  logpath: "` + logPath + `"
+`
+	cfg, err := LoadConfig(writeTempConfig(t, base))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.Server.Pprof {
+		t.Error("expected server.pprof to default to false")
+	}
+	cfg, err = LoadConfig(writeTempConfig(t, base+"  pprof: true\n"))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if !cfg.Server.Pprof {
+		t.Error("expected server.pprof to be true")
+	}
+}
+
+func TestLoadConfig_ServerTLS(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "test.log")
+	base := `jwt_secret: "this-is-a-very-long-secret-that-is-at-least-32-chars!"
+server:
+  logpath: "` + logPath + `"
+`
+	cfg, err := LoadConfig(writeTempConfig(t, base))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.Server.TLS.Enabled() || cfg.Server.TLS.ACMECacheDir != DefaultTLSACMECacheDir || cfg.Server.TLS.HSTSMaxAge != DefaultTLSHSTSMaxAge {
+		t.Fatalf("unexpected default tls config %+v", cfg.Server.TLS)
+	}
+
+	certFile, keyFile := writeTestCertificate(t)
+	cfg, err = LoadConfig(writeTempConfig(t, base+"  tls:\n    cert_file: \""+certFile+"\"\n    key_file: \""+keyFile+"\"\n    hsts_max_age: 0\n"))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if !cfg.Server.TLS.Enabled() || cfg.Server.TLS.HSTSMaxAge != 0 {
+		t.Fatalf("unexpected tls config %+v", cfg.Server.TLS)
+	}
+	cfg, err = LoadConfig(writeTempConfig(t, base+"  tls:\n    acme_hosts: [\"api.example.com\"]\n    acme_email: \"ops@example.com\"\n"))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if !cfg.Server.TLS.Enabled() || cfg.Server.TLS.ACMEEmail != "ops@example.com" {
+		t.Fatalf("unexpected tls config %+v", cfg.Server.TLS)
+	}
+
+	tests := []struct {
+		name string
+		tls  string
+		want string
+	}{
+		{"cert without key", "    cert_file: \"" + certFile + "\"\n", "must be set together"},
+		{"missing cert", "    cert_file: \"/nonexistent.pem\"\n    key_file: \"" + keyFile + "\"\n", "cannot load certificate"},
+		{"cert and acme", "    cert_file: \"" + certFile + "\"\n    key_file: \"" + keyFile + "\"\n    acme_hosts: [\"api.example.com\"]\n", "cannot both be set"},
+		{"ip host", "    acme_hosts: [\"10.0.0.1\"]\n", "not a valid host name"},
+		{"wildcard host", "    acme_hosts: [\"*.example.com\"]\n", "not a valid host name"},
+		{"host with port", "    acme_hosts: [\"api.example.com:443\"]\n", "not a valid host name"},
+		{"empty cache dir", "    acme_hosts: [\"api.example.com\"]\n    acme_cache_dir: \"\"\n", "acme_cache_dir"},
+		{"negative hsts", "    hsts_max_age: -1\n", "hsts_max_age"},
+		{"unknown key", "    ca_file: \"ca.pem\"\n", "server.tls.ca_file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadConfig(writeTempConfig(t, base+"  tls:\n"+tt.tls))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_WellKnown(t *testing.T) {
+	base := minimalValidYAML(t)
+	cfg, err := LoadConfig(writeTempConfig(t, base+`well_known:
+  robots_txt: |
+    User-agent: *
+    Disallow: /
+  security_txt: |
+    Contact: mailto:security@example.com
+    Expires: 2030-01-01T00:00:00Z
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.WellKnown.RobotsTxt != "User-agent: *\nDisallow: /\n" {
+		t.Errorf("unexpected robots_txt %q", cfg.WellKnown.RobotsTxt)
+	}
+	if !strings.HasPrefix(cfg.WellKnown.SecurityTxt, "Contact: ") {
+		t.Errorf("unexpected security_txt %q", cfg.WellKnown.SecurityTxt)
+	}
+
+	_, err = LoadConfig(writeTempConfig(t, base+`well_known:
+  security_txt: "Contact: mailto:security@example.com"
+`))
+	if err == nil || !strings.Contains(err.Error(), "Expires") {
+		t.Fatalf("expected missing Expires error, got %v", err)
+	}
+
+	if _, err := LoadConfig(writeTempConfig(t, base+"well_known:\n  humans_txt: hi\n")); err == nil {
+		t.Fatal("expected error for unknown well_known key")
+	}
+}
+
+func TestLoadConfig_ErrorReporting(t *testing.T) {
+	base := minimalValidYAML(t)
+	cfg, err := LoadConfig(writeTempConfig(t, base+`error_reporting:
+  sentry_dsn: "https://abc123@sentry.example.com/42"
+  environment: production
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.ErrorReporting.SentryDSN != "https://abc123@sentry.example.com/42" || cfg.ErrorReporting.Environment != "production" {
+		t.Errorf("unexpected error_reporting %+v", cfg.ErrorReporting)
+	}
+
+	_, err = LoadConfig(writeTempConfig(t, base+"error_reporting:\n  sentry_dsn: \"https://sentry.example.com/42\"\n"))
+	if err == nil || !strings.Contains(err.Error(), "sentry_dsn") {
+		t.Fatalf("expected invalid DSN error, got %v", err)
+	}
+}
+
+func TestLoadConfig_JWTRoles(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "test.log")
+	base := `jwt_secret: "this-is-a-very-long-secret-that-is-at-least-32-chars!"
+jwt_access_expiry: 1800
+server:
+  logpath: "` + logPath + `"
+`
+	cfg, err := LoadConfig(writeTempConfig(t, base+`jwt_roles:
+  admin:
+    access_expiry: 300
+    refresh_expiry: 28800
+    idle_timeout: 3600
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if got := cfg.SessionLifetimeFor("admin"); got != (SessionLifetime{AccessExpiry: 300, RefreshExpiry: 28800, IdleTimeout: 3600}) {
+		t.Errorf("unexpected admin lifetime: %+v", got)
+	}
+	if got := cfg.SessionLifetimeFor("user"); got != (SessionLifetime{AccessExpiry: 1800, RefreshExpiry: DefaultJWTRefreshExpiry}) {
+		t.Errorf("expected user to use global lifetimes, got %+v", got)
+	}
+
+	cfg, err = LoadConfig(writeTempConfig(t, base+"jwt_roles:\n  user:\n    idle_timeout: 86400\n"))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if got := cfg.SessionLifetimeFor("user"); got.AccessExpiry != 1800 || got.IdleTimeout != 86400 {
+		t.Errorf("expected unset role values to inherit global ones, got %+v", got)
+	}
+
+	invalid := map[string]string{
+		"unknown role":         "jwt_roles:\n  guest:\n    access_expiry: 60\n",
+		"unknown key":          "jwt_roles:\n  user:\n    lifetime: 60\n",
+		"refresh below access": "jwt_roles:\n  user:\n    refresh_expiry: 600\n",
+		"idle below access":    "jwt_roles:\n  user:\n    idle_timeout: 600\n",
+		"idle above refresh":   "jwt_idle_timeout: 700000\n",
+	}
+	for name, extra := range invalid {
+		if _, err := LoadConfig(writeTempConfig(t, base+extra)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
 func TestLoadConfig_JWTRefreshNotGreaterThanAccess(t *testing.T) {
 	logDir := t.TempDir()
 	logPath := filepath.Join(logDir, "test.log")
@@ -634,6 +1011,124 @@ database:
 	}
 }
 
+func TestLoadConfig_DatabaseConnectSettings(t *testing.T) {
+	logDir := t.TempDir()
+	logPath := filepath.Join(logDir, "test.log")
+	yaml := `jwt_secret: "this-is-a-very-long-secret-that-is-at-least-32-chars!"
+server:
+  logpath: "` + logPath + `"
+database:
+  connect_retries: 3
+  connect_max_delay: 4
+  health_check_interval: 0
+`
+	cfg, err := LoadConfig(writeTempConfig(t, yaml))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.Database.ConnectRetries != 3 || cfg.Database.ConnectMaxDelay != 4 || cfg.Database.HealthInterval != 0 {
+		t.Fatalf("unexpected database settings: %+v", cfg.Database)
+	}
+
+	for _, bad := range []string{"connect_retries: -1", "connect_max_delay: 0", "health_check_interval: -5"} {
+		yaml := `jwt_secret: "this-is-a-very-long-secret-that-is-at-least-32-chars!"
+server:
+  logpath: "` + logPath + `"
+database:
+  ` + bad + `
+`
+		_, err := LoadConfig(writeTempConfig(t, yaml))
+		key := strings.SplitN(bad, ":", 2)[0]
+		if err == nil || !strings.Contains(err.Error(), key) {
+			t.Errorf("%s: expected an error naming %s, got %v", bad, key, err)
+		}
+	}
+}
+
+func TestLoadConfig_DatabaseReplicas(t *testing.T) {
+	logDir := t.TempDir()
+	logPath := filepath.Join(logDir, "test.log")
+	base := `jwt_secret: "this-is-a-very-long-secret-that-is-at-least-32-chars!"
+server:
+  logpath: "` + logPath + `"
+`
+	cfg, err := LoadConfig(writeTempConfig(t, base+`database:
+  connection: mysql
+  database: moon
+  user: moon
+  password: secret
+  host: primary
+  replicas:
+    - host: replica-1
+    - host: replica-2
+      user: reader
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if len(cfg.Database.Replicas) != 2 || cfg.Database.Replicas[1].User != "reader" {
+		t.Fatalf("unexpected replicas: %+v", cfg.Database.Replicas)
+	}
+
+	tests := []struct {
+		name, yaml, want string
+	}{
+		{"sqlite", "database:\n  replicas:\n    - host: replica-1\n", "not supported for sqlite"},
+		{"missing host", "database:\n  connection: mysql\n  database: moon\n  user: moon\n  password: secret\n  host: primary\n  replicas:\n    - user: reader\n", "database.replicas[0].host"},
+		{"unknown key", "database:\n  replicas:\n    - host: replica-1\n      port: 3306\n", "database.replicas[0].port"},
+	}
+	for _, tt := range tests {
+		_, err := LoadConfig(writeTempConfig(t, base+tt.yaml))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestLoadConfig_CacheQueryTTL(t *testing.T) {
+	logDir := t.TempDir()
+	logPath := filepath.Join(logDir, "test.log")
+	base := `jwt_secret: "this-is-a-very-long-secret-that-is-at-least-32-chars!"
+server:
+  logpath: "` + logPath + `"
+`
+	cfg, err := LoadConfig(writeTempConfig(t, base))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.Cache.QueryTTL != nil || cfg.Cache.QueryMaxBytes != DefaultCacheQueryMaxBytes {
+		t.Fatalf("unexpected defaults: %+v", cfg.Cache)
+	}
+
+	cfg, err = LoadConfig(writeTempConfig(t, base+`cache:
+  query_max_bytes: 1048576
+  query_ttl:
+    "*": 30
+    products: 300
+    orders: 0
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.Cache.QueryMaxBytes != 1048576 || cfg.Cache.QueryTTL["products"] != 300 || cfg.Cache.QueryTTL["*"] != 30 {
+		t.Fatalf("unexpected cache config: %+v", cfg.Cache)
+	}
+
+	tests := []struct {
+		name, yaml, want string
+	}{
+		{"bad name", "cache:\n  query_ttl:\n    Products: 30\n", `cache.query_ttl key "Products"`},
+		{"negative ttl", "cache:\n  query_ttl:\n    products: -1\n", "cache.query_ttl.products"},
+		{"zero max bytes", "cache:\n  query_max_bytes: 0\n", "cache.query_max_bytes"},
+	}
+	for _, tt := range tests {
+		_, err := LoadConfig(writeTempConfig(t, base+tt.yaml))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Email validation
 // ---------------------------------------------------------------------------
@@ -682,7 +1177,7 @@ func TestValidatePasswordPolicy(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		err := validatePasswordPolicy(tt.password)
+		err := DefaultPasswordPolicy().Validate(tt.password)
 		if tt.wantErr && err == nil {
 			t.Errorf("password %q: expected error containing %q", tt.password, tt.errMsg)
 		}
@@ -695,6 +1190,77 @@ func TestValidatePasswordPolicy(t *testing.T) {
 	}
 }
 
+func TestPasswordPolicy_Configured(t *testing.T) {
+	path := writeTempConfig(t, minimalValidYAML(t)+`password_policy:
+  min_length: 12
+  require_uppercase: false
+  require_symbol: true
+  history: 5
+  lockout_threshold: 3
+  lockout_duration: 60
+`)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	p := cfg.Passwords()
+	assertEqual(t, p.History, 5)
+	assertEqual(t, p.LockoutThreshold, 3)
+	assertEqual(t, p.LockoutDuration, 60)
+
+	for _, tt := range []struct {
+		password string
+		errMsg   string
+	}{
+		{"lower-case-12", ""},
+		{"Short-1", "at least 12"},
+		{"nosymbolhere12", "symbol"},
+		{"no-digits-here", "digit"},
+		{strings.Repeat("a1!", 25), "at most 72"},
+	} {
+		err := p.Validate(tt.password)
+		if tt.errMsg == "" && err != nil {
+			t.Errorf("password %q: unexpected error: %v", tt.password, err)
+		}
+		if tt.errMsg != "" && (err == nil || !strings.Contains(err.Error(), tt.errMsg)) {
+			t.Errorf("password %q: expected error containing %q, got %v", tt.password, tt.errMsg, err)
+		}
+	}
+}
+
+func TestValidatePasswordPolicyConfig(t *testing.T) {
+	if err := validatePasswordPolicyConfig(DefaultPasswordPolicy()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, tt := range []struct {
+		modify func(*PasswordPolicy)
+		want   string
+	}{
+		{func(p *PasswordPolicy) { p.MinLength = 6 }, "password_policy.min_length"},
+		{func(p *PasswordPolicy) { p.MinLength = 73 }, "password_policy.min_length"},
+		{func(p *PasswordPolicy) { p.History = MaxPasswordHistory + 1 }, "password_policy.history"},
+		{func(p *PasswordPolicy) { p.LockoutThreshold = -1 }, "password_policy.lockout_threshold"},
+		{func(p *PasswordPolicy) { p.LockoutDuration = 0 }, "password_policy.lockout_duration"},
+	} {
+		p := DefaultPasswordPolicy()
+		tt.modify(&p)
+		if err := validatePasswordPolicyConfig(p); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("expected %s error, got %v", tt.want, err)
+		}
+	}
+
+	// The bootstrap admin password must meet the configured policy.
+	path := writeTempConfig(t, minimalValidYAML(t)+`bootstrap_admin_username: admin
+bootstrap_admin_email: admin@example.com
+bootstrap_admin_password: "MoonAdmin12"
+password_policy:
+  require_symbol: true
+`)
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "bootstrap_admin_password") {
+		t.Errorf("expected the bootstrap password to be checked against the policy, got %v", err)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Port zero
 // ---------------------------------------------------------------------------
@@ -785,13 +1351,23 @@ func TestValidateServer_ValidConfig(t *testing.T) {
 	logDir := t.TempDir()
 	logPath := filepath.Join(logDir, "test.log")
 	cfg := &AppConfig{
-		Server: ServerConfig{Host: "127.0.0.1", Port: 6000, Logpath: logPath},
+		Server: ServerConfig{Host: "127.0.0.1", Port: 6000, Logpath: logPath, ShutdownTimeout: DefaultServerShutdownTimeout, LogLevel: DefaultServerLogLevel},
 	}
 	if err := validateServer(cfg); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
 
+func TestValidateServer_InvalidShutdownTimeout(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "test.log")
+	cfg := &AppConfig{
+		Server: ServerConfig{Host: "127.0.0.1", Port: 6000, Logpath: logPath, ShutdownTimeout: 0},
+	}
+	if err := validateServer(cfg); err == nil || !strings.Contains(err.Error(), "server.shutdown_timeout") {
+		t.Fatalf("expected shutdown_timeout error, got %v", err)
+	}
+}
+
 func TestValidateServer_InvalidHost(t *testing.T) {
 	cfg := &AppConfig{
 		Server: ServerConfig{Host: "invalid-host-that-does-not-exist.example.invalid", Port: 6000},
@@ -811,3 +1387,162 @@ func TestValidateServer_PortTooHigh(t *testing.T) {
 		t.Fatal("expected error for port > 65535")
 	}
 }
+
+func TestLoadConfig_OIDC(t *testing.T) {
+	path := writeTempConfig(t, minimalValidYAML(t)+`oidc:
+  issuer: "https://id.example.com/"
+  client_id: moon
+  redirect_uri: "https://app.example.com/callback"
+`)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertEqual(t, cfg.OIDC.Issuer, "https://id.example.com")
+	assertEqual(t, cfg.OIDC.DefaultRole, DefaultOIDCDefaultRole)
+	assertEqual(t, cfg.OIDC.AutoProvision, DefaultOIDCAutoProvision)
+	if !reflect.DeepEqual(cfg.OIDC.Scopes, DefaultOIDCScopes) {
+		t.Errorf("expected default scopes, got %v", cfg.OIDC.Scopes)
+	}
+}
+
+func TestLoadConfig_JWTAlgorithm(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := writePEMKey(t, dir, "ec.pem", newECTestKey(t, elliptic.P256()))
+	previous := writePEMKey(t, dir, "old.pub", &newRSATestKey(t, 2048).PublicKey)
+
+	cfg, err := LoadConfig(writeTempConfig(t, minimalValidYAML(t)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertEqual(t, cfg.JWTAlgorithm, JWTAlgorithmHS256)
+	if cfg.TokenKeys().Asymmetric() {
+		t.Error("expected HS256 keys by default")
+	}
+
+	cfg, err = LoadConfig(writeTempConfig(t, minimalValidYAML(t)+`jwt_algorithm: ES256
+jwt_key_file: "`+keyFile+`"
+jwt_previous_key_files:
+  - "`+previous+`"
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if keys := cfg.TokenKeys().JWKS()["keys"].([]any); len(keys) != 2 {
+		t.Errorf("expected 2 verification keys, got %d", len(keys))
+	}
+
+	_, err = LoadConfig(writeTempConfig(t, minimalValidYAML(t)+`jwt_key_file: "`+keyFile+`"
+`))
+	if err == nil || !strings.Contains(err.Error(), "jwt_key_file requires jwt_algorithm") {
+		t.Errorf("expected a key file without RS256 or ES256 to be rejected, got %v", err)
+	}
+
+	_, err = LoadConfig(writeTempConfig(t, minimalValidYAML(t)+`jwt_algorithm: RS256
+`))
+	if err == nil || !strings.Contains(err.Error(), "jwt_key_file") {
+		t.Errorf("expected RS256 without a key file to be rejected, got %v", err)
+	}
+}
+
+func TestValidateOIDC(t *testing.T) {
+	valid := OIDCConfig{
+		Issuer:      "https://id.example.com",
+		ClientID:    "moon",
+		RedirectURI: "https://app.example.com/callback",
+		Scopes:      DefaultOIDCScopes,
+		DefaultRole: "user",
+	}
+	if err := validateOIDC(valid); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := validateOIDC(OIDCConfig{}); err != nil {
+		t.Fatalf("expected an unset issuer to be valid, got %v", err)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		modify func(*OIDCConfig)
+		want   string
+	}{
+		{"plain http", func(o *OIDCConfig) { o.Issuer = "http://id.example.com" }, "oidc.issuer"},
+		{"missing client", func(o *OIDCConfig) { o.ClientID = "" }, "oidc.client_id"},
+		{"relative redirect", func(o *OIDCConfig) { o.RedirectURI = "/callback" }, "oidc.redirect_uri"},
+		{"no openid scope", func(o *OIDCConfig) { o.Scopes = []string{"email"} }, "oidc.scopes"},
+		{"bad role", func(o *OIDCConfig) { o.DefaultRole = "owner" }, "oidc.default_role"},
+	} {
+		o := valid
+		tt.modify(&o)
+		if err := validateOIDC(o); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected %s error, got %v", tt.name, tt.want, err)
+		}
+	}
+
+	local := valid
+	local.Issuer = "http://127.0.0.1:8080"
+	if err := validateOIDC(local); err != nil {
+		t.Errorf("expected a loopback http issuer to be valid, got %v", err)
+	}
+}
+
+func TestLoadConfig_MailAndPasswordReset(t *testing.T) {
+	path := writeTempConfig(t, minimalValidYAML(t)+`mail:
+  smtp_host: smtp.example.com
+  smtp_username: moon
+  smtp_password: secret
+  from: moon@example.com
+password_reset:
+  url: https://app.example.com/reset
+  token_ttl: 1800
+`)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertEqual(t, cfg.Mail.SMTPPort, DefaultMailSMTPPort)
+	assertEqual(t, cfg.Mail.From, "moon@example.com")
+	assertEqual(t, cfg.PasswordReset.TokenTTL, 1800)
+
+	for _, tt := range []struct {
+		yaml string
+		want string
+	}{
+		{"mail:\n  smtp_host: smtp.example.com\n", "mail.from"},
+		{"mail:\n  smtp_host: smtp.example.com\n  from: moon@example.com\n  smtp_port: 70000\n", "mail.smtp_port"},
+		{"mail:\n  smtp_host: smtp.example.com\n  from: moon@example.com\n  smtp_password: secret\n", "mail.smtp_username"},
+		{"mail:\n  smtp_server: smtp.example.com\n", "mail.smtp_server"},
+		{"password_reset:\n  url: /reset\n", "password_reset.url"},
+		{"password_reset:\n  token_ttl: 60\n", "password_reset.token_ttl"},
+		{"invitation:\n  url: invite\n", "invitation.url"},
+		{"invitation:\n  token_ttl: 60\n", "invitation.token_ttl"},
+	} {
+		_, err := LoadConfig(writeTempConfig(t, minimalValidYAML(t)+tt.yaml))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("expected %s error, got %v", tt.want, err)
+		}
+	}
+}
+
+func TestLoadConfig_MailDriver(t *testing.T) {
+	cfg, err := LoadConfig(writeTempConfig(t, minimalValidYAML(t)+"mail:\n  driver: console\n  from: moon@example.com\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.Mail.Enabled() || cfg.Mail.Templates == nil {
+		t.Errorf("expected the console driver to enable email, got %+v", cfg.Mail)
+	}
+
+	for _, tt := range []struct {
+		yaml string
+		want string
+	}{
+		{"mail:\n  driver: sendmail\n", "mail.driver"},
+		{"mail:\n  driver: console\n", "mail.from"},
+		{"mail:\n  template_dir: /nonexistent/moon-templates\n", "mail.template_dir"},
+	} {
+		_, err := LoadConfig(writeTempConfig(t, minimalValidYAML(t)+tt.yaml))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("expected %s error, got %v", tt.want, err)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ---------------------------------------------------------------------------
+// Database availability
+//
+// A database that is briefly unreachable should not take Moon down. At
+// startup the first connection is retried with backoff. While serving, a
+// DBHealth pings the database in the background, and a request that fails
+// while the database does not answer gets 503 instead of 500, so clients
+// know to retry. The connection pool replaces broken connections on its
+// own once the database is back.
+// ---------------------------------------------------------------------------
+
+// ConnectDatabase opens the configured database and waits until it
+// answers a ping. A database that does not answer is retried up to
+// cfg.ConnectRetries times with jittered exponential backoff; the last
+// ping error is returned when every attempt fails or ctx is done. Read
+// replicas are then opened with ConnectReplicas.
+func ConnectDatabase(ctx context.Context, cfg DatabaseConfig, logger *Logger) (DatabaseAdapter, error) {
+	adapter, err := NewDatabaseAdapter(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	for attempt := 1; ; attempt++ {
+		err := adapter.Ping(ctx)
+		if err == nil {
+			if attempt > 1 {
+				logger.Info("database connected", "attempts", attempt)
+			}
+			return ConnectReplicas(ctx, adapter, cfg, logger)
+		}
+		if attempt > cfg.ConnectRetries {
+			adapter.Close()
+			return nil, err
+		}
+		delay := connectRetryDelay(attempt, cfg.ConnectMaxDelay)
+		logger.Warn("database not reachable; retrying",
+			"error", err,
+			"attempt", attempt,
+			"retry_in_ms", delay.Milliseconds(),
+		)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			adapter.Close()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+}
+
+// connectRetryDelay returns the delay before retry attempt, counting from
+// 1: between half and all of DBConnectBaseDelayMs * 2^(attempt-1)
+// milliseconds, capped at maxDelay seconds.
+func connectRetryDelay(attempt, maxDelay int) time.Duration {
+	ceiling := time.Duration(DBConnectBaseDelayMs) * time.Millisecond
+	limit := time.Duration(maxDelay) * time.Second
+	for i := 1; i < attempt && ceiling < limit; i++ {
+		ceiling *= 2
+	}
+	ceiling = min(ceiling, limit)
+	half := ceiling / 2
+	return half + time.Duration(rand.Int64N(int64(ceiling-half)+1))
+}
+
+// DBHealth tracks whether the database answers pings.
+type DBHealth struct {
+	db     DatabaseAdapter
+	logger *Logger
+
+	down      atomic.Bool
+	lastCheck atomic.Int64 // unix nanoseconds of the last ping
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewDBHealth creates a DBHealth for db, which starts out available.
+func NewDBHealth(db DatabaseAdapter, logger *Logger) *DBHealth {
+	return &DBHealth{db: db, logger: logger, stop: make(chan struct{})}
+}
+
+// Start pings the database every interval seconds until Close. An
+// interval of 0 starts nothing; failed requests still check the database.
+func (h *DBHealth) Start(interval int) {
+	if interval <= 0 {
+		return
+	}
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-h.stop:
+				return
+			case <-ticker.C:
+				h.check(context.Background())
+			}
+		}
+	}()
+}
+
+// Close stops the background pings.
+func (h *DBHealth) Close() {
+	h.stopOnce.Do(func() { close(h.stop) })
+	h.wg.Wait()
+}
+
+// Available reports whether the database answered the last ping.
+func (h *DBHealth) Available() bool {
+	return !h.down.Load()
+}
+
+// check pings the database within DBHealthPingTimeoutSeconds and records
+// the result, logging when availability changes. It reports whether the
+// database answered.
+func (h *DBHealth) check(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), DBHealthPingTimeoutSeconds*time.Second)
+	defer cancel()
+	err := h.db.Ping(ctx)
+	h.lastCheck.Store(time.Now().UnixNano())
+	if err != nil {
+		if !h.down.Swap(true) {
+			h.logger.Error("database unavailable", "error", err)
+		}
+		return false
+	}
+	if h.down.Swap(false) {
+		h.logger.Info("database available again")
+	}
+	return true
+}
+
+// confirmAvailable reports whether the database is available after a
+// request failed. An available database is pinged to confirm it; one
+// already marked unavailable is pinged again only once
+// DBUnavailableRecheckMs have passed since the last ping.
+func (h *DBHealth) confirmAvailable(ctx context.Context) bool {
+	if h.down.Load() {
+		since := time.Since(time.Unix(0, h.lastCheck.Load()))
+		if since < DBUnavailableRecheckMs*time.Millisecond {
+			return false
+		}
+	}
+	return h.check(ctx)
+}
+
+// Middleware replaces a 500 response with 503 and Retry-After when the
+// database does not answer, since the failure is then most likely the
+// database and not the request.
+func (h *DBHealth) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&dbHealthWriter{ResponseWriter: w, health: h, ctx: r.Context()}, r)
+	})
+}
+
+// dbHealthWriter checks the database when the handler writes a 500 and,
+// if it does not answer, writes a 503 and discards the handler's body.
+type dbHealthWriter struct {
+	http.ResponseWriter
+	health *DBHealth
+	ctx    context.Context
+
+	wroteHeader bool
+	replaced    bool
+}
+
+func (d *dbHealthWriter) WriteHeader(status int) {
+	if d.wroteHeader {
+		return
+	}
+	if status >= 100 && status < http.StatusOK {
+		d.ResponseWriter.WriteHeader(status)
+		return
+	}
+	d.wroteHeader = true
+	if status == http.StatusInternalServerError && !d.health.confirmAvailable(d.ctx) {
+		d.replaced = true
+		d.Header().Set("Retry-After", strconv.Itoa(DBUnavailableRetryAfterSeconds))
+		WriteErrorCode(d.ResponseWriter, http.StatusServiceUnavailable, ErrCodeDatabaseUnavailable, "Database unavailable")
+		return
+	}
+	d.ResponseWriter.WriteHeader(status)
+}
+
+func (d *dbHealthWriter) Write(p []byte) (int, error) {
+	if !d.wroteHeader {
+		d.WriteHeader(http.StatusOK)
+	}
+	if d.replaced {
+		return len(p), nil
+	}
+	return d.ResponseWriter.Write(p)
+}
+
+// Flush sends what has been written so far.
+func (d *dbHealthWriter) Flush() {
+	if f, ok := d.ResponseWriter.(http.Flusher); ok && !d.replaced {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (d *dbHealthWriter) Unwrap() http.ResponseWriter {
+	return d.ResponseWriter
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// pingAdapter is a DatabaseAdapter whose Ping fails while down is set.
+type pingAdapter struct {
+	DatabaseAdapter
+	down  atomic.Bool
+	pings atomic.Int64
+}
+
+func (a *pingAdapter) Ping(ctx context.Context) error {
+	a.pings.Add(1)
+	if a.down.Load() {
+		return newAdapterError("Ping", "", "database unreachable", errors.New("dial tcp 127.0.0.1:3306: connect: connection refused"))
+	}
+	return nil
+}
+
+func TestDBErrorKind_Unavailable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{driver.ErrBadConn, true},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connect: connection refused")}, true},
+		{errors.New("[mysql] invalid connection"), true},
+		{errors.New("FATAL: the database system is starting up (SQLSTATE 57P03)"), true},
+		{&mysql.MySQLError{Number: 1040, Message: "Too many connections"}, true},
+		{errors.New("UNIQUE constraint failed: products.title"), false},
+		{errors.New("database is locked"), false},
+	}
+	for _, tt := range tests {
+		err := newAdapterError("QueryRows", "products", "query failed", tt.err)
+		if got := errors.Is(err, ErrUnavailable); got != tt.want {
+			t.Errorf("errors.Is(%v, ErrUnavailable) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+
+	status, msg := dbErrorResponse(newAdapterError("QueryRows", "products", "query failed", driver.ErrBadConn))
+	if status != http.StatusServiceUnavailable || msg != "Database unavailable" {
+		t.Fatalf("dbErrorResponse: got %d %q", status, msg)
+	}
+}
+
+func TestWriteDBError_UnavailableSetsRetryAfter(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeDBError(w, newAdapterError("InsertRow", "products", "insert failed", driver.ErrBadConn))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Fatal("expected Retry-After")
+	}
+}
+
+func TestConnectRetryDelay(t *testing.T) {
+	for attempt := 1; attempt <= 12; attempt++ {
+		ceiling := min(time.Duration(DBConnectBaseDelayMs)*time.Millisecond<<(attempt-1), 4*time.Second)
+		d := connectRetryDelay(attempt, 4)
+		if d < ceiling/2 || d > ceiling {
+			t.Errorf("attempt %d: delay %v outside [%v, %v]", attempt, d, ceiling/2, ceiling)
+		}
+	}
+}
+
+func TestConnectDatabase_SQLite(t *testing.T) {
+	cfg := DatabaseConfig{
+		Connection:         DBConnectionSQLite,
+		Database:           ":memory:",
+		QueryTimeout:       5,
+		SlowQueryThreshold: 500,
+		ConnectMaxDelay:    1,
+	}
+	adapter, err := ConnectDatabase(context.Background(), cfg, NewTestLogger(&bytes.Buffer{}))
+	if err != nil {
+		t.Fatalf("ConnectDatabase: %v", err)
+	}
+	adapter.Close()
+}
+
+func TestConnectDatabase_GivesUp(t *testing.T) {
+	logBuf := &bytes.Buffer{}
+	cfg := DatabaseConfig{
+		Connection:      DBConnectionPostgres,
+		QueryTimeout:    5,
+		ConnectRetries:  1,
+		ConnectMaxDelay: 1,
+	}
+	start := time.Now()
+	if _, err := ConnectDatabase(context.Background(), cfg, NewTestLogger(logBuf)); err == nil {
+		t.Fatal("expected an error from a database that never answers")
+	}
+	if elapsed := time.Since(start); elapsed < DBConnectBaseDelayMs/2*time.Millisecond {
+		t.Fatalf("expected one backoff delay before giving up, took %v", elapsed)
+	}
+	if !bytes.Contains(logBuf.Bytes(), []byte("retrying")) {
+		t.Fatalf("expected the retry to be logged, got %s", logBuf.String())
+	}
+}
+
+func TestConnectDatabase_StopsWithContext(t *testing.T) {
+	cfg := DatabaseConfig{
+		Connection:      DBConnectionPostgres,
+		QueryTimeout:    5,
+		ConnectRetries:  100,
+		ConnectMaxDelay: 30,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := ConnectDatabase(ctx, cfg, NewTestLogger(&bytes.Buffer{})); err == nil {
+		t.Fatal("expected an error")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("expected the context to end the retries, took %v", elapsed)
+	}
+}
+
+func TestDBHealthMiddleware(t *testing.T) {
+	db := &pingAdapter{}
+	health := NewDBHealth(db, NewTestLogger(&bytes.Buffer{}))
+	status := http.StatusInternalServerError
+	handler := health.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteError(w, status, "Failed to load records")
+	}))
+	serve := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/data/products:query", nil))
+		return w
+	}
+
+	// A 500 while the database answers is left alone.
+	if w := serve(); w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500 while the database answers, got %d", w.Code)
+	}
+
+	db.down.Store(true)
+	w := serve()
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 while the database is down, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Fatal("expected Retry-After")
+	}
+	if resp := decodeResponse(t, w); resp["message"] != "Database unavailable" {
+		t.Fatalf("unexpected body: %v", resp)
+	}
+	if health.Available() {
+		t.Fatal("expected the database to be marked unavailable")
+	}
+
+	// While marked down, failures do not ping again until the recheck delay.
+	pings := db.pings.Load()
+	serve()
+	if db.pings.Load() != pings {
+		t.Fatal("expected no ping within the recheck delay")
+	}
+
+	// Other statuses pass through without a ping.
+	status = http.StatusNotFound
+	if w := serve(); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+
+	db.down.Store(false)
+	if !health.check(context.Background()) || !health.Available() {
+		t.Fatal("expected the database to be available again")
+	}
+}
+
+func TestDBHealth_BackgroundPings(t *testing.T) {
+	db := &pingAdapter{}
+	health := NewDBHealth(db, NewTestLogger(&bytes.Buffer{}))
+	health.Start(1)
+	defer health.Close()
+
+	db.down.Store(true)
+	deadline := time.Now().Add(3 * time.Second)
+	for health.Available() && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if health.Available() {
+		t.Fatal("expected a background ping to mark the database unavailable")
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// decimalPattern matches the accepted text form of a decimal: an optional
+// minus sign, digits, and an optional fraction. Exponents, plus signs, and
+// group separators are rejected.
+var decimalPattern = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// decimalTypePattern matches a declared NUMERIC(p) or NUMERIC(p,s) column
+// type, and the DECIMAL spelling used by MySQL.
+var decimalTypePattern = regexp.MustCompile(`(?i)^(?:NUMERIC|DECIMAL)\s*\(\s*(\d+)\s*(?:,\s*(\d+)\s*)?\)$`)
+
+// normalizeDecimal returns the canonical text of a decimal JSON value: no
+// leading zeros in the integer part, no trailing zeros in the fraction,
+// and no minus sign on zero. ok is false when value is not a string in
+// decimal form or a finite number.
+func normalizeDecimal(value any) (string, bool) {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "", false
+		}
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return "", false
+	}
+	if !decimalPattern.MatchString(s) {
+		return "", false
+	}
+
+	neg := strings.HasPrefix(s, "-")
+	intPart, frac, _ := strings.Cut(strings.TrimPrefix(s, "-"), ".")
+	intPart = strings.TrimLeft(intPart, "0")
+	frac = strings.TrimRight(frac, "0")
+	if intPart == "" {
+		intPart = "0"
+	}
+	out := intPart
+	if frac != "" {
+		out += "." + frac
+	}
+	if neg && out != "0" {
+		out = "-" + out
+	}
+	return out, true
+}
+
+// decimalDigits returns the number of integer and fractional digits of a
+// canonical decimal. A zero integer part counts as no integer digits.
+func decimalDigits(canonical string) (intDigits, fracDigits int) {
+	intPart, frac, _ := strings.Cut(strings.TrimPrefix(canonical, "-"), ".")
+	if intPart != "0" {
+		intDigits = len(intPart)
+	}
+	return intDigits, len(frac)
+}
+
+// parseDecimalType returns the precision and scale declared by a column
+// type such as NUMERIC(10,2), or zeros for a type without them.
+func parseDecimalType(sqlType string) (precision, scale int) {
+	m := decimalTypePattern.FindStringSubmatch(strings.TrimSpace(sqlType))
+	if m == nil {
+		return 0, 0
+	}
+	precision, _ = strconv.Atoi(m[1])
+	if m[2] != "" {
+		scale, _ = strconv.Atoi(m[2])
+	}
+	return precision, scale
+}
+
+// decimalTypeSQL returns the SQLite column type of a decimal column with
+// the given precision and scale. Precision 0 means none was declared.
+func decimalTypeSQL(precision, scale int) string {
+	if precision == 0 {
+		return SQLiteTypeDecimal
+	}
+	return fmt.Sprintf("%s(%d,%d)", SQLiteTypeDecimal, precision, scale)
+}
+
+// checkDecimal validates a type-valid decimal value against the precision
+// and scale of f, or against DecimalMaxPrecision and DecimalMaxScale when
+// f declares none.
+func checkDecimal(f Field, value any) error {
+	canonical, ok := normalizeDecimal(value)
+	if !ok {
+		return fmt.Errorf("Invalid value for field '%s' of type '%s'", f.Name, f.Type)
+	}
+	precision, scale := f.Precision, f.Scale
+	if precision == 0 {
+		precision, scale = DecimalMaxPrecision, DecimalMaxScale
+	}
+	intDigits, fracDigits := decimalDigits(canonical)
+	if fracDigits > scale {
+		return fmt.Errorf("Field '%s' must have at most %d decimal places", f.Name, scale)
+	}
+	if f.Precision == 0 {
+		if intDigits+fracDigits > precision {
+			return fmt.Errorf("Field '%s' must have at most %d significant digits", f.Name, precision)
+		}
+	} else if intDigits > precision-scale {
+		return fmt.Errorf("Field '%s' must have at most %d digits before the decimal point", f.Name, precision-scale)
+	}
+	return nil
+}
+
+// formatDecimal renders a stored decimal with exactly scale fractional
+// digits. Values that already carry more digits are returned unchanged.
+func formatDecimal(value any, scale int) any {
+	s, ok := toDecimalString(value).(string)
+	if !ok {
+		return value
+	}
+	canonical, ok := normalizeDecimal(s)
+	if !ok {
+		return s
+	}
+	_, fracDigits := decimalDigits(canonical)
+	if fracDigits > scale {
+		return canonical
+	}
+	if fracDigits == 0 && scale > 0 {
+		canonical += "."
+	}
+	return canonical + strings.Repeat("0", scale-fracDigits)
+}
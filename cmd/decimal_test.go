@@ -0,0 +1,152 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeDecimal(t *testing.T) {
+	tests := []struct {
+		in   any
+		want string
+		ok   bool
+	}{
+		{"12.50", "12.5", true},
+		{"007", "7", true},
+		{"-0.00", "0", true},
+		{"-1.20", "-1.2", true},
+		{float64(29.99), "29.99", true},
+		{float64(1e20), "100000000000000000000", true},
+		{"1e5", "", false},
+		{"+1", "", false},
+		{".5", "", false},
+		{"1,000", "", false},
+		{int64(3), "", false},
+	}
+	for _, tt := range tests {
+		got, ok := normalizeDecimal(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("normalizeDecimal(%v) = (%q, %v), want (%q, %v)", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCheckDecimal(t *testing.T) {
+	money := Field{Name: "price", Type: MoonFieldTypeDecimal, Precision: 6, Scale: 2}
+	free := Field{Name: "ratio", Type: MoonFieldTypeDecimal}
+	tests := []struct {
+		f       Field
+		value   any
+		wantErr string
+	}{
+		{money, "9999.99", ""},
+		{money, "1.230", ""},
+		{money, "1.234", "at most 2 decimal places"},
+		{money, "10000", "at most 4 digits before"},
+		{money, float64(0.5), ""},
+		{free, "0.0000000001", ""},
+		{free, "0.00000000001", "at most 10 decimal places"},
+		{free, "1234567890.123456", "at most 15 significant digits"},
+		{free, "abc", "Invalid value"},
+	}
+	for _, tt := range tests {
+		err := checkDecimal(tt.f, tt.value)
+		if (tt.wantErr == "" && err != nil) || (tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr))) {
+			t.Errorf("checkDecimal(%s, %v) = %v, want %q", tt.f.Name, tt.value, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseDecimalType(t *testing.T) {
+	tests := []struct {
+		in              string
+		precision, scal int
+	}{
+		{"NUMERIC(10,2)", 10, 2},
+		{"decimal(19, 4)", 19, 4},
+		{"NUMERIC(8)", 8, 0},
+		{"NUMERIC", 0, 0},
+	}
+	for _, tt := range tests {
+		if p, s := parseDecimalType(tt.in); p != tt.precision || s != tt.scal {
+			t.Errorf("parseDecimalType(%q) = (%d, %d), want (%d, %d)", tt.in, p, s, tt.precision, tt.scal)
+		}
+	}
+}
+
+func TestFormatDecimal(t *testing.T) {
+	tests := []struct {
+		in    any
+		scale int
+		want  string
+	}{
+		{float64(9.5), 2, "9.50"},
+		{int64(100), 2, "100.00"},
+		{"3.14159", 2, "3.14159"},
+		{int64(7), 0, "7"},
+	}
+	for _, tt := range tests {
+		if got := formatDecimal(tt.in, tt.scale); got != tt.want {
+			t.Errorf("formatDecimal(%v, %d) = %v, want %q", tt.in, tt.scale, got, tt.want)
+		}
+	}
+}
+
+func TestDecimalColumn_EndToEnd(t *testing.T) {
+	adapter, registry, cfg, _ := setupCollectionTest(t)
+	ch := NewCollectionHandler(adapter, registry, cfg)
+	admin := adminIdentity()
+
+	create := `{"op":"create","data":[{"name":"products","columns":[{"name":"price","type":"decimal","precision":6,"scale":2}]}]}`
+	if w := doIndexRequest(ch, http.MethodPost, "/collections:mutate", create, admin); w.Code != http.StatusCreated {
+		t.Fatalf("create collection: %d %s", w.Code, w.Body.String())
+	}
+	bad := `{"op":"create","data":[{"name":"bad","columns":[{"name":"price","type":"decimal","precision":4,"scale":5}]}]}`
+	if w := doIndexRequest(ch, http.MethodPost, "/collections:mutate", bad, admin); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for scale above precision, got %d", w.Code)
+	}
+
+	mh := NewResourceMutateHandler(adapter, registry, cfg, nil)
+	for _, price := range []any{"9.5", float64(10.25), "100"} {
+		body := map[string]any{"op": "create", "data": []any{map[string]any{"price": price}}}
+		if w := doMutateRequest(t, mh, "products", body, admin); w.Code != http.StatusCreated {
+			t.Fatalf("create %v: %d %s", price, w.Code, w.Body.String())
+		}
+	}
+	body := map[string]any{"op": "create", "data": []any{map[string]any{"price": "1.234"}}}
+	if w := doMutateRequest(t, mh, "products", body, admin); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for too many decimal places, got %d", w.Code)
+	}
+
+	qh := NewResourceQueryHandler(adapter, registry, cfg)
+	w := httptest.NewRecorder()
+	qh.HandleQuery(w, makeQueryRequest("/data/products:query?price[gt]=9.75&sort=price"))
+	data := decodeResponse(t, w)["data"].([]any)
+	if len(data) != 2 || data[0].(map[string]any)["price"] != "10.25" || data[1].(map[string]any)["price"] != "100.00" {
+		t.Fatalf("unexpected gt result: %v", data)
+	}
+
+	w = httptest.NewRecorder()
+	qh.HandleQuery(w, makeQueryRequest("/data/products:query?price[lte]=9.5"))
+	data = decodeResponse(t, w)["data"].([]any)
+	if len(data) != 1 || data[0].(map[string]any)["price"] != "9.50" {
+		t.Fatalf("unexpected lte result: %v", data)
+	}
+
+	w = httptest.NewRecorder()
+	qh.HandleQuery(w, makeQueryRequest("/data/products:query?price[gt]=abc"))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a non-decimal filter value, got %d", w.Code)
+	}
+
+	sh := NewResourceSchemaHandler(registry, "")
+	sw := httptest.NewRecorder()
+	sh.HandleSchema(sw, httptest.NewRequest(http.MethodGet, "/data/products:schema", nil))
+	for _, f := range decodeResponse(t, sw)["data"].([]any)[0].(map[string]any)["fields"].([]any) {
+		if fd := f.(map[string]any); fd["name"] == "price" && (fd["precision"] != float64(6) || fd["scale"] != float64(2)) {
+			t.Errorf("expected precision 6 and scale 2 in :schema, got %v", fd)
+		}
+	}
+}
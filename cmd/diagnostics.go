@@ -0,0 +1,302 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Diagnostics holds the process-wide state reported by
+// GET /admin:diagnostics: the start time, the most recent server error
+// responses, and the response-time SLOs.
+type Diagnostics struct {
+	started time.Time
+	slo     *sloTracker // nil when slo.targets is empty
+
+	mu      sync.Mutex
+	samples []errorSample // ring buffer of DiagnosticsErrorSamples entries
+	next    int
+	total   int64
+}
+
+// errorSample is one recorded 5xx response.
+type errorSample struct {
+	Time      string `json:"time"`
+	RequestID string `json:"request_id"`
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	Status    int    `json:"status"`
+}
+
+// NewDiagnostics creates a Diagnostics that counts uptime from now.
+func NewDiagnostics() *Diagnostics {
+	return &Diagnostics{started: time.Now()}
+}
+
+// SetSLO starts tracking the response-time targets of cfg. at-risk targets
+// are reported to logger.
+func (d *Diagnostics) SetSLO(cfg SLOConfig, logger *Logger) {
+	d.slo = newSLOTracker(cfg, logger)
+}
+
+// recordError adds a sample, replacing the oldest once the buffer is full.
+func (d *Diagnostics) recordError(sample errorSample) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.total++
+	if len(d.samples) < DiagnosticsErrorSamples {
+		d.samples = append(d.samples, sample)
+		return
+	}
+	d.samples[d.next] = sample
+	d.next = (d.next + 1) % DiagnosticsErrorSamples
+}
+
+// recentErrors returns the total error count and the kept samples, newest
+// first.
+func (d *Diagnostics) recentErrors() (int64, []errorSample) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	result := make([]errorSample, 0, len(d.samples))
+	for i := len(d.samples) - 1; i >= 0; i-- {
+		result = append(result, d.samples[(d.next+i)%len(d.samples)])
+	}
+	return d.total, result
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Flush lets streaming handlers such as :export and pprof flush through
+// the recorder.
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// errorSampleMiddleware records every response with a 5xx status. It runs
+// outside panic recovery so that recovered panics are sampled too.
+func errorSampleMiddleware(d *Diagnostics, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status >= http.StatusInternalServerError {
+			d.recordError(errorSample{
+				Time:      time.Now().UTC().Format(time.RFC3339),
+				RequestID: w.Header().Get("X-Request-ID"),
+				Method:    r.Method,
+				Path:      r.URL.Path,
+				Status:    rec.status,
+			})
+		}
+	})
+}
+
+// cacheCounter counts hits and misses of an in-memory cache.
+type cacheCounter struct {
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+func (c *cacheCounter) record(hit bool) {
+	if hit {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+}
+
+// stats reports the counts and the hit rate, which is 0 before any lookup.
+func (c *cacheCounter) stats() map[string]any {
+	hits, misses := c.hits.Load(), c.misses.Load()
+	rate := 0.0
+	if hits+misses > 0 {
+		rate = float64(hits) / float64(hits+misses)
+	}
+	return map[string]any{"hits": hits, "misses": misses, "hit_rate": rate}
+}
+
+// poolStatser is implemented by adapters backed by a database/sql pool.
+type poolStatser interface {
+	PoolStats() sql.DBStats
+}
+
+// writeRetryStatser is implemented by adapters that retry transient write
+// failures.
+type writeRetryStatser interface {
+	WriteRetryStats() map[string]int64
+}
+
+// replicaStatser is implemented by adapters that read from replicas.
+type replicaStatser interface {
+	ReplicaStats() []map[string]any
+}
+
+// statementCacheStatser is implemented by adapters that cache prepared
+// statements.
+type statementCacheStatser interface {
+	StatementCacheStats() map[string]any
+}
+
+// AdminDiagnosticsHandler implements GET /admin:diagnostics.
+type AdminDiagnosticsHandler struct {
+	db          DatabaseAdapter
+	registry    *SchemaRegistry
+	permissions *PermissionStore
+	diag        *Diagnostics
+}
+
+// NewAdminDiagnosticsHandler creates an AdminDiagnosticsHandler. Any
+// dependency may be nil; its section is then reported as null.
+func NewAdminDiagnosticsHandler(db DatabaseAdapter, registry *SchemaRegistry, perms *PermissionStore, diag *Diagnostics) *AdminDiagnosticsHandler {
+	return &AdminDiagnosticsHandler{db: db, registry: registry, permissions: perms, diag: diag}
+}
+
+// HandleQuery reports build details, uptime, Go runtime statistics,
+// database pool statistics, cache counters, recent server errors, and
+// response-time SLOs.
+func (h *AdminDiagnosticsHandler) HandleQuery(w http.ResponseWriter, r *http.Request) {
+	identity, ok := GetAuthIdentity(r.Context())
+	if !ok {
+		WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if identity.Role != "admin" {
+		WriteError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	lastPause := time.Duration(0)
+	if mem.NumGC > 0 {
+		lastPause = time.Duration(mem.PauseNs[(mem.NumGC+255)%256])
+	}
+
+	data := map[string]any{
+		"build": buildInfo(h.registry),
+		"runtime": map[string]any{
+			"goroutines":        runtime.NumGoroutine(),
+			"num_cpu":           runtime.NumCPU(),
+			"gomaxprocs":        runtime.GOMAXPROCS(0),
+			"heap_alloc_bytes":  mem.HeapAlloc,
+			"heap_sys_bytes":    mem.HeapSys,
+			"heap_objects":      mem.HeapObjects,
+			"num_gc":            mem.NumGC,
+			"gc_pause_total_ms": time.Duration(mem.PauseTotalNs).Milliseconds(),
+			"gc_last_pause_ms":  float64(lastPause) / float64(time.Millisecond),
+			"gc_cpu_fraction":   mem.GCCPUFraction,
+		},
+		"database": nil,
+		"registry": nil,
+		"caches":   map[string]any{},
+		"errors":   nil,
+		"slo":      nil,
+	}
+
+	if h.diag != nil {
+		data["started_at"] = h.diag.started.UTC().Format(time.RFC3339)
+		data["uptime_seconds"] = int64(time.Since(h.diag.started).Seconds())
+		total, samples := h.diag.recentErrors()
+		data["errors"] = map[string]any{"total": total, "recent": samples}
+		if h.diag.slo != nil {
+			data["slo"] = map[string]any{
+				"objective":      h.diag.slo.objective,
+				"window_seconds": SLOWindowMinutes * 60,
+				"targets":        h.diag.slo.report(time.Now()),
+			}
+		}
+	}
+	if ps, ok := h.db.(poolStatser); ok {
+		stats := ps.PoolStats()
+		data["database"] = map[string]any{
+			"max_open_connections": stats.MaxOpenConnections,
+			"open_connections":     stats.OpenConnections,
+			"in_use":               stats.InUse,
+			"idle":                 stats.Idle,
+			"wait_count":           stats.WaitCount,
+			"wait_duration_ms":     stats.WaitDuration.Milliseconds(),
+		}
+		if rs, ok := h.db.(writeRetryStatser); ok {
+			data["database"].(map[string]any)["write_retries"] = rs.WriteRetryStats()
+		}
+		if rs, ok := h.db.(replicaStatser); ok {
+			if replicas := rs.ReplicaStats(); replicas != nil {
+				data["database"].(map[string]any)["replicas"] = replicas
+			}
+		}
+	}
+	caches := data["caches"].(map[string]any)
+	if h.registry != nil {
+		data["registry"] = map[string]any{"collections": len(h.registry.List())}
+		caches["schema_version"] = h.registry.versionCache.stats()
+	}
+	if h.permissions != nil {
+		caches["permissions"] = h.permissions.cache.stats()
+	}
+	if sc, ok := h.db.(statementCacheStatser); ok {
+		caches["statements"] = sc.StatementCacheStats()
+	}
+	if qc, ok := h.db.(*CachedAdapter); ok {
+		caches["query_results"] = qc.QueryResultCacheStats()
+	}
+
+	WriteSuccess(w, http.StatusOK, "Diagnostics retrieved successfully", []any{data})
+}
+
+// handlePprof serves the net/http/pprof profiles under
+// {prefix}/admin:pprof/. It is mounted only when server.pprof is true and
+// is limited to admins.
+func handlePprof(prefix string) http.HandlerFunc {
+	base := prefix + "/admin:pprof/"
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := GetAuthIdentity(r.Context())
+		if !ok {
+			WriteError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		if identity.Role != "admin" {
+			WriteError(w, http.StatusForbidden, "Forbidden")
+			return
+		}
+
+		switch name := strings.TrimPrefix(r.URL.Path, base); name {
+		case "cmdline":
+			pprof.Cmdline(w, r)
+		case "profile":
+			pprof.Profile(w, r)
+		case "symbol":
+			pprof.Symbol(w, r)
+		case "trace":
+			pprof.Trace(w, r)
+		default:
+			// pprof.Index looks profiles up by their path below /debug/pprof/.
+			r2 := r.Clone(r.Context())
+			r2.URL.Path = "/debug/pprof/" + name
+			pprof.Index(w, r2)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiagnostics_RecentErrors(t *testing.T) {
+	d := NewDiagnostics()
+	for i := 0; i < DiagnosticsErrorSamples+5; i++ {
+		d.recordError(errorSample{Path: fmt.Sprintf("/p%d", i), Status: 500})
+	}
+	total, samples := d.recentErrors()
+	if total != DiagnosticsErrorSamples+5 {
+		t.Fatalf("expected total %d, got %d", DiagnosticsErrorSamples+5, total)
+	}
+	if len(samples) != DiagnosticsErrorSamples {
+		t.Fatalf("expected %d samples, got %d", DiagnosticsErrorSamples, len(samples))
+	}
+	if want := fmt.Sprintf("/p%d", DiagnosticsErrorSamples+4); samples[0].Path != want {
+		t.Errorf("expected newest sample %s first, got %s", want, samples[0].Path)
+	}
+	if samples[len(samples)-1].Path != "/p5" {
+		t.Errorf("expected oldest kept sample /p5 last, got %s", samples[len(samples)-1].Path)
+	}
+}
+
+func TestErrorSampleMiddleware(t *testing.T) {
+	d := NewDiagnostics()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /ok", func(w http.ResponseWriter, r *http.Request) {
+		WriteSuccess(w, http.StatusOK, "ok", nil)
+	})
+	mux.HandleFunc("GET /fail", func(w http.ResponseWriter, r *http.Request) {
+		WriteError(w, http.StatusServiceUnavailable, "Unavailable")
+	})
+	mux.HandleFunc("GET /panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	handler := BuildHandler(mux, defaultTestConfig(), NewTestLogger(&bytes.Buffer{}), WithDiagnostics(d))
+
+	for _, path := range []string{"/ok", "/fail", "/panic", "/missing"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	total, samples := d.recentErrors()
+	if total != 2 {
+		t.Fatalf("expected 2 recorded errors, got %d: %v", total, samples)
+	}
+	if samples[0].Path != "/panic" || samples[0].Status != http.StatusInternalServerError {
+		t.Errorf("unexpected panic sample: %+v", samples[0])
+	}
+	if samples[1].Path != "/fail" || samples[1].Status != http.StatusServiceUnavailable || samples[1].RequestID == "" {
+		t.Errorf("unexpected error sample: %+v", samples[1])
+	}
+}
+
+func TestAdminDiagnostics(t *testing.T) {
+	_, db, reg := setupResourceQueryTest(t)
+	d := NewDiagnostics()
+	d.recordError(errorSample{Path: "/data/products:query", Status: 500})
+	h := NewAdminDiagnosticsHandler(db, reg, nil, d)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin:diagnostics", nil)
+	w := httptest.NewRecorder()
+	h.HandleQuery(w, req.WithContext(SetAuthIdentity(context.Background(), userWriteIdentity())))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a non-admin, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	h.HandleQuery(w, req.WithContext(SetAuthIdentity(context.Background(), adminIdentity())))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	data := decodeResponse(t, w)["data"].([]any)[0].(map[string]any)
+
+	if rt := data["runtime"].(map[string]any); rt["goroutines"].(float64) < 1 {
+		t.Errorf("expected goroutine count, got %v", rt)
+	}
+	if db, _ := data["database"].(map[string]any); db == nil {
+		t.Error("expected pool statistics for the SQLite adapter")
+	} else if _, ok := db["write_retries"]; !ok {
+		t.Errorf("expected write retry counters, got %v", db)
+	}
+	if registry := data["registry"].(map[string]any); registry["collections"] != float64(len(reg.List())) {
+		t.Errorf("unexpected registry section: %v", registry)
+	}
+	if _, ok := data["caches"].(map[string]any)["schema_version"]; !ok {
+		t.Errorf("expected schema_version cache counters, got %v", data["caches"])
+	}
+	if errs := data["errors"].(map[string]any); errs["total"] != float64(1) {
+		t.Errorf("unexpected errors section: %v", errs)
+	}
+	if data["build"].(map[string]any)["moon"] != MoonVersion {
+		t.Errorf("unexpected build section: %v", data["build"])
+	}
+	if data["slo"] != nil {
+		t.Errorf("expected no slo section without targets, got %v", data["slo"])
+	}
+
+	d.SetSLO(SLOConfig{Objective: 0.99, Targets: map[string]int{"*:query": 100}}, nil)
+	d.slo.record("products:query", 20*time.Millisecond, time.Now())
+	w = httptest.NewRecorder()
+	h.HandleQuery(w, req.WithContext(SetAuthIdentity(context.Background(), adminIdentity())))
+	slo := decodeResponse(t, w)["data"].([]any)[0].(map[string]any)["slo"].(map[string]any)
+	targets := slo["targets"].([]any)
+	if len(targets) != 1 || targets[0].(map[string]any)["requests"] != float64(1) {
+		t.Errorf("unexpected slo section: %v", slo)
+	}
+}
+
+func TestPprofRoutes(t *testing.T) {
+	cfg := defaultTestConfig()
+	mux := http.NewServeMux()
+	RegisterDiagnosticsRoutes(mux, cfg, nil, nil, nil, NewDiagnostics())
+	req := httptest.NewRequest(http.MethodGet, "/admin:pprof/", nil)
+	req = req.WithContext(SetAuthIdentity(context.Background(), adminIdentity()))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 with server.pprof off, got %d", w.Code)
+	}
+
+	cfg.Server.Pprof = true
+	mux = http.NewServeMux()
+	RegisterDiagnosticsRoutes(mux, cfg, nil, nil, nil, NewDiagnostics())
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "goroutine") {
+		t.Fatalf("expected the pprof index, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/admin:pprof/goroutine?debug=1", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req.WithContext(SetAuthIdentity(context.Background(), adminIdentity())))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "goroutine profile") {
+		t.Fatalf("expected the goroutine profile, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req.WithContext(SetAuthIdentity(context.Background(), userWriteIdentity())))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a non-admin, got %d", w.Code)
+	}
+}
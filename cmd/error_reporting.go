@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrorReport describes a panic recovered while serving a request.
+type ErrorReport struct {
+	Time      time.Time
+	RequestID string
+	Method    string
+	Path      string
+	Message   string
+	// Stack lists the frames of the panicking goroutine, innermost first.
+	Stack []StackFrame
+}
+
+// StackFrame is one call in an ErrorReport stack.
+type StackFrame struct {
+	Function string
+	File     string
+	Line     int
+}
+
+// String formats the frame as "function (file:line)".
+func (f StackFrame) String() string {
+	return fmt.Sprintf("%s (%s:%d)", f.Function, f.File, f.Line)
+}
+
+// ErrorReporter receives the panics recovered by panicRecoveryMiddleware.
+// Report is called on the request goroutine after the 500 response has been
+// written, so implementations must not block.
+type ErrorReporter interface {
+	Report(report ErrorReport)
+}
+
+// panicStack returns the stack of the panicking goroutine, starting at the
+// frame that panicked. It must be called from the deferred function that
+// recovered the panic.
+func panicStack() []StackFrame {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var all []StackFrame
+	start := 0
+	for {
+		f, more := frames.Next()
+		all = append(all, StackFrame{Function: f.Function, File: f.File, Line: f.Line})
+		if f.Function == "runtime.gopanic" {
+			start = len(all)
+		}
+		if !more {
+			break
+		}
+	}
+	// Runtime errors such as a nil dereference enter gopanic through
+	// runtime helpers; skip those so the stack starts in our code.
+	for start < len(all) && strings.HasPrefix(all[start].Function, "runtime.") {
+		start++
+	}
+	if start == len(all) {
+		return all
+	}
+	return all[start:]
+}
+
+// ---------------------------------------------------------------------------
+// Sentry
+// ---------------------------------------------------------------------------
+
+// SentryReporter sends recovered panics to a Sentry-compatible server as
+// events in the envelope format. Reports are queued and delivered by one
+// background goroutine; when the queue is full new reports are dropped.
+type SentryReporter struct {
+	dsn         string
+	endpoint    string
+	auth        string
+	environment string
+	serverName  string
+	client      *http.Client
+	logger      *Logger
+	queue       chan ErrorReport
+	stop        chan struct{}
+	done        chan struct{}
+	once        sync.Once
+}
+
+// NewSentryReporter creates a SentryReporter for dsn and starts its
+// delivery goroutine. environment may be empty. logger may be nil.
+func NewSentryReporter(dsn, environment string, logger *Logger) (*SentryReporter, error) {
+	endpoint, key, err := parseSentryDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	s := &SentryReporter{
+		dsn:         dsn,
+		endpoint:    endpoint,
+		auth:        fmt.Sprintf("Sentry sentry_version=7, sentry_client=moon/%s, sentry_key=%s", MoonVersion, key),
+		environment: environment,
+		serverName:  host,
+		client:      &http.Client{Timeout: ErrorReportTimeoutSeconds * time.Second},
+		logger:      logger,
+		queue:       make(chan ErrorReport, ErrorReportQueueSize),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+// Report queues report for delivery. Reports made after Close are dropped.
+func (s *SentryReporter) Report(report ErrorReport) {
+	select {
+	case <-s.stop:
+		return
+	default:
+	}
+	select {
+	case s.queue <- report:
+	default:
+		if s.logger != nil {
+			s.logger.Warn("error report dropped: queue full", "request_id", report.RequestID)
+		}
+	}
+}
+
+// Close delivers the reports still queued and stops the delivery
+// goroutine.
+func (s *SentryReporter) Close() {
+	s.once.Do(func() { close(s.stop) })
+	<-s.done
+}
+
+func (s *SentryReporter) run() {
+	defer close(s.done)
+	for {
+		select {
+		case report := <-s.queue:
+			s.deliver(report)
+		case <-s.stop:
+			for {
+				select {
+				case report := <-s.queue:
+					s.deliver(report)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *SentryReporter) deliver(report ErrorReport) {
+	if err := s.send(report); err != nil && s.logger != nil {
+		s.logger.Warn("error report not delivered", "request_id", report.RequestID, "error", err.Error())
+	}
+}
+
+// send posts one report as a Sentry envelope holding a single event.
+func (s *SentryReporter) send(report ErrorReport) error {
+	body, err := s.envelope(report)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ErrorReportTimeoutSeconds*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", s.auth)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("sentry returned %s", resp.Status)
+	}
+	return nil
+}
+
+// envelope encodes report as an envelope header, an item header, and the
+// event payload, one JSON document per line.
+func (s *SentryReporter) envelope(report ErrorReport) ([]byte, error) {
+	eventID := newSentryEventID()
+
+	// Sentry lists frames outermost first.
+	frames := make([]map[string]any, 0, len(report.Stack))
+	for i := len(report.Stack) - 1; i >= 0; i-- {
+		f := report.Stack[i]
+		frames = append(frames, map[string]any{
+			"function": f.Function,
+			"filename": filepath.Base(f.File),
+			"abs_path": f.File,
+			"lineno":   f.Line,
+			"in_app":   strings.HasPrefix(f.Function, "main."),
+		})
+	}
+	event := map[string]any{
+		"event_id":    eventID,
+		"timestamp":   report.Time.UTC().Format(time.RFC3339Nano),
+		"platform":    "go",
+		"level":       "fatal",
+		"logger":      "moon",
+		"server_name": s.serverName,
+		"release":     "moon@" + MoonVersion,
+		"exception": map[string]any{"values": []any{map[string]any{
+			"type":       "panic",
+			"value":      report.Message,
+			"mechanism":  map[string]any{"type": "panic", "handled": false},
+			"stacktrace": map[string]any{"frames": frames},
+		}}},
+		"request": map[string]any{"method": report.Method, "url": report.Path},
+		"tags":    map[string]any{"request_id": report.RequestID},
+	}
+	if s.environment != "" {
+		event["environment"] = s.environment
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, doc := range []any{
+		map[string]any{"event_id": eventID, "dsn": s.dsn, "sent_at": time.Now().UTC().Format(time.RFC3339)},
+		map[string]any{"type": "event"},
+		event,
+	} {
+		if err := enc.Encode(doc); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// parseSentryDSN splits a DSN of the form
+// https://<public_key>@<host>[/<path>]/<project_id> into the envelope
+// endpoint and the public key.
+func parseSentryDSN(dsn string) (endpoint, key string, err error) {
+	u, err := url.Parse(dsn)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", "", fmt.Errorf("invalid Sentry DSN: must be an http or https URL")
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return "", "", fmt.Errorf("invalid Sentry DSN: missing public key")
+	}
+	path := strings.TrimRight(u.Path, "/")
+	idx := strings.LastIndex(path, "/")
+	project := path[idx+1:]
+	if project == "" {
+		return "", "", fmt.Errorf("invalid Sentry DSN: missing project id")
+	}
+	endpoint = fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, path[:idx], project)
+	return endpoint, u.User.Username(), nil
+}
+
+// newSentryEventID returns a random 32-character hex event id.
+func newSentryEventID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// captureReporter records the reports it receives.
+type captureReporter struct {
+	reports []ErrorReport
+}
+
+func (c *captureReporter) Report(report ErrorReport) {
+	c.reports = append(c.reports, report)
+}
+
+func panickingRecordHandler(w http.ResponseWriter, r *http.Request) {
+	var record map[string]any
+	_ = record["title"].(string)
+}
+
+func TestPanicRecovery_ReportsError(t *testing.T) {
+	var logs bytes.Buffer
+	reporter := &captureReporter{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /panic-test", panickingRecordHandler)
+	handler := BuildHandler(mux, defaultTestConfig(), NewTestLogger(&logs), WithErrorReporter(reporter))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic-test", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", w.Code)
+	}
+	requestID := w.Header().Get("X-Request-ID")
+	if requestID == "" {
+		t.Fatal("expected X-Request-ID on the 500 response")
+	}
+	if len(reporter.reports) != 1 {
+		t.Fatalf("expected 1 report, got %d", len(reporter.reports))
+	}
+	report := reporter.reports[0]
+	if report.RequestID != requestID || report.Method != http.MethodGet || report.Path != "/panic-test" {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if len(report.Stack) == 0 || !strings.HasSuffix(report.Stack[0].Function, "panickingRecordHandler") {
+		t.Errorf("expected stack to start at the panicking handler, got %v", report.Stack)
+	}
+	if !strings.Contains(logs.String(), requestID) || !strings.Contains(logs.String(), "panickingRecordHandler") {
+		t.Errorf("expected panic log with request ID and stack, got %s", logs.String())
+	}
+}
+
+func TestPanicRecovery_AbortHandler(t *testing.T) {
+	reporter := &captureReporter{}
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+	handler := panicRecoveryMiddleware(middlewareTestLogger(), reporter, inner)
+
+	defer func() {
+		if rec := recover(); rec != http.ErrAbortHandler {
+			t.Fatalf("expected ErrAbortHandler to be re-panicked, got %v", rec)
+		}
+		if len(reporter.reports) != 0 {
+			t.Errorf("expected no report for an aborted response, got %d", len(reporter.reports))
+		}
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+func TestParseSentryDSN(t *testing.T) {
+	tests := []struct {
+		dsn      string
+		endpoint string
+		key      string
+		wantErr  bool
+	}{
+		{"https://abc@o1.ingest.sentry.io/42", "https://o1.ingest.sentry.io/api/42/envelope/", "abc", false},
+		{"http://abc@localhost:9000/sentry/7", "http://localhost:9000/sentry/api/7/envelope/", "abc", false},
+		{"https://o1.ingest.sentry.io/42", "", "", true},
+		{"https://abc@o1.ingest.sentry.io/", "", "", true},
+		{"ftp://abc@example.com/42", "", "", true},
+	}
+	for _, tt := range tests {
+		endpoint, key, err := parseSentryDSN(tt.dsn)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.dsn, err, tt.wantErr)
+			continue
+		}
+		if endpoint != tt.endpoint || key != tt.key {
+			t.Errorf("%s: got (%q, %q), want (%q, %q)", tt.dsn, endpoint, key, tt.endpoint, tt.key)
+		}
+	}
+}
+
+func TestSentryReporter_Send(t *testing.T) {
+	type delivery struct {
+		path, auth string
+		body       []byte
+	}
+	received := make(chan delivery, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- delivery{r.URL.Path, r.Header.Get("X-Sentry-Auth"), body}
+	}))
+	defer srv.Close()
+
+	dsn := strings.Replace(srv.URL, "://", "://pubkey@", 1) + "/42"
+	reporter, err := NewSentryReporter(dsn, "test", nil)
+	if err != nil {
+		t.Fatalf("NewSentryReporter: %v", err)
+	}
+	reporter.Report(ErrorReport{
+		Time:      time.Now(),
+		RequestID: "01REQUEST0000000000000000",
+		Method:    http.MethodPost,
+		Path:      "/data/products:mutate",
+		Message:   "boom",
+		Stack:     []StackFrame{{Function: "main.inner", File: "/src/a.go", Line: 10}, {Function: "main.outer", File: "/src/b.go", Line: 20}},
+	})
+
+	var got delivery
+	select {
+	case got = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the report")
+	}
+	if got.path != "/api/42/envelope/" || !strings.Contains(got.auth, "sentry_key=pubkey") {
+		t.Fatalf("unexpected delivery to %s with auth %q", got.path, got.auth)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(got.body))
+	var lines []map[string]any
+	for scanner.Scan() {
+		var doc map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &doc); err != nil {
+			t.Fatalf("decode envelope line: %v", err)
+		}
+		lines = append(lines, doc)
+	}
+	if len(lines) != 3 || lines[1]["type"] != "event" {
+		t.Fatalf("unexpected envelope %s", got.body)
+	}
+	event := lines[2]
+	if event["event_id"] != lines[0]["event_id"] || event["environment"] != "test" {
+		t.Errorf("unexpected event %v", event)
+	}
+	if tags := event["tags"].(map[string]any); tags["request_id"] != "01REQUEST0000000000000000" {
+		t.Errorf("expected request_id tag, got %v", tags)
+	}
+	exc := event["exception"].(map[string]any)["values"].([]any)[0].(map[string]any)
+	frames := exc["stacktrace"].(map[string]any)["frames"].([]any)
+	if exc["value"] != "boom" || len(frames) != 2 || frames[1].(map[string]any)["function"] != "main.inner" {
+		t.Errorf("unexpected exception %v", exc)
+	}
+}
+
+func TestSentryReporter_CloseDeliversQueuedReports(t *testing.T) {
+	var mu sync.Mutex
+	delivered := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		delivered++
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	reporter, err := NewSentryReporter(strings.Replace(srv.URL, "://", "://pubkey@", 1)+"/42", "", nil)
+	if err != nil {
+		t.Fatalf("NewSentryReporter: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		reporter.Report(ErrorReport{Time: time.Now(), Message: "boom"})
+	}
+	reporter.Close()
+	reporter.Report(ErrorReport{Time: time.Now(), Message: "after close"})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if delivered != 3 {
+		t.Fatalf("expected 3 reports delivered before Close returned, got %d", delivered)
+	}
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
+	"runtime"
+	"runtime/debug"
 	"time"
 )
 
@@ -27,12 +30,75 @@ func handleHealth(w http.ResponseWriter, r *http.Request) {
 	WriteJSON(w, http.StatusOK, resp)
 }
 
+// handleTextFile returns a handler that serves body as text/plain.
+func handleTextFile(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(body))
+	}
+}
+
+// handleJWKS serves the public keys that verify access tokens as a JSON
+// Web Key Set. Like /openapi.json it is written without the response
+// envelope, as external verifiers expect.
+func handleJWKS(keys *TokenKeys) http.HandlerFunc {
+	body := keys.JWKS()
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", JWKSCacheMaxAge))
+		WriteJSON(w, http.StatusOK, body)
+	}
+}
+
+// handleVersion returns build details for the running binary and the
+// schema version this instance last published or synced.
+func handleVersion(reg *SchemaRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		WriteSuccess(w, http.StatusOK, "Version retrieved successfully", []any{buildInfo(reg)})
+	}
+}
+
+// buildInfo describes the running binary. Revision fields are empty when
+// the binary was built without VCS information. reg may be nil.
+func buildInfo(reg *SchemaRegistry) map[string]any {
+	data := map[string]any{
+		"moon":           MoonVersion,
+		"go":             runtime.Version(),
+		"revision":       "",
+		"revision_time":  "",
+		"modified":       false,
+		"schema_version": "",
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				data["revision"] = setting.Value
+			case "vcs.time":
+				data["revision_time"] = setting.Value
+			case "vcs.modified":
+				data["modified"] = setting.Value == "true"
+			}
+		}
+	}
+	if reg != nil {
+		data["schema_version"] = reg.Version()
+		data["schema_version_pending"] = reg.PublishPending()
+	}
+	return data
+}
+
 // newAuthSessionHandler creates the AuthSessionHandler with its dependencies.
 // logger and rl may be nil; rate limiting is skipped when rl is nil.
 func newAuthSessionHandler(db DatabaseAdapter, cfg *AppConfig, logger *Logger, rl *RateLimiter) *AuthSessionHandler {
 	return &AuthSessionHandler{db: db, cfg: cfg, logger: logger, rateLimiter: rl}
 }
 
+// handleNotImplemented answers routes whose dependencies are not configured.
+func handleNotImplemented(w http.ResponseWriter, r *http.Request) {
+	WriteError(w, http.StatusNotImplemented, "Not implemented")
+}
+
 // handleCollectionsQuery is a stub for GET /collections:query.
 func handleCollectionsQuery(w http.ResponseWriter, r *http.Request) {
 	WriteError(w, http.StatusNotImplemented, "Not implemented")
@@ -43,6 +109,11 @@ func handleCollectionsMutate(w http.ResponseWriter, r *http.Request) {
 	WriteError(w, http.StatusNotImplemented, "Not implemented")
 }
 
+// handleCollectionsRefresh is a stub for POST /collections:refresh.
+func handleCollectionsRefresh(w http.ResponseWriter, r *http.Request) {
+	WriteError(w, http.StatusNotImplemented, "Not implemented")
+}
+
 // handleResourceQuery is a stub for GET /data/{resource}:query.
 func handleResourceQuery(w http.ResponseWriter, r *http.Request) {
 	resource := extractResource(r.URL.Path)
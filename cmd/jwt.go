@@ -1,35 +1,20 @@
 package main
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"time"
-
-	"github.com/golang-jwt/jwt/v5"
 )
 
-// CreateAccessToken signs a JWT with the standard Moon claims.
+// CreateAccessToken signs a JWT with the standard Moon claims using HS256
+// and secret.
 func CreateAccessToken(userID, jti, role string, canWrite bool, secret string, expirySeconds int) (string, time.Time, error) {
-	now := time.Now().UTC()
-	exp := now.Add(time.Duration(expirySeconds) * time.Second)
-
-	claims := jwt.MapClaims{
-		"sub":       userID,
-		"jti":       jti,
-		"role":      role,
-		"can_write": canWrite,
-		"exp":       exp.Unix(),
-		"iat":       now.Unix(),
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signed, err := token.SignedString([]byte(secret))
-	if err != nil {
-		return "", time.Time{}, fmt.Errorf("sign jwt: %w", err)
-	}
-	return signed, exp, nil
+	return NewHMACTokenKeys(secret).CreateAccessToken(userID, jti, role, canWrite, expirySeconds)
 }
 
 // GenerateRefreshToken creates a cryptographically random refresh token
@@ -50,3 +35,50 @@ func HashRefreshToken(raw string) string {
 	h := sha256.Sum256([]byte(raw))
 	return fmt.Sprintf("%x", h)
 }
+
+// errSealedValue reports a sealed value that cannot be opened, usually
+// because jwt_secret changed after it was sealed.
+var errSealedValue = errors.New("sealed value cannot be opened")
+
+// secretCipher returns the AES-GCM cipher for values sealed for purpose.
+// Its key is derived from jwt_secret and purpose, so a value sealed for one
+// purpose cannot be opened as another.
+func secretCipher(jwtSecret, purpose string) (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte("moon-" + purpose + "\x00" + jwtSecret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealSecret encrypts and authenticates data for purpose, returning it
+// base64-encoded.
+func sealSecret(jwtSecret, purpose string, data []byte) (string, error) {
+	aead, err := secretCipher(jwtSecret, purpose)
+	if err != nil {
+		return "", fmt.Errorf("seal %s: %w", purpose, err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("seal %s: %w", purpose, err)
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, data, nil)), nil
+}
+
+// openSecret returns the data of a value sealed by sealSecret for purpose.
+func openSecret(jwtSecret, purpose, sealed string) ([]byte, error) {
+	aead, err := secretCipher(jwtSecret, purpose)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(raw) < aead.NonceSize() {
+		return nil, errSealedValue
+	}
+	data, err := aead.Open(nil, raw[:aead.NonceSize()], raw[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, errSealedValue
+	}
+	return data, nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ---------------------------------------------------------------------------
+// Access-token signing keys
+//
+// TokenKeys signs access tokens with the algorithm selected by
+// jwt_algorithm and verifies them. HS256 uses jwt_secret. RS256 and ES256
+// sign with the private key in jwt_key_file and name it in the token's kid
+// header; tokens are verified against that key and the keys in
+// jwt_previous_key_files, so a key can be replaced without rejecting
+// tokens it already signed. The public keys are published at
+// /.well-known/jwks.json for external verifiers.
+// ---------------------------------------------------------------------------
+
+// TokenKeys holds the key that signs access tokens and the keys that
+// verify them.
+type TokenKeys struct {
+	method  jwt.SigningMethod
+	signKey any    // []byte for HS256, otherwise the private key
+	kid     string // empty for HS256
+	verify  map[string]tokenKey
+}
+
+// tokenKey is a public key accepted for verification.
+type tokenKey struct {
+	method jwt.SigningMethod
+	public crypto.PublicKey
+}
+
+// NewHMACTokenKeys returns TokenKeys that sign and verify with HS256 and
+// secret.
+func NewHMACTokenKeys(secret string) *TokenKeys {
+	return &TokenKeys{method: jwt.SigningMethodHS256, signKey: []byte(secret)}
+}
+
+// LoadTokenKeys returns the TokenKeys for algorithm. For RS256 and ES256
+// it reads the PEM private key in keyFile and the PEM public or private
+// keys in previousFiles. secret is used for HS256.
+func LoadTokenKeys(algorithm, keyFile string, previousFiles []string, secret string) (*TokenKeys, error) {
+	k := &TokenKeys{verify: map[string]tokenKey{}}
+	switch algorithm {
+	case JWTAlgorithmHS256:
+		k.method, k.signKey = jwt.SigningMethodHS256, []byte(secret)
+	case JWTAlgorithmRS256, JWTAlgorithmES256:
+		private, err := readPEMKey(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("jwt_key_file: %w", err)
+		}
+		signer, ok := private.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("jwt_key_file: %s does not contain a private key", keyFile)
+		}
+		kid, method, err := addTokenKey(k.verify, signer.Public())
+		if err != nil {
+			return nil, fmt.Errorf("jwt_key_file: %w", err)
+		}
+		if method.Alg() != algorithm {
+			return nil, fmt.Errorf("jwt_key_file: %s holds a %s key, not a %s key", keyFile, method.Alg(), algorithm)
+		}
+		k.method, k.signKey, k.kid = method, private, kid
+	default:
+		return nil, fmt.Errorf("jwt_algorithm must be %s, %s, or %s", JWTAlgorithmHS256, JWTAlgorithmRS256, JWTAlgorithmES256)
+	}
+
+	for _, file := range previousFiles {
+		key, err := readPEMKey(file)
+		if err != nil {
+			return nil, fmt.Errorf("jwt_previous_key_files: %w", err)
+		}
+		if signer, ok := key.(crypto.Signer); ok {
+			key = signer.Public()
+		}
+		if _, _, err := addTokenKey(k.verify, key); err != nil {
+			return nil, fmt.Errorf("jwt_previous_key_files: %s: %w", file, err)
+		}
+	}
+	return k, nil
+}
+
+// CreateAccessToken signs a JWT with the standard Moon claims.
+func (k *TokenKeys) CreateAccessToken(userID, jti, role string, canWrite bool, expirySeconds int) (string, time.Time, error) {
+	now := time.Now().UTC()
+	exp := now.Add(time.Duration(expirySeconds) * time.Second)
+
+	token := jwt.NewWithClaims(k.method, jwt.MapClaims{
+		"sub":       userID,
+		"jti":       jti,
+		"role":      role,
+		"can_write": canWrite,
+		"exp":       exp.Unix(),
+		"iat":       now.Unix(),
+	})
+	if k.kid != "" {
+		token.Header["kid"] = k.kid
+	}
+	signed, err := token.SignedString(k.signKey)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("sign jwt: %w", err)
+	}
+	return signed, exp, nil
+}
+
+// Parse verifies tokenStr and returns its claims. The token must use the
+// algorithm of the key it names, or HS256 when HS256 is configured.
+func (k *TokenKeys) Parse(tokenStr string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (any, error) {
+		if k.method == jwt.SigningMethodHS256 && t.Method == jwt.SigningMethodHS256 {
+			return k.signKey, nil
+		}
+		kid, _ := t.Header["kid"].(string)
+		key, ok := k.verify[kid]
+		if !ok || t.Method != key.method {
+			return nil, fmt.Errorf("unexpected signing key %q or method %v", kid, t.Header["alg"])
+		}
+		return key.public, nil
+	}, jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// Asymmetric reports whether any token is verified with a public key, so
+// that there is a key set to publish.
+func (k *TokenKeys) Asymmetric() bool {
+	return len(k.verify) > 0
+}
+
+// JWKS returns the public keys as a JSON Web Key Set (RFC 7517), the
+// signing key first.
+func (k *TokenKeys) JWKS() map[string]any {
+	keys := []any{}
+	if key, ok := k.verify[k.kid]; ok {
+		keys = append(keys, jwkFor(k.kid, key))
+	}
+	for kid, key := range k.verify {
+		if kid != k.kid {
+			keys = append(keys, jwkFor(kid, key))
+		}
+	}
+	return map[string]any{"keys": keys}
+}
+
+// jwkFor returns the JWK of a public key.
+func jwkFor(kid string, key tokenKey) map[string]any {
+	jwk := map[string]any{"kid": kid, "use": "sig", "alg": key.method.Alg()}
+	encode := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	switch pub := key.public.(type) {
+	case *rsa.PublicKey:
+		jwk["kty"] = "RSA"
+		jwk["n"] = encode(pub.N.Bytes())
+		jwk["e"] = encode(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		x, y := make([]byte, 32), make([]byte, 32)
+		jwk["kty"] = "EC"
+		jwk["crv"] = "P-256"
+		jwk["x"] = encode(pub.X.FillBytes(x))
+		jwk["y"] = encode(pub.Y.FillBytes(y))
+	}
+	return jwk
+}
+
+// addTokenKey adds a public key to verify under its key id, and returns
+// the id and the algorithm the key signs with.
+func addTokenKey(verify map[string]tokenKey, public crypto.PublicKey) (string, jwt.SigningMethod, error) {
+	var method jwt.SigningMethod
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < MinJWTRSAKeyBits {
+			return "", nil, fmt.Errorf("RSA keys must have at least %d bits", MinJWTRSAKeyBits)
+		}
+		method = jwt.SigningMethodRS256
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return "", nil, fmt.Errorf("EC keys must use the P-256 curve")
+		}
+		method = jwt.SigningMethodES256
+	default:
+		return "", nil, fmt.Errorf("unsupported key type %T", public)
+	}
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return "", nil, err
+	}
+	sum := sha256.Sum256(der)
+	kid := base64.RawURLEncoding.EncodeToString(sum[:12])
+	verify[kid] = tokenKey{method: method, public: public}
+	return kid, method, nil
+}
+
+// readPEMKey reads the first key in a PEM file: a PKCS #8, PKCS #1, or SEC 1
+// private key, or a PKIX public key.
+func readPEMKey(path string) (any, error) {
+	if path == "" {
+		return nil, fmt.Errorf("no key file set")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a PEM file", path)
+	}
+	switch block.Type {
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+}
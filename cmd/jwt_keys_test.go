@@ -0,0 +1,238 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// writePEMKey writes key to a PEM file in dir. Private keys are written as
+// PKCS #8 and public keys as PKIX.
+func writePEMKey(t *testing.T, dir, name string, key any) string {
+	t.Helper()
+	var der []byte
+	var blockType string
+	var err error
+	switch key.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		blockType = "PUBLIC KEY"
+		der, err = x509.MarshalPKIXPublicKey(key)
+	default:
+		blockType = "PRIVATE KEY"
+		der, err = x509.MarshalPKCS8PrivateKey(key)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newRSATestKey(t *testing.T, bits int) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newECTestKey(t *testing.T, curve elliptic.Curve) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestTokenKeys_SignAndParse(t *testing.T) {
+	dir := t.TempDir()
+	rsaFile := writePEMKey(t, dir, "rsa.pem", newRSATestKey(t, 2048))
+	ecFile := writePEMKey(t, dir, "ec.pem", newECTestKey(t, elliptic.P256()))
+
+	for _, tt := range []struct {
+		algorithm string
+		keyFile   string
+	}{
+		{JWTAlgorithmHS256, ""},
+		{JWTAlgorithmRS256, rsaFile},
+		{JWTAlgorithmES256, ecFile},
+	} {
+		keys, err := LoadTokenKeys(tt.algorithm, tt.keyFile, nil, testJWTSecret())
+		if err != nil {
+			t.Fatalf("%s: %v", tt.algorithm, err)
+		}
+		token, _, err := keys.CreateAccessToken("user-1", "jti-1", "admin", true, 60)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.algorithm, err)
+		}
+		parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.Method.Alg() != tt.algorithm {
+			t.Errorf("%s: token signed with %s", tt.algorithm, parsed.Method.Alg())
+		}
+		claims, err := keys.Parse(token)
+		if err != nil {
+			t.Fatalf("%s: parse: %v", tt.algorithm, err)
+		}
+		if claims["sub"] != "user-1" || claims["role"] != "admin" {
+			t.Errorf("%s: unexpected claims %v", tt.algorithm, claims)
+		}
+		if keys.Asymmetric() != (tt.algorithm != JWTAlgorithmHS256) {
+			t.Errorf("%s: Asymmetric() = %v", tt.algorithm, keys.Asymmetric())
+		}
+	}
+}
+
+func TestTokenKeys_Rotation(t *testing.T) {
+	dir := t.TempDir()
+	oldKey := newRSATestKey(t, 2048)
+	oldFile := writePEMKey(t, dir, "old.pem", oldKey)
+	newFile := writePEMKey(t, dir, "new.pem", newECTestKey(t, elliptic.P256()))
+	oldPublic := writePEMKey(t, dir, "old.pub", &oldKey.PublicKey)
+
+	oldKeys, err := LoadTokenKeys(JWTAlgorithmRS256, oldFile, nil, testJWTSecret())
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, _, err := oldKeys.CreateAccessToken("user-1", "jti-1", "user", false, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hmacToken, _, err := NewHMACTokenKeys(testJWTSecret()).CreateAccessToken("user-1", "jti-2", "user", false, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without the previous key, tokens it signed are rejected.
+	rotated, err := LoadTokenKeys(JWTAlgorithmES256, newFile, nil, testJWTSecret())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rotated.Parse(oldToken); err == nil {
+		t.Error("expected a token from an unknown key to be rejected")
+	}
+
+	rotated, err = LoadTokenKeys(JWTAlgorithmES256, newFile, []string{oldPublic}, testJWTSecret())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rotated.Parse(oldToken); err != nil {
+		t.Errorf("expected a token from the previous key to verify, got %v", err)
+	}
+	if _, err := rotated.Parse(hmacToken); err == nil {
+		t.Error("expected an HS256 token to be rejected when ES256 is configured")
+	}
+
+	jwks := rotated.JWKS()["keys"].([]any)
+	if len(jwks) != 2 {
+		t.Fatalf("expected 2 keys in the key set, got %d", len(jwks))
+	}
+	if first := jwks[0].(map[string]any); first["kty"] != "EC" || first["alg"] != JWTAlgorithmES256 || first["kid"] != rotated.kid {
+		t.Errorf("expected the signing key first, got %v", first)
+	}
+	if second := jwks[1].(map[string]any); second["kty"] != "RSA" || second["n"] == "" || second["e"] != "AQAB" {
+		t.Errorf("unexpected previous key %v", second)
+	}
+}
+
+func TestTokenKeys_ForgedAlgorithm(t *testing.T) {
+	dir := t.TempDir()
+	key := newRSATestKey(t, 2048)
+	keys, err := LoadTokenKeys(JWTAlgorithmRS256, writePEMKey(t, dir, "rsa.pem", key), nil, testJWTSecret())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An HS256 token keyed with the public key must not verify.
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "user-1", "jti": "jti-1", "exp": 9999999999})
+	token.Header["kid"] = keys.kid
+	forged, err := token.SignedString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.Parse(forged); err == nil {
+		t.Error("expected an HS256 token to be rejected when RS256 is configured")
+	}
+}
+
+func TestLoadTokenKeys_Errors(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey := newRSATestKey(t, 2048)
+	rsaFile := writePEMKey(t, dir, "rsa.pem", rsaKey)
+	rsaPublic := writePEMKey(t, dir, "rsa.pub", &rsaKey.PublicKey)
+	smallFile := writePEMKey(t, dir, "small.pem", newRSATestKey(t, 1024))
+	p384File := writePEMKey(t, dir, "p384.pem", newECTestKey(t, elliptic.P384()))
+	garbage := filepath.Join(dir, "garbage.pem")
+	if err := os.WriteFile(garbage, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name      string
+		algorithm string
+		keyFile   string
+		previous  []string
+		want      string
+	}{
+		{"unknown algorithm", "PS256", rsaFile, nil, "jwt_algorithm"},
+		{"missing key file", JWTAlgorithmRS256, "", nil, "jwt_key_file"},
+		{"unreadable key file", JWTAlgorithmRS256, filepath.Join(dir, "missing.pem"), nil, "jwt_key_file"},
+		{"not PEM", JWTAlgorithmRS256, garbage, nil, "not a PEM file"},
+		{"public key", JWTAlgorithmRS256, rsaPublic, nil, "does not contain a private key"},
+		{"algorithm mismatch", JWTAlgorithmES256, rsaFile, nil, "not a ES256 key"},
+		{"small RSA key", JWTAlgorithmRS256, smallFile, nil, "at least 2048 bits"},
+		{"wrong curve", JWTAlgorithmES256, p384File, nil, "P-256"},
+		{"bad previous key", JWTAlgorithmRS256, rsaFile, []string{garbage}, "jwt_previous_key_files"},
+	} {
+		_, err := LoadTokenKeys(tt.algorithm, tt.keyFile, tt.previous, testJWTSecret())
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestHandleJWKS(t *testing.T) {
+	dir := t.TempDir()
+	keys, err := LoadTokenKeys(JWTAlgorithmES256, writePEMKey(t, dir, "ec.pem", newECTestKey(t, elliptic.P256())), nil, testJWTSecret())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	handleJWKS(keys)(w, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if got := w.Header().Get("Cache-Control"); got != "public, max-age=300" {
+		t.Errorf("unexpected Cache-Control %q", got)
+	}
+	body := decodeResponse(t, w)
+	set := body["keys"].([]any)
+	if len(set) != 1 || set[0].(map[string]any)["crv"] != "P-256" || set[0].(map[string]any)["use"] != "sig" {
+		t.Errorf("unexpected key set %v", body)
+	}
+	if _, ok := set[0].(map[string]any)["d"]; ok {
+		t.Error("the key set must not contain private key material")
+	}
+}
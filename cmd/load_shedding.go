@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+)
+
+// ---------------------------------------------------------------------------
+// Load shedding
+//
+// When limits.max_concurrent_requests is set, requests in flight are
+// counted and, as the count nears the limit, lower-priority requests are
+// rejected with 503 so that admin traffic and writes stay responsive.
+// ---------------------------------------------------------------------------
+
+// LoadShedder counts in-flight requests and decides which to shed.
+type LoadShedder struct {
+	inflight atomic.Int64
+	prefix   string
+}
+
+// NewLoadShedder creates a LoadShedder for a server mounted under prefix.
+func NewLoadShedder(prefix string) *LoadShedder {
+	return &LoadShedder{prefix: prefix}
+}
+
+// requestPriority classifies a request: admin callers first, then
+// authenticated writes, authenticated reads, and anonymous requests.
+func requestPriority(r *http.Request) int {
+	identity, ok := GetAuthIdentity(r.Context())
+	switch {
+	case !ok:
+		return PriorityAnonymous
+	case identity.Role == "admin":
+		return PriorityAdmin
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		return PriorityRead
+	default:
+		return PriorityWrite
+	}
+}
+
+// shedThreshold returns the in-flight count at which requests of priority
+// are shed under limit, or 0 when they never are.
+func shedThreshold(priority, limit int) int64 {
+	if limit <= 0 || priority >= len(LoadShedShares) {
+		return 0
+	}
+	return max(int64(float64(limit)*LoadShedShares[priority]), 1)
+}
+
+// isHealthPath reports whether path is one of the health check routes,
+// which are never shed so that load balancers keep seeing the instance.
+func (s *LoadShedder) isHealthPath(path string) bool {
+	return path == s.prefix+"/health" || path == s.prefix+"/" || (s.prefix != "" && path == s.prefix)
+}
+
+// Middleware rejects requests with 503 when the requests already in flight
+// reach the threshold of their priority class. It must run after the
+// authentication middleware so that the caller identity is available.
+func (s *LoadShedder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := requestLimits().MaxConcurrentRequests
+		if limit <= 0 || s.isHealthPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		n := s.inflight.Add(1)
+		defer s.inflight.Add(-1)
+		if threshold := shedThreshold(requestPriority(r), limit); threshold > 0 && n > threshold {
+			w.Header().Set("Retry-After", strconv.Itoa(LoadShedRetryAfterSeconds))
+			WriteErrorCode(w, http.StatusServiceUnavailable, ErrCodeOverloaded, "Server is overloaded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestRequestPriority(t *testing.T) {
+	admin := &AuthIdentity{CallerID: "a", Role: "admin"}
+	user := &AuthIdentity{CallerID: "u", Role: "user"}
+	for _, tt := range []struct {
+		method   string
+		identity *AuthIdentity
+		want     int
+	}{
+		{http.MethodGet, nil, PriorityAnonymous},
+		{http.MethodPost, nil, PriorityAnonymous},
+		{http.MethodGet, user, PriorityRead},
+		{http.MethodPost, user, PriorityWrite},
+		{http.MethodPost, admin, PriorityAdmin},
+	} {
+		req := httptest.NewRequest(tt.method, "/data/products:query", nil)
+		if tt.identity != nil {
+			req = req.WithContext(SetAuthIdentity(req.Context(), tt.identity))
+		}
+		if got := requestPriority(req); got != tt.want {
+			t.Errorf("%s as %v: priority %d, want %d", tt.method, tt.identity, got, tt.want)
+		}
+	}
+}
+
+func TestLoadShedder_ShedsLowerClassesFirst(t *testing.T) {
+	limits := requestLimits()
+	limits.MaxConcurrentRequests = 10
+	SetRequestLimits(limits)
+	t.Cleanup(func() { liveLimits.Store(nil) })
+
+	// Hold 8 requests in flight: over the anonymous (5) and read (7)
+	// thresholds but under the write threshold (9).
+	release := make(chan struct{})
+	var started, done sync.WaitGroup
+	shedder := NewLoadShedder("")
+	handler := shedder.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("hold") != "" {
+			started.Done()
+			<-release
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	admin := &AuthIdentity{CallerID: "a", Role: "admin"}
+	user := &AuthIdentity{CallerID: "u", Role: "user"}
+	serve := func(method, target string, identity *AuthIdentity) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if identity != nil {
+			req = req.WithContext(SetAuthIdentity(context.Background(), identity))
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	for range 8 {
+		started.Add(1)
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			serve(http.MethodGet, "/data/products:query?hold=1", admin)
+		}()
+	}
+	started.Wait()
+
+	for _, tt := range []struct {
+		method, target string
+		identity       *AuthIdentity
+		want           int
+	}{
+		{http.MethodGet, "/data/products:query", nil, http.StatusServiceUnavailable},
+		{http.MethodGet, "/data/products:query", user, http.StatusServiceUnavailable},
+		{http.MethodPost, "/data/products:mutate", user, http.StatusOK},
+		{http.MethodGet, "/data/products:query", admin, http.StatusOK},
+		{http.MethodGet, "/health", nil, http.StatusOK},
+	} {
+		w := serve(tt.method, tt.target, tt.identity)
+		if w.Code != tt.want {
+			t.Errorf("%s %s as %v: expected %d, got %d", tt.method, tt.target, tt.identity, tt.want, w.Code)
+		}
+		if w.Code == http.StatusServiceUnavailable && w.Header().Get("Retry-After") == "" {
+			t.Errorf("%s %s: expected a Retry-After header", tt.method, tt.target)
+		}
+	}
+
+	close(release)
+	done.Wait()
+	if n := shedder.inflight.Load(); n != 0 {
+		t.Errorf("expected no requests in flight, got %d", n)
+	}
+	if w := serve(http.MethodGet, "/data/products:query", nil); w.Code != http.StatusOK {
+		t.Errorf("expected anonymous requests to pass once load drops, got %d", w.Code)
+	}
+}
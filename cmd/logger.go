@@ -18,7 +18,8 @@ import (
 // os.Stdout and the configured log file.
 type Logger struct {
 	*slog.Logger
-	file *os.File
+	file  *os.File
+	level *slog.LevelVar
 }
 
 // InitLogger creates a Logger that writes JSON-structured log lines to both
@@ -32,26 +33,55 @@ func InitLogger(logpath string) (*Logger, error) {
 	}
 
 	dual := io.MultiWriter(os.Stdout, f)
+	level := new(slog.LevelVar)
 	base := slog.NewJSONHandler(dual, &slog.HandlerOptions{
-		Level: slog.LevelInfo,
+		Level: level,
 	})
 	rh := NewRedactingHandler(base)
 
 	return &Logger{
 		Logger: slog.New(rh),
 		file:   f,
+		level:  level,
 	}, nil
 }
 
 // NewTestLogger creates a Logger that writes to the supplied writer only,
 // useful for capturing log output in tests without touching the filesystem.
 func NewTestLogger(w io.Writer) *Logger {
+	level := new(slog.LevelVar)
 	base := slog.NewJSONHandler(w, &slog.HandlerOptions{
-		Level: slog.LevelInfo,
+		Level: level,
 	})
 	rh := NewRedactingHandler(base)
 	return &Logger{
 		Logger: slog.New(rh),
+		level:  level,
+	}
+}
+
+// SetLevel changes the lowest level written, taking effect for every
+// subsequent entry. level is one of the LogLevel* constants; other values
+// are ignored. Loggers start at LogLevelInfo.
+func (l *Logger) SetLevel(level string) {
+	if lv, ok := parseLogLevel(level); ok && l.level != nil {
+		l.level.Set(lv)
+	}
+}
+
+// parseLogLevel maps a server.log_level value to its slog level.
+func parseLogLevel(level string) (slog.Level, bool) {
+	switch level {
+	case LogLevelDebug:
+		return slog.LevelDebug, true
+	case LogLevelInfo:
+		return slog.LevelInfo, true
+	case LogLevelWarn:
+		return slog.LevelWarn, true
+	case LogLevelError:
+		return slog.LevelError, true
+	default:
+		return 0, false
 	}
 }
 
@@ -69,10 +99,34 @@ func (l *Logger) Close() error {
 // follow the audit field convention: method, path, actor, target, op,
 // outcome, status, duration_ms.
 func (l *Logger) AuditEvent(event string, fields ...any) {
+	l.AuditEventContext(context.Background(), event, fields...)
+}
+
+// AuditEventContext is AuditEvent for a request-scoped event. The entry
+// carries the request ID stored in ctx, if any.
+func (l *Logger) AuditEventContext(ctx context.Context, event string, fields ...any) {
 	attrs := make([]any, 0, len(fields)+2)
 	attrs = append(attrs, "event", event)
 	attrs = append(attrs, fields...)
-	l.Info("audit", attrs...)
+	l.InfoContext(ctx, "audit", attrs...)
+}
+
+// ---------------------------------------------------------------------------
+// Request correlation
+// ---------------------------------------------------------------------------
+
+const requestIDKey contextKey = "request_id"
+
+// SetRequestID stores the request correlation ID in ctx.
+func SetRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestIDFromContext returns the request correlation ID stored in ctx, or
+// "" outside a request.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
 }
 
 // ---------------------------------------------------------------------------
@@ -124,13 +178,23 @@ func (h *RedactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
 	return h.inner.Enabled(ctx, level)
 }
 
-// Handle redacts sensitive attributes in the record before delegating.
+// Handle redacts sensitive attributes in the record before delegating. A
+// request ID stored in ctx is added as "request_id" unless the record
+// already has one.
 func (h *RedactingHandler) Handle(ctx context.Context, r slog.Record) error {
 	redacted := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	hasRequestID := false
 	r.Attrs(func(a slog.Attr) bool {
+		hasRequestID = hasRequestID || a.Key == "request_id"
 		redacted.AddAttrs(redactAttr(a))
 		return true
 	})
+	if id := RequestIDFromContext(ctx); id != "" && !hasRequestID {
+		redacted.AddAttrs(slog.String("request_id", id))
+	}
+	if id := SpanFromContext(ctx).TraceID(); id != "" {
+		redacted.AddAttrs(slog.String("trace_id", id))
+	}
 	return h.inner.Handle(ctx, redacted)
 }
 
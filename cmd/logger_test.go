@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io"
 	"log/slog"
@@ -452,6 +453,12 @@ func TestAuditEventConstants(t *testing.T) {
 		"AuditPrivilegedMutation":  AuditPrivilegedMutation,
 		"AuditAPIKeyCreate":        AuditAPIKeyCreate,
 		"AuditAPIKeyRotation":      AuditAPIKeyRotation,
+		"AuditAPIKeyExpiring":      AuditAPIKeyExpiring,
+		"AuditSLOAtRisk":           AuditSLOAtRisk,
+		"AuditTwoFactorChange":     AuditTwoFactorChange,
+		"AuditAccountLocked":       AuditAccountLocked,
+		"AuditPasswordReset":       AuditPasswordReset,
+		"AuditInvitationAccepted":  AuditInvitationAccepted,
 		"AuditAdminUserManagement": AuditAdminUserManagement,
 		"AuditShutdown":            AuditShutdown,
 	}
@@ -561,3 +568,30 @@ func TestNewTestLogger_Close(t *testing.T) {
 		t.Errorf("Close on non-file logger returned error: %v", err)
 	}
 }
+
+func TestLogger_AddsRequestIDFromContext(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewTestLogger(&buf)
+	ctx := SetRequestID(context.Background(), "req-42")
+
+	logger.WarnContext(ctx, "slow query", "table", "products")
+	logger.InfoContext(ctx, "explicit", "request_id", "other")
+	logger.Info("no request")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 log lines, got %d", len(lines))
+	}
+	for i, want := range []any{"req-42", "other", nil} {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(lines[i]), &entry); err != nil {
+			t.Fatalf("decode line %d: %v", i, err)
+		}
+		if entry["request_id"] != want {
+			t.Errorf("line %d: expected request_id %v, got %v", i, want, entry["request_id"])
+		}
+	}
+	if strings.Count(lines[1], "request_id") != 1 {
+		t.Errorf("expected one request_id on explicit line, got %s", lines[1])
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------------------------------------------------------------------------
+// Mail
+//
+// Moon sends email through the driver in the mail config section. The smtp
+// driver delivers through an SMTP server: port 465 uses implicit TLS, and
+// on other ports the connection is upgraded with STARTTLS when the server
+// offers it. Credentials are only sent over TLS. The console driver writes
+// each message to the log instead, for development. Messages are rendered
+// from the templates in mail_templates.go.
+// ---------------------------------------------------------------------------
+
+// MailMessage is a plain-text email to one recipient.
+type MailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers email.
+type Mailer interface {
+	Send(ctx context.Context, msg MailMessage) error
+}
+
+// SMTPMailer delivers email through an SMTP server.
+type SMTPMailer struct {
+	cfg MailConfig
+}
+
+// NewMailer returns the mailer for cfg, or nil when email is disabled.
+func NewMailer(cfg MailConfig, logger *Logger) Mailer {
+	switch {
+	case cfg.Driver == MailDriverConsole:
+		return &ConsoleMailer{from: cfg.From, logger: logger}
+	case cfg.SMTPHost != "":
+		return &SMTPMailer{cfg: cfg}
+	}
+	return nil
+}
+
+// ConsoleMailer writes email to the log instead of sending it.
+type ConsoleMailer struct {
+	from   string
+	logger *Logger
+}
+
+// Send logs msg at info level.
+func (m *ConsoleMailer) Send(ctx context.Context, msg MailMessage) error {
+	if m.logger != nil {
+		m.logger.InfoContext(ctx, "mail",
+			"from", m.from,
+			"to", msg.To,
+			"subject", msg.Subject,
+			"body", msg.Body,
+		)
+	}
+	return nil
+}
+
+// Send delivers msg, giving up after MailTimeoutSeconds.
+func (m *SMTPMailer) Send(ctx context.Context, msg MailMessage) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(MailTimeoutSeconds)*time.Second)
+	defer cancel()
+
+	addr := net.JoinHostPort(m.cfg.SMTPHost, strconv.Itoa(m.cfg.SMTPPort))
+	tlsConfig := &tls.Config{ServerName: m.cfg.SMTPHost, MinVersion: tls.VersionTLS12}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("mail: dial %s: %w", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	if m.cfg.SMTPPort == 465 {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	c, err := smtp.NewClient(conn, m.cfg.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("mail: %w", err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok && m.cfg.SMTPPort != 465 {
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("mail: starttls: %w", err)
+		}
+	}
+	if m.cfg.SMTPUsername != "" {
+		auth := smtp.PlainAuth("", m.cfg.SMTPUsername, m.cfg.SMTPPassword, m.cfg.SMTPHost)
+		if err := c.Auth(auth); err != nil {
+			return fmt.Errorf("mail: auth: %w", err)
+		}
+	}
+	if err := c.Mail(m.cfg.From); err != nil {
+		return fmt.Errorf("mail: %w", err)
+	}
+	if err := c.Rcpt(msg.To); err != nil {
+		return fmt.Errorf("mail: %w", err)
+	}
+	wc, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("mail: %w", err)
+	}
+	if _, err := wc.Write(formatMail(m.cfg.From, msg, time.Now())); err != nil {
+		wc.Close()
+		return fmt.Errorf("mail: %w", err)
+	}
+	if err := wc.Close(); err != nil {
+		return fmt.Errorf("mail: %w", err)
+	}
+	return c.Quit()
+}
+
+// formatMail renders msg as an RFC 5322 message with CRLF line endings.
+func formatMail(from string, msg MailMessage, now time.Time) []byte {
+	var b strings.Builder
+	header := func(name, value string) {
+		// Header values must not carry line breaks.
+		value = strings.NewReplacer("\r", "", "\n", "").Replace(value)
+		b.WriteString(name + ": " + value + "\r\n")
+	}
+	header("From", from)
+	header("To", msg.To)
+	header("Subject", msg.Subject)
+	header("Date", now.UTC().Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	b.WriteString("\r\n")
+	body := strings.ReplaceAll(msg.Body, "\r\n", "\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return []byte(b.String())
+}
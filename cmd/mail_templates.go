@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// ---------------------------------------------------------------------------
+// Mail templates
+//
+// Every email Moon sends is rendered from a text/template that defines a
+// "subject" and a "body" template. The built-in templates below can be
+// replaced by a file named {name}.tmpl in mail.template_dir.
+// ---------------------------------------------------------------------------
+
+// builtinMailTemplates maps each template name to its default source.
+var builtinMailTemplates = map[string]string{
+	MailTemplatePasswordReset: `{{define "subject"}}Reset your password{{end}}
+{{define "body"}}Hello {{.Username}},
+
+A password reset was requested for your account.
+
+{{if .URL}}To choose a new password, open:
+
+{{.URL}}
+{{else}}Your reset token is:
+
+{{.Token}}
+{{end}}
+This expires in {{.ExpiresIn}} and can be used once. If you did not ask for a reset, ignore this email.
+{{end}}`,
+	MailTemplateInvitation: `{{define "subject"}}You have been invited to Moon{{end}}
+{{define "body"}}Hello,
+
+You have been invited to sign in to Moon as {{.Username}} with the {{.Role}} role.
+
+{{if .URL}}To accept and choose a password, open:
+
+{{.URL}}
+{{else}}Your invitation token is:
+
+{{.Token}}
+{{end}}
+This invitation expires in {{.ExpiresIn}}.
+{{end}}`,
+}
+
+// PasswordResetMail is the data of the password_reset template.
+type PasswordResetMail struct {
+	Username  string
+	Email     string
+	Token     string
+	URL       string // the reset link, empty without password_reset.url
+	ExpiresIn string // token lifetime, such as "1h0m0s"
+}
+
+// InvitationMail is the data of the invitation template.
+type InvitationMail struct {
+	Username  string
+	Email     string
+	Role      string
+	Token     string
+	URL       string // the acceptance link, empty without invitation.url
+	ExpiresIn string // token lifetime, such as "168h0m0s"
+}
+
+// MailTemplates holds the parsed template of every message.
+type MailTemplates struct {
+	templates map[string]*template.Template
+}
+
+// LoadMailTemplates parses the built-in templates, replacing each with
+// {name}.tmpl from dir when dir is set and has one. A file whose name is
+// not a known template is an error, so misspelled overrides are caught.
+func LoadMailTemplates(dir string) (*MailTemplates, error) {
+	sources := make(map[string]string, len(builtinMailTemplates))
+	for name, src := range builtinMailTemplates {
+		sources[name] = src
+	}
+	if dir != "" {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			name, ok := strings.CutSuffix(entry.Name(), MailTemplateExt)
+			if entry.IsDir() || !ok {
+				continue
+			}
+			if _, known := builtinMailTemplates[name]; !known {
+				return nil, fmt.Errorf("unknown template %q; expected one of %s", entry.Name(), strings.Join(mailTemplateNames(), ", "))
+			}
+			data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				return nil, err
+			}
+			sources[name] = string(data)
+		}
+	}
+
+	mt := &MailTemplates{templates: make(map[string]*template.Template, len(sources))}
+	for name, src := range sources {
+		tmpl, err := template.New(name).Option("missingkey=error").Parse(src)
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", name, err)
+		}
+		for _, part := range []string{"subject", "body"} {
+			if tmpl.Lookup(part) == nil {
+				return nil, fmt.Errorf("template %s must define %q", name, part)
+			}
+		}
+		mt.templates[name] = tmpl
+	}
+	return mt, nil
+}
+
+// mailTemplateNames returns the template file names, sorted.
+func mailTemplateNames() []string {
+	names := make([]string, 0, len(builtinMailTemplates))
+	for name := range builtinMailTemplates {
+		names = append(names, name+MailTemplateExt)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Render builds the message to to from the named template and data.
+func (mt *MailTemplates) Render(name, to string, data any) (MailMessage, error) {
+	tmpl, ok := mt.templates[name]
+	if !ok {
+		return MailMessage{}, fmt.Errorf("mail: unknown template %q", name)
+	}
+	var subject, body bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return MailMessage{}, fmt.Errorf("mail: template %s: %w", name, err)
+	}
+	if err := tmpl.ExecuteTemplate(&body, "body", data); err != nil {
+		return MailMessage{}, fmt.Errorf("mail: template %s: %w", name, err)
+	}
+	return MailMessage{
+		To:      to,
+		Subject: strings.TrimSpace(subject.String()),
+		Body:    strings.TrimLeft(body.String(), "\n"),
+	}, nil
+}
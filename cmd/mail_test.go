@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatMail(t *testing.T) {
+	msg := formatMail("moon@example.com", MailMessage{
+		To:      "user@example.com",
+		Subject: "Hello\r\nBcc: attacker@example.com",
+		Body:    "line one\nline two\n",
+	}, time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	got := string(msg)
+	if !strings.Contains(got, "Subject: HelloBcc: attacker@example.com\r\n") {
+		t.Errorf("expected line breaks to be stripped from headers, got %q", got)
+	}
+	if !strings.HasSuffix(got, "\r\n\r\nline one\r\nline two\r\n") {
+		t.Errorf("expected a CRLF body, got %q", got)
+	}
+}
+
+func TestMailTemplates_Builtin(t *testing.T) {
+	mt, err := LoadMailTemplates("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := mt.Render(MailTemplatePasswordReset, "ada@example.com", PasswordResetMail{
+		Username: "ada", Email: "ada@example.com", Token: "tok123", ExpiresIn: "1h0m0s",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.To != "ada@example.com" || msg.Subject != "Reset your password" {
+		t.Errorf("unexpected message %+v", msg)
+	}
+	if !strings.HasPrefix(msg.Body, "Hello ada,") || !strings.Contains(msg.Body, "tok123") {
+		t.Errorf("unexpected body %q", msg.Body)
+	}
+}
+
+func TestMailTemplates_Override(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, src string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("password_reset.tmpl", `{{define "subject"}}Moon reset for {{.Username}}{{end}}{{define "body"}}Use {{.Token}}{{end}}`)
+	write("README.md", "ignored")
+
+	mt, err := LoadMailTemplates(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := mt.Render(MailTemplatePasswordReset, "ada@example.com", PasswordResetMail{Username: "ada", Token: "tok123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Subject != "Moon reset for ada" || msg.Body != "Use tok123" {
+		t.Errorf("unexpected message %+v", msg)
+	}
+
+	for _, tt := range []struct {
+		file, src, want string
+	}{
+		{"invite.tmpl", `{{define "subject"}}x{{end}}{{define "body"}}x{{end}}`, "unknown template"},
+		{"password_reset.tmpl", `{{define "subject"}}x{{end}}`, `must define "body"`},
+		{"password_reset.tmpl", `{{define "subject"}}{{.Missing}{{end}}`, "password_reset"},
+	} {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, tt.file), []byte(tt.src), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadMailTemplates(dir); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.file, tt.want, err)
+		}
+	}
+}
+
+func TestConsoleMailer(t *testing.T) {
+	var buf bytes.Buffer
+	mailer := NewMailer(MailConfig{Driver: MailDriverConsole, From: "moon@example.com"}, NewTestLogger(&buf))
+	if err := mailer.Send(context.Background(), MailMessage{To: "ada@example.com", Subject: "Hi", Body: "Hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); !strings.Contains(out, `"to":"ada@example.com"`) || !strings.Contains(out, `"body":"Hello"`) {
+		t.Errorf("expected the message in the log, got %s", out)
+	}
+	if NewMailer(MailConfig{Driver: MailDriverSMTP}, nil) != nil {
+		t.Error("expected no mailer without an SMTP host")
+	}
+}
@@ -6,12 +6,30 @@ import (
 	"fmt"
 	"os"
 	"time"
+
+	// Embed the IANA time zone database so tz-aware queries work in the
+	// scratch container image, which ships without /usr/share/zoneinfo.
+	_ "time/tzdata"
 )
 
 func main() {
 	configPath := flag.String("c", DefaultConfigPath, "path to the YAML configuration file")
 	flag.Parse()
 
+	// "moon upgrade" migrates the system tables and exits. Flags may come
+	// before or after the command.
+	upgrade := false
+	if flag.Arg(0) == "upgrade" {
+		upgrade = true
+		if err := flag.CommandLine.Parse(flag.Args()[1:]); err != nil {
+			os.Exit(2)
+		}
+	}
+	if flag.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", flag.Arg(0))
+		os.Exit(2)
+	}
+
 	cfg, err := LoadConfig(*configPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "startup error: %v\n", err)
@@ -24,25 +42,37 @@ func main() {
 		os.Exit(1)
 	}
 	defer logger.Close()
+	logger.SetLevel(cfg.Server.LogLevel)
 
-	adapter, err := NewDatabaseAdapter(cfg.Database, logger)
+	adapter, err := ConnectDatabase(context.Background(), cfg.Database, logger)
 	if err != nil {
-		logger.Error("database init failed", "error", err)
+		logger.Error("database connection failed", "error", err)
 		fmt.Fprintf(os.Stderr, "startup error: %v\n", err)
 		os.Exit(1)
 	}
+	adapter = NewCachedAdapter(adapter, cfg.Cache)
 	defer adapter.Close()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	if err := adapter.Ping(ctx); err != nil {
-		logger.Error("database ping failed", "error", err)
-		fmt.Fprintf(os.Stderr, "startup error: %v\n", err)
-		os.Exit(1)
+	if upgrade {
+		from, to, err := UpgradeSystemTables(ctx, adapter)
+		if err != nil {
+			logger.Error("system tables upgrade failed", "error", err)
+			fmt.Fprintf(os.Stderr, "upgrade error: %v\n", err)
+			os.Exit(1)
+		}
+		if from == to {
+			fmt.Printf("moon: database layout is up to date (version %d)\n", to)
+			return
+		}
+		logger.Info("system tables upgraded", "from", from, "to", to)
+		fmt.Printf("moon: database layout upgraded from version %d to %d\n", from, to)
+		return
 	}
 
-	if err := EnsureSystemTables(ctx, adapter); err != nil {
+	if err := PrepareSystemTables(ctx, adapter); err != nil {
 		logger.Error("system tables init failed", "error", err)
 		fmt.Fprintf(os.Stderr, "startup error: %v\n", err)
 		os.Exit(1)
@@ -59,6 +89,10 @@ func main() {
 	if err := StartServer(cfg, logger, adapter); err != nil {
 		logger.Error("server error", "error", err)
 		fmt.Fprintf(os.Stderr, "server error: %v\n", err)
+		// os.Exit skips deferred calls; close the database after the
+		// drained server as a clean shutdown would.
+		adapter.Close()
+		logger.Close()
 		os.Exit(1)
 	}
 }
@@ -6,31 +6,91 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/oklog/ulid/v2"
 )
 
-// corsMiddleware adds CORS headers when cors.enabled is true and handles
-// OPTIONS preflight requests by returning 200 immediately.
-func corsMiddleware(cfg CORSConfig, next http.Handler) http.Handler {
+// CORSPolicy holds the CORS settings applied by corsMiddleware. Set
+// replaces them for subsequent requests.
+type CORSPolicy struct {
+	cfg atomic.Pointer[CORSConfig]
+}
+
+// NewCORSPolicy creates a CORSPolicy applying cfg.
+func NewCORSPolicy(cfg CORSConfig) *CORSPolicy {
+	p := &CORSPolicy{}
+	p.Set(cfg)
+	return p
+}
+
+// Set replaces the settings in one step, so no request sees a mix of old
+// and new values.
+func (p *CORSPolicy) Set(cfg CORSConfig) {
+	cfg.AllowedOrigins = append([]string(nil), cfg.AllowedOrigins...)
+	if cfg.Origins != nil {
+		origins := make(map[string]CORSRules, len(cfg.Origins))
+		for origin, rules := range cfg.Origins {
+			origins[strings.ToLower(origin)] = rules
+		}
+		cfg.Origins = origins
+	}
+	p.cfg.Store(&cfg)
+}
+
+// rulesFor returns the Access-Control-Allow-Origin value for origin and the
+// rules that apply to it, or "" if the origin is not allowed. An origin
+// listed under cors.origins uses its own rules.
+func (c *CORSConfig) rulesFor(origin string) (string, CORSRules) {
+	if origin == "" {
+		return "", CORSRules{}
+	}
+	if rules, ok := c.Origins[strings.ToLower(origin)]; ok {
+		return origin, rules
+	}
+	return matchOrigin(origin, c.AllowedOrigins), c.CORSRules
+}
+
+// corsMiddleware adds CORS headers when cors.enabled is true and answers
+// OPTIONS requests with 200 immediately, before routing and
+// authentication, so a preflight works for every route, including the
+// `:action` ones. The allowed methods, headers, and max age are sent only
+// on preflight responses, where browsers read them.
+func corsMiddleware(policy *CORSPolicy, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := policy.cfg.Load()
 		if !cfg.Enabled {
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		origin := r.Header.Get("Origin")
-		allowed := matchOrigin(origin, cfg.AllowedOrigins)
+		allowed, rules := cfg.rulesFor(r.Header.Get("Origin"))
+		if allowed != "*" || len(cfg.Origins) > 0 {
+			// The response differs by origin, so caches must key on it.
+			w.Header().Add("Vary", "Origin")
+		}
 		if allowed != "" {
 			w.Header().Set("Access-Control-Allow-Origin", allowed)
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
-			w.Header().Set("Access-Control-Max-Age", "86400")
+			if rules.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
 		}
 
 		if r.Method == http.MethodOptions {
+			if allowed != "" && r.Header.Get("Access-Control-Request-Method") != "" {
+				if len(rules.AllowedMethods) > 0 {
+					w.Header().Set("Access-Control-Allow-Methods", strings.Join(rules.AllowedMethods, ", "))
+				}
+				if len(rules.AllowedHeaders) > 0 {
+					w.Header().Set("Access-Control-Allow-Headers", strings.Join(rules.AllowedHeaders, ", "))
+				}
+				if rules.MaxAge > 0 {
+					w.Header().Set("Access-Control-Max-Age", strconv.Itoa(rules.MaxAge))
+				}
+			}
 			w.WriteHeader(http.StatusOK)
 			return
 		}
@@ -55,19 +115,78 @@ func matchOrigin(origin string, allowed []string) string {
 	return ""
 }
 
-// auditContextMiddleware injects a request ID and start time into audit logs.
+// requestIDMiddleware assigns each request its correlation ID. A valid
+// X-Request-ID sent by the client, such as one set by a proxy, is kept;
+// otherwise a new ULID is generated. The ID is stored in the request
+// context, where the logger picks it up, and echoed in the response header.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = ulid.Make().String()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(SetRequestID(r.Context(), id)))
+	})
+}
+
+// hstsMiddleware sends Strict-Transport-Security with maxAge seconds on
+// responses to requests that arrived over TLS.
+func hstsMiddleware(maxAge int, next http.Handler) http.Handler {
+	value := fmt.Sprintf("max-age=%d", maxAge)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil {
+			w.Header().Set("Strict-Transport-Security", value)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// bodyLimitMiddleware caps request bodies at limits.max_request_body. A
+// declared Content-Length over the limit is rejected with 413 before the
+// handler runs; a body without one is cut off at the limit, so the handler
+// fails to read it.
+func bodyLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := int64(requestLimits().MaxRequestBody)
+		if r.ContentLength > limit {
+			WriteError(w, http.StatusRequestEntityTooLarge, "Request body too large")
+			return
+		}
+		if r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validRequestID reports whether an inbound request ID can be used as is:
+// 1 to MaxRequestIDLength letters, digits, '-', '_', '.', or ':'.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > MaxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// auditContextMiddleware writes an http.request audit event, carrying the
+// request ID from the context, after each request completes.
 func auditContextMiddleware(logger *Logger, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		requestID := ulid.Make().String()
 		start := time.Now()
 
-		w.Header().Set("X-Request-ID", requestID)
-
 		next.ServeHTTP(w, r)
 
 		duration := time.Since(start)
-		logger.AuditEvent("http.request",
-			"request_id", requestID,
+		logger.AuditEventContext(r.Context(), "http.request",
 			"method", r.Method,
 			"path", r.URL.Path,
 			"status", w.Header().Get("X-Status-Code"),
@@ -89,18 +208,41 @@ func methodValidationMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// panicRecoveryMiddleware catches panics from downstream handlers, logs them,
-// and returns a 500 error response.
-func panicRecoveryMiddleware(logger *Logger, next http.Handler) http.Handler {
+// panicRecoveryMiddleware catches panics from downstream handlers, logs them
+// with the request ID and stack, passes them to reporter (if non-nil), and
+// returns a 500 error response. http.ErrAbortHandler is re-panicked so the
+// server can abort the response as intended.
+func panicRecoveryMiddleware(logger *Logger, reporter ErrorReporter, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
-			if rec := recover(); rec != nil {
-				logger.Error("panic recovered",
-					"error", fmt.Sprintf("%v", rec),
-					"method", r.Method,
-					"path", r.URL.Path,
-				)
-				WriteError(w, http.StatusInternalServerError, "Internal server error")
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+			report := ErrorReport{
+				Time:      time.Now(),
+				RequestID: RequestIDFromContext(r.Context()),
+				Method:    r.Method,
+				Path:      r.URL.Path,
+				Message:   fmt.Sprintf("%v", rec),
+				Stack:     panicStack(),
+			}
+			stack := make([]string, len(report.Stack))
+			for i, f := range report.Stack {
+				stack[i] = f.String()
+			}
+			logger.ErrorContext(r.Context(), "panic recovered",
+				"error", report.Message,
+				"method", r.Method,
+				"path", r.URL.Path,
+				"stack", stack,
+			)
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			if reporter != nil {
+				reporter.Report(report)
 			}
 		}()
 		next.ServeHTTP(w, r)
@@ -108,20 +250,23 @@ func panicRecoveryMiddleware(logger *Logger, next http.Handler) http.Handler {
 }
 
 // rateLimitMiddleware enforces per-caller rate limits for authenticated JWT and
-// API key requests. It must run after the authentication middleware so that the
-// caller identity is available in the request context.
+// API key requests, then any limits.routes policy for the route, counted per
+// caller or, for anonymous requests, per client IP. It must run after the
+// authentication middleware so that the caller identity is available in the
+// request context.
 func rateLimitMiddleware(rl *RateLimiter, logger *Logger, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		identity, ok := GetAuthIdentity(r.Context())
-		if !ok {
-			next.ServeHTTP(w, r)
-			return
+		caller := clientIP(r)
+		if ok {
+			caller = identity.CallerID
 		}
 
-		switch identity.CredentialType {
-		case CredentialTypeJWT:
+		switch {
+		case !ok:
+		case identity.CredentialType == CredentialTypeJWT:
 			if !rl.AllowJWT(identity.CallerID) {
-				logger.AuditEvent(AuditRateLimitViolation,
+				logger.AuditEventContext(r.Context(), AuditRateLimitViolation,
 					"limit_type", "jwt_traffic",
 					"actor", identity.CallerID,
 					"timestamp", time.Now().UTC().Format(time.RFC3339),
@@ -129,7 +274,7 @@ func rateLimitMiddleware(rl *RateLimiter, logger *Logger, next http.Handler) htt
 				WriteError(w, http.StatusTooManyRequests, "Too many requests")
 				return
 			}
-		case CredentialTypeAPIKey:
+		case identity.CredentialType == CredentialTypeAPIKey:
 			bucket := identity.CallerID
 			limit := identity.RateLimit
 			if limit < 1 {
@@ -138,8 +283,11 @@ func rateLimitMiddleware(rl *RateLimiter, logger *Logger, next http.Handler) htt
 			if identity.IsWebsite {
 				bucket = fmt.Sprintf("%s:%s", identity.CallerID, clientIP(r))
 			}
-			if !rl.AllowAPIKeyWithLimit(bucket, limit) {
-				logger.AuditEvent(AuditRateLimitViolation,
+			allowed := rl.AllowAPIKeyWithLimit(bucket, limit)
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(rl.APIKeyRemaining(bucket, limit)))
+			if !allowed {
+				logger.AuditEventContext(r.Context(), AuditRateLimitViolation,
 					"limit_type", "apikey_traffic",
 					"actor", bucket,
 					"timestamp", time.Now().UTC().Format(time.RFC3339),
@@ -149,6 +297,27 @@ func rateLimitMiddleware(rl *RateLimiter, logger *Logger, next http.Handler) htt
 			}
 		}
 
+		if bucket, allowed := rl.AllowRoute(routeName(r.URL.Path), caller); !allowed {
+			logger.AuditEventContext(r.Context(), AuditRateLimitViolation,
+				"limit_type", "route_traffic",
+				"actor", bucket,
+				"timestamp", time.Now().UTC().Format(time.RFC3339),
+			)
+			WriteError(w, http.StatusTooManyRequests, "Too many requests")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// schemaSyncMiddleware refreshes the schema registry before the request is
+// handled when another Moon instance has published a newer schema version.
+// Sync failures are ignored so the request is served from the current
+// registry state.
+func schemaSyncMiddleware(registry *SchemaRegistry, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = registry.SyncVersion(r.Context())
 		next.ServeHTTP(w, r)
 	})
 }
@@ -2,9 +2,13 @@ package main
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -62,7 +66,7 @@ func TestCORSMiddleware_Enabled(t *testing.T) {
 	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})
-	handler := corsMiddleware(cfg, inner)
+	handler := corsMiddleware(NewCORSPolicy(cfg), inner)
 
 	t.Run("adds CORS headers", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/test", nil)
@@ -105,7 +109,7 @@ func TestCORSMiddleware_Disabled(t *testing.T) {
 	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})
-	handler := corsMiddleware(cfg, inner)
+	handler := corsMiddleware(NewCORSPolicy(cfg), inner)
 
 	req := httptest.NewRequest(http.MethodGet, "/test", nil)
 	req.Header.Set("Origin", "http://example.com")
@@ -122,7 +126,7 @@ func TestCORSMiddleware_SpecificOrigins(t *testing.T) {
 	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})
-	handler := corsMiddleware(cfg, inner)
+	handler := corsMiddleware(NewCORSPolicy(cfg), inner)
 
 	t.Run("matching origin", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/test", nil)
@@ -147,6 +151,69 @@ func TestCORSMiddleware_SpecificOrigins(t *testing.T) {
 	})
 }
 
+func TestCORSMiddleware_Preflight(t *testing.T) {
+	cfg := CORSConfig{
+		Enabled:        true,
+		AllowedOrigins: []string{"http://public.com"},
+		CORSRules: CORSRules{
+			AllowedMethods: []string{"GET", "POST", "OPTIONS"},
+			AllowedHeaders: []string{"Authorization", "Content-Type"},
+			MaxAge:         600,
+		},
+		Origins: map[string]CORSRules{
+			"https://App.example.com": {
+				AllowedMethods:   []string{"POST"},
+				AllowedHeaders:   []string{"Authorization", "Content-Type", "X-Request-ID"},
+				AllowCredentials: true,
+			},
+		},
+	}
+	called := false
+	handler := corsMiddleware(NewCORSPolicy(cfg), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	preflight := func(origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodOptions, "/data/products:mutate", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := preflight("http://public.com")
+	h := w.Header()
+	if w.Code != http.StatusOK || called {
+		t.Fatalf("expected the preflight to be answered directly, got %d (handler called: %v)", w.Code, called)
+	}
+	if h.Get("Access-Control-Allow-Methods") != "GET, POST, OPTIONS" || h.Get("Access-Control-Allow-Headers") != "Authorization, Content-Type" ||
+		h.Get("Access-Control-Max-Age") != "600" || h.Get("Access-Control-Allow-Credentials") != "" || h.Get("Vary") != "Origin" {
+		t.Fatalf("unexpected preflight headers %v", h)
+	}
+
+	w = preflight("https://app.example.com")
+	h = w.Header()
+	if h.Get("Access-Control-Allow-Origin") != "https://app.example.com" || h.Get("Access-Control-Allow-Methods") != "POST" ||
+		h.Get("Access-Control-Allow-Headers") != "Authorization, Content-Type, X-Request-ID" ||
+		h.Get("Access-Control-Allow-Credentials") != "true" || h.Get("Access-Control-Max-Age") != "" {
+		t.Fatalf("expected the per-origin rules, got %v", h)
+	}
+
+	w = preflight("http://other.com")
+	if w.Header().Get("Access-Control-Allow-Origin") != "" || w.Header().Get("Access-Control-Allow-Methods") != "" {
+		t.Fatalf("expected no grant for an unlisted origin, got %v", w.Header())
+	}
+
+	// Only the origin and credentials go on the actual response.
+	req := httptest.NewRequest(http.MethodPost, "/data/products:mutate", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if !called || rec.Header().Get("Access-Control-Allow-Credentials") != "true" || rec.Header().Get("Access-Control-Allow-Methods") != "" {
+		t.Fatalf("unexpected response headers %v", rec.Header())
+	}
+}
+
 func TestWebsiteAPIKeyMiddleware(t *testing.T) {
 	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -192,7 +259,7 @@ func TestPanicRecoveryMiddleware(t *testing.T) {
 	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		panic("test panic")
 	})
-	handler := panicRecoveryMiddleware(logger, inner)
+	handler := panicRecoveryMiddleware(logger, nil, inner)
 
 	req := httptest.NewRequest(http.MethodGet, "/test", nil)
 	w := httptest.NewRecorder()
@@ -211,19 +278,111 @@ func TestPanicRecoveryMiddleware(t *testing.T) {
 	}
 }
 
-func TestAuditContextMiddleware(t *testing.T) {
-	logger := middlewareTestLogger()
+func TestRequestIDMiddleware(t *testing.T) {
+	var seen string
+	handler := requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+	}))
+
+	tests := []struct {
+		name    string
+		inbound string
+		keep    bool
+	}{
+		{"generated", "", false},
+		{"propagated", "edge-7f3a:01", true},
+		{"invalid characters", "bad id\n", false},
+		{"too long", strings.Repeat("a", MaxRequestIDLength+1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			if tt.inbound != "" {
+				req.Header.Set(RequestIDHeader, tt.inbound)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			got := w.Header().Get(RequestIDHeader)
+			if got == "" || got != seen {
+				t.Fatalf("header %q and context %q should match and be set", got, seen)
+			}
+			if (got == tt.inbound) != tt.keep {
+				t.Fatalf("inbound %q: got %q, keep=%v", tt.inbound, got, tt.keep)
+			}
+		})
+	}
+}
+
+func TestHSTSMiddleware(t *testing.T) {
+	handler := hstsMiddleware(600, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if got := w.Header().Get("Strict-Transport-Security"); got != "" {
+		t.Fatalf("expected no HSTS header over plain HTTP, got %q", got)
+	}
+
+	req.TLS = &tls.ConnectionState{}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if got := w.Header().Get("Strict-Transport-Security"); got != "max-age=600" {
+		t.Fatalf("expected max-age=600 over TLS, got %q", got)
+	}
+}
+
+func TestBodyLimitMiddleware(t *testing.T) {
+	t.Cleanup(func() { liveLimits.Store(nil) })
+	limits := requestLimits()
+	limits.MaxRequestBody = MinRequestBodyBytes
+	SetRequestLimits(limits)
+
+	var readErr error
+	handler := bodyLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, readErr = io.ReadAll(r.Body)
+	}))
+
+	body := strings.Repeat("x", MinRequestBodyBytes+1)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/test", strings.NewReader(body)))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for a large Content-Length, got %d", w.Code)
+	}
+
+	// Without a Content-Length the body is cut off at the limit.
+	req := httptest.NewRequest(http.MethodPost, "/test", io.NopCloser(strings.NewReader(body)))
+	req.ContentLength = -1
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	var maxErr *http.MaxBytesError
+	if !errors.As(readErr, &maxErr) {
+		t.Fatalf("expected a MaxBytesError, got %v", readErr)
+	}
+
+	readErr = nil
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/test", strings.NewReader(body[1:])))
+	if readErr != nil {
+		t.Fatalf("expected a body at the limit to be read, got %v", readErr)
+	}
+}
+
+func TestAuditContextMiddleware_LogsRequestID(t *testing.T) {
+	var buf bytes.Buffer
 	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})
-	handler := auditContextMiddleware(logger, inner)
+	handler := requestIDMiddleware(auditContextMiddleware(NewTestLogger(&buf), inner))
 
 	req := httptest.NewRequest(http.MethodGet, "/test", nil)
-	w := httptest.NewRecorder()
-	handler.ServeHTTP(w, req)
+	req.Header.Set(RequestIDHeader, "req-123")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
 
-	if got := w.Header().Get("X-Request-ID"); got == "" {
-		t.Fatal("expected X-Request-ID header to be set")
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("decode log line: %v", err)
+	}
+	if entry["event"] != "http.request" || entry["request_id"] != "req-123" {
+		t.Fatalf("expected http.request event with request_id, got %v", entry)
 	}
 }
 
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ---------------------------------------------------------------------------
+// OpenID Connect provider
+//
+// OIDCProvider runs the authorization code flow with PKCE against the
+// configured issuer. Nothing is stored between op=start and op=callback:
+// the nonce and PKCE verifier travel in the state parameter, sealed with a
+// key derived from jwt_secret. The issuer's discovery document is fetched
+// once and its signing keys whenever an ID token names an unknown key.
+// ---------------------------------------------------------------------------
+
+// errOIDCLogin reports a callback that cannot complete a login: a bad or
+// expired state, a code the issuer rejects, or an invalid ID token.
+var errOIDCLogin = errors.New("oidc login failed")
+
+// OIDCProvider signs users in with the identity provider of an OIDCConfig.
+type OIDCProvider struct {
+	cfg       OIDCConfig
+	jwtSecret string
+	client    *http.Client
+
+	mu          sync.Mutex
+	discovery   *oidcDiscovery
+	keys        map[string]any // kid to *rsa.PublicKey or *ecdsa.PublicKey
+	keysFetched time.Time
+}
+
+// oidcDiscovery holds the fields Moon uses from the issuer's
+// /.well-known/openid-configuration document.
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcState is the sealed content of the state parameter.
+type oidcState struct {
+	Nonce    string `json:"n"`
+	Verifier string `json:"v"`
+	Expires  int64  `json:"e"`
+}
+
+// oidcClaims are the ID token claims used to find or create the local user.
+type oidcClaims struct {
+	jwt.RegisteredClaims
+	Nonce             string `json:"nonce"`
+	AuthorizedParty   string `json:"azp"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+// NewOIDCProvider creates an OIDCProvider for cfg, or returns nil when OIDC
+// login is not configured.
+func NewOIDCProvider(cfg OIDCConfig, jwtSecret string) *OIDCProvider {
+	if cfg.Issuer == "" {
+		return nil
+	}
+	return &OIDCProvider{
+		cfg:       cfg,
+		jwtSecret: jwtSecret,
+		client:    &http.Client{Timeout: OIDCTimeoutSeconds * time.Second},
+	}
+}
+
+// AuthorizationURL starts a login and returns the issuer URL to send the
+// user to, and the state the client should expect back with the code.
+func (p *OIDCProvider) AuthorizationURL(ctx context.Context, now time.Time) (string, string, error) {
+	d, err := p.fetchDiscovery(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	st := oidcState{Nonce: randomURLString(), Verifier: randomURLString(), Expires: now.Unix() + OIDCStateTTLSeconds}
+	payload, _ := json.Marshal(st)
+	state, err := sealSecret(p.jwtSecret, "oidc", payload)
+	if err != nil {
+		return "", "", err
+	}
+	challenge := sha256.Sum256([]byte(st.Verifier))
+
+	u, err := url.Parse(d.AuthorizationEndpoint)
+	if err != nil {
+		return "", "", fmt.Errorf("oidc: authorization endpoint: %w", err)
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.cfg.ClientID)
+	q.Set("redirect_uri", p.cfg.RedirectURI)
+	q.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", st.Nonce)
+	q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+	return u.String(), state, nil
+}
+
+// Exchange completes a login: it checks state, redeems code at the token
+// endpoint, and returns the verified ID token claims.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, state string, now time.Time) (*oidcClaims, error) {
+	payload, err := openSecret(p.jwtSecret, "oidc", state)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid state", errOIDCLogin)
+	}
+	var st oidcState
+	if err := json.Unmarshal(payload, &st); err != nil || now.Unix() > st.Expires {
+		return nil, fmt.Errorf("%w: expired state", errOIDCLogin)
+	}
+	d, err := p.fetchDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURI},
+		"code_verifier": {st.Verifier},
+	}
+	if p.cfg.ClientSecret == "" {
+		form.Set("client_id", p.cfg.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("oidc: token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	status, err := p.doJSON(req, &tokens)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK || tokens.IDToken == "" {
+		return nil, fmt.Errorf("%w: token endpoint returned %d", errOIDCLogin, status)
+	}
+	return p.verifyIDToken(ctx, tokens.IDToken, st.Nonce, now)
+}
+
+// verifyIDToken checks the signature, issuer, audience, expiry, and nonce
+// of an ID token.
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, raw, nonce string, now time.Time) (*oidcClaims, error) {
+	claims := &oidcClaims{}
+	var keyErr error
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := p.signingKey(ctx, kid)
+		keyErr = err
+		return key, err
+	},
+		jwt.WithValidMethods([]string{"RS256", "ES256"}),
+		jwt.WithIssuer(p.cfg.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(OIDCClockSkewSeconds*time.Second),
+		jwt.WithTimeFunc(func() time.Time { return now }),
+	)
+	if keyErr != nil && !errors.Is(keyErr, errOIDCLogin) {
+		return nil, keyErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errOIDCLogin, err)
+	}
+	if claims.Subject == "" || claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: id token subject or nonce mismatch", errOIDCLogin)
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.cfg.ClientID {
+		return nil, fmt.Errorf("%w: id token azp mismatch", errOIDCLogin)
+	}
+	return claims, nil
+}
+
+// fetchDiscovery returns the issuer's discovery document, fetching it on
+// first use.
+func (p *OIDCProvider) fetchDiscovery(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	d := p.discovery
+	p.mu.Unlock()
+	if d != nil {
+		return d, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.cfg.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: discovery: %w", err)
+	}
+	d = &oidcDiscovery{}
+	status, err := p.doJSON(req, d)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("oidc: discovery returned %d", status)
+	}
+	if strings.TrimRight(d.Issuer, "/") != p.cfg.Issuer || d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc: discovery document for %s is incomplete or names another issuer", p.cfg.Issuer)
+	}
+
+	p.mu.Lock()
+	p.discovery = d
+	p.mu.Unlock()
+	return d, nil
+}
+
+// signingKey returns the issuer key with id kid, refetching the key set
+// when kid is unknown and the last fetch is at least
+// OIDCKeysRefreshSeconds old.
+func (p *OIDCProvider) signingKey(ctx context.Context, kid string) (any, error) {
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	stale := time.Since(p.keysFetched) >= OIDCKeysRefreshSeconds*time.Second
+	p.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+	if !stale {
+		return nil, fmt.Errorf("%w: unknown signing key %q", errOIDCLogin, kid)
+	}
+
+	d, err := p.fetchDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.JWKSURI, nil)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: jwks: %w", err)
+	}
+	var set struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	status, err := p.doJSON(req, &set)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("oidc: jwks returned %d", status)
+	}
+	keys := make(map[string]any, len(set.Keys))
+	for _, raw := range set.Keys {
+		if id, k, ok := parseJWK(raw); ok {
+			keys[id] = k
+		}
+	}
+
+	p.mu.Lock()
+	p.keys, p.keysFetched = keys, time.Now()
+	p.mu.Unlock()
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: unknown signing key %q", errOIDCLogin, kid)
+}
+
+// doJSON sends req and decodes a JSON response body into out. It returns
+// the response status; out is only filled for 200 responses.
+func (p *OIDCProvider) doJSON(req *http.Request, out any) (int, error) {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("oidc: %s: %w", req.URL.Host, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return resp.StatusCode, nil
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, MaxRequestBodyBytes)).Decode(out); err != nil {
+		return 0, fmt.Errorf("oidc: %s: invalid JSON: %w", req.URL.Host, err)
+	}
+	return resp.StatusCode, nil
+}
+
+// parseJWK converts an RSA or P-256 signing key from a JWK set. Keys of
+// other types, or marked for encryption, are skipped.
+func parseJWK(raw json.RawMessage) (string, any, bool) {
+	var k struct {
+		Kid string `json:"kid"`
+		Kty string `json:"kty"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		Crv string `json:"crv"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	}
+	if json.Unmarshal(raw, &k) != nil || (k.Use != "" && k.Use != "sig") {
+		return "", nil, false
+	}
+	decode := func(s string) *big.Int {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil || len(b) == 0 {
+			return nil
+		}
+		return new(big.Int).SetBytes(b)
+	}
+	switch k.Kty {
+	case "RSA":
+		n, e := decode(k.N), decode(k.E)
+		if n == nil || e == nil || !e.IsInt64() {
+			return "", nil, false
+		}
+		return k.Kid, &rsa.PublicKey{N: n, E: int(e.Int64())}, true
+	case "EC":
+		x, y := decode(k.X), decode(k.Y)
+		if k.Crv != "P-256" || x == nil || y == nil || !elliptic.P256().IsOnCurve(x, y) {
+			return "", nil, false
+		}
+		return k.Kid, &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, true
+	}
+	return "", nil, false
+}
+
+// randomURLString returns 32 random bytes, base64url-encoded, for nonces
+// and PKCE verifiers.
+func randomURLString() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"net/http"
+)
+
+// OpenAPIHandler implements GET /openapi.json. The document is assembled from
+// the SchemaRegistry on every request, so it always reflects the current
+// collections without a separate refresh step.
+type OpenAPIHandler struct {
+	registry *SchemaRegistry
+	prefix   string
+}
+
+// NewOpenAPIHandler creates an OpenAPIHandler with the given dependencies.
+func NewOpenAPIHandler(registry *SchemaRegistry, prefix string) *OpenAPIHandler {
+	return &OpenAPIHandler{registry: registry, prefix: prefix}
+}
+
+// HandleSpec writes the OpenAPI 3.1 document. API key callers only see the
+// collections in their allowlist.
+func (h *OpenAPIHandler) HandleSpec(w http.ResponseWriter, r *http.Request) {
+	collections := filterCollectionsByIdentity(r.Context(), h.registry.List())
+	WriteJSON(w, http.StatusOK, buildOpenAPIDocument(h.prefix, collections))
+}
+
+// buildOpenAPIDocument assembles the OpenAPI document for the fixed endpoint
+// surface plus one set of resource paths per collection.
+func buildOpenAPIDocument(prefix string, collections []*Collection) map[string]any {
+	paths := map[string]any{
+		prefix + "/health": map[string]any{
+			"get": openAPIPublic(openAPIOperation("Service health", nil, nil, "200")),
+		},
+		prefix + "/version": map[string]any{
+			"get": openAPIOperation("Build details and current schema version", nil, nil, "200"),
+		},
+		prefix + "/auth:session": map[string]any{
+			"post": openAPIPublic(openAPIOperation("Login, refresh, or logout", nil, openAPIRef("ActionRequest"), "200")),
+		},
+		prefix + "/auth:oidc": map[string]any{
+			"post": openAPIPublic(openAPIOperation("Start or complete an OpenID Connect login", nil, openAPIRef("ActionRequest"), "200")),
+		},
+		prefix + "/auth:forgot": map[string]any{
+			"post": openAPIPublic(openAPIOperation("Email a password reset token", nil, map[string]any{"type": "object"}, "200")),
+		},
+		prefix + "/auth:reset": map[string]any{
+			"post": openAPIPublic(openAPIOperation("Set a new password with a reset token", nil, map[string]any{"type": "object"}, "200")),
+		},
+		prefix + "/auth:accept_invite": map[string]any{
+			"post": openAPIPublic(openAPIOperation("Accept an invitation and set a password", nil, map[string]any{"type": "object"}, "200")),
+		},
+		prefix + "/auth:me": map[string]any{
+			"get":  openAPIOperation("Get the current authenticated user", nil, nil, "200"),
+			"post": openAPIOperation("Update the current authenticated user", nil, map[string]any{"type": "object"}, "200"),
+		},
+		prefix + "/auth:keys": map[string]any{
+			"get":  openAPIOperation("List the current user's personal API keys", []any{openAPIQueryParam("all", "boolean")}, nil, "200"),
+			"post": openAPIOperation("Create, rotate, or destroy personal API keys", nil, map[string]any{"type": "object"}, "200"),
+		},
+		prefix + "/auth:sessions": map[string]any{
+			"get":  openAPIOperation("List the current user's active sessions", []any{openAPIQueryParam("user_id", "string")}, nil, "200"),
+			"post": openAPIOperation("Revoke sessions", nil, map[string]any{"type": "object"}, "200"),
+		},
+		prefix + "/auth:2fa": map[string]any{
+			"get":  openAPIOperation("Get the current user's two-factor status", nil, nil, "200"),
+			"post": openAPIOperation("Set up, verify, or disable two-factor authentication", nil, map[string]any{"type": "object"}, "200"),
+		},
+		prefix + "/batch": map[string]any{
+			"post": openAPIOperation("Apply record operations across collections in one transaction", nil, map[string]any{"type": "object"}, "200"),
+		},
+		prefix + "/collections:query": map[string]any{
+			"get": openAPIOperation("List collections or get one by name", openAPIListParams("name"), nil, "200"),
+		},
+		prefix + "/collections:mutate": map[string]any{
+			"post": openAPIOperation("Create, update, or destroy collections", nil, openAPIRef("MutateRequest"), "200"),
+		},
+		prefix + "/collections:refresh": map[string]any{
+			"post": openAPIOperation("Reload collections from the database", nil, nil, "200"),
+		},
+		prefix + "/collections:indexes": map[string]any{
+			"get":  openAPIOperation("List the indexes of a collection", []any{openAPIQueryParam("name", "string")}, nil, "200"),
+			"post": openAPIOperation("Create or drop collection indexes", nil, map[string]any{"type": "object"}, "200"),
+		},
+		prefix + "/collections:migrations": map[string]any{
+			"get": openAPIOperation("Report the progress of column migrations", []any{openAPIQueryParam("name", "string")}, nil, "200"),
+		},
+		prefix + "/collections:rename": map[string]any{
+			"post": openAPIOperation("Rename collections", nil, map[string]any{"type": "object"}, "200"),
+		},
+	}
+
+	schemas := map[string]any{
+		"Error": map[string]any{
+			"type":     "object",
+			"required": []string{"code", "message"},
+			"properties": map[string]any{
+				"code":    map[string]any{"type": "string"},
+				"message": map[string]any{"type": "string"},
+				"details": map[string]any{
+					"type": "array",
+					"items": map[string]any{
+						"type":     "object",
+						"required": []string{"field", "message"},
+						"properties": map[string]any{
+							"field":   map[string]any{"type": "string"},
+							"message": map[string]any{"type": "string"},
+							"example": map[string]any{},
+						},
+					},
+				},
+				"request_id": map[string]any{"type": "string"},
+			},
+		},
+		"ActionRequest": map[string]any{
+			"type":     "object",
+			"required": []string{"op", "data"},
+			"properties": map[string]any{
+				"op":   map[string]any{"type": "string"},
+				"data": map[string]any{"type": "object"},
+			},
+		},
+		"MutateRequest": map[string]any{
+			"type":     "object",
+			"required": []string{"op", "data"},
+			"properties": map[string]any{
+				"op":     map[string]any{"type": "string", "enum": []string{"create", "update", "destroy", "action"}},
+				"data":   map[string]any{"type": "array", "items": map[string]any{"type": "object"}},
+				"action": map[string]any{"type": "string"},
+			},
+		},
+		"UpsertRequest": map[string]any{
+			"type":     "object",
+			"required": []string{"data"},
+			"properties": map[string]any{
+				"data": map[string]any{"type": "array", "items": map[string]any{"type": "object"}},
+				"on":   map[string]any{"type": "string"},
+				"mode": map[string]any{"type": "string", "enum": []string{"atomic", "best_effort"}},
+			},
+		},
+		"WhereRequest": map[string]any{
+			"type":     "object",
+			"required": []string{"filter"},
+			"properties": map[string]any{
+				"filter":        map[string]any{"type": "object"},
+				"data":          map[string]any{"type": "object"},
+				"confirm_count": map[string]any{"type": "integer", "minimum": 0},
+				"dry_run":       map[string]any{"type": "boolean"},
+			},
+		},
+	}
+
+	for _, col := range collections {
+		base := prefix + "/data/" + col.Name
+		paths[base+":query"] = map[string]any{
+			"get": openAPIOperation("List "+col.Name+" records or get one by id",
+				append(openAPIListParams("id"), openAPIQueryParam("after", "string"), openAPIQueryParam("before", "string")), nil, "200", col.Name),
+		}
+		paths[base+":mutate"] = map[string]any{
+			"post": openAPIOperation("Create, update, destroy, or run an action on "+col.Name,
+				nil, openAPIRef("MutateRequest"), "200", col.Name),
+		}
+		paths[base+":schema"] = map[string]any{
+			"get": openAPIOperation("Read the "+col.Name+" schema", nil, nil, "200"),
+		}
+		if !col.System {
+			paths[base+":export"] = map[string]any{
+				"get": openAPIOperation("Export "+col.Name+" records as CSV or NDJSON",
+					[]any{openAPIQueryParam("format", "string"), openAPIQueryParam("sort", "string")}, nil, "200"),
+			}
+			paths[base+":import"] = map[string]any{
+				"post": openAPIOperation("Import "+col.Name+" records from CSV or NDJSON",
+					[]any{openAPIQueryParam("format", "string"), openAPIQueryParam("mode", "string")}, nil, "201"),
+			}
+			paths[base+":upsert"] = map[string]any{
+				"post": openAPIOperation("Create or update "+col.Name+" records matched by id or a unique field",
+					nil, openAPIRef("UpsertRequest"), "200", col.Name),
+			}
+			paths[base+":updateWhere"] = map[string]any{
+				"post": openAPIOperation("Update the "+col.Name+" records matching a filter",
+					nil, openAPIRef("WhereRequest"), "200"),
+			}
+			paths[base+":destroyWhere"] = map[string]any{
+				"post": openAPIOperation("Destroy the "+col.Name+" records matching a filter",
+					nil, openAPIRef("WhereRequest"), "200"),
+			}
+			paths[base+":quality"] = map[string]any{
+				"get": openAPIOperation("Check "+col.Name+" records against data-quality rules",
+					[]any{openAPIQueryParam("required", "string"), openAPIQueryParam("pattern", "string"), openAPIQueryParam("ref", "string")}, nil, "200"),
+			}
+			if hasAttributes(col) {
+				paths[base+":attributes"] = map[string]any{
+					"post": openAPIOperation("Define or remove flex attributes of "+col.Name, nil, nil, "201"),
+				}
+			}
+			paths[base+":render"] = map[string]any{
+				"get": openAPIOperation("Render a "+col.Name+" record with a document template",
+					[]any{openAPIQueryParam("id", "string"), openAPIQueryParam("template", "string")}, nil, "200"),
+			}
+			paths[base+":qrcode"] = map[string]any{
+				"get": openAPIOperation("Encode a "+col.Name+" field as a QR code",
+					[]any{openAPIQueryParam("id", "string"), openAPIQueryParam("field", "string"), openAPIQueryParam("format", "string")}, nil, "200"),
+			}
+		}
+		schemas[col.Name] = openAPICollectionSchema(col)
+	}
+
+	return map[string]any{
+		"openapi": OpenAPIVersion,
+		"info": map[string]any{
+			"title":   OpenAPITitle,
+			"version": MoonVersion,
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": schemas,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{"type": "http", "scheme": "bearer"},
+			},
+		},
+		"security": []any{map[string]any{"bearerAuth": []string{}}},
+	}
+}
+
+// openAPIOperation builds one operation object. When record is set, the
+// success response carries an array of that collection's schema in data.
+func openAPIOperation(summary string, params []any, body map[string]any, status string, record ...string) map[string]any {
+	data := map[string]any{"type": "array", "items": map[string]any{}}
+	if len(record) > 0 {
+		data["items"] = openAPIRef(record[0])
+	}
+	op := map[string]any{
+		"summary": summary,
+		"responses": map[string]any{
+			status: openAPIJSONContent("Success", map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"message": map[string]any{"type": "string"},
+					"data":    data,
+					"meta":    map[string]any{"type": "object"},
+					"links":   map[string]any{"type": "object"},
+				},
+			}),
+			"default": openAPIJSONContent("Error", openAPIRef("Error")),
+		},
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+	if body != nil {
+		op["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{"application/json": map[string]any{"schema": body}},
+		}
+	}
+	return op
+}
+
+// openAPIPublic marks an operation as not requiring authentication.
+func openAPIPublic(op map[string]any) map[string]any {
+	op["security"] = []any{}
+	return op
+}
+
+// openAPIListParams returns the shared query options plus the get-one key.
+func openAPIListParams(key string) []any {
+	params := []any{openAPIQueryParam(key, "string")}
+	for _, name := range []string{"page", "per_page"} {
+		params = append(params, openAPIQueryParam(name, "integer"))
+	}
+	for _, name := range []string{"sort", "q", "fields"} {
+		params = append(params, openAPIQueryParam(name, "string"))
+	}
+	return params
+}
+
+func openAPIQueryParam(name, typ string) map[string]any {
+	return map[string]any{
+		"name":   name,
+		"in":     "query",
+		"schema": map[string]any{"type": typ},
+	}
+}
+
+func openAPIRef(name string) map[string]any {
+	return map[string]any{"$ref": "#/components/schemas/" + name}
+}
+
+func openAPIJSONContent(description string, schema map[string]any) map[string]any {
+	return map[string]any{
+		"description": description,
+		"content":     map[string]any{"application/json": map[string]any{"schema": schema}},
+	}
+}
+
+// openAPICollectionSchema converts a collection's API-visible fields into a
+// JSON Schema object.
+func openAPICollectionSchema(col *Collection) map[string]any {
+	props := make(map[string]any)
+	required := []string{}
+	for _, f := range col.APIFields() {
+		prop := openAPIFieldSchema(f.Type)
+		if !f.Nullable {
+			required = append(required, f.Name)
+		}
+		if t, ok := prop["type"]; ok && f.Nullable {
+			prop["type"] = []any{t, "null"}
+		}
+		if f.ReadOnly {
+			prop["readOnly"] = true
+		}
+		addOpenAPIRules(prop, f.Rules)
+		props[f.Name] = prop
+	}
+	return map[string]any{
+		"type":       "object",
+		"required":   required,
+		"properties": props,
+	}
+}
+
+// addOpenAPIRules maps field rules to the equivalent JSON Schema keywords.
+func addOpenAPIRules(prop map[string]any, r FieldRules) {
+	if r.Min != nil {
+		prop["minimum"] = *r.Min
+	}
+	if r.Max != nil {
+		prop["maximum"] = *r.Max
+	}
+	if r.MinLength != nil {
+		prop["minLength"] = *r.MinLength
+	}
+	if r.MaxLength != nil {
+		prop["maxLength"] = *r.MaxLength
+	}
+	if len(r.Enum) > 0 {
+		prop["enum"] = r.Enum
+	}
+}
+
+// openAPIFieldSchema maps a Moon field type to its JSON wire representation.
+func openAPIFieldSchema(moonType string) map[string]any {
+	switch moonType {
+	case MoonFieldTypeInteger:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case MoonFieldTypeDecimal:
+		return map[string]any{"type": "string", "format": "decimal"}
+	case MoonFieldTypeBoolean:
+		return map[string]any{"type": "boolean"}
+	case MoonFieldTypeDatetime:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case MoonFieldTypeJSON:
+		return map[string]any{} // any JSON value
+	default:
+		return map[string]any{"type": "string"}
+	}
+}
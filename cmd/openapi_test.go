@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func getOpenAPIDocument(t *testing.T, h *OpenAPIHandler, identity *AuthIdentity) map[string]any {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/openapi.json", nil)
+	if identity != nil {
+		req = req.WithContext(SetAuthIdentity(req.Context(), identity))
+	}
+	w := httptest.NewRecorder()
+	h.HandleSpec(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("decode document: %v", err)
+	}
+	return doc
+}
+
+func TestOpenAPI_DocumentShape(t *testing.T) {
+	_, _, registry := setupResourceQueryTest(t)
+	h := NewOpenAPIHandler(registry, "")
+
+	doc := getOpenAPIDocument(t, h, &AuthIdentity{CallerID: "admin-001", Role: "admin", CredentialType: CredentialTypeJWT})
+
+	if doc["openapi"] != OpenAPIVersion {
+		t.Errorf("expected openapi %q, got %v", OpenAPIVersion, doc["openapi"])
+	}
+	paths := doc["paths"].(map[string]any)
+	for _, p := range []string{
+		"/auth:session", "/auth:oidc", "/auth:forgot", "/auth:reset", "/auth:accept_invite", "/auth:keys", "/auth:sessions", "/auth:2fa", "/batch", "/collections:query", "/collections:mutate",
+		"/collections:rename", "/collections:indexes",
+		"/data/products:query", "/data/products:mutate", "/data/products:schema",
+		"/data/products:export", "/data/products:import", "/data/products:render", "/data/products:qrcode",
+		"/data/users:query", "/data/apikeys:query",
+	} {
+		if _, ok := paths[p]; !ok {
+			t.Errorf("missing path %s", p)
+		}
+	}
+
+	schemas := doc["components"].(map[string]any)["schemas"].(map[string]any)
+	products := schemas["products"].(map[string]any)["properties"].(map[string]any)
+	tests := []struct {
+		field    string
+		wantType any
+	}{
+		{"price", "string"},
+		{"quantity", "integer"},
+		{"active", "boolean"},
+	}
+	for _, tt := range tests {
+		prop, ok := products[tt.field].(map[string]any)
+		if !ok {
+			t.Errorf("products schema missing %s", tt.field)
+			continue
+		}
+		if prop["type"] != tt.wantType {
+			t.Errorf("%s: expected type %v, got %v", tt.field, tt.wantType, prop["type"])
+		}
+	}
+	if desc := products["description"].(map[string]any); len(desc["type"].([]any)) != 2 {
+		t.Errorf("expected nullable description to allow null, got %v", desc["type"])
+	}
+
+	if _, ok := paths["/data/users:export"]; ok {
+		t.Error("system collections must not advertise export")
+	}
+
+	users := schemas["users"].(map[string]any)["properties"].(map[string]any)
+	if _, ok := users["password_hash"]; ok {
+		t.Error("users schema must not expose password_hash")
+	}
+}
+
+func TestOpenAPI_APIKeyAllowlist(t *testing.T) {
+	_, _, registry := setupResourceQueryTest(t)
+	h := NewOpenAPIHandler(registry, "")
+
+	doc := getOpenAPIDocument(t, h, &AuthIdentity{
+		CallerID:       "key-001",
+		Role:           "user",
+		CredentialType: CredentialTypeAPIKey,
+		Collections:    []string{"products"},
+	})
+
+	paths := doc["paths"].(map[string]any)
+	if _, ok := paths["/data/products:query"]; !ok {
+		t.Error("expected allowlisted collection in paths")
+	}
+	if _, ok := paths["/data/users:query"]; ok {
+		t.Error("expected users to be hidden from API key outside its allowlist")
+	}
+}
+
+func TestOpenAPI_ReflectsRegistryChanges(t *testing.T) {
+	_, adapter, registry := setupResourceQueryTest(t)
+	h := NewOpenAPIHandler(registry, "/api")
+
+	if err := adapter.ExecDDL(context.Background(), `CREATE TABLE orders (id TEXT PRIMARY KEY, total INTEGER NOT NULL)`); err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+	if err := registry.Refresh(); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	doc := getOpenAPIDocument(t, h, nil)
+	paths := doc["paths"].(map[string]any)
+	if _, ok := paths["/api/data/orders:query"]; !ok {
+		t.Error("expected new collection after refresh")
+	}
+}
+
+func TestOpenAPI_RequiresAuthentication(t *testing.T) {
+	handler, _, _ := buildAuthenticatedCollectionHandler(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/openapi.json", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/openapi.json", nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken(t, collectionTestSecret))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 with token, got %d: %s", w.Code, w.Body.String())
+	}
+}
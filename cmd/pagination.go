@@ -0,0 +1,124 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// parsePagination extracts page and per_page from query parameters,
+// applying the limits.default_per_page and limits.max_per_page in force.
+func parsePagination(r *http.Request) (page, perPage int) {
+	limits := requestLimits()
+	page = 1
+	perPage = limits.DefaultPerPage
+
+	if v := r.URL.Query().Get("page"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 1 {
+			page = n
+		}
+	}
+	if v := r.URL.Query().Get("per_page"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 1 {
+			perPage = n
+			if perPage > limits.MaxPerPage {
+				perPage = limits.MaxPerPage
+			}
+		}
+	}
+	return page, perPage
+}
+
+// buildPagination returns the standard list meta and links for one page of
+// results. Every list endpoint uses it so the meta fields stay identical.
+func buildPagination(basePath string, q url.Values, total, count, page, perPage int) (map[string]any, map[string]any) {
+	totalPages := 1
+	if total > 0 {
+		totalPages = int(math.Ceil(float64(total) / float64(perPage)))
+	}
+	meta := map[string]any{
+		"total":        total,
+		"count":        count,
+		"per_page":     perPage,
+		"current_page": page,
+		"total_pages":  totalPages,
+	}
+	return meta, buildPaginationLinks(basePath, page, perPage, totalPages, q)
+}
+
+// buildPaginationLinks builds the first, last, prev, and next links. Every
+// query parameter other than page and per_page is preserved, so sort,
+// filter, q, and fields carry over between pages.
+func buildPaginationLinks(basePath string, page, perPage, totalPages int, q url.Values) map[string]any {
+	linkURL := func(p int) string {
+		params := url.Values{}
+		params.Set("page", strconv.Itoa(p))
+		params.Set("per_page", strconv.Itoa(perPage))
+		for key, vals := range q {
+			if key == "page" || key == "per_page" {
+				continue
+			}
+			for _, v := range vals {
+				params.Add(key, v)
+			}
+		}
+		return basePath + "?" + params.Encode()
+	}
+
+	links := map[string]any{
+		"first": linkURL(1),
+		"last":  linkURL(totalPages),
+	}
+
+	if page > 1 {
+		links["prev"] = linkURL(page - 1)
+	} else {
+		links["prev"] = nil
+	}
+
+	if page < totalPages {
+		links["next"] = linkURL(page + 1)
+	} else {
+		links["next"] = nil
+	}
+
+	return links
+}
+
+// buildCursorPagination returns the meta and links for a cursor page. prev
+// and next are the cursor ids for the neighbouring pages, or "" when there
+// is none. Query parameters other than after and before are preserved.
+func buildCursorPagination(basePath string, q url.Values, count, perPage int, prev, next string) (map[string]any, map[string]any) {
+	linkURL := func(key, cursor string) string {
+		params := url.Values{}
+		for k, vals := range q {
+			if k == "after" || k == "before" || k == "per_page" {
+				continue
+			}
+			for _, v := range vals {
+				params.Add(k, v)
+			}
+		}
+		params.Set("per_page", strconv.Itoa(perPage))
+		params.Set(key, cursor)
+		return basePath + "?" + params.Encode()
+	}
+
+	meta := map[string]any{
+		"count":       count,
+		"per_page":    perPage,
+		"prev_cursor": nil,
+		"next_cursor": nil,
+	}
+	links := map[string]any{"prev": nil, "next": nil}
+	if prev != "" {
+		meta["prev_cursor"] = prev
+		links["prev"] = linkURL("before", prev)
+	}
+	if next != "" {
+		meta["next_cursor"] = next
+		links["next"] = linkURL("after", next)
+	}
+	return meta, links
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParsePagination(t *testing.T) {
+	tests := []struct {
+		url     string
+		page    int
+		perPage int
+	}{
+		{"/test", 1, DefaultPerPage},
+		{"/test?page=2", 2, DefaultPerPage},
+		{"/test?per_page=50", 1, 50},
+		{"/test?page=3&per_page=10", 3, 10},
+		{"/test?page=0", 1, DefaultPerPage},
+		{"/test?per_page=999", 1, MaxPerPage},
+		{"/test?page=abc", 1, DefaultPerPage},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		page, perPage := parsePagination(r)
+		if page != tt.page {
+			t.Fatalf("url=%q: page=%d, want %d", tt.url, page, tt.page)
+		}
+		if perPage != tt.perPage {
+			t.Fatalf("url=%q: perPage=%d, want %d", tt.url, perPage, tt.perPage)
+		}
+	}
+}
+
+func TestBuildPaginationLinks(t *testing.T) {
+	links := buildPaginationLinks("/collections:query", 1, 15, 3, nil)
+	if links["first"] != "/collections:query?page=1&per_page=15" {
+		t.Fatalf("unexpected first: %v", links["first"])
+	}
+	if links["last"] != "/collections:query?page=3&per_page=15" {
+		t.Fatalf("unexpected last: %v", links["last"])
+	}
+	if links["prev"] != nil {
+		t.Fatalf("expected prev=nil, got %v", links["prev"])
+	}
+	if links["next"] != "/collections:query?page=2&per_page=15" {
+		t.Fatalf("unexpected next: %v", links["next"])
+	}
+
+	links2 := buildPaginationLinks("/collections:query", 3, 15, 3, nil)
+	if links2["prev"] != "/collections:query?page=2&per_page=15" {
+		t.Fatalf("unexpected prev: %v", links2["prev"])
+	}
+	if links2["next"] != nil {
+		t.Fatalf("expected next=nil, got %v", links2["next"])
+	}
+}
+
+func TestBuildPaginationLinks_PreservesQuery(t *testing.T) {
+	q := url.Values{}
+	q.Set("sort", "-title")
+	q.Set("per_page", "2")
+	q.Set("page", "1")
+
+	links := buildPaginationLinks("/data/products:query", 1, 2, 3, q)
+
+	first := links["first"].(string)
+	if !strings.Contains(first, "page=1") {
+		t.Fatalf("first link should have page=1: %s", first)
+	}
+	if !strings.Contains(first, "sort=-title") {
+		t.Fatalf("first link should include sort param: %s", first)
+	}
+
+	last := links["last"].(string)
+	if !strings.Contains(last, "page=3") {
+		t.Fatalf("last link should have page=3: %s", last)
+	}
+
+	if links["prev"] != nil {
+		t.Fatal("prev should be nil on page 1")
+	}
+
+	next := links["next"].(string)
+	if !strings.Contains(next, "page=2") {
+		t.Fatalf("next link should have page=2: %s", next)
+	}
+}
+
+func TestBuildPagination_Meta(t *testing.T) {
+	tests := []struct {
+		total, count, page, perPage int
+		wantPages                   int
+	}{
+		{0, 0, 1, 15, 1},
+		{15, 15, 1, 15, 1},
+		{16, 1, 2, 15, 2},
+		{42, 15, 1, 15, 3},
+	}
+	for _, tt := range tests {
+		meta, links := buildPagination("/data/products:query", nil, tt.total, tt.count, tt.page, tt.perPage)
+		if meta["total"] != tt.total || meta["count"] != tt.count || meta["per_page"] != tt.perPage ||
+			meta["current_page"] != tt.page || meta["total_pages"] != tt.wantPages {
+			t.Errorf("total=%d: unexpected meta %v", tt.total, meta)
+		}
+		if want := "/data/products:query?page=" + strconv.Itoa(tt.wantPages) + "&per_page=" + strconv.Itoa(tt.perPage); links["last"] != want {
+			t.Errorf("total=%d: last link %v, want %s", tt.total, links["last"], want)
+		}
+	}
+}
+
+func TestBuildCursorPagination(t *testing.T) {
+	q := url.Values{}
+	q.Set("after", "01J0002")
+	q.Set("per_page", "2")
+	q.Set("q", "widget")
+
+	meta, links := buildCursorPagination("/data/products:query", q, 2, 2, "01J0003", "01J0004")
+	if meta["prev_cursor"] != "01J0003" || meta["next_cursor"] != "01J0004" || meta["count"] != 2 {
+		t.Fatalf("unexpected meta: %v", meta)
+	}
+	if want := "/data/products:query?before=01J0003&per_page=2&q=widget"; links["prev"] != want {
+		t.Errorf("prev link %v, want %s", links["prev"], want)
+	}
+	if want := "/data/products:query?after=01J0004&per_page=2&q=widget"; links["next"] != want {
+		t.Errorf("next link %v, want %s", links["next"], want)
+	}
+
+	meta, links = buildCursorPagination("/data/products:query", q, 0, 2, "", "")
+	if meta["prev_cursor"] != nil || meta["next_cursor"] != nil || links["prev"] != nil || links["next"] != nil {
+		t.Errorf("expected no cursors for an empty page: %v %v", meta, links)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ---------------------------------------------------------------------------
+// Password policy
+//
+// PasswordPolicy checks new passwords against the complexity rules in the
+// password_policy config section. When history is set, a user's previous
+// password hashes are kept in the internal moon_auth_password_history table
+// and a new password may not match the current one or any of them. When
+// lockout_threshold is set, consecutive failed logins per account are
+// counted in the internal moon_auth_lockouts table, keyed by user id, so a
+// lockout survives restarts and applies across instances sharing the
+// database.
+// ---------------------------------------------------------------------------
+
+// errPasswordReused is returned by CheckHistory for a password that matches
+// the current or a recent password.
+var errPasswordReused = errors.New("must not match a recent password")
+
+// Validate checks password against the complexity rules.
+func (p PasswordPolicy) Validate(password string) error {
+	if len(password) < p.MinLength {
+		return fmt.Errorf("must be at least %d characters", p.MinLength)
+	}
+	if len(password) > MaxPasswordLength {
+		return fmt.Errorf("must be at most %d bytes", MaxPasswordLength)
+	}
+
+	var hasLower, hasUpper, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSymbol = true
+		}
+	}
+
+	if p.RequireLowercase && !hasLower {
+		return fmt.Errorf("must contain at least one lowercase letter")
+	}
+	if p.RequireUppercase && !hasUpper {
+		return fmt.Errorf("must contain at least one uppercase letter")
+	}
+	if p.RequireDigit && !hasDigit {
+		return fmt.Errorf("must contain at least one digit")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		return fmt.Errorf("must contain at least one symbol")
+	}
+	return nil
+}
+
+// CheckHistory returns errPasswordReused when history is enabled and
+// password matches the user's current password or one of the previous
+// passwords kept for them.
+func (p PasswordPolicy) CheckHistory(ctx context.Context, db DatabaseAdapter, user map[string]any, password string) error {
+	if p.History == 0 {
+		return nil
+	}
+	if bcrypt.CompareHashAndPassword([]byte(stringVal(user, "password_hash")), []byte(password)) == nil {
+		return errPasswordReused
+	}
+	rows, err := passwordHistory(ctx, db, stringVal(user, "id"))
+	if err != nil {
+		return err
+	}
+	for i, row := range rows {
+		if i >= p.History {
+			break
+		}
+		if bcrypt.CompareHashAndPassword([]byte(stringVal(row, "password_hash")), []byte(password)) == nil {
+			return errPasswordReused
+		}
+	}
+	return nil
+}
+
+// RecordHistory keeps the hash a user's password is being changed from,
+// dropping entries beyond the configured history length.
+func (p PasswordPolicy) RecordHistory(ctx context.Context, db DatabaseAdapter, userID, oldHash string) error {
+	if p.History == 0 || oldHash == "" {
+		return nil
+	}
+	if err := db.InsertRow(ctx, "moon_auth_password_history", map[string]any{
+		"id":            GenerateULID(),
+		"user_id":       userID,
+		"password_hash": oldHash,
+		"created_at":    time.Now().UTC().Format(time.RFC3339),
+	}); err != nil {
+		return err
+	}
+	rows, err := passwordHistory(ctx, db, userID)
+	if err != nil {
+		return err
+	}
+	for i := p.History; i < len(rows); i++ {
+		if err := db.DeleteRow(ctx, "moon_auth_password_history", stringVal(rows[i], "id")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// passwordHistory returns the previous passwords of userID, newest first.
+func passwordHistory(ctx context.Context, db DatabaseAdapter, userID string) ([]map[string]any, error) {
+	rows, _, err := db.QueryRows(ctx, "moon_auth_password_history", QueryOptions{
+		Filters: []Filter{{Field: "user_id", Op: "eq", Value: userID}},
+		Sort:    []SortField{{Field: "created_at", Desc: true}, {Field: "id", Desc: true}},
+		Page:    1,
+		PerPage: MaxPerPage,
+	})
+	return rows, err
+}
+
+// passwordPolicyViolation formats a Validate or CheckHistory error for a
+// 400 response.
+func passwordPolicyViolation(err error) string {
+	return fmt.Sprintf("Password policy violation: %s", err.Error())
+}
+
+// ---------------------------------------------------------------------------
+// Account lockout
+// ---------------------------------------------------------------------------
+
+// LockedUntil returns when the lockout of userID ends, or the zero time when
+// the account is not locked at now.
+func (p PasswordPolicy) LockedUntil(ctx context.Context, db DatabaseAdapter, userID string, now time.Time) (time.Time, error) {
+	if p.LockoutThreshold == 0 {
+		return time.Time{}, nil
+	}
+	row, err := loadLockout(ctx, db, userID)
+	if err != nil || row == nil {
+		return time.Time{}, err
+	}
+	until, err := time.Parse(time.RFC3339, stringVal(row, "locked_until"))
+	if err != nil || !until.After(now) {
+		return time.Time{}, nil
+	}
+	return until, nil
+}
+
+// RecordFailure counts a failed login for userID and reports whether it
+// locked the account. Failures more than lockout_duration apart start the
+// count again.
+func (p PasswordPolicy) RecordFailure(ctx context.Context, db DatabaseAdapter, userID string, now time.Time) (bool, error) {
+	if p.LockoutThreshold == 0 {
+		return false, nil
+	}
+	row, err := loadLockout(ctx, db, userID)
+	if err != nil {
+		return false, err
+	}
+
+	window := time.Duration(p.LockoutDuration) * time.Second
+	failures := 1
+	if row != nil {
+		last, err := time.Parse(time.RFC3339, stringVal(row, "last_failed_at"))
+		if err == nil && now.Sub(last) < window {
+			count, _ := toInt64(row["failed_count"])
+			failures = int(count) + 1
+		}
+	}
+	values := map[string]any{
+		"failed_count":   failures,
+		"last_failed_at": now.UTC().Format(time.RFC3339),
+		"locked_until":   nil,
+	}
+	locked := failures >= p.LockoutThreshold
+	if locked {
+		values["failed_count"] = 0
+		values["locked_until"] = now.Add(window).UTC().Format(time.RFC3339)
+	}
+
+	if row == nil {
+		values["id"] = userID
+		return locked, db.InsertRow(ctx, "moon_auth_lockouts", values)
+	}
+	return locked, db.UpdateRow(ctx, "moon_auth_lockouts", userID, values)
+}
+
+// ClearLockout forgets the failed logins of userID and unlocks the account.
+func ClearLockout(ctx context.Context, db DatabaseAdapter, userID string) error {
+	row, err := loadLockout(ctx, db, userID)
+	if err != nil || row == nil {
+		return err
+	}
+	return db.DeleteRow(ctx, "moon_auth_lockouts", userID)
+}
+
+// loadLockout returns the moon_auth_lockouts row of userID, or nil.
+func loadLockout(ctx context.Context, db DatabaseAdapter, userID string) (map[string]any, error) {
+	rows, _, err := db.QueryRows(ctx, "moon_auth_lockouts", QueryOptions{
+		Filters: []Filter{{Field: "id", Op: "eq", Value: userID}},
+		Page:    1,
+		PerPage: 1,
+	})
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	return rows[0], nil
+}
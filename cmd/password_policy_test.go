@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func changeMyPassword(t *testing.T, h *AuthMeHandler, oldPassword, newPassword string) *httptest.ResponseRecorder {
+	t.Helper()
+	body, _ := json.Marshal(map[string]any{
+		"data": map[string]any{"old_password": oldPassword, "password": newPassword},
+	})
+	w := httptest.NewRecorder()
+	h.UpdateMe(w, reqWithJWT("POST", "/auth:me", body, "01TESTUSER000000000000001", "admin", true))
+	return w
+}
+
+func TestPasswordPolicy_History(t *testing.T) {
+	h, _, db := setupAuthMeTest(t)
+	policy := DefaultPasswordPolicy()
+	policy.History = 2
+	h.cfg.PasswordPolicy = policy
+
+	if w := changeMyPassword(t, h, "TestPass1", "TestPass1"); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "recent password") {
+		t.Fatalf("expected the current password to be rejected, got %d: %s", w.Code, w.Body.String())
+	}
+
+	current := "TestPass1"
+	for _, next := range []string{"Second22", "Third333", "Fourth44"} {
+		if w := changeMyPassword(t, h, current, next); w.Code != http.StatusOK {
+			t.Fatalf("change to %s: expected 200, got %d: %s", next, w.Code, w.Body.String())
+		}
+		current = next
+	}
+
+	// Second22 and Third333 are remembered; TestPass1 has dropped out.
+	for _, reused := range []string{"Second22", "Third333"} {
+		if w := changeMyPassword(t, h, current, reused); w.Code != http.StatusBadRequest {
+			t.Errorf("expected %s to be rejected as reused, got %d", reused, w.Code)
+		}
+	}
+	rows, err := passwordHistory(context.Background(), db, "01TESTUSER000000000000001")
+	if err != nil || len(rows) != 2 {
+		t.Fatalf("expected 2 history rows, got %d (%v)", len(rows), err)
+	}
+	if w := changeMyPassword(t, h, current, "TestPass1"); w.Code != http.StatusOK {
+		t.Errorf("expected a password beyond the history to be accepted, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestPasswordPolicy_Lockout(t *testing.T) {
+	h, db := setupAuthTest(t)
+	policy := DefaultPasswordPolicy()
+	policy.LockoutThreshold = 3
+	policy.LockoutDuration = 600
+	h.cfg.PasswordPolicy = policy
+	login := func(password string) *httptest.ResponseRecorder {
+		return doAuthRequest(t, h, map[string]any{
+			"op":   "login",
+			"data": map[string]any{"username": "testuser", "password": password},
+		})
+	}
+
+	// A success before the threshold starts the count again.
+	login("WrongPass1")
+	login("WrongPass1")
+	if w := login("TestPass1"); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	for i := 0; i < 2; i++ {
+		if w := login("WrongPass1"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected 401, got %d", i+1, w.Code)
+		}
+	}
+	if w := login("TestPass1"); w.Code != http.StatusOK {
+		t.Fatalf("expected the count to restart after a success, got %d", w.Code)
+	}
+
+	for i := 0; i < 3; i++ {
+		login("WrongPass1")
+	}
+	w := login("TestPass1")
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "Account is locked") {
+		t.Fatalf("expected a locked account, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("expected a Retry-After header")
+	}
+
+	// A wrong password while locked gets the plain 401, so the lockout is
+	// not revealed to someone guessing, and does not end the lockout.
+	if w := login("WrongPass1"); w.Code != http.StatusUnauthorized || strings.Contains(w.Body.String(), "locked") {
+		t.Fatalf("expected 401 for a wrong password while locked, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := login("TestPass1"); w.Code != http.StatusForbidden {
+		t.Fatalf("expected the account to stay locked, got %d", w.Code)
+	}
+
+	// The lockout is stored, so a new handler (as after a restart) sees it.
+	fresh := &AuthSessionHandler{db: db, cfg: h.cfg}
+	if w := doAuthRequest(t, fresh, map[string]any{
+		"op":   "login",
+		"data": map[string]any{"username": "testuser", "password": "TestPass1"},
+	}); w.Code != http.StatusForbidden {
+		t.Errorf("expected the lockout to persist, got %d", w.Code)
+	}
+
+	// The lockout ends after lockout_duration.
+	ctx := context.Background()
+	if err := db.UpdateRow(ctx, "moon_auth_lockouts", "01TESTUSER000000000000001", map[string]any{
+		"locked_until": time.Now().Add(-time.Second).UTC().Format(time.RFC3339),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if w := login("TestPass1"); w.Code != http.StatusOK {
+		t.Fatalf("expected login after the lockout, got %d: %s", w.Code, w.Body.String())
+	}
+	if row, err := loadLockout(ctx, db, "01TESTUSER000000000000001"); err != nil || row != nil {
+		t.Errorf("expected a successful login to clear the lockout, got %v (%v)", row, err)
+	}
+}
+
+func TestUsersAction_Unlock(t *testing.T) {
+	h, db, _ := setupMutateTest(t)
+	ctx := context.Background()
+	id := seedAdminUser(t, db)
+	policy := DefaultPasswordPolicy()
+	policy.LockoutThreshold = 1
+	h.cfg.PasswordPolicy = policy
+
+	if _, err := policy.RecordFailure(ctx, db, id, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	w := doMutateRequest(t, h, "users", map[string]any{
+		"op":     "action",
+		"action": "unlock",
+		"data":   []any{map[string]any{"id": id}, map[string]any{"id": "01NOTLOCKED00000000000001"}},
+	}, adminIdentity())
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	meta := decodeResponse(t, w)["meta"].(map[string]any)
+	if meta["success"] != float64(1) || meta["failed"] != float64(1) {
+		t.Errorf("unexpected meta %v", meta)
+	}
+	if until, err := policy.LockedUntil(ctx, db, id, time.Now()); err != nil || !until.IsZero() {
+		t.Errorf("expected the account to be unlocked, got %v (%v)", until, err)
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PermissionRule grants a role or a single API key a set of operations on
+// one collection.
+type PermissionRule struct {
+	ID          string   `json:"id"`
+	Collection  string   `json:"collection"`
+	SubjectType string   `json:"subject_type"`
+	Subject     string   `json:"subject"`
+	Operations  []string `json:"operations"`
+}
+
+// grants reports whether the rule allows op.
+func (p PermissionRule) grants(op string) bool {
+	return stringInSlice(op, p.Operations)
+}
+
+// PermissionStore caches the rules in moon_permissions, keyed by
+// collection, and the custom roles in moon_roles, keyed by name. A
+// collection without rules keeps the default role and can_write checks.
+// The cache is reloaded at most once every PermissionReloadSeconds so that
+// rules and roles changed by another instance are picked up.
+type PermissionStore struct {
+	db DatabaseAdapter
+
+	mu         sync.RWMutex
+	rules      map[string][]PermissionRule
+	roles      map[string]Role
+	lastLoaded time.Time
+
+	// cache counts requests served from the cached rules (hits) and
+	// requests that reloaded them (misses).
+	cache cacheCounter
+}
+
+// NewPermissionStore creates a PermissionStore and loads the current rules.
+func NewPermissionStore(ctx context.Context, db DatabaseAdapter) (*PermissionStore, error) {
+	s := &PermissionStore{db: db}
+	if err := s.Load(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Load replaces the cached rules and roles with the contents of
+// moon_permissions and moon_roles.
+func (s *PermissionStore) Load(ctx context.Context) error {
+	rules := make(map[string][]PermissionRule)
+	for page := 1; ; page++ {
+		rows, _, err := s.db.QueryRows(ctx, PermissionsTable, QueryOptions{
+			Sort:    []SortField{{Field: "id"}},
+			Page:    page,
+			PerPage: MaxPerPage,
+		})
+		if err != nil {
+			return fmt.Errorf("permissions: load: %w", err)
+		}
+		for _, row := range rows {
+			rule, err := permissionRuleFromRow(row)
+			if err != nil {
+				return fmt.Errorf("permissions: load: %w", err)
+			}
+			rules[rule.Collection] = append(rules[rule.Collection], rule)
+		}
+		if len(rows) < MaxPerPage {
+			break
+		}
+	}
+	roles, err := s.loadRoles(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.rules = rules
+	s.roles = roles
+	s.lastLoaded = time.Now()
+	s.mu.Unlock()
+	return nil
+}
+
+// reloadIfStale reloads the cache when it is older than
+// PermissionReloadSeconds. A failed reload keeps the previous rules.
+func (s *PermissionStore) reloadIfStale(ctx context.Context) {
+	s.mu.RLock()
+	stale := time.Since(s.lastLoaded) >= PermissionReloadSeconds*time.Second
+	s.mu.RUnlock()
+	s.cache.record(!stale)
+	if stale {
+		_ = s.Load(ctx)
+	}
+}
+
+// Rules returns the cached rules, optionally limited to one collection,
+// sorted by collection, subject type, and subject.
+func (s *PermissionStore) Rules(collection string) []PermissionRule {
+	s.mu.RLock()
+	var result []PermissionRule
+	for name, rules := range s.rules {
+		if collection == "" || name == collection {
+			result = append(result, rules...)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Collection != b.Collection {
+			return a.Collection < b.Collection
+		}
+		if a.SubjectType != b.SubjectType {
+			return a.SubjectType < b.SubjectType
+		}
+		return a.Subject < b.Subject
+	})
+	return result
+}
+
+// HasRules reports whether any rule is defined for collection.
+func (s *PermissionStore) HasRules(collection string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.rules[collection]) > 0
+}
+
+// Allowed reports whether identity may perform op on collection. Admins
+// are always allowed. An API key's own rule takes precedence over
+// everything else. A custom role is then decided by its permissions alone.
+// For the user role, collections without rules are allowed here, as the
+// caller still applies the default checks; otherwise the caller needs a
+// matching role rule.
+func (s *PermissionStore) Allowed(identity *AuthIdentity, collection, op string) bool {
+	if identity.Role == "admin" {
+		return true
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rules := s.rules[collection]
+	if identity.Role != "user" {
+		for _, rule := range rules {
+			if identity.CredentialType == CredentialTypeAPIKey &&
+				rule.SubjectType == PermissionSubjectAPIKey && rule.Subject == identity.CallerID {
+				return rule.grants(op)
+			}
+		}
+		role, ok := s.roles[identity.Role]
+		return ok && role.Permissions.Allows(collection, op)
+	}
+	if len(rules) == 0 {
+		return true
+	}
+
+	var roleRule *PermissionRule
+	for i := range rules {
+		rule := &rules[i]
+		if identity.CredentialType == CredentialTypeAPIKey &&
+			rule.SubjectType == PermissionSubjectAPIKey && rule.Subject == identity.CallerID {
+			return rule.grants(op)
+		}
+		if rule.SubjectType == PermissionSubjectRole && rule.Subject == identity.Role {
+			roleRule = rule
+		}
+	}
+	return roleRule != nil && roleRule.grants(op)
+}
+
+// Set creates the rule for (collection, subjectType, subject) or replaces
+// the operations of the existing one.
+func (s *PermissionStore) Set(ctx context.Context, rule PermissionRule) (PermissionRule, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	ops, err := json.Marshal(rule.Operations)
+	if err != nil {
+		return PermissionRule{}, err
+	}
+
+	existing, err := s.find(ctx, rule.Collection, rule.SubjectType, rule.Subject)
+	if err != nil {
+		return PermissionRule{}, err
+	}
+	if existing != "" {
+		rule.ID = existing
+		err = s.db.UpdateRow(ctx, PermissionsTable, existing, map[string]any{
+			"operations": string(ops),
+			"updated_at": now,
+		})
+	} else {
+		rule.ID = GenerateULID()
+		err = s.db.InsertRow(ctx, PermissionsTable, map[string]any{
+			"id":           rule.ID,
+			"collection":   rule.Collection,
+			"subject_type": rule.SubjectType,
+			"subject":      rule.Subject,
+			"operations":   string(ops),
+			"created_at":   now,
+			"updated_at":   now,
+		})
+	}
+	if err != nil {
+		return PermissionRule{}, err
+	}
+	return rule, s.Load(ctx)
+}
+
+// Remove deletes the rule for (collection, subjectType, subject). It
+// reports false when no such rule exists.
+func (s *PermissionStore) Remove(ctx context.Context, collection, subjectType, subject string) (bool, error) {
+	id, err := s.find(ctx, collection, subjectType, subject)
+	if err != nil || id == "" {
+		return false, err
+	}
+	if err := s.db.DeleteRow(ctx, PermissionsTable, id); err != nil {
+		return false, err
+	}
+	return true, s.Load(ctx)
+}
+
+// RemoveCollection deletes every rule for collection. It is called when
+// the collection is destroyed so a later collection with the same name
+// does not inherit stale rules.
+func (s *PermissionStore) RemoveCollection(ctx context.Context, collection string) error {
+	for _, rule := range s.Rules(collection) {
+		if err := s.db.DeleteRow(ctx, PermissionsTable, rule.ID); err != nil {
+			return err
+		}
+	}
+	return s.Load(ctx)
+}
+
+// RenameCollection moves every rule of from to the collection to. It is
+// called when a collection is renamed.
+func (s *PermissionStore) RenameCollection(ctx context.Context, from, to string) error {
+	for _, rule := range s.Rules(from) {
+		if err := s.db.UpdateRow(ctx, PermissionsTable, rule.ID, map[string]any{
+			"collection": to,
+			"updated_at": time.Now().UTC().Format(time.RFC3339),
+		}); err != nil {
+			return err
+		}
+	}
+	return s.Load(ctx)
+}
+
+// find returns the id of the stored rule for the given key, or "".
+func (s *PermissionStore) find(ctx context.Context, collection, subjectType, subject string) (string, error) {
+	rows, _, err := s.db.QueryRows(ctx, PermissionsTable, QueryOptions{
+		Filters: []Filter{
+			{Field: "collection", Op: "eq", Value: collection},
+			{Field: "subject_type", Op: "eq", Value: subjectType},
+			{Field: "subject", Op: "eq", Value: subject},
+		},
+		Page:    1,
+		PerPage: 1,
+	})
+	if err != nil || len(rows) == 0 {
+		return "", err
+	}
+	id, _ := rows[0]["id"].(string)
+	return id, nil
+}
+
+func permissionRuleFromRow(row map[string]any) (PermissionRule, error) {
+	ops, err := parseStringArrayValue(row["operations"], "operations")
+	if err != nil {
+		return PermissionRule{}, err
+	}
+	rule := PermissionRule{Operations: ops}
+	rule.ID, _ = row["id"].(string)
+	rule.Collection, _ = row["collection"].(string)
+	rule.SubjectType, _ = row["subject_type"].(string)
+	rule.Subject, _ = row["subject"].(string)
+	if rule.Operations == nil {
+		rule.Operations = []string{}
+	}
+	return rule, nil
+}
+
+// ---------------------------------------------------------------------------
+// Request operation mapping
+// ---------------------------------------------------------------------------
+
+// dataRouteOperation maps a /data/{resource}:{action} request to the
+// collection and permission operation it performs. Reads with an id
+// parameter, including :render and :qrcode, are "read"; other reads,
+// including schema, aggregate, and export routes, are "list". Imports are
+// "create", :updateWhere is "update", :destroyWhere is "destroy", and
+// :upsert is "upsert", which routeOperations expands. For :mutate the op is taken from the JSON body, which is
+// restored for the handler, and op=action counts as "update". An empty op
+// means the request is not a data route or its body is invalid; the
+// handler reports the error.
+func dataRouteOperation(r *http.Request, prefix string) (string, string, error) {
+	dataPrefix := prefix + "/data/"
+	if !strings.HasPrefix(r.URL.Path, dataPrefix) {
+		return "", "", nil
+	}
+	rest := r.URL.Path[len(dataPrefix):]
+	colonIdx := strings.LastIndex(rest, ":")
+	if colonIdx <= 0 {
+		return "", "", nil
+	}
+	resource, action := rest[:colonIdx], rest[colonIdx+1:]
+
+	switch {
+	case r.Method == http.MethodGet && (action == "query" || action == "render" || action == "qrcode"):
+		if r.URL.Query().Get("id") != "" {
+			return resource, "read", nil
+		}
+		return resource, "list", nil
+	case r.Method == http.MethodGet:
+		return resource, "list", nil
+	case r.Method == http.MethodPost && action == "import":
+		return resource, "create", nil
+	case r.Method == http.MethodPost && action == "upsert":
+		return resource, "upsert", nil
+	case r.Method == http.MethodPost && action == "updateWhere":
+		return resource, "update", nil
+	case r.Method == http.MethodPost && action == "destroyWhere":
+		return resource, "destroy", nil
+	case r.Method == http.MethodPost && action == "mutate":
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return "", "", err
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		var payload struct {
+			Op string `json:"op"`
+		}
+		if json.Unmarshal(body, &payload) != nil {
+			return resource, "", nil
+		}
+		switch payload.Op {
+		case "create", "update", "destroy":
+			return resource, payload.Op, nil
+		case "action":
+			return resource, "update", nil
+		}
+		return resource, "", nil
+	}
+	return resource, "", nil
+}
+
+// routeOperations returns the permission operations that op, as returned
+// by dataRouteOperation, needs: an upsert may create or update, so it needs
+// both.
+func routeOperations(op string) []string {
+	if op == "upsert" {
+		return []string{"create", "update"}
+	}
+	return []string{op}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func setupPermissionTest(t *testing.T) (*PermissionStore, *SchemaRegistry) {
+	t.Helper()
+	_, adapter, registry := setupResourceQueryTest(t)
+	ctx := context.Background()
+	if err := adapter.ExecDDL(ctx, ddlPermissionsTable); err != nil {
+		t.Fatalf("ExecDDL permissions: %v", err)
+	}
+	if err := adapter.ExecDDL(ctx, ddlRolesTable); err != nil {
+		t.Fatalf("ExecDDL roles: %v", err)
+	}
+	store, err := NewPermissionStore(ctx, adapter)
+	if err != nil {
+		t.Fatalf("NewPermissionStore: %v", err)
+	}
+	return store, registry
+}
+
+func TestPermissionStore_Allowed(t *testing.T) {
+	store, _ := setupPermissionTest(t)
+	ctx := context.Background()
+
+	user := &AuthIdentity{CredentialType: CredentialTypeJWT, CallerID: "u1", Role: "user", CanWrite: true}
+	key := &AuthIdentity{CredentialType: CredentialTypeAPIKey, CallerID: "key-1", Role: "user", CanWrite: true}
+	otherKey := &AuthIdentity{CredentialType: CredentialTypeAPIKey, CallerID: "key-2", Role: "user", CanWrite: true}
+	admin := &AuthIdentity{CredentialType: CredentialTypeJWT, CallerID: "a1", Role: "admin"}
+
+	if !store.Allowed(user, "products", "destroy") {
+		t.Fatal("collection without rules must not be restricted")
+	}
+
+	if _, err := store.Set(ctx, PermissionRule{
+		Collection: "products", SubjectType: PermissionSubjectRole, Subject: "user",
+		Operations: []string{"list", "read"},
+	}); err != nil {
+		t.Fatalf("Set role rule: %v", err)
+	}
+	if _, err := store.Set(ctx, PermissionRule{
+		Collection: "products", SubjectType: PermissionSubjectAPIKey, Subject: "key-1",
+		Operations: []string{"create"},
+	}); err != nil {
+		t.Fatalf("Set apikey rule: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		identity *AuthIdentity
+		op       string
+		want     bool
+	}{
+		{"role grants list", user, "list", true},
+		{"role denies create", user, "create", false},
+		{"key rule grants create", key, "create", true},
+		{"key rule replaces role rule", key, "list", false},
+		{"key without own rule uses role", otherKey, "read", true},
+		{"admin bypasses rules", admin, "destroy", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := store.Allowed(tt.identity, "products", tt.op); got != tt.want {
+				t.Errorf("Allowed(%s) = %v, want %v", tt.op, got, tt.want)
+			}
+		})
+	}
+
+	// Setting an existing rule replaces its operations.
+	if _, err := store.Set(ctx, PermissionRule{
+		Collection: "products", SubjectType: PermissionSubjectRole, Subject: "user",
+		Operations: []string{"list", "read", "create"},
+	}); err != nil {
+		t.Fatalf("Set replace: %v", err)
+	}
+	if n := len(store.Rules("products")); n != 2 {
+		t.Fatalf("expected 2 rules after replace, got %d", n)
+	}
+	if !store.Allowed(user, "products", "create") {
+		t.Error("expected replaced rule to grant create")
+	}
+
+	if err := store.RemoveCollection(ctx, "products"); err != nil {
+		t.Fatalf("RemoveCollection: %v", err)
+	}
+	if store.HasRules("products") {
+		t.Error("expected rules to be removed with the collection")
+	}
+}
+
+func TestPermissionStore_LoadFromDatabase(t *testing.T) {
+	store, _ := setupPermissionTest(t)
+	ctx := context.Background()
+
+	if _, err := store.Set(ctx, PermissionRule{
+		Collection: "products", SubjectType: PermissionSubjectRole, Subject: "user",
+		Operations: []string{"list"},
+	}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	reloaded, err := NewPermissionStore(ctx, store.db)
+	if err != nil {
+		t.Fatalf("NewPermissionStore: %v", err)
+	}
+	rules := reloaded.Rules("")
+	if len(rules) != 1 || rules[0].Subject != "user" || len(rules[0].Operations) != 1 {
+		t.Fatalf("unexpected rules after reload: %+v", rules)
+	}
+}
+
+func TestAuthorizeWithPermissions(t *testing.T) {
+	store, _ := setupPermissionTest(t)
+	if _, err := store.Set(context.Background(), PermissionRule{
+		Collection: "products", SubjectType: PermissionSubjectRole, Subject: "user",
+		Operations: []string{"read", "update"},
+	}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	var gotBody string
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := AuthorizeWithPermissions("", store, inner)
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		body     string
+		identity *AuthIdentity
+		want     int
+	}{
+		{"list denied", http.MethodGet, "/data/products:query", "", userWriteIdentity(), http.StatusForbidden},
+		{"read allowed", http.MethodGet, "/data/products:query?id=1", "", userWriteIdentity(), http.StatusOK},
+		{"export counts as list", http.MethodGet, "/data/products:export", "", userWriteIdentity(), http.StatusForbidden},
+		{"create denied", http.MethodPost, "/data/products:mutate", `{"op":"create","data":[]}`, userWriteIdentity(), http.StatusForbidden},
+		{"update allowed", http.MethodPost, "/data/products:mutate", `{"op":"update","data":[]}`, userWriteIdentity(), http.StatusOK},
+		{"import counts as create", http.MethodPost, "/data/products:import", "title\nA\n", userWriteIdentity(), http.StatusForbidden},
+		{"upsert needs create too", http.MethodPost, "/data/products:upsert", `{"data":[]}`, userWriteIdentity(), http.StatusForbidden},
+		{"updateWhere counts as update", http.MethodPost, "/data/products:updateWhere", `{"filter":{}}`, userWriteIdentity(), http.StatusOK},
+		{"destroyWhere counts as destroy", http.MethodPost, "/data/products:destroyWhere", `{"filter":{}}`, userWriteIdentity(), http.StatusForbidden},
+		{"other collection unaffected", http.MethodGet, "/data/users:query", "", userWriteIdentity(), http.StatusOK},
+		{"admin bypasses rules", http.MethodPost, "/data/products:mutate", `{"op":"destroy","data":[]}`, adminIdentity(), http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotBody = ""
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			req = req.WithContext(SetAuthIdentity(req.Context(), tt.identity))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, w.Code)
+			}
+			if tt.want == http.StatusOK && tt.body != "" && gotBody != tt.body {
+				t.Errorf("expected body to reach handler unchanged, got %q", gotBody)
+			}
+		})
+	}
+
+	// Rules never grant writes to a caller without can_write.
+	readOnly := &AuthIdentity{CredentialType: CredentialTypeJWT, CallerID: "u2", Role: "user"}
+	req := httptest.NewRequest(http.MethodPost, "/data/products:mutate", strings.NewReader(`{"op":"update","data":[]}`))
+	req = req.WithContext(SetAuthIdentity(req.Context(), readOnly))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 without can_write, got %d", w.Code)
+	}
+}
@@ -0,0 +1,602 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"strings"
+)
+
+// ---------------------------------------------------------------------------
+// QR code encoder
+// ---------------------------------------------------------------------------
+
+// The encoder supports byte mode at error correction level M for versions
+// 1 through QRCodeMaxVersion, which covers SKUs, ticket codes, and URLs.
+
+// qrBlockLayout describes how a version's codewords are split into
+// Reed-Solomon blocks at level M.
+type qrBlockLayout struct {
+	ecPerBlock  int
+	shortBlocks int
+	shortData   int
+	longBlocks  int
+}
+
+// qrLayoutsM is indexed by version. Long blocks hold one more data codeword
+// than short blocks.
+var qrLayoutsM = [...]qrBlockLayout{
+	1:  {10, 1, 16, 0},
+	2:  {16, 1, 28, 0},
+	3:  {26, 1, 44, 0},
+	4:  {18, 2, 32, 0},
+	5:  {24, 2, 43, 0},
+	6:  {16, 4, 27, 0},
+	7:  {18, 4, 31, 0},
+	8:  {22, 2, 38, 2},
+	9:  {22, 3, 36, 2},
+	10: {26, 4, 43, 1},
+}
+
+// qrAlignmentCenters lists the alignment pattern center coordinates per
+// version.
+var qrAlignmentCenters = [...][]int{
+	1:  nil,
+	2:  {6, 18},
+	3:  {6, 22},
+	4:  {6, 26},
+	5:  {6, 30},
+	6:  {6, 34},
+	7:  {6, 22, 38},
+	8:  {6, 24, 42},
+	9:  {6, 26, 46},
+	10: {6, 28, 50},
+}
+
+// dataCodewords returns the number of data codewords of the layout.
+func (l qrBlockLayout) dataCodewords() int {
+	return l.shortBlocks*l.shortData + l.longBlocks*(l.shortData+1)
+}
+
+// qrCapacity returns the number of bytes a version holds in byte mode.
+func qrCapacity(version int) int {
+	return (qrLayoutsM[version].dataCodewords()*8 - 4 - qrCountBits(version)) / 8
+}
+
+// qrCountBits returns the width of the byte mode character count field.
+func qrCountBits(version int) int {
+	if version < 10 {
+		return 8
+	}
+	return 16
+}
+
+// qrCode is an encoded symbol. modules[y][x] is true for a dark module.
+type qrCode struct {
+	size     int
+	modules  [][]bool
+	function [][]bool
+}
+
+// encodeQRCode encodes data in the smallest version that holds it.
+func encodeQRCode(data []byte) (*qrCode, error) {
+	version := 0
+	for v := 1; v <= QRCodeMaxVersion; v++ {
+		if len(data) <= qrCapacity(v) {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, fmt.Errorf("value exceeds %d bytes", qrCapacity(QRCodeMaxVersion))
+	}
+
+	layout := qrLayoutsM[version]
+	var bits qrBitBuffer
+	bits.append(0x4, 4)
+	bits.append(len(data), qrCountBits(version))
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+	capacity := layout.dataCodewords() * 8
+	bits.append(0, min(4, capacity-len(bits)))
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+
+	codewords := make([]byte, len(bits)/8)
+	for i, bit := range bits {
+		if bit {
+			codewords[i>>3] |= 1 << (7 - i&7)
+		}
+	}
+
+	q := newQRCode(version)
+	q.drawCodewords(interleaveQRBlocks(codewords, layout))
+
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		q.applyMask(mask)
+		q.drawFormatBits(mask)
+		if p := q.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+		q.applyMask(mask)
+	}
+	q.applyMask(best)
+	q.drawFormatBits(best)
+	return q, nil
+}
+
+// qrBitBuffer accumulates bits most significant first.
+type qrBitBuffer []bool
+
+func (b *qrBitBuffer) append(value, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, value>>i&1 == 1)
+	}
+}
+
+// interleaveQRBlocks splits data into blocks, appends each block's error
+// correction codewords, and interleaves the result.
+func interleaveQRBlocks(data []byte, layout qrBlockLayout) []byte {
+	blocks := make([][]byte, 0, layout.shortBlocks+layout.longBlocks)
+	for i, off := 0, 0; i < layout.shortBlocks+layout.longBlocks; i++ {
+		n := layout.shortData
+		if i >= layout.shortBlocks {
+			n++
+		}
+		blocks = append(blocks, data[off:off+n])
+		off += n
+	}
+
+	divisor := reedSolomonDivisor(layout.ecPerBlock)
+	result := make([]byte, 0, len(data)+len(blocks)*layout.ecPerBlock)
+	for i := 0; i <= layout.shortData; i++ {
+		for _, block := range blocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	ec := make([][]byte, len(blocks))
+	for i, block := range blocks {
+		ec[i] = reedSolomonRemainder(block, divisor)
+	}
+	for i := 0; i < layout.ecPerBlock; i++ {
+		for _, block := range ec {
+			result = append(result, block[i])
+		}
+	}
+	return result
+}
+
+// gfMultiply multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1.
+func gfMultiply(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x11D
+		z ^= int(y>>i&1) * int(x)
+	}
+	return byte(z)
+}
+
+// reedSolomonDivisor returns the generator polynomial of the given degree,
+// highest coefficient first and without the leading 1.
+func reedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < degree {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+// reedSolomonRemainder returns the error correction codewords for data.
+func reedSolomonRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coef := range divisor {
+			result[i] ^= gfMultiply(coef, factor)
+		}
+	}
+	return result
+}
+
+// newQRCode returns a symbol with its function patterns drawn.
+func newQRCode(version int) *qrCode {
+	size := version*4 + 17
+	q := &qrCode{size: size, modules: make([][]bool, size), function: make([][]bool, size)}
+	for i := range q.modules {
+		q.modules[i] = make([]bool, size)
+		q.function[i] = make([]bool, size)
+	}
+
+	for i := 0; i < size; i++ {
+		q.setFunction(6, i, i%2 == 0)
+		q.setFunction(i, 6, i%2 == 0)
+	}
+	q.drawFinder(3, 3)
+	q.drawFinder(size-4, 3)
+	q.drawFinder(3, size-4)
+
+	centers := qrAlignmentCenters[version]
+	last := len(centers) - 1
+	for i, cx := range centers {
+		for j, cy := range centers {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					q.setFunction(cx+dx, cy+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	// Reserve the format areas; drawFormatBits fills them in.
+	q.drawFormatBits(0)
+	if version >= 7 {
+		bits := qrVersionBits(version)
+		for i := 0; i < 18; i++ {
+			dark := bits>>i&1 == 1
+			a, b := size-11+i%3, i/3
+			q.setFunction(a, b, dark)
+			q.setFunction(b, a, dark)
+		}
+	}
+	return q
+}
+
+func (q *qrCode) setFunction(x, y int, dark bool) {
+	q.modules[y][x] = dark
+	q.function[y][x] = true
+}
+
+// drawFinder draws a finder pattern and its separator around (cx, cy).
+func (q *qrCode) drawFinder(cx, cy int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			x, y := cx+dx, cy+dy
+			if x < 0 || x >= q.size || y < 0 || y >= q.size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			q.setFunction(x, y, dist != 2 && dist != 4)
+		}
+	}
+}
+
+// qrFormatBits returns the 15-bit format information for level M and mask.
+func qrFormatBits(mask int) int {
+	data := 0<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+// qrVersionBits returns the 18-bit version information.
+func qrVersionBits(version int) int {
+	rem := version
+	for i := 0; i < 12; i++ {
+		rem = rem<<1 ^ (rem>>11)*0x1F25
+	}
+	return version<<12 | rem
+}
+
+// drawFormatBits writes both copies of the format information and the
+// dark module.
+func (q *qrCode) drawFormatBits(mask int) {
+	bits := qrFormatBits(mask)
+	bit := func(i int) bool { return bits>>i&1 == 1 }
+	for i := 0; i <= 5; i++ {
+		q.setFunction(8, i, bit(i))
+	}
+	q.setFunction(8, 7, bit(6))
+	q.setFunction(8, 8, bit(7))
+	q.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.setFunction(14-i, 8, bit(i))
+	}
+	for i := 0; i < 8; i++ {
+		q.setFunction(q.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.setFunction(8, q.size-15+i, bit(i))
+	}
+	q.setFunction(8, q.size-8, true)
+}
+
+// drawCodewords places the codewords in the zigzag order of the
+// specification, skipping function modules.
+func (q *qrCode) drawCodewords(data []byte) {
+	i := 0
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < q.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if upward {
+					y = q.size - 1 - vert
+				}
+				if !q.function[y][x] && i < len(data)*8 {
+					q.modules[y][x] = data[i>>3]>>(7-i&7)&1 == 1
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask XORs the data modules with mask pattern mask. Applying the
+// same mask twice restores the original modules.
+func (q *qrCode) applyMask(mask int) {
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !q.function[y][x] {
+				q.modules[y][x] = !q.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores the symbol with the four mask evaluation rules; the mask
+// with the lowest score is used.
+func (q *qrCode) penalty() int {
+	at := func(x, y int, vertical bool) bool {
+		if vertical {
+			return q.modules[x][y]
+		}
+		return q.modules[y][x]
+	}
+	finderLike := [][]bool{
+		{true, false, true, true, true, false, true, false, false, false, false},
+		{false, false, false, false, true, false, true, true, true, false, true},
+	}
+
+	score := 0
+	for _, vertical := range []bool{false, true} {
+		for y := 0; y < q.size; y++ {
+			run := 1
+			for x := 1; x <= q.size; x++ {
+				if x < q.size && at(x, y, vertical) == at(x-1, y, vertical) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					score += run - 2
+				}
+				run = 1
+			}
+			for x := 0; x+11 <= q.size; x++ {
+				for _, pattern := range finderLike {
+					match := true
+					for k, dark := range pattern {
+						if at(x+k, y, vertical) != dark {
+							match = false
+							break
+						}
+					}
+					if match {
+						score += 40
+					}
+				}
+			}
+		}
+	}
+
+	dark := 0
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if q.modules[y][x] {
+				dark++
+			}
+			if x+1 < q.size && y+1 < q.size {
+				c := q.modules[y][x]
+				if c == q.modules[y][x+1] && c == q.modules[y+1][x] && c == q.modules[y+1][x+1] {
+					score += 3
+				}
+			}
+		}
+	}
+	total := q.size * q.size
+	score += abs(dark*20-total*10) / total * 10
+	return score
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// png renders the symbol with scale pixels per module and a quiet zone.
+func (q *qrCode) png(scale int) ([]byte, error) {
+	side := (q.size + 2*QRCodeQuietZone) * scale
+	img := image.NewGray(image.Rect(0, 0, side, side))
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if !q.modules[y][x] {
+				continue
+			}
+			px, py := (x+QRCodeQuietZone)*scale, (y+QRCodeQuietZone)*scale
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetGray(px+dx, py+dy, color.Gray{})
+				}
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// svg renders the symbol as one path in module units with a quiet zone.
+func (q *qrCode) svg() string {
+	side := q.size + 2*QRCodeQuietZone
+	var path strings.Builder
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if q.modules[y][x] {
+				fmt.Fprintf(&path, "M%d,%dh1v1h-1z", x+QRCodeQuietZone, y+QRCodeQuietZone)
+			}
+		}
+	}
+	return fmt.Sprintf(
+		`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges"><rect width="100%%" height="100%%" fill="#ffffff"/><path d="%s" fill="#000000"/></svg>`,
+		side, side, path.String(),
+	)
+}
+
+// ---------------------------------------------------------------------------
+// GET /data/{resource}:qrcode
+// ---------------------------------------------------------------------------
+
+// knownQRCodeParams lists the query parameters accepted by :qrcode.
+var knownQRCodeParams = map[string]bool{
+	"id":     true,
+	"field":  true,
+	"format": true,
+}
+
+// HandleQRCode returns a QR code encoding one field of the record named by
+// id. Strings are encoded as-is and other values as JSON. The response is
+// an SVG or PNG image, not the JSON envelope.
+func (h *ResourceRenderHandler) HandleQRCode(w http.ResponseWriter, r *http.Request) {
+	resource := extractResource(r.URL.Path)
+	col, ok := h.registry.Get(resource)
+	if !ok {
+		WriteError(w, http.StatusNotFound, fmt.Sprintf("Resource '%s' not found", resource))
+		return
+	}
+	if col.System {
+		WriteError(w, http.StatusBadRequest, fmt.Sprintf("QR codes are not supported for '%s'", resource))
+		return
+	}
+
+	q := r.URL.Query()
+	for key := range q {
+		if !knownQRCodeParams[key] {
+			WriteError(w, http.StatusBadRequest, fmt.Sprintf("Unknown query parameter %q", key))
+			return
+		}
+	}
+	id, field := q.Get("id"), q.Get("field")
+	if id == "" {
+		WriteError(w, http.StatusBadRequest, "Missing required parameter: id")
+		return
+	}
+	if field == "" {
+		WriteError(w, http.StatusBadRequest, "Missing required parameter: field")
+		return
+	}
+	format := q.Get("format")
+	if format == "" {
+		format = "svg"
+	}
+	if format != "svg" && format != "png" {
+		WriteError(w, http.StatusBadRequest, "Invalid format: must be svg or png")
+		return
+	}
+
+	rows, _, err := h.db.QueryRows(r.Context(), resource, QueryOptions{
+		Filters: append([]Filter{{Field: "id", Op: "eq", Value: id}}, ownerFilters(r, col)...),
+		Page:    1,
+		PerPage: 1,
+	})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if len(rows) == 0 {
+		WriteError(w, http.StatusNotFound, "Resource not found")
+		return
+	}
+	record := filterHiddenFields(resource, formatRecord(rows[0], col))
+	value, ok := record[field]
+	if !ok {
+		WriteError(w, http.StatusBadRequest, fmt.Sprintf("Unknown field '%s'", field))
+		return
+	}
+	if value == nil {
+		WriteError(w, http.StatusNotFound, fmt.Sprintf("Field '%s' has no value", field))
+		return
+	}
+
+	text, isString := value.(string)
+	if !isString {
+		b, err := json.Marshal(value)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		text = string(b)
+	}
+	code, err := encodeQRCode([]byte(text))
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Sprintf("Field '%s' is too long for a QR code: %v", field, err))
+		return
+	}
+
+	if format == "svg" {
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(code.svg()))
+		return
+	}
+	img, err := code.png(QRCodeModuleScale)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.WriteHeader(http.StatusOK)
+	w.Write(img)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReedSolomonRemainder(t *testing.T) {
+	// Version 1-M "HELLO WORLD" example from the QR code specification
+	// tutorials.
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := reedSolomonRemainder(data, reedSolomonDivisor(10)); !bytes.Equal(got, want) {
+		t.Fatalf("remainder = %v, want %v", got, want)
+	}
+}
+
+func TestQRCodeTables(t *testing.T) {
+	formats := map[int]int{0: 0b101010000010010, 1: 0b101000100100101, 4: 0b100010111111001, 7: 0b100101010100000}
+	for mask, want := range formats {
+		if got := qrFormatBits(mask); got != want {
+			t.Errorf("format bits for mask %d = %015b, want %015b", mask, got, want)
+		}
+	}
+	if got := qrVersionBits(7); got != 0x07C94 {
+		t.Errorf("version 7 bits = %#x, want 0x07c94", got)
+	}
+
+	capacities := []int{1: 14, 2: 26, 3: 42, 4: 62, 5: 84, 6: 106, 7: 122, 8: 152, 9: 180, 10: 213}
+	remainderBits := []int{1: 0, 2: 7, 3: 7, 4: 7, 5: 7, 6: 7, 7: 0, 8: 0, 9: 0, 10: 0}
+	for v := 1; v <= QRCodeMaxVersion; v++ {
+		if got := qrCapacity(v); got != capacities[v] {
+			t.Errorf("version %d capacity = %d, want %d", v, got, capacities[v])
+		}
+		// Every module outside the function patterns holds a codeword bit
+		// or a remainder bit.
+		q := newQRCode(v)
+		free := 0
+		for _, row := range q.function {
+			for _, fn := range row {
+				if !fn {
+					free++
+				}
+			}
+		}
+		layout := qrLayoutsM[v]
+		total := layout.dataCodewords() + (layout.shortBlocks+layout.longBlocks)*layout.ecPerBlock
+		if free != total*8+remainderBits[v] {
+			t.Errorf("version %d has %d data modules, want %d", v, free, total*8+remainderBits[v])
+		}
+	}
+}
+
+func TestEncodeQRCode(t *testing.T) {
+	code, err := encodeQRCode([]byte("SKU-0001"))
+	if err != nil {
+		t.Fatalf("encodeQRCode: %v", err)
+	}
+	if code.size != 21 {
+		t.Fatalf("expected version 1 (21 modules), got %d", code.size)
+	}
+	if !code.modules[0][0] || code.modules[1][1] || !code.modules[3][3] || code.modules[7][7] {
+		t.Error("top-left finder pattern is not drawn")
+	}
+
+	long, err := encodeQRCode([]byte(strings.Repeat("x", 213)))
+	if err != nil || long.size != 57 {
+		t.Fatalf("expected 213 bytes to fit version 10, got %v", err)
+	}
+	if _, err := encodeQRCode([]byte(strings.Repeat("x", 214))); err == nil {
+		t.Fatal("expected an error above the maximum capacity")
+	}
+}
+
+func TestResourceQRCode(t *testing.T) {
+	adapter, registry := setupTemplateTest(t)
+	seedProducts(t, adapter)
+	h := NewResourceRenderHandler(adapter, registry)
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/data/products:qrcode?"+query, nil)
+		req = req.WithContext(SetAuthIdentity(req.Context(), adminIdentity()))
+		w := httptest.NewRecorder()
+		h.HandleQRCode(w, req)
+		return w
+	}
+
+	w := get("id=01J0001&field=title")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/svg+xml" || !strings.HasPrefix(w.Body.String(), "<svg") {
+		t.Fatalf("svg: %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	w = get("id=01J0001&field=quantity&format=png")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("png: %d %s", w.Code, w.Body.String())
+	}
+	img, err := png.Decode(w.Body)
+	if err != nil {
+		t.Fatalf("decode png: %v", err)
+	}
+	if side := (21 + 2*QRCodeQuietZone) * QRCodeModuleScale; img.Bounds().Dx() != side {
+		t.Errorf("expected %dpx image, got %d", side, img.Bounds().Dx())
+	}
+
+	for query, want := range map[string]int{
+		"field=title":                       http.StatusBadRequest,
+		"id=01J0001":                        http.StatusBadRequest,
+		"id=01J0001&field=title&format=gif": http.StatusBadRequest,
+		"id=01J0001&field=missing":          http.StatusBadRequest,
+		"id=01J0004&field=description":      http.StatusNotFound,
+		"id=01J9999&field=title":            http.StatusNotFound,
+	} {
+		if w := get(query); w.Code != want {
+			t.Errorf("%s: expected %d, got %d", query, want, w.Code)
+		}
+	}
+}
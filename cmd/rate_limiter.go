@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -15,25 +17,33 @@ import (
 
 // slidingWindowLimiter is a concurrency-safe in-memory sliding window rate limiter.
 type slidingWindowLimiter struct {
-	mu     sync.Mutex
-	hits   map[string][]time.Time
-	limit  int
-	window time.Duration
+	mu       sync.Mutex
+	hits     map[string][]time.Time
+	rejected map[string][]time.Time // recent denials, for diagnostics
+	limits   map[string]int         // per-key limit overrides seen via AllowWithLimit
+	limit    int
+	window   time.Duration
+	now      func() time.Time
 }
 
 // newSlidingWindowLimiter creates a sliding window limiter with the given limit and window.
 func newSlidingWindowLimiter(limit int, window time.Duration) *slidingWindowLimiter {
 	return &slidingWindowLimiter{
-		hits:   make(map[string][]time.Time),
-		limit:  limit,
-		window: window,
+		hits:     make(map[string][]time.Time),
+		rejected: make(map[string][]time.Time),
+		limits:   make(map[string]int),
+		limit:    limit,
+		window:   window,
+		now:      time.Now,
 	}
 }
 
 // Allow returns true if the key is below the limit and records the hit.
 // Returns false without recording a hit if the limit is already reached.
 func (l *slidingWindowLimiter) Allow(key string) bool {
-	return l.AllowWithLimit(key, l.limit)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.allowLocked(key, l.limit)
 }
 
 // AllowWithLimit returns true if the key is below the provided limit and
@@ -42,34 +52,59 @@ func (l *slidingWindowLimiter) Allow(key string) bool {
 func (l *slidingWindowLimiter) AllowWithLimit(key string, limit int) bool {
 	l.mu.Lock()
 	defer l.mu.Unlock()
+	return l.allowLocked(key, limit)
+}
 
-	now := time.Now()
+// allowLocked implements AllowWithLimit. Callers must hold l.mu.
+func (l *slidingWindowLimiter) allowLocked(key string, limit int) bool {
+	now := l.now()
 	cutoff := now.Add(-l.window)
 	l.hits[key] = keepAfter(l.hits[key], cutoff)
+	if limit != l.limit {
+		l.limits[key] = limit
+	}
 
 	if len(l.hits[key]) >= limit {
+		l.recordRejection(key, now, cutoff)
 		return false
 	}
 	l.hits[key] = append(l.hits[key], now)
 	return true
 }
 
+// SetLimit changes the default limit. Hits already recorded count against
+// the new limit.
+func (l *slidingWindowLimiter) SetLimit(limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = limit
+}
+
 // IsExceeded returns true if the key is at or over the limit without recording a hit.
 func (l *slidingWindowLimiter) IsExceeded(key string) bool {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	now := time.Now()
+	now := l.now()
 	cutoff := now.Add(-l.window)
 	l.hits[key] = keepAfter(l.hits[key], cutoff)
-	return len(l.hits[key]) >= l.limit
+	if len(l.hits[key]) >= l.limit {
+		l.recordRejection(key, now, cutoff)
+		return true
+	}
+	return false
+}
+
+// recordRejection notes a denied request for key. Callers must hold l.mu.
+func (l *slidingWindowLimiter) recordRejection(key string, now, cutoff time.Time) {
+	l.rejected[key] = append(keepAfter(l.rejected[key], cutoff), now)
 }
 
 // RecordHit records a hit for key without checking the limit.
 func (l *slidingWindowLimiter) RecordHit(key string) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	l.hits[key] = append(l.hits[key], time.Now())
+	l.hits[key] = append(l.hits[key], l.now())
 }
 
 // Reset removes all recorded hits for key.
@@ -77,6 +112,96 @@ func (l *slidingWindowLimiter) Reset(key string) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 	delete(l.hits, key)
+	delete(l.rejected, key)
+	delete(l.limits, key)
+}
+
+// Has reports whether key has any hits or denials in the current window.
+func (l *slidingWindowLimiter) Has(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	cutoff := l.now().Add(-l.window)
+	return len(keepAfter(l.hits[key], cutoff)) > 0 || len(keepAfter(l.rejected[key], cutoff)) > 0
+}
+
+// Recent returns the number of hits for key in the current window and the
+// time of the most recent one.
+func (l *slidingWindowLimiter) Recent(key string) (int, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.hits[key] = keepAfter(l.hits[key], l.now().Add(-l.window))
+	hits := l.hits[key]
+	if len(hits) == 0 {
+		return 0, time.Time{}
+	}
+	return len(hits), hits[len(hits)-1]
+}
+
+// Remaining returns how many more hits key may record under limit in the
+// current window.
+func (l *slidingWindowLimiter) Remaining(key string, limit int) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.hits[key] = keepAfter(l.hits[key], l.now().Add(-l.window))
+	return max(limit-len(l.hits[key]), 0)
+}
+
+// limiterBucketState is a point-in-time view of one key's window.
+type limiterBucketState struct {
+	Key       string
+	Used      int
+	Limit     int
+	Rejected  int
+	ResetsAt  time.Time // when the oldest hit leaves the window
+	WindowSec int
+}
+
+// Snapshot returns the state of every key with activity in the current
+// window, pruning expired entries as a side effect.
+func (l *slidingWindowLimiter) Snapshot() []limiterBucketState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	cutoff := now.Add(-l.window)
+	keys := make(map[string]bool, len(l.hits))
+	for k := range l.hits {
+		keys[k] = true
+	}
+	for k := range l.rejected {
+		keys[k] = true
+	}
+
+	states := make([]limiterBucketState, 0, len(keys))
+	for key := range keys {
+		hits := keepAfter(l.hits[key], cutoff)
+		rejected := keepAfter(l.rejected[key], cutoff)
+		if len(hits) == 0 && len(rejected) == 0 {
+			delete(l.hits, key)
+			delete(l.rejected, key)
+			delete(l.limits, key)
+			continue
+		}
+		l.hits[key] = hits
+		l.rejected[key] = rejected
+
+		limit := l.limit
+		if override, ok := l.limits[key]; ok {
+			limit = override
+		}
+		state := limiterBucketState{
+			Key:       key,
+			Used:      len(hits),
+			Limit:     limit,
+			Rejected:  len(rejected),
+			WindowSec: int(l.window / time.Second),
+		}
+		if len(hits) > 0 {
+			state.ResetsAt = hits[0].Add(l.window)
+		}
+		states = append(states, state)
+	}
+	return states
 }
 
 // keepAfter returns the subset of ts that is strictly after cutoff.
@@ -95,12 +220,26 @@ func keepAfter(ts []time.Time, cutoff time.Time) []time.Time {
 // Aggregate rate limiter
 // ---------------------------------------------------------------------------
 
-// RateLimiter aggregates rate limiters for the three distinct traffic types
-// defined in SPEC.md: login failures, JWT requests, and API key requests.
+// RateLimiter aggregates rate limiters for the traffic types defined in
+// SPEC.md: login failures, JWT requests, API key requests, requests to
+// routes with a limits.routes policy, and password reset requests.
 type RateLimiter struct {
 	loginFailure  *slidingWindowLimiter
 	jwtRequest    *slidingWindowLimiter
 	apikeyRequest *slidingWindowLimiter
+	routeRequest  *slidingWindowLimiter
+	passwordReset *slidingWindowLimiter
+
+	loginChallenge LoginChallenge // optional; see SetLoginChallenge
+}
+
+// LoginChallenge is a pluggable check that login attempts must pass once
+// an IP and username pair has LoginChallengeAfterFailures recent failures.
+type LoginChallenge interface {
+	// Verify reports whether the login data carries a valid challenge answer.
+	Verify(data map[string]any) bool
+	// Challenge writes a fresh challenge response to the client.
+	Challenge(w http.ResponseWriter)
 }
 
 // NewRateLimiter creates a RateLimiter with limits taken from the constants in
@@ -110,6 +249,8 @@ func NewRateLimiter() *RateLimiter {
 		loginFailure:  newSlidingWindowLimiter(RateLoginFailureLimit, time.Duration(RateLoginFailureWindow)*time.Second),
 		jwtRequest:    newSlidingWindowLimiter(RateJWTRequestLimit, time.Duration(RateJWTRequestWindow)*time.Second),
 		apikeyRequest: newSlidingWindowLimiter(RateAPIKeyRequestLimit, time.Duration(RateAPIKeyRequestWindow)*time.Second),
+		routeRequest:  newSlidingWindowLimiter(0, time.Duration(RateRouteRequestWindow)*time.Second),
+		passwordReset: newSlidingWindowLimiter(RatePasswordResetLimit, time.Duration(RatePasswordResetWindow)*time.Second),
 	}
 }
 
@@ -129,11 +270,56 @@ func (r *RateLimiter) ResetLoginFailures(ip, username string) {
 	r.loginFailure.Reset(loginFailureKey(ip, username))
 }
 
+// LoginBackoff returns how long the given IP and username must wait before
+// the next login attempt is accepted. Delays from LoginBackoffDelays apply to
+// the failures leading up to the hard lockout at RateLoginFailureLimit.
+func (r *RateLimiter) LoginBackoff(ip, username string) time.Duration {
+	failures, last := r.loginFailure.Recent(loginFailureKey(ip, username))
+	delay := loginBackoffDelay(failures)
+	if delay == 0 {
+		return 0
+	}
+	return max(last.Add(delay).Sub(r.loginFailure.now()), 0)
+}
+
+// loginBackoffDelay maps a failure count to its progressive delay.
+func loginBackoffDelay(failures int) time.Duration {
+	i := failures - (RateLoginFailureLimit - len(LoginBackoffDelays))
+	if i < 0 || i >= len(LoginBackoffDelays) {
+		return 0
+	}
+	return time.Duration(LoginBackoffDelays[i]) * time.Second
+}
+
+// SetLoginChallenge installs the challenge required after repeated login
+// failures. A nil challenge disables the check.
+func (r *RateLimiter) SetLoginChallenge(c LoginChallenge) {
+	r.loginChallenge = c
+}
+
+// LoginChallengeFor returns the challenge the given IP and username must
+// pass, or nil when no challenge is configured or required yet.
+func (r *RateLimiter) LoginChallengeFor(ip, username string) LoginChallenge {
+	if r.loginChallenge == nil {
+		return nil
+	}
+	failures, _ := r.loginFailure.Recent(loginFailureKey(ip, username))
+	if failures < LoginChallengeAfterFailures {
+		return nil
+	}
+	return r.loginChallenge
+}
+
 // AllowJWT returns true if the JWT request is within the per-user limit.
 func (r *RateLimiter) AllowJWT(userID string) bool {
 	return r.jwtRequest.Allow(userID)
 }
 
+// SetJWTRequestLimit changes the per-user limit on JWT requests per window.
+func (r *RateLimiter) SetJWTRequestLimit(limit int) {
+	r.jwtRequest.SetLimit(limit)
+}
+
 // AllowAPIKey returns true if the API key request is within the per-key limit.
 func (r *RateLimiter) AllowAPIKey(keyID string) bool {
 	return r.apikeyRequest.Allow(keyID)
@@ -145,6 +331,152 @@ func (r *RateLimiter) AllowAPIKeyWithLimit(keyID string, limit int) bool {
 	return r.apikeyRequest.AllowWithLimit(keyID, limit)
 }
 
+// APIKeyRemaining returns how many more requests the API key bucket may make
+// under limit in the current window.
+func (r *RateLimiter) APIKeyRemaining(keyID string, limit int) int {
+	return r.apikeyRequest.Remaining(keyID, limit)
+}
+
+// AllowPasswordReset returns true if a password reset request from ip for
+// email is within both the per-IP and the per-email limit. Both buckets
+// record the hit only when both allow it.
+func (r *RateLimiter) AllowPasswordReset(ip, email string) bool {
+	ipKey := "ip:" + ip
+	emailKey := "email:" + strings.ToLower(email)
+	if r.passwordReset.IsExceeded(ipKey) || r.passwordReset.IsExceeded(emailKey) {
+		return false
+	}
+	r.passwordReset.RecordHit(ipKey)
+	r.passwordReset.RecordHit(emailKey)
+	return true
+}
+
+// routePatternRegex matches a limits.routes key: a resource or route name
+// and an action, either of which may be *.
+var routePatternRegex = regexp.MustCompile(`^(\*|[a-z][a-z0-9_]*):(\*|[a-z][a-z0-9_]*)$`)
+
+// routeName returns the name:action form of a request path, such as
+// "orders:mutate" for /data/orders:mutate or "auth:session" for
+// /auth:session, or "" for paths without an action.
+func routeName(path string) string {
+	name := path[strings.LastIndex(path, "/")+1:]
+	if !strings.Contains(name, ":") {
+		return ""
+	}
+	return name
+}
+
+// matchRoutePattern returns the pattern in patterns, as in limits.routes or
+// slo.targets, that applies to route and its value. An exact pattern wins
+// over name:*, which wins over *:action, which wins over *:*.
+func matchRoutePattern(patterns map[string]int, route string) (string, int) {
+	name, action, ok := strings.Cut(route, ":")
+	if !ok || len(patterns) == 0 {
+		return "", 0
+	}
+	for _, pattern := range []string{route, name + ":*", "*:" + action, "*:*"} {
+		if value, ok := patterns[pattern]; ok {
+			return pattern, value
+		}
+	}
+	return "", 0
+}
+
+// AllowRoute returns true if the caller is within the limit of the
+// limits.routes policy for route. Requests to routes without a policy are
+// always allowed. The bucket is the matched pattern and the caller, so
+// routes sharing a pattern share a bucket.
+func (r *RateLimiter) AllowRoute(route, caller string) (string, bool) {
+	pattern, limit := matchRoutePattern(requestLimits().Routes, route)
+	if pattern == "" {
+		return "", true
+	}
+	bucket := pattern + "|" + caller
+	return bucket, r.routeRequest.AllowWithLimit(bucket, limit)
+}
+
+// RateLimitBucket is the diagnostic view of one rate limit bucket exposed
+// through the admin rate limit endpoint.
+type RateLimitBucket struct {
+	Type       string  `json:"type"`
+	Entity     string  `json:"entity"`
+	Used       int     `json:"used"`
+	Limit      int     `json:"limit"`
+	Remaining  int     `json:"remaining"`
+	Saturation float64 `json:"saturation"`
+	Rejected   int     `json:"rejected"`
+	Window     int     `json:"window_seconds"`
+	ResetsAt   *string `json:"resets_at"`
+}
+
+// limiterFor returns the limiter for a bucket type name.
+func (r *RateLimiter) limiterFor(bucketType string) (*slidingWindowLimiter, bool) {
+	switch bucketType {
+	case RateLimitTypeLoginFailure:
+		return r.loginFailure, true
+	case RateLimitTypeJWT:
+		return r.jwtRequest, true
+	case RateLimitTypeAPIKey:
+		return r.apikeyRequest, true
+	case RateLimitTypeRoute:
+		return r.routeRequest, true
+	case RateLimitTypePasswordReset:
+		return r.passwordReset, true
+	}
+	return nil, false
+}
+
+// Buckets returns every active bucket across all limiters, ordered by type
+// and then by saturation (most throttled first).
+func (r *RateLimiter) Buckets() []RateLimitBucket {
+	var out []RateLimitBucket
+	for _, bucketType := range []string{RateLimitTypeLoginFailure, RateLimitTypeJWT, RateLimitTypeAPIKey, RateLimitTypeRoute, RateLimitTypePasswordReset} {
+		limiter, _ := r.limiterFor(bucketType)
+		start := len(out)
+		for _, st := range limiter.Snapshot() {
+			b := RateLimitBucket{
+				Type:     bucketType,
+				Entity:   st.Key,
+				Used:     st.Used,
+				Limit:    st.Limit,
+				Rejected: st.Rejected,
+				Window:   st.WindowSec,
+			}
+			b.Remaining = st.Limit - st.Used
+			if b.Remaining < 0 {
+				b.Remaining = 0
+			}
+			if st.Limit > 0 {
+				b.Saturation = float64(st.Used) / float64(st.Limit)
+			}
+			if !st.ResetsAt.IsZero() {
+				ts := st.ResetsAt.UTC().Format(time.RFC3339)
+				b.ResetsAt = &ts
+			}
+			out = append(out, b)
+		}
+		group := out[start:]
+		sort.Slice(group, func(i, j int) bool {
+			if group[i].Saturation != group[j].Saturation {
+				return group[i].Saturation > group[j].Saturation
+			}
+			return group[i].Entity < group[j].Entity
+		})
+	}
+	return out
+}
+
+// ResetBucket clears one bucket. It returns false when the type is unknown
+// or the entity has no activity in the current window.
+func (r *RateLimiter) ResetBucket(bucketType, entity string) bool {
+	limiter, ok := r.limiterFor(bucketType)
+	if !ok || !limiter.Has(entity) {
+		return false
+	}
+	limiter.Reset(entity)
+	return true
+}
+
 // loginFailureKey returns the composite rate-limit key for login failure tracking.
 func loginFailureKey(ip, username string) string {
 	return fmt.Sprintf("%s:%s", ip, strings.ToLower(username))
@@ -167,6 +167,46 @@ func TestRateLimiter_LoginFailure_CaseInsensitive(t *testing.T) {
 	}
 }
 
+func TestRateLimiter_LoginBackoff(t *testing.T) {
+	rl := NewRateLimiter()
+	now := time.Now()
+	rl.loginFailure.now = func() time.Time { return now }
+
+	wantDelays := make([]int, RateLoginFailureLimit)
+	copy(wantDelays[RateLoginFailureLimit-len(LoginBackoffDelays):], LoginBackoffDelays)
+	for failures := 1; failures < RateLoginFailureLimit; failures++ {
+		rl.RecordLoginFailure("10.0.0.1", "alice")
+		want := time.Duration(wantDelays[failures]) * time.Second
+		if got := rl.LoginBackoff("10.0.0.1", "alice"); got != want {
+			t.Errorf("after %d failures: expected %v, got %v", failures, want, got)
+		}
+	}
+
+	now = now.Add(2 * time.Second)
+	want := time.Duration(LoginBackoffDelays[len(LoginBackoffDelays)-1])*time.Second - 2*time.Second
+	if got := rl.LoginBackoff("10.0.0.1", "alice"); got != want {
+		t.Errorf("expected remaining %v, got %v", want, got)
+	}
+}
+
+func TestRateLimiter_LoginChallengeFor(t *testing.T) {
+	rl := NewRateLimiter()
+	for range LoginChallengeAfterFailures {
+		rl.RecordLoginFailure("10.0.0.1", "alice")
+	}
+	if rl.LoginChallengeFor("10.0.0.1", "alice") != nil {
+		t.Error("expected no challenge when no hook is configured")
+	}
+
+	rl.SetLoginChallenge(NewCaptchaLoginChallenge(NewCaptchaStore()))
+	if rl.LoginChallengeFor("10.0.0.1", "alice") == nil {
+		t.Error("expected challenge after threshold")
+	}
+	if rl.LoginChallengeFor("10.0.0.1", "bob") != nil {
+		t.Error("expected no challenge for a user without failures")
+	}
+}
+
 func TestRateLimiter_JWT(t *testing.T) {
 	rl := NewRateLimiter()
 
@@ -383,3 +423,174 @@ func TestRateLimitMiddleware_APIKey_Allowed(t *testing.T) {
 		t.Fatal("expected inner handler to be called")
 	}
 }
+
+// TestRateLimitMiddleware_APIKey_Headers verifies that API key responses
+// report the key's own limit and the requests left in the window.
+func TestRateLimitMiddleware_APIKey_Headers(t *testing.T) {
+	rl := NewRateLimiter()
+	logger := middlewareTestLogger()
+	handler := rateLimitMiddleware(rl, logger, http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(200)
+	}))
+
+	identity := &AuthIdentity{CredentialType: CredentialTypeAPIKey, CallerID: "apikey-custom", RateLimit: 2}
+	for i, want := range []struct {
+		code      int
+		remaining string
+	}{{200, "1"}, {200, "0"}, {429, "0"}} {
+		req := httptest.NewRequest("GET", "/data/test:query", nil)
+		req = req.WithContext(SetAuthIdentity(req.Context(), identity))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != want.code {
+			t.Fatalf("request %d: expected %d, got %d", i, want.code, w.Code)
+		}
+		if got := w.Header().Get("X-RateLimit-Limit"); got != "2" {
+			t.Errorf("request %d: X-RateLimit-Limit = %q, want 2", i, got)
+		}
+		if got := w.Header().Get("X-RateLimit-Remaining"); got != want.remaining {
+			t.Errorf("request %d: X-RateLimit-Remaining = %q, want %s", i, got, want.remaining)
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Bucket inspection
+// ---------------------------------------------------------------------------
+
+func TestMatchRoutePattern(t *testing.T) {
+	routes := map[string]int{"orders:mutate": 1, "orders:*": 2, "*:mutate": 3, "*:*": 4}
+	for _, tt := range []struct {
+		route, pattern string
+		limit          int
+	}{
+		{"orders:mutate", "orders:mutate", 1},
+		{"orders:query", "orders:*", 2},
+		{"products:mutate", "*:mutate", 3},
+		{"auth:session", "*:*", 4},
+		{"", "", 0},
+	} {
+		if pattern, limit := matchRoutePattern(routes, tt.route); pattern != tt.pattern || limit != tt.limit {
+			t.Errorf("matchRoutePattern(%q) = %q, %d; want %q, %d", tt.route, pattern, limit, tt.pattern, tt.limit)
+		}
+	}
+	if name := routeName("/api/data/orders:mutate"); name != "orders:mutate" {
+		t.Errorf("routeName = %q", name)
+	}
+	if name := routeName("/health"); name != "" {
+		t.Errorf("routeName(/health) = %q, want empty", name)
+	}
+}
+
+// TestRateLimitMiddleware_RoutePolicies verifies that limits.routes throttles
+// matching routes per caller, and anonymous requests per client IP.
+func TestRateLimitMiddleware_RoutePolicies(t *testing.T) {
+	limits := requestLimits()
+	limits.Routes = map[string]int{"*:mutate": 2, "auth:session": 1}
+	SetRequestLimits(limits)
+	t.Cleanup(func() { liveLimits.Store(nil) })
+
+	rl := NewRateLimiter()
+	handler := rateLimitMiddleware(rl, middlewareTestLogger(), http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(200)
+	}))
+	serve := func(method, target, callerID string) int {
+		req := httptest.NewRequest(method, target, nil)
+		if callerID != "" {
+			identity := &AuthIdentity{CredentialType: CredentialTypeJWT, CallerID: callerID}
+			req = req.WithContext(SetAuthIdentity(req.Context(), identity))
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Writes to any collection share the *:mutate bucket.
+	for i, want := range []int{200, 200, 429} {
+		target := []string{"/data/orders:mutate", "/data/products:mutate", "/data/orders:mutate"}[i]
+		if code := serve("POST", target, "user-a"); code != want {
+			t.Errorf("write %d: expected %d, got %d", i, want, code)
+		}
+	}
+	if code := serve("POST", "/data/orders:mutate", "user-b"); code != 200 {
+		t.Errorf("expected another caller's writes to be allowed, got %d", code)
+	}
+	for range 5 {
+		if code := serve("GET", "/data/orders:query", "user-a"); code != 200 {
+			t.Fatalf("expected reads to be unaffected, got %d", code)
+		}
+	}
+
+	if code := serve("POST", "/auth:session", ""); code != 200 {
+		t.Fatalf("first login: expected 200, got %d", code)
+	}
+	if code := serve("POST", "/auth:session", ""); code != 429 {
+		t.Errorf("second login from the same IP: expected 429, got %d", code)
+	}
+
+	buckets := rl.Buckets()
+	found := false
+	for _, b := range buckets {
+		if b.Type == RateLimitTypeRoute && b.Entity == "*:mutate|user-a" && b.Limit == 2 {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected a route bucket for user-a, got %+v", buckets)
+	}
+}
+
+func TestRateLimiter_Buckets(t *testing.T) {
+	rl := NewRateLimiter()
+
+	for range 3 {
+		rl.AllowAPIKeyWithLimit("key-a", 3)
+	}
+	if rl.AllowAPIKeyWithLimit("key-a", 3) {
+		t.Fatal("fourth request should be denied")
+	}
+	rl.AllowJWT("user-1")
+
+	buckets := rl.Buckets()
+	if len(buckets) != 2 {
+		t.Fatalf("expected 2 buckets, got %+v", buckets)
+	}
+
+	jwt, apikey := buckets[0], buckets[1]
+	if jwt.Type != RateLimitTypeJWT || jwt.Entity != "user-1" || jwt.Used != 1 {
+		t.Errorf("unexpected jwt bucket: %+v", jwt)
+	}
+	if apikey.Type != RateLimitTypeAPIKey || apikey.Limit != 3 || apikey.Remaining != 0 {
+		t.Errorf("unexpected apikey bucket: %+v", apikey)
+	}
+	if apikey.Saturation != 1 || apikey.Rejected != 1 {
+		t.Errorf("expected saturation 1 and 1 rejection, got %+v", apikey)
+	}
+	if apikey.ResetsAt == nil {
+		t.Error("expected resets_at for an active bucket")
+	}
+}
+
+func TestRateLimiter_ResetBucket(t *testing.T) {
+	rl := NewRateLimiter()
+	for range RateLoginFailureLimit {
+		rl.RecordLoginFailure("10.0.0.1", "alice")
+	}
+	key := loginFailureKey("10.0.0.1", "alice")
+
+	if rl.ResetBucket("unknown", key) {
+		t.Fatal("unknown type must not reset")
+	}
+	if rl.ResetBucket(RateLimitTypeLoginFailure, "nobody") {
+		t.Fatal("inactive entity must not report a reset")
+	}
+	if !rl.ResetBucket(RateLimitTypeLoginFailure, key) {
+		t.Fatal("expected reset to succeed")
+	}
+	if rl.LoginFailureExceeded("10.0.0.1", "alice") {
+		t.Fatal("bucket should be cleared after reset")
+	}
+	if len(rl.Buckets()) != 0 {
+		t.Fatalf("expected no buckets after reset, got %+v", rl.Buckets())
+	}
+}
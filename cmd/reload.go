@@ -0,0 +1,237 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ---------------------------------------------------------------------------
+// Configuration reload
+//
+// On SIGHUP the server rereads its configuration file. The log level, CORS
+// settings, slow query threshold, and request limits (including the body
+// size limit) take effect at once;
+// every other setting is read only at startup, so a changed value is
+// logged and ignored until the next restart.
+// ---------------------------------------------------------------------------
+
+// liveLimits holds the request limits in force; see SetRequestLimits.
+var liveLimits atomic.Pointer[LimitsConfig]
+
+// SetRequestLimits replaces the pagination and batch limits applied by the
+// handlers.
+func SetRequestLimits(limits LimitsConfig) {
+	liveLimits.Store(&limits)
+}
+
+// requestLimits returns the limits last passed to SetRequestLimits, or the
+// built-in defaults if there were none.
+func requestLimits() LimitsConfig {
+	if l := liveLimits.Load(); l != nil {
+		return *l
+	}
+	return LimitsConfig{
+		JWTRequestsPerMinute: RateJWTRequestLimit,
+		MaxBatchOperations:   MaxBatchOperations,
+		MaxPerPage:           MaxPerPage,
+		DefaultPerPage:       DefaultPerPage,
+		MaxRequestBody:       MaxRequestBodyBytes,
+	}
+}
+
+// configSetting is one configuration key, compared between reloads.
+type configSetting struct {
+	key        string
+	reloadable bool
+	value      func(*AppConfig) any
+}
+
+// configSettings lists every configuration key and whether a reload
+// applies it.
+var configSettings = []configSetting{
+	{KeyServerLogLevel, true, func(c *AppConfig) any { return c.Server.LogLevel }},
+	{KeyDatabaseSlowQueryThreshold, true, func(c *AppConfig) any { return c.Database.SlowQueryThreshold }},
+	{KeyCORSEnabled, true, func(c *AppConfig) any { return c.CORS.Enabled }},
+	{KeyCORSAllowedOrigins, true, func(c *AppConfig) any { return c.CORS.AllowedOrigins }},
+	{KeyCORSAllowedMethods, true, func(c *AppConfig) any { return c.CORS.AllowedMethods }},
+	{KeyCORSAllowedHeaders, true, func(c *AppConfig) any { return c.CORS.AllowedHeaders }},
+	{KeyCORSAllowCredentials, true, func(c *AppConfig) any { return c.CORS.AllowCredentials }},
+	{KeyCORSMaxAge, true, func(c *AppConfig) any { return c.CORS.MaxAge }},
+	{KeyCORSOrigins, true, func(c *AppConfig) any { return c.CORS.Origins }},
+	{KeyLimitsJWTRequestsPerMinute, true, func(c *AppConfig) any { return c.Limits.JWTRequestsPerMinute }},
+	{KeyLimitsMaxBatchOperations, true, func(c *AppConfig) any { return c.Limits.MaxBatchOperations }},
+	{KeyLimitsMaxPerPage, true, func(c *AppConfig) any { return c.Limits.MaxPerPage }},
+	{KeyLimitsDefaultPerPage, true, func(c *AppConfig) any { return c.Limits.DefaultPerPage }},
+	{KeyLimitsMaxRequestBody, true, func(c *AppConfig) any { return c.Limits.MaxRequestBody }},
+	{KeyLimitsMaxConcurrentRequests, true, func(c *AppConfig) any { return c.Limits.MaxConcurrentRequests }},
+	{KeyLimitsRoutes, true, func(c *AppConfig) any { return c.Limits.Routes }},
+
+	{KeyServerHost, false, func(c *AppConfig) any { return c.Server.Host }},
+	{KeyServerPort, false, func(c *AppConfig) any { return c.Server.Port }},
+	{KeyServerPrefix, false, func(c *AppConfig) any { return c.Server.Prefix }},
+	{KeyServerLogpath, false, func(c *AppConfig) any { return c.Server.Logpath }},
+	{KeyServerPprof, false, func(c *AppConfig) any { return c.Server.Pprof }},
+	{KeyServerShutdownTimeout, false, func(c *AppConfig) any { return c.Server.ShutdownTimeout }},
+	{KeyServerCompression, false, func(c *AppConfig) any { return c.Server.Compression }},
+	{KeyServerTLSCertFile, false, func(c *AppConfig) any { return c.Server.TLS.CertFile }},
+	{KeyServerTLSKeyFile, false, func(c *AppConfig) any { return c.Server.TLS.KeyFile }},
+	{KeyServerTLSACMEHosts, false, func(c *AppConfig) any { return c.Server.TLS.ACMEHosts }},
+	{KeyServerTLSACMEEmail, false, func(c *AppConfig) any { return c.Server.TLS.ACMEEmail }},
+	{KeyServerTLSACMECacheDir, false, func(c *AppConfig) any { return c.Server.TLS.ACMECacheDir }},
+	{KeyServerTLSHSTSMaxAge, false, func(c *AppConfig) any { return c.Server.TLS.HSTSMaxAge }},
+	{KeyDatabaseConnection, false, func(c *AppConfig) any { return c.Database.Connection }},
+	{KeyDatabaseDatabase, false, func(c *AppConfig) any { return c.Database.Database }},
+	{KeyDatabaseUser, false, func(c *AppConfig) any { return c.Database.User }},
+	{KeyDatabasePassword, false, func(c *AppConfig) any { return c.Database.Password }},
+	{KeyDatabaseHost, false, func(c *AppConfig) any { return c.Database.Host }},
+	{KeyDatabaseQueryTimeout, false, func(c *AppConfig) any { return c.Database.QueryTimeout }},
+	{KeyDatabaseConnectRetries, false, func(c *AppConfig) any { return c.Database.ConnectRetries }},
+	{KeyDatabaseConnectMaxDelay, false, func(c *AppConfig) any { return c.Database.ConnectMaxDelay }},
+	{KeyDatabaseHealthInterval, false, func(c *AppConfig) any { return c.Database.HealthInterval }},
+	{KeyDatabaseReplicas, false, func(c *AppConfig) any { return c.Database.Replicas }},
+	{KeyJWTSecret, false, func(c *AppConfig) any { return c.JWTSecret }},
+	{KeyJWTAccessExpiry, false, func(c *AppConfig) any { return c.JWTAccessExpiry }},
+	{KeyJWTRefreshExpiry, false, func(c *AppConfig) any { return c.JWTRefreshExpiry }},
+	{KeyJWTStaleClaims, false, func(c *AppConfig) any { return c.JWTStaleClaims }},
+	{KeyJWTIdleTimeout, false, func(c *AppConfig) any { return c.JWTIdleTimeout }},
+	{KeyJWTRoles, false, func(c *AppConfig) any { return c.JWTRoles }},
+	{KeyJWTAlgorithm, false, func(c *AppConfig) any { return c.JWTAlgorithm }},
+	{KeyJWTKeyFile, false, func(c *AppConfig) any { return c.JWTKeyFile }},
+	{KeyJWTPreviousKeyFiles, false, func(c *AppConfig) any { return c.JWTPreviousKeyFiles }},
+	{KeyBootstrapAdminUsername, false, func(c *AppConfig) any { return c.BootstrapAdminUsername }},
+	{KeyBootstrapAdminEmail, false, func(c *AppConfig) any { return c.BootstrapAdminEmail }},
+	{KeyBootstrapAdminPassword, false, func(c *AppConfig) any { return c.BootstrapAdminPassword }},
+	{KeyBundleKey, false, func(c *AppConfig) any { return c.BundleKey }},
+	{KeyWellKnownRobotsTxt, false, func(c *AppConfig) any { return c.WellKnown.RobotsTxt }},
+	{KeyWellKnownSecurityTxt, false, func(c *AppConfig) any { return c.WellKnown.SecurityTxt }},
+	{KeyErrorReportingSentryDSN, false, func(c *AppConfig) any { return c.ErrorReporting.SentryDSN }},
+	{KeyErrorReportingEnvironment, false, func(c *AppConfig) any { return c.ErrorReporting.Environment }},
+	{KeyCacheBackend, false, func(c *AppConfig) any { return c.Cache.Backend }},
+	{KeyCacheRedisURL, false, func(c *AppConfig) any { return c.Cache.RedisURL }},
+	{KeyCacheQueryTTL, false, func(c *AppConfig) any { return c.Cache.QueryTTL }},
+	{KeyCacheQueryMaxBytes, false, func(c *AppConfig) any { return c.Cache.QueryMaxBytes }},
+	{KeyTracingOTLPEndpoint, false, func(c *AppConfig) any { return c.Tracing.OTLPEndpoint }},
+	{KeyTracingServiceName, false, func(c *AppConfig) any { return c.Tracing.ServiceName }},
+	{KeyAggregatePrivacyEpsilon, false, func(c *AppConfig) any { return c.AggregatePrivacy.Epsilon }},
+	{KeyAggregatePrivacyMinGroupSize, false, func(c *AppConfig) any { return c.AggregatePrivacy.MinGroupSize }},
+	{KeySLOObjective, false, func(c *AppConfig) any { return c.SLO.Objective }},
+	{KeySLOTargets, false, func(c *AppConfig) any { return c.SLO.Targets }},
+	{KeyOIDCIssuer, false, func(c *AppConfig) any { return c.OIDC.Issuer }},
+	{KeyOIDCClientID, false, func(c *AppConfig) any { return c.OIDC.ClientID }},
+	{KeyOIDCClientSecret, false, func(c *AppConfig) any { return c.OIDC.ClientSecret }},
+	{KeyOIDCRedirectURI, false, func(c *AppConfig) any { return c.OIDC.RedirectURI }},
+	{KeyOIDCScopes, false, func(c *AppConfig) any { return c.OIDC.Scopes }},
+	{KeyOIDCAutoProvision, false, func(c *AppConfig) any { return c.OIDC.AutoProvision }},
+	{KeyOIDCDefaultRole, false, func(c *AppConfig) any { return c.OIDC.DefaultRole }},
+	{KeyPasswordPolicyMinLength, false, func(c *AppConfig) any { return c.PasswordPolicy.MinLength }},
+	{KeyPasswordPolicyRequireLowercase, false, func(c *AppConfig) any { return c.PasswordPolicy.RequireLowercase }},
+	{KeyPasswordPolicyRequireUppercase, false, func(c *AppConfig) any { return c.PasswordPolicy.RequireUppercase }},
+	{KeyPasswordPolicyRequireDigit, false, func(c *AppConfig) any { return c.PasswordPolicy.RequireDigit }},
+	{KeyPasswordPolicyRequireSymbol, false, func(c *AppConfig) any { return c.PasswordPolicy.RequireSymbol }},
+	{KeyPasswordPolicyHistory, false, func(c *AppConfig) any { return c.PasswordPolicy.History }},
+	{KeyPasswordPolicyLockoutThreshold, false, func(c *AppConfig) any { return c.PasswordPolicy.LockoutThreshold }},
+	{KeyPasswordPolicyLockoutDuration, false, func(c *AppConfig) any { return c.PasswordPolicy.LockoutDuration }},
+	{KeyMailSMTPHost, false, func(c *AppConfig) any { return c.Mail.SMTPHost }},
+	{KeyMailSMTPPort, false, func(c *AppConfig) any { return c.Mail.SMTPPort }},
+	{KeyMailSMTPUsername, false, func(c *AppConfig) any { return c.Mail.SMTPUsername }},
+	{KeyMailSMTPPassword, false, func(c *AppConfig) any { return c.Mail.SMTPPassword }},
+	{KeyMailFrom, false, func(c *AppConfig) any { return c.Mail.From }},
+	{KeyMailDriver, false, func(c *AppConfig) any { return c.Mail.Driver }},
+	{KeyMailTemplateDir, false, func(c *AppConfig) any { return c.Mail.TemplateDir }},
+	{KeyPasswordResetURL, false, func(c *AppConfig) any { return c.PasswordReset.URL }},
+	{KeyPasswordResetTokenTTL, false, func(c *AppConfig) any { return c.PasswordReset.TokenTTL }},
+	{KeyInvitationURL, false, func(c *AppConfig) any { return c.Invitation.URL }},
+	{KeyInvitationTokenTTL, false, func(c *AppConfig) any { return c.Invitation.TokenTTL }},
+}
+
+// changedSettings returns the keys whose values differ between a and b,
+// split into those a reload applies and those that need a restart.
+func changedSettings(a, b *AppConfig) (reloadable, restart []string) {
+	for _, s := range configSettings {
+		if reflect.DeepEqual(s.value(a), s.value(b)) {
+			continue
+		}
+		if s.reloadable {
+			reloadable = append(reloadable, s.key)
+		} else {
+			restart = append(restart, s.key)
+		}
+	}
+	return reloadable, restart
+}
+
+// slowQueryThresholdSetter is implemented by adapters whose slow query
+// threshold can change while they run.
+type slowQueryThresholdSetter interface {
+	SetSlowQueryThreshold(ms int)
+}
+
+// ConfigReloader rereads the configuration file and applies the settings
+// that can change while the server runs. Settings that need a restart are
+// compared with the configuration the server started with, so a pending
+// change is reported on every reload until the server restarts.
+type ConfigReloader struct {
+	logger  *Logger
+	cors    *CORSPolicy
+	limiter *RateLimiter // nil when rate limiting is off
+	db      DatabaseAdapter
+
+	mu      sync.Mutex
+	started *AppConfig
+	current *AppConfig
+}
+
+// NewConfigReloader creates a ConfigReloader for a server started with
+// cfg. limiter and db may be nil.
+func NewConfigReloader(cfg *AppConfig, logger *Logger, cors *CORSPolicy, limiter *RateLimiter, db DatabaseAdapter) *ConfigReloader {
+	return &ConfigReloader{
+		logger:  logger,
+		cors:    cors,
+		limiter: limiter,
+		db:      db,
+		started: cfg,
+		current: cfg,
+	}
+}
+
+// Apply puts the reloadable settings of cfg into effect.
+func (c *ConfigReloader) Apply(cfg *AppConfig) {
+	c.logger.SetLevel(cfg.Server.LogLevel)
+	c.cors.Set(cfg.CORS)
+	SetRequestLimits(cfg.Limits)
+	if c.limiter != nil {
+		c.limiter.SetJWTRequestLimit(cfg.Limits.JWTRequestsPerMinute)
+	}
+	if s, ok := c.db.(slowQueryThresholdSetter); ok {
+		s.SetSlowQueryThreshold(cfg.Database.SlowQueryThreshold)
+	}
+}
+
+// Reload rereads the configuration file. If it fails to load or validate,
+// nothing changes. Otherwise the reloadable settings are applied and any
+// changed setting that needs a restart is logged and ignored.
+func (c *ConfigReloader) Reload() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	next, err := LoadConfig(c.started.Path)
+	if err != nil {
+		c.logger.Error("configuration reload failed; keeping the current configuration", "error", err.Error())
+		c.logger.AuditEvent(AuditConfigReload, "outcome", "failure")
+		return err
+	}
+
+	_, restart := changedSettings(c.started, next)
+	if len(restart) > 0 {
+		c.logger.Warn("configuration changes need a restart and were not applied", "keys", strings.Join(restart, ", "))
+	}
+	applied, _ := changedSettings(c.current, next)
+	c.Apply(next)
+	c.current = next
+
+	c.logger.Info("configuration reloaded", "applied", strings.Join(applied, ", "))
+	c.logger.AuditEvent(AuditConfigReload, "outcome", "success", "applied", strings.Join(applied, ", "), "ignored", strings.Join(restart, ", "))
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestConfigReloader_Reload(t *testing.T) {
+	t.Cleanup(func() { liveLimits.Store(nil) })
+	logPath := filepath.Join(t.TempDir(), "test.log")
+	base := `jwt_secret: "this-is-a-very-long-secret-that-is-at-least-32-chars!"
+server:
+  logpath: "` + logPath + `"
+`
+	cfg, err := LoadConfig(writeTempConfig(t, base))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+
+	var logs bytes.Buffer
+	logger := NewTestLogger(&logs)
+	cors := NewCORSPolicy(cfg.CORS)
+	rl := NewRateLimiter()
+	adapter := testSQLiteAdapter(t)
+	reloader := NewConfigReloader(cfg, logger, cors, rl, adapter)
+	reloader.Apply(cfg)
+
+	// A file that fails validation changes nothing.
+	if err := os.WriteFile(cfg.Path, []byte(base+"limits:\n  max_per_page: 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := reloader.Reload(); err == nil {
+		t.Fatal("expected an invalid file to be rejected")
+	}
+	if !reflect.DeepEqual(requestLimits(), cfg.Limits) {
+		t.Fatalf("limits changed after a rejected reload: %+v", requestLimits())
+	}
+
+	changed := strings.Replace(base, "server:\n", "server:\n  port: 7000\n  log_level: warn\n", 1) + `database:
+  slow_query_threshold: 50
+cors:
+  allowed_origins: ["https://app.example.com"]
+limits:
+  jwt_requests_per_minute: 2
+  max_batch_operations: 10
+  max_per_page: 40
+  default_per_page: 5
+  max_request_body: 4096
+`
+	if err := os.WriteFile(cfg.Path, []byte(changed), 0644); err != nil {
+		t.Fatal(err)
+	}
+	logs.Reset()
+	if err := reloader.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+
+	want := LimitsConfig{JWTRequestsPerMinute: 2, MaxBatchOperations: 10, MaxPerPage: 40, DefaultPerPage: 5, MaxRequestBody: 4096}
+	if !reflect.DeepEqual(requestLimits(), want) {
+		t.Errorf("got limits %+v; want %+v", requestLimits(), want)
+	}
+	if _, perPage := parsePagination(httptest.NewRequest("GET", "/?per_page=100", nil)); perPage != 40 {
+		t.Errorf("expected per_page capped at 40, got %d", perPage)
+	}
+	if origins := cors.cfg.Load().AllowedOrigins; !slices.Equal(origins, []string{"https://app.example.com"}) {
+		t.Errorf("unexpected CORS origins %v", origins)
+	}
+	if adapter.slowQueryMs() != 50 {
+		t.Errorf("expected slow query threshold 50, got %d", adapter.slowQueryMs())
+	}
+	if !rl.AllowJWT("u1") || !rl.AllowJWT("u1") || rl.AllowJWT("u1") {
+		t.Error("expected the JWT request limit of 2 to apply")
+	}
+
+	// The port change is reported, and the log level is now warn, so the
+	// info-level summary is not written.
+	out := logs.String()
+	if !strings.Contains(out, "need a restart") || !strings.Contains(out, KeyServerPort) {
+		t.Errorf("expected a restart warning naming %s, got %s", KeyServerPort, out)
+	}
+	if strings.Contains(out, `"msg":"configuration reloaded"`) {
+		t.Errorf("expected info entries to be dropped at log level warn, got %s", out)
+	}
+}
+
+func TestChangedSettings(t *testing.T) {
+	a := &AppConfig{CORS: CORSConfig{AllowedOrigins: []string{"*"}}}
+	b := &AppConfig{CORS: CORSConfig{AllowedOrigins: []string{"*"}}}
+	if reloadable, restart := changedSettings(a, b); len(reloadable) != 0 || len(restart) != 0 {
+		t.Fatalf("expected no changes, got %v and %v", reloadable, restart)
+	}
+	b.Database.Connection = DBConnectionPostgres
+	b.Limits.MaxPerPage = 50
+	reloadable, restart := changedSettings(a, b)
+	if !slices.Equal(reloadable, []string{KeyLimitsMaxPerPage}) || !slices.Equal(restart, []string{KeyDatabaseConnection}) {
+		t.Fatalf("got reloadable %v, restart %v", reloadable, restart)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ResourceAttributesHandler implements POST /data/{resource}:attributes,
+// which defines and removes the flex attributes of a collection. Flex
+// attributes are stored as keys of the collection's _attributes JSON
+// column, so adding one needs no DDL.
+type ResourceAttributesHandler struct {
+	db       DatabaseAdapter
+	registry *SchemaRegistry
+}
+
+// NewResourceAttributesHandler creates a ResourceAttributesHandler with the given dependencies.
+func NewResourceAttributesHandler(db DatabaseAdapter, registry *SchemaRegistry) *ResourceAttributesHandler {
+	return &ResourceAttributesHandler{db: db, registry: registry}
+}
+
+// attributeItem is a single flex attribute definition.
+type attributeItem struct {
+	Name string `json:"name"`
+	Type string `json:"type,omitempty"`
+}
+
+// attributeMutateRequest is the JSON body for POST /data/{resource}:attributes.
+type attributeMutateRequest struct {
+	Op   string          `json:"op"`
+	Data []attributeItem `json:"data"`
+}
+
+// HandleMutate handles POST /data/{resource}:attributes. op=create defines
+// attributes; op=destroy removes attributes that no record has a value for.
+func (h *ResourceAttributesHandler) HandleMutate(w http.ResponseWriter, r *http.Request) {
+	identity, ok := GetAuthIdentity(r.Context())
+	if !ok || !identity.ManagesCollections() {
+		WriteError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	resource := extractResource(r.URL.Path)
+	if resource == "" {
+		WriteError(w, http.StatusBadRequest, "Missing resource name")
+		return
+	}
+	col, ok := h.registry.Get(resource)
+	if !ok {
+		WriteError(w, http.StatusNotFound, "Collection not found")
+		return
+	}
+	if !hasAttributes(col) {
+		WriteError(w, http.StatusBadRequest, fmt.Sprintf("Collection '%s' does not have flex attributes", resource))
+		return
+	}
+
+	var req attributeMutateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Op != "create" && req.Op != "destroy" {
+		WriteError(w, http.StatusBadRequest, "Invalid op: must be create or destroy")
+		return
+	}
+	if len(req.Data) == 0 {
+		WriteError(w, http.StatusBadRequest, "Missing required field: data")
+		return
+	}
+
+	ctx := r.Context()
+	var cerr *collectionError
+	if req.Op == "create" {
+		cerr = h.create(ctx, col, req.Data)
+	} else {
+		cerr = h.destroy(ctx, col, req.Data)
+	}
+	if cerr != nil {
+		writeCollectionError(w, cerr)
+		return
+	}
+
+	if err := h.registry.Refresh(); err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	h.registry.AnnounceChange(ctx)
+
+	results := make([]any, len(req.Data))
+	for i, a := range req.Data {
+		results[i] = a
+	}
+	meta := map[string]any{"success": len(req.Data), "failed": 0}
+	if req.Op == "create" {
+		WriteSuccessFull(w, http.StatusCreated, "Attributes created successfully", results, meta, nil)
+		return
+	}
+	WriteSuccessFull(w, http.StatusOK, "Attributes destroyed successfully", results, meta, nil)
+}
+
+// create validates every item before storing any, so a bad item leaves
+// the collection unchanged.
+func (h *ResourceAttributesHandler) create(ctx context.Context, col *Collection, items []attributeItem) *collectionError {
+	if len(col.Attributes)+len(items) > MaxAttributesPerCollection {
+		return &collectionError{Status: http.StatusBadRequest,
+			Message: fmt.Sprintf("A collection can have at most %d attributes", MaxAttributesPerCollection)}
+	}
+	seen := make(map[string]bool, len(items))
+	for _, a := range items {
+		if !namePattern.MatchString(a.Name) || len(a.Name) > MaxFieldNameLen {
+			return &collectionError{Status: http.StatusBadRequest,
+				Message: fmt.Sprintf("Invalid attribute name '%s': must be lowercase snake_case", a.Name)}
+		}
+		if !stringInSlice(a.Type, AttributeTypes) {
+			return &collectionError{Status: http.StatusBadRequest,
+				Message: fmt.Sprintf("Invalid type '%s' for attribute '%s'", a.Type, a.Name)}
+		}
+		if seen[a.Name] || findAttribute(col, a.Name) != nil {
+			return &collectionError{Status: http.StatusConflict,
+				Message: fmt.Sprintf("Attribute '%s' already exists", a.Name)}
+		}
+		seen[a.Name] = true
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, a := range items {
+		if err := h.db.InsertRow(ctx, AttributesTable, map[string]any{
+			"id":         GenerateULID(),
+			"collection": col.Name,
+			"name":       a.Name,
+			"type":       a.Type,
+			"created_at": now,
+		}); err != nil {
+			return &collectionError{Status: http.StatusInternalServerError, Message: "Internal server error"}
+		}
+	}
+	return nil
+}
+
+// destroy refuses to remove an attribute that any record still has a
+// value for, since the value would no longer validate or be filterable.
+func (h *ResourceAttributesHandler) destroy(ctx context.Context, col *Collection, items []attributeItem) *collectionError {
+	for i, a := range items {
+		if findAttribute(col, a.Name) == nil {
+			return &collectionError{Status: http.StatusNotFound,
+				Message: fmt.Sprintf("Attribute '%s' not found", a.Name)}
+		}
+		rows, _, err := h.db.QueryRows(ctx, col.Name, QueryOptions{
+			Filters: []Filter{{Field: FieldAttributes, Path: a.Name, Op: "not_null"}},
+			Page:    1,
+			PerPage: 1,
+		})
+		if err != nil {
+			return &collectionError{Status: http.StatusInternalServerError, Message: "Internal server error"}
+		}
+		if len(rows) > 0 {
+			return &collectionError{Status: http.StatusConflict,
+				Message: fmt.Sprintf("Attribute '%s' is set on existing records", a.Name)}
+		}
+		items[i].Type = findAttribute(col, a.Name).Type
+	}
+
+	for _, a := range items {
+		rows, _, err := h.db.QueryRows(ctx, AttributesTable, QueryOptions{
+			Filters: []Filter{
+				{Field: "collection", Op: "eq", Value: col.Name},
+				{Field: "name", Op: "eq", Value: a.Name},
+			},
+			Page:    1,
+			PerPage: 1,
+		})
+		if err != nil || len(rows) == 0 {
+			return &collectionError{Status: http.StatusInternalServerError, Message: "Internal server error"}
+		}
+		if err := h.db.DeleteRow(ctx, AttributesTable, stringVal(rows[0], "id")); err != nil {
+			return &collectionError{Status: http.StatusInternalServerError, Message: "Internal server error"}
+		}
+	}
+	return nil
+}
+
+// validateAttributes checks the _attributes value of a create or update
+// item: it must be an object, or null, whose keys are attributes defined
+// on col and whose values match their types.
+func validateAttributes(item map[string]any, col *Collection) error {
+	value, ok := item[FieldAttributes]
+	if !ok || value == nil || !hasAttributes(col) {
+		return nil
+	}
+	attrs, ok := value.(map[string]any)
+	if !ok {
+		return fmt.Errorf("Field '%s' must be an object", FieldAttributes)
+	}
+	for name, v := range attrs {
+		a := findAttribute(col, name)
+		if a == nil {
+			return fmt.Errorf("Unknown attribute '%s' for collection '%s'", name, col.Name)
+		}
+		if v != nil && !isTypeValid(v, a.Type) {
+			return fmt.Errorf("Invalid value for attribute '%s' of type '%s'", name, a.Type)
+		}
+	}
+	return nil
+}
+
+// removeCollectionAttributes deletes the attribute definitions of
+// collection. It is called when the collection is destroyed.
+func removeCollectionAttributes(ctx context.Context, db DatabaseAdapter, collection string) error {
+	for {
+		rows, _, err := db.QueryRows(ctx, AttributesTable, QueryOptions{
+			Filters: []Filter{{Field: "collection", Op: "eq", Value: collection}},
+			Page:    1,
+			PerPage: MaxPerPage,
+		})
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if err := db.DeleteRow(ctx, AttributesTable, stringVal(row, "id")); err != nil {
+				return err
+			}
+		}
+		if len(rows) < MaxPerPage {
+			return nil
+		}
+	}
+}
+
+// renameCollectionAttributes moves the attribute definitions of from to
+// the collection to. It is called when a collection is renamed.
+func renameCollectionAttributes(ctx context.Context, db DatabaseAdapter, from, to string) error {
+	for {
+		rows, _, err := db.QueryRows(ctx, AttributesTable, QueryOptions{
+			Filters: []Filter{{Field: "collection", Op: "eq", Value: from}},
+			Page:    1,
+			PerPage: MaxPerPage,
+		})
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if err := db.UpdateRow(ctx, AttributesTable, stringVal(row, "id"), map[string]any{"collection": to}); err != nil {
+				return err
+			}
+		}
+		if len(rows) < MaxPerPage {
+			return nil
+		}
+	}
+}
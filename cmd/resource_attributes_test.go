@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func doAttributesRequest(h *ResourceAttributesHandler, resource, body string, identity *AuthIdentity) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/data/"+resource+":attributes", strings.NewReader(body))
+	req = req.WithContext(SetAuthIdentity(context.Background(), identity))
+	w := httptest.NewRecorder()
+	h.HandleMutate(w, req)
+	return w
+}
+
+func TestFlexAttributes_EndToEnd(t *testing.T) {
+	adapter, registry, cfg, _ := setupCollectionTest(t)
+	ch := NewCollectionHandler(adapter, registry, cfg)
+	admin := adminIdentity()
+
+	create := `{"op":"create","data":[{"name":"products","columns":[{"name":"title","type":"string"}],"attributes":true}]}`
+	if w := doIndexRequest(ch, http.MethodPost, "/collections:mutate", create, admin); w.Code != http.StatusCreated {
+		t.Fatalf("create collection: %d %s", w.Code, w.Body.String())
+	}
+
+	ah := NewResourceAttributesHandler(adapter, registry)
+	define := `{"op":"create","data":[{"name":"color","type":"string"},{"name":"weight","type":"integer"},{"name":"fragile","type":"boolean"}]}`
+	if w := doAttributesRequest(ah, "products", define, admin); w.Code != http.StatusCreated {
+		t.Fatalf("define attributes: %d %s", w.Code, w.Body.String())
+	}
+	if w := doAttributesRequest(ah, "products", `{"op":"create","data":[{"name":"color","type":"string"}]}`, admin); w.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a duplicate attribute, got %d", w.Code)
+	}
+	if w := doAttributesRequest(ah, "products", `{"op":"create","data":[{"name":"size","type":"decimal"}]}`, admin); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unsupported type, got %d", w.Code)
+	}
+	user := &AuthIdentity{CallerID: "u1", Role: "user", CanWrite: true}
+	if w := doAttributesRequest(ah, "products", `{"op":"create","data":[{"name":"size","type":"string"}]}`, user); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a non-admin, got %d", w.Code)
+	}
+
+	mh := NewResourceMutateHandler(adapter, registry, cfg, nil)
+	for _, attrs := range []map[string]any{
+		{"color": "red", "weight": 5, "fragile": true},
+		{"color": "blue", "weight": 12},
+		{"color": "red", "weight": 20, "fragile": false},
+	} {
+		body := map[string]any{"op": "create", "data": []any{map[string]any{"title": "item", FieldAttributes: attrs}}}
+		if w := doMutateRequest(t, mh, "products", body, admin); w.Code != http.StatusCreated {
+			t.Fatalf("create %v: %d %s", attrs, w.Code, w.Body.String())
+		}
+	}
+	for _, attrs := range []map[string]any{{"unknown": "x"}, {"weight": "heavy"}} {
+		body := map[string]any{"op": "create", "data": []any{map[string]any{"title": "item", FieldAttributes: attrs}}}
+		if w := doMutateRequest(t, mh, "products", body, admin); w.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %v, got %d", attrs, w.Code)
+		}
+	}
+
+	qh := NewResourceQueryHandler(adapter, registry, cfg)
+	for _, tt := range []struct {
+		query string
+		want  int
+	}{
+		{"_attributes.color[eq]=red", 2},
+		{"_attributes.weight[gt]=10", 2},
+		{"_attributes.fragile[eq]=true", 1},
+		{"_attributes.fragile[is_null]", 1},
+		{"_attributes.color[in]=red,blue&_attributes.weight[lt]=15", 2},
+	} {
+		w := httptest.NewRecorder()
+		qh.HandleQuery(w, makeQueryRequest("/data/products:query?"+tt.query))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", tt.query, w.Code, w.Body.String())
+		}
+		if data := decodeResponse(t, w)["data"].([]any); len(data) != tt.want {
+			t.Errorf("%s: expected %d records, got %d", tt.query, tt.want, len(data))
+		}
+	}
+	for _, query := range []string{"_attributes.size[eq]=1", "_attributes.weight[eq]=abc", "_attributes.fragile[like]=t"} {
+		w := httptest.NewRecorder()
+		qh.HandleQuery(w, makeQueryRequest("/data/products:query?"+query))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, w.Code)
+		}
+	}
+
+	sh := NewResourceSchemaHandler(registry, "")
+	sw := httptest.NewRecorder()
+	sh.HandleSchema(sw, httptest.NewRequest(http.MethodGet, "/data/products:schema", nil))
+	if attrs := decodeResponse(t, sw)["data"].([]any)[0].(map[string]any)["attributes"].([]any); len(attrs) != 3 {
+		t.Errorf("expected 3 attributes in :schema, got %v", attrs)
+	}
+
+	if w := doAttributesRequest(ah, "products", `{"op":"destroy","data":[{"name":"color"}]}`, admin); w.Code != http.StatusConflict {
+		t.Fatalf("expected 409 destroying an attribute in use, got %d", w.Code)
+	}
+	if w := doAttributesRequest(ah, "products", `{"op":"create","data":[{"name":"size","type":"string"}]}`, admin); w.Code != http.StatusCreated {
+		t.Fatalf("define size: %d %s", w.Code, w.Body.String())
+	}
+	if w := doAttributesRequest(ah, "products", `{"op":"destroy","data":[{"name":"size"}]}`, admin); w.Code != http.StatusOK {
+		t.Fatalf("destroy unused attribute: %d %s", w.Code, w.Body.String())
+	}
+	col, _ := registry.Get("products")
+	if findAttribute(col, "size") != nil {
+		t.Error("expected size to be removed from the registry")
+	}
+
+	drop := `{"op":"destroy","data":[{"name":"products"}]}`
+	if w := doIndexRequest(ch, http.MethodPost, "/collections:mutate", drop, admin); w.Code != http.StatusOK {
+		t.Fatalf("destroy collection: %d %s", w.Code, w.Body.String())
+	}
+	rows, _, err := adapter.QueryRows(context.Background(), AttributesTable, QueryOptions{Page: 1, PerPage: 10})
+	if err != nil || len(rows) != 0 {
+		t.Fatalf("expected attribute definitions to be removed, got %v (%v)", rows, err)
+	}
+}
+
+func TestFlexAttributes_RequiresColumn(t *testing.T) {
+	_, adapter, registry := setupMutateTest(t)
+	ah := NewResourceAttributesHandler(adapter, registry)
+	w := doAttributesRequest(ah, "products", `{"op":"create","data":[{"name":"color","type":"string"}]}`, adminIdentity())
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a collection without _attributes, got %d", w.Code)
+	}
+}
@@ -10,17 +10,21 @@ import (
 	"math"
 	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
 
 // ResourceMutateHandler implements POST /data/{resource}:mutate.
 type ResourceMutateHandler struct {
-	db       DatabaseAdapter
-	registry *SchemaRegistry
-	cfg      *AppConfig
-	jtiStore *JTIRevocationStore
-	prefix   string
+	db         DatabaseAdapter
+	registry   *SchemaRegistry
+	cfg        *AppConfig
+	jtiStore   *JTIRevocationStore
+	prefix     string
+	audit      *AuditLog
+	validators *ValidatorStore
+	mailer     Mailer
 }
 
 // NewResourceMutateHandler creates a ResourceMutateHandler with the given dependencies.
@@ -34,11 +38,69 @@ func NewResourceMutateHandler(db DatabaseAdapter, registry *SchemaRegistry, cfg
 	}
 }
 
+// SetAuditLog records each created, updated, and destroyed record in audit.
+func (h *ResourceMutateHandler) SetAuditLog(audit *AuditLog) {
+	h.audit = audit
+}
+
+// SetValidators runs the validator attached to a collection, if any, on
+// each record created or updated in it.
+func (h *ResourceMutateHandler) SetValidators(validators *ValidatorStore) {
+	h.validators = validators
+}
+
+// SetMailer enables the invite action on users, which emails invitations
+// through mailer.
+func (h *ResourceMutateHandler) SetMailer(mailer Mailer) {
+	h.mailer = mailer
+}
+
+// checkValidator runs the validator of a dynamic collection on the
+// candidate record. On rejection or failure it writes the error response
+// and returns false.
+func (h *ResourceMutateHandler) checkValidator(ctx context.Context, w http.ResponseWriter, op, resource string, col *Collection, record map[string]any) bool {
+	if col.System {
+		return true
+	}
+	messages, err := h.validators.Check(ctx, op, resource, record)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return false
+	}
+	if len(messages) > 0 {
+		WriteErrorCode(w, http.StatusBadRequest, ErrCodeValidationFailed, validatorRejection(messages))
+		return false
+	}
+	return true
+}
+
+// auditMutation records a record change. before is nil for a create and
+// after is nil for a destroy.
+func (h *ResourceMutateHandler) auditMutation(w http.ResponseWriter, r *http.Request, op, resource, id string, before, after map[string]any) {
+	if h.audit == nil {
+		return
+	}
+	var actor string
+	if identity, ok := GetAuthIdentity(r.Context()); ok {
+		actor = identity.CallerID
+	}
+	h.audit.Record(r.Context(), AuditEntry{
+		Event:      AuditDataMutation,
+		Actor:      actor,
+		Action:     op,
+		Collection: resource,
+		RecordID:   id,
+		Changes:    auditDiff(before, after),
+		RequestID:  requestID(w),
+	})
+}
+
 // resourceMutateRequest is the JSON body for POST /data/{resource}:mutate.
 type resourceMutateRequest struct {
 	Op     string            `json:"op"`
 	Data   []json.RawMessage `json:"data"`
 	Action string            `json:"action,omitempty"`
+	Mode   string            `json:"mode,omitempty"` // users only: atomic or best_effort
 }
 
 // HandleMutate handles POST /data/{resource}:mutate requests.
@@ -87,6 +149,38 @@ func (h *ResourceMutateHandler) HandleMutate(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	if r.Header.Get("If-Match") != "" {
+		if req.Op != "update" && req.Op != "destroy" {
+			WriteError(w, http.StatusBadRequest, "If-Match applies only to op=update and op=destroy")
+			return
+		}
+		if len(req.Data) != 1 {
+			WriteError(w, http.StatusBadRequest, "If-Match requires exactly one item")
+			return
+		}
+	}
+
+	if req.Mode != "" {
+		if resource != "users" || (req.Op != "create" && req.Op != "update" && req.Op != "destroy") {
+			WriteError(w, http.StatusBadRequest, "Field 'mode' applies only to op=create, op=update, and op=destroy on users")
+			return
+		}
+		if req.Mode != "atomic" && req.Mode != "best_effort" {
+			WriteError(w, http.StatusBadRequest, "Invalid mode: must be atomic or best_effort")
+			return
+		}
+		if r.Header.Get("If-Match") != "" {
+			WriteError(w, http.StatusBadRequest, "If-Match cannot be combined with mode")
+			return
+		}
+		if len(req.Data) > MaxUserBatchItems {
+			WriteError(w, http.StatusBadRequest, fmt.Sprintf("Data exceeds %d items", MaxUserBatchItems))
+			return
+		}
+		h.handleUsersBatch(w, r, col, req)
+		return
+	}
+
 	switch req.Op {
 	case "create":
 		h.handleCreate(w, r, resource, col, req.Data)
@@ -104,7 +198,7 @@ func (h *ResourceMutateHandler) HandleMutate(w http.ResponseWriter, r *http.Requ
 // authorize checks authorization for mutate operations.
 func (h *ResourceMutateHandler) authorize(resource string, identity *AuthIdentity) error {
 	if resource == "users" || resource == "apikeys" {
-		if identity.Role != "admin" {
+		if !identity.ManagesUsers() {
 			return fmt.Errorf("forbidden")
 		}
 		return nil
@@ -119,8 +213,8 @@ func (h *ResourceMutateHandler) authorize(resource string, identity *AuthIdentit
 // op=create
 // ---------------------------------------------------------------------------
 
-func (h *ResourceMutateHandler) handleCreate(w http.ResponseWriter, _ *http.Request, resource string, col *Collection, rawItems []json.RawMessage) {
-	ctx := context.Background()
+func (h *ResourceMutateHandler) handleCreate(w http.ResponseWriter, r *http.Request, resource string, col *Collection, rawItems []json.RawMessage) {
+	ctx := r.Context()
 	fieldMap := buildFieldMap(col)
 
 	var results []any
@@ -139,17 +233,29 @@ func (h *ResourceMutateHandler) handleCreate(w http.ResponseWriter, _ *http.Requ
 		}
 
 		if err := validateWritableFields(item, col, resource); err != nil {
-			WriteError(w, http.StatusBadRequest, err.Error())
+			WriteErrorFrom(w, http.StatusBadRequest, withExamples(err, col, "create"))
 			return
 		}
 
 		if err := validateFieldsExist(item, fieldMap, resource); err != nil {
-			WriteError(w, http.StatusBadRequest, err.Error())
+			WriteErrorFrom(w, http.StatusBadRequest, withExamples(err, col, "create"))
 			return
 		}
 
 		if err := validateFieldTypes(item, fieldMap); err != nil {
-			WriteError(w, http.StatusBadRequest, err.Error())
+			WriteErrorFrom(w, http.StatusBadRequest, withExamples(err, col, "create"))
+			return
+		}
+		if err := validateAttributes(item, col); err != nil {
+			WriteErrorFrom(w, http.StatusBadRequest, withExamples(err, col, "create"))
+			return
+		}
+
+		if !h.checkValidator(ctx, w, "create", resource, col, item) {
+			return
+		}
+		if role, _ := item["role"].(string); isCredentialResource(resource) && !adminRoleAllowed(r, role) {
+			WriteError(w, http.StatusForbidden, "Only admins can grant the admin role")
 			return
 		}
 
@@ -162,22 +268,24 @@ func (h *ResourceMutateHandler) handleCreate(w http.ResponseWriter, _ *http.Requ
 		case "apikeys":
 			record, insertErr = h.createAPIKey(ctx, item)
 		default:
-			record, insertErr = h.createDynamic(ctx, resource, item, col)
+			record, insertErr = h.createDynamic(ctx, resource, item, col, callerID(r))
 		}
 
 		if insertErr != nil {
 			if ve, ok := insertErr.(*validationError); ok {
-				WriteError(w, http.StatusBadRequest, ve.msg)
+				WriteErrorCode(w, http.StatusBadRequest, ErrCodeValidationFailed, ve.msg)
 				return
 			}
-			if isUniqueViolation(insertErr) {
-				WriteError(w, http.StatusConflict, uniqueViolationMessage(insertErr))
+			if field := notNullField(insertErr); field != "" && errors.Is(insertErr, ErrNotNull) {
+				WriteErrorFrom(w, http.StatusBadRequest, withExamples(
+					fieldError(ErrCodeNotNullViolation, field, notNullViolationMessage(insertErr)), col, "create"))
 				return
 			}
-			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			writeDBError(w, insertErr)
 			return
 		}
 
+		h.auditMutation(w, r, "create", resource, stringVal(record, "id"), nil, record)
 		results = append(results, record)
 	}
 
@@ -190,38 +298,51 @@ func (h *ResourceMutateHandler) handleCreate(w http.ResponseWriter, _ *http.Requ
 }
 
 func (h *ResourceMutateHandler) createUser(ctx context.Context, item map[string]any) (map[string]any, error) {
+	row, record, err := h.buildUser(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.db.InsertRow(ctx, "users", row); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// buildUser validates a users create item and returns the physical row
+// and the record reported for it.
+func (h *ResourceMutateHandler) buildUser(ctx context.Context, item map[string]any) (map[string]any, map[string]any, error) {
 	username, _ := item["username"].(string)
 	email, _ := item["email"].(string)
 	password, _ := item["password"].(string)
 	role, _ := item["role"].(string)
 
 	if username == "" {
-		return nil, &validationError{msg: "Field 'username' is required"}
+		return nil, nil, &validationError{msg: "Field 'username' is required"}
 	}
 	if email == "" {
-		return nil, &validationError{msg: "Field 'email' is required"}
+		return nil, nil, &validationError{msg: "Field 'email' is required"}
 	}
 	if password == "" {
-		return nil, &validationError{msg: "Field 'password' is required"}
+		return nil, nil, &validationError{msg: "Field 'password' is required"}
 	}
 	if role == "" {
-		return nil, &validationError{msg: "Field 'role' is required"}
+		return nil, nil, &validationError{msg: "Field 'role' is required"}
 	}
-	if role != "admin" && role != "user" {
-		return nil, &validationError{msg: "Field 'role' must be 'admin' or 'user'"}
+	if err := checkRoleName(ctx, h.db, role); err != nil {
+		return nil, nil, err
 	}
 
-	if err := validatePasswordPolicy(password); err != nil {
-		return nil, &validationError{msg: fmt.Sprintf("Password policy violation: %s", err.Error())}
+	if err := h.cfg.Passwords().Validate(password); err != nil {
+		return nil, nil, &validationError{msg: passwordPolicyViolation(err)}
 	}
 
 	if !isValidEmail(email) {
-		return nil, &validationError{msg: "Invalid email address"}
+		return nil, nil, &validationError{msg: "Invalid email address"}
 	}
 
 	hash, err := HashPassword(password)
 	if err != nil {
-		return nil, fmt.Errorf("hash password: %w", err)
+		return nil, nil, fmt.Errorf("hash password: %w", err)
 	}
 
 	canWrite := false
@@ -229,32 +350,32 @@ func (h *ResourceMutateHandler) createUser(ctx context.Context, item map[string]
 		canWrite = toBool(v)
 	}
 
+	row := newUserRow(username, email, role, canWrite, hash)
+	return row, map[string]any{
+		"id":         row["id"],
+		"username":   row["username"],
+		"email":      row["email"],
+		"role":       role,
+		"can_write":  canWrite,
+		"created_at": row["created_at"],
+		"updated_at": row["updated_at"],
+	}, nil
+}
+
+// newUserRow builds the physical users row for a validated account. The
+// username and email are normalized to lowercase.
+func newUserRow(username, email, role string, canWrite bool, passwordHash string) map[string]any {
 	now := time.Now().UTC().Format(time.RFC3339)
-	id := GenerateULID()
-	row := map[string]any{
-		"id":            id,
+	return map[string]any{
+		"id":            GenerateULID(),
 		"username":      strings.ToLower(username),
 		"email":         strings.ToLower(email),
-		"password_hash": hash,
+		"password_hash": passwordHash,
 		"role":          role,
 		"can_write":     boolToInt(canWrite),
 		"created_at":    now,
 		"updated_at":    now,
 	}
-
-	if err := h.db.InsertRow(ctx, "users", row); err != nil {
-		return nil, err
-	}
-
-	return map[string]any{
-		"id":         id,
-		"username":   row["username"],
-		"email":      row["email"],
-		"role":       role,
-		"can_write":  canWrite,
-		"created_at": now,
-		"updated_at": now,
-	}, nil
 }
 
 func (h *ResourceMutateHandler) createAPIKey(ctx context.Context, item map[string]any) (map[string]any, error) {
@@ -267,8 +388,8 @@ func (h *ResourceMutateHandler) createAPIKey(ctx context.Context, item map[strin
 	if role == "" {
 		return nil, &validationError{msg: "Field 'role' is required"}
 	}
-	if role != "admin" && role != "user" {
-		return nil, &validationError{msg: "Field 'role' must be 'admin' or 'user'"}
+	if err := checkRoleName(ctx, h.db, role); err != nil {
+		return nil, err
 	}
 
 	isWebsiteRaw, ok := item["is_website"]
@@ -290,6 +411,11 @@ func (h *ResourceMutateHandler) createAPIKey(ctx context.Context, item map[strin
 		return nil, &validationError{msg: err.Error()}
 	}
 
+	scopes, err := validateScopes(item["scopes"])
+	if err != nil {
+		return nil, &validationError{msg: err.Error()}
+	}
+
 	allowedOrigins, err := validateAllowedOrigins(item["allowed_origins"])
 	if err != nil {
 		return nil, &validationError{msg: err.Error()}
@@ -308,11 +434,21 @@ func (h *ResourceMutateHandler) createAPIKey(ctx context.Context, item map[strin
 		captchaRequired = toBool(value)
 	}
 
+	noisyAggregates := false
+	if value, ok := item["noisy_aggregates"]; ok {
+		noisyAggregates = toBool(value)
+	}
+
 	enabled := true
 	if value, ok := item["enabled"]; ok {
 		enabled = toBool(value)
 	}
 
+	expiresAt, err := validateAPIKeyExpiry(item["expires_at"])
+	if err != nil {
+		return nil, &validationError{msg: err.Error()}
+	}
+
 	rawKey, keyHash := GenerateAPIKey()
 	now := time.Now().UTC().Format(time.RFC3339)
 	id := GenerateULID()
@@ -322,11 +458,14 @@ func (h *ResourceMutateHandler) createAPIKey(ctx context.Context, item map[strin
 		"role":             role,
 		"can_write":        boolToInt(canWrite),
 		"collections":      prepareValueForDB(collections, MoonFieldTypeJSON),
+		"scopes":           prepareValueForDB(scopes, MoonFieldTypeJSON),
 		"is_website":       boolToInt(isWebsite),
 		"allowed_origins":  prepareValueForDB(allowedOrigins, MoonFieldTypeJSON),
 		"rate_limit":       int64(rateLimit),
 		"captcha_required": boolToInt(captchaRequired),
+		"noisy_aggregates": boolToInt(noisyAggregates),
 		"enabled":          boolToInt(enabled),
+		"expires_at":       expiresAt,
 		"key_hash":         keyHash,
 		"created_at":       now,
 		"updated_at":       now,
@@ -342,32 +481,23 @@ func (h *ResourceMutateHandler) createAPIKey(ctx context.Context, item map[strin
 		"role":             role,
 		"can_write":        canWrite,
 		"collections":      collections,
+		"scopes":           scopes,
 		"is_website":       isWebsite,
 		"allowed_origins":  allowedOrigins,
 		"rate_limit":       int64(rateLimit),
 		"captcha_required": captchaRequired,
+		"noisy_aggregates": noisyAggregates,
 		"enabled":          enabled,
+		"expires_at":       expiresAt,
 		"key":              rawKey,
 		"created_at":       now,
 		"updated_at":       now,
 	}, nil
 }
 
-func (h *ResourceMutateHandler) createDynamic(ctx context.Context, resource string, item map[string]any, col *Collection) (map[string]any, error) {
-	now := time.Now().UTC().Format(time.RFC3339)
-	id := GenerateULID()
-	row := map[string]any{"id": id}
-	for k, v := range item {
-		row[k] = prepareValueForDB(v, buildFieldMap(col)[k].Type)
-	}
-
-	fieldMap := buildFieldMap(col)
-	if _, hasCreated := fieldMap["created_at"]; hasCreated {
-		row["created_at"] = now
-	}
-	if _, hasUpdated := fieldMap["updated_at"]; hasUpdated {
-		row["updated_at"] = now
-	}
+func (h *ResourceMutateHandler) createDynamic(ctx context.Context, resource string, item map[string]any, col *Collection, owner string) (map[string]any, error) {
+	row := newDynamicRow(item, col, owner)
+	id := row["id"].(string)
 
 	if err := h.db.InsertRow(ctx, resource, row); err != nil {
 		return nil, err
@@ -387,12 +517,43 @@ func (h *ResourceMutateHandler) createDynamic(ctx context.Context, resource stri
 	return record, nil
 }
 
+// newDynamicRow builds the physical row for a validated create item: a new
+// ULID id, values converted for storage, and the server-owned columns.
+// owner is the creating caller's ID, stored when the collection is owned.
+func newDynamicRow(item map[string]any, col *Collection, owner string) map[string]any {
+	fieldMap := buildFieldMap(col)
+	row := map[string]any{"id": GenerateULID()}
+	for k, v := range item {
+		row[k] = prepareValueForDB(v, fieldMap[k].Type)
+	}
+	setTimestampFields(row, fieldMap, true)
+	if f, ok := fieldMap[FieldVersion]; ok && isVersionField(f) {
+		row[FieldVersion] = int64(1)
+	}
+	if f, ok := fieldMap[FieldOwnerID]; ok && isOwnerField(f) && owner != "" {
+		row[FieldOwnerID] = owner
+	}
+	return row
+}
+
+// setTimestampFields sets the collection's system timestamp columns on a
+// physical row. created_at is only set when the row is being created.
+func setTimestampFields(row map[string]any, fieldMap map[string]Field, create bool) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	if f, ok := fieldMap[FieldCreatedAt]; ok && create && isTimestampField(f) {
+		row[FieldCreatedAt] = now
+	}
+	if f, ok := fieldMap[FieldUpdatedAt]; ok && isTimestampField(f) {
+		row[FieldUpdatedAt] = now
+	}
+}
+
 // ---------------------------------------------------------------------------
 // op=update
 // ---------------------------------------------------------------------------
 
-func (h *ResourceMutateHandler) handleUpdate(w http.ResponseWriter, _ *http.Request, resource string, col *Collection, rawItems []json.RawMessage) {
-	ctx := context.Background()
+func (h *ResourceMutateHandler) handleUpdate(w http.ResponseWriter, r *http.Request, resource string, col *Collection, rawItems []json.RawMessage) {
+	ctx := r.Context()
 	fieldMap := buildFieldMap(col)
 
 	var results []any
@@ -424,31 +585,52 @@ func (h *ResourceMutateHandler) handleUpdate(w http.ResponseWriter, _ *http.Requ
 			updateData[k] = v
 		}
 
+		expected, err := takeExpectedVersion(updateData, fieldMap)
+		if err != nil {
+			WriteErrorFrom(w, http.StatusBadRequest, err)
+			return
+		}
+
 		if err := validateWritableFields(updateData, col, resource); err != nil {
-			WriteError(w, http.StatusBadRequest, err.Error())
+			WriteErrorFrom(w, http.StatusBadRequest, withExamples(err, col, "update"))
 			return
 		}
 
 		if err := validateFieldsExist(updateData, fieldMap, resource); err != nil {
-			WriteError(w, http.StatusBadRequest, err.Error())
+			WriteErrorFrom(w, http.StatusBadRequest, withExamples(err, col, "update"))
 			return
 		}
 
 		if err := validateFieldTypes(updateData, fieldMap); err != nil {
-			WriteError(w, http.StatusBadRequest, err.Error())
+			WriteErrorFrom(w, http.StatusBadRequest, withExamples(err, col, "update"))
+			return
+		}
+		if err := validateAttributes(updateData, col); err != nil {
+			WriteErrorFrom(w, http.StatusBadRequest, withExamples(err, col, "update"))
 			return
 		}
 
 		if resource == "apikeys" {
 			if err := validateAPIKeyMutationFields(updateData); err != nil {
-				WriteError(w, http.StatusBadRequest, err.Error())
+				WriteErrorFrom(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+		if role, ok := updateData["role"].(string); ok && isCredentialResource(resource) {
+			if err := checkRoleName(ctx, h.db, role); err != nil {
+				writeValidationOrDBError(w, err)
+				return
+			}
+			if !adminRoleAllowed(r, role) {
+				WriteError(w, http.StatusForbidden, "Only admins can grant the admin role")
 				return
 			}
 		}
 
-		// Check record exists
+		// Check record exists and, in an owned collection, belongs to the
+		// caller. owner_id is read-only, so the check cannot go stale.
 		existing, _, err := h.db.QueryRows(ctx, resource, QueryOptions{
-			Filters: []Filter{{Field: "id", Op: "eq", Value: id}},
+			Filters: append([]Filter{{Field: "id", Op: "eq", Value: id}}, ownerFilters(r, col)...),
 			Page:    1,
 			PerPage: 1,
 		})
@@ -456,11 +638,27 @@ func (h *ResourceMutateHandler) handleUpdate(w http.ResponseWriter, _ *http.Requ
 			WriteError(w, http.StatusInternalServerError, "Internal server error")
 			return
 		}
+		if !checkIfMatch(w, r, resource, col, id, existing) {
+			return
+		}
 		if len(existing) == 0 {
 			failed++
 			continue
 		}
 
+		if isCredentialResource(resource) && !adminRoleAllowed(r, stringVal(existing[0], "role")) {
+			WriteError(w, http.StatusForbidden, "Only admins can change admin accounts")
+			return
+		}
+
+		candidate := formatRecord(existing[0], col)
+		for k, v := range updateData {
+			candidate[k] = v
+		}
+		if !h.checkValidator(ctx, w, "update", resource, col, candidate) {
+			return
+		}
+
 		dbData := make(map[string]any)
 		for k, v := range updateData {
 			f, fOK := fieldMap[k]
@@ -471,12 +669,47 @@ func (h *ResourceMutateHandler) handleUpdate(w http.ResponseWriter, _ *http.Requ
 			}
 		}
 
-		if _, hasUpdated := fieldMap["updated_at"]; hasUpdated {
-			dbData["updated_at"] = time.Now().UTC().Format(time.RFC3339)
-		}
+		setTimestampFields(dbData, fieldMap, false)
 
-		if err := h.db.UpdateRow(ctx, resource, id, dbData); err != nil {
-			if isUniqueViolation(err) {
+		if f, ok := fieldMap[FieldVersion]; ok && isVersionField(f) {
+			current, _ := toInt64(existing[0][FieldVersion])
+			if expected == 0 && r.Header.Get("If-Match") != "" {
+				// Make the If-Match check atomic with the write.
+				expected = current
+			}
+			if expected != 0 && current != expected {
+				WriteVersionConflict(w, id, filterHiddenFields(resource, formatRecord(existing[0], col)))
+				return
+			}
+			updated, err := h.db.UpdateRowVersion(ctx, resource, id, expected, dbData)
+			if err != nil {
+				if isConstraintViolation(err) {
+					failed++
+					continue
+				}
+				WriteError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			if !updated {
+				// The record changed or was deleted after it was read.
+				rows, _, err := h.db.QueryRows(ctx, resource, QueryOptions{
+					Filters: []Filter{{Field: "id", Op: "eq", Value: id}},
+					Page:    1,
+					PerPage: 1,
+				})
+				if err != nil {
+					WriteError(w, http.StatusInternalServerError, "Internal server error")
+					return
+				}
+				if len(rows) == 0 {
+					failed++
+					continue
+				}
+				WriteVersionConflict(w, id, filterHiddenFields(resource, formatRecord(rows[0], col)))
+				return
+			}
+		} else if err := h.db.UpdateRow(ctx, resource, id, dbData); err != nil {
+			if isConstraintViolation(err) {
 				failed++
 				continue
 			}
@@ -496,6 +729,7 @@ func (h *ResourceMutateHandler) handleUpdate(w http.ResponseWriter, _ *http.Requ
 
 		record := formatRecord(rows[0], col)
 		record = filterHiddenFields(resource, record)
+		h.auditMutation(w, r, "update", resource, id, filterHiddenFields(resource, formatRecord(existing[0], col)), record)
 		results = append(results, record)
 	}
 
@@ -503,143 +737,642 @@ func (h *ResourceMutateHandler) handleUpdate(w http.ResponseWriter, _ *http.Requ
 	WriteSuccessFull(w, http.StatusOK, "Resource updated successfully", results, meta, nil)
 }
 
+// takeExpectedVersion removes the client's expected _version from an update
+// item and returns it, or 0 when the item has none. On collections without
+// a version column the key is left in place, so it is reported as unknown.
+func takeExpectedVersion(item map[string]any, fieldMap map[string]Field) (int64, error) {
+	if f, ok := fieldMap[FieldVersion]; !ok || !isVersionField(f) {
+		return 0, nil
+	}
+	raw, ok := item[FieldVersion]
+	if !ok {
+		return 0, nil
+	}
+	delete(item, FieldVersion)
+	n, ok := toInt64(raw)
+	if !ok || n < 1 {
+		return 0, fmt.Errorf("Field '%s' must be a positive integer", FieldVersion)
+	}
+	return n, nil
+}
+
+// checkIfMatch applies the request's If-Match header to the record read
+// for id, which is empty if the record does not exist. If the header is
+// set and the record does not match, it writes 412 Precondition Failed
+// with the current ETag and returns false. The header matches the ETag a
+// get-one read returns, "*" for any existing record, or the record's
+// updated_at as an RFC 3339 timestamp.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, resource string, col *Collection, id string, existing []map[string]any) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+	if len(existing) > 0 {
+		record := filterHiddenFields(resource, formatRecord(existing[0], col))
+		etag := valueETag(record)
+		if etagListed(header, etag) || updatedAtMatches(header, record) {
+			return true
+		}
+		w.Header().Set("ETag", etag)
+	}
+	WriteError(w, http.StatusPreconditionFailed, fmt.Sprintf("Precondition failed for record '%s'", id))
+	return false
+}
+
+// updatedAtMatches reports whether header is an RFC 3339 timestamp equal
+// to the record's updated_at.
+func updatedAtMatches(header string, record map[string]any) bool {
+	want, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(header))
+	if err != nil {
+		return false
+	}
+	raw, _ := record[FieldUpdatedAt].(string)
+	got, err := time.Parse(time.RFC3339Nano, raw)
+	return err == nil && got.Equal(want)
+}
+
 // ---------------------------------------------------------------------------
 // op=destroy
 // ---------------------------------------------------------------------------
 
-func (h *ResourceMutateHandler) handleDestroy(w http.ResponseWriter, _ *http.Request, resource string, col *Collection, rawItems []json.RawMessage) {
-	ctx := context.Background()
+func (h *ResourceMutateHandler) handleDestroy(w http.ResponseWriter, r *http.Request, resource string, col *Collection, rawItems []json.RawMessage) {
+	ctx := r.Context()
+
+	failed := 0
+	success := 0
+
+	for _, raw := range rawItems {
+		var item map[string]any
+		if err := json.Unmarshal(raw, &item); err != nil {
+			WriteError(w, http.StatusBadRequest, "Invalid destroy item")
+			return
+		}
+
+		idRaw, hasID := item["id"]
+		if !hasID {
+			WriteError(w, http.StatusBadRequest, "Each destroy item must include 'id'")
+			return
+		}
+		id, ok := idRaw.(string)
+		if !ok || id == "" {
+			WriteError(w, http.StatusBadRequest, "Field 'id' must be a non-empty string")
+			return
+		}
+
+		// Check record exists and, in an owned collection, belongs to the
+		// caller. owner_id is read-only, so the check cannot go stale.
+		existing, _, err := h.db.QueryRows(ctx, resource, QueryOptions{
+			Filters: append([]Filter{{Field: "id", Op: "eq", Value: id}}, ownerFilters(r, col)...),
+			Page:    1,
+			PerPage: 1,
+		})
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		if !checkIfMatch(w, r, resource, col, id, existing) {
+			return
+		}
+		if len(existing) == 0 {
+			failed++
+			continue
+		}
+
+		if isCredentialResource(resource) && !adminRoleAllowed(r, stringVal(existing[0], "role")) {
+			WriteError(w, http.StatusForbidden, "Only admins can change admin accounts")
+			return
+		}
+
+		// Last admin protection
+		if resource == "users" {
+			userRole, _ := existing[0]["role"].(string)
+			if userRole == "admin" {
+				adminCount, err := h.countAdmins(ctx)
+				if err != nil {
+					WriteError(w, http.StatusInternalServerError, "Internal server error")
+					return
+				}
+				if adminCount <= 1 {
+					failed++
+					continue
+				}
+			}
+		}
+
+		if resource == "users" {
+			if err := h.cascadeDeleteUser(ctx, id); err != nil {
+				WriteError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+		}
+
+		if err := h.db.DeleteRow(ctx, resource, id); err != nil {
+			failed++
+			continue
+		}
+
+		h.auditMutation(w, r, "destroy", resource, id, filterHiddenFields(resource, formatRecord(existing[0], col)), nil)
+		success++
+	}
+
+	data := make([]any, 0)
+	meta := map[string]any{"success": success, "failed": failed}
+	WriteSuccessFull(w, http.StatusOK, "Resource destroyed successfully", data, meta, nil)
+}
+
+func (h *ResourceMutateHandler) countAdmins(ctx context.Context) (int, error) {
+	rows, _, err := h.db.QueryRows(ctx, "users", QueryOptions{
+		Filters: []Filter{{Field: "role", Op: "eq", Value: "admin"}},
+		Page:    1,
+		PerPage: MaxPerPage,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(rows), nil
+}
+
+// isCredentialResource reports whether resource is users or apikeys.
+func isCredentialResource(resource string) bool {
+	return resource == "users" || resource == "apikeys"
+}
+
+// adminRoleAllowed reports whether the caller may give a user or API key
+// role, or change one that has it. Only admins can grant the admin role or
+// change admin accounts, so a custom role with the users permission cannot
+// escalate itself.
+func adminRoleAllowed(r *http.Request, role string) bool {
+	if role != "admin" {
+		return true
+	}
+	identity, ok := GetAuthIdentity(r.Context())
+	return ok && identity.Role == "admin"
+}
+
+// writeValidationOrDBError writes 400 for a validationError and 500
+// otherwise.
+func writeValidationOrDBError(w http.ResponseWriter, err error) {
+	if ve, ok := err.(*validationError); ok {
+		WriteErrorCode(w, http.StatusBadRequest, ErrCodeValidationFailed, ve.msg)
+		return
+	}
+	WriteError(w, http.StatusInternalServerError, "Internal server error")
+}
+
+// cascadeDeleteUser removes the rows that belong to user id: refresh
+// tokens, two-factor enrollment, linked external identities, password
+// history, lockout state, password resets, invitations, and personal API
+// keys.
+func (h *ResourceMutateHandler) cascadeDeleteUser(ctx context.Context, id string) error {
+	if err := h.cascadeDeleteRefreshTokens(ctx, id); err != nil {
+		return err
+	}
+	if err := h.db.DeleteRow(ctx, "moon_auth_totp", id); err != nil {
+		return err
+	}
+	if err := h.cascadeDeleteIdentities(ctx, id); err != nil {
+		return err
+	}
+	if err := h.cascadeDeletePasswordHistory(ctx, id); err != nil {
+		return err
+	}
+	if err := ClearLockout(ctx, h.db, id); err != nil {
+		return err
+	}
+	if err := h.cascadeDeletePasswordResets(ctx, id); err != nil {
+		return err
+	}
+	if err := deleteInvitations(ctx, h.db, id); err != nil {
+		return err
+	}
+	return h.cascadeDeletePersonalKeys(ctx, id)
+}
+
+func (h *ResourceMutateHandler) cascadeDeleteRefreshTokens(ctx context.Context, userID string) error {
+	rows, _, err := h.db.QueryRows(ctx, "moon_auth_refresh_tokens", QueryOptions{
+		Filters: []Filter{{Field: "user_id", Op: "eq", Value: userID}},
+		Page:    1,
+		PerPage: MaxPerPage,
+	})
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		tokenID, _ := row["id"].(string)
+		if tokenID == "" {
+			continue
+		}
+		if err := h.db.DeleteRow(ctx, "moon_auth_refresh_tokens", tokenID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cascadeDeleteIdentities removes the external identities linked to a user.
+func (h *ResourceMutateHandler) cascadeDeleteIdentities(ctx context.Context, userID string) error {
+	rows, _, err := h.db.QueryRows(ctx, "moon_auth_identities", QueryOptions{
+		Filters: []Filter{{Field: "user_id", Op: "eq", Value: userID}},
+		Page:    1,
+		PerPage: MaxPerPage,
+	})
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := h.db.DeleteRow(ctx, "moon_auth_identities", stringVal(row, "id")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cascadeDeletePasswordHistory removes the previous password hashes of a
+// user.
+func (h *ResourceMutateHandler) cascadeDeletePasswordHistory(ctx context.Context, userID string) error {
+	rows, err := passwordHistory(ctx, h.db, userID)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := h.db.DeleteRow(ctx, "moon_auth_password_history", stringVal(row, "id")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cascadeDeletePasswordResets removes the password reset tokens of a user.
+func (h *ResourceMutateHandler) cascadeDeletePasswordResets(ctx context.Context, userID string) error {
+	rows, _, err := h.db.QueryRows(ctx, "moon_auth_password_resets", QueryOptions{
+		Filters: []Filter{{Field: "user_id", Op: "eq", Value: userID}},
+		Page:    1,
+		PerPage: MaxPerPage,
+	})
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := h.db.DeleteRow(ctx, "moon_auth_password_resets", stringVal(row, "id")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *ResourceMutateHandler) cascadeDeletePersonalKeys(ctx context.Context, userID string) error {
+	rows, _, err := h.db.QueryRows(ctx, "apikeys", QueryOptions{
+		Filters: []Filter{{Field: "user_id", Op: "eq", Value: userID}},
+		Page:    1,
+		PerPage: MaxPerPage,
+	})
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := h.db.DeleteRow(ctx, "apikeys", stringVal(row, "id")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+// op=action
+// ---------------------------------------------------------------------------
+
+func (h *ResourceMutateHandler) handleAction(w http.ResponseWriter, r *http.Request, resource string, col *Collection, req resourceMutateRequest) {
+	if req.Action == "" {
+		WriteError(w, http.StatusBadRequest, "Missing required field: action")
+		return
+	}
+	if isCredentialResource(resource) && req.Action != "invite" && !adminRoleAllowed(r, "admin") {
+		targetsAdmin, err := h.targetsAdmin(r.Context(), resource, req.Data)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		if targetsAdmin {
+			WriteError(w, http.StatusForbidden, "Only admins can change admin accounts")
+			return
+		}
+	}
+
+	switch {
+	case resource == "users" && req.Action == "reset_password":
+		h.actionResetPassword(w, r, req.Data)
+	case resource == "users" && req.Action == "revoke_sessions":
+		h.actionRevokeSessions(w, r, req.Data)
+	case resource == "users" && req.Action == "disable_2fa":
+		h.actionDisableTwoFactor(w, r, req.Data)
+	case resource == "users" && req.Action == "unlock":
+		h.actionUnlock(w, r, req.Data)
+	case resource == "users" && req.Action == "invite":
+		h.actionInvite(w, r, req.Data)
+	case resource == "apikeys" && req.Action == "rotate":
+		h.actionRotateAPIKey(w, r, req.Data)
+	case (resource == "users" || resource == "apikeys") && (req.Action == "disable" || req.Action == "enable"):
+		h.actionSetEnabled(w, r, resource, req.Action == "enable", req.Data)
+	default:
+		WriteError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported action '%s' for resource '%s'", req.Action, resource))
+	}
+}
+
+// targetsAdmin reports whether any action item names a users or apikeys
+// record with the admin role. Items without an id are left to the action
+// to reject.
+func (h *ResourceMutateHandler) targetsAdmin(ctx context.Context, resource string, rawItems []json.RawMessage) (bool, error) {
+	for _, raw := range rawItems {
+		var item struct {
+			ID string `json:"id"`
+		}
+		if json.Unmarshal(raw, &item) != nil || item.ID == "" {
+			continue
+		}
+		rows, _, err := h.db.QueryRows(ctx, resource, QueryOptions{
+			Filters: []Filter{{Field: "id", Op: "eq", Value: item.ID}},
+			Page:    1,
+			PerPage: 1,
+		})
+		if err != nil {
+			return false, err
+		}
+		if len(rows) > 0 && stringVal(rows[0], "role") == "admin" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (h *ResourceMutateHandler) actionResetPassword(w http.ResponseWriter, r *http.Request, rawItems []json.RawMessage) {
+	ctx := r.Context()
+	var results []any
+	failed := 0
+
+	for _, raw := range rawItems {
+		var item map[string]any
+		if err := json.Unmarshal(raw, &item); err != nil {
+			WriteError(w, http.StatusBadRequest, "Invalid action item")
+			return
+		}
+
+		idRaw, hasID := item["id"]
+		if !hasID {
+			WriteError(w, http.StatusBadRequest, "Each item must include 'id'")
+			return
+		}
+		id, ok := idRaw.(string)
+		if !ok || id == "" {
+			WriteError(w, http.StatusBadRequest, "Field 'id' must be a non-empty string")
+			return
+		}
+
+		passwordRaw, hasPwd := item["password"]
+		if !hasPwd {
+			WriteError(w, http.StatusBadRequest, "Field 'password' is required for reset_password")
+			return
+		}
+		password, ok := passwordRaw.(string)
+		if !ok || password == "" {
+			WriteError(w, http.StatusBadRequest, "Field 'password' must be a non-empty string")
+			return
+		}
+
+		policy := h.cfg.Passwords()
+		if err := policy.Validate(password); err != nil {
+			WriteError(w, http.StatusBadRequest, passwordPolicyViolation(err))
+			return
+		}
+
+		// Check user exists
+		existing, _, err := h.db.QueryRows(ctx, "users", QueryOptions{
+			Filters: []Filter{{Field: "id", Op: "eq", Value: id}},
+			Page:    1,
+			PerPage: 1,
+		})
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		if len(existing) == 0 {
+			failed++
+			continue
+		}
+		if err := policy.CheckHistory(ctx, h.db, existing[0], password); errors.Is(err, errPasswordReused) {
+			WriteError(w, http.StatusBadRequest, passwordPolicyViolation(err))
+			return
+		} else if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		hash, err := HashPassword(password)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		now := time.Now().UTC().Format(time.RFC3339)
+		if err := h.db.UpdateRow(ctx, "users", id, map[string]any{
+			"password_hash": hash,
+			"updated_at":    now,
+		}); err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		if err := policy.RecordHistory(ctx, h.db, id, stringVal(existing[0], "password_hash")); err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		if err := ClearLockout(ctx, h.db, id); err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		// Invalidate all refresh tokens
+		if err := h.revokeAllRefreshTokens(ctx, id, "password_reset"); err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		results = append(results, map[string]any{"id": id})
+	}
+
+	meta := map[string]any{"success": len(results), "failed": failed}
+	WriteSuccessFull(w, http.StatusOK, "Action completed successfully", results, meta, nil)
+}
+
+func (h *ResourceMutateHandler) actionRevokeSessions(w http.ResponseWriter, r *http.Request, rawItems []json.RawMessage) {
+	ctx := r.Context()
+	var results []any
+	failed := 0
+
+	for _, raw := range rawItems {
+		var item map[string]any
+		if err := json.Unmarshal(raw, &item); err != nil {
+			WriteError(w, http.StatusBadRequest, "Invalid action item")
+			return
+		}
+
+		idRaw, hasID := item["id"]
+		if !hasID {
+			WriteError(w, http.StatusBadRequest, "Each item must include 'id'")
+			return
+		}
+		id, ok := idRaw.(string)
+		if !ok || id == "" {
+			WriteError(w, http.StatusBadRequest, "Field 'id' must be a non-empty string")
+			return
+		}
+
+		// Check user exists
+		existing, _, err := h.db.QueryRows(ctx, "users", QueryOptions{
+			Filters: []Filter{{Field: "id", Op: "eq", Value: id}},
+			Page:    1,
+			PerPage: 1,
+		})
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		if len(existing) == 0 {
+			failed++
+			continue
+		}
+
+		if err := h.revokeAllRefreshTokens(ctx, id, "admin_revoked"); err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		results = append(results, map[string]any{"id": id})
+	}
+
+	meta := map[string]any{"success": len(results), "failed": failed}
+	WriteSuccessFull(w, http.StatusOK, "Action completed successfully", results, meta, nil)
+}
+
+// actionDisableTwoFactor removes the two-factor enrollment of each user,
+// for a user who has lost both their authenticator and recovery codes. A
+// user without two-factor authentication counts as failed.
+func (h *ResourceMutateHandler) actionDisableTwoFactor(w http.ResponseWriter, r *http.Request, rawItems []json.RawMessage) {
+	ctx := r.Context()
+	var results []any
+	failed := 0
+
+	for _, raw := range rawItems {
+		var item map[string]any
+		if err := json.Unmarshal(raw, &item); err != nil {
+			WriteError(w, http.StatusBadRequest, "Invalid action item")
+			return
+		}
+		id, ok := item["id"].(string)
+		if !ok || id == "" {
+			WriteError(w, http.StatusBadRequest, "Each item must include 'id'")
+			return
+		}
+
+		row, err := loadTOTP(ctx, h.db, id)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		if row == nil {
+			failed++
+			continue
+		}
+		if err := h.db.DeleteRow(ctx, "moon_auth_totp", id); err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		if h.audit != nil {
+			var actor string
+			if identity, ok := GetAuthIdentity(r.Context()); ok {
+				actor = identity.CallerID
+			}
+			h.audit.Record(r.Context(), AuditEntry{
+				Event:      AuditPrivilegedMutation,
+				Actor:      actor,
+				Action:     "disable_2fa",
+				Collection: "users",
+				RecordID:   id,
+				RequestID:  requestID(w),
+			})
+		}
+		results = append(results, map[string]any{"id": id})
+	}
+
+	meta := map[string]any{"success": len(results), "failed": failed}
+	WriteSuccessFull(w, http.StatusOK, "Action completed successfully", results, meta, nil)
+}
 
+// actionUnlock ends the lockout of each user and forgets their failed
+// logins. A user who is not locked counts as failed.
+func (h *ResourceMutateHandler) actionUnlock(w http.ResponseWriter, r *http.Request, rawItems []json.RawMessage) {
+	ctx := r.Context()
+	var results []any
 	failed := 0
-	success := 0
 
 	for _, raw := range rawItems {
 		var item map[string]any
 		if err := json.Unmarshal(raw, &item); err != nil {
-			WriteError(w, http.StatusBadRequest, "Invalid destroy item")
-			return
-		}
-
-		idRaw, hasID := item["id"]
-		if !hasID {
-			WriteError(w, http.StatusBadRequest, "Each destroy item must include 'id'")
+			WriteError(w, http.StatusBadRequest, "Invalid action item")
 			return
 		}
-		id, ok := idRaw.(string)
+		id, ok := item["id"].(string)
 		if !ok || id == "" {
-			WriteError(w, http.StatusBadRequest, "Field 'id' must be a non-empty string")
+			WriteError(w, http.StatusBadRequest, "Each item must include 'id'")
 			return
 		}
 
-		// Check record exists
-		existing, _, err := h.db.QueryRows(ctx, resource, QueryOptions{
-			Filters: []Filter{{Field: "id", Op: "eq", Value: id}},
-			Page:    1,
-			PerPage: 1,
-		})
+		until, err := h.cfg.Passwords().LockedUntil(ctx, h.db, id, time.Now())
 		if err != nil {
 			WriteError(w, http.StatusInternalServerError, "Internal server error")
 			return
 		}
-		if len(existing) == 0 {
+		if until.IsZero() {
 			failed++
 			continue
 		}
-
-		// Last admin protection
-		if resource == "users" {
-			userRole, _ := existing[0]["role"].(string)
-			if userRole == "admin" {
-				adminCount, err := h.countAdmins(ctx)
-				if err != nil {
-					WriteError(w, http.StatusInternalServerError, "Internal server error")
-					return
-				}
-				if adminCount <= 1 {
-					failed++
-					continue
-				}
-			}
+		if err := ClearLockout(ctx, h.db, id); err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
 		}
-
-		// For users, cascade-delete refresh tokens
-		if resource == "users" {
-			if err := h.cascadeDeleteRefreshTokens(ctx, id); err != nil {
-				WriteError(w, http.StatusInternalServerError, "Internal server error")
-				return
+		if h.audit != nil {
+			var actor string
+			if identity, ok := GetAuthIdentity(r.Context()); ok {
+				actor = identity.CallerID
 			}
+			h.audit.Record(r.Context(), AuditEntry{
+				Event:      AuditPrivilegedMutation,
+				Actor:      actor,
+				Action:     "unlock",
+				Collection: "users",
+				RecordID:   id,
+				RequestID:  requestID(w),
+			})
 		}
-
-		if err := h.db.DeleteRow(ctx, resource, id); err != nil {
-			failed++
-			continue
-		}
-
-		success++
-	}
-
-	data := make([]any, 0)
-	meta := map[string]any{"success": success, "failed": failed}
-	WriteSuccessFull(w, http.StatusOK, "Resource destroyed successfully", data, meta, nil)
-}
-
-func (h *ResourceMutateHandler) countAdmins(ctx context.Context) (int, error) {
-	rows, _, err := h.db.QueryRows(ctx, "users", QueryOptions{
-		Filters: []Filter{{Field: "role", Op: "eq", Value: "admin"}},
-		Page:    1,
-		PerPage: MaxPerPage,
-	})
-	if err != nil {
-		return 0, err
+		results = append(results, map[string]any{"id": id})
 	}
-	return len(rows), nil
-}
 
-func (h *ResourceMutateHandler) cascadeDeleteRefreshTokens(ctx context.Context, userID string) error {
-	rows, _, err := h.db.QueryRows(ctx, "moon_auth_refresh_tokens", QueryOptions{
-		Filters: []Filter{{Field: "user_id", Op: "eq", Value: userID}},
-		Page:    1,
-		PerPage: MaxPerPage,
-	})
-	if err != nil {
-		return err
-	}
-	for _, row := range rows {
-		tokenID, _ := row["id"].(string)
-		if tokenID == "" {
-			continue
-		}
-		if err := h.db.DeleteRow(ctx, "moon_auth_refresh_tokens", tokenID); err != nil {
-			return err
-		}
-	}
-	return nil
+	meta := map[string]any{"success": len(results), "failed": failed}
+	WriteSuccessFull(w, http.StatusOK, "Action completed successfully", results, meta, nil)
 }
 
-// ---------------------------------------------------------------------------
-// op=action
-// ---------------------------------------------------------------------------
-
-func (h *ResourceMutateHandler) handleAction(w http.ResponseWriter, _ *http.Request, resource string, col *Collection, req resourceMutateRequest) {
-	if req.Action == "" {
-		WriteError(w, http.StatusBadRequest, "Missing required field: action")
+// actionInvite creates a pending user for each email and emails it an
+// invitation to choose a password. Inviting the email of a pending user
+// sends a new invitation; the email of an active user counts as failed, as
+// does a taken username.
+func (h *ResourceMutateHandler) actionInvite(w http.ResponseWriter, r *http.Request, rawItems []json.RawMessage) {
+	if h.mailer == nil {
+		WriteError(w, http.StatusBadRequest, "Invitations require email; see the mail configuration")
 		return
 	}
-
-	switch {
-	case resource == "users" && req.Action == "reset_password":
-		h.actionResetPassword(w, req.Data)
-	case resource == "users" && req.Action == "revoke_sessions":
-		h.actionRevokeSessions(w, req.Data)
-	case resource == "apikeys" && req.Action == "rotate":
-		h.actionRotateAPIKey(w, req.Data)
-	default:
-		WriteError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported action '%s' for resource '%s'", req.Action, resource))
+	ctx := r.Context()
+	var actor string
+	if identity, ok := GetAuthIdentity(ctx); ok {
+		actor = identity.CallerID
 	}
-}
-
-func (h *ResourceMutateHandler) actionResetPassword(w http.ResponseWriter, rawItems []json.RawMessage) {
-	ctx := context.Background()
 	var results []any
 	failed := 0
 
@@ -649,79 +1382,116 @@ func (h *ResourceMutateHandler) actionResetPassword(w http.ResponseWriter, rawIt
 			WriteError(w, http.StatusBadRequest, "Invalid action item")
 			return
 		}
-
-		idRaw, hasID := item["id"]
-		if !hasID {
-			WriteError(w, http.StatusBadRequest, "Each item must include 'id'")
-			return
-		}
-		id, ok := idRaw.(string)
-		if !ok || id == "" {
-			WriteError(w, http.StatusBadRequest, "Field 'id' must be a non-empty string")
+		email, _ := item["email"].(string)
+		email = strings.ToLower(email)
+		role, _ := item["role"].(string)
+		if email == "" {
+			WriteError(w, http.StatusBadRequest, "Field 'email' is required for invite")
 			return
 		}
-
-		passwordRaw, hasPwd := item["password"]
-		if !hasPwd {
-			WriteError(w, http.StatusBadRequest, "Field 'password' is required for reset_password")
+		if !isValidEmail(email) {
+			WriteError(w, http.StatusBadRequest, "Invalid email address")
 			return
 		}
-		password, ok := passwordRaw.(string)
-		if !ok || password == "" {
-			WriteError(w, http.StatusBadRequest, "Field 'password' must be a non-empty string")
+		if err := checkRoleName(ctx, h.db, role); err != nil {
+			writeValidationOrDBError(w, err)
 			return
 		}
-
-		if err := validatePasswordPolicy(password); err != nil {
-			WriteError(w, http.StatusBadRequest, fmt.Sprintf("Password policy violation: %s", err.Error()))
+		if !adminRoleAllowed(r, role) {
+			WriteError(w, http.StatusForbidden, "Only admins can grant the admin role")
 			return
 		}
 
-		// Check user exists
-		existing, _, err := h.db.QueryRows(ctx, "users", QueryOptions{
-			Filters: []Filter{{Field: "id", Op: "eq", Value: id}},
-			Page:    1,
-			PerPage: 1,
-		})
+		user, err := lookupUser(ctx, h.db, "email", email)
 		if err != nil {
 			WriteError(w, http.StatusInternalServerError, "Internal server error")
 			return
 		}
-		if len(existing) == 0 {
-			failed++
-			continue
+		created := false
+		if user != nil {
+			if err := checkInvitationAccepted(ctx, h.db, stringVal(user, "id")); err == nil {
+				failed++
+				continue
+			} else if !errors.Is(err, errInvitationPending) {
+				WriteError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+		} else {
+			username, _ := item["username"].(string)
+			if username == "" {
+				username = email
+			}
+			if taken, err := lookupUser(ctx, h.db, "username", strings.ToLower(username)); err != nil {
+				WriteError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			} else if taken != nil {
+				failed++
+				continue
+			}
+			// The account gets a random password that nobody knows until
+			// the invitation is accepted.
+			hash, err := HashPassword(randomURLString())
+			if err != nil {
+				WriteError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			user = newUserRow(username, email, role, toBool(item["can_write"]), hash)
+			if err := h.db.InsertRow(ctx, "users", user); err != nil {
+				writeDBError(w, err)
+				return
+			}
+			created = true
 		}
 
-		hash, err := HashPassword(password)
+		id := stringVal(user, "id")
+		token, expiresAt, err := createInvitation(ctx, h.db, h.cfg, id, actor)
 		if err != nil {
 			WriteError(w, http.StatusInternalServerError, "Internal server error")
 			return
 		}
-
-		now := time.Now().UTC().Format(time.RFC3339)
-		if err := h.db.UpdateRow(ctx, "users", id, map[string]any{
-			"password_hash": hash,
-			"updated_at":    now,
-		}); err != nil {
-			WriteError(w, http.StatusInternalServerError, "Internal server error")
-			return
+		msg, err := invitationMessage(h.cfg, user, token)
+		if err == nil {
+			err = h.mailer.Send(ctx, msg)
 		}
-
-		// Invalidate all refresh tokens
-		if err := h.revokeAllRefreshTokens(ctx, id, "password_reset"); err != nil {
-			WriteError(w, http.StatusInternalServerError, "Internal server error")
+		if err != nil {
+			// Without the email the invitation cannot be accepted, so
+			// undo it rather than leave an unreachable account.
+			_ = deleteInvitations(ctx, h.db, id)
+			if created {
+				_ = h.db.DeleteRow(ctx, "users", id)
+			}
+			WriteError(w, http.StatusBadGateway, "Invitation email could not be sent")
 			return
 		}
 
-		results = append(results, map[string]any{"id": id})
+		if h.audit != nil {
+			h.audit.Record(ctx, AuditEntry{
+				Event:      AuditPrivilegedMutation,
+				Actor:      actor,
+				Action:     "invite",
+				Collection: "users",
+				RecordID:   id,
+				RequestID:  requestID(w),
+			})
+		}
+		results = append(results, map[string]any{
+			"id":                    id,
+			"username":              stringVal(user, "username"),
+			"email":                 stringVal(user, "email"),
+			"role":                  stringVal(user, "role"),
+			"can_write":             toBool(user["can_write"]),
+			"invitation_expires_at": expiresAt,
+		})
 	}
 
 	meta := map[string]any{"success": len(results), "failed": failed}
 	WriteSuccessFull(w, http.StatusOK, "Action completed successfully", results, meta, nil)
 }
 
-func (h *ResourceMutateHandler) actionRevokeSessions(w http.ResponseWriter, rawItems []json.RawMessage) {
-	ctx := context.Background()
+// actionSetEnabled suspends or restores users or API keys without deleting
+// them. Disabling a user also revokes its refresh tokens.
+func (h *ResourceMutateHandler) actionSetEnabled(w http.ResponseWriter, r *http.Request, resource string, enabled bool, rawItems []json.RawMessage) {
+	ctx := r.Context()
 	var results []any
 	failed := 0
 
@@ -743,8 +1513,7 @@ func (h *ResourceMutateHandler) actionRevokeSessions(w http.ResponseWriter, rawI
 			return
 		}
 
-		// Check user exists
-		existing, _, err := h.db.QueryRows(ctx, "users", QueryOptions{
+		existing, _, err := h.db.QueryRows(ctx, resource, QueryOptions{
 			Filters: []Filter{{Field: "id", Op: "eq", Value: id}},
 			Page:    1,
 			PerPage: 1,
@@ -758,20 +1527,31 @@ func (h *ResourceMutateHandler) actionRevokeSessions(w http.ResponseWriter, rawI
 			continue
 		}
 
-		if err := h.revokeAllRefreshTokens(ctx, id, "admin_revoked"); err != nil {
+		now := time.Now().UTC().Format(time.RFC3339)
+		if err := h.db.UpdateRow(ctx, resource, id, map[string]any{
+			"enabled":    boolToInt(enabled),
+			"updated_at": now,
+		}); err != nil {
 			WriteError(w, http.StatusInternalServerError, "Internal server error")
 			return
 		}
 
-		results = append(results, map[string]any{"id": id})
+		if resource == "users" && !enabled {
+			if err := h.revokeAllRefreshTokens(ctx, id, "account_disabled"); err != nil {
+				WriteError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+		}
+
+		results = append(results, map[string]any{"id": id, "enabled": enabled})
 	}
 
 	meta := map[string]any{"success": len(results), "failed": failed}
 	WriteSuccessFull(w, http.StatusOK, "Action completed successfully", results, meta, nil)
 }
 
-func (h *ResourceMutateHandler) actionRotateAPIKey(w http.ResponseWriter, rawItems []json.RawMessage) {
-	ctx := context.Background()
+func (h *ResourceMutateHandler) actionRotateAPIKey(w http.ResponseWriter, r *http.Request, rawItems []json.RawMessage) {
+	ctx := r.Context()
 	var results []any
 	failed := 0
 
@@ -792,6 +1572,15 @@ func (h *ResourceMutateHandler) actionRotateAPIKey(w http.ResponseWriter, rawIte
 			WriteError(w, http.StatusBadRequest, "Field 'id' must be a non-empty string")
 			return
 		}
+		// A rotation may set a new expiry; without one the old expiry stays.
+		expiresAt, setExpiry := item["expires_at"]
+		if setExpiry {
+			var err error
+			if expiresAt, err = validateAPIKeyExpiry(expiresAt); err != nil {
+				WriteErrorFrom(w, http.StatusBadRequest, err)
+				return
+			}
+		}
 
 		existing, _, err := h.db.QueryRows(ctx, "apikeys", QueryOptions{
 			Filters: []Filter{{Field: "id", Op: "eq", Value: id}},
@@ -810,26 +1599,34 @@ func (h *ResourceMutateHandler) actionRotateAPIKey(w http.ResponseWriter, rawIte
 		rawKey, keyHash := GenerateAPIKey()
 		now := time.Now().UTC().Format(time.RFC3339)
 
-		if err := h.db.UpdateRow(ctx, "apikeys", id, map[string]any{
+		update := map[string]any{
 			"key_hash":   keyHash,
 			"updated_at": now,
-		}); err != nil {
+		}
+		row := existing[0]
+		if setExpiry {
+			update["expires_at"] = expiresAt
+			row["expires_at"] = expiresAt
+		}
+		if err := h.db.UpdateRow(ctx, "apikeys", id, update); err != nil {
 			WriteError(w, http.StatusInternalServerError, "Internal server error")
 			return
 		}
 
-		row := existing[0]
 		results = append(results, map[string]any{
 			"id":               id,
 			"name":             stringVal(row, "name"),
 			"role":             stringVal(row, "role"),
 			"can_write":        toBool(row["can_write"]),
 			"collections":      apiKeyCollectionsValue(row["collections"]),
+			"scopes":           apiKeyScopesValue(row["scopes"]),
 			"is_website":       toBool(row["is_website"]),
 			"allowed_origins":  apiKeyAllowedOriginsValue(row["allowed_origins"]),
 			"rate_limit":       int64(apiKeyRateLimitValue(row["rate_limit"])),
 			"captcha_required": toBool(row["captcha_required"]),
-			"enabled":          apiKeyEnabledValue(row),
+			"noisy_aggregates": toBool(row["noisy_aggregates"]),
+			"enabled":          enabledValue(row),
+			"expires_at":       row["expires_at"],
 			"key":              rawKey,
 		})
 	}
@@ -900,22 +1697,29 @@ func (e *validationError) Error() string { return e.msg }
 
 // readonlyFieldsForResource returns the set of fields that are read-only for
 // the given resource and must not be set by the client on create or update.
-func readonlyFieldsForResource(resource string) map[string]bool {
+// For dynamic collections this is id plus any system timestamp columns.
+func readonlyFieldsForResource(resource string, col *Collection) map[string]bool {
 	if sysFields, ok := systemReadOnlyFields[resource]; ok {
 		return sysFields
 	}
-	return map[string]bool{"id": true}
+	readonly := map[string]bool{"id": true}
+	for _, f := range col.Fields {
+		if f.ReadOnly {
+			readonly[f.Name] = true
+		}
+	}
+	return readonly
 }
 
 // validateWritableFields rejects writes to read-only or server-owned fields.
 func validateWritableFields(item map[string]any, col *Collection, resource string) error {
-	readonly := readonlyFieldsForResource(resource)
+	readonly := readonlyFieldsForResource(resource, col)
 
 	// For system resources, also block password/password_hash and key_hash writes
 	// through create/update (password is handled as a special input field for users)
 	for key := range item {
 		if readonly[key] {
-			return fmt.Errorf("Field '%s' is read-only", key)
+			return fieldError(ErrCodeReadOnlyField, key, fmt.Sprintf("Field '%s' is read-only", key))
 		}
 	}
 	return nil
@@ -932,7 +1736,7 @@ func validateFieldsExist(item map[string]any, fieldMap map[string]Field, resourc
 		if resource == "users" && key == "password" {
 			continue
 		}
-		return fmt.Errorf("Unknown field '%s'", key)
+		return fieldError(ErrCodeUnknownField, key, fmt.Sprintf("Unknown field '%s'", key))
 	}
 	return nil
 }
@@ -946,12 +1750,20 @@ func validateFieldTypes(item map[string]any, fieldMap map[string]Field) error {
 		}
 		if value == nil {
 			if !f.Nullable {
-				return fmt.Errorf("Field '%s' cannot be null", key)
+				return fieldError(ErrCodeValidationFailed, key, fmt.Sprintf("Field '%s' cannot be null", key))
 			}
 			continue
 		}
 		if !isTypeValid(value, f.Type) {
-			return fmt.Errorf("Invalid value for field '%s' of type '%s'", key, f.Type)
+			return fieldError(ErrCodeValidationFailed, key, fmt.Sprintf("Invalid value for field '%s' of type '%s'", key, f.Type))
+		}
+		if f.Type == MoonFieldTypeDecimal {
+			if err := checkDecimal(f, value); err != nil {
+				return fieldError(ErrCodeValidationFailed, key, err.Error())
+			}
+		}
+		if err := f.Rules.Check(key, value); err != nil {
+			return fieldError(ErrCodeValidationFailed, key, err.Error())
 		}
 	}
 	return nil
@@ -968,6 +1780,11 @@ func validateAPIKeyMutationFields(item map[string]any) error {
 			return err
 		}
 	}
+	if _, ok := item["scopes"]; ok {
+		if _, err := validateScopes(item["scopes"]); err != nil {
+			return err
+		}
+	}
 
 	if value, ok := item["rate_limit"]; ok {
 		if _, err := validatePositiveInteger("rate_limit", value); err != nil {
@@ -987,15 +1804,47 @@ func validateAPIKeyMutationFields(item map[string]any) error {
 		}
 	}
 
+	if value, ok := item["noisy_aggregates"]; ok {
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("Field 'noisy_aggregates' must be a boolean")
+		}
+	}
+
 	if value, ok := item["enabled"]; ok {
 		if _, ok := value.(bool); !ok {
 			return fmt.Errorf("Field 'enabled' must be a boolean")
 		}
 	}
 
+	if value, ok := item["expires_at"]; ok {
+		expiresAt, err := validateAPIKeyExpiry(value)
+		if err != nil {
+			return err
+		}
+		item["expires_at"] = expiresAt
+	}
+
 	return nil
 }
 
+// validateAPIKeyExpiry checks an expires_at value: null, or an RFC 3339
+// time in the future. The time is returned in UTC so stored values compare
+// correctly as strings.
+func validateAPIKeyExpiry(value any) (any, error) {
+	if value == nil {
+		return nil, nil
+	}
+	s, _ := value.(string)
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil, fmt.Errorf("Field 'expires_at' must be an RFC 3339 time")
+	}
+	if !t.After(time.Now()) {
+		return nil, fmt.Errorf("Field 'expires_at' must be in the future")
+	}
+	return t.UTC().Format(time.RFC3339), nil
+}
+
 func validateAllowedOrigins(value any) ([]string, error) {
 	return validateStringArrayField("allowed_origins", value, false)
 }
@@ -1070,6 +1919,14 @@ func apiKeyCollectionsValue(value any) []string {
 	return collections
 }
 
+func apiKeyScopesValue(value any) []string {
+	scopes, err := parseStringArrayValue(value, "scopes")
+	if err != nil {
+		return nil
+	}
+	return scopes
+}
+
 func apiKeyRateLimitValue(value any) int {
 	rateLimit, err := parseAPIKeyRateLimit(value)
 	if err != nil {
@@ -1078,7 +1935,9 @@ func apiKeyRateLimitValue(value any) int {
 	return rateLimit
 }
 
-func apiKeyEnabledValue(row map[string]any) bool {
+// enabledValue reports whether a users or apikeys row is enabled. A row
+// without the column is treated as enabled.
+func enabledValue(row map[string]any) bool {
 	value, ok := row["enabled"]
 	if !ok {
 		return true
@@ -1104,14 +1963,8 @@ func isTypeValid(value any, fieldType string) bool {
 			return false
 		}
 	case MoonFieldTypeDecimal:
-		switch value.(type) {
-		case string:
-			return true
-		case float64:
-			return true
-		default:
-			return false
-		}
+		_, ok := normalizeDecimal(value)
+		return ok
 	case MoonFieldTypeBoolean:
 		_, ok := value.(bool)
 		return ok
@@ -1153,6 +2006,11 @@ func prepareValueForDB(value any, fieldType string) any {
 			return value
 		}
 		return string(b)
+	case MoonFieldTypeDecimal:
+		if canonical, ok := normalizeDecimal(value); ok {
+			return canonical
+		}
+		return value
 	default:
 		return value
 	}
@@ -1168,14 +2026,63 @@ func boolToInt(b bool) int64 {
 
 // isUniqueViolation checks if an error indicates a unique constraint violation.
 func isUniqueViolation(err error) bool {
-	for _, msg := range errorMessages(err) {
-		if strings.Contains(msg, "UNIQUE constraint failed") ||
-			strings.Contains(msg, "unique constraint") ||
-			strings.Contains(msg, "duplicate key") {
-			return true
-		}
+	return errors.Is(err, ErrUniqueViolation)
+}
+
+// isConstraintViolation reports whether err broke a unique, foreign key,
+// check, or not null constraint.
+func isConstraintViolation(err error) bool {
+	return errors.Is(err, ErrUniqueViolation) || errors.Is(err, ErrForeignKey) ||
+		errors.Is(err, ErrCheckViolation) || errors.Is(err, ErrNotNull)
+}
+
+// dbErrorResponse maps a database error to the status and message clients
+// see. Unclassified errors become a generic 500 so SQL details never leak.
+func dbErrorResponse(err error) (int, string) {
+	switch {
+	case errors.Is(err, ErrUniqueViolation):
+		return http.StatusConflict, uniqueViolationMessage(err)
+	case errors.Is(err, ErrForeignKey):
+		return http.StatusConflict, "Foreign key constraint violation"
+	case errors.Is(err, ErrCheckViolation):
+		return http.StatusBadRequest, "Check constraint violation"
+	case errors.Is(err, ErrNotNull):
+		return http.StatusBadRequest, notNullViolationMessage(err)
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound, "Not found"
+	case errors.Is(err, ErrUnavailable):
+		return http.StatusServiceUnavailable, "Database unavailable"
+	default:
+		return http.StatusInternalServerError, "Internal server error"
 	}
-	return false
+}
+
+// dbErrorCode returns the error code of a database error, or "" for the
+// generic code of its status.
+func dbErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrUniqueViolation):
+		return ErrCodeUniqueViolation
+	case errors.Is(err, ErrForeignKey):
+		return ErrCodeForeignKeyViolation
+	case errors.Is(err, ErrCheckViolation):
+		return ErrCodeCheckViolation
+	case errors.Is(err, ErrNotNull):
+		return ErrCodeNotNullViolation
+	case errors.Is(err, ErrUnavailable):
+		return ErrCodeDatabaseUnavailable
+	default:
+		return ""
+	}
+}
+
+// writeDBError writes the error response for a database error.
+func writeDBError(w http.ResponseWriter, err error) {
+	status, msg := dbErrorResponse(err)
+	if status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", strconv.Itoa(DBUnavailableRetryAfterSeconds))
+	}
+	WriteErrorCode(w, status, dbErrorCode(err), msg)
 }
 
 // postgresUniqueFieldsRe extracts field names from PostgreSQL duplicate key errors.
@@ -1218,6 +2125,31 @@ func uniqueViolationFields(err error) []string {
 	return nil
 }
 
+// notNullFieldRe extracts the column name from SQLite, PostgreSQL, and
+// MySQL not null errors.
+var notNullFieldRe = regexp.MustCompile(`NOT NULL constraint failed: (?:[^.\s]+\.)?(\S+)|null value in column "([^"]+)"|(?:Column|Field) '([^']+)' (?:cannot be null|doesn't have a default value)`)
+
+func notNullViolationMessage(err error) string {
+	if field := notNullField(err); field != "" {
+		return fmt.Sprintf("Missing required field: %s", field)
+	}
+	return "Missing required field"
+}
+
+// notNullField returns the field named by a not null error, or "".
+func notNullField(err error) string {
+	for _, msg := range errorMessages(err) {
+		if m := notNullFieldRe.FindStringSubmatch(msg); m != nil {
+			for _, field := range m[1:] {
+				if field != "" {
+					return field
+				}
+			}
+		}
+	}
+	return ""
+}
+
 func parseUniqueFieldList(raw string) []string {
 	parts := strings.Split(raw, ",")
 	fields := make([]string, 0, len(parts))
@@ -10,6 +10,8 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/go-sql-driver/mysql"
 )
 
 // ---------------------------------------------------------------------------
@@ -239,6 +241,13 @@ func TestMutate_Create_RejectsUnknownFields(t *testing.T) {
 	if w.Code != http.StatusBadRequest {
 		t.Fatalf("expected 400, got %d: %s", w.Code, w.Body.String())
 	}
+	var got ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.Code != ErrCodeUnknownField || len(got.Details) != 2 || got.Details[0].Field != "nonexistent" || got.Details[1].Field != "data" {
+		t.Fatalf("error = %+v, want unknown_field for nonexistent", got)
+	}
 }
 
 func TestMutate_Create_RejectsInvalidType(t *testing.T) {
@@ -253,6 +262,103 @@ func TestMutate_Create_RejectsInvalidType(t *testing.T) {
 	if w.Code != http.StatusBadRequest {
 		t.Fatalf("expected 400, got %d: %s", w.Code, w.Body.String())
 	}
+	var got ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.Code != ErrCodeValidationFailed || len(got.Details) != 2 || got.Details[0].Field != "title" {
+		t.Fatalf("error = %+v, want validation_failed for title", got)
+	}
+	if got.Details[0].Example != "example" {
+		t.Errorf("expected an example string for title, got %v", got.Details[0].Example)
+	}
+}
+
+func TestMutate_ValidationErrorExamples(t *testing.T) {
+	handler, _, _ := setupMutateTest(t)
+
+	decode := func(w *httptest.ResponseRecorder) ErrorResponse {
+		t.Helper()
+		var got ErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return got
+	}
+
+	// A create missing a required field names it, and the example item
+	// in the "data" detail is itself accepted.
+	w := doMutateRequest(t, handler, "products", map[string]any{"op": "create", "data": []any{map[string]any{"price": "9.99"}}}, adminIdentity())
+	got := decode(w)
+	if w.Code != http.StatusBadRequest || got.Code != ErrCodeNotNullViolation || len(got.Details) != 2 || got.Details[0].Field != "title" {
+		t.Fatalf("expected 400 not_null_violation for title, got %d: %s", w.Code, w.Body.String())
+	}
+	example := got.Details[1]
+	if example.Field != "data" || example.Example == nil {
+		t.Fatalf("expected an example item, got %+v", example)
+	}
+	w = doMutateRequest(t, handler, "products", map[string]any{"op": "create", "data": []any{example.Example}}, adminIdentity())
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected the example item to be created, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// An update example names a record and one field.
+	w = doMutateRequest(t, handler, "products", map[string]any{"op": "update", "data": []any{map[string]any{"id": "x", "quantity": "many"}}}, adminIdentity())
+	got = decode(w)
+	if w.Code != http.StatusBadRequest || len(got.Details) != 2 || got.Details[0].Example != float64(1) {
+		t.Fatalf("expected 400 with an example quantity, got %d: %s", w.Code, w.Body.String())
+	}
+	item, _ := got.Details[1].Example.(map[string]any)
+	if len(item) != 2 || item["id"] != exampleULID {
+		t.Errorf("unexpected update example %v", item)
+	}
+
+	// System collections have no generated examples.
+	w = doMutateRequest(t, handler, "users", map[string]any{"op": "create", "data": []any{map[string]any{"nope": 1}}}, adminIdentity())
+	if got := decode(w); len(got.Details) != 1 {
+		t.Errorf("expected no example for users, got %+v", got.Details)
+	}
+}
+
+func TestMutate_Create_EnforcesFieldRules(t *testing.T) {
+	handler, adapter, registry := setupMutateTest(t)
+
+	lo, hi, maxLen := int64(1), int64(5), 10
+	ddl := `CREATE TABLE tickets (id TEXT PRIMARY KEY, ` +
+		`"priority" INTEGER NOT NULL` + fieldRulesCheckSQL("priority", FieldRules{Min: &lo, Max: &hi}) + `, ` +
+		`"state" TEXT NOT NULL` + fieldRulesCheckSQL("state", FieldRules{MaxLength: &maxLen, Enum: []string{"open", "closed"}}) + `)`
+	if err := adapter.ExecDDL(context.Background(), ddl); err != nil {
+		t.Fatalf("ExecDDL tickets: %v", err)
+	}
+	if err := registry.Refresh(); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		item    map[string]any
+		status  int
+		message string
+	}{
+		{"valid", map[string]any{"priority": 3, "state": "open"}, http.StatusCreated, ""},
+		{"below min", map[string]any{"priority": 0, "state": "open"}, http.StatusBadRequest, "Field 'priority' must be at least 1"},
+		{"above max", map[string]any{"priority": 6, "state": "open"}, http.StatusBadRequest, "Field 'priority' must be at most 5"},
+		{"not in enum", map[string]any{"priority": 2, "state": "pending"}, http.StatusBadRequest, "Field 'state' must be one of: open, closed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := map[string]any{"op": "create", "data": []any{tt.item}}
+			w := doMutateRequest(t, handler, "tickets", body, adminIdentity())
+			if w.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.message != "" {
+				if msg := decodeResponse(t, w)["message"]; msg != tt.message {
+					t.Errorf("expected message %q, got %v", tt.message, msg)
+				}
+			}
+		})
+	}
 }
 
 func TestMutate_Create_MissingOp(t *testing.T) {
@@ -517,6 +623,7 @@ func TestMutate_Create_APIKey_Success(t *testing.T) {
 				"allowed_origins":  []any{"https://example.com"},
 				"rate_limit":       5,
 				"captcha_required": true,
+				"noisy_aggregates": true,
 				"enabled":          true,
 			},
 		},
@@ -548,6 +655,9 @@ func TestMutate_Create_APIKey_Success(t *testing.T) {
 	if record["captcha_required"] != true {
 		t.Fatalf("expected captcha_required=true, got %v", record["captcha_required"])
 	}
+	if record["noisy_aggregates"] != true {
+		t.Fatalf("expected noisy_aggregates=true, got %v", record["noisy_aggregates"])
+	}
 	if record["enabled"] != true {
 		t.Fatalf("expected enabled=true, got %v", record["enabled"])
 	}
@@ -670,6 +780,265 @@ func TestMutate_Update_Success(t *testing.T) {
 	}
 }
 
+func TestMutate_TimestampFields(t *testing.T) {
+	handler, adapter, registry := setupMutateTest(t)
+
+	ddl := `CREATE TABLE notes (id TEXT PRIMARY KEY, body TEXT NOT NULL, created_at TIMESTAMP NOT NULL, updated_at TIMESTAMP NOT NULL)`
+	if err := adapter.ExecDDL(context.Background(), ddl); err != nil {
+		t.Fatalf("ExecDDL notes: %v", err)
+	}
+	if err := registry.Refresh(); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	body := map[string]any{"op": "create", "data": []any{map[string]any{"body": "hello"}}}
+	w := doMutateRequest(t, handler, "notes", body, adminIdentity())
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	record := parseResponse(t, w)["data"].([]any)[0].(map[string]any)
+	if record["created_at"] == "" || record["created_at"] != record["updated_at"] {
+		t.Fatalf("expected matching server timestamps, got %v", record)
+	}
+	id := record["id"].(string)
+
+	body = map[string]any{"op": "create", "data": []any{map[string]any{"body": "x", "created_at": "2020-01-01T00:00:00Z"}}}
+	w = doMutateRequest(t, handler, "notes", body, adminIdentity())
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for client created_at, got %d", w.Code)
+	}
+
+	old := "2020-01-01T00:00:00Z"
+	if err := adapter.UpdateRow(context.Background(), "notes", id, map[string]any{"created_at": old, "updated_at": old}); err != nil {
+		t.Fatalf("UpdateRow: %v", err)
+	}
+	body = map[string]any{"op": "update", "data": []any{map[string]any{"id": id, "body": "edited"}}}
+	w = doMutateRequest(t, handler, "notes", body, adminIdentity())
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	record = parseResponse(t, w)["data"].([]any)[0].(map[string]any)
+	if record["created_at"] != old || record["updated_at"] == old {
+		t.Errorf("expected only updated_at to change, got %v", record)
+	}
+
+	body = map[string]any{"op": "update", "data": []any{map[string]any{"id": id, "updated_at": old}}}
+	w = doMutateRequest(t, handler, "notes", body, adminIdentity())
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for client updated_at, got %d", w.Code)
+	}
+}
+
+func TestMutate_OwnedCollection(t *testing.T) {
+	handler, adapter, registry := setupMutateTest(t)
+
+	ddl := `CREATE TABLE tasks (id TEXT PRIMARY KEY, title TEXT NOT NULL, owner_id TEXT)`
+	if err := adapter.ExecDDL(context.Background(), ddl); err != nil {
+		t.Fatalf("ExecDDL tasks: %v", err)
+	}
+	if err := registry.Refresh(); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	alice := userWriteIdentity()
+	bob := &AuthIdentity{CredentialType: CredentialTypeJWT, CallerID: "bob-id", Role: "user", CanWrite: true}
+
+	body := map[string]any{"op": "create", "data": []any{map[string]any{"title": "mine"}}}
+	w := doMutateRequest(t, handler, "tasks", body, alice)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	record := parseResponse(t, w)["data"].([]any)[0].(map[string]any)
+	if record["owner_id"] != alice.CallerID {
+		t.Fatalf("expected owner_id %q, got %v", alice.CallerID, record["owner_id"])
+	}
+	id := record["id"].(string)
+
+	body = map[string]any{"op": "create", "data": []any{map[string]any{"title": "x", "owner_id": bob.CallerID}}}
+	if w := doMutateRequest(t, handler, "tasks", body, bob); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for client owner_id, got %d", w.Code)
+	}
+
+	for _, op := range []string{"update", "destroy"} {
+		item := map[string]any{"id": id}
+		if op == "update" {
+			item["title"] = "stolen"
+		}
+		w := doMutateRequest(t, handler, "tasks", map[string]any{"op": op, "data": []any{item}}, bob)
+		meta := parseResponse(t, w)["meta"].(map[string]any)
+		if meta["failed"] != float64(1) {
+			t.Errorf("%s by another user: expected failed=1, got %v", op, meta)
+		}
+	}
+
+	qh := NewResourceQueryHandler(adapter, registry, &AppConfig{})
+	count := func(identity *AuthIdentity) int {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/data/tasks:query", nil)
+		req = req.WithContext(SetAuthIdentity(req.Context(), identity))
+		w := httptest.NewRecorder()
+		qh.HandleQuery(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("query as %s: expected 200, got %d", identity.CallerID, w.Code)
+		}
+		data, _ := parseResponse(t, w)["data"].([]any)
+		return len(data)
+	}
+	if n := count(bob); n != 0 {
+		t.Errorf("expected other user to see no rows, got %d", n)
+	}
+	if n := count(alice); n != 1 {
+		t.Errorf("expected owner to see 1 row, got %d", n)
+	}
+	if n := count(adminIdentity()); n != 1 {
+		t.Errorf("expected admin to see 1 row, got %d", n)
+	}
+
+	body = map[string]any{"op": "update", "data": []any{map[string]any{"id": id, "title": "done"}}}
+	if w := doMutateRequest(t, handler, "tasks", body, alice); w.Code != http.StatusOK {
+		t.Fatalf("owner update: expected 200, got %d", w.Code)
+	}
+	body = map[string]any{"op": "destroy", "data": []any{map[string]any{"id": id}}}
+	w = doMutateRequest(t, handler, "tasks", body, adminIdentity())
+	if meta := parseResponse(t, w)["meta"].(map[string]any); meta["success"] != float64(1) {
+		t.Errorf("expected admin to destroy any row, got %v", meta)
+	}
+}
+
+func TestMutate_Update_OptimisticConcurrency(t *testing.T) {
+	handler, adapter, registry := setupMutateTest(t)
+
+	ddl := `CREATE TABLE docs (id TEXT PRIMARY KEY, title TEXT NOT NULL, "_version" INTEGER NOT NULL DEFAULT 1)`
+	if err := adapter.ExecDDL(context.Background(), ddl); err != nil {
+		t.Fatalf("ExecDDL docs: %v", err)
+	}
+	if err := registry.Refresh(); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	body := map[string]any{"op": "create", "data": []any{map[string]any{"title": "draft"}}}
+	w := doMutateRequest(t, handler, "docs", body, adminIdentity())
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	record := parseResponse(t, w)["data"].([]any)[0].(map[string]any)
+	if record["_version"] != float64(1) {
+		t.Fatalf("expected _version=1 on create, got %v", record["_version"])
+	}
+	id := record["id"].(string)
+
+	update := func(item map[string]any) *httptest.ResponseRecorder {
+		item["id"] = id
+		return doMutateRequest(t, handler, "docs", map[string]any{"op": "update", "data": []any{item}}, adminIdentity())
+	}
+
+	w = update(map[string]any{"title": "first", "_version": 1})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if v := parseResponse(t, w)["data"].([]any)[0].(map[string]any)["_version"]; v != float64(2) {
+		t.Fatalf("expected _version=2 after update, got %v", v)
+	}
+
+	w = update(map[string]any{"title": "stale", "_version": 1})
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for stale version, got %d: %s", w.Code, w.Body.String())
+	}
+	resp := parseResponse(t, w)
+	current := resp["data"].([]any)[0].(map[string]any)
+	if current["title"] != "first" || current["_version"] != float64(2) {
+		t.Errorf("expected current record in conflict body, got %v", current)
+	}
+
+	w = update(map[string]any{"title": "unconditional"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 without _version, got %d: %s", w.Code, w.Body.String())
+	}
+	if v := parseResponse(t, w)["data"].([]any)[0].(map[string]any)["_version"]; v != float64(3) {
+		t.Errorf("expected _version=3, got %v", v)
+	}
+
+	for _, bad := range []any{0, "2", 1.5} {
+		if w := update(map[string]any{"title": "x", "_version": bad}); w.Code != http.StatusBadRequest {
+			t.Errorf("_version=%v: expected 400, got %d", bad, w.Code)
+		}
+	}
+
+	if w := doMutateRequest(t, handler, "products", map[string]any{"op": "update", "data": []any{map[string]any{"id": "p1", "_version": 1}}}, adminIdentity()); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for _version on unversioned collection, got %d", w.Code)
+	}
+}
+
+func TestMutate_IfMatch(t *testing.T) {
+	handler, adapter, registry := setupMutateTest(t)
+	id := GenerateULID()
+	if err := adapter.InsertRow(context.Background(), "products", map[string]any{
+		"id": id, "title": "Old Title", "price": "10.00", "quantity": int64(5), "active": int64(1),
+		"created_at": "2025-01-01T00:00:00Z", "updated_at": "2025-01-01T00:00:00Z",
+	}); err != nil {
+		t.Fatalf("seed product: %v", err)
+	}
+
+	query := NewResourceQueryHandler(adapter, registry, &AppConfig{})
+	read := func() string {
+		w := httptest.NewRecorder()
+		query.HandleQuery(w, httptest.NewRequest(http.MethodGet, "/data/products:query?id="+id, nil))
+		return w.Header().Get("ETag")
+	}
+	mutate := func(ifMatch string, body map[string]any) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, "/data/products:mutate", bytes.NewReader(b))
+		req = req.WithContext(SetAuthIdentity(req.Context(), adminIdentity()))
+		req.Header.Set("If-Match", ifMatch)
+		w := httptest.NewRecorder()
+		handler.HandleMutate(w, req)
+		return w
+	}
+	update := func(ifMatch, title string) *httptest.ResponseRecorder {
+		return mutate(ifMatch, map[string]any{"op": "update", "data": []any{map[string]any{"id": id, "title": title}}})
+	}
+
+	etag := read()
+	if w := update(etag, "First"); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 with the current ETag, got %d: %s", w.Code, w.Body.String())
+	}
+	w := update(etag, "Stale")
+	if w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 with a stale ETag, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("ETag") != read() {
+		t.Errorf("expected the 412 to carry the current ETag")
+	}
+	if w := update("2024-06-01T00:00:00Z", "Stale"); w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 with a stale updated_at, got %d", w.Code)
+	}
+
+	rows, _, _ := adapter.QueryRows(context.Background(), "products", QueryOptions{Filters: []Filter{{Field: "id", Op: "eq", Value: id}}, Page: 1, PerPage: 1})
+	updatedAt, _ := rows[0]["updated_at"].(string)
+	if w := update(updatedAt, "Second"); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 with the current updated_at %q, got %d: %s", updatedAt, w.Code, w.Body.String())
+	}
+
+	for name, body := range map[string]map[string]any{
+		"create": {"op": "create", "data": []any{map[string]any{"title": "x"}}},
+		"batch":  {"op": "update", "data": []any{map[string]any{"id": id, "title": "a"}, map[string]any{"id": id, "title": "b"}}},
+	} {
+		if w := mutate("*", body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", name, w.Code)
+		}
+	}
+
+	destroy := map[string]any{"op": "destroy", "data": []any{map[string]any{"id": id}}}
+	if w := mutate(etag, destroy); w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 destroying with a stale ETag, got %d", w.Code)
+	}
+	if w := mutate("*", destroy); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 destroying with *, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := mutate("*", destroy); w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 for a destroyed record, got %d", w.Code)
+	}
+}
+
 func TestMutate_Update_MissingID(t *testing.T) {
 	handler, _, _ := setupMutateTest(t)
 
@@ -1042,6 +1411,67 @@ func TestMutate_Action_RevokeSessions_Success(t *testing.T) {
 	}
 }
 
+func TestMutate_Action_DisableEnable(t *testing.T) {
+	handler, adapter, _ := setupMutateTest(t)
+	ctx := context.Background()
+	userID := seedAdminUser(t, adapter)
+	if err := adapter.InsertRow(ctx, "moon_auth_refresh_tokens", map[string]any{
+		"id":                 GenerateULID(),
+		"user_id":            userID,
+		"refresh_token_hash": "hash1",
+		"expires_at":         "2099-01-01T00:00:00Z",
+		"created_at":         "2025-01-01T00:00:00Z",
+	}); err != nil {
+		t.Fatalf("seed token: %v", err)
+	}
+
+	setEnabled := func(resource, action, id string) {
+		t.Helper()
+		body := map[string]any{"op": "action", "action": action, "data": []any{map[string]any{"id": id}}}
+		w := doMutateRequest(t, handler, resource, body, adminIdentity())
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s %s: expected 200, got %d: %s", resource, action, w.Code, w.Body.String())
+		}
+	}
+	enabled := func(resource, id string) bool {
+		t.Helper()
+		rows, _, err := adapter.QueryRows(ctx, resource, QueryOptions{
+			Filters: []Filter{{Field: "id", Op: "eq", Value: id}},
+			Page:    1,
+			PerPage: 1,
+		})
+		if err != nil || len(rows) != 1 {
+			t.Fatalf("query %s: %v", resource, err)
+		}
+		return enabledValue(rows[0])
+	}
+
+	setEnabled("users", "disable", userID)
+	if enabled("users", userID) {
+		t.Fatal("expected user to be disabled")
+	}
+	tokens, _, _ := adapter.QueryRows(ctx, "moon_auth_refresh_tokens", QueryOptions{Page: 1, PerPage: 10})
+	if reason, _ := tokens[0]["revocation_reason"].(string); reason != "account_disabled" {
+		t.Errorf("expected refresh token revoked with account_disabled, got %v", tokens[0])
+	}
+	setEnabled("users", "enable", userID)
+	if !enabled("users", userID) {
+		t.Fatal("expected user to be enabled again")
+	}
+
+	keyID := GenerateULID()
+	if err := adapter.InsertRow(ctx, "apikeys", map[string]any{
+		"id": keyID, "name": "svc", "role": "user", "key_hash": "kh", "collections": "[]",
+		"created_at": "2025-01-01T00:00:00Z", "updated_at": "2025-01-01T00:00:00Z",
+	}); err != nil {
+		t.Fatalf("seed api key: %v", err)
+	}
+	setEnabled("apikeys", "disable", keyID)
+	if enabled("apikeys", keyID) {
+		t.Fatal("expected api key to be disabled")
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Tests: op=action rotate (apikeys)
 // ---------------------------------------------------------------------------
@@ -1266,22 +1696,23 @@ func TestUniqueViolationMessage(t *testing.T) {
 
 func TestIsUniqueViolation(t *testing.T) {
 	tests := []struct {
-		msg  string
+		name string
+		err  error
 		want bool
 	}{
-		{"UNIQUE constraint failed: users.username", true},
-		{"unique constraint violation", true},
-		{"duplicate key value violates unique constraint", true},
-		{"some other error", false},
-		{"", false},
+		{"sentinel", ErrUniqueViolation, true},
+		{"wrapped sentinel", fmt.Errorf("insert: %w", ErrUniqueViolation), true},
+		{"postgres adapter error", newAdapterError("InsertRow", "users", "insert failed", fmt.Errorf(`duplicate key value violates unique constraint "users_email_key" (SQLSTATE 23505)`)), true},
+		{"mysql adapter error", newAdapterError("InsertRow", "users", "insert failed", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'a' for key 'email'"}), true},
+		{"foreign key", newAdapterError("InsertRow", "orders", "insert failed", fmt.Errorf("SQLSTATE 23503")), false},
+		{"unclassified message", fmt.Errorf("UNIQUE constraint failed: users.username"), false},
+		{"other error", fmt.Errorf("some other error"), false},
 	}
 
 	for _, tt := range tests {
-		t.Run(tt.msg, func(t *testing.T) {
-			err := fmt.Errorf("%s", tt.msg)
-			got := isUniqueViolation(err)
-			if got != tt.want {
-				t.Fatalf("isUniqueViolation(%q) = %v, want %v", tt.msg, got, tt.want)
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isUniqueViolation(tt.err); got != tt.want {
+				t.Fatalf("isUniqueViolation(%v) = %v, want %v", tt.err, got, tt.want)
 			}
 		})
 	}
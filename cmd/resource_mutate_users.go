@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// userWrite is one prepared item of a users :mutate request with a mode.
+type userWrite struct {
+	write  BatchWrite
+	before map[string]any // the stored record, for update and destroy
+	record map[string]any // the created record, for create
+}
+
+// handleUsersBatch applies op=create, op=update, or op=destroy on users
+// with an explicit mode. Every item is checked before anything is
+// written. In atomic mode an invalid item rejects the request with a
+// message naming its 1-based position, and the writes are applied in one
+// transaction. In best_effort mode an invalid item counts as failed and
+// every other item is written on its own.
+func (h *ResourceMutateHandler) handleUsersBatch(w http.ResponseWriter, r *http.Request, col *Collection, req resourceMutateRequest) {
+	ctx := r.Context()
+	atomic := req.Mode == "atomic"
+	fieldMap := buildFieldMap(col)
+
+	writes := make([]userWrite, 0, len(req.Data))
+	failed := 0
+	// Admins destroyed so far in the request, for last admin protection.
+	destroyedAdmins := 0
+	for i, raw := range req.Data {
+		var item map[string]any
+		if err := json.Unmarshal(raw, &item); err != nil {
+			WriteError(w, http.StatusBadRequest, fmt.Sprintf("Invalid %s item", req.Op))
+			return
+		}
+
+		var uw userWrite
+		var berr *batchError
+		switch req.Op {
+		case "create":
+			uw, berr = h.prepareUserCreate(ctx, r, col, fieldMap, item)
+		case "update":
+			uw, berr = h.prepareUserUpdate(ctx, r, col, fieldMap, item)
+		default:
+			uw, berr = h.prepareUserDestroy(ctx, r, col, item, destroyedAdmins)
+		}
+		if berr != nil {
+			if berr.status == http.StatusInternalServerError {
+				berr.write(w, "")
+				return
+			}
+			if atomic {
+				berr.write(w, fmt.Sprintf("Item %d: ", i+1))
+				return
+			}
+			failed++
+			continue
+		}
+		if req.Op == "destroy" && stringVal(uw.before, "role") == "admin" {
+			destroyedAdmins++
+		}
+		writes = append(writes, uw)
+	}
+
+	applied := writes
+	if atomic {
+		batch := make([]BatchWrite, len(writes))
+		for i, uw := range writes {
+			batch[i] = uw.write
+		}
+		if len(batch) > 0 {
+			if idx, err := h.db.ExecWriteBatch(ctx, batch); err != nil {
+				switch {
+				case idx < len(batch) && errors.Is(err, ErrNoRowAffected):
+					WriteErrorCode(w, http.StatusConflict, ErrCodeVersionConflict, fmt.Sprintf("Item %d: Record '%s' was changed or deleted before it could be written", idx+1, batch[idx].ID))
+				case idx < len(batch) && isConstraintViolation(err):
+					status, msg := dbErrorResponse(err)
+					WriteErrorCode(w, status, dbErrorCode(err), fmt.Sprintf("Item %d: %s", idx+1, msg))
+				default:
+					WriteError(w, http.StatusInternalServerError, "Internal server error")
+				}
+				return
+			}
+		}
+	} else {
+		applied = make([]userWrite, 0, len(writes))
+		for _, uw := range writes {
+			if _, err := h.db.ExecWriteBatch(ctx, []BatchWrite{uw.write}); err != nil {
+				if !isConstraintViolation(err) && !errors.Is(err, ErrNoRowAffected) {
+					WriteError(w, http.StatusInternalServerError, "Internal server error")
+					return
+				}
+				failed++
+				continue
+			}
+			applied = append(applied, uw)
+		}
+	}
+
+	results := make([]any, 0, len(applied))
+	for _, uw := range applied {
+		id := uw.write.ID
+		switch req.Op {
+		case "create":
+			h.auditMutation(w, r, "create", "users", id, nil, uw.record)
+			results = append(results, uw.record)
+		case "update":
+			rows, _, err := h.db.QueryRows(ctx, "users", QueryOptions{
+				Filters: []Filter{{Field: "id", Op: "eq", Value: id}},
+				Page:    1,
+				PerPage: 1,
+			})
+			if err != nil || len(rows) == 0 {
+				WriteError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			record := filterHiddenFields("users", formatRecord(rows[0], col))
+			h.auditMutation(w, r, "update", "users", id, uw.before, record)
+			results = append(results, record)
+		default:
+			if err := h.cascadeDeleteUser(ctx, id); err != nil {
+				WriteError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			h.auditMutation(w, r, "destroy", "users", id, uw.before, nil)
+		}
+	}
+
+	meta := map[string]any{"success": len(applied), "failed": failed}
+	switch req.Op {
+	case "create":
+		status := http.StatusCreated
+		if len(applied) == 0 {
+			status = http.StatusOK
+		}
+		WriteSuccessFull(w, status, "Resource created successfully", results, meta, nil)
+	case "update":
+		WriteSuccessFull(w, http.StatusOK, "Resource updated successfully", results, meta, nil)
+	default:
+		WriteSuccessFull(w, http.StatusOK, "Resource destroyed successfully", []any{}, meta, nil)
+	}
+}
+
+// prepareUserCreate applies the op=create checks to item and builds the
+// insert.
+func (h *ResourceMutateHandler) prepareUserCreate(ctx context.Context, r *http.Request, col *Collection, fieldMap map[string]Field, item map[string]any) (userWrite, *batchError) {
+	if _, hasID := item["id"]; hasID {
+		return userWrite{}, &batchError{status: http.StatusBadRequest, msg: "Field 'id' must not be provided for create"}
+	}
+	if berr := validateUserFields(item, col, fieldMap); berr != nil {
+		return userWrite{}, berr
+	}
+	if role, _ := item["role"].(string); !adminRoleAllowed(r, role) {
+		return userWrite{}, &batchError{status: http.StatusForbidden, msg: "Only admins can grant the admin role"}
+	}
+	row, record, err := h.buildUser(ctx, item)
+	if err != nil {
+		return userWrite{}, userBatchError(err)
+	}
+	return userWrite{
+		write:  BatchWrite{Op: BatchInsert, Table: "users", ID: stringVal(row, "id"), Data: row},
+		record: record,
+	}, nil
+}
+
+// prepareUserUpdate applies the op=update checks to item and builds the
+// update.
+func (h *ResourceMutateHandler) prepareUserUpdate(ctx context.Context, r *http.Request, col *Collection, fieldMap map[string]Field, item map[string]any) (userWrite, *batchError) {
+	id, berr := userItemID(item, "update")
+	if berr != nil {
+		return userWrite{}, berr
+	}
+	updateData := make(map[string]any, len(item))
+	for k, v := range item {
+		if k != "id" {
+			updateData[k] = v
+		}
+	}
+	if berr := validateUserFields(updateData, col, fieldMap); berr != nil {
+		return userWrite{}, berr
+	}
+	if role, ok := updateData["role"].(string); ok {
+		if err := checkRoleName(ctx, h.db, role); err != nil {
+			return userWrite{}, userBatchError(err)
+		}
+		if !adminRoleAllowed(r, role) {
+			return userWrite{}, &batchError{status: http.StatusForbidden, msg: "Only admins can grant the admin role"}
+		}
+	}
+	before, berr := h.findUserForBatch(ctx, r, col, id)
+	if berr != nil {
+		return userWrite{}, berr
+	}
+
+	dbData := make(map[string]any, len(updateData))
+	for k, v := range updateData {
+		if f, ok := fieldMap[k]; ok {
+			dbData[k] = prepareValueForDB(v, f.Type)
+		} else {
+			dbData[k] = v
+		}
+	}
+	setTimestampFields(dbData, fieldMap, false)
+	return userWrite{
+		write:  BatchWrite{Op: BatchUpdate, Table: "users", ID: id, Data: dbData},
+		before: before,
+	}, nil
+}
+
+// prepareUserDestroy applies the op=destroy checks to item. adminsBefore
+// is the number of admins destroyed by earlier items, so a request cannot
+// remove the last admin.
+func (h *ResourceMutateHandler) prepareUserDestroy(ctx context.Context, r *http.Request, col *Collection, item map[string]any, adminsBefore int) (userWrite, *batchError) {
+	id, berr := userItemID(item, "destroy")
+	if berr != nil {
+		return userWrite{}, berr
+	}
+	before, berr := h.findUserForBatch(ctx, r, col, id)
+	if berr != nil {
+		return userWrite{}, berr
+	}
+	if stringVal(before, "role") == "admin" {
+		adminCount, err := h.countAdmins(ctx)
+		if err != nil {
+			return userWrite{}, &batchError{status: http.StatusInternalServerError, msg: "Internal server error"}
+		}
+		if adminCount-adminsBefore <= 1 {
+			return userWrite{}, &batchError{status: http.StatusConflict, msg: "Cannot destroy the last admin"}
+		}
+	}
+	return userWrite{
+		write:  BatchWrite{Op: BatchDelete, Table: "users", ID: id},
+		before: before,
+	}, nil
+}
+
+// findUserForBatch reads user id for an update or destroy item and checks
+// that the caller may change it.
+func (h *ResourceMutateHandler) findUserForBatch(ctx context.Context, r *http.Request, col *Collection, id string) (map[string]any, *batchError) {
+	rows, _, err := h.db.QueryRows(ctx, "users", QueryOptions{
+		Filters: []Filter{{Field: "id", Op: "eq", Value: id}},
+		Page:    1,
+		PerPage: 1,
+	})
+	if err != nil {
+		return nil, &batchError{status: http.StatusInternalServerError, msg: "Internal server error"}
+	}
+	if len(rows) == 0 {
+		return nil, &batchError{status: http.StatusNotFound, msg: fmt.Sprintf("Record '%s' not found", id)}
+	}
+	if !adminRoleAllowed(r, stringVal(rows[0], "role")) {
+		return nil, &batchError{status: http.StatusForbidden, msg: "Only admins can change admin accounts"}
+	}
+	return filterHiddenFields("users", formatRecord(rows[0], col)), nil
+}
+
+// validateUserFields applies the :mutate field checks to a users item.
+func validateUserFields(item map[string]any, col *Collection, fieldMap map[string]Field) *batchError {
+	if err := validateWritableFields(item, col, "users"); err != nil {
+		return newBatchError(http.StatusBadRequest, err)
+	}
+	if err := validateFieldsExist(item, fieldMap, "users"); err != nil {
+		return newBatchError(http.StatusBadRequest, err)
+	}
+	if err := validateFieldTypes(item, fieldMap); err != nil {
+		return newBatchError(http.StatusBadRequest, err)
+	}
+	return nil
+}
+
+// userItemID returns the id of an update or destroy item.
+func userItemID(item map[string]any, op string) (string, *batchError) {
+	raw, ok := item["id"]
+	if !ok {
+		return "", &batchError{status: http.StatusBadRequest, msg: fmt.Sprintf("Each %s item must include 'id'", op)}
+	}
+	id, ok := raw.(string)
+	if !ok || id == "" {
+		return "", &batchError{status: http.StatusBadRequest, msg: "Field 'id' must be a non-empty string"}
+	}
+	return id, nil
+}
+
+// userBatchError maps a validationError to 400 and anything else to 500.
+func userBatchError(err error) *batchError {
+	if ve, ok := err.(*validationError); ok {
+		return &batchError{status: http.StatusBadRequest, msg: ve.msg, code: ErrCodeValidationFailed}
+	}
+	return &batchError{status: http.StatusInternalServerError, msg: "Internal server error"}
+}
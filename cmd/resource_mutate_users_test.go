@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func countUsers(t *testing.T, db *SQLiteAdapter) int {
+	t.Helper()
+	_, total, err := db.QueryRows(context.Background(), "users", QueryOptions{Page: 1, PerPage: 1})
+	if err != nil {
+		t.Fatalf("QueryRows: %v", err)
+	}
+	return total
+}
+
+func newUserItem(name string) map[string]any {
+	return map[string]any{"username": name, "email": name + "@example.com", "password": "BatchPass1", "role": "user"}
+}
+
+func TestUsersMutate_AtomicCreate(t *testing.T) {
+	h, db, _ := setupMutateTest(t)
+	before := countUsers(t, db)
+
+	bad := newUserItem("bob")
+	bad["email"] = "nope"
+	w := doMutateRequest(t, h, "users", map[string]any{"op": "create", "mode": "atomic", "data": []any{newUserItem("ada"), bad}}, adminIdentity())
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "Item 2: Invalid email address") {
+		t.Fatalf("expected 400 naming item 2, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := countUsers(t, db); got != before {
+		t.Fatalf("expected no users created, got %d more", got-before)
+	}
+
+	// A duplicate within the request fails the transaction.
+	w = doMutateRequest(t, h, "users", map[string]any{"op": "create", "mode": "atomic", "data": []any{newUserItem("ada"), newUserItem("ada")}}, adminIdentity())
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "Item 2:") {
+		t.Fatalf("expected 409 naming item 2, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := countUsers(t, db); got != before {
+		t.Fatalf("expected the transaction to roll back, got %d more users", got-before)
+	}
+
+	w = doMutateRequest(t, h, "users", map[string]any{"op": "create", "mode": "atomic", "data": []any{newUserItem("ada"), newUserItem("bob")}}, adminIdentity())
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	body := decodeResponse(t, w)
+	if meta := body["meta"].(map[string]any); meta["success"] != float64(2) || meta["failed"] != float64(0) {
+		t.Errorf("unexpected meta %v", meta)
+	}
+	if user := body["data"].([]any)[0].(map[string]any); user["username"] != "ada" || user["password_hash"] != nil {
+		t.Errorf("unexpected record %v", user)
+	}
+}
+
+func TestUsersMutate_BestEffort(t *testing.T) {
+	h, db, _ := setupMutateTest(t)
+	before := countUsers(t, db)
+
+	bad := newUserItem("bob")
+	bad["role"] = "owner"
+	w := doMutateRequest(t, h, "users", map[string]any{"op": "create", "mode": "best_effort", "data": []any{
+		newUserItem("ada"), bad, newUserItem("cy"), newUserItem("ada"),
+	}}, adminIdentity())
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	body := decodeResponse(t, w)
+	if meta := body["meta"].(map[string]any); meta["success"] != float64(2) || meta["failed"] != float64(2) {
+		t.Errorf("unexpected meta %v", meta)
+	}
+	if got := countUsers(t, db); got != before+2 {
+		t.Fatalf("expected 2 users created, got %d", got-before)
+	}
+
+	var ids []any
+	for _, u := range body["data"].([]any) {
+		ids = append(ids, map[string]any{"id": u.(map[string]any)["id"], "can_write": true})
+	}
+	ids = append(ids, map[string]any{"id": "missing", "can_write": true})
+	w = doMutateRequest(t, h, "users", map[string]any{"op": "update", "mode": "best_effort", "data": ids}, adminIdentity())
+	body = decodeResponse(t, w)
+	if meta := body["meta"].(map[string]any); w.Code != http.StatusOK || meta["success"] != float64(2) || meta["failed"] != float64(1) {
+		t.Fatalf("unexpected update result %d: %v", w.Code, body)
+	}
+	if user := body["data"].([]any)[0].(map[string]any); user["can_write"] != true {
+		t.Errorf("expected can_write to be updated, got %v", user)
+	}
+}
+
+func TestUsersMutate_AtomicDestroy(t *testing.T) {
+	h, db, _ := setupMutateTest(t)
+	admin := seedAdminUser(t, db)
+	w := doMutateRequest(t, h, "users", map[string]any{"op": "create", "data": []any{newUserItem("ada")}}, adminIdentity())
+	ada := decodeResponse(t, w)["data"].([]any)[0].(map[string]any)["id"]
+	before := countUsers(t, db)
+
+	w = doMutateRequest(t, h, "users", map[string]any{"op": "destroy", "mode": "atomic", "data": []any{
+		map[string]any{"id": ada}, map[string]any{"id": "missing"},
+	}}, adminIdentity())
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "Item 2:") {
+		t.Fatalf("expected 404 naming item 2, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := countUsers(t, db); got != before {
+		t.Fatal("expected nothing to be destroyed")
+	}
+
+	w = doMutateRequest(t, h, "users", map[string]any{"op": "destroy", "mode": "atomic", "data": []any{
+		map[string]any{"id": ada}, map[string]any{"id": admin},
+	}}, adminIdentity())
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected the last admin to be protected, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = doMutateRequest(t, h, "users", map[string]any{"op": "destroy", "mode": "atomic", "data": []any{map[string]any{"id": ada}}}, adminIdentity())
+	if w.Code != http.StatusOK || countUsers(t, db) != before-1 {
+		t.Fatalf("expected destroy to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestUsersMutate_ModeErrors(t *testing.T) {
+	h, _, _ := setupMutateTest(t)
+	for _, tt := range []struct {
+		resource string
+		body     map[string]any
+		want     string
+	}{
+		{"products", map[string]any{"op": "create", "mode": "atomic", "data": []any{map[string]any{"title": "x"}}}, "applies only to"},
+		{"users", map[string]any{"op": "action", "action": "unlock", "mode": "atomic", "data": []any{map[string]any{"id": "x"}}}, "applies only to"},
+		{"users", map[string]any{"op": "create", "mode": "some", "data": []any{newUserItem("ada")}}, "Invalid mode"},
+	} {
+		w := doMutateRequest(t, h, tt.resource, tt.body, adminIdentity())
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.want) {
+			t.Errorf("expected 400 with %q, got %d: %s", tt.want, w.Code, w.Body.String())
+		}
+	}
+}
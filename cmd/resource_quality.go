@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ResourceQualityHandler implements GET /data/{resource}:quality, which
+// checks every record of a collection against data-quality rules given in
+// the query and reports a score with the violating records. Rules are
+// evaluated on request; clients that track quality over time call it on
+// their own schedule.
+type ResourceQualityHandler struct {
+	db       DatabaseAdapter
+	registry *SchemaRegistry
+}
+
+// NewResourceQualityHandler creates a ResourceQualityHandler with the given dependencies.
+func NewResourceQualityHandler(db DatabaseAdapter, registry *SchemaRegistry) *ResourceQualityHandler {
+	return &ResourceQualityHandler{db: db, registry: registry}
+}
+
+// knownQualityParams lists the recognized top-level query parameters for
+// the quality endpoint. Filter parameters (field[op]) are also accepted.
+var knownQualityParams = map[string]bool{
+	"required": true,
+	"pattern":  true,
+	"ref":      true,
+}
+
+// qualityRule is one check applied to every record.
+type qualityRule struct {
+	Rule   string `json:"rule"` // "required", "pattern", or "ref"
+	Field  string `json:"field"`
+	Target string `json:"target,omitempty"` // the pattern or referenced collection
+
+	re *regexp.Regexp
+}
+
+// qualityResult is the JSON representation of one rule's outcome.
+type qualityResult struct {
+	qualityRule
+	Passed     int      `json:"passed"`
+	Failed     int      `json:"failed"`
+	Violations []string `json:"violations"`
+}
+
+// HandleQuality handles GET /data/{resource}:quality requests.
+func (h *ResourceQualityHandler) HandleQuality(w http.ResponseWriter, r *http.Request) {
+	identity, ok := GetAuthIdentity(r.Context())
+	if !ok || identity.Role != "admin" {
+		WriteError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	resource := extractResource(r.URL.Path)
+	if resource == "" {
+		WriteError(w, http.StatusBadRequest, "Missing resource name")
+		return
+	}
+	col, ok := h.registry.Get(resource)
+	if !ok {
+		WriteError(w, http.StatusNotFound, fmt.Sprintf("Resource '%s' not found", resource))
+		return
+	}
+	if col.System {
+		WriteError(w, http.StatusBadRequest, fmt.Sprintf("Quality checks are not supported for '%s'", resource))
+		return
+	}
+
+	q := r.URL.Query()
+	rules, err := h.parseQualityRules(q, col)
+	if err != nil {
+		WriteErrorFrom(w, http.StatusBadRequest, err)
+		return
+	}
+	filters, err := parseFilterParams(q, col)
+	if err != nil {
+		WriteErrorFrom(w, http.StatusBadRequest, err)
+		return
+	}
+
+	results, records, err := h.evaluate(r.Context(), resource, rules, filters)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	data := make([]any, len(results))
+	passed, checks := 0, 0
+	for i, res := range results {
+		data[i] = res
+		passed += res.Passed
+		checks += res.Passed + res.Failed
+	}
+	score := 1.0
+	if checks > 0 {
+		score = math.Round(float64(passed)/float64(checks)*10000) / 10000
+	}
+	meta := map[string]any{"records": records, "checks": checks, "score": score}
+	WriteSuccessFull(w, http.StatusOK, "Quality report retrieved successfully", data, meta, nil)
+}
+
+// parseQualityRules validates the quality query parameters. required is a
+// comma-separated field list; each pattern is field:regexp and each ref is
+// field:collection.
+func (h *ResourceQualityHandler) parseQualityRules(q url.Values, col *Collection) ([]qualityRule, error) {
+	for key := range q {
+		if !knownQualityParams[key] && !filterParamPattern.MatchString(key) {
+			return nil, fmt.Errorf("Unknown query parameter %q", key)
+		}
+	}
+	fieldMap := buildFieldMap(col)
+
+	var rules []qualityRule
+	for _, v := range q["required"] {
+		for _, name := range strings.Split(v, ",") {
+			if _, ok := fieldMap[name]; !ok {
+				return nil, fmt.Errorf("Unknown field %q", name)
+			}
+			rules = append(rules, qualityRule{Rule: "required", Field: name})
+		}
+	}
+	for _, v := range q["pattern"] {
+		name, expr, _ := strings.Cut(v, ":")
+		f, ok := fieldMap[name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown field %q", name)
+		}
+		if f.Type != MoonFieldTypeString {
+			return nil, fmt.Errorf("Field %q must be a string field for pattern", name)
+		}
+		if expr == "" || len(expr) > MaxQualityPatternLen {
+			return nil, fmt.Errorf("Pattern for field %q must be 1 to %d characters", name, MaxQualityPatternLen)
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid pattern for field %q", name)
+		}
+		rules = append(rules, qualityRule{Rule: "pattern", Field: name, Target: expr, re: re})
+	}
+	for _, v := range q["ref"] {
+		name, target, _ := strings.Cut(v, ":")
+		if _, ok := fieldMap[name]; !ok {
+			return nil, fmt.Errorf("Unknown field %q", name)
+		}
+		if tc, ok := h.registry.Get(target); !ok || tc.System {
+			return nil, fmt.Errorf("Collection '%s' not found", target)
+		}
+		rules = append(rules, qualityRule{Rule: "ref", Field: name, Target: target})
+	}
+
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("At least one of required, pattern, or ref is required")
+	}
+	if len(rules) > MaxQualityRules {
+		return nil, fmt.Errorf("At most %d rules are allowed", MaxQualityRules)
+	}
+	return rules, nil
+}
+
+// evaluate applies rules to every record of table matching filters, in id
+// order, and returns each rule's outcome with the number of records read.
+// Null values fail only required; pattern and ref pass them.
+func (h *ResourceQualityHandler) evaluate(ctx context.Context, table string, rules []qualityRule, filters []Filter) ([]qualityResult, int, error) {
+	results := make([]qualityResult, len(rules))
+	for i, rule := range rules {
+		results[i] = qualityResult{qualityRule: rule, Violations: []string{}}
+	}
+	fail := func(res *qualityResult, id string) {
+		res.Failed++
+		if len(res.Violations) < MaxQualityViolations {
+			res.Violations = append(res.Violations, id)
+		}
+	}
+
+	records, after := 0, ""
+	for {
+		page := filters
+		if after != "" {
+			page = append(append([]Filter{}, filters...), Filter{Field: "id", Op: "gt", Value: after})
+		}
+		rows, _, err := h.db.QueryRows(ctx, table, QueryOptions{
+			Filters: page,
+			Sort:    []SortField{{Field: "id"}},
+			Page:    1,
+			PerPage: MaxPerPage,
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+		records += len(rows)
+
+		for i := range results {
+			res := &results[i]
+			var existing map[string]bool
+			if res.Rule == "ref" {
+				if existing, err = h.existingIDs(ctx, res.Target, rows, res.Field); err != nil {
+					return nil, 0, err
+				}
+			}
+			for _, row := range rows {
+				id, value := stringVal(row, "id"), row[res.Field]
+				ok := true
+				switch res.Rule {
+				case "required":
+					s, isString := value.(string)
+					ok = value != nil && (!isString || strings.TrimSpace(s) != "")
+				case "pattern":
+					s, isString := value.(string)
+					ok = !isString || res.re.MatchString(s)
+				case "ref":
+					ok = value == nil || existing[fmt.Sprint(value)]
+				}
+				if ok {
+					res.Passed++
+				} else {
+					fail(res, id)
+				}
+			}
+		}
+
+		if len(rows) < MaxPerPage {
+			return results, records, nil
+		}
+		after = stringVal(rows[len(rows)-1], "id")
+	}
+}
+
+// existingIDs returns which of the non-null field values in rows are ids
+// of records in target.
+func (h *ResourceQualityHandler) existingIDs(ctx context.Context, target string, rows []map[string]any, field string) (map[string]bool, error) {
+	seen := make(map[string]bool)
+	var values []string
+	for _, row := range rows {
+		if v := row[field]; v != nil && !seen[fmt.Sprint(v)] {
+			seen[fmt.Sprint(v)] = true
+			values = append(values, fmt.Sprint(v))
+		}
+	}
+	existing := make(map[string]bool, len(values))
+	if len(values) == 0 {
+		return existing, nil
+	}
+	found, _, err := h.db.QueryRows(ctx, target, QueryOptions{
+		Filters: []Filter{{Field: "id", Op: "in", Value: values}},
+		Fields:  []string{"id"},
+		Page:    1,
+		PerPage: len(values),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range found {
+		existing[stringVal(row, "id")] = true
+	}
+	return existing, nil
+}
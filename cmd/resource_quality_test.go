@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func doQualityRequest(h *ResourceQualityHandler, resource, query string, identity *AuthIdentity) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/data/"+resource+":quality?"+query, nil)
+	req = req.WithContext(SetAuthIdentity(context.Background(), identity))
+	w := httptest.NewRecorder()
+	h.HandleQuality(w, req)
+	return w
+}
+
+func TestResourceQuality(t *testing.T) {
+	_, adapter, registry := setupResourceQueryTest(t)
+	seedProducts(t, adapter)
+	ctx := context.Background()
+	if err := adapter.ExecDDL(ctx, `CREATE TABLE orders (id TEXT PRIMARY KEY, product_id TEXT, code TEXT)`); err != nil {
+		t.Fatalf("ExecDDL orders: %v", err)
+	}
+	for _, o := range []map[string]any{
+		{"id": "O1", "product_id": "01J0001", "code": "ORD-001"},
+		{"id": "O2", "product_id": "01J9999", "code": "ord-2"},
+		{"id": "O3", "product_id": nil, "code": "  "},
+	} {
+		if err := adapter.InsertRow(ctx, "orders", o); err != nil {
+			t.Fatalf("InsertRow orders: %v", err)
+		}
+	}
+	if err := registry.Refresh(); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	h := NewResourceQualityHandler(adapter, registry)
+	admin := adminIdentity()
+
+	w := doQualityRequest(h, "orders", url.Values{
+		"required": {"product_id,code"},
+		"pattern":  {`code:^ORD-\d{3}$`},
+		"ref":      {"product_id:products"},
+	}.Encode(), admin)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	resp := decodeResponse(t, w)
+	want := []struct {
+		rule       string
+		passed     float64
+		violations []string
+	}{
+		{"required", 2, []string{"O3"}},      // product_id
+		{"required", 2, []string{"O3"}},      // code (blank)
+		{"pattern", 1, []string{"O2", "O3"}}, // code
+		{"ref", 2, []string{"O2"}},           // product_id; null passes
+	}
+	data := resp["data"].([]any)
+	if len(data) != len(want) {
+		t.Fatalf("expected %d results, got %v", len(want), data)
+	}
+	for i, tt := range want {
+		res := data[i].(map[string]any)
+		violations := res["violations"].([]any)
+		if res["rule"] != tt.rule || res["passed"] != tt.passed || len(violations) != len(tt.violations) {
+			t.Errorf("result %d: got %v", i, res)
+			continue
+		}
+		for j, id := range tt.violations {
+			if violations[j] != id {
+				t.Errorf("result %d: expected violations %v, got %v", i, tt.violations, violations)
+			}
+		}
+	}
+	meta := resp["meta"].(map[string]any)
+	if meta["records"] != float64(3) || meta["checks"] != float64(12) || meta["score"] != 0.5833 {
+		t.Errorf("unexpected meta: %v", meta)
+	}
+
+	// Filters narrow the records checked.
+	w = doQualityRequest(h, "products", "required=description&active[eq]=1", admin)
+	meta = decodeResponse(t, w)["meta"].(map[string]any)
+	if meta["records"] != float64(4) || meta["score"] != 0.75 {
+		t.Errorf("unexpected filtered meta: %v", meta)
+	}
+}
+
+func TestResourceQuality_Errors(t *testing.T) {
+	_, adapter, registry := setupResourceQueryTest(t)
+	h := NewResourceQualityHandler(adapter, registry)
+	admin := adminIdentity()
+
+	for _, tt := range []struct {
+		resource, query string
+		want            int
+	}{
+		{"products", "", http.StatusBadRequest},
+		{"products", "required=nope", http.StatusBadRequest},
+		{"products", "pattern=price:^1", http.StatusBadRequest},
+		{"products", "pattern=title:(", http.StatusBadRequest},
+		{"products", "pattern=title", http.StatusBadRequest},
+		{"products", "ref=title:missing", http.StatusBadRequest},
+		{"products", "required=title&limit=5", http.StatusBadRequest},
+		{"missing", "required=title", http.StatusNotFound},
+		{"users", "pattern=password_hash:^x", http.StatusBadRequest},
+		{"products", "required=title", http.StatusOK},
+	} {
+		if w := doQualityRequest(h, tt.resource, tt.query, admin); w.Code != tt.want {
+			t.Errorf("%s?%s: expected %d, got %d: %s", tt.resource, tt.query, tt.want, w.Code, w.Body.String())
+		}
+	}
+
+	user := &AuthIdentity{CallerID: "u1", Role: "user"}
+	if w := doQualityRequest(h, "products", "required=title", user); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a non-admin, got %d", w.Code)
+	}
+}
@@ -4,12 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"math"
 	"net/http"
 	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // ResourceQueryHandler implements GET /data/{resource}:query.
@@ -47,7 +47,7 @@ func (h *ResourceQueryHandler) HandleQuery(w http.ResponseWriter, r *http.Reques
 	q := r.URL.Query()
 
 	if err := h.validateQueryParams(q, col); err != nil {
-		WriteError(w, http.StatusBadRequest, err.Error())
+		WriteErrorFrom(w, http.StatusBadRequest, err)
 		return
 	}
 
@@ -62,14 +62,14 @@ func (h *ResourceQueryHandler) HandleQuery(w http.ResponseWriter, r *http.Reques
 // Get-one mode
 // ---------------------------------------------------------------------------
 
-func (h *ResourceQueryHandler) handleGetOne(w http.ResponseWriter, _ *http.Request, resource string, col *Collection, id string) {
+func (h *ResourceQueryHandler) handleGetOne(w http.ResponseWriter, r *http.Request, resource string, col *Collection, id string) {
 	opts := QueryOptions{
-		Filters: []Filter{{Field: "id", Op: "eq", Value: id}},
+		Filters: append([]Filter{{Field: "id", Op: "eq", Value: id}}, ownerFilters(r, col)...),
 		Page:    1,
 		PerPage: 1,
 	}
 
-	rows, _, err := h.db.QueryRows(context.Background(), resource, opts)
+	rows, _, err := h.db.QueryRows(readContext(r), resource, opts)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, "Internal server error")
 		return
@@ -82,6 +82,9 @@ func (h *ResourceQueryHandler) handleGetOne(w http.ResponseWriter, _ *http.Reque
 	record := formatRecord(rows[0], col)
 	record = filterHiddenFields(resource, record)
 
+	if writeNotModified(w, r, valueETag(record)) {
+		return
+	}
 	WriteSuccess(w, http.StatusOK, "Resource retrieved successfully", []any{record})
 }
 
@@ -93,26 +96,32 @@ func (h *ResourceQueryHandler) handleList(w http.ResponseWriter, r *http.Request
 	q := r.URL.Query()
 	page, perPage := parsePagination(r)
 
+	cursorMode := q.Has("after") || q.Has("before")
+	if cursorMode {
+		if err := validateCursorParams(q); err != nil {
+			WriteErrorFrom(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
 	opts := QueryOptions{
 		Page:    page,
 		PerPage: perPage,
 	}
 
 	// Sort
-	if sortParam := q.Get("sort"); sortParam != "" {
-		sortFields, err := parseSortParam(sortParam, col)
-		if err != nil {
-			WriteError(w, http.StatusBadRequest, err.Error())
-			return
-		}
-		opts.Sort = sortFields
+	sortFields, err := parseSortQuery(q, col)
+	if err != nil {
+		WriteErrorFrom(w, http.StatusBadRequest, err)
+		return
 	}
+	opts.Sort = sortFields
 
 	// Fields projection
 	if fieldsParam := q.Get("fields"); fieldsParam != "" {
 		projFields, err := parseFieldsParam(fieldsParam, col)
 		if err != nil {
-			WriteError(w, http.StatusBadRequest, err.Error())
+			WriteErrorFrom(w, http.StatusBadRequest, err)
 			return
 		}
 		opts.Fields = projFields
@@ -127,41 +136,130 @@ func (h *ResourceQueryHandler) handleList(w http.ResponseWriter, r *http.Request
 	// Filters
 	filters, err := parseFilterParams(q, col)
 	if err != nil {
-		WriteError(w, http.StatusBadRequest, err.Error())
+		WriteErrorFrom(w, http.StatusBadRequest, err)
+		return
+	}
+	opts.Filters = append(filters, ownerFilters(r, col)...)
+
+	// ?expired=true on apikeys lists only the keys past their expires_at.
+	if q.Has("expired") {
+		if q.Get("expired") != "true" {
+			WriteError(w, http.StatusBadRequest, "Parameter expired must be true")
+			return
+		}
+		opts.Filters = append(opts.Filters, expiredAPIKeyFilters(time.Now())...)
+	}
+
+	if cursorMode {
+		h.handleCursorList(w, r, resource, col, q, opts)
+		return
+	}
+
+	// Records are written as they are scanned, so a large page is never
+	// held in memory.
+	stream := newListStream(w, r, "Resources retrieved successfully")
+	total, err := streamRows(readContext(r), h.db, resource, opts, func(row map[string]any) error {
+		return stream.add(filterHiddenFields(resource, formatRecord(row, col)))
+	})
+	if err != nil {
+		stream.fail()
 		return
 	}
-	opts.Filters = filters
 
-	rows, total, err := h.db.QueryRows(context.Background(), resource, opts)
+	basePath := fmt.Sprintf("%s/data/%s:query", h.prefix, resource)
+	meta, links := buildPagination(basePath, q, total, stream.count, page, perPage)
+	stream.finish(meta, links)
+}
+
+// handleCursorList serves list mode with an after or before cursor.
+func (h *ResourceQueryHandler) handleCursorList(w http.ResponseWriter, r *http.Request, resource string, col *Collection, q url.Values, opts QueryOptions) {
+	rows, prev, next, err := queryCursorPage(readContext(r), h.db, resource, q, opts)
 	if err != nil {
 		WriteError(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
-	data := make([]any, 0, len(rows))
+	// The cursors depend on the whole page, so it is read first and only
+	// the encoding is streamed.
+	stream := newListStream(w, r, "Resources retrieved successfully")
 	for _, row := range rows {
-		record := formatRecord(row, col)
-		record = filterHiddenFields(resource, record)
-		data = append(data, record)
+		if err := stream.add(filterHiddenFields(resource, formatRecord(row, col))); err != nil {
+			return
+		}
 	}
 
-	totalPages := 1
-	if total > 0 {
-		totalPages = int(math.Ceil(float64(total) / float64(perPage)))
+	basePath := fmt.Sprintf("%s/data/%s:query", h.prefix, resource)
+	meta, links := buildCursorPagination(basePath, q, stream.count, opts.PerPage, prev, next)
+	stream.finish(meta, links)
+}
+
+// queryCursorPage reads one cursor page of table. Rows are ordered by id,
+// which is a ULID and so follows creation order. after returns the rows
+// following the cursor id and before the rows preceding it, both in
+// ascending order; an empty cursor starts at the first or last page. The
+// cursor id is exclusive and need not exist. prev and next are the cursors
+// of the neighbouring pages, or "" when there is none. opts supplies the
+// filters and page size.
+func queryCursorPage(ctx context.Context, db DatabaseAdapter, table string, q url.Values, opts QueryOptions) (rows []map[string]any, prev, next string, err error) {
+	base := opts.Filters
+	withID := func(op, id string) []Filter {
+		return append(append([]Filter{}, base...), Filter{Field: "id", Op: op, Value: id})
 	}
 
-	meta := map[string]any{
-		"total":        total,
-		"count":        len(data),
-		"per_page":     perPage,
-		"current_page": page,
-		"total_pages":  totalPages,
+	backward := q.Has("before")
+	opts.Page = 1
+	opts.Sort = []SortField{{Field: "id", Desc: backward}}
+	if cursor := q.Get("after"); !backward && cursor != "" {
+		opts.Filters = withID("gt", cursor)
+	}
+	if cursor := q.Get("before"); backward && cursor != "" {
+		opts.Filters = withID("lt", cursor)
 	}
 
-	basePath := fmt.Sprintf("%s/data/%s:query", h.prefix, resource)
-	links := buildResourcePaginationLinks(basePath, page, perPage, totalPages, q)
+	rows, total, err := db.QueryRows(ctx, table, opts)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if backward {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
 
-	WriteSuccessFull(w, http.StatusOK, "Resources retrieved successfully", data, meta, links)
+	// The query in the paging direction reports whether more rows follow;
+	// the opposite direction needs a one-row probe.
+	if len(rows) > 0 {
+		first, _ := rows[0]["id"].(string)
+		last, _ := rows[len(rows)-1]["id"].(string)
+		more := total > len(rows)
+		// The probe keeps the page's filters and search, so it only finds
+		// rows the page could have listed.
+		probe := func(op, id string) bool {
+			p := opts
+			p.Filters = withID(op, id)
+			p.Sort = nil
+			p.Fields = []string{"id"}
+			p.PerPage = 1
+			_, n, err := db.QueryRows(ctx, table, p)
+			return err == nil && n > 0
+		}
+		if backward {
+			if more {
+				prev = first
+			}
+			if probe("gt", last) {
+				next = last
+			}
+		} else {
+			if more {
+				next = last
+			}
+			if probe("lt", first) {
+				prev = first
+			}
+		}
+	}
+	return rows, prev, next, nil
 }
 
 // ---------------------------------------------------------------------------
@@ -176,10 +274,27 @@ var knownQueryParams = map[string]bool{
 	"q":        true,
 	"fields":   true,
 	"id":       true,
+	"nulls":    true,
+	"after":    true,
+	"before":   true,
+}
+
+// validateCursorParams rejects parameters that conflict with cursor
+// pagination. Cursor pages are always ordered by id.
+func validateCursorParams(q url.Values) error {
+	if q.Has("after") && q.Has("before") {
+		return &APIError{Code: ErrCodeCursorInvalid, Message: "Parameters after and before are mutually exclusive"}
+	}
+	for _, key := range []string{"page", "sort"} {
+		if q.Has(key) {
+			return &APIError{Code: ErrCodeCursorInvalid, Message: fmt.Sprintf("Parameter %s cannot be combined with after or before", key)}
+		}
+	}
+	return nil
 }
 
 // filterParamPattern matches filter parameters like field[op].
-var filterParamPattern = regexp.MustCompile(`^([a-z][a-z0-9_]*)\[([a-z]+)\]$`)
+var filterParamPattern = regexp.MustCompile(`^((?:` + regexp.QuoteMeta(FieldAttributes) + `\.)?[a-z][a-z0-9_]*)\[([a-z_]+)\]$`)
 
 // validateQueryParams rejects unknown query parameters.
 func (h *ResourceQueryHandler) validateQueryParams(q url.Values, col *Collection) error {
@@ -190,7 +305,10 @@ func (h *ResourceQueryHandler) validateQueryParams(q url.Values, col *Collection
 		if filterParamPattern.MatchString(key) {
 			continue
 		}
-		return fmt.Errorf("Unknown query parameter %q", key)
+		if key == "expired" && col.Name == "apikeys" {
+			continue
+		}
+		return &APIError{Code: ErrCodeUnknownParameter, Message: fmt.Sprintf("Unknown query parameter %q", key)}
 	}
 	return nil
 }
@@ -199,8 +317,32 @@ func (h *ResourceQueryHandler) validateQueryParams(q url.Values, col *Collection
 // Sort parsing
 // ---------------------------------------------------------------------------
 
+// parseSortQuery reads the sort and nulls parameters together. nulls
+// applies to every sort field and is rejected when no sort is given.
+func parseSortQuery(q url.Values, col *Collection) ([]SortField, error) {
+	nulls := q.Get("nulls")
+	if nulls != "" && nulls != NullsFirst && nulls != NullsLast {
+		return nil, fmt.Errorf("Invalid nulls: must be %s or %s", NullsFirst, NullsLast)
+	}
+	sortParam := q.Get("sort")
+	if sortParam == "" {
+		if nulls != "" {
+			return nil, fmt.Errorf("Parameter nulls requires sort")
+		}
+		return nil, nil
+	}
+	sortFields, err := parseSortParam(sortParam, col)
+	if err != nil {
+		return nil, err
+	}
+	for i := range sortFields {
+		sortFields[i].Nulls = nulls
+	}
+	return sortFields, nil
+}
+
 func parseSortParam(sortParam string, col *Collection) ([]SortField, error) {
-	fieldMap := buildFieldMap(col)
+	fieldMap := buildAPIFieldMap(col)
 	parts := strings.Split(sortParam, ",")
 	result := make([]SortField, 0, len(parts))
 	for _, p := range parts {
@@ -215,7 +357,7 @@ func parseSortParam(sortParam string, col *Collection) ([]SortField, error) {
 			fieldName = p[1:]
 		}
 		if _, ok := fieldMap[fieldName]; !ok {
-			return nil, fmt.Errorf("Unknown sort field %q", fieldName)
+			return nil, fieldError(ErrCodeUnknownField, fieldName, fmt.Sprintf("Unknown sort field %q", fieldName))
 		}
 		result = append(result, SortField{Field: fieldName, Desc: desc})
 	}
@@ -227,7 +369,7 @@ func parseSortParam(sortParam string, col *Collection) ([]SortField, error) {
 // ---------------------------------------------------------------------------
 
 func parseFieldsParam(fieldsParam string, col *Collection) ([]string, error) {
-	fieldMap := buildFieldMap(col)
+	fieldMap := buildAPIFieldMap(col)
 	parts := strings.Split(fieldsParam, ",")
 	seen := make(map[string]bool)
 	result := []string{"id"}
@@ -238,7 +380,7 @@ func parseFieldsParam(fieldsParam string, col *Collection) ([]string, error) {
 			continue
 		}
 		if _, ok := fieldMap[p]; !ok {
-			return nil, fmt.Errorf("Unknown field %q", p)
+			return nil, fieldError(ErrCodeUnknownField, p, fmt.Sprintf("Unknown field %q", p))
 		}
 		if !seen[p] {
 			result = append(result, p)
@@ -256,12 +398,13 @@ func parseFieldsParam(fieldsParam string, col *Collection) ([]string, error) {
 var validFilterOps = map[string]bool{
 	"eq": true, "ne": true, "gt": true, "lt": true,
 	"gte": true, "lte": true, "like": true, "in": true,
+	"ieq": true, "ilike": true, "is_null": true, "not_null": true,
 }
 
 // opsForType maps Moon field types to the set of valid filter operators.
 var opsForType = map[string]map[string]bool{
-	MoonFieldTypeID:       {"eq": true, "ne": true, "in": true},
-	MoonFieldTypeString:   {"eq": true, "ne": true, "like": true, "in": true},
+	MoonFieldTypeID:       {"eq": true, "ne": true, "in": true, "gt": true, "lt": true},
+	MoonFieldTypeString:   {"eq": true, "ne": true, "like": true, "in": true, "ieq": true, "ilike": true},
 	MoonFieldTypeInteger:  {"eq": true, "ne": true, "gt": true, "lt": true, "gte": true, "lte": true, "in": true},
 	MoonFieldTypeDecimal:  {"eq": true, "ne": true, "gt": true, "lt": true, "gte": true, "lte": true, "in": true},
 	MoonFieldTypeDatetime: {"eq": true, "ne": true, "gt": true, "lt": true, "gte": true, "lte": true, "in": true},
@@ -269,8 +412,29 @@ var opsForType = map[string]map[string]bool{
 	MoonFieldTypeJSON:     {"eq": true, "ne": true},
 }
 
+// ownerFilters returns the filter that limits a non-admin caller to its own
+// rows of an owned collection, or nil when no restriction applies.
+func ownerFilters(r *http.Request, col *Collection) []Filter {
+	identity, ok := GetAuthIdentity(r.Context())
+	if !ok || identity.Role == "admin" || !isOwnedCollection(col) {
+		return nil
+	}
+	return []Filter{{Field: FieldOwnerID, Op: "eq", Value: identity.OwnerID()}}
+}
+
+// callerID returns the authenticated caller's owner id, or "" without one.
+func callerID(r *http.Request) string {
+	if identity, ok := GetAuthIdentity(r.Context()); ok {
+		return identity.OwnerID()
+	}
+	return ""
+}
+
+// nullFilterOps are valid for fields of every type.
+var nullFilterOps = map[string]bool{"is_null": true, "not_null": true}
+
 func parseFilterParams(q url.Values, col *Collection) ([]Filter, error) {
-	fieldMap := buildFieldMap(col)
+	fieldMap := buildAPIFieldMap(col)
 	var filters []Filter
 
 	for key, values := range q {
@@ -285,25 +449,61 @@ func parseFilterParams(q url.Values, col *Collection) ([]Filter, error) {
 			return nil, fmt.Errorf("Unknown filter operator %q", op)
 		}
 
+		if name, ok := strings.CutPrefix(fieldName, FieldAttributes+"."); ok {
+			af, err := attributeFilter(col, name, op, values[0])
+			if err != nil {
+				return nil, err
+			}
+			filters = append(filters, af)
+			continue
+		}
+
 		f, ok := fieldMap[fieldName]
 		if !ok {
-			return nil, fmt.Errorf("Unknown filter field %q", fieldName)
+			return nil, fieldError(ErrCodeUnknownField, fieldName, fmt.Sprintf("Unknown filter field %q", fieldName))
 		}
 
 		allowed := opsForType[f.Type]
-		if !allowed[op] {
+		if !allowed[op] && !nullFilterOps[op] {
 			return nil, fmt.Errorf("Operator %q is not valid for field %q of type %q", op, fieldName, f.Type)
 		}
 
 		value := values[0]
 
+		if op == "is_null" || op == "not_null" {
+			if value != "" && value != "true" {
+				return nil, fmt.Errorf("Operator %q takes no value", op)
+			}
+			filters = append(filters, Filter{Field: fieldName, Op: op})
+			continue
+		}
+
+		if f.Type == MoonFieldTypeDecimal {
+			df, err := decimalFilter(fieldName, op, value)
+			if err != nil {
+				return nil, err
+			}
+			filters = append(filters, df)
+			continue
+		}
+
+		// Booleans are stored as 0 or 1, so compare against the stored form.
+		if f.Type == MoonFieldTypeBoolean {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid boolean value %q for field %q", value, fieldName)
+			}
+			filters = append(filters, Filter{Field: fieldName, Op: op, Value: boolToInt(b)})
+			continue
+		}
+
 		if op == "in" {
 			inValues := strings.Split(value, ",")
 			filters = append(filters, Filter{Field: fieldName, Op: "in", Value: inValues})
 		} else if op == "ne" {
 			filters = append(filters, Filter{Field: fieldName, Op: "ne", Value: value})
-		} else if op == "like" {
-			filters = append(filters, Filter{Field: fieldName, Op: "like", Value: "%" + value + "%"})
+		} else if op == "like" || op == "ilike" {
+			filters = append(filters, Filter{Field: fieldName, Op: op, Value: "%" + value + "%"})
 		} else {
 			filters = append(filters, Filter{Field: fieldName, Op: op, Value: value})
 		}
@@ -311,6 +511,95 @@ func parseFilterParams(q url.Values, col *Collection) ([]Filter, error) {
 	return filters, nil
 }
 
+// attributeFilter builds a filter on the flex attribute name of col. The
+// value is converted to the attribute's type, since JSON values compare
+// without column type affinity.
+func attributeFilter(col *Collection, name, op, value string) (Filter, error) {
+	a := findAttribute(col, name)
+	if a == nil {
+		return Filter{}, fieldError(ErrCodeUnknownField, FieldAttributes+"."+name, fmt.Sprintf("Unknown filter field %q", FieldAttributes+"."+name))
+	}
+	if !opsForType[a.Type][op] && !nullFilterOps[op] {
+		return Filter{}, fmt.Errorf("Operator %q is not valid for attribute %q of type %q", op, name, a.Type)
+	}
+	f := Filter{Field: FieldAttributes, Path: name, Op: op}
+	if nullFilterOps[op] {
+		if value != "" && value != "true" {
+			return Filter{}, fmt.Errorf("Operator %q takes no value", op)
+		}
+		return f, nil
+	}
+
+	convert := func(v string) (any, error) {
+		switch a.Type {
+		case MoonFieldTypeInteger:
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid integer value %q for attribute %q", v, name)
+			}
+			return n, nil
+		case MoonFieldTypeBoolean:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid boolean value %q for attribute %q", v, name)
+			}
+			return boolToInt(b), nil
+		}
+		return v, nil
+	}
+	switch op {
+	case "in":
+		var list []any
+		for _, v := range strings.Split(value, ",") {
+			c, err := convert(v)
+			if err != nil {
+				return Filter{}, err
+			}
+			list = append(list, c)
+		}
+		f.Value = list
+	case "like", "ilike":
+		f.Value = "%" + value + "%"
+	default:
+		c, err := convert(value)
+		if err != nil {
+			return Filter{}, err
+		}
+		f.Value = c
+	}
+	return f, nil
+}
+
+// decimalFilter builds a filter on a decimal field. Values must be in
+// decimal form; comparison values are bound as numbers so every adapter
+// compares them numerically rather than as text.
+func decimalFilter(field, op, value string) (Filter, error) {
+	parse := func(v string) (string, error) {
+		canonical, ok := normalizeDecimal(v)
+		if !ok {
+			return "", fmt.Errorf("Invalid decimal value %q for filter field %q", v, field)
+		}
+		return canonical, nil
+	}
+	if op == "in" {
+		parts := strings.Split(value, ",")
+		for i, part := range parts {
+			canonical, err := parse(part)
+			if err != nil {
+				return Filter{}, err
+			}
+			parts[i] = canonical
+		}
+		return Filter{Field: field, Op: op, Value: parts}, nil
+	}
+	canonical, err := parse(value)
+	if err != nil {
+		return Filter{}, err
+	}
+	n, _ := strconv.ParseFloat(canonical, 64)
+	return Filter{Field: field, Op: op, Value: n}, nil
+}
+
 // ---------------------------------------------------------------------------
 // Field helpers
 // ---------------------------------------------------------------------------
@@ -323,9 +612,27 @@ func buildFieldMap(col *Collection) map[string]Field {
 	return m
 }
 
+// buildAPIFieldMap is buildFieldMap without the hidden system fields. Query
+// parameters resolve field names through it, so password_hash and
+// key_hash cannot be sorted, filtered, selected, or searched on.
+func buildAPIFieldMap(col *Collection) map[string]Field {
+	fields := col.APIFields()
+	m := make(map[string]Field, len(fields))
+	for _, f := range fields {
+		m[f.Name] = f
+	}
+	return m
+}
+
+// getStringFields returns the fields the q parameter searches: the
+// systemSearchFields of a system collection, otherwise every visible
+// string field.
 func getStringFields(col *Collection) []string {
+	if fields, ok := systemSearchFields[col.Name]; ok {
+		return fields
+	}
 	var result []string
-	for _, f := range col.Fields {
+	for _, f := range col.APIFields() {
 		if f.Type == MoonFieldTypeString {
 			result = append(result, f.Name)
 		}
@@ -347,6 +654,10 @@ func formatRecord(row map[string]any, col *Collection) map[string]any {
 			result[k] = v
 			continue
 		}
+		if f.Type == MoonFieldTypeDecimal && f.Precision > 0 && v != nil {
+			result[k] = formatDecimal(v, f.Scale)
+			continue
+		}
 		result[k] = convertToMoonType(v, f.Type)
 	}
 	return result
@@ -368,6 +679,9 @@ func convertToMoonType(value any, fieldType string) any {
 	case MoonFieldTypeJSON:
 		return toJSONValue(value)
 	case MoonFieldTypeDatetime:
+		if t, ok := value.(time.Time); ok {
+			return t.UTC().Format(time.RFC3339)
+		}
 		return toString(value)
 	case MoonFieldTypeID:
 		return toString(value)
@@ -463,47 +777,3 @@ func filterHiddenFields(resource string, record map[string]any) map[string]any {
 	}
 	return record
 }
-
-// ---------------------------------------------------------------------------
-// Pagination links with query params
-// ---------------------------------------------------------------------------
-
-// buildResourcePaginationLinks builds pagination links that preserve all
-// active query parameters (sort, filter, q, fields, etc.).
-func buildResourcePaginationLinks(basePath string, page, perPage, totalPages int, q url.Values) map[string]any {
-	linkURL := func(p int) string {
-		params := url.Values{}
-		params.Set("page", strconv.Itoa(p))
-		params.Set("per_page", strconv.Itoa(perPage))
-
-		// Preserve other query params
-		for key, vals := range q {
-			if key == "page" || key == "per_page" {
-				continue
-			}
-			for _, v := range vals {
-				params.Add(key, v)
-			}
-		}
-		return basePath + "?" + params.Encode()
-	}
-
-	links := map[string]any{
-		"first": linkURL(1),
-		"last":  linkURL(totalPages),
-	}
-
-	if page > 1 {
-		links["prev"] = linkURL(page - 1)
-	} else {
-		links["prev"] = nil
-	}
-
-	if page < totalPages {
-		links["next"] = linkURL(page + 1)
-	} else {
-		links["next"] = nil
-	}
-
-	return links
-}
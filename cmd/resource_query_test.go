@@ -58,6 +58,7 @@ func setupResourceQueryTest(t *testing.T) (*ResourceQueryHandler, *SQLiteAdapter
 		email TEXT NOT NULL UNIQUE,
 		password_hash TEXT NOT NULL,
 		role TEXT NOT NULL DEFAULT 'user',
+		can_write BOOLEAN NOT NULL DEFAULT 0,
 		created_at TEXT NOT NULL DEFAULT '',
 		updated_at TEXT NOT NULL DEFAULT '',
 		last_login_at TEXT
@@ -243,6 +244,144 @@ func TestResourceQuery_ListMode_CustomPagination(t *testing.T) {
 	}
 }
 
+func TestResourceQuery_ListMode_Cursor(t *testing.T) {
+	h, adapter, _ := setupResourceQueryTest(t)
+	seedProducts(t, adapter)
+
+	page := func(query string) ([]string, map[string]any, map[string]any) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		h.HandleQuery(w, makeQueryRequest("/data/products:query?"+query))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", query, w.Code, w.Body.String())
+		}
+		resp := decodeRQResponse(t, w)
+		data, _ := resp["data"].([]any)
+		ids := make([]string, 0, len(data))
+		for _, rec := range data {
+			ids = append(ids, rec.(map[string]any)["id"].(string))
+		}
+		return ids, resp["meta"].(map[string]any), resp["links"].(map[string]any)
+	}
+
+	tests := []struct {
+		query      string
+		wantIDs    string
+		prevCursor any
+		nextCursor any
+	}{
+		{"after=&per_page=2", "01J0001,01J0002", nil, "01J0002"},
+		{"after=01J0002&per_page=2", "01J0003,01J0004", "01J0003", "01J0004"},
+		{"after=01J0004&per_page=2", "01J0005", "01J0005", nil},
+		{"before=&per_page=2", "01J0004,01J0005", "01J0004", nil},
+		{"before=01J0004&per_page=2", "01J0002,01J0003", "01J0002", "01J0003"},
+		{"before=01J0002&per_page=2", "01J0001", nil, "01J0001"},
+		{"after=01J0005", "", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			ids, meta, links := page(tt.query)
+			if got := strings.Join(ids, ","); got != tt.wantIDs {
+				t.Fatalf("expected ids %q, got %q", tt.wantIDs, got)
+			}
+			if meta["prev_cursor"] != tt.prevCursor || meta["next_cursor"] != tt.nextCursor {
+				t.Fatalf("expected cursors %v/%v, got %v/%v", tt.prevCursor, tt.nextCursor, meta["prev_cursor"], meta["next_cursor"])
+			}
+			if meta["count"].(float64) != float64(len(ids)) {
+				t.Errorf("expected count=%d, got %v", len(ids), meta["count"])
+			}
+			if (links["next"] == nil) != (tt.nextCursor == nil) || (links["prev"] == nil) != (tt.prevCursor == nil) {
+				t.Errorf("links do not match cursors: %v", links)
+			}
+		})
+	}
+
+	// Following links in both directions walks the same pages.
+	_, _, links := page("after=&per_page=2&active[eq]=1")
+	next := links["next"].(string)
+	if !strings.Contains(next, "after=01J0002") || !strings.Contains(next, "active%5Beq%5D=1") {
+		t.Fatalf("unexpected next link: %s", next)
+	}
+	ids, _, _ := page("after=01J0002&per_page=2&active[eq]=1")
+	if got := strings.Join(ids, ","); got != "01J0004,01J0005" {
+		t.Fatalf("expected filters to apply to cursor pages, got %q", got)
+	}
+
+	// With a search only Gadget and Thingamajig match, so the probes for
+	// the neighbouring pages must not find the rows in between.
+	for _, tt := range []struct {
+		query, wantIDs   string
+		prevCursor, next any
+	}{
+		{"after=&per_page=1&q=ga", "01J0002", nil, "01J0002"},
+		{"after=01J0002&per_page=1&q=ga", "01J0004", "01J0004", nil},
+		{"before=&per_page=1&q=ga", "01J0004", "01J0004", nil},
+	} {
+		ids, meta, _ := page(tt.query)
+		if got := strings.Join(ids, ","); got != tt.wantIDs {
+			t.Errorf("%s: expected ids %q, got %q", tt.query, tt.wantIDs, got)
+		}
+		if meta["prev_cursor"] != tt.prevCursor || meta["next_cursor"] != tt.next {
+			t.Errorf("%s: expected cursors %v/%v, got %v/%v", tt.query, tt.prevCursor, tt.next, meta["prev_cursor"], meta["next_cursor"])
+		}
+	}
+}
+
+func TestResourceQuery_SlowQueryLogCarriesRequestID(t *testing.T) {
+	h, adapter, _ := setupResourceQueryTest(t)
+	seedProducts(t, adapter)
+	var buf bytes.Buffer
+	adapter.logger = NewTestLogger(&buf)
+	adapter.SetSlowQueryThreshold(-1) // every query is slow
+
+	req := makeQueryRequest("/data/products:query?per_page=2")
+	req.Header.Set(RequestIDHeader, "req-slow-1")
+	w := httptest.NewRecorder()
+	requestIDMiddleware(http.HandlerFunc(h.HandleQuery)).ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	logged := 0
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		var entry map[string]any
+		if err := json.Unmarshal(line, &entry); err != nil {
+			t.Fatalf("decode log line %q: %v", line, err)
+		}
+		if entry["msg"] != "slow query" {
+			continue
+		}
+		logged++
+		if entry["request_id"] != "req-slow-1" || entry["table"] != "products" {
+			t.Errorf("expected the slow query logged with the request ID, got %v", entry)
+		}
+	}
+	if logged == 0 {
+		t.Fatalf("expected a slow query log line, got %q", buf.String())
+	}
+}
+
+func TestResourceQuery_ListMode_CursorConflicts(t *testing.T) {
+	h, adapter, _ := setupResourceQueryTest(t)
+	seedProducts(t, adapter)
+
+	for _, query := range []string{
+		"after=01J0001&before=01J0003",
+		"after=01J0001&page=2",
+		"before=01J0003&sort=-price",
+	} {
+		w := httptest.NewRecorder()
+		h.HandleQuery(w, makeQueryRequest("/data/products:query?"+query))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, w.Code)
+		}
+		var got ErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || got.Code != ErrCodeCursorInvalid {
+			t.Errorf("%s: code = %q, want %q", query, got.Code, ErrCodeCursorInvalid)
+		}
+	}
+}
+
 func TestResourceQuery_ListMode_EmptyCollection(t *testing.T) {
 	h, _, _ := setupResourceQueryTest(t)
 
@@ -312,6 +451,35 @@ func TestResourceQuery_GetOne_Found(t *testing.T) {
 	}
 }
 
+func TestResourceQuery_GetOne_ETag(t *testing.T) {
+	h, adapter, _ := setupResourceQueryTest(t)
+	seedProducts(t, adapter)
+
+	w := httptest.NewRecorder()
+	h.HandleQuery(w, makeQueryRequest("/data/products:query?id=01J0001"))
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("expected 200 with an ETag, got %d %q", w.Code, etag)
+	}
+
+	r := makeQueryRequest("/data/products:query?id=01J0001")
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	h.HandleQuery(w, r)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 || w.Header().Get("ETag") != etag {
+		t.Fatalf("expected an empty 304 with the same ETag, got %d %q", w.Code, w.Body.String())
+	}
+
+	if err := adapter.UpdateRow(context.Background(), "products", "01J0001", map[string]any{"title": "Renamed"}); err != nil {
+		t.Fatalf("UpdateRow: %v", err)
+	}
+	w = httptest.NewRecorder()
+	h.HandleQuery(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Fatalf("expected 200 with a new ETag after an update, got %d %q", w.Code, w.Header().Get("ETag"))
+	}
+}
+
 func TestResourceQuery_GetOne_NotFound(t *testing.T) {
 	h, adapter, _ := setupResourceQueryTest(t)
 	seedProducts(t, adapter)
@@ -618,6 +786,108 @@ func TestResourceQuery_Filter_Like(t *testing.T) {
 	}
 }
 
+func TestResourceQuery_Filter_CaseInsensitive(t *testing.T) {
+	h, adapter, _ := setupResourceQueryTest(t)
+	seedProducts(t, adapter)
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"title[eq]=widget", 0},
+		{"title[ieq]=wIDGET", 1},
+		{"title[ilike]=DGET", 2},
+		{"description[ilike]=QUITE", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.HandleQuery(w, makeQueryRequest("/data/products:query?"+tt.query))
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+			}
+			data, _ := decodeRQResponse(t, w)["data"].([]any)
+			if len(data) != tt.want {
+				t.Fatalf("expected %d results, got %d", tt.want, len(data))
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	h.HandleQuery(w, makeQueryRequest("/data/products:query?quantity[ieq]=10"))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for ieq on integer, got %d", w.Code)
+	}
+}
+
+func TestResourceQuery_Filter_NullOperators(t *testing.T) {
+	h, adapter, _ := setupResourceQueryTest(t)
+	seedProducts(t, adapter)
+
+	tests := []struct {
+		query  string
+		status int
+		want   int
+	}{
+		{"description[is_null]=", http.StatusOK, 1},
+		{"description[is_null]=true", http.StatusOK, 1},
+		{"description[not_null]=true", http.StatusOK, 4},
+		{"quantity[is_null]=", http.StatusOK, 0},
+		{"description[is_null]=false", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.HandleQuery(w, makeQueryRequest("/data/products:query?"+tt.query))
+			if w.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			data, _ := decodeRQResponse(t, w)["data"].([]any)
+			if len(data) != tt.want {
+				t.Fatalf("expected %d results, got %d", tt.want, len(data))
+			}
+		})
+	}
+}
+
+func TestResourceQuery_SortNulls(t *testing.T) {
+	h, adapter, _ := setupResourceQueryTest(t)
+	seedProducts(t, adapter)
+
+	tests := []struct {
+		query  string
+		wantID string
+	}{
+		{"sort=description&nulls=first", "01J0004"},
+		{"sort=-description&nulls=first", "01J0004"},
+		{"sort=description&nulls=last", "01J0002"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.HandleQuery(w, makeQueryRequest("/data/products:query?"+tt.query))
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+			}
+			data := decodeRQResponse(t, w)["data"].([]any)
+			if got := data[0].(map[string]any)["id"]; got != tt.wantID {
+				t.Fatalf("expected first id %s, got %v", tt.wantID, got)
+			}
+		})
+	}
+
+	for _, query := range []string{"nulls=first", "sort=description&nulls=middle"} {
+		w := httptest.NewRecorder()
+		h.HandleQuery(w, makeQueryRequest("/data/products:query?"+query))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", query, w.Code)
+		}
+	}
+}
+
 func TestResourceQuery_Filter_In(t *testing.T) {
 	h, adapter, _ := setupResourceQueryTest(t)
 	seedProducts(t, adapter)
@@ -637,6 +907,44 @@ func TestResourceQuery_Filter_In(t *testing.T) {
 	}
 }
 
+func TestResourceQuery_KeysetPagination_DeletedBoundary(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		deleted string
+		want    []string
+	}{
+		{"forward", "sort=id&per_page=2&id[gt]=", "01J0002", []string{"01J0003", "01J0004"}},
+		{"backward", "sort=-id&per_page=2&id[lt]=", "01J0004", []string{"01J0003", "01J0002"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, adapter, _ := setupResourceQueryTest(t)
+			seedProducts(t, adapter)
+
+			// The boundary record is deleted after the previous page was read.
+			if err := adapter.DeleteRow(context.Background(), "products", tt.deleted); err != nil {
+				t.Fatalf("DeleteRow: %v", err)
+			}
+
+			w := httptest.NewRecorder()
+			h.HandleQuery(w, makeQueryRequest("/data/products:query?"+tt.query+tt.deleted))
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+			}
+			data := decodeRQResponse(t, w)["data"].([]any)
+			if len(data) != len(tt.want) {
+				t.Fatalf("expected %d rows, got %d", len(tt.want), len(data))
+			}
+			for i, id := range tt.want {
+				if got := data[i].(map[string]any)["id"]; got != id {
+					t.Errorf("row %d: expected %s, got %v", i, id, got)
+				}
+			}
+		})
+	}
+}
+
 func TestResourceQuery_Filter_InvalidOperatorForType(t *testing.T) {
 	h, adapter, _ := setupResourceQueryTest(t)
 	seedProducts(t, adapter)
@@ -1064,41 +1372,6 @@ func TestResourceQuery_RouterIntegration(t *testing.T) {
 	}
 }
 
-// ---------------------------------------------------------------------------
-// Tests: buildResourcePaginationLinks
-// ---------------------------------------------------------------------------
-
-func TestBuildResourcePaginationLinks(t *testing.T) {
-	q := url.Values{}
-	q.Set("sort", "-title")
-	q.Set("per_page", "2")
-	q.Set("page", "1")
-
-	links := buildResourcePaginationLinks("/data/products:query", 1, 2, 3, q)
-
-	first := links["first"].(string)
-	if !strings.Contains(first, "page=1") {
-		t.Fatalf("first link should have page=1: %s", first)
-	}
-	if !strings.Contains(first, "sort=-title") {
-		t.Fatalf("first link should include sort param: %s", first)
-	}
-
-	last := links["last"].(string)
-	if !strings.Contains(last, "page=3") {
-		t.Fatalf("last link should have page=3: %s", last)
-	}
-
-	if links["prev"] != nil {
-		t.Fatal("prev should be nil on page 1")
-	}
-
-	next := links["next"].(string)
-	if !strings.Contains(next, "page=2") {
-		t.Fatalf("next link should have page=2: %s", next)
-	}
-}
-
 // ---------------------------------------------------------------------------
 // Tests: convertToMoonType
 // ---------------------------------------------------------------------------
@@ -1568,3 +1841,75 @@ func TestConvertToMoonType_AllTypes(t *testing.T) {
 		})
 	}
 }
+
+// ---------------------------------------------------------------------------
+// Tests: users listing
+// ---------------------------------------------------------------------------
+
+func TestResourceQuery_Users_ListParity(t *testing.T) {
+	h, adapter, _ := setupResourceQueryTest(t)
+	seedUsers(t, adapter)
+	for _, u := range []struct {
+		id, username, email string
+		canWrite            int64
+	}{
+		{"U002", "ada", "ada@lovelace.dev", 1},
+		{"U003", "bob", "bob@example.com", 0},
+		{"U004", "cy", "cy@example.com", 1},
+	} {
+		if err := adapter.InsertRow(context.Background(), "users", map[string]any{
+			"id": u.id, "username": u.username, "email": u.email, "password_hash": "$2a$12$fakehash",
+			"role": "user", "can_write": u.canWrite, "created_at": "2024-01-02T00:00:00Z", "updated_at": "2024-01-02T00:00:00Z",
+		}); err != nil {
+			t.Fatalf("InsertRow users: %v", err)
+		}
+	}
+
+	query := func(path string) (int, map[string]any) {
+		w := httptest.NewRecorder()
+		h.HandleQuery(w, makeQueryRequest(path))
+		if w.Code != http.StatusOK {
+			return w.Code, nil
+		}
+		return w.Code, decodeRQResponse(t, w)
+	}
+	usernames := func(resp map[string]any) []string {
+		var names []string
+		data, _ := resp["data"].([]any)
+		for _, rec := range data {
+			names = append(names, rec.(map[string]any)["username"].(string))
+		}
+		return names
+	}
+
+	// q searches username and email only, never the password hash.
+	if _, resp := query("/data/users:query?q=lovelace"); strings.Join(usernames(resp), ",") != "ada" {
+		t.Errorf("expected q to match the email, got %v", usernames(resp))
+	}
+	if _, resp := query("/data/users:query?q=fakehash"); len(usernames(resp)) != 0 {
+		t.Errorf("expected q not to search password_hash, got %v", usernames(resp))
+	}
+
+	_, resp := query("/data/users:query?can_write[eq]=true&sort=-created_at,username&fields=username,email")
+	if got := strings.Join(usernames(resp), ","); got != "ada,cy" {
+		t.Errorf("expected ada,cy, got %s", got)
+	}
+	if meta := resp["meta"].(map[string]any); meta["total"] != float64(2) {
+		t.Errorf("expected total 2, got %v", meta)
+	}
+	if rec := resp["data"].([]any)[0].(map[string]any); rec["role"] != nil || rec["email"] == nil {
+		t.Errorf("expected the projection to apply, got %v", rec)
+	}
+
+	for _, path := range []string{
+		"/data/users:query?sort=password_hash",
+		"/data/users:query?fields=password_hash",
+		"/data/users:query?can_write[eq]=maybe",
+		"/data/users:query?password_hash[like]=$2a%25",
+		"/data/apikeys:query?key_hash[eq]=abc123hash",
+	} {
+		if code, _ := query(path); code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", path, code)
+		}
+	}
+}
@@ -20,17 +20,30 @@ func NewResourceSchemaHandler(registry *SchemaRegistry, prefix string) *Resource
 
 // fieldDescriptor is the JSON representation of a single field in a schema response.
 type fieldDescriptor struct {
-	Name     string `json:"name"`
-	Type     string `json:"type"`
-	Nullable bool   `json:"nullable"`
-	Unique   bool   `json:"unique"`
-	ReadOnly bool   `json:"readonly"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Nullable  bool   `json:"nullable"`
+	Unique    bool   `json:"unique"`
+	ReadOnly  bool   `json:"readonly"`
+	Collation string `json:"collation,omitempty"`
+	Precision *int   `json:"precision,omitempty"`
+	Scale     *int   `json:"scale,omitempty"`
+	FieldRules
+}
+
+// indexDescriptor is the JSON representation of a secondary index.
+type indexDescriptor struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Unique  bool     `json:"unique"`
 }
 
 // schemaObject is the JSON representation of a collection schema.
 type schemaObject struct {
-	Name   string            `json:"name"`
-	Fields []fieldDescriptor `json:"fields"`
+	Name       string            `json:"name"`
+	Fields     []fieldDescriptor `json:"fields"`
+	Indexes    []indexDescriptor `json:"indexes"`
+	Attributes []attributeItem   `json:"attributes,omitempty"`
 }
 
 // HandleSchema handles GET /data/{resource}:schema requests.
@@ -51,18 +64,43 @@ func (h *ResourceSchemaHandler) HandleSchema(w http.ResponseWriter, r *http.Requ
 	descriptors := make([]fieldDescriptor, len(apiFields))
 	for i, f := range apiFields {
 		descriptors[i] = fieldDescriptor{
-			Name:     f.Name,
-			Type:     f.Type,
-			Nullable: f.Nullable,
-			Unique:   f.Unique,
-			ReadOnly: f.ReadOnly,
+			Name:       f.Name,
+			Type:       f.Type,
+			Nullable:   f.Nullable,
+			Unique:     f.Unique,
+			ReadOnly:   f.ReadOnly,
+			Collation:  f.Collation,
+			FieldRules: f.Rules,
+		}
+		if f.Precision > 0 {
+			descriptors[i].Precision, descriptors[i].Scale = &f.Precision, &f.Scale
 		}
 	}
 
 	schema := schemaObject{
-		Name:   col.Name,
-		Fields: descriptors,
+		Name:    col.Name,
+		Fields:  descriptors,
+		Indexes: indexDescriptors(col.Indexes),
+	}
+	if hasAttributes(col) {
+		schema.Attributes = make([]attributeItem, len(col.Attributes))
+		for i, a := range col.Attributes {
+			schema.Attributes[i] = attributeItem{Name: a.Name, Type: a.Type}
+		}
 	}
 
+	if writeNotModified(w, r, valueETag(schema)) {
+		return
+	}
 	WriteSuccess(w, http.StatusOK, "Schema retrieved successfully", []any{schema})
 }
+
+// indexDescriptors converts registry indexes to their JSON form. The
+// result is never nil, so a collection without indexes reports [].
+func indexDescriptors(indexes []IndexInfo) []indexDescriptor {
+	result := make([]indexDescriptor, len(indexes))
+	for i, idx := range indexes {
+		result[i] = indexDescriptor{Name: idx.Name, Columns: idx.Columns, Unique: idx.Unique}
+	}
+	return result
+}
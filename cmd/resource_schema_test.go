@@ -92,6 +92,31 @@ func TestResourceSchemaHandler_HandleSchema(t *testing.T) {
 		}
 	})
 
+	t.Run("etag", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/data/products:schema", nil)
+		w := httptest.NewRecorder()
+		h.HandleSchema(w, req)
+		etag := w.Header().Get("ETag")
+		if etag == "" {
+			t.Fatal("expected an ETag")
+		}
+
+		req.Header.Set("If-None-Match", `"other", `+etag)
+		w = httptest.NewRecorder()
+		h.HandleSchema(w, req)
+		if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Fatalf("got status %d with %d body bytes, want an empty 304", w.Code, w.Body.Len())
+		}
+
+		req = httptest.NewRequest(http.MethodGet, "/api/data/users:schema", nil)
+		req.Header.Set("If-None-Match", etag)
+		w = httptest.NewRecorder()
+		h.HandleSchema(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("got status %d for another schema, want %d", w.Code, http.StatusOK)
+		}
+	})
+
 	t.Run("not_found", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/api/data/nonexistent:schema", nil)
 		w := httptest.NewRecorder()
@@ -0,0 +1,764 @@
+package main
+
+import (
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ResourceStatsHandler implements read-only aggregate endpoints over a
+// resource: GET /data/{resource}:histogram, :timeseries, and :pivot.
+type ResourceStatsHandler struct {
+	db       DatabaseAdapter
+	registry *SchemaRegistry
+	privacy  AggregatePrivacyConfig
+	noiseKey []byte
+}
+
+// NewResourceStatsHandler creates a ResourceStatsHandler with the given
+// dependencies. Until SetNoiseSecret is called, noise is keyed by a random
+// per-process key.
+func NewResourceStatsHandler(db DatabaseAdapter, registry *SchemaRegistry) *ResourceStatsHandler {
+	key := make([]byte, 32)
+	crand.Read(key)
+	return &ResourceStatsHandler{
+		db:       db,
+		registry: registry,
+		privacy: AggregatePrivacyConfig{
+			Epsilon:      DefaultAggregateEpsilon,
+			MinGroupSize: DefaultAggregateMinGroupSize,
+		},
+		noiseKey: key,
+	}
+}
+
+// SetAggregatePrivacy sets the noise and suppression applied for API keys
+// with noisy_aggregates.
+func (h *ResourceStatsHandler) SetAggregatePrivacy(cfg AggregatePrivacyConfig) {
+	h.privacy = cfg
+}
+
+// SetNoiseSecret derives the noise key from jwtSecret, so every instance
+// and every restart adds the same noise to the same query.
+func (h *ResourceStatsHandler) SetNoiseSecret(jwtSecret string) {
+	key := sha256.Sum256([]byte("moon-aggregate-noise\x00" + jwtSecret))
+	h.noiseKey = key[:]
+}
+
+// ---------------------------------------------------------------------------
+// GET /data/{resource}:histogram
+// ---------------------------------------------------------------------------
+
+// knownHistogramParams lists the recognized top-level query parameters for
+// the histogram endpoint. Filter parameters (field[op]) are also accepted.
+var knownHistogramParams = map[string]bool{
+	"field":   true,
+	"buckets": true,
+}
+
+// histogramBucket is the JSON representation of a single histogram bucket.
+type histogramBucket struct {
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+	Count int     `json:"count"`
+}
+
+// histogramObject is the JSON representation of a histogram response item.
+type histogramObject struct {
+	Field       string             `json:"field"`
+	Count       int                `json:"count"`
+	Min         float64            `json:"min"`
+	Max         float64            `json:"max"`
+	Avg         float64            `json:"avg"`
+	Percentiles map[string]float64 `json:"percentiles"`
+	Buckets     []histogramBucket  `json:"buckets"`
+}
+
+// HandleHistogram handles GET /data/{resource}:histogram requests. It
+// returns summary statistics and equal-width bucket counts for one numeric
+// field, optionally restricted by the standard filter parameters.
+func (h *ResourceStatsHandler) HandleHistogram(w http.ResponseWriter, r *http.Request) {
+	resource := extractResource(r.URL.Path)
+	if resource == "" {
+		WriteError(w, http.StatusBadRequest, "Missing resource name")
+		return
+	}
+
+	col, ok := h.registry.Get(resource)
+	if !ok {
+		WriteError(w, http.StatusNotFound, fmt.Sprintf("Resource '%s' not found", resource))
+		return
+	}
+
+	// Bucket bounds, extremes, and percentiles are taken from individual
+	// values, which noise on counts does not hide.
+	if noisyAggregates(r) {
+		WriteError(w, http.StatusForbidden, "Histograms are not available to this API key")
+		return
+	}
+
+	q := r.URL.Query()
+	field, buckets, err := parseHistogramParams(q, col)
+	if err != nil {
+		WriteErrorFrom(w, http.StatusBadRequest, err)
+		return
+	}
+
+	filters, err := parseFilterParams(q, col)
+	if err != nil {
+		WriteErrorFrom(w, http.StatusBadRequest, err)
+		return
+	}
+
+	filters = append(filters, ownerFilters(r, col)...)
+
+	result, err := h.db.NumericHistogram(r.Context(), resource, field, buckets, filters)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	item := histogramObject{
+		Field:       field,
+		Count:       result.Count,
+		Min:         result.Min,
+		Max:         result.Max,
+		Avg:         result.Avg,
+		Percentiles: make(map[string]float64, len(result.Percentiles)),
+		Buckets:     make([]histogramBucket, len(result.Buckets)),
+	}
+	for p, v := range result.Percentiles {
+		item.Percentiles[fmt.Sprintf("p%d", p)] = v
+	}
+	for i, b := range result.Buckets {
+		item.Buckets[i] = histogramBucket{Lower: b.Lower, Upper: b.Upper, Count: b.Count}
+	}
+
+	WriteSuccess(w, http.StatusOK, "Histogram retrieved successfully", []any{item})
+}
+
+// parseHistogramParams validates the histogram query parameters and
+// returns the target field and bucket count.
+func parseHistogramParams(q url.Values, col *Collection) (string, int, error) {
+	for key := range q {
+		if knownHistogramParams[key] || filterParamPattern.MatchString(key) {
+			continue
+		}
+		return "", 0, fmt.Errorf("Unknown query parameter %q", key)
+	}
+
+	field := q.Get("field")
+	if field == "" {
+		return "", 0, fmt.Errorf("Query parameter 'field' is required")
+	}
+	f, ok := buildAPIFieldMap(col)[field]
+	if !ok {
+		return "", 0, fmt.Errorf("Unknown field %q", field)
+	}
+	if f.Type != MoonFieldTypeInteger && f.Type != MoonFieldTypeDecimal {
+		return "", 0, fmt.Errorf("Field %q must be of type integer or decimal", field)
+	}
+
+	buckets := DefaultHistogramBuckets
+	if v := q.Get("buckets"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxHistogramBuckets {
+			return "", 0, fmt.Errorf("Query parameter 'buckets' must be an integer between 1 and %d", MaxHistogramBuckets)
+		}
+		buckets = n
+	}
+
+	return field, buckets, nil
+}
+
+// ---------------------------------------------------------------------------
+// Noisy aggregates
+// ---------------------------------------------------------------------------
+
+// errNoisyCountOnly is returned when a noisy_aggregates API key asks for an
+// aggregate other than count.
+const errNoisyCountOnly = "Only count aggregates are available to this API key"
+
+// noisyAggregates reports whether the caller is an API key marked with
+// noisy_aggregates.
+func noisyAggregates(r *http.Request) bool {
+	identity, ok := GetAuthIdentity(r.Context())
+	return ok && identity.CredentialType == CredentialTypeAPIKey && identity.NoisyAggregates
+}
+
+// noisyQuery returns the normalized form of a noisy aggregate request:
+// the resource and its query parameters in a fixed order. Parameter order
+// and repetition order do not change it.
+func noisyQuery(resource string, q url.Values) string {
+	norm := make(url.Values, len(q))
+	for k, vs := range q {
+		vs = append([]string(nil), vs...)
+		sort.Strings(vs)
+		norm[k] = vs
+	}
+	return resource + "?" + norm.Encode()
+}
+
+// release returns count with Laplace noise of scale 1/Epsilon added,
+// rounded and clamped at zero. It reports false for groups of fewer than
+// MinGroupSize records, which are suppressed.
+//
+// The noise is drawn from a generator seeded with an HMAC under key of
+// the normalized query, the group, and the exact count, which stands in
+// for the data version. Repeating a query therefore returns the same
+// value until the group changes, so averaging repeated requests does not
+// remove the noise.
+func (c AggregatePrivacyConfig) release(key []byte, query, group string, count int) (int, bool) {
+	if count < c.MinGroupSize {
+		return 0, false
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(strings.Join([]string{query, group, strconv.Itoa(count)}, "\x00")))
+	var seed [32]byte
+	copy(seed[:], mac.Sum(nil))
+	rng := rand.New(rand.NewChaCha8(seed))
+	// The difference of two exponential draws is Laplace distributed.
+	noise := (rng.ExpFloat64() - rng.ExpFloat64()) / c.Epsilon
+	return max(0, int(math.Round(float64(count)+noise))), true
+}
+
+// ---------------------------------------------------------------------------
+// GET /data/{resource}:timeseries
+// ---------------------------------------------------------------------------
+
+// knownTimeSeriesParams lists the recognized top-level query parameters for
+// the time-series endpoint. Filter parameters (field[op]) are also accepted.
+var knownTimeSeriesParams = map[string]bool{
+	"date_field": true,
+	"value":      true,
+	"interval":   true,
+	"agg":        true,
+	"from":       true,
+	"to":         true,
+	"tz":         true,
+}
+
+// validTimeIntervals lists the supported calendar bucket sizes.
+var validTimeIntervals = map[string]bool{
+	"hour": true, "day": true, "week": true, "month": true, "year": true,
+}
+
+// validAggregates lists the aggregate functions supported by the
+// time-series and pivot endpoints.
+var validAggregates = map[string]bool{
+	"sum": true, "avg": true, "min": true, "max": true, "count": true,
+}
+
+// timeSeriesPoint is the JSON representation of one time-series bucket.
+// Value is null for avg/min/max buckets that contain no rows.
+type timeSeriesPoint struct {
+	Bucket string   `json:"bucket"`
+	Value  *float64 `json:"value"`
+	Count  int      `json:"count"`
+}
+
+// timeSeriesParams holds validated time-series query parameters.
+type timeSeriesParams struct {
+	query    TimeSeriesQuery
+	location *time.Location
+}
+
+// HandleTimeSeries handles GET /data/{resource}:timeseries requests. It
+// aggregates a numeric field per calendar bucket of a datetime field in
+// the requested time zone and fills empty buckets between from and to.
+func (h *ResourceStatsHandler) HandleTimeSeries(w http.ResponseWriter, r *http.Request) {
+	resource := extractResource(r.URL.Path)
+	if resource == "" {
+		WriteError(w, http.StatusBadRequest, "Missing resource name")
+		return
+	}
+
+	col, ok := h.registry.Get(resource)
+	if !ok {
+		WriteError(w, http.StatusNotFound, fmt.Sprintf("Resource '%s' not found", resource))
+		return
+	}
+
+	q := r.URL.Query()
+	params, err := parseTimeSeriesParams(q, col)
+	if err != nil {
+		WriteErrorFrom(w, http.StatusBadRequest, err)
+		return
+	}
+	noisy := noisyAggregates(r)
+	if noisy && params.query.Agg != "count" {
+		WriteError(w, http.StatusForbidden, errNoisyCountOnly)
+		return
+	}
+
+	buckets := timeSeriesBuckets(params.query.From, params.query.To, params.query.Interval, params.location)
+	if len(buckets) > MaxTimeSeriesPoints {
+		WriteError(w, http.StatusBadRequest, fmt.Sprintf("Time range produces more than %d buckets", MaxTimeSeriesPoints))
+		return
+	}
+
+	filters, err := parseFilterParams(q, col)
+	if err != nil {
+		WriteErrorFrom(w, http.StatusBadRequest, err)
+		return
+	}
+	params.query.Filters = append(filters, ownerFilters(r, col)...)
+	params.query.Offsets = utcOffsetSpans(params.query.From, params.query.To, params.location)
+
+	points, err := h.db.TimeSeries(r.Context(), resource, params.query)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	byBucket := make(map[string]TimeSeriesPoint, len(points))
+	for _, p := range points {
+		byBucket[p.Bucket] = p
+	}
+
+	var query string
+	if noisy {
+		query = noisyQuery(resource, q)
+	}
+	zeroFill := params.query.Agg == "sum" || params.query.Agg == "count"
+	data := make([]any, 0, len(buckets))
+	for _, b := range buckets {
+		item := timeSeriesPoint{Bucket: b.Format(time.RFC3339)}
+		if noisy {
+			key := b.Format(timeSeriesBucketLayout)
+			if n, ok := h.privacy.release(h.noiseKey, query, key, byBucket[key].Count); ok {
+				v := float64(n)
+				item.Value, item.Count = &v, n
+			}
+		} else if p, ok := byBucket[b.Format(timeSeriesBucketLayout)]; ok && p.Count > 0 {
+			v := p.Value
+			item.Value = &v
+			item.Count = p.Count
+		} else if zeroFill {
+			v := 0.0
+			item.Value = &v
+		}
+		data = append(data, item)
+	}
+
+	WriteSuccess(w, http.StatusOK, "Time series retrieved successfully", data)
+}
+
+// parseTimeSeriesParams validates the time-series query parameters.
+func parseTimeSeriesParams(q url.Values, col *Collection) (*timeSeriesParams, error) {
+	for key := range q {
+		if knownTimeSeriesParams[key] || filterParamPattern.MatchString(key) {
+			continue
+		}
+		return nil, fmt.Errorf("Unknown query parameter %q", key)
+	}
+
+	fieldMap := buildAPIFieldMap(col)
+
+	dateField := q.Get("date_field")
+	if dateField == "" {
+		return nil, fmt.Errorf("Query parameter 'date_field' is required")
+	}
+	if f, ok := fieldMap[dateField]; !ok {
+		return nil, fmt.Errorf("Unknown field %q", dateField)
+	} else if f.Type != MoonFieldTypeDatetime {
+		return nil, fmt.Errorf("Field %q must be of type datetime", dateField)
+	}
+
+	agg := q.Get("agg")
+	valueField := q.Get("value")
+	if agg == "" {
+		agg = "sum"
+		if valueField == "" {
+			agg = "count"
+		}
+	}
+	if !validAggregates[agg] {
+		return nil, fmt.Errorf("Query parameter 'agg' must be one of sum, avg, min, max, count")
+	}
+	if valueField == "" && agg != "count" {
+		return nil, fmt.Errorf("Query parameter 'value' is required for agg %q", agg)
+	}
+	if valueField != "" {
+		f, ok := fieldMap[valueField]
+		if !ok {
+			return nil, fmt.Errorf("Unknown field %q", valueField)
+		}
+		if f.Type != MoonFieldTypeInteger && f.Type != MoonFieldTypeDecimal {
+			return nil, fmt.Errorf("Field %q must be of type integer or decimal", valueField)
+		}
+	}
+
+	interval := q.Get("interval")
+	if interval == "" {
+		interval = "day"
+	}
+	if !validTimeIntervals[interval] {
+		return nil, fmt.Errorf("Query parameter 'interval' must be one of hour, day, week, month, year")
+	}
+
+	loc := time.UTC
+	if tz := q.Get("tz"); tz != "" {
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, fmt.Errorf("Unknown time zone %q", tz)
+		}
+		loc = l
+	}
+
+	from, err := time.Parse(time.RFC3339, q.Get("from"))
+	if err != nil {
+		return nil, fmt.Errorf("Query parameter 'from' must be an RFC3339 timestamp")
+	}
+	to, err := time.Parse(time.RFC3339, q.Get("to"))
+	if err != nil {
+		return nil, fmt.Errorf("Query parameter 'to' must be an RFC3339 timestamp")
+	}
+	if !to.After(from) {
+		return nil, fmt.Errorf("Query parameter 'to' must be after 'from'")
+	}
+
+	return &timeSeriesParams{
+		query: TimeSeriesQuery{
+			DateField:  dateField,
+			ValueField: valueField,
+			Interval:   interval,
+			Agg:        agg,
+			From:       from,
+			To:         to,
+		},
+		location: loc,
+	}, nil
+}
+
+// timeSeriesBucketLayout is the wall-clock key format shared with the
+// adapter's TimeSeriesPoint.Bucket.
+const timeSeriesBucketLayout = "2006-01-02T15:04:05"
+
+// truncateToInterval returns the start of the bucket containing t in loc.
+// Weeks start on Monday.
+func truncateToInterval(t time.Time, interval string, loc *time.Location) time.Time {
+	t = t.In(loc)
+	y, m, d := t.Date()
+	switch interval {
+	case "hour":
+		return time.Date(y, m, d, t.Hour(), 0, 0, 0, loc)
+	case "week":
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(y, m, d-offset, 0, 0, 0, 0, loc)
+	case "month":
+		return time.Date(y, m, 1, 0, 0, 0, 0, loc)
+	case "year":
+		return time.Date(y, 1, 1, 0, 0, 0, 0, loc)
+	default:
+		return time.Date(y, m, d, 0, 0, 0, 0, loc)
+	}
+}
+
+// nextInterval returns the start of the bucket after the one starting at t.
+func nextInterval(t time.Time, interval string) time.Time {
+	switch interval {
+	case "hour":
+		return t.Add(time.Hour)
+	case "week":
+		return t.AddDate(0, 0, 7)
+	case "month":
+		return t.AddDate(0, 1, 0)
+	case "year":
+		return t.AddDate(1, 0, 0)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
+
+// timeSeriesBuckets lists the bucket start times overlapping [from, to)
+// in loc. Iteration stops once the list exceeds MaxTimeSeriesPoints so
+// callers can reject oversized ranges cheaply.
+func timeSeriesBuckets(from, to time.Time, interval string, loc *time.Location) []time.Time {
+	var buckets []time.Time
+	seen := make(map[string]bool)
+	for b := truncateToInterval(from, interval, loc); b.Before(to); b = nextInterval(b, interval) {
+		// Repeated wall-clock hours at a DST fall-back share one bucket.
+		key := b.Format(timeSeriesBucketLayout)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		buckets = append(buckets, b)
+		if len(buckets) > MaxTimeSeriesPoints {
+			break
+		}
+	}
+	return buckets
+}
+
+// utcOffsetSpans lists the UTC offsets of loc in effect between from and
+// to, in order, so the adapter can convert instants to local time.
+func utcOffsetSpans(from, to time.Time, loc *time.Location) []UTCOffsetSpan {
+	var spans []UTCOffsetSpan
+	t := from.In(loc)
+	for {
+		_, offset := t.Zone()
+		_, end := t.ZoneBounds()
+		if end.IsZero() || !end.Before(to) {
+			return append(spans, UTCOffsetSpan{Seconds: offset})
+		}
+		spans = append(spans, UTCOffsetSpan{Until: end, Seconds: offset})
+		t = end.In(loc)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// GET /data/{resource}:pivot
+// ---------------------------------------------------------------------------
+
+// knownPivotParams lists the recognized top-level query parameters for the
+// pivot endpoint. Filter parameters (field[op]) are also accepted.
+var knownPivotParams = map[string]bool{
+	"rows":            true,
+	"row_interval":    true,
+	"columns":         true,
+	"column_interval": true,
+	"value":           true,
+	"agg":             true,
+}
+
+// pivotRow is the JSON representation of one pivot table row. Values are
+// aligned with the table's columns list.
+type pivotRow struct {
+	Key    string     `json:"key"`
+	Values []*float64 `json:"values"`
+}
+
+// pivotTable is the JSON representation of a pivot response item.
+type pivotTable struct {
+	Columns []string   `json:"columns"`
+	Rows    []pivotRow `json:"rows"`
+}
+
+// errPivotTooLarge is the error for a pivot over MaxPivotRows or
+// MaxPivotColumns.
+var errPivotTooLarge = fmt.Sprintf("Pivot exceeds %d rows or %d columns", MaxPivotRows, MaxPivotColumns)
+
+// HandlePivot handles GET /data/{resource}:pivot requests. It groups
+// records by a row field and a column field and returns one aggregated
+// value per cell in a tabular structure.
+func (h *ResourceStatsHandler) HandlePivot(w http.ResponseWriter, r *http.Request) {
+	resource := extractResource(r.URL.Path)
+	if resource == "" {
+		WriteError(w, http.StatusBadRequest, "Missing resource name")
+		return
+	}
+
+	col, ok := h.registry.Get(resource)
+	if !ok {
+		WriteError(w, http.StatusNotFound, fmt.Sprintf("Resource '%s' not found", resource))
+		return
+	}
+
+	q := r.URL.Query()
+	pq, err := parsePivotParams(q, col)
+	if err != nil {
+		WriteErrorFrom(w, http.StatusBadRequest, err)
+		return
+	}
+	noisy := noisyAggregates(r)
+	if noisy && pq.Agg != "count" {
+		WriteError(w, http.StatusForbidden, errNoisyCountOnly)
+		return
+	}
+
+	filters, err := parseFilterParams(q, col)
+	if err != nil {
+		WriteErrorFrom(w, http.StatusBadRequest, err)
+		return
+	}
+	pq.Filters = append(filters, ownerFilters(r, col)...)
+
+	// More cells than a table within the limits can hold means too many
+	// rows or columns, so the query reads at most one cell past that and
+	// the check is made before any keys are collected.
+	pq.Limit = MaxPivotCells + 1
+	cells, err := h.db.Pivot(r.Context(), resource, *pq)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if len(cells) > MaxPivotCells {
+		WriteError(w, http.StatusBadRequest, errPivotTooLarge)
+		return
+	}
+
+	if noisy {
+		// Suppressed cells are dropped before the keys are collected, so
+		// a row or column made only of small groups is left out entirely.
+		query := noisyQuery(resource, q)
+		released := cells[:0]
+		for _, c := range cells {
+			if n, ok := h.privacy.release(h.noiseKey, query, c.Row+"\x00"+c.Column, c.Count); ok {
+				c.Value, c.Count = float64(n), n
+				released = append(released, c)
+			}
+		}
+		cells = released
+	}
+
+	fieldMap := buildFieldMap(col)
+	rowType, colType := fieldMap[pq.RowField].Type, fieldMap[pq.ColumnField].Type
+
+	var rowKeys, colKeys []string
+	rowIdx := make(map[string]int)
+	colIdx := make(map[string]int)
+	for _, c := range cells {
+		if _, ok := rowIdx[c.Row]; !ok {
+			rowIdx[c.Row] = len(rowKeys)
+			rowKeys = append(rowKeys, c.Row)
+		}
+		if _, ok := colIdx[c.Column]; !ok {
+			colIdx[c.Column] = len(colKeys)
+			colKeys = append(colKeys, c.Column)
+		}
+	}
+	if len(rowKeys) > MaxPivotRows || len(colKeys) > MaxPivotColumns {
+		WriteError(w, http.StatusBadRequest, errPivotTooLarge)
+		return
+	}
+	sort.Strings(colKeys)
+	for i, k := range colKeys {
+		colIdx[k] = i
+	}
+
+	// With noise, a missing cell is a suppressed one and stays null.
+	zeroFill := (pq.Agg == "sum" || pq.Agg == "count") && !noisy
+	table := pivotTable{
+		Columns: make([]string, len(colKeys)),
+		Rows:    make([]pivotRow, len(rowKeys)),
+	}
+	for i, k := range colKeys {
+		table.Columns[i] = formatPivotKey(k, colType, pq.ColumnInterval)
+	}
+	for i, k := range rowKeys {
+		values := make([]*float64, len(colKeys))
+		if zeroFill {
+			for j := range values {
+				values[j] = new(float64)
+			}
+		}
+		table.Rows[i] = pivotRow{Key: formatPivotKey(k, rowType, pq.RowInterval), Values: values}
+	}
+	for _, c := range cells {
+		if c.Count == 0 && !zeroFill {
+			continue
+		}
+		v := c.Value
+		table.Rows[rowIdx[c.Row]].Values[colIdx[c.Column]] = &v
+	}
+
+	WriteSuccess(w, http.StatusOK, "Pivot retrieved successfully", []any{table})
+}
+
+// parsePivotParams validates the pivot query parameters.
+func parsePivotParams(q url.Values, col *Collection) (*PivotQuery, error) {
+	for key := range q {
+		if knownPivotParams[key] || filterParamPattern.MatchString(key) {
+			continue
+		}
+		return nil, fmt.Errorf("Unknown query parameter %q", key)
+	}
+
+	fieldMap := buildAPIFieldMap(col)
+
+	axis := func(param, intervalParam string) (string, string, error) {
+		name := q.Get(param)
+		if name == "" {
+			return "", "", fmt.Errorf("Query parameter '%s' is required", param)
+		}
+		f, ok := fieldMap[name]
+		if !ok {
+			return "", "", fmt.Errorf("Unknown field %q", name)
+		}
+		if f.Type == MoonFieldTypeJSON {
+			return "", "", fmt.Errorf("Field %q of type json cannot be used as a pivot axis", name)
+		}
+		interval := q.Get(intervalParam)
+		if interval == "" {
+			return name, "", nil
+		}
+		if f.Type != MoonFieldTypeDatetime {
+			return "", "", fmt.Errorf("Query parameter '%s' requires a datetime field", intervalParam)
+		}
+		if !validTimeIntervals[interval] {
+			return "", "", fmt.Errorf("Query parameter '%s' must be one of hour, day, week, month, year", intervalParam)
+		}
+		return name, interval, nil
+	}
+
+	rowField, rowInterval, err := axis("rows", "row_interval")
+	if err != nil {
+		return nil, err
+	}
+	colField, colInterval, err := axis("columns", "column_interval")
+	if err != nil {
+		return nil, err
+	}
+
+	agg := q.Get("agg")
+	valueField := q.Get("value")
+	if agg == "" {
+		agg = "sum"
+		if valueField == "" {
+			agg = "count"
+		}
+	}
+	if !validAggregates[agg] {
+		return nil, fmt.Errorf("Query parameter 'agg' must be one of sum, avg, min, max, count")
+	}
+	if valueField == "" && agg != "count" {
+		return nil, fmt.Errorf("Query parameter 'value' is required for agg %q", agg)
+	}
+	if valueField != "" {
+		f, ok := fieldMap[valueField]
+		if !ok {
+			return nil, fmt.Errorf("Unknown field %q", valueField)
+		}
+		if f.Type != MoonFieldTypeInteger && f.Type != MoonFieldTypeDecimal {
+			return nil, fmt.Errorf("Field %q must be of type integer or decimal", valueField)
+		}
+	}
+
+	return &PivotQuery{
+		RowField:       rowField,
+		RowInterval:    rowInterval,
+		ColumnField:    colField,
+		ColumnInterval: colInterval,
+		ValueField:     valueField,
+		Agg:            agg,
+	}, nil
+}
+
+// formatPivotKey converts an adapter grouping key to its API form. Datetime
+// buckets become RFC3339 UTC timestamps and booleans become true/false.
+func formatPivotKey(key, fieldType, interval string) string {
+	if key == "" {
+		return key
+	}
+	if interval != "" {
+		if t, err := time.ParseInLocation(timeSeriesBucketLayout, key, time.UTC); err == nil {
+			return t.Format(time.RFC3339)
+		}
+		return key
+	}
+	if fieldType == MoonFieldTypeBoolean {
+		return strconv.FormatBool(key != "0")
+	}
+	return key
+}
@@ -0,0 +1,556 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// ---------------------------------------------------------------------------
+// Test helpers
+// ---------------------------------------------------------------------------
+
+func setupResourceStatsTest(t *testing.T) (*ResourceStatsHandler, *SQLiteAdapter) {
+	t.Helper()
+	_, adapter, registry := setupResourceQueryTest(t)
+	seedProducts(t, adapter)
+	return NewResourceStatsHandler(adapter, registry), adapter
+}
+
+func doHistogram(t *testing.T, h *ResourceStatsHandler, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	w := httptest.NewRecorder()
+	h.HandleHistogram(w, req)
+	return w
+}
+
+// ---------------------------------------------------------------------------
+// GET /data/{resource}:histogram
+// ---------------------------------------------------------------------------
+
+func TestResourceHistogram_Integer(t *testing.T) {
+	h, _ := setupResourceStatsTest(t)
+
+	w := doHistogram(t, h, "/data/products:histogram?field=quantity&buckets=2")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	resp := decodeResponse(t, w)
+	item := resp["data"].([]any)[0].(map[string]any)
+
+	if item["count"] != float64(5) {
+		t.Errorf("count: got %v", item["count"])
+	}
+	if item["min"] != float64(10) || item["max"] != float64(200) {
+		t.Errorf("min/max: got %v/%v", item["min"], item["max"])
+	}
+	if item["avg"] != float64(87) {
+		t.Errorf("avg: got %v", item["avg"])
+	}
+
+	percentiles := item["percentiles"].(map[string]any)
+	if percentiles["p50"] != float64(75) {
+		t.Errorf("p50: got %v", percentiles["p50"])
+	}
+
+	buckets := item["buckets"].([]any)
+	if len(buckets) != 2 {
+		t.Fatalf("expected 2 buckets, got %d", len(buckets))
+	}
+	first := buckets[0].(map[string]any)
+	last := buckets[1].(map[string]any)
+	if first["count"] != float64(4) || last["count"] != float64(1) {
+		t.Errorf("bucket counts: got %v and %v", first["count"], last["count"])
+	}
+	if last["upper"] != float64(200) {
+		t.Errorf("last bucket upper: got %v", last["upper"])
+	}
+}
+
+func TestResourceHistogram_WithFilter(t *testing.T) {
+	h, _ := setupResourceStatsTest(t)
+
+	w := doHistogram(t, h, "/data/products:histogram?field=price&active[eq]=0")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	resp := decodeResponse(t, w)
+	item := resp["data"].([]any)[0].(map[string]any)
+	if item["count"] != float64(1) {
+		t.Errorf("count: got %v", item["count"])
+	}
+	// A single distinct value collapses into one bucket.
+	if buckets := item["buckets"].([]any); len(buckets) != 1 {
+		t.Errorf("expected 1 bucket, got %d", len(buckets))
+	}
+}
+
+func TestResourceHistogram_Empty(t *testing.T) {
+	h, adapter := setupResourceStatsTest(t)
+	if err := adapter.ExecDDL(context.Background(), "DELETE FROM products"); err != nil {
+		t.Fatal(err)
+	}
+
+	w := doHistogram(t, h, "/data/products:histogram?field=price")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	resp := decodeResponse(t, w)
+	item := resp["data"].([]any)[0].(map[string]any)
+	if item["count"] != float64(0) {
+		t.Errorf("count: got %v", item["count"])
+	}
+	if buckets := item["buckets"].([]any); len(buckets) != 0 {
+		t.Errorf("expected no buckets, got %d", len(buckets))
+	}
+}
+
+func TestResourceHistogram_Validation(t *testing.T) {
+	h, _ := setupResourceStatsTest(t)
+
+	cases := []struct {
+		name   string
+		target string
+		status int
+	}{
+		{"missing field", "/data/products:histogram", http.StatusBadRequest},
+		{"unknown field", "/data/products:histogram?field=nope", http.StatusBadRequest},
+		{"non-numeric field", "/data/products:histogram?field=title", http.StatusBadRequest},
+		{"zero buckets", "/data/products:histogram?field=price&buckets=0", http.StatusBadRequest},
+		{"too many buckets", "/data/products:histogram?field=price&buckets=101", http.StatusBadRequest},
+		{"unknown param", "/data/products:histogram?field=price&sort=price", http.StatusBadRequest},
+		{"unknown resource", "/data/missing:histogram?field=price", http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := doHistogram(t, h, tc.target)
+			if w.Code != tc.status {
+				t.Fatalf("expected %d, got %d: %s", tc.status, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+// GET /data/{resource}:timeseries
+// ---------------------------------------------------------------------------
+
+func doTimeSeries(t *testing.T, h *ResourceStatsHandler, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	w := httptest.NewRecorder()
+	h.HandleTimeSeries(w, req)
+	return w
+}
+
+func TestResourceTimeSeries_DailySumWithGaps(t *testing.T) {
+	h, _ := setupResourceStatsTest(t)
+
+	w := doTimeSeries(t, h, "/data/products:timeseries?date_field=created_at&value=quantity&interval=day&agg=sum"+
+		"&from=2023-12-31T00:00:00Z&to=2024-01-07T00:00:00Z")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	data := decodeResponse(t, w)["data"].([]any)
+	if len(data) != 7 {
+		t.Fatalf("expected 7 buckets, got %d", len(data))
+	}
+
+	want := []struct {
+		bucket string
+		value  float64
+	}{
+		{"2023-12-31T00:00:00Z", 0},
+		{"2024-01-01T00:00:00Z", 100},
+		{"2024-01-02T00:00:00Z", 50},
+		{"2024-01-03T00:00:00Z", 200},
+		{"2024-01-04T00:00:00Z", 10},
+		{"2024-01-05T00:00:00Z", 75},
+		{"2024-01-06T00:00:00Z", 0},
+	}
+	for i, exp := range want {
+		item := data[i].(map[string]any)
+		if item["bucket"] != exp.bucket || item["value"] != exp.value {
+			t.Errorf("bucket %d: got %v=%v, want %s=%v", i, item["bucket"], item["value"], exp.bucket, exp.value)
+		}
+	}
+}
+
+func TestResourceTimeSeries_TimeZoneShiftsBuckets(t *testing.T) {
+	h, _ := setupResourceStatsTest(t)
+
+	w := doTimeSeries(t, h, "/data/products:timeseries?date_field=created_at&interval=day&tz=America/New_York"+
+		"&from=2023-12-31T05:00:00Z&to=2024-01-02T05:00:00Z")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	data := decodeResponse(t, w)["data"].([]any)
+	if len(data) != 2 {
+		t.Fatalf("expected 2 buckets, got %d", len(data))
+	}
+	// Midnight UTC on Jan 1 and Jan 2 is the evening before in New York.
+	first := data[0].(map[string]any)
+	if first["bucket"] != "2023-12-31T00:00:00-05:00" || first["count"] != float64(1) {
+		t.Errorf("first bucket: got %v", first)
+	}
+	second := data[1].(map[string]any)
+	if second["bucket"] != "2024-01-01T00:00:00-05:00" || second["count"] != float64(1) {
+		t.Errorf("second bucket: got %v", second)
+	}
+}
+
+func TestResourceTimeSeries_DSTTransition(t *testing.T) {
+	h, adapter := setupResourceStatsTest(t)
+	if err := adapter.InsertRow(context.Background(), "products", map[string]any{
+		"id": "01J0099", "title": "Spring", "price": 1, "quantity": int64(1), "active": int64(1),
+		"created_at": "2024-03-11T04:30:00Z",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 04:30 UTC on Mar 11 is 00:30 EDT, after the Mar 10 spring-forward.
+	w := doTimeSeries(t, h, "/data/products:timeseries?date_field=created_at&interval=day&tz=America/New_York"+
+		"&from=2024-03-09T05:00:00Z&to=2024-03-12T04:00:00Z")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	data := decodeResponse(t, w)["data"].([]any)
+	if len(data) != 3 {
+		t.Fatalf("expected 3 buckets, got %d", len(data))
+	}
+	last := data[2].(map[string]any)
+	if last["bucket"] != "2024-03-11T00:00:00-04:00" || last["count"] != float64(1) {
+		t.Errorf("expected the row in the Mar 11 bucket, got %v", data)
+	}
+}
+
+func TestResourceTimeSeries_AvgLeavesGapsNull(t *testing.T) {
+	h, _ := setupResourceStatsTest(t)
+
+	w := doTimeSeries(t, h, "/data/products:timeseries?date_field=created_at&value=price&agg=avg"+
+		"&from=2024-01-05T00:00:00Z&to=2024-01-07T00:00:00Z")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	data := decodeResponse(t, w)["data"].([]any)
+	if v := data[0].(map[string]any)["value"]; v != float64(15) {
+		t.Errorf("expected avg 15, got %v", v)
+	}
+	if v := data[1].(map[string]any)["value"]; v != nil {
+		t.Errorf("expected null for empty bucket, got %v", v)
+	}
+}
+
+func TestResourceTimeSeries_Validation(t *testing.T) {
+	h, _ := setupResourceStatsTest(t)
+	rng := "&from=2024-01-01T00:00:00Z&to=2024-01-02T00:00:00Z"
+
+	cases := []struct {
+		name   string
+		target string
+	}{
+		{"missing date_field", "/data/products:timeseries?value=price" + rng},
+		{"non-datetime date_field", "/data/products:timeseries?date_field=title" + rng},
+		{"non-numeric value", "/data/products:timeseries?date_field=created_at&value=title" + rng},
+		{"value required", "/data/products:timeseries?date_field=created_at&agg=max" + rng},
+		{"bad interval", "/data/products:timeseries?date_field=created_at&interval=minute" + rng},
+		{"bad agg", "/data/products:timeseries?date_field=created_at&value=price&agg=median" + rng},
+		{"bad tz", "/data/products:timeseries?date_field=created_at&tz=Mars/Olympus" + rng},
+		{"missing range", "/data/products:timeseries?date_field=created_at"},
+		{"inverted range", "/data/products:timeseries?date_field=created_at&from=2024-01-02T00:00:00Z&to=2024-01-01T00:00:00Z"},
+		{"too many buckets", "/data/products:timeseries?date_field=created_at&interval=hour&from=2024-01-01T00:00:00Z&to=2024-03-01T00:00:00Z"},
+		{"unknown param", "/data/products:timeseries?date_field=created_at&sort=title" + rng},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := doTimeSeries(t, h, tc.target)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestUTCOffsetSpans_DSTTransition(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	spans := utcOffsetSpans(from, to, loc)
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %+v", spans)
+	}
+	if spans[0].Seconds != -5*3600 || spans[1].Seconds != -4*3600 {
+		t.Errorf("unexpected offsets: %+v", spans)
+	}
+	if !spans[0].Until.Equal(time.Date(2024, 3, 10, 7, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected transition: %v", spans[0].Until)
+	}
+	if !spans[1].Until.IsZero() {
+		t.Errorf("last span must be open-ended: %v", spans[1].Until)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// GET /data/{resource}:pivot
+// ---------------------------------------------------------------------------
+
+func doPivot(t *testing.T, h *ResourceStatsHandler, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	w := httptest.NewRecorder()
+	h.HandlePivot(w, req)
+	return w
+}
+
+func TestResourcePivot_SumByBooleanAndDay(t *testing.T) {
+	h, _ := setupResourceStatsTest(t)
+
+	w := doPivot(t, h, "/data/products:pivot?rows=active&columns=created_at&column_interval=day&value=quantity&agg=sum")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	table := decodeResponse(t, w)["data"].([]any)[0].(map[string]any)
+	columns := table["columns"].([]any)
+	if len(columns) != 5 || columns[0] != "2024-01-01T00:00:00Z" {
+		t.Fatalf("unexpected columns: %v", columns)
+	}
+
+	rows := table["rows"].([]any)
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(rows))
+	}
+	inactive := rows[0].(map[string]any)
+	if inactive["key"] != "false" {
+		t.Fatalf("expected first row key false, got %v", inactive["key"])
+	}
+	values := inactive["values"].([]any)
+	if values[0] != float64(0) || values[2] != float64(200) {
+		t.Errorf("unexpected inactive values: %v", values)
+	}
+	active := rows[1].(map[string]any)
+	if v := active["values"].([]any)[0]; v != float64(100) {
+		t.Errorf("expected 100 for active on day 1, got %v", v)
+	}
+}
+
+func TestResourcePivot_AvgLeavesEmptyCellsNull(t *testing.T) {
+	h, _ := setupResourceStatsTest(t)
+
+	w := doPivot(t, h, "/data/products:pivot?rows=active&columns=title&value=price&agg=avg")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	table := decodeResponse(t, w)["data"].([]any)[0].(map[string]any)
+	inactive := table["rows"].([]any)[0].(map[string]any)
+	nulls := 0
+	for _, v := range inactive["values"].([]any) {
+		if v == nil {
+			nulls++
+		}
+	}
+	if nulls != 4 {
+		t.Errorf("expected 4 empty cells for the inactive row, got %d", nulls)
+	}
+}
+
+func TestResourcePivot_Validation(t *testing.T) {
+	h, _ := setupResourceStatsTest(t)
+
+	cases := []struct {
+		name   string
+		target string
+	}{
+		{"missing rows", "/data/products:pivot?columns=title"},
+		{"missing columns", "/data/products:pivot?rows=title"},
+		{"unknown field", "/data/products:pivot?rows=nope&columns=title"},
+		{"json axis", "/data/products:pivot?rows=metadata&columns=title"},
+		{"interval on non-datetime", "/data/products:pivot?rows=title&columns=active&column_interval=day"},
+		{"bad interval", "/data/products:pivot?rows=title&columns=created_at&column_interval=minute"},
+		{"value required", "/data/products:pivot?rows=title&columns=active&agg=sum"},
+		{"non-numeric value", "/data/products:pivot?rows=title&columns=active&value=title"},
+		{"unknown param", "/data/products:pivot?rows=title&columns=active&page=2"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := doPivot(t, h, tc.target)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+// cellFloodDB answers every pivot with as many distinct cells as the
+// handler asks for, standing in for a high-cardinality pair of fields.
+type cellFloodDB struct {
+	DatabaseAdapter
+	limit int
+}
+
+func (d *cellFloodDB) Pivot(_ context.Context, _ string, q PivotQuery) ([]PivotCell, error) {
+	d.limit = q.Limit
+	cells := make([]PivotCell, q.Limit)
+	for i := range cells {
+		cells[i] = PivotCell{Row: strconv.Itoa(i), Column: "c", Count: 1}
+	}
+	return cells, nil
+}
+
+func TestResourcePivot_BoundedInQuery(t *testing.T) {
+	h, adapter := setupResourceStatsTest(t)
+	db := &cellFloodDB{DatabaseAdapter: adapter}
+	h.db = db
+
+	w := doPivot(t, h, "/data/products:pivot?rows=title&columns=active")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+	if db.limit != MaxPivotCells+1 {
+		t.Errorf("expected the query to be limited to %d cells, got %d", MaxPivotCells+1, db.limit)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Noisy aggregates
+// ---------------------------------------------------------------------------
+
+func TestResourceStats_NoisyAggregates(t *testing.T) {
+	h, _ := setupResourceStatsTest(t)
+	// A huge epsilon makes the noise round away, so counts are exact.
+	h.SetAggregatePrivacy(AggregatePrivacyConfig{Epsilon: 1e9, MinGroupSize: 2})
+	identity := &AuthIdentity{CredentialType: CredentialTypeAPIKey, Role: "user", NoisyAggregates: true}
+	do := func(handle http.HandlerFunc, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req = req.WithContext(SetAuthIdentity(req.Context(), identity))
+		w := httptest.NewRecorder()
+		handle(w, req)
+		return w
+	}
+
+	if w := do(h.HandleHistogram, "/data/products:histogram?field=price"); w.Code != http.StatusForbidden {
+		t.Fatalf("histogram: expected 403, got %d", w.Code)
+	}
+	if w := do(h.HandlePivot, "/data/products:pivot?rows=active&columns=title&value=price&agg=sum"); w.Code != http.StatusForbidden {
+		t.Fatalf("pivot sum: expected 403, got %d", w.Code)
+	}
+
+	w := do(h.HandleTimeSeries, "/data/products:timeseries?date_field=created_at&interval=month&from=2024-01-01T00:00:00Z&to=2024-03-01T00:00:00Z")
+	if w.Code != http.StatusOK {
+		t.Fatalf("timeseries: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	data := decodeResponse(t, w)["data"].([]any)
+	if jan := data[0].(map[string]any); jan["value"] != float64(5) || jan["count"] != float64(5) {
+		t.Errorf("expected January to report 5, got %v", jan)
+	}
+	// An empty bucket is suppressed like any other small group.
+	if feb := data[1].(map[string]any); feb["value"] != nil || feb["count"] != float64(0) {
+		t.Errorf("expected February to be suppressed, got %v", feb)
+	}
+
+	// Inactive products form a group of one, so their row is left out.
+	w = do(h.HandlePivot, "/data/products:pivot?rows=active&columns=created_at&column_interval=month")
+	if w.Code != http.StatusOK {
+		t.Fatalf("pivot: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	rows := decodeResponse(t, w)["data"].([]any)[0].(map[string]any)["rows"].([]any)
+	if len(rows) != 1 {
+		t.Fatalf("expected only the active row, got %v", rows)
+	}
+	if row := rows[0].(map[string]any); row["key"] != "true" || row["values"].([]any)[0] != float64(4) {
+		t.Errorf("unexpected row %v", row)
+	}
+}
+
+func TestAggregatePrivacy_Release(t *testing.T) {
+	c := AggregatePrivacyConfig{Epsilon: 0.5, MinGroupSize: 10}
+	key := []byte("test-noise-key")
+	if _, ok := c.release(key, "q", "g", 9); ok {
+		t.Fatal("expected a group below min_group_size to be suppressed")
+	}
+
+	// Each distinct query gets its own draw, and those draws follow the
+	// Laplace distribution.
+	const draws = 20000
+	sum, exact := 0, 0
+	for i := range draws {
+		n, ok := c.release(key, fmt.Sprintf("q%d", i), "g", 1000)
+		if !ok || n < 0 {
+			t.Fatalf("unexpected release %d, %v", n, ok)
+		}
+		sum += n
+		if n == 1000 {
+			exact++
+		}
+	}
+	// Laplace noise of scale 2 is centered on zero but rarely rounds to it.
+	if mean := float64(sum) / draws; mean < 999.8 || mean > 1000.2 {
+		t.Errorf("expected the noise to average out near 1000, got %v", mean)
+	}
+	if exact > draws/2 {
+		t.Errorf("expected most counts to be perturbed, %d of %d were exact", exact, draws)
+	}
+}
+
+func TestAggregatePrivacy_ReleaseRepeatable(t *testing.T) {
+	c := AggregatePrivacyConfig{Epsilon: 0.5, MinGroupSize: 1}
+	key := []byte("test-noise-key")
+
+	// Repeating a query returns the same value, so averaging many
+	// requests does not converge on the exact count.
+	first, _ := c.release(key, "q", "g", 1000)
+	for range 100 {
+		if n, _ := c.release(key, "q", "g", 1000); n != first {
+			t.Fatalf("expected a repeated query to return %d, got %d", first, n)
+		}
+	}
+
+	// A different group, count, or key gets an independent draw.
+	noise := func(key []byte, group string, count int) []int {
+		out := make([]int, 20)
+		for i := range out {
+			n, _ := c.release(key, "q", fmt.Sprintf("%s%d", group, i), count)
+			out[i] = n - count
+		}
+		return out
+	}
+	base := noise(key, "g", 1000)
+	for name, other := range map[string][]int{
+		"group": noise(key, "h", 1000),
+		"count": noise(key, "g", 1001),
+		"key":   noise([]byte("other-key"), "g", 1000),
+	} {
+		if slices.Equal(base, other) {
+			t.Errorf("expected the noise to depend on the %s", name)
+		}
+	}
+}
+
+func TestNoisyQuery_Normalized(t *testing.T) {
+	a, _ := url.ParseQuery("rows=active&columns=title&title[in]=b&title[in]=a")
+	b, _ := url.ParseQuery("title[in]=a&columns=title&title[in]=b&rows=active")
+	if noisyQuery("products", a) != noisyQuery("products", b) {
+		t.Errorf("expected %q and %q to normalize alike", a.Encode(), b.Encode())
+	}
+	if noisyQuery("products", a) == noisyQuery("orders", a) {
+		t.Error("expected the resource to be part of the normalized query")
+	}
+}
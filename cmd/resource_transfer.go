@@ -0,0 +1,746 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// ResourceTransferHandler implements bulk GET /data/{resource}:export and
+// POST /data/{resource}:import for dynamic collections and, for user
+// managers, the users collection. The apikeys collection can be exported
+// but not imported.
+type ResourceTransferHandler struct {
+	db         DatabaseAdapter
+	registry   *SchemaRegistry
+	bundleKey  []byte // nil disables export bundles
+	validators *ValidatorStore
+	passwords  PasswordPolicy
+}
+
+// NewResourceTransferHandler creates a ResourceTransferHandler with the given dependencies.
+func NewResourceTransferHandler(db DatabaseAdapter, registry *SchemaRegistry) *ResourceTransferHandler {
+	return &ResourceTransferHandler{
+		db:        db,
+		registry:  registry,
+		passwords: DefaultPasswordPolicy(),
+	}
+}
+
+// SetBundleKey enables export bundles encrypted with a key derived from
+// secret.
+func (h *ResourceTransferHandler) SetBundleKey(secret string) {
+	h.bundleKey = deriveBundleKey(secret)
+}
+
+// SetPasswordPolicy sets the policy plaintext passwords in imported users
+// must meet.
+func (h *ResourceTransferHandler) SetPasswordPolicy(policy PasswordPolicy) {
+	h.passwords = policy
+}
+
+// SetValidators runs the validator attached to a collection, if any, on
+// each imported row.
+func (h *ResourceTransferHandler) SetValidators(validators *ValidatorStore) {
+	h.validators = validators
+}
+
+// parseBundleParam reads the bundle query parameter and checks that
+// bundles are enabled when it is set.
+func (h *ResourceTransferHandler) parseBundleParam(q url.Values) (bool, error) {
+	switch q.Get("bundle") {
+	case "", "false":
+		return false, nil
+	case "true":
+	default:
+		return false, fmt.Errorf("Invalid bundle: must be true or false")
+	}
+	if h.bundleKey == nil {
+		return false, fmt.Errorf("Export bundles are disabled: bundle_key is not configured")
+	}
+	return true, nil
+}
+
+// lookupTransferCollection resolves the collection for an import or export
+// request and writes the error response when it cannot be used.
+func (h *ResourceTransferHandler) lookupTransferCollection(w http.ResponseWriter, r *http.Request, export bool) (string, *Collection, bool) {
+	resource := extractResource(r.URL.Path)
+	if resource == "" {
+		WriteError(w, http.StatusBadRequest, "Missing resource name")
+		return "", nil, false
+	}
+	col, ok := h.registry.Get(resource)
+	if !ok {
+		WriteError(w, http.StatusNotFound, fmt.Sprintf("Resource '%s' not found", resource))
+		return "", nil, false
+	}
+	if col.System {
+		if resource != "users" && (resource != "apikeys" || !export) {
+			WriteError(w, http.StatusBadRequest, fmt.Sprintf("Import and export are not supported for '%s'", resource))
+			return "", nil, false
+		}
+		if identity, ok := GetAuthIdentity(r.Context()); !ok || !identity.ManagesUsers() {
+			WriteError(w, http.StatusForbidden, "Forbidden")
+			return "", nil, false
+		}
+	}
+	return resource, col, true
+}
+
+// parseTransferParams rejects unknown query parameters and returns the
+// validated format, defaulting to csv.
+func parseTransferParams(q url.Values, known map[string]bool, allowFilters bool) (string, error) {
+	for key := range q {
+		if known[key] || (allowFilters && filterParamPattern.MatchString(key)) {
+			continue
+		}
+		return "", fmt.Errorf("Unknown query parameter %q", key)
+	}
+	format := q.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "ndjson" {
+		return "", fmt.Errorf("Invalid format: must be csv or ndjson")
+	}
+	return format, nil
+}
+
+// ---------------------------------------------------------------------------
+// GET /data/{resource}:export
+// ---------------------------------------------------------------------------
+
+// knownExportParams lists the recognized top-level query parameters for
+// the export endpoint. Filter parameters (field[op]) are also accepted.
+var knownExportParams = map[string]bool{
+	"bundle":         true,
+	"format":         true,
+	"include_hashes": true,
+	"sort":           true,
+	"nulls":          true,
+}
+
+// HandleExport streams every matching record as CSV or NDJSON. Records are
+// read in pages of ExportBatchSize so memory use does not grow with the
+// collection size. All pages come from one database snapshot, so the export
+// is consistent even while the collection is being written.
+//
+// Password and key hashes are left out unless an admin sets
+// include_hashes=true, which exports them for migration to another
+// instance.
+func (h *ResourceTransferHandler) HandleExport(w http.ResponseWriter, r *http.Request) {
+	resource, col, ok := h.lookupTransferCollection(w, r, true)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	format, err := parseTransferParams(q, knownExportParams, true)
+	if err != nil {
+		WriteErrorFrom(w, http.StatusBadRequest, err)
+		return
+	}
+	includeHashes, err := parseIncludeHashesParam(r, col)
+	if err != nil {
+		WriteErrorFrom(w, http.StatusBadRequest, err)
+		return
+	}
+	if identity, ok := GetAuthIdentity(r.Context()); includeHashes && (!ok || identity.Role != "admin") {
+		WriteError(w, http.StatusForbidden, "include_hashes requires the admin role")
+		return
+	}
+	bundle, err := h.parseBundleParam(q)
+	if err != nil {
+		WriteErrorFrom(w, http.StatusBadRequest, err)
+		return
+	}
+
+	sortFields, err := parseSortQuery(q, col)
+	if err != nil {
+		WriteErrorFrom(w, http.StatusBadRequest, err)
+		return
+	}
+	// id breaks ties so page boundaries are stable.
+	sortFields = append(sortFields, SortField{Field: "id"})
+
+	filters, err := parseFilterParams(q, col)
+	if err != nil {
+		WriteErrorFrom(w, http.StatusBadRequest, err)
+		return
+	}
+
+	filters = append(filters, ownerFilters(r, col)...)
+	opts := QueryOptions{Filters: filters, Sort: sortFields, Page: 1, PerPage: ExportBatchSize}
+
+	// Every page is read from one snapshot so rows written during the
+	// export can neither be skipped nor repeated at page boundaries.
+	err = h.db.ReadSnapshot(r.Context(), func(snap SnapshotReader) error {
+		h.writeExport(w, r, snap, resource, col, format, bundle, includeHashes, opts)
+		return nil
+	})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
+
+// writeExport reads the pages selected by opts from snap and writes them
+// to w in format, sealed in an export bundle when bundle is set. Hidden
+// fields are written only when includeHashes is set.
+//
+// When id is the only sort key, each page after the first starts after the
+// last id written instead of at an offset, so late pages of a large
+// collection cost no more than early ones.
+func (h *ResourceTransferHandler) writeExport(w http.ResponseWriter, r *http.Request, snap SnapshotReader, resource string, col *Collection, format string, bundle, includeHashes bool, opts QueryOptions) {
+	ctx := r.Context()
+	rows, total, err := snap.QueryRows(ctx, resource, opts)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	fields := col.APIFields()
+	if includeHashes {
+		fields = col.Fields
+	}
+	header := make([]string, len(fields))
+	for i, f := range fields {
+		header[i] = f.Name
+	}
+
+	var out io.Writer = w
+	var bw *bundleWriter
+	filename := resource + "." + format
+	contentType := NDJSONContentType
+	if format == "csv" {
+		contentType = "text/csv; charset=utf-8"
+	}
+	if bundle {
+		if bw, err = newBundleWriter(w, h.bundleKey, resource, format); err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		out = bw
+		filename += BundleFileExtension
+		contentType = "application/octet-stream"
+	}
+
+	var csvWriter *csv.Writer
+	var encoder *json.Encoder
+	if format == "csv" {
+		csvWriter = csv.NewWriter(out)
+	} else {
+		encoder = json.NewEncoder(out)
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+
+	if csvWriter != nil {
+		csvWriter.Write(header)
+	}
+	flusher, _ := w.(http.Flusher)
+	keyset := len(opts.Sort) == 1
+	filters := opts.Filters[:len(opts.Filters):len(opts.Filters)]
+	for {
+		for _, row := range rows {
+			record := formatRecord(row, col)
+			if !includeHashes {
+				record = filterHiddenFields(resource, record)
+			}
+			if csvWriter != nil {
+				cells := make([]string, len(header))
+				for i, name := range header {
+					cells[i] = exportCell(record[name])
+				}
+				csvWriter.Write(cells)
+			} else {
+				encoder.Encode(record)
+			}
+		}
+		if csvWriter != nil {
+			csvWriter.Flush()
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		// The adapter may cap the page size, so progress is measured
+		// against the rows left rather than the requested size.
+		if len(rows) == 0 || len(rows) >= total {
+			// Only a complete export gets the final chunk, so a bundle
+			// cut short by an error fails to open.
+			if bw != nil {
+				bw.Close()
+			}
+			return
+		}
+		if keyset {
+			// total is recounted after the cursor, so it stays the rows left.
+			opts.Filters = append(filters, Filter{Field: "id", Op: "gt", Value: rows[len(rows)-1]["id"]})
+		} else {
+			total -= len(rows)
+			opts.Page++
+		}
+		next, left, err := snap.QueryRows(ctx, resource, opts)
+		if err != nil {
+			// Headers are already sent; the truncated body is the only signal.
+			return
+		}
+		rows = next
+		if keyset {
+			total = left
+		}
+	}
+}
+
+// parseIncludeHashesParam reads the include_hashes query parameter, which
+// applies only to collections with hidden fields.
+func parseIncludeHashesParam(r *http.Request, col *Collection) (bool, error) {
+	switch r.URL.Query().Get("include_hashes") {
+	case "", "false":
+		return false, nil
+	case "true":
+	default:
+		return false, fmt.Errorf("Invalid include_hashes: must be true or false")
+	}
+	if len(hiddenSystemFields[col.Name]) == 0 {
+		return false, fmt.Errorf("include_hashes applies only to users and apikeys")
+	}
+	return true, nil
+}
+
+// exportCell renders one API value as a CSV cell. JSON values are written
+// as compact JSON text and NULL as an empty cell.
+func exportCell(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case bool:
+		return strconv.FormatBool(val)
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	default:
+		b, err := json.Marshal(val)
+		if err != nil {
+			return ""
+		}
+		return string(b)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// POST /data/{resource}:import
+// ---------------------------------------------------------------------------
+
+// knownImportParams lists the recognized query parameters for the import
+// endpoint.
+var knownImportParams = map[string]bool{
+	"bundle": true,
+	"format": true,
+	"mode":   true,
+}
+
+// importRow is one decoded import record. Row is the 1-based record number
+// excluding the CSV header.
+type importRow struct {
+	Row  int
+	Item map[string]any
+	Err  error
+}
+
+// importFailure is the JSON representation of a rejected best-effort row.
+type importFailure struct {
+	Row     int    `json:"row"`
+	Message string `json:"message"`
+}
+
+// HandleImport creates records from a CSV or NDJSON body. The body may be
+// sent directly or as the "file" part of a multipart form. In atomic mode
+// (the default) one invalid row rejects the whole import; in best_effort
+// mode valid rows are inserted and failures are reported per row.
+func (h *ResourceTransferHandler) HandleImport(w http.ResponseWriter, r *http.Request) {
+	resource, col, ok := h.lookupTransferCollection(w, r, false)
+	if !ok {
+		return
+	}
+
+	identity, ok := GetAuthIdentity(r.Context())
+	if !ok {
+		WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if identity.Role != "admin" && !identity.CanWrite {
+		WriteError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	q := r.URL.Query()
+	known := knownImportParams
+	if resource == "users" {
+		known = knownUserImportParams
+	}
+	format, err := parseTransferParams(q, known, false)
+	if err != nil {
+		WriteErrorFrom(w, http.StatusBadRequest, err)
+		return
+	}
+	mode := q.Get("mode")
+	if mode == "" {
+		mode = "atomic"
+	}
+	if mode != "atomic" && mode != "best_effort" {
+		WriteError(w, http.StatusBadRequest, "Invalid mode: must be atomic or best_effort")
+		return
+	}
+	onDuplicate := q.Get("on_duplicate")
+	if onDuplicate == "" {
+		onDuplicate = "fail"
+	}
+	if onDuplicate != "fail" && onDuplicate != "skip" {
+		WriteError(w, http.StatusBadRequest, "Invalid on_duplicate: must be fail or skip")
+		return
+	}
+	if resource == "users" {
+		col = userImportCollection
+	}
+
+	bundle, err := h.parseBundleParam(q)
+	if err != nil {
+		WriteErrorFrom(w, http.StatusBadRequest, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, MaxImportBodyBytes)
+	src, err := importSource(r)
+	if err != nil {
+		WriteErrorFrom(w, http.StatusBadRequest, err)
+		return
+	}
+	if bundle {
+		src, format, err = h.openImportBundle(src, resource, q.Get("format"))
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				WriteError(w, http.StatusBadRequest, fmt.Sprintf("Import body exceeds %d bytes", MaxImportBodyBytes))
+				return
+			}
+			WriteErrorFrom(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	var rows []importRow
+	if format == "csv" {
+		rows, err = decodeCSVImport(src, col)
+	} else {
+		rows, err = decodeNDJSONImport(src, col)
+	}
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			WriteError(w, http.StatusBadRequest, fmt.Sprintf("Import body exceeds %d bytes", MaxImportBodyBytes))
+			return
+		}
+		WriteErrorFrom(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(rows) == 0 {
+		WriteError(w, http.StatusBadRequest, "Import contains no rows")
+		return
+	}
+	if resource == "users" {
+		h.importUsers(w, r, rows, mode, onDuplicate)
+		return
+	}
+
+	fieldMap := buildFieldMap(col)
+	for i := range rows {
+		if rows[i].Err == nil {
+			rows[i].Err = validateImportItem(rows[i].Item, col, fieldMap, resource)
+		}
+	}
+	validator, err := h.validators.Lookup(r.Context(), resource)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	for i := range rows {
+		if validator == nil || rows[i].Err != nil {
+			continue
+		}
+		messages, err := h.validators.Run(r.Context(), validator, "create", resource, rows[i].Item)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		if len(messages) > 0 {
+			rows[i].Err = &APIError{Code: ErrCodeValidationFailed, Message: validatorRejection(messages)}
+		}
+	}
+
+	if mode == "atomic" {
+		h.importAtomic(w, r, resource, col, rows, identity.OwnerID())
+		return
+	}
+	h.importBestEffort(w, r, resource, col, rows, identity.OwnerID())
+}
+
+// openImportBundle verifies and decrypts an export bundle and returns its
+// payload and format. The bundle must have been exported from resource,
+// and format, when given, must match the bundle.
+func (h *ResourceTransferHandler) openImportBundle(src io.Reader, resource, format string) (io.Reader, string, error) {
+	m, payload, err := openBundle(src, h.bundleKey)
+	if err != nil {
+		return nil, "", err
+	}
+	if m.Collection != resource {
+		return nil, "", fmt.Errorf("Bundle was exported from collection %q", m.Collection)
+	}
+	if format != "" && format != m.Format {
+		return nil, "", fmt.Errorf("Bundle format is %s", m.Format)
+	}
+	return bytes.NewReader(payload), m.Format, nil
+}
+
+// importAtomic inserts all rows in one transaction after every row has
+// passed validation.
+func (h *ResourceTransferHandler) importAtomic(w http.ResponseWriter, r *http.Request, resource string, col *Collection, rows []importRow, owner string) {
+	physical := make([]map[string]any, 0, len(rows))
+	for _, row := range rows {
+		if row.Err != nil {
+			WriteErrorFrom(w, http.StatusBadRequest, fmt.Errorf("Row %d: %w", row.Row, row.Err))
+			return
+		}
+		physical = append(physical, newDynamicRow(row.Item, col, owner))
+	}
+
+	if err := h.db.InsertRows(r.Context(), resource, physical); err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	meta := map[string]any{"success": len(physical), "failed": 0}
+	WriteSuccessFull(w, http.StatusCreated, "Resource imported successfully", []any{}, meta, nil)
+}
+
+// importBestEffort inserts each valid row on its own and reports the rows
+// that failed validation or insertion.
+func (h *ResourceTransferHandler) importBestEffort(w http.ResponseWriter, r *http.Request, resource string, col *Collection, rows []importRow, owner string) {
+	ctx := r.Context()
+	failures := make([]any, 0)
+	success := 0
+	for _, row := range rows {
+		if row.Err != nil {
+			failures = append(failures, importFailure{Row: row.Row, Message: row.Err.Error()})
+			continue
+		}
+		if err := h.db.InsertRow(ctx, resource, newDynamicRow(row.Item, col, owner)); err != nil {
+			_, msg := dbErrorResponse(err)
+			failures = append(failures, importFailure{Row: row.Row, Message: msg})
+			continue
+		}
+		success++
+	}
+
+	status := http.StatusCreated
+	if success == 0 {
+		status = http.StatusOK
+	}
+	meta := map[string]any{"success": success, "failed": len(failures)}
+	WriteSuccessFull(w, status, "Resource imported successfully", failures, meta, nil)
+}
+
+// validateImportItem applies the same field checks as op=create.
+func validateImportItem(item map[string]any, col *Collection, fieldMap map[string]Field, resource string) error {
+	if err := validateWritableFields(item, col, resource); err != nil {
+		return err
+	}
+	if err := validateFieldsExist(item, fieldMap, resource); err != nil {
+		return err
+	}
+	if err := validateFieldTypes(item, fieldMap); err != nil {
+		return err
+	}
+	return validateAttributes(item, col)
+}
+
+// importSource returns the reader holding the import payload: the "file"
+// part of a multipart form, or the raw request body.
+func importSource(r *http.Request) (io.Reader, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r.Body, nil
+	}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, fmt.Errorf("Invalid multipart body")
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, fmt.Errorf("Missing multipart field: file")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid multipart body")
+		}
+		if part.FormName() == "file" {
+			return part, nil
+		}
+	}
+}
+
+// decodeCSVImport reads a CSV payload whose first line names the columns.
+// An id column is accepted so exports can be re-imported, but its values
+// are ignored and new ids are generated.
+func decodeCSVImport(src io.Reader, col *Collection) ([]importRow, error) {
+	reader := csv.NewReader(src)
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, importReadError(err)
+	}
+
+	fieldMap := buildFieldMap(col)
+	seen := make(map[string]bool, len(header))
+	for _, name := range header {
+		if _, ok := fieldMap[name]; !ok {
+			return nil, fmt.Errorf("Unknown column %q in CSV header", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("Duplicate column %q in CSV header", name)
+		}
+		seen[name] = true
+	}
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, importReadError(err)
+		}
+		if len(rows) == MaxImportRows {
+			return nil, fmt.Errorf("Import exceeds %d rows", MaxImportRows)
+		}
+
+		row := importRow{Row: len(rows) + 1, Item: make(map[string]any, len(header))}
+		for i, name := range header {
+			if fieldMap[name].ReadOnly {
+				continue
+			}
+			value, err := parseCSVCell(record[i], fieldMap[name])
+			if err != nil {
+				row.Err = err
+				break
+			}
+			row.Item[name] = value
+		}
+		rows = append(rows, row)
+	}
+}
+
+// parseCSVCell converts a CSV cell into the JSON value op=create expects
+// for the field. An empty cell is NULL, except for string fields that are
+// not nullable, where it is the empty string.
+func parseCSVCell(cell string, f Field) (any, error) {
+	if cell == "" {
+		if f.Nullable {
+			return nil, nil
+		}
+		if f.Type == MoonFieldTypeString {
+			return "", nil
+		}
+		return nil, fmt.Errorf("Field '%s' cannot be null", f.Name)
+	}
+
+	invalid := fmt.Errorf("Invalid value for field '%s' of type '%s'", f.Name, f.Type)
+	switch f.Type {
+	case MoonFieldTypeInteger:
+		n, err := strconv.ParseInt(cell, 10, 64)
+		if err != nil {
+			return nil, invalid
+		}
+		return n, nil
+	case MoonFieldTypeBoolean:
+		b, err := strconv.ParseBool(cell)
+		if err != nil {
+			return nil, invalid
+		}
+		return b, nil
+	case MoonFieldTypeJSON:
+		var v any
+		if err := json.Unmarshal([]byte(cell), &v); err != nil {
+			return nil, invalid
+		}
+		return v, nil
+	default:
+		return cell, nil
+	}
+}
+
+// decodeNDJSONImport reads one JSON object per line. Blank lines are
+// skipped and read-only keys such as id are ignored, matching the CSV
+// behavior.
+func decodeNDJSONImport(src io.Reader, col *Collection) ([]importRow, error) {
+	scanner := bufio.NewScanner(src)
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxImportLineBytes)
+
+	var rows []importRow
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if len(rows) == MaxImportRows {
+			return nil, fmt.Errorf("Import exceeds %d rows", MaxImportRows)
+		}
+
+		row := importRow{Row: len(rows) + 1}
+		if err := json.Unmarshal(line, &row.Item); err != nil || row.Item == nil {
+			row.Err = fmt.Errorf("Invalid JSON object")
+		} else {
+			for _, f := range col.Fields {
+				if f.ReadOnly {
+					delete(row.Item, f.Name)
+				}
+			}
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, importReadError(err)
+	}
+	return rows, nil
+}
+
+// importReadError keeps body-size errors intact for the caller and maps
+// every other read or parse failure to a client message.
+func importReadError(err error) error {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return err
+	}
+	if errors.Is(err, bufio.ErrTooLong) {
+		return fmt.Errorf("Import line exceeds %d bytes", MaxImportLineBytes)
+	}
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return fmt.Errorf("Invalid CSV on line %d", parseErr.Line)
+	}
+	return fmt.Errorf("Invalid request body")
+}
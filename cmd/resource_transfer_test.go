@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// ---------------------------------------------------------------------------
+// Test helpers
+// ---------------------------------------------------------------------------
+
+func setupResourceTransferTest(t *testing.T) (*ResourceTransferHandler, *SQLiteAdapter) {
+	t.Helper()
+	_, adapter, registry := setupResourceQueryTest(t)
+	seedProducts(t, adapter)
+	return NewResourceTransferHandler(adapter, registry), adapter
+}
+
+func doExport(t *testing.T, h *ResourceTransferHandler, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	w := httptest.NewRecorder()
+	h.HandleExport(w, req)
+	return w
+}
+
+func doImport(t *testing.T, h *ResourceTransferHandler, target, contentType, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req = req.WithContext(SetAuthIdentity(req.Context(), &AuthIdentity{
+		CallerID: "admin-001", Role: "admin", CanWrite: true, CredentialType: CredentialTypeJWT,
+	}))
+	w := httptest.NewRecorder()
+	h.HandleImport(w, req)
+	return w
+}
+
+func countProducts(t *testing.T, adapter *SQLiteAdapter) int {
+	t.Helper()
+	n, err := adapter.CountRows(context.Background(), "products")
+	if err != nil {
+		t.Fatalf("CountRows: %v", err)
+	}
+	return n
+}
+
+// ---------------------------------------------------------------------------
+// GET /data/{resource}:export
+// ---------------------------------------------------------------------------
+
+func TestResourceExport_CSV(t *testing.T) {
+	h, _ := setupResourceTransferTest(t)
+
+	w := doExport(t, h, "/data/products:export?sort=-quantity")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Errorf("expected text/csv, got %q", ct)
+	}
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("parse csv: %v", err)
+	}
+	if len(records) != 6 {
+		t.Fatalf("expected header + 5 rows, got %d", len(records))
+	}
+	header := records[0]
+	if header[0] != "id" {
+		t.Errorf("expected id first, got %v", header)
+	}
+	idx := make(map[string]int)
+	for i, name := range header {
+		idx[name] = i
+	}
+	first := records[1]
+	if first[idx["title"]] != "Doohickey" || first[idx["quantity"]] != "200" || first[idx["active"]] != "false" {
+		t.Errorf("unexpected first row: %v", first)
+	}
+	if first[idx["metadata"]] != `{"color":"green"}` {
+		t.Errorf("expected compact JSON metadata, got %q", first[idx["metadata"]])
+	}
+	if last := records[5]; last[idx["description"]] != "" {
+		t.Errorf("expected empty cell for NULL description, got %q", last[idx["description"]])
+	}
+}
+
+func TestResourceExport_NDJSONWithFilter(t *testing.T) {
+	h, _ := setupResourceTransferTest(t)
+
+	w := doExport(t, h, "/data/products:export?format=ndjson&active[eq]=1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 active products, got %d lines", len(lines))
+	}
+	var rec map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+		t.Fatalf("decode line: %v", err)
+	}
+	if rec["active"] != true {
+		t.Errorf("expected active=true, got %v", rec["active"])
+	}
+}
+
+func TestResourceExport_MultiplePages(t *testing.T) {
+	h, adapter := setupResourceTransferTest(t)
+	rows := make([]map[string]any, 0, ExportBatchSize)
+	for i := range ExportBatchSize {
+		rows = append(rows, map[string]any{
+			"id": fmt.Sprintf("01K%04d", i), "title": "Bulk", "price": 1.0, "quantity": int64(i), "active": int64(1),
+			"created_at": "2024-02-01T00:00:00Z",
+		})
+	}
+	if err := adapter.InsertRows(context.Background(), "products", rows); err != nil {
+		t.Fatalf("InsertRows: %v", err)
+	}
+
+	// The default id order pages by cursor; other sorts page by offset.
+	for _, target := range []string{"/data/products:export?format=ndjson", "/data/products:export?format=ndjson&sort=-quantity"} {
+		w := doExport(t, h, target)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+		seen := make(map[string]bool, len(lines))
+		for _, line := range lines {
+			var record map[string]any
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				t.Fatalf("parse ndjson: %v", err)
+			}
+			seen[record["id"].(string)] = true
+		}
+		if want := ExportBatchSize + 5; len(lines) != want || len(seen) != want {
+			t.Fatalf("%s: expected %d distinct records, got %d lines and %d ids", target, want, len(lines), len(seen))
+		}
+	}
+}
+
+func TestResourceExport_Validation(t *testing.T) {
+	h, _ := setupResourceTransferTest(t)
+
+	tests := []struct {
+		name   string
+		target string
+		status int
+	}{
+		{"bad format", "/data/products:export?format=xml", http.StatusBadRequest},
+		{"unknown param", "/data/products:export?page=2", http.StatusBadRequest},
+		{"unknown sort field", "/data/products:export?sort=nope", http.StatusBadRequest},
+		{"missing collection", "/data/nothing:export", http.StatusNotFound},
+		{"apikeys without admin", "/data/apikeys:export", http.StatusForbidden},
+		{"include_hashes on a collection", "/data/products:export?include_hashes=true", http.StatusBadRequest},
+		{"users without admin", "/data/users:export", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := doExport(t, h, tt.target); w.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+// POST /data/{resource}:import
+// ---------------------------------------------------------------------------
+
+func TestResourceImport_RoundTripCSV(t *testing.T) {
+	h, adapter := setupResourceTransferTest(t)
+
+	export := doExport(t, h, "/data/products:export")
+	w := doImport(t, h, "/data/products:import", "text/csv", export.Body.String())
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	resp := decodeResponse(t, w)
+	meta := resp["meta"].(map[string]any)
+	if meta["success"] != float64(5) || meta["failed"] != float64(0) {
+		t.Errorf("unexpected meta: %v", meta)
+	}
+	if n := countProducts(t, adapter); n != 10 {
+		t.Fatalf("expected 10 products after re-import, got %d", n)
+	}
+}
+
+func TestResourceImport_RoundTripBundle(t *testing.T) {
+	h, adapter := setupResourceTransferTest(t)
+	h.SetBundleKey(strings.Repeat("b", MinBundleKeyLength))
+
+	export := doExport(t, h, "/data/products:export?format=ndjson&bundle=true")
+	if export.Code != http.StatusOK {
+		t.Fatalf("export: expected 200, got %d: %s", export.Code, export.Body.String())
+	}
+	if cd := export.Header().Get("Content-Disposition"); !strings.Contains(cd, "products.ndjson"+BundleFileExtension) {
+		t.Errorf("unexpected Content-Disposition %q", cd)
+	}
+	if strings.Contains(export.Body.String(), "Widget") {
+		t.Fatal("bundle must not contain plaintext records")
+	}
+	bundle := export.Body.String()
+
+	w := doImport(t, h, "/data/products:import?bundle=true", "application/octet-stream", bundle)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("import: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if n := countProducts(t, adapter); n != 10 {
+		t.Fatalf("expected 10 products after re-import, got %d", n)
+	}
+
+	tampered := []byte(bundle)
+	tampered[len(tampered)-1] ^= 1
+	for name, tc := range map[string]struct{ target, body string }{
+		"tampered":         {"/data/products:import?bundle=true", string(tampered)},
+		"other format":     {"/data/products:import?bundle=true&format=csv", bundle},
+		"other collection": {"/data/users:import?bundle=true", bundle},
+		"plain body":       {"/data/products:import?bundle=true", "title\nA\n"},
+		"bad bundle flag":  {"/data/products:import?bundle=yes", bundle},
+	} {
+		if w := doImport(t, h, tc.target, "application/octet-stream", tc.body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d: %s", name, w.Code, w.Body.String())
+		}
+	}
+	if n := countProducts(t, adapter); n != 10 {
+		t.Fatalf("rejected bundles must not insert rows, got %d products", n)
+	}
+
+	h2, _ := setupResourceTransferTest(t)
+	if w := doImport(t, h2, "/data/products:import?bundle=true", "application/octet-stream", bundle); w.Code != http.StatusBadRequest {
+		t.Fatalf("bundles disabled: expected 400, got %d", w.Code)
+	}
+	if w := doExport(t, h2, "/data/products:export?bundle=true"); w.Code != http.StatusBadRequest {
+		t.Fatalf("bundles disabled: expected 400 on export, got %d", w.Code)
+	}
+}
+
+func TestResourceImport_NDJSON(t *testing.T) {
+	h, adapter := setupResourceTransferTest(t)
+
+	body := `{"title":"Sprocket","price":"1.50","quantity":3,"active":true}
+
+{"title":"Cog","price":"2.00","quantity":4,"active":false,"metadata":{"size":"s"}}
+`
+	w := doImport(t, h, "/data/products:import?format=ndjson", "application/x-ndjson", body)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if n := countProducts(t, adapter); n != 7 {
+		t.Fatalf("expected 7 products, got %d", n)
+	}
+}
+
+func TestResourceImport_AtomicRejectsWholeBatch(t *testing.T) {
+	h, adapter := setupResourceTransferTest(t)
+
+	body := "title,price,quantity,active\nSprocket,1.50,3,true\nCog,2.00,many,false\n"
+	w := doImport(t, h, "/data/products:import", "text/csv", body)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+	resp := decodeResponse(t, w)
+	if msg := resp["message"].(string); !strings.HasPrefix(msg, "Row 2:") {
+		t.Errorf("expected row number in message, got %q", msg)
+	}
+	if n := countProducts(t, adapter); n != 5 {
+		t.Fatalf("expected no rows inserted, got %d products", n)
+	}
+}
+
+func TestResourceImport_BestEffortReportsFailures(t *testing.T) {
+	h, adapter := setupResourceTransferTest(t)
+
+	body := "title,price,quantity,active\nSprocket,1.50,3,true\nCog,2.00,many,false\nGear,3.00,5,yes\n"
+	w := doImport(t, h, "/data/products:import?mode=best_effort", "text/csv", body)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	resp := decodeResponse(t, w)
+	meta := resp["meta"].(map[string]any)
+	if meta["success"] != float64(1) || meta["failed"] != float64(2) {
+		t.Errorf("unexpected meta: %v", meta)
+	}
+	data := resp["data"].([]any)
+	if first := data[0].(map[string]any); first["row"] != float64(2) {
+		t.Errorf("expected first failure on row 2, got %v", first)
+	}
+	if n := countProducts(t, adapter); n != 6 {
+		t.Fatalf("expected 6 products, got %d", n)
+	}
+}
+
+func TestResourceImport_Multipart(t *testing.T) {
+	h, adapter := setupResourceTransferTest(t)
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	mw.WriteField("note", "ignored")
+	fw, _ := mw.CreateFormFile("file", "products.csv")
+	fw.Write([]byte("title,price,quantity,active\nSprocket,1.50,3,true\n"))
+	mw.Close()
+
+	w := doImport(t, h, "/data/products:import", mw.FormDataContentType(), buf.String())
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if n := countProducts(t, adapter); n != 6 {
+		t.Fatalf("expected 6 products, got %d", n)
+	}
+}
+
+func TestResourceImport_Validation(t *testing.T) {
+	h, _ := setupResourceTransferTest(t)
+
+	tests := []struct {
+		name   string
+		target string
+		body   string
+		status int
+	}{
+		{"bad mode", "/data/products:import?mode=fast", "title\nA\n", http.StatusBadRequest},
+		{"bad format", "/data/products:import?format=xml", "title\nA\n", http.StatusBadRequest},
+		{"unknown column", "/data/products:import", "title,color\nA,red\n", http.StatusBadRequest},
+		{"duplicate column", "/data/products:import", "title,title\nA,B\n", http.StatusBadRequest},
+		{"ragged row", "/data/products:import", "title,price\nA\n", http.StatusBadRequest},
+		{"empty body", "/data/products:import", "", http.StatusBadRequest},
+		{"header only", "/data/products:import", "title\n", http.StatusBadRequest},
+		{"invalid json line", "/data/products:import?format=ndjson", "[1,2]\n", http.StatusBadRequest},
+		{"apikeys collection", "/data/apikeys:import", "name\nbob\n", http.StatusBadRequest},
+		{"on_duplicate on dynamic collection", "/data/products:import?on_duplicate=skip", "title\nA\n", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := doImport(t, h, tt.target, "text/csv", tt.body); w.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestResourceImport_RequiresWriteAccess(t *testing.T) {
+	h, _ := setupResourceTransferTest(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/data/products:import", strings.NewReader("title\nA\n"))
+	req = req.WithContext(SetAuthIdentity(req.Context(), &AuthIdentity{
+		CallerID: "user-001", Role: "user", CanWrite: false, CredentialType: CredentialTypeJWT,
+	}))
+	w := httptest.NewRecorder()
+	h.HandleImport(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", w.Code)
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// knownUserImportParams lists the recognized query parameters for
+// POST /data/users:import.
+var knownUserImportParams = map[string]bool{
+	"bundle":       true,
+	"format":       true,
+	"mode":         true,
+	"on_duplicate": true,
+}
+
+// userImportCollection describes the columns accepted by a users import.
+// It is not the physical users schema: password and password_hash are
+// write-only inputs, and the exported read-only columns are accepted so an
+// export can be re-imported, but their values are ignored.
+var userImportCollection = &Collection{
+	Name:   "users",
+	System: true,
+	Fields: []Field{
+		{Name: "id", Type: MoonFieldTypeID, ReadOnly: true},
+		{Name: "username", Type: MoonFieldTypeString},
+		{Name: "email", Type: MoonFieldTypeString},
+		{Name: "role", Type: MoonFieldTypeString},
+		{Name: "can_write", Type: MoonFieldTypeBoolean, Nullable: true},
+		{Name: "enabled", Type: MoonFieldTypeBoolean, Nullable: true},
+		{Name: "password", Type: MoonFieldTypeString, Nullable: true},
+		{Name: "password_hash", Type: MoonFieldTypeString, Nullable: true},
+		{Name: "created_at", Type: MoonFieldTypeString, Nullable: true, ReadOnly: true},
+		{Name: "updated_at", Type: MoonFieldTypeString, Nullable: true, ReadOnly: true},
+		{Name: "last_login_at", Type: MoonFieldTypeString, Nullable: true, ReadOnly: true},
+	},
+}
+
+// importUsers creates user accounts from decoded import rows. Every row is
+// checked before any password is hashed, so an atomic import that fails
+// validation returns quickly. Rows whose username or email already exists,
+// in the database or earlier in the file, fail the row or are skipped,
+// depending on onDuplicate. Only admins can import users with the admin
+// role.
+func (h *ResourceTransferHandler) importUsers(w http.ResponseWriter, r *http.Request, rows []importRow, mode, onDuplicate string) {
+	if len(rows) > MaxUserImportRows {
+		WriteError(w, http.StatusBadRequest, fmt.Sprintf("User import exceeds %d rows", MaxUserImportRows))
+		return
+	}
+
+	ctx := r.Context()
+	failures := make([]any, 0)
+	seen := make(map[string]bool)
+	var accepted []importRow
+	skipped := 0
+
+	for _, row := range rows {
+		err := row.Err
+		if err == nil {
+			err = validateUserImportItem(row.Item, h.passwords)
+		}
+		if err == nil {
+			role := row.Item["role"].(string)
+			if err = checkRoleName(ctx, h.db, role); err != nil {
+				if _, ok := err.(*validationError); !ok {
+					WriteError(w, http.StatusInternalServerError, "Internal server error")
+					return
+				}
+			} else if !adminRoleAllowed(r, role) {
+				err = fmt.Errorf("Only admins can grant the admin role")
+			}
+		}
+		if err == nil {
+			var dup bool
+			dup, err = h.userImportDuplicate(ctx, row.Item, seen)
+			if err != nil {
+				WriteError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			if dup && onDuplicate == "skip" {
+				skipped++
+				continue
+			}
+			if dup {
+				msg := fmt.Sprintf("User with username '%s' or email '%s' already exists",
+					strings.ToLower(row.Item["username"].(string)), strings.ToLower(row.Item["email"].(string)))
+				if mode == "atomic" {
+					WriteError(w, http.StatusConflict, fmt.Sprintf("Row %d: %s", row.Row, msg))
+					return
+				}
+				failures = append(failures, importFailure{Row: row.Row, Message: msg})
+				continue
+			}
+		}
+		if err != nil {
+			if mode == "atomic" {
+				WriteErrorFrom(w, http.StatusBadRequest, fmt.Errorf("Row %d: %w", row.Row, err))
+				return
+			}
+			failures = append(failures, importFailure{Row: row.Row, Message: err.Error()})
+			continue
+		}
+		accepted = append(accepted, row)
+	}
+
+	physical := make([]map[string]any, 0, len(accepted))
+	for _, row := range accepted {
+		userRow, err := newImportedUserRow(row.Item)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		physical = append(physical, userRow)
+	}
+
+	success := 0
+	if mode == "atomic" {
+		if len(physical) > 0 {
+			if err := h.db.InsertRows(ctx, "users", physical); err != nil {
+				writeDBError(w, err)
+				return
+			}
+		}
+		success = len(physical)
+	} else {
+		for i, userRow := range physical {
+			if err := h.db.InsertRow(ctx, "users", userRow); err != nil {
+				_, msg := dbErrorResponse(err)
+				failures = append(failures, importFailure{Row: accepted[i].Row, Message: msg})
+				continue
+			}
+			success++
+		}
+	}
+
+	status := http.StatusCreated
+	if success == 0 {
+		status = http.StatusOK
+	}
+	meta := map[string]any{"success": success, "failed": len(failures), "skipped": skipped}
+	WriteSuccessFull(w, status, "Users imported successfully", failures, meta, nil)
+}
+
+// validateUserImportItem applies the op=create rules for users, except
+// that exactly one of password or password_hash is required. A plaintext
+// password must meet policy.
+func validateUserImportItem(item map[string]any, policy PasswordPolicy) error {
+	fieldMap := buildFieldMap(userImportCollection)
+	for key := range item {
+		if _, ok := fieldMap[key]; !ok {
+			return fmt.Errorf("Unknown field '%s'", key)
+		}
+	}
+	for _, name := range []string{"username", "email", "role"} {
+		if s, _ := item[name].(string); s == "" {
+			return fmt.Errorf("Field '%s' is required", name)
+		}
+	}
+	if !isValidEmail(item["email"].(string)) {
+		return fmt.Errorf("Invalid email address")
+	}
+	for _, name := range []string{"can_write", "enabled"} {
+		if v, ok := item[name]; ok && v != nil {
+			if _, ok := v.(bool); !ok {
+				return fmt.Errorf("Field '%s' must be a boolean", name)
+			}
+		}
+	}
+
+	password, _ := item["password"].(string)
+	hash, _ := item["password_hash"].(string)
+	switch {
+	case password == "" && hash == "":
+		return fmt.Errorf("Field 'password' or 'password_hash' is required")
+	case password != "" && hash != "":
+		return fmt.Errorf("Fields 'password' and 'password_hash' are mutually exclusive")
+	case password != "":
+		if err := policy.Validate(password); err != nil {
+			return errors.New(passwordPolicyViolation(err))
+		}
+	default:
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return fmt.Errorf("Field 'password_hash' must be a bcrypt hash")
+		}
+	}
+	return nil
+}
+
+// userImportDuplicate reports whether the row's username or email is
+// already taken, either by an existing user or by an earlier row.
+func (h *ResourceTransferHandler) userImportDuplicate(ctx context.Context, item map[string]any, seen map[string]bool) (bool, error) {
+	username := strings.ToLower(item["username"].(string))
+	email := strings.ToLower(item["email"].(string))
+	if seen["username:"+username] || seen["email:"+email] {
+		return true, nil
+	}
+	for _, f := range []Filter{
+		{Field: "username", Op: "eq", Value: username},
+		{Field: "email", Op: "eq", Value: email},
+	} {
+		rows, _, err := h.db.QueryRows(ctx, "users", QueryOptions{Filters: []Filter{f}, Page: 1, PerPage: 1})
+		if err != nil {
+			return false, err
+		}
+		if len(rows) > 0 {
+			return true, nil
+		}
+	}
+	seen["username:"+username] = true
+	seen["email:"+email] = true
+	return false, nil
+}
+
+// newImportedUserRow builds the physical users row for a validated import
+// item, hashing a plaintext password at BcryptCost.
+func newImportedUserRow(item map[string]any) (map[string]any, error) {
+	hash, _ := item["password_hash"].(string)
+	if password, _ := item["password"].(string); password != "" {
+		var err error
+		if hash, err = HashPassword(password); err != nil {
+			return nil, err
+		}
+	}
+	canWrite, _ := item["can_write"].(bool)
+	row := newUserRow(item["username"].(string), item["email"].(string), item["role"].(string), canWrite, hash)
+	if enabled, ok := item["enabled"].(bool); ok {
+		row["enabled"] = boolToInt(enabled)
+	}
+	return row, nil
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func setupUserTransferTest(t *testing.T) (*ResourceTransferHandler, *SQLiteAdapter) {
+	t.Helper()
+	_, adapter, registry := setupResourceQueryTest(t)
+	seedUsers(t, adapter)
+	if err := adapter.ExecDDL(context.Background(), ddlRolesTable); err != nil {
+		t.Fatalf("ExecDDL roles: %v", err)
+	}
+	return NewResourceTransferHandler(adapter, registry), adapter
+}
+
+func testBcryptHash(t *testing.T, password string) string {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("GenerateFromPassword: %v", err)
+	}
+	return string(hash)
+}
+
+func findUser(t *testing.T, adapter *SQLiteAdapter, username string) map[string]any {
+	t.Helper()
+	rows, _, err := adapter.QueryRows(context.Background(), "users", QueryOptions{
+		Filters: []Filter{{Field: "username", Op: "eq", Value: username}},
+		Page:    1,
+		PerPage: 1,
+	})
+	if err != nil {
+		t.Fatalf("QueryRows: %v", err)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	return rows[0]
+}
+
+func TestUserExport_OmitsPasswordHash(t *testing.T) {
+	h, _ := setupUserTransferTest(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/data/users:export", nil)
+	req = req.WithContext(SetAuthIdentity(req.Context(), adminIdentity()))
+	w := httptest.NewRecorder()
+	h.HandleExport(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("parse csv: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected header + 1 user, got %d", len(records))
+	}
+	header := strings.Join(records[0], ",")
+	if strings.Contains(header, "password_hash") || !strings.Contains(header, "username") {
+		t.Errorf("unexpected header: %s", header)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/data/users:export?format=ndjson", nil)
+	req = req.WithContext(SetAuthIdentity(req.Context(), adminIdentity()))
+	w = httptest.NewRecorder()
+	h.HandleExport(w, req)
+	if strings.Contains(w.Body.String(), "password_hash") {
+		t.Errorf("ndjson export leaked password_hash: %s", w.Body.String())
+	}
+}
+
+func TestUserExport_IncludeHashes(t *testing.T) {
+	h, adapter := setupUserTransferTest(t)
+	export := func(target string, identity *AuthIdentity) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req = req.WithContext(SetAuthIdentity(req.Context(), identity))
+		w := httptest.NewRecorder()
+		h.HandleExport(w, req)
+		return w
+	}
+
+	w := export("/data/users:export?format=ndjson&include_hashes=true", adminIdentity())
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"password_hash":"$2a$12$fakehash"`) {
+		t.Fatalf("expected the hash to be exported, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// A hash export re-imports without knowing the password.
+	if err := adapter.DeleteRow(context.Background(), "users", "U001"); err != nil {
+		t.Fatal(err)
+	}
+	hash := testBcryptHash(t, "Migrated1")
+	body := "username,email,role,can_write,password_hash\nmigrated,migrated@example.com,user,false," + hash + "\n"
+	req := httptest.NewRequest(http.MethodPost, "/data/users:import", strings.NewReader(body))
+	req = req.WithContext(SetAuthIdentity(req.Context(), adminIdentity()))
+	imp := httptest.NewRecorder()
+	h.HandleImport(imp, req)
+	if imp.Code != http.StatusOK && imp.Code != http.StatusCreated {
+		t.Fatalf("import: got %d: %s", imp.Code, imp.Body.String())
+	}
+	if user := findUser(t, adapter, "migrated"); user == nil || user["password_hash"] != hash {
+		t.Errorf("expected the hash to round-trip, got %v", user)
+	}
+
+	support := &AuthIdentity{CredentialType: CredentialTypeJWT, CallerID: "support-id", Role: "support", Permissions: &RolePermissions{Users: true}}
+	if w := export("/data/users:export", support); w.Code != http.StatusOK {
+		t.Errorf("expected a user manager to export users, got %d", w.Code)
+	}
+	if w := export("/data/users:export?include_hashes=true", support); w.Code != http.StatusForbidden {
+		t.Errorf("expected include_hashes to require admin, got %d", w.Code)
+	}
+	if w := export("/data/users:export?include_hashes=yes", adminIdentity()); w.Code != http.StatusBadRequest {
+		t.Errorf("expected an invalid include_hashes to be rejected, got %d", w.Code)
+	}
+}
+
+func TestAPIKeyExport(t *testing.T) {
+	h, adapter := setupUserTransferTest(t)
+	seedAPIKeys(t, adapter)
+
+	req := httptest.NewRequest(http.MethodGet, "/data/apikeys:export", nil)
+	req = req.WithContext(SetAuthIdentity(req.Context(), adminIdentity()))
+	w := httptest.NewRecorder()
+	h.HandleExport(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("parse csv: %v", err)
+	}
+	if header := strings.Join(records[0], ","); len(records) != 2 || strings.Contains(header, "key_hash") || !strings.Contains(header, "name") {
+		t.Errorf("unexpected export: %v", records)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/data/apikeys:export?format=ndjson&include_hashes=true", nil)
+	req = req.WithContext(SetAuthIdentity(req.Context(), adminIdentity()))
+	w = httptest.NewRecorder()
+	h.HandleExport(w, req)
+	if !strings.Contains(w.Body.String(), `"key_hash":"abc123hash"`) {
+		t.Errorf("expected key_hash with include_hashes, got %s", w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/data/apikeys:import", strings.NewReader("name\nbob\n"))
+	req = req.WithContext(SetAuthIdentity(req.Context(), adminIdentity()))
+	w = httptest.NewRecorder()
+	h.HandleImport(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected apikeys import to be rejected, got %d", w.Code)
+	}
+}
+
+func TestUserImport_CSVWithPasswordAndHash(t *testing.T) {
+	h, adapter := setupUserTransferTest(t)
+
+	hash := testBcryptHash(t, "Legacy-Pass-123")
+	body := "username,email,role,can_write,password,password_hash\n" +
+		"Alice,Alice@Example.com,user,true,Str0ng-Password!,\n" +
+		"bob,bob@example.com,admin,,," + hash + "\n"
+	w := doImport(t, h, "/data/users:import", "text/csv", body)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	meta := decodeResponse(t, w)["meta"].(map[string]any)
+	if meta["success"] != float64(2) || meta["failed"] != float64(0) || meta["skipped"] != float64(0) {
+		t.Errorf("unexpected meta: %v", meta)
+	}
+
+	alice := findUser(t, adapter, "alice")
+	if alice == nil {
+		t.Fatal("expected alice to be imported with a lowercase username")
+	}
+	if alice["email"] != "alice@example.com" || toBool(alice["can_write"]) != true {
+		t.Errorf("unexpected alice row: %v", alice)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(alice["password_hash"].(string)), []byte("Str0ng-Password!")); err != nil {
+		t.Errorf("expected plaintext password to be hashed: %v", err)
+	}
+
+	bob := findUser(t, adapter, "bob")
+	if bob == nil || bob["password_hash"] != hash {
+		t.Errorf("expected pre-hashed password to be stored as-is, got %v", bob)
+	}
+}
+
+func TestUserImport_Duplicates(t *testing.T) {
+	body := `{"username":"admin","email":"other@example.com","role":"user","password_hash":"%s"}
+{"username":"carol","email":"carol@example.com","role":"user","password_hash":"%s"}
+{"username":"carol2","email":"CAROL@example.com","role":"user","password_hash":"%s"}
+`
+
+	tests := []struct {
+		name    string
+		query   string
+		status  int
+		success float64
+		skipped float64
+		failed  float64
+	}{
+		{"atomic fail", "format=ndjson", http.StatusConflict, 0, 0, 0},
+		{"best effort fail", "format=ndjson&mode=best_effort", http.StatusCreated, 1, 0, 2},
+		{"atomic skip", "format=ndjson&on_duplicate=skip", http.StatusCreated, 1, 2, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, adapter := setupUserTransferTest(t)
+			hash := testBcryptHash(t, "Legacy-Pass-123")
+			payload := strings.ReplaceAll(body, "%s", hash)
+
+			w := doImport(t, h, "/data/users:import?"+tt.query, "application/x-ndjson", payload)
+			if w.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.status == http.StatusConflict {
+				if findUser(t, adapter, "carol") != nil {
+					t.Error("atomic import must not insert any row")
+				}
+				return
+			}
+			meta := decodeResponse(t, w)["meta"].(map[string]any)
+			if meta["success"] != tt.success || meta["skipped"] != tt.skipped || meta["failed"] != tt.failed {
+				t.Errorf("unexpected meta: %v", meta)
+			}
+		})
+	}
+}
+
+func TestUserImport_Validation(t *testing.T) {
+	h, _ := setupUserTransferTest(t)
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"missing password", "username,email,role\nzed,zed@example.com,user\n", "Row 1: Field 'password' or 'password_hash' is required"},
+		{"both passwords", "username,email,role,password,password_hash\nzed,zed@example.com,user,Str0ng-Password!,x\n", "Row 1: Fields 'password' and 'password_hash' are mutually exclusive"},
+		{"bad hash", "username,email,role,password_hash\nzed,zed@example.com,user,md5:abc\n", "Row 1: Field 'password_hash' must be a bcrypt hash"},
+		{"bad role", "username,email,role,password\nzed,zed@example.com,owner,Str0ng-Password!\n", "Row 1: Field 'role' must be 'admin', 'user', or a defined role"},
+		{"bad email", "username,email,role,password\nzed,nope,user,Str0ng-Password!\n", "Row 1: Invalid email address"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doImport(t, h, "/data/users:import", "text/csv", tt.body)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d: %s", w.Code, w.Body.String())
+			}
+			if msg := decodeResponse(t, w)["message"]; msg != tt.want {
+				t.Errorf("expected %q, got %v", tt.want, msg)
+			}
+		})
+	}
+
+	w := doImport(t, h, "/data/users:import", "text/csv", "username,nickname\nzed,z\n")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown column, got %d", w.Code)
+	}
+}
+
+func TestUserImport_RequiresAdmin(t *testing.T) {
+	h, _ := setupUserTransferTest(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/data/users:import", strings.NewReader("username\nzed\n"))
+	req = req.WithContext(SetAuthIdentity(req.Context(), userWriteIdentity()))
+	w := httptest.NewRecorder()
+	h.HandleImport(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", w.Code)
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// resourceUpsertRequest is the JSON body for POST /data/{resource}:upsert.
+type resourceUpsertRequest struct {
+	Data []json.RawMessage `json:"data"`
+	On   string            `json:"on,omitempty"`   // "id" (default) or a unique field
+	Mode string            `json:"mode,omitempty"` // atomic (default) or best_effort
+}
+
+// upsertWrite is one prepared item of an upsert request.
+type upsertWrite struct {
+	write  BatchWrite
+	value  any            // the key value, as stored
+	before map[string]any // the stored record when one matched at check time
+}
+
+// HandleUpsert handles POST /data/{resource}:upsert. Each item is inserted,
+// or, when a record with the same value of the on field exists, written
+// over that record. Items are checked before anything is written, and the
+// modes match those of a users :mutate request: atomic applies every write
+// in one transaction or none, best_effort writes every valid item on its
+// own.
+func (h *ResourceMutateHandler) HandleUpsert(w http.ResponseWriter, r *http.Request) {
+	resource := extractResource(r.URL.Path)
+	if resource == "" {
+		WriteError(w, http.StatusBadRequest, "Missing resource name")
+		return
+	}
+	col, ok := h.registry.Get(resource)
+	if !ok {
+		WriteError(w, http.StatusNotFound, fmt.Sprintf("Resource '%s' not found", resource))
+		return
+	}
+	identity, ok := GetAuthIdentity(r.Context())
+	if !ok {
+		WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if err := h.authorize(resource, identity); err != nil {
+		WriteError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+	if col.System {
+		WriteError(w, http.StatusBadRequest, fmt.Sprintf("Resource '%s' does not support upsert", resource))
+		return
+	}
+
+	var req resourceUpsertRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Data == nil {
+		WriteError(w, http.StatusBadRequest, "Missing required field: data")
+		return
+	}
+	if len(req.Data) == 0 {
+		WriteError(w, http.StatusBadRequest, "Data must not be empty")
+		return
+	}
+	if len(req.Data) > MaxUpsertItems {
+		WriteError(w, http.StatusBadRequest, fmt.Sprintf("Data exceeds %d items", MaxUpsertItems))
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = "atomic"
+	}
+	if req.Mode != "atomic" && req.Mode != "best_effort" {
+		WriteError(w, http.StatusBadRequest, "Invalid mode: must be atomic or best_effort")
+		return
+	}
+	if req.On == "" {
+		req.On = "id"
+	}
+	if !upsertKeyAllowed(col, req.On) {
+		WriteErrorCode(w, http.StatusBadRequest, ErrCodeValidationFailed,
+			fmt.Sprintf("Field 'on' must be id or a unique field, not '%s'", req.On),
+			ErrorDetail{Field: "on", Message: "must be id or a unique field"})
+		return
+	}
+
+	ctx := r.Context()
+	atomic := req.Mode == "atomic"
+	fieldMap := buildFieldMap(col)
+
+	writes := make([]upsertWrite, 0, len(req.Data))
+	failed := 0
+	for i, raw := range req.Data {
+		var item map[string]any
+		if err := json.Unmarshal(raw, &item); err != nil {
+			WriteError(w, http.StatusBadRequest, "Invalid upsert item")
+			return
+		}
+		uw, berr := h.prepareUpsert(ctx, r, col, fieldMap, req.On, item)
+		if berr != nil {
+			if berr.status == http.StatusInternalServerError {
+				berr.write(w, "")
+				return
+			}
+			if atomic {
+				berr.write(w, fmt.Sprintf("Item %d: ", i+1))
+				return
+			}
+			failed++
+			continue
+		}
+		writes = append(writes, uw)
+	}
+
+	applied := writes
+	if atomic {
+		batch := make([]BatchWrite, len(writes))
+		for i, uw := range writes {
+			batch[i] = uw.write
+		}
+		if idx, err := h.db.ExecWriteBatch(ctx, batch); err != nil {
+			if idx < len(batch) && errors.Is(err, ErrNoRowAffected) {
+				upsertTaken(batch[idx].Key).write(w, fmt.Sprintf("Item %d: ", idx+1))
+				return
+			}
+			if idx < len(batch) && isConstraintViolation(err) {
+				status, msg := dbErrorResponse(err)
+				WriteErrorCode(w, status, dbErrorCode(err), fmt.Sprintf("Item %d: %s", idx+1, msg))
+				return
+			}
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+	} else {
+		applied = make([]upsertWrite, 0, len(writes))
+		for _, uw := range writes {
+			if _, err := h.db.ExecWriteBatch(ctx, []BatchWrite{uw.write}); err != nil {
+				if !isConstraintViolation(err) && !errors.Is(err, ErrNoRowAffected) {
+					WriteError(w, http.StatusInternalServerError, "Internal server error")
+					return
+				}
+				failed++
+				continue
+			}
+			applied = append(applied, uw)
+		}
+	}
+
+	results := make([]any, 0, len(applied))
+	for _, uw := range applied {
+		rows, _, err := h.db.QueryRows(ctx, resource, QueryOptions{
+			Filters: []Filter{{Field: uw.write.Key, Op: "eq", Value: uw.value}},
+			Page:    1,
+			PerPage: 1,
+		})
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		if len(rows) == 0 {
+			// Destroyed by another request since it was written.
+			continue
+		}
+		record := filterHiddenFields(resource, formatRecord(rows[0], col))
+		op := "create"
+		if uw.before != nil {
+			op = "update"
+		}
+		h.auditMutation(w, r, op, resource, stringVal(record, "id"), uw.before, record)
+		results = append(results, record)
+	}
+
+	meta := map[string]any{"success": len(applied), "failed": failed}
+	WriteSuccessFull(w, http.StatusOK, "Resource upserted successfully", results, meta, nil)
+}
+
+// upsertKeyAllowed reports whether an upsert may match records of col on
+// field: id, a unique field, or the only column of a unique index.
+func upsertKeyAllowed(col *Collection, field string) bool {
+	if field == "id" {
+		return true
+	}
+	for _, f := range col.Fields {
+		if f.Name == field {
+			if f.Unique {
+				return true
+			}
+			break
+		}
+	}
+	for _, idx := range col.Indexes {
+		if idx.Unique && len(idx.Columns) == 1 && idx.Columns[0] == field {
+			return true
+		}
+	}
+	return false
+}
+
+// prepareUpsert applies the op=create checks to item and builds the upsert
+// that matches on key. A record that already holds the key value is
+// checked by the collection validator as an update, and must belong to the
+// caller in an owned collection.
+func (h *ResourceMutateHandler) prepareUpsert(ctx context.Context, r *http.Request, col *Collection, fieldMap map[string]Field, key string, item map[string]any) (upsertWrite, *batchError) {
+	fields := make(map[string]any, len(item))
+	for k, v := range item {
+		if k != "id" {
+			fields[k] = v
+		}
+	}
+
+	var id string
+	var value any
+	if key == "id" {
+		id, _ = item["id"].(string)
+		if _, err := ulid.ParseStrict(id); err != nil {
+			return upsertWrite{}, newBatchError(http.StatusBadRequest,
+				fieldError(ErrCodeValidationFailed, "id", "Field 'id' must be a valid ULID"))
+		}
+		value = id
+	} else {
+		if _, hasID := item["id"]; hasID {
+			return upsertWrite{}, &batchError{status: http.StatusBadRequest, msg: fmt.Sprintf("Field 'id' must not be provided for upsert on '%s'", key)}
+		}
+		if fields[key] == nil {
+			return upsertWrite{}, newBatchError(http.StatusBadRequest,
+				fieldError(ErrCodeValidationFailed, key, fmt.Sprintf("Field '%s' is required for upsert", key)))
+		}
+	}
+	if err := validateBatchFields(fields, col, fieldMap); err != nil {
+		return upsertWrite{}, err
+	}
+	if key != "id" {
+		value = prepareValueForDB(fields[key], fieldMap[key].Type)
+	}
+
+	existing, _, err := h.db.QueryRows(ctx, col.Name, QueryOptions{
+		Filters: []Filter{{Field: key, Op: "eq", Value: value}},
+		Page:    1,
+		PerPage: 1,
+	})
+	if err != nil {
+		return upsertWrite{}, &batchError{status: http.StatusInternalServerError, msg: "Internal server error"}
+	}
+
+	op, candidate := "create", fields
+	var before map[string]any
+	if len(existing) > 0 {
+		// Another caller's record must not be written over; to this caller
+		// the value is simply taken.
+		for _, f := range ownerFilters(r, col) {
+			if stringVal(existing[0], f.Field) != f.Value {
+				return upsertWrite{}, upsertTaken(key)
+			}
+		}
+		before = filterHiddenFields(col.Name, formatRecord(existing[0], col))
+		op, candidate = "update", maps.Clone(before)
+		maps.Copy(candidate, fields)
+	}
+	messages, err := h.validators.Check(ctx, op, col.Name, candidate)
+	if err != nil {
+		return upsertWrite{}, &batchError{status: http.StatusInternalServerError, msg: "Internal server error"}
+	}
+	if len(messages) > 0 {
+		return upsertWrite{}, &batchError{status: http.StatusBadRequest, msg: validatorRejection(messages), code: ErrCodeValidationFailed}
+	}
+
+	row := newDynamicRow(fields, col, callerID(r))
+	if id != "" {
+		row["id"] = id
+	}
+	update := make([]string, 0, len(fields)+1)
+	for _, k := range slices.Sorted(maps.Keys(fields)) {
+		if k != key {
+			update = append(update, k)
+		}
+	}
+	if _, ok := row[FieldUpdatedAt]; ok {
+		update = append(update, FieldUpdatedAt)
+	}
+	wr := BatchWrite{Op: BatchUpsert, Table: col.Name, ID: row["id"].(string), Data: row, Key: key, Update: update}
+	if f, ok := fieldMap[FieldVersion]; ok && isVersionField(f) {
+		wr.Versioned = true
+	}
+	// The owner check above read the record before the write; the guard
+	// repeats it in the statement, in case the record changed hands or
+	// was created in between.
+	for _, f := range ownerFilters(r, col) {
+		if wr.Guard == nil {
+			wr.Guard = make(map[string]any)
+		}
+		wr.Guard[f.Field] = f.Value
+	}
+	return upsertWrite{write: wr, value: value, before: before}, nil
+}
+
+// upsertTaken is the error for an upsert whose key value belongs to a
+// record the caller may not update.
+func upsertTaken(key string) *batchError {
+	return &batchError{status: http.StatusConflict,
+		msg: fmt.Sprintf("Unique constraint violation for field: %s", key), code: ErrCodeUniqueViolation}
+}
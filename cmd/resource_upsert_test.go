@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// setupUpsertTest adds a parts collection with a unique sku and an owner
+// to the mutate test database.
+func setupUpsertTest(t *testing.T) (*ResourceMutateHandler, *SQLiteAdapter) {
+	t.Helper()
+	handler, adapter, registry := setupMutateTest(t)
+	ddl := `CREATE TABLE parts (id TEXT PRIMARY KEY, sku TEXT NOT NULL UNIQUE, name TEXT NOT NULL, owner_id TEXT)`
+	if err := adapter.ExecDDL(context.Background(), ddl); err != nil {
+		t.Fatalf("ExecDDL parts: %v", err)
+	}
+	if err := registry.Refresh(); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	return handler, adapter
+}
+
+func doUpsertRequest(t *testing.T, handler *ResourceMutateHandler, resource string, body any, identity *AuthIdentity) *httptest.ResponseRecorder {
+	t.Helper()
+	b, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("marshal body: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/data/%s:upsert", resource), bytes.NewReader(b))
+	req = req.WithContext(SetAuthIdentity(req.Context(), identity))
+	w := httptest.NewRecorder()
+	handler.HandleUpsert(w, req)
+	return w
+}
+
+func TestUpsert_ByUniqueField(t *testing.T) {
+	handler, adapter := setupUpsertTest(t)
+	alice := userWriteIdentity()
+
+	body := map[string]any{"on": "sku", "data": []any{map[string]any{"sku": "SP-1", "name": "sprocket"}}}
+	w := doUpsertRequest(t, handler, "parts", body, alice)
+	if w.Code != http.StatusOK {
+		t.Fatalf("insert: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	first := parseResponse(t, w)["data"].([]any)[0].(map[string]any)
+
+	body = map[string]any{"on": "sku", "data": []any{
+		map[string]any{"sku": "SP-1", "name": "big sprocket"},
+		map[string]any{"sku": "CG-2", "name": "cog"},
+	}}
+	w = doUpsertRequest(t, handler, "parts", body, alice)
+	if w.Code != http.StatusOK {
+		t.Fatalf("upsert: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	resp := parseResponse(t, w)
+	data := resp["data"].([]any)
+	if len(data) != 2 {
+		t.Fatalf("expected 2 records, got %v", data)
+	}
+	updated := data[0].(map[string]any)
+	if updated["id"] != first["id"] || updated["name"] != "big sprocket" || updated["owner_id"] != alice.CallerID {
+		t.Errorf("unexpected updated record %v", updated)
+	}
+	if count, _ := adapter.CountRows(context.Background(), "parts"); count != 2 {
+		t.Errorf("expected 2 rows, got %d", count)
+	}
+
+	// Another user's record is not taken over.
+	bob := &AuthIdentity{CredentialType: CredentialTypeJWT, CallerID: "bob-id", Role: "user", CanWrite: true}
+	body = map[string]any{"on": "sku", "data": []any{map[string]any{"sku": "SP-1", "name": "stolen"}}}
+	w = doUpsertRequest(t, handler, "parts", body, bob)
+	if w.Code != http.StatusConflict || parseResponse(t, w)["code"] != ErrCodeUniqueViolation {
+		t.Fatalf("expected 409 unique_violation, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// racingWriteDB runs before once ahead of the first ExecWriteBatch, to
+// stand in for a request that writes between a handler's read and write.
+type racingWriteDB struct {
+	DatabaseAdapter
+	before func()
+}
+
+func (d *racingWriteDB) ExecWriteBatch(ctx context.Context, writes []BatchWrite) (int, error) {
+	if d.before != nil {
+		d.before()
+		d.before = nil
+	}
+	return d.DatabaseAdapter.ExecWriteBatch(ctx, writes)
+}
+
+func TestUpsert_OwnerGuardedInStatement(t *testing.T) {
+	handler, adapter := setupUpsertTest(t)
+	handler.db = &racingWriteDB{DatabaseAdapter: adapter, before: func() {
+		if err := adapter.InsertRow(context.Background(), "parts", map[string]any{
+			"id": GenerateULID(), "sku": "SP-1", "name": "bob's", "owner_id": "bob-id",
+		}); err != nil {
+			t.Fatalf("InsertRow: %v", err)
+		}
+	}}
+
+	body := map[string]any{"on": "sku", "data": []any{map[string]any{"sku": "SP-1", "name": "sprocket"}}}
+	w := doUpsertRequest(t, handler, "parts", body, userWriteIdentity())
+	if w.Code != http.StatusConflict || parseResponse(t, w)["code"] != ErrCodeUniqueViolation {
+		t.Fatalf("expected 409 unique_violation, got %d: %s", w.Code, w.Body.String())
+	}
+	rows, _, _ := adapter.QueryRows(context.Background(), "parts", QueryOptions{Page: 1, PerPage: 10})
+	if len(rows) != 1 || rows[0]["name"] != "bob's" {
+		t.Errorf("expected bob's record unchanged, got %v", rows)
+	}
+}
+
+func TestUpsert_ByID(t *testing.T) {
+	handler, _ := setupUpsertTest(t)
+	id := GenerateULID()
+
+	for _, name := range []string{"sprocket", "big sprocket"} {
+		body := map[string]any{"data": []any{map[string]any{"id": id, "sku": "SP-1", "name": name}}}
+		w := doUpsertRequest(t, handler, "parts", body, adminIdentity())
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		record := parseResponse(t, w)["data"].([]any)[0].(map[string]any)
+		if record["id"] != id || record["name"] != name {
+			t.Errorf("unexpected record %v", record)
+		}
+	}
+
+	body := map[string]any{"data": []any{map[string]any{"id": "not-a-ulid", "sku": "X", "name": "x"}}}
+	if w := doUpsertRequest(t, handler, "parts", body, adminIdentity()); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid id: expected 400, got %d", w.Code)
+	}
+}
+
+func TestUpsert_Modes(t *testing.T) {
+	handler, adapter := setupUpsertTest(t)
+	items := []any{
+		map[string]any{"sku": "SP-1", "name": "sprocket"},
+		map[string]any{"sku": "CG-2", "bogus": true},
+	}
+
+	w := doUpsertRequest(t, handler, "parts", map[string]any{"on": "sku", "data": items}, adminIdentity())
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("atomic: expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+	if msg, _ := parseResponse(t, w)["message"].(string); msg[:8] != "Item 2: " {
+		t.Errorf("atomic: unexpected message %q", msg)
+	}
+	if count, _ := adapter.CountRows(context.Background(), "parts"); count != 0 {
+		t.Fatalf("atomic: expected no rows, got %d", count)
+	}
+
+	w = doUpsertRequest(t, handler, "parts", map[string]any{"on": "sku", "mode": "best_effort", "data": items}, adminIdentity())
+	if w.Code != http.StatusOK {
+		t.Fatalf("best_effort: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	meta := parseResponse(t, w)["meta"].(map[string]any)
+	if meta["success"] != float64(1) || meta["failed"] != float64(1) {
+		t.Errorf("best_effort: unexpected meta %v", meta)
+	}
+}
+
+func TestUpsert_RejectsInvalidRequests(t *testing.T) {
+	handler, _ := setupUpsertTest(t)
+	tests := []struct {
+		name     string
+		resource string
+		body     map[string]any
+	}{
+		{"non-unique key", "parts", map[string]any{"on": "name", "data": []any{map[string]any{"name": "x"}}}},
+		{"id with other key", "parts", map[string]any{"on": "sku", "data": []any{map[string]any{"id": GenerateULID(), "sku": "X", "name": "x"}}}},
+		{"missing key", "parts", map[string]any{"on": "sku", "data": []any{map[string]any{"name": "x"}}}},
+		{"empty data", "parts", map[string]any{"data": []any{}}},
+		{"bad mode", "parts", map[string]any{"mode": "eventually", "data": []any{map[string]any{"sku": "X"}}}},
+		{"system collection", "users", map[string]any{"data": []any{map[string]any{"username": "x"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doUpsertRequest(t, handler, tt.resource, tt.body, adminIdentity())
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("expected 400, got %d: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// resourceWhereRequest is the JSON body for POST /data/{resource}:updateWhere
+// and POST /data/{resource}:destroyWhere.
+type resourceWhereRequest struct {
+	Filter       map[string]json.RawMessage `json:"filter"` // keys as in :query, such as "price[gt]"
+	Data         map[string]any             `json:"data,omitempty"`
+	ConfirmCount *int                       `json:"confirm_count"`
+	DryRun       bool                       `json:"dry_run,omitempty"`
+}
+
+// HandleUpdateWhere handles POST /data/{resource}:updateWhere, which sets
+// the same fields on every record matching a filter in one statement.
+func (h *ResourceMutateHandler) HandleUpdateWhere(w http.ResponseWriter, r *http.Request) {
+	h.handleWhere(w, r, "update")
+}
+
+// HandleDestroyWhere handles POST /data/{resource}:destroyWhere, which
+// destroys every record matching a filter in one statement.
+func (h *ResourceMutateHandler) HandleDestroyWhere(w http.ResponseWriter, r *http.Request) {
+	h.handleWhere(w, r, "destroy")
+}
+
+// handleWhere serves both filtered writes. The request states how many
+// records it expects to change in confirm_count, and fails without
+// changing any when the filter matches more. A dry run only counts the
+// matching records.
+func (h *ResourceMutateHandler) handleWhere(w http.ResponseWriter, r *http.Request, op string) {
+	resource := extractResource(r.URL.Path)
+	if resource == "" {
+		WriteError(w, http.StatusBadRequest, "Missing resource name")
+		return
+	}
+	col, ok := h.registry.Get(resource)
+	if !ok {
+		WriteError(w, http.StatusNotFound, fmt.Sprintf("Resource '%s' not found", resource))
+		return
+	}
+	identity, ok := GetAuthIdentity(r.Context())
+	if !ok {
+		WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if err := h.authorize(resource, identity); err != nil {
+		WriteError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+	if col.System {
+		WriteError(w, http.StatusBadRequest, fmt.Sprintf("Resource '%s' does not support filtered writes", resource))
+		return
+	}
+
+	var req resourceWhereRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if len(req.Filter) == 0 {
+		WriteErrorCode(w, http.StatusBadRequest, ErrCodeValidationFailed, "Missing required field: filter",
+			ErrorDetail{Field: "filter", Message: "must name at least one condition"})
+		return
+	}
+	if req.ConfirmCount == nil && !req.DryRun {
+		WriteErrorCode(w, http.StatusBadRequest, ErrCodeValidationFailed, "Missing required field: confirm_count",
+			ErrorDetail{Field: "confirm_count", Message: "is required"})
+		return
+	}
+	if req.ConfirmCount != nil && *req.ConfirmCount < 0 {
+		WriteErrorCode(w, http.StatusBadRequest, ErrCodeValidationFailed, "Field 'confirm_count' must not be negative",
+			ErrorDetail{Field: "confirm_count", Message: "must not be negative"})
+		return
+	}
+	filters, err := parseWhereFilter(req.Filter, col)
+	if err != nil {
+		WriteErrorFrom(w, http.StatusBadRequest, err)
+		return
+	}
+	filters = append(filters, ownerFilters(r, col)...)
+
+	ctx := r.Context()
+	fieldMap := buildFieldMap(col)
+	dbData := make(map[string]any, len(req.Data)+1)
+	switch {
+	case op == "destroy" && req.Data != nil:
+		WriteError(w, http.StatusBadRequest, "Field 'data' is not accepted by destroyWhere")
+		return
+	case op == "update":
+		if len(req.Data) == 0 {
+			WriteError(w, http.StatusBadRequest, "Missing required field: data")
+			return
+		}
+		if berr := validateBatchFields(req.Data, col, fieldMap); berr != nil {
+			berr.write(w, "")
+			return
+		}
+		// A validator checks whole records, which a single UPDATE never
+		// reads.
+		m, err := h.validators.Lookup(ctx, resource)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		if m != nil {
+			WriteError(w, http.StatusBadRequest, fmt.Sprintf("Resource '%s' has a validator; update its records with :mutate", resource))
+			return
+		}
+		for k, v := range req.Data {
+			dbData[k] = prepareValueForDB(v, fieldMap[k].Type)
+		}
+		setTimestampFields(dbData, fieldMap, false)
+	}
+
+	_, matched, err := h.db.QueryRows(ctx, resource, QueryOptions{
+		Filters: filters,
+		Fields:  []string{"id"},
+		Page:    1,
+		PerPage: 1,
+	})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if req.DryRun {
+		meta := map[string]any{"matched": matched}
+		if req.ConfirmCount != nil {
+			meta["confirm_count"] = *req.ConfirmCount
+		}
+		WriteSuccessFull(w, http.StatusOK, "Dry run completed", []any{}, meta, nil)
+		return
+	}
+	limit := *req.ConfirmCount
+	if matched > limit {
+		writeConfirmCountExceeded(w, matched, limit)
+		return
+	}
+
+	var affected int
+	if op == "update" {
+		versioned := false
+		if f, ok := fieldMap[FieldVersion]; ok && isVersionField(f) {
+			versioned = true
+		}
+		affected, err = h.db.UpdateWhere(ctx, resource, filters, dbData, versioned, limit)
+	} else {
+		affected, err = h.db.DeleteWhere(ctx, resource, filters, limit)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrTooManyRows):
+			// More records matched by the time the statement ran.
+			writeConfirmCountExceeded(w, affected, limit)
+		case isConstraintViolation(err):
+			writeDBError(w, err)
+		default:
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+		}
+		return
+	}
+
+	var after map[string]any
+	if op == "update" {
+		after = req.Data
+	}
+	h.auditMutation(w, r, op+"_where", resource, "", nil, after)
+
+	message := "Resources updated successfully"
+	if op == "destroy" {
+		message = "Resources destroyed successfully"
+	}
+	WriteSuccessFull(w, http.StatusOK, message, []any{}, map[string]any{"affected": affected}, nil)
+}
+
+// parseWhereFilter parses the filter of a filtered write, whose keys and
+// values are :query filter parameters. Values may be JSON strings,
+// numbers, or booleans.
+func parseWhereFilter(filter map[string]json.RawMessage, col *Collection) ([]Filter, error) {
+	q := make(url.Values, len(filter))
+	for key, raw := range filter {
+		if !filterParamPattern.MatchString(key) {
+			return nil, &APIError{Code: ErrCodeUnknownParameter, Message: fmt.Sprintf("Unknown filter %q: expected field[operator]", key)}
+		}
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			var v any
+			if json.Unmarshal(raw, &v) != nil {
+				return nil, fmt.Errorf("Invalid value for filter %q", key)
+			}
+			switch v.(type) {
+			case float64, bool:
+				s = strings.TrimSpace(string(raw))
+			default:
+				return nil, fmt.Errorf("Invalid value for filter %q: must be a string, number, or boolean", key)
+			}
+		}
+		q.Set(key, s)
+	}
+	return parseFilterParams(q, col)
+}
+
+// writeConfirmCountExceeded reports a filtered write that matched more
+// records than its confirm_count.
+func writeConfirmCountExceeded(w http.ResponseWriter, matched, limit int) {
+	WriteErrorCode(w, http.StatusConflict, ErrCodeConfirmCountExceeded,
+		fmt.Sprintf("Filter matches %d records, more than confirm_count %d", matched, limit))
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func doWhereRequest(t *testing.T, handler *ResourceMutateHandler, resource, action string, body any, identity *AuthIdentity) *httptest.ResponseRecorder {
+	t.Helper()
+	b, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("marshal body: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/data/%s:%s", resource, action), bytes.NewReader(b))
+	req = req.WithContext(SetAuthIdentity(req.Context(), identity))
+	w := httptest.NewRecorder()
+	if action == "updateWhere" {
+		handler.HandleUpdateWhere(w, req)
+	} else {
+		handler.HandleDestroyWhere(w, req)
+	}
+	return w
+}
+
+// seedWhereProducts inserts products with quantities 1 to 4.
+func seedWhereProducts(t *testing.T, adapter *SQLiteAdapter) {
+	t.Helper()
+	for i := 1; i <= 4; i++ {
+		row := map[string]any{"id": GenerateULID(), "title": fmt.Sprintf("p%d", i), "quantity": int64(i)}
+		if err := adapter.InsertRow(context.Background(), "products", row); err != nil {
+			t.Fatalf("InsertRow: %v", err)
+		}
+	}
+}
+
+func TestUpdateWhere(t *testing.T) {
+	handler, adapter, _ := setupMutateTest(t)
+	seedWhereProducts(t, adapter)
+	filter := map[string]any{"quantity[gte]": 3}
+	data := map[string]any{"active": false}
+
+	w := doWhereRequest(t, handler, "products", "updateWhere", map[string]any{"filter": filter, "data": data, "dry_run": true}, adminIdentity())
+	if w.Code != http.StatusOK {
+		t.Fatalf("dry run: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if meta := parseResponse(t, w)["meta"].(map[string]any); meta["matched"] != float64(2) {
+		t.Errorf("dry run: expected matched=2, got %v", meta)
+	}
+
+	body := map[string]any{"filter": filter, "data": data, "confirm_count": 1}
+	w = doWhereRequest(t, handler, "products", "updateWhere", body, adminIdentity())
+	if w.Code != http.StatusConflict || parseResponse(t, w)["code"] != ErrCodeConfirmCountExceeded {
+		t.Fatalf("expected 409 confirm_count_exceeded, got %d: %s", w.Code, w.Body.String())
+	}
+
+	body["confirm_count"] = 2
+	w = doWhereRequest(t, handler, "products", "updateWhere", body, adminIdentity())
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if meta := parseResponse(t, w)["meta"].(map[string]any); meta["affected"] != float64(2) {
+		t.Errorf("expected affected=2, got %v", meta)
+	}
+	rows, _, _ := adapter.QueryRows(context.Background(), "products", QueryOptions{
+		Filters: []Filter{{Field: "active", Op: "eq", Value: 0}},
+	})
+	if len(rows) != 2 {
+		t.Errorf("expected 2 inactive products, got %d", len(rows))
+	}
+}
+
+func TestDestroyWhere(t *testing.T) {
+	handler, adapter, _ := setupMutateTest(t)
+	seedWhereProducts(t, adapter)
+
+	body := map[string]any{"filter": map[string]any{"title[in]": "p1,p2"}, "confirm_count": 5}
+	w := doWhereRequest(t, handler, "products", "destroyWhere", body, userWriteIdentity())
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if meta := parseResponse(t, w)["meta"].(map[string]any); meta["affected"] != float64(2) {
+		t.Errorf("expected affected=2, got %v", meta)
+	}
+	if count, _ := adapter.CountRows(context.Background(), "products"); count != 2 {
+		t.Errorf("expected 2 products left, got %d", count)
+	}
+}
+
+func TestWhere_RejectsInvalidRequests(t *testing.T) {
+	handler, adapter, _ := setupMutateTest(t)
+	seedWhereProducts(t, adapter)
+	tests := []struct {
+		name   string
+		action string
+		body   map[string]any
+	}{
+		{"missing confirm_count", "destroyWhere", map[string]any{"filter": map[string]any{"quantity[gt]": 0}}},
+		{"negative confirm_count", "destroyWhere", map[string]any{"filter": map[string]any{"quantity[gt]": 0}, "confirm_count": -1}},
+		{"empty filter", "destroyWhere", map[string]any{"filter": map[string]any{}, "confirm_count": 10}},
+		{"unknown filter key", "destroyWhere", map[string]any{"filter": map[string]any{"quantity": 1}, "confirm_count": 10}},
+		{"unknown filter field", "destroyWhere", map[string]any{"filter": map[string]any{"nope[eq]": 1}, "confirm_count": 10}},
+		{"data on destroy", "destroyWhere", map[string]any{"filter": map[string]any{"quantity[gt]": 0}, "data": map[string]any{}, "confirm_count": 10}},
+		{"missing data", "updateWhere", map[string]any{"filter": map[string]any{"quantity[gt]": 0}, "confirm_count": 10}},
+		{"read-only data", "updateWhere", map[string]any{"filter": map[string]any{"quantity[gt]": 0}, "data": map[string]any{"id": "x"}, "confirm_count": 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doWhereRequest(t, handler, "products", tt.action, tt.body, adminIdentity())
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("expected 400, got %d: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+	if count, _ := adapter.CountRows(context.Background(), "products"); count != 4 {
+		t.Errorf("expected no product changed, got %d left", count)
+	}
+}
@@ -1,8 +1,13 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 )
 
 // SuccessResponse is the standard envelope for successful API responses.
@@ -13,15 +18,83 @@ type SuccessResponse struct {
 	Links   map[string]any `json:"links,omitempty"`
 }
 
-// ErrorResponse is the standard envelope for error API responses.
+// ErrorResponse is the standard envelope for error API responses. Code is
+// an entry of the error code catalog; Details names the fields at fault.
 type ErrorResponse struct {
+	Code      string        `json:"code"`
+	Message   string        `json:"message"`
+	Details   []ErrorDetail `json:"details,omitempty"`
+	RequestID string        `json:"request_id,omitempty"`
+}
+
+// ErrorDetail describes one field at fault in a rejected request. Example,
+// when set, is a valid value for the field.
+type ErrorDetail struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+	Example any    `json:"example,omitempty"`
+}
+
+// MessageResponse is the envelope of a message-only success response.
+type MessageResponse struct {
 	Message string `json:"message"`
 }
 
 // CaptchaChallengeResponse is the documented CAPTCHA challenge envelope.
 type CaptchaChallengeResponse struct {
-	Message string              `json:"message"`
-	Captcha CaptchaChallengeDTO `json:"captcha"`
+	Code      string              `json:"code"`
+	Message   string              `json:"message"`
+	Captcha   CaptchaChallengeDTO `json:"captcha"`
+	RequestID string              `json:"request_id,omitempty"`
+}
+
+// VersionConflictResponse is the documented optimistic concurrency
+// conflict envelope. Data holds the current record.
+type VersionConflictResponse struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Data      []any  `json:"data"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// APIError is an error with a specific code from the error code catalog.
+// Validation returns it so that WriteErrorFrom can answer with its code
+// and field details instead of the generic code of the status.
+type APIError struct {
+	Code    string
+	Message string
+	Details []ErrorDetail
+}
+
+func (e *APIError) Error() string { return e.Message }
+
+// fieldError returns an APIError about one field.
+func fieldError(code, field, message string) *APIError {
+	return &APIError{Code: code, Message: message, Details: []ErrorDetail{{Field: field, Message: message}}}
+}
+
+// statusErrorCodes maps each error status to its generic error code.
+var statusErrorCodes = map[int]string{
+	http.StatusBadRequest:            ErrCodeBadRequest,
+	http.StatusUnauthorized:          ErrCodeUnauthorized,
+	http.StatusForbidden:             ErrCodeForbidden,
+	http.StatusNotFound:              ErrCodeNotFound,
+	http.StatusMethodNotAllowed:      ErrCodeMethodNotAllowed,
+	http.StatusConflict:              ErrCodeConflict,
+	http.StatusPreconditionFailed:    ErrCodePreconditionFailed,
+	http.StatusRequestEntityTooLarge: ErrCodePayloadTooLarge,
+	http.StatusTooManyRequests:       ErrCodeRateLimited,
+	http.StatusNotImplemented:        ErrCodeNotImplemented,
+	http.StatusBadGateway:            ErrCodeBadGateway,
+	http.StatusServiceUnavailable:    ErrCodeUnavailable,
+}
+
+// statusErrorCode returns the generic error code of status.
+func statusErrorCode(status int) string {
+	if code, ok := statusErrorCodes[status]; ok {
+		return code
+	}
+	return ErrCodeInternal
 }
 
 // WriteJSON serializes body as JSON and writes it to w with the given status.
@@ -31,16 +104,56 @@ func WriteJSON(w http.ResponseWriter, status int, body any) {
 	json.NewEncoder(w).Encode(body)
 }
 
-// WriteError writes a standard error response with the given status and message.
+// WriteError writes a standard error response with the given status and
+// message, coded with the generic code of the status.
 func WriteError(w http.ResponseWriter, status int, message string) {
-	WriteJSON(w, status, ErrorResponse{Message: message})
+	WriteErrorCode(w, status, "", message)
+}
+
+// WriteErrorCode writes a standard error response with a specific error
+// code and field details. An empty code means the generic code of the
+// status.
+func WriteErrorCode(w http.ResponseWriter, status int, code, message string, details ...ErrorDetail) {
+	if code == "" {
+		code = statusErrorCode(status)
+	}
+	WriteJSON(w, status, ErrorResponse{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: requestID(w),
+	})
+}
+
+// WriteErrorFrom writes err as a standard error response. The code and
+// details come from an APIError in err's chain, if any.
+func WriteErrorFrom(w http.ResponseWriter, status int, err error) {
+	var ae *APIError
+	if errors.As(err, &ae) {
+		WriteErrorCode(w, status, ae.Code, err.Error(), ae.Details...)
+		return
+	}
+	WriteError(w, status, err.Error())
 }
 
 // WriteCaptchaChallenge writes a CAPTCHA challenge response.
 func WriteCaptchaChallenge(w http.ResponseWriter, status int, challenge CaptchaChallengeDTO) {
 	WriteJSON(w, status, CaptchaChallengeResponse{
-		Message: "Captcha required",
-		Captcha: challenge,
+		Code:      ErrCodeCaptchaRequired,
+		Message:   "Captcha required",
+		Captcha:   challenge,
+		RequestID: requestID(w),
+	})
+}
+
+// WriteVersionConflict writes a 409 response carrying the current record,
+// so the client can merge its change and retry with the new version.
+func WriteVersionConflict(w http.ResponseWriter, id string, current map[string]any) {
+	WriteJSON(w, http.StatusConflict, VersionConflictResponse{
+		Code:      ErrCodeVersionConflict,
+		Message:   fmt.Sprintf("Version conflict for record '%s'", id),
+		Data:      []any{current},
+		RequestID: requestID(w),
 	})
 }
 
@@ -66,5 +179,45 @@ func WriteSuccessFull(w http.ResponseWriter, status int, message string, data []
 
 // WriteMessage writes a message-only success response (no data envelope).
 func WriteMessage(w http.ResponseWriter, status int, message string) {
-	WriteJSON(w, status, ErrorResponse{Message: message})
+	WriteJSON(w, status, MessageResponse{Message: message})
+}
+
+// contentETag returns a strong ETag for b: a quoted prefix of its SHA-256
+// hash, so the same content always gets the same tag.
+func contentETag(b []byte) string {
+	sum := sha256.Sum256(b)
+	return `"` + hex.EncodeToString(sum[:ETagHashBytes]) + `"`
+}
+
+// valueETag returns the ETag of v's JSON encoding. Map keys are encoded in
+// sorted order, so equal values get equal tags.
+func valueETag(v any) string {
+	b, _ := json.Marshal(v)
+	return contentETag(b)
+}
+
+// etagListed reports whether an If-None-Match or If-Match header value
+// lists etag, or is "*". Tags are compared weakly: a W/ prefix on either
+// side is ignored.
+func etagListed(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// writeNotModified sets the ETag header and, if the request's
+// If-None-Match lists etag, writes 304 Not Modified and returns true. The
+// caller then writes nothing more.
+func writeNotModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagListed(inm, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
 }
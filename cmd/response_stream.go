@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// listStream writes a list response one record at a time, so a page is
+// never held in memory. The JSON form is the envelope WriteSuccessFull
+// writes, byte for byte, with meta and links after the data. The NDJSON
+// form, chosen with Accept: application/x-ndjson, writes one record per
+// line and sends meta and links as JSON in the X-Pagination trailer.
+//
+// Nothing is sent until the first record or finish, so an error before
+// that still gets a normal error response.
+type listStream struct {
+	w       http.ResponseWriter
+	message string
+	ndjson  bool
+	started bool
+	count   int
+}
+
+// newListStream returns a listStream for the response to r.
+func newListStream(w http.ResponseWriter, r *http.Request, message string) *listStream {
+	return &listStream{w: w, message: message, ndjson: acceptsNDJSON(r)}
+}
+
+// acceptsNDJSON reports whether the Accept header of r lists
+// application/x-ndjson with a non-zero quality.
+func acceptsNDJSON(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || mediaType != NDJSONContentType {
+			continue
+		}
+		if q, ok := params["q"]; ok {
+			if v, err := strconv.ParseFloat(q, 64); err != nil || v == 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// start sends the header and, for JSON, the opening of the envelope.
+func (s *listStream) start() {
+	if s.started {
+		return
+	}
+	s.started = true
+	h := s.w.Header()
+	if s.ndjson {
+		h.Set("Content-Type", NDJSONContentType)
+		h.Set("Trailer", PaginationTrailer)
+		s.w.WriteHeader(http.StatusOK)
+		return
+	}
+	h.Set("Content-Type", "application/json; charset=utf-8")
+	s.w.WriteHeader(http.StatusOK)
+	message, _ := json.Marshal(s.message)
+	s.w.Write([]byte(`{"message":`))
+	s.w.Write(message)
+}
+
+// add writes record. An error means the client is gone and the rest of
+// the response can be skipped.
+func (s *listStream) add(record map[string]any) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	s.start()
+	switch {
+	case s.ndjson:
+		b = append(b, '\n')
+	case s.count == 0:
+		s.w.Write([]byte(`,"data":[`))
+	default:
+		s.w.Write([]byte(","))
+	}
+	s.count++
+	_, err = s.w.Write(b)
+	return err
+}
+
+// finish ends the response with meta and links.
+func (s *listStream) finish(meta, links map[string]any) {
+	s.start()
+	if s.ndjson {
+		b, _ := json.Marshal(map[string]any{"meta": meta, "links": links})
+		s.w.Header().Set(PaginationTrailer, string(b))
+		return
+	}
+	if s.count > 0 {
+		s.w.Write([]byte("]"))
+	}
+	if len(meta) > 0 {
+		b, _ := json.Marshal(meta)
+		s.w.Write([]byte(`,"meta":`))
+		s.w.Write(b)
+	}
+	if len(links) > 0 {
+		b, _ := json.Marshal(links)
+		s.w.Write([]byte(`,"links":`))
+		s.w.Write(b)
+	}
+	s.w.Write([]byte("}\n"))
+}
+
+// fail answers 500 when nothing has been sent yet. Otherwise the header is
+// gone, and the response is cut short: the truncated body is the only
+// signal left.
+func (s *listStream) fail() {
+	if !s.started {
+		WriteError(s.w, http.StatusInternalServerError, "Internal server error")
+	}
+}
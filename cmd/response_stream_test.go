@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestListStream_MatchesWriteSuccessFull(t *testing.T) {
+	meta := map[string]any{"total": 2, "count": 2}
+	links := map[string]any{"next": nil, "first": "/data/p:query?a=1&b=<2>"}
+	records := []map[string]any{{"id": "1", "title": "<b>&"}, {"id": "2", "title": nil}}
+
+	tests := []struct {
+		name    string
+		records []map[string]any
+		meta    map[string]any
+		links   map[string]any
+	}{
+		{"records", records, meta, links},
+		{"empty", nil, meta, links},
+		{"no meta", records, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := httptest.NewRecorder()
+			data := make([]any, 0, len(tt.records))
+			for _, rec := range tt.records {
+				data = append(data, rec)
+			}
+			WriteSuccessFull(want, http.StatusOK, "Resources retrieved successfully", data, tt.meta, tt.links)
+
+			got := httptest.NewRecorder()
+			stream := newListStream(got, httptest.NewRequest(http.MethodGet, "/", nil), "Resources retrieved successfully")
+			for _, rec := range tt.records {
+				if err := stream.add(rec); err != nil {
+					t.Fatalf("add: %v", err)
+				}
+			}
+			stream.finish(tt.meta, tt.links)
+
+			if got.Body.String() != want.Body.String() {
+				t.Errorf("body =\n%s\nwant\n%s", got.Body.String(), want.Body.String())
+			}
+			if got.Header().Get("Content-Type") != want.Header().Get("Content-Type") {
+				t.Errorf("Content-Type = %q, want %q", got.Header().Get("Content-Type"), want.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestListStream_FailBeforeAndAfterStart(t *testing.T) {
+	w := httptest.NewRecorder()
+	stream := newListStream(w, httptest.NewRequest(http.MethodGet, "/", nil), "ok")
+	stream.fail()
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500 before anything is sent", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	stream = newListStream(w, httptest.NewRequest(http.MethodGet, "/", nil), "ok")
+	stream.add(map[string]any{"id": "1"})
+	stream.fail()
+	if w.Code != http.StatusOK || json.Valid(w.Body.Bytes()) {
+		t.Errorf("status = %d, body %q; want a truncated 200", w.Code, w.Body.String())
+	}
+}
+
+func TestAcceptsNDJSON(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{"", false},
+		{"application/json", false},
+		{"application/x-ndjson", true},
+		{"application/json, application/x-ndjson;q=0.5", true},
+		{"application/x-ndjson;q=0", false},
+		{"*/*", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept", tt.accept)
+		if got := acceptsNDJSON(r); got != tt.want {
+			t.Errorf("acceptsNDJSON(%q) = %v, want %v", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestResourceQuery_ListMode_NDJSON(t *testing.T) {
+	h, adapter, _ := setupResourceQueryTest(t)
+	seedProducts(t, adapter)
+
+	for _, path := range []string{"/data/products:query?per_page=2&page=2", "/data/products:query?per_page=2&after="} {
+		srv := httptest.NewServer(http.HandlerFunc(h.HandleQuery))
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		req.Header.Set("Accept", NDJSONContentType)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+
+		if ct := resp.Header.Get("Content-Type"); ct != NDJSONContentType {
+			t.Errorf("%s: Content-Type = %q", path, ct)
+		}
+		var ids []string
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			var rec map[string]any
+			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+				t.Fatalf("%s: line %q: %v", path, scanner.Text(), err)
+			}
+			ids = append(ids, rec["id"].(string))
+		}
+		resp.Body.Close()
+		srv.Close()
+		if len(ids) != 2 {
+			t.Errorf("%s: ids = %v, want 2 records", path, ids)
+		}
+
+		var pagination struct {
+			Meta  map[string]any `json:"meta"`
+			Links map[string]any `json:"links"`
+		}
+		if err := json.Unmarshal([]byte(resp.Trailer.Get(PaginationTrailer)), &pagination); err != nil {
+			t.Fatalf("%s: trailer %q: %v", path, resp.Trailer.Get(PaginationTrailer), err)
+		}
+		if pagination.Meta["count"] != float64(2) || pagination.Links["next"] == nil {
+			t.Errorf("%s: pagination = %+v", path, pagination)
+		}
+	}
+}
+
+// failingStreamer passes on rows and then fails, as a connection lost in
+// the middle of a large page would.
+type failingStreamer struct {
+	DatabaseAdapter
+	rows int
+}
+
+func (f failingStreamer) StreamRows(ctx context.Context, table string, opts QueryOptions, each func(map[string]any) error) (int, error) {
+	for i := range f.rows {
+		if err := each(map[string]any{"id": strings.Repeat("x", i+1)}); err != nil {
+			return 0, err
+		}
+	}
+	return 0, errors.New("connection reset")
+}
+
+func TestResourceQuery_ListMode_StreamError(t *testing.T) {
+	h, adapter, _ := setupResourceQueryTest(t)
+
+	for _, n := range []int{0, 3} {
+		h.db = failingStreamer{DatabaseAdapter: adapter, rows: n}
+		w := httptest.NewRecorder()
+		h.HandleQuery(w, makeQueryRequest("/data/products:query"))
+		if n == 0 && w.Code != http.StatusInternalServerError {
+			t.Errorf("status = %d, want 500 when the query fails before any row", w.Code)
+		}
+		if n > 0 && json.Valid(w.Body.Bytes()) {
+			t.Errorf("body %q: want a truncated body after rows were sent", w.Body.String())
+		}
+	}
+}
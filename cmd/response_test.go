@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -33,11 +34,12 @@ func TestWriteError(t *testing.T) {
 		name    string
 		status  int
 		message string
+		code    string
 	}{
-		{"bad request", http.StatusBadRequest, "Bad request"},
-		{"not found", http.StatusNotFound, "Not found"},
-		{"internal error", http.StatusInternalServerError, "Internal server error"},
-		{"method not allowed", http.StatusMethodNotAllowed, "Method not allowed"},
+		{"bad request", http.StatusBadRequest, "Bad request", ErrCodeBadRequest},
+		{"not found", http.StatusNotFound, "Not found", ErrCodeNotFound},
+		{"internal error", http.StatusInternalServerError, "Internal server error", ErrCodeInternal},
+		{"method not allowed", http.StatusMethodNotAllowed, "Method not allowed", ErrCodeMethodNotAllowed},
 	}
 
 	for _, tt := range tests {
@@ -56,10 +58,44 @@ func TestWriteError(t *testing.T) {
 			if got.Message != tt.message {
 				t.Fatalf("expected message %q, got %q", tt.message, got.Message)
 			}
+			if got.Code != tt.code {
+				t.Fatalf("expected code %q, got %q", tt.code, got.Code)
+			}
 		})
 	}
 }
 
+func TestWriteErrorFrom(t *testing.T) {
+	w := httptest.NewRecorder()
+	w.Header().Set(RequestIDHeader, "req-1")
+	err := fmt.Errorf("Item 2: %w", fieldError(ErrCodeUnknownField, "color", "Unknown field 'color'"))
+	WriteErrorFrom(w, http.StatusBadRequest, err)
+
+	var got map[string]any
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	want := map[string]any{
+		"code":       ErrCodeUnknownField,
+		"message":    "Item 2: Unknown field 'color'",
+		"details":    []any{map[string]any{"field": "color", "message": "Unknown field 'color'"}},
+		"request_id": "req-1",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("body = %v, want %v", got, want)
+	}
+
+	w = httptest.NewRecorder()
+	WriteErrorFrom(w, http.StatusBadRequest, fmt.Errorf("Invalid page"))
+	got = nil
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	if got["code"] != ErrCodeBadRequest || got["details"] != nil || got["request_id"] != nil {
+		t.Fatalf("body = %v, want a bare bad_request", got)
+	}
+}
+
 func TestWriteCaptchaChallenge(t *testing.T) {
 	w := httptest.NewRecorder()
 	WriteCaptchaChallenge(w, http.StatusForbidden, CaptchaChallengeDTO{
@@ -145,12 +181,12 @@ func TestWriteMessage(t *testing.T) {
 	w := httptest.NewRecorder()
 	WriteMessage(w, http.StatusOK, "Logged out successfully")
 
-	var got ErrorResponse
+	var got map[string]any
 	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
 		t.Fatalf("failed to decode: %v", err)
 	}
-	if got.Message != "Logged out successfully" {
-		t.Fatalf("unexpected message: %q", got.Message)
+	if len(got) != 1 || got["message"] != "Logged out successfully" {
+		t.Fatalf("unexpected body: %v", got)
 	}
 }
 
@@ -163,3 +199,25 @@ func TestWriteSuccess_Created(t *testing.T) {
 		t.Fatalf("expected 201, got %d", w.Code)
 	}
 }
+
+func TestETagListed(t *testing.T) {
+	etag := contentETag([]byte("body"))
+	if etag != contentETag([]byte("body")) || etag == contentETag([]byte("other")) {
+		t.Fatal("expected the ETag to depend only on the content")
+	}
+	for header, want := range map[string]bool{
+		etag:                     true,
+		"W/" + etag:              true,
+		`"a", ` + etag + `, "b"`: true,
+		"*":                      true,
+		`"a"`:                    false,
+		"":                       false,
+	} {
+		if got := etagListed(header, etag); got != want {
+			t.Errorf("etagListed(%q) = %v, want %v", header, got, want)
+		}
+	}
+	if !etagListed(etag, "W/"+etag) {
+		t.Error("expected a weak ETag to match its strong form")
+	}
+}
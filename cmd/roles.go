@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// ---------------------------------------------------------------------------
+// Custom roles
+//
+// Besides the built-in admin and user roles, admins can define named roles
+// in moon_roles. A custom role grants collection management, user and API
+// key management, and read or write access to listed collections. Users and
+// API keys hold a custom role by name in their role field; the name is what
+// access tokens carry, and the authorization middleware resolves it to the
+// role's permissions through the PermissionStore cache on each request.
+// ---------------------------------------------------------------------------
+
+// rolePattern is the syntax of a custom role name.
+var rolePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// RolePermissions is what a custom role grants.
+type RolePermissions struct {
+	Collections bool     `json:"collections"` // manage collection schemas
+	Users       bool     `json:"users"`       // manage users and API keys
+	Read        []string `json:"read"`        // collections the role may list and read
+	Write       []string `json:"write"`       // collections the role may also create, update, and destroy in
+}
+
+// Role is a custom role.
+type Role struct {
+	ID          string          `json:"id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Permissions RolePermissions `json:"permissions"`
+}
+
+// Allows reports whether the permissions grant op on collection. Writing a
+// collection implies reading it. The users and apikeys collections follow
+// the Users permission instead of the collection lists.
+func (p *RolePermissions) Allows(collection, op string) bool {
+	if collection == "users" || collection == "apikeys" {
+		return p.Users
+	}
+	matches := func(list []string) bool {
+		return stringInSlice(RoleAllCollections, list) || stringInSlice(collection, list)
+	}
+	switch op {
+	case "list", "read":
+		return matches(p.Read) || matches(p.Write)
+	default:
+		return matches(p.Write)
+	}
+}
+
+// isBuiltinRole reports whether name is admin or user.
+func isBuiltinRole(name string) bool {
+	return stringInSlice(name, BuiltinRoles)
+}
+
+// validateRole checks a role for /admin:roles op=set.
+func validateRole(role Role) error {
+	if role.Name == "" {
+		return fmt.Errorf("Missing required field: data.name")
+	}
+	if len(role.Name) > MaxRoleNameLength || !rolePattern.MatchString(role.Name) {
+		return fmt.Errorf("Invalid role name '%s': use lowercase letters, digits, and underscores", role.Name)
+	}
+	if isBuiltinRole(role.Name) {
+		return fmt.Errorf("Role '%s' is built in and cannot be redefined", role.Name)
+	}
+	for _, list := range [][]string{role.Permissions.Read, role.Permissions.Write} {
+		for _, name := range list {
+			if name != RoleAllCollections && !rolePattern.MatchString(name) {
+				return fmt.Errorf("Invalid collection '%s' in role permissions", name)
+			}
+		}
+	}
+	return nil
+}
+
+// checkRoleName returns a validationError unless role is a built-in role
+// or a custom role stored in moon_roles.
+func checkRoleName(ctx context.Context, db DatabaseAdapter, role string) error {
+	if isBuiltinRole(role) {
+		return nil
+	}
+	if role != "" && rolePattern.MatchString(role) {
+		rows, _, err := db.QueryRows(ctx, RolesTable, QueryOptions{
+			Filters: []Filter{{Field: "name", Op: "eq", Value: role}},
+			Page:    1,
+			PerPage: 1,
+		})
+		if err != nil {
+			return err
+		}
+		if len(rows) > 0 {
+			return nil
+		}
+	}
+	return &validationError{msg: "Field 'role' must be 'admin', 'user', or a defined role"}
+}
+
+// roleInUse reports whether any user or API key holds role.
+func roleInUse(ctx context.Context, db DatabaseAdapter, role string) (bool, error) {
+	for _, table := range []string{"users", "apikeys"} {
+		rows, _, err := db.QueryRows(ctx, table, QueryOptions{
+			Filters: []Filter{{Field: "role", Op: "eq", Value: role}},
+			Page:    1,
+			PerPage: 1,
+		})
+		if err != nil {
+			return false, err
+		}
+		if len(rows) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func roleFromRow(row map[string]any) (Role, error) {
+	role := Role{
+		ID:          stringVal(row, "id"),
+		Name:        stringVal(row, "name"),
+		Description: stringVal(row, "description"),
+	}
+	var raw []byte
+	switch v := row["permissions"].(type) {
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &role.Permissions); err != nil {
+			return Role{}, fmt.Errorf("role %s: %w", role.Name, err)
+		}
+	}
+	role.Permissions.normalize()
+	return role, nil
+}
+
+// normalize replaces nil lists with empty ones so they encode as [].
+func (p *RolePermissions) normalize() {
+	if p.Read == nil {
+		p.Read = []string{}
+	}
+	if p.Write == nil {
+		p.Write = []string{}
+	}
+}
+
+// ---------------------------------------------------------------------------
+// PermissionStore role cache
+// ---------------------------------------------------------------------------
+
+// loadRoles reads every custom role.
+func (s *PermissionStore) loadRoles(ctx context.Context) (map[string]Role, error) {
+	roles := make(map[string]Role)
+	for page := 1; ; page++ {
+		rows, _, err := s.db.QueryRows(ctx, RolesTable, QueryOptions{
+			Sort:    []SortField{{Field: "name"}},
+			Page:    page,
+			PerPage: MaxPerPage,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("roles: load: %w", err)
+		}
+		for _, row := range rows {
+			role, err := roleFromRow(row)
+			if err != nil {
+				return nil, fmt.Errorf("roles: load: %w", err)
+			}
+			roles[role.Name] = role
+		}
+		if len(rows) < MaxPerPage {
+			break
+		}
+	}
+	return roles, nil
+}
+
+// Roles returns the cached custom roles sorted by name.
+func (s *PermissionStore) Roles() []Role {
+	s.mu.RLock()
+	result := make([]Role, 0, len(s.roles))
+	for _, role := range s.roles {
+		result = append(result, role)
+	}
+	s.mu.RUnlock()
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// Role returns the cached custom role called name.
+func (s *PermissionStore) Role(name string) (Role, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	role, ok := s.roles[name]
+	return role, ok
+}
+
+// resolveRole attaches the permissions of identity's custom role. A caller
+// with a custom role may write when the role lists any collection to
+// write; the collection itself is checked by Allowed. A role that no
+// longer exists grants nothing.
+func (s *PermissionStore) resolveRole(identity *AuthIdentity) {
+	if isBuiltinRole(identity.Role) {
+		return
+	}
+	role, ok := s.Role(identity.Role)
+	if !ok {
+		role.Permissions.normalize()
+	}
+	identity.Permissions = &role.Permissions
+	identity.CanWrite = len(role.Permissions.Write) > 0 || role.Permissions.Users
+}
+
+// SetRole creates the role called role.Name or replaces its description
+// and permissions.
+func (s *PermissionStore) SetRole(ctx context.Context, role Role) (Role, error) {
+	role.Permissions.normalize()
+	perms, err := json.Marshal(role.Permissions)
+	if err != nil {
+		return Role{}, err
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	existing, ok, err := s.findRole(ctx, role.Name)
+	if err != nil {
+		return Role{}, err
+	}
+	if ok {
+		role.ID = existing.ID
+		err = s.db.UpdateRow(ctx, RolesTable, role.ID, map[string]any{
+			"description": role.Description,
+			"permissions": string(perms),
+			"updated_at":  now,
+		})
+	} else {
+		role.ID = GenerateULID()
+		err = s.db.InsertRow(ctx, RolesTable, map[string]any{
+			"id":          role.ID,
+			"name":        role.Name,
+			"description": role.Description,
+			"permissions": string(perms),
+			"created_at":  now,
+			"updated_at":  now,
+		})
+	}
+	if err != nil {
+		return Role{}, err
+	}
+	return role, s.Load(ctx)
+}
+
+// RemoveRole deletes the role called name. It reports false when no such
+// role exists.
+func (s *PermissionStore) RemoveRole(ctx context.Context, name string) (bool, error) {
+	existing, ok, err := s.findRole(ctx, name)
+	if err != nil || !ok {
+		return false, err
+	}
+	if err := s.db.DeleteRow(ctx, RolesTable, existing.ID); err != nil {
+		return false, err
+	}
+	return true, s.Load(ctx)
+}
+
+// findRole reads the stored role called name.
+func (s *PermissionStore) findRole(ctx context.Context, name string) (Role, bool, error) {
+	rows, _, err := s.db.QueryRows(ctx, RolesTable, QueryOptions{
+		Filters: []Filter{{Field: "name", Op: "eq", Value: name}},
+		Page:    1,
+		PerPage: 1,
+	})
+	if err != nil || len(rows) == 0 {
+		return Role{}, false, err
+	}
+	role, err := roleFromRow(rows[0])
+	return role, err == nil, err
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func doAdminRoleMutate(t *testing.T, h *AdminRoleHandler, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	b, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, "/admin:roles", strings.NewReader(string(b)))
+	req = req.WithContext(SetAuthIdentity(req.Context(), adminIdentity()))
+	w := httptest.NewRecorder()
+	h.HandleMutate(w, req)
+	return w
+}
+
+func TestAdminRoles_SetQueryDestroy(t *testing.T) {
+	h, db, _ := setupMutateTest(t)
+	store, err := NewPermissionStore(context.Background(), db)
+	if err != nil {
+		t.Fatalf("NewPermissionStore: %v", err)
+	}
+	roles := NewAdminRoleHandler(store, db, nil)
+
+	editor := map[string]any{
+		"name":        "editor",
+		"description": "Edits posts",
+		"permissions": map[string]any{"read": []string{"*"}, "write": []string{"posts"}},
+	}
+	if w := doAdminRoleMutate(t, roles, map[string]any{"op": "set", "data": []any{editor}}); w.Code != http.StatusOK {
+		t.Fatalf("set: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin:roles", nil)
+	req = req.WithContext(SetAuthIdentity(req.Context(), adminIdentity()))
+	w := httptest.NewRecorder()
+	roles.HandleQuery(w, req)
+	data := decodeResponse(t, w)["data"].([]any)
+	if len(data) != 1 {
+		t.Fatalf("expected 1 role, got %v", data)
+	}
+	got := data[0].(map[string]any)
+	perms := got["permissions"].(map[string]any)
+	if got["name"] != "editor" || perms["users"] != false || len(perms["write"].([]any)) != 1 {
+		t.Errorf("unexpected role %v", got)
+	}
+
+	// A user holding the role keeps it from being destroyed.
+	w = doMutateRequest(t, h, "users", map[string]any{"op": "create", "data": []any{map[string]any{
+		"username": "ed", "email": "ed@example.com", "password": "EditorPass1", "role": "editor",
+	}}}, adminIdentity())
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create user: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	destroy := map[string]any{"op": "destroy", "data": []any{map[string]any{"name": "editor"}}}
+	if meta := decodeResponse(t, doAdminRoleMutate(t, roles, destroy))["meta"].(map[string]any); meta["failed"] != float64(1) {
+		t.Errorf("expected a held role to fail, got %v", meta)
+	}
+	userID := decodeResponse(t, w)["data"].([]any)[0].(map[string]any)["id"].(string)
+	if err := db.DeleteRow(context.Background(), "users", userID); err != nil {
+		t.Fatal(err)
+	}
+	if meta := decodeResponse(t, doAdminRoleMutate(t, roles, destroy))["meta"].(map[string]any); meta["success"] != float64(1) {
+		t.Errorf("expected destroy to succeed, got %v", meta)
+	}
+	if _, ok := store.Role("editor"); ok {
+		t.Error("expected the role to leave the cache")
+	}
+}
+
+func TestAdminRoles_Validation(t *testing.T) {
+	_, db, _ := setupMutateTest(t)
+	store, err := NewPermissionStore(context.Background(), db)
+	if err != nil {
+		t.Fatalf("NewPermissionStore: %v", err)
+	}
+	roles := NewAdminRoleHandler(store, db, nil)
+	for _, role := range []map[string]any{
+		{"name": "admin"},
+		{"name": "Editor"},
+		{"description": "no name"},
+		{"name": "editor", "permissions": map[string]any{"read": []string{"Posts!"}}},
+	} {
+		if w := doAdminRoleMutate(t, roles, map[string]any{"op": "set", "data": []any{role}}); w.Code != http.StatusBadRequest {
+			t.Errorf("%v: expected 400, got %d", role, w.Code)
+		}
+	}
+}
+
+func TestAuthorizeWithPermissions_CustomRoles(t *testing.T) {
+	store, _ := setupPermissionTest(t)
+	ctx := context.Background()
+	for _, role := range []Role{
+		{Name: "editor", Permissions: RolePermissions{Read: []string{"*"}, Write: []string{"products"}}},
+		{Name: "support", Permissions: RolePermissions{Users: true}},
+		{Name: "architect", Permissions: RolePermissions{Collections: true}},
+	} {
+		if _, err := store.SetRole(ctx, role); err != nil {
+			t.Fatalf("SetRole: %v", err)
+		}
+	}
+
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	handler := AuthorizeWithPermissions("", store, inner)
+	caller := func(role string) *AuthIdentity {
+		return &AuthIdentity{CredentialType: CredentialTypeJWT, CallerID: "u-" + role, Role: role}
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		role   string
+		want   int
+	}{
+		{"editor reads any collection", http.MethodGet, "/data/orders:query", "", "editor", http.StatusOK},
+		{"editor writes listed collection", http.MethodPost, "/data/products:mutate", `{"op":"create","data":[]}`, "editor", http.StatusOK},
+		{"editor cannot write other collection", http.MethodPost, "/data/orders:mutate", `{"op":"create","data":[]}`, "editor", http.StatusForbidden},
+		{"editor cannot manage users", http.MethodPost, "/data/users:mutate", `{"op":"create","data":[]}`, "editor", http.StatusForbidden},
+		{"editor cannot change schemas", http.MethodPost, "/collections:mutate", `{}`, "editor", http.StatusForbidden},
+		{"support manages users", http.MethodPost, "/data/users:mutate", `{"op":"create","data":[]}`, "support", http.StatusOK},
+		{"support cannot read data", http.MethodGet, "/data/products:query", "", "support", http.StatusForbidden},
+		{"architect changes schemas", http.MethodPost, "/collections:mutate", `{}`, "architect", http.StatusOK},
+		{"architect cannot write data", http.MethodPost, "/data/products:mutate", `{"op":"update","data":[]}`, "architect", http.StatusForbidden},
+		{"unknown role grants nothing", http.MethodGet, "/data/products:query", "", "ghost", http.StatusForbidden},
+		{"roles are admin only", http.MethodGet, "/admin:roles", "", "support", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			req = req.WithContext(SetAuthIdentity(req.Context(), caller(tt.role)))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+}
+
+func TestResourceMutate_CustomRoleAssignment(t *testing.T) {
+	h, db, _ := setupMutateTest(t)
+	store, err := NewPermissionStore(context.Background(), db)
+	if err != nil {
+		t.Fatalf("NewPermissionStore: %v", err)
+	}
+	if _, err := store.SetRole(context.Background(), Role{Name: "support", Permissions: RolePermissions{Users: true}}); err != nil {
+		t.Fatalf("SetRole: %v", err)
+	}
+	support := &AuthIdentity{CredentialType: CredentialTypeJWT, CallerID: "support-id", Role: "support", CanWrite: true}
+	store.resolveRole(support)
+
+	create := func(role string, identity *AuthIdentity) *httptest.ResponseRecorder {
+		return doMutateRequest(t, h, "users", map[string]any{"op": "create", "data": []any{map[string]any{
+			"username": "new_" + role, "email": "new_" + role + "@example.com", "password": "NewUserPass1", "role": role,
+		}}}, identity)
+	}
+	if w := create("owner", adminIdentity()); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "a defined role") {
+		t.Errorf("expected an unknown role to be rejected, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := create("support", support); w.Code != http.StatusCreated {
+		t.Errorf("expected a user manager to create users, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := create("admin", support); w.Code != http.StatusForbidden {
+		t.Errorf("expected a user manager not to grant admin, got %d", w.Code)
+	}
+
+	admin := seedAdminUser(t, db)
+	w := doMutateRequest(t, h, "users", map[string]any{"op": "action", "action": "reset_password", "data": []any{
+		map[string]any{"id": admin, "password": "Takeover1"},
+	}}, support)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected a user manager not to reset an admin password, got %d", w.Code)
+	}
+	w = doMutateRequest(t, h, "users", map[string]any{"op": "destroy", "data": []any{map[string]any{"id": admin}}}, support)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected a user manager not to destroy an admin, got %d", w.Code)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Middleware wraps a handler. Route middleware runs after the global chain
+// built by BuildHandler, so it sees the authenticated identity.
+type Middleware func(http.Handler) http.Handler
+
+// Router registers Moon routes on a ServeMux by method and path. A path
+// registered for some methods answers every other method with 405 and an
+// Allow header listing the registered ones.
+//
+// Data routes take the form {prefix}/data/{collection}:{action} and are
+// registered by action with HandleAction. The collection name is extracted
+// once and exposed to handlers as r.PathValue("collection").
+type Router struct {
+	mux     *http.ServeMux
+	prefix  string
+	paths   map[string]map[string]http.Handler // path → method → handler
+	actions map[string]map[string]http.Handler // data action → method → handler
+}
+
+// newRouter creates a Router that registers on mux. prefix is prepended to
+// every path and must not end in a slash.
+func newRouter(mux *http.ServeMux, prefix string) *Router {
+	return &Router{
+		mux:     mux,
+		prefix:  prefix,
+		paths:   make(map[string]map[string]http.Handler),
+		actions: make(map[string]map[string]http.Handler),
+	}
+}
+
+// Handle registers h for method on path, relative to the router prefix.
+// Middleware is applied in order, the first being outermost. A path ending
+// in a slash matches its whole subtree, as with ServeMux.
+func (rt *Router) Handle(method, path string, h http.HandlerFunc, mw ...Middleware) {
+	methods, ok := rt.paths[path]
+	if !ok {
+		methods = make(map[string]http.Handler)
+		rt.paths[path] = methods
+		rt.mux.Handle(rt.prefix+path, methodDispatcher(methods))
+	}
+	if _, dup := methods[method]; dup {
+		panic(fmt.Sprintf("router: duplicate route %s %s", method, rt.prefix+path))
+	}
+	methods[method] = chain(h, mw)
+}
+
+// HandleAction registers h for method on {prefix}/data/{collection}:{action}.
+func (rt *Router) HandleAction(method, action string, h http.HandlerFunc, mw ...Middleware) {
+	if len(rt.actions) == 0 {
+		rt.mux.HandleFunc(rt.prefix+"/data/", rt.dispatchAction)
+	}
+	methods, ok := rt.actions[action]
+	if !ok {
+		methods = make(map[string]http.Handler)
+		rt.actions[action] = methods
+	}
+	if _, dup := methods[method]; dup {
+		panic(fmt.Sprintf("router: duplicate action %s :%s", method, action))
+	}
+	methods[method] = chain(h, mw)
+}
+
+// dispatchAction routes a /data/ request by its action suffix and method.
+func (rt *Router) dispatchAction(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, rt.prefix+"/data/")
+	colonIdx := strings.LastIndex(rest, ":")
+	if colonIdx < 0 {
+		WriteError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	collection, action := rest[:colonIdx], rest[colonIdx+1:]
+	if collection == "" {
+		WriteError(w, http.StatusBadRequest, "Missing resource name")
+		return
+	}
+	if strings.HasPrefix(collection, "moon_") {
+		WriteError(w, http.StatusBadRequest, fmt.Sprintf("Resource name %q is reserved", collection))
+		return
+	}
+
+	methods, ok := rt.actions[action]
+	if !ok {
+		WriteError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	r.SetPathValue("collection", collection)
+	methodDispatcher(methods).ServeHTTP(w, r)
+}
+
+// methodDispatcher serves a request with the handler registered for its
+// method, or answers 405 with an Allow header. GET handlers also serve HEAD.
+func methodDispatcher(methods map[string]http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h, ok := methods[r.Method]
+		if !ok && r.Method == http.MethodHead {
+			h, ok = methods[http.MethodGet]
+		}
+		if !ok {
+			w.Header().Set("Allow", allowHeader(methods))
+			WriteError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// allowHeader lists the registered methods, sorted, for an Allow header.
+func allowHeader(methods map[string]http.Handler) string {
+	names := make([]string, 0, len(methods))
+	for m := range methods {
+		names = append(names, m)
+	}
+	slices.Sort(names)
+	return strings.Join(names, ", ")
+}
+
+// chain wraps h with mw, the first middleware being outermost.
+func chain(h http.Handler, mw []Middleware) http.Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
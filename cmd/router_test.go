@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func serveRouter(rt *Router, method, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	rt.mux.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+func TestRouter_MethodNotAllowed(t *testing.T) {
+	rt := newRouter(http.NewServeMux(), "/api")
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
+	rt.Handle(http.MethodPost, "/things:mutate", ok)
+	rt.Handle(http.MethodGet, "/things:mutate", ok)
+
+	if w := serveRouter(rt, http.MethodGet, "/api/things:mutate"); w.Code != http.StatusNoContent {
+		t.Fatalf("GET: expected 204, got %d", w.Code)
+	}
+	if w := serveRouter(rt, http.MethodHead, "/api/things:mutate"); w.Code != http.StatusNoContent {
+		t.Fatalf("HEAD: expected 204, got %d", w.Code)
+	}
+
+	w := serveRouter(rt, http.MethodDelete, "/api/things:mutate")
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %d", w.Code)
+	}
+	if got := w.Header().Get("Allow"); got != "GET, POST" {
+		t.Fatalf("expected Allow: GET, POST, got %q", got)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body["message"] != "Method not allowed" {
+		t.Fatalf("expected JSON error body, got %s", w.Body.String())
+	}
+}
+
+func TestRouter_HandleAction(t *testing.T) {
+	rt := newRouter(http.NewServeMux(), "")
+	var gotCollection string
+	rt.HandleAction(http.MethodGet, "query", func(w http.ResponseWriter, r *http.Request) {
+		gotCollection = r.PathValue("collection")
+		w.WriteHeader(http.StatusNoContent)
+	})
+	rt.HandleAction(http.MethodPost, "mutate", func(w http.ResponseWriter, r *http.Request) {})
+
+	if w := serveRouter(rt, http.MethodGet, "/data/products:query"); w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", w.Code)
+	}
+	if gotCollection != "products" {
+		t.Fatalf("expected collection products, got %q", gotCollection)
+	}
+
+	tests := []struct {
+		method, target string
+		want           int
+		allow          string
+	}{
+		{http.MethodGet, "/data/products:mutate", http.StatusMethodNotAllowed, "POST"},
+		{http.MethodPost, "/data/products:query", http.StatusMethodNotAllowed, "GET"},
+		{http.MethodGet, "/data/products:unknown", http.StatusNotFound, ""},
+		{http.MethodGet, "/data/products", http.StatusNotFound, ""},
+		{http.MethodGet, "/data/:query", http.StatusBadRequest, ""},
+		{http.MethodGet, "/data/moon_users:query", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		w := serveRouter(rt, tt.method, tt.target)
+		if w.Code != tt.want {
+			t.Errorf("%s %s: expected %d, got %d", tt.method, tt.target, tt.want, w.Code)
+		}
+		if got := w.Header().Get("Allow"); got != tt.allow {
+			t.Errorf("%s %s: expected Allow %q, got %q", tt.method, tt.target, tt.allow, got)
+		}
+	}
+}
+
+func TestRouter_MiddlewareOrder(t *testing.T) {
+	rt := newRouter(http.NewServeMux(), "")
+	var calls []string
+	mark := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	rt.Handle(http.MethodGet, "/x", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "handler")
+	}, mark("auth"), mark("authz"), mark("ratelimit"))
+
+	serveRouter(rt, http.MethodGet, "/x")
+	if got := strings.Join(calls, ","); got != "auth,authz,ratelimit,handler" {
+		t.Fatalf("unexpected call order %q", got)
+	}
+}
+
+func TestRouter_DuplicateRoutePanics(t *testing.T) {
+	rt := newRouter(http.NewServeMux(), "")
+	h := func(w http.ResponseWriter, r *http.Request) {}
+	rt.Handle(http.MethodGet, "/x", h)
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic on duplicate route")
+		}
+	}()
+	rt.Handle(http.MethodGet, "/x", h)
+}
@@ -3,10 +3,14 @@ package main
 import (
 	"context"
 	"fmt"
+	"math"
 	"regexp"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
+	"time"
+	"unicode/utf8"
 )
 
 // ---------------------------------------------------------------------------
@@ -47,6 +51,7 @@ var reservedCollectionNames = map[string]bool{
 	"auth":        true,
 	"doc":         true,
 	"health":      true,
+	"batch":       true,
 }
 
 // sqlReservedKeywords lists SQL keywords that cannot be used as collection
@@ -96,6 +101,22 @@ var sqlReservedKeywords = map[string]bool{
 	"vacuum": true, "values": true, "view": true, "virtual": true,
 	"when": true, "where": true, "window": true, "with": true,
 	"without": true,
+
+	// Reserved in PostgreSQL or MySQL but not SQLite. Rejecting them on
+	// every backend keeps collections portable between databases.
+	"analyse": true, "array": true, "asymmetric": true, "authorization": true,
+	"both": true, "change": true, "condition": true, "current_user": true,
+	"databases": true, "describe": true, "div": true, "dual": true,
+	"fetch": true, "grant": true, "interval": true, "keys": true,
+	"kill": true, "lateral": true, "leading": true, "load": true,
+	"localtime": true, "localtimestamp": true, "lock": true, "mod": true,
+	"only": true, "option": true, "procedure": true, "read": true,
+	"repeat": true, "require": true, "return": true, "revoke": true,
+	"rlike": true, "schema": true, "schemas": true, "session_user": true,
+	"show": true, "signal": true, "some": true, "symmetric": true,
+	"trailing": true, "unlock": true, "usage": true, "use": true,
+	"user": true, "variadic": true, "while": true, "write": true,
+	"xor": true,
 }
 
 // ---------------------------------------------------------------------------
@@ -110,7 +131,7 @@ var systemReadOnlyFields = map[string]map[string]bool{
 		"created_at": true, "updated_at": true, "last_login_at": true,
 	},
 	"apikeys": {
-		"id": true, "key_hash": true,
+		"id": true, "key_hash": true, "user_id": true,
 		"created_at": true, "updated_at": true, "last_used_at": true,
 	},
 }
@@ -122,6 +143,13 @@ var hiddenSystemFields = map[string]map[string]bool{
 	"apikeys": {"key_hash": true},
 }
 
+// systemSearchFields maps system collection names to the fields the q
+// parameter searches. Other collections search every string field.
+var systemSearchFields = map[string][]string{
+	"users":   {"username", "email"},
+	"apikeys": {"name"},
+}
+
 // ---------------------------------------------------------------------------
 // Physical-to-Moon type mapping
 // ---------------------------------------------------------------------------
@@ -145,9 +173,14 @@ var physicalTypeMap = map[string]string{
 
 // Collection represents an API-visible collection schema.
 type Collection struct {
-	Name   string
-	Fields []Field
-	System bool
+	Name    string
+	Fields  []Field
+	System  bool
+	Indexes []IndexInfo // secondary indexes created through /collections:indexes
+
+	// Attributes are the flex attributes defined on a collection with an
+	// _attributes column, ordered by name. Only Name and Type are set.
+	Attributes []Field
 }
 
 // APIFields returns only fields that should be visible in API schema
@@ -170,11 +203,89 @@ func (c *Collection) APIFields() []Field {
 
 // Field represents a single field descriptor in a collection.
 type Field struct {
-	Name     string
-	Type     string
-	Nullable bool
-	Unique   bool
-	ReadOnly bool
+	Name      string
+	Type      string
+	Nullable  bool
+	Unique    bool
+	ReadOnly  bool
+	Collation string // CollationNocase, or empty for binary
+	Rules     FieldRules
+
+	// Precision and Scale are the declared digits of a decimal field.
+	// Precision 0 means none was declared.
+	Precision int
+	Scale     int
+}
+
+// FieldRules are optional value constraints declared on a field. They are
+// stored as column CHECK constraints, so the database enforces them too.
+// Min and Max apply to integer fields; MinLength, MaxLength, and Enum apply
+// to string fields. Lengths count characters, not bytes.
+type FieldRules struct {
+	Min       *int64   `json:"min,omitempty"`
+	Max       *int64   `json:"max,omitempty"`
+	MinLength *int     `json:"min_length,omitempty"`
+	MaxLength *int     `json:"max_length,omitempty"`
+	Enum      []string `json:"enum,omitempty"`
+}
+
+// IsZero reports whether no rule is set.
+func (r FieldRules) IsZero() bool {
+	return r.Min == nil && r.Max == nil && r.MinLength == nil && r.MaxLength == nil && len(r.Enum) == 0
+}
+
+// Equal reports whether r and o declare the same rules.
+func (r FieldRules) Equal(o FieldRules) bool {
+	return int64PtrEqual(r.Min, o.Min) && int64PtrEqual(r.Max, o.Max) &&
+		intPtrEqual(r.MinLength, o.MinLength) && intPtrEqual(r.MaxLength, o.MaxLength) &&
+		slices.Equal(r.Enum, o.Enum)
+}
+
+// Check validates a non-null, type-valid value against the rules.
+func (r FieldRules) Check(name string, value any) error {
+	switch v := value.(type) {
+	case string:
+		n := utf8.RuneCountInString(v)
+		if r.MinLength != nil && n < *r.MinLength {
+			return fmt.Errorf("Field '%s' must be at least %d characters", name, *r.MinLength)
+		}
+		if r.MaxLength != nil && n > *r.MaxLength {
+			return fmt.Errorf("Field '%s' must be at most %d characters", name, *r.MaxLength)
+		}
+		if len(r.Enum) > 0 && !slices.Contains(r.Enum, v) {
+			return fmt.Errorf("Field '%s' must be one of: %s", name, strings.Join(r.Enum, ", "))
+		}
+	case float64, int, int64:
+		n, _ := toInt64(v)
+		if r.Min != nil && n < *r.Min {
+			return fmt.Errorf("Field '%s' must be at least %d", name, *r.Min)
+		}
+		if r.Max != nil && n > *r.Max {
+			return fmt.Errorf("Field '%s' must be at most %d", name, *r.Max)
+		}
+	}
+	return nil
+}
+
+// toInt64 converts an integer-valued JSON number to int64.
+func toInt64(value any) (int64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return int64(v), v == math.Trunc(v)
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	}
+	return 0, false
+}
+
+func int64PtrEqual(a, b *int64) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+func intPtrEqual(a, b *int) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
 }
 
 // ---------------------------------------------------------------------------
@@ -189,6 +300,28 @@ type SchemaRegistry struct {
 	collections map[string]*Collection
 	order       []string // sorted collection names for stable iteration
 	db          DatabaseAdapter
+
+	// versionMu guards the shared schema version bookkeeping used to
+	// notice collection changes made by other Moon instances.
+	// publishPending is set while a local change has not been announced.
+	versionMu        sync.Mutex
+	version          string
+	lastVersionCheck time.Time
+	publishPending   bool
+
+	// logger, when set, receives failed version publishes. stop and wg
+	// belong to the version poller started by StartVersionPoll.
+	logger   *Logger
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+
+	// versionCache counts SyncVersion calls answered from the known
+	// version (hits) and calls that read the shared version (misses).
+	versionCache cacheCounter
+
+	// migrations runs the shadow-table rebuilds of column modifications.
+	migrations *ShadowMigrator
 }
 
 // NewSchemaRegistry creates a new registry and populates it from the
@@ -198,10 +331,14 @@ func NewSchemaRegistry(db DatabaseAdapter) (*SchemaRegistry, error) {
 	r := &SchemaRegistry{
 		collections: make(map[string]*Collection),
 		db:          db,
+		stop:        make(chan struct{}),
 	}
+	r.migrations = NewShadowMigrator(db, r)
 	if err := r.populate(context.Background()); err != nil {
 		return nil, err
 	}
+	r.version, _ = r.readVersion(context.Background())
+	r.lastVersionCheck = time.Now()
 	return r, nil
 }
 
@@ -230,17 +367,219 @@ func (r *SchemaRegistry) List() []*Collection {
 // is returned. Readers always see either the old or the new complete
 // state, never a partial update.
 func (r *SchemaRegistry) Refresh() error {
+	_, err := r.RefreshWithDiff()
+	return err
+}
+
+// SchemaDiff reports which collections changed during a registry refresh.
+// Each list is sorted alphabetically and never nil.
+type SchemaDiff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Changed []string `json:"changed"`
+}
+
+// RefreshWithDiff rebuilds the registry like Refresh and reports the
+// collections that were added, removed, or changed relative to the
+// previous state. The diff is computed under the write lock so it always
+// describes exactly the swap that took place.
+func (r *SchemaRegistry) RefreshWithDiff() (SchemaDiff, error) {
 	newCollections, newOrder, err := r.buildFromDB(context.Background())
 	if err != nil {
-		return err
+		return SchemaDiff{}, err
 	}
 	r.mu.Lock()
+	diff := diffCollections(r.collections, newCollections)
 	r.collections = newCollections
 	r.order = newOrder
 	r.mu.Unlock()
+	return diff, nil
+}
+
+// ---------------------------------------------------------------------------
+// Shared schema version
+// ---------------------------------------------------------------------------
+
+// PublishVersion records a new schema version in moon_schema_version so
+// other Moon instances sharing the database refresh their registries.
+// It must be called after a schema change has been persisted and the
+// local registry refreshed.
+func (r *SchemaRegistry) PublishVersion(ctx context.Context) error {
+	version := GenerateULID()
+	now := time.Now().UTC().Format(time.RFC3339)
+	err := r.db.ExecDDLBatch(ctx, []string{
+		fmt.Sprintf("DELETE FROM %s", SchemaVersionTable),
+		fmt.Sprintf("INSERT INTO %s (id, version, updated_at) VALUES ('%s', '%s', '%s')",
+			SchemaVersionTable, SchemaVersionRowID, version, now),
+	})
+	if err != nil {
+		return fmt.Errorf("schema registry: publish version: %w", err)
+	}
+	r.versionMu.Lock()
+	r.version = version
+	r.publishPending = false
+	r.versionMu.Unlock()
 	return nil
 }
 
+// SetLogger sets the logger that receives failed version publishes.
+func (r *SchemaRegistry) SetLogger(logger *Logger) {
+	r.logger = logger
+}
+
+// AnnounceChange publishes a new schema version after a local schema
+// change. A failure is logged and left pending: the version poller
+// retries it, and PublishPending reports it until it succeeds, so peers
+// are never left on a stale schema without a trace.
+func (r *SchemaRegistry) AnnounceChange(ctx context.Context) {
+	err := r.PublishVersion(ctx)
+	if err == nil {
+		return
+	}
+	r.versionMu.Lock()
+	r.publishPending = true
+	r.versionMu.Unlock()
+	if r.logger != nil {
+		r.logger.ErrorContext(ctx, "schema version not published; other instances keep the old schema until it is", "error", err)
+	}
+}
+
+// PublishPending reports whether a local schema change has not yet been
+// announced to other instances.
+func (r *SchemaRegistry) PublishPending() bool {
+	r.versionMu.Lock()
+	defer r.versionMu.Unlock()
+	return r.publishPending
+}
+
+// StartVersionPoll checks the shared schema version every interval in the
+// background, so an instance picks up a peer's change within interval
+// even while it serves no requests. Each tick first retries a pending
+// publish. Close stops the poller.
+func (r *SchemaRegistry) StartVersionPoll(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				r.pollVersion(context.Background())
+			}
+		}
+	}()
+}
+
+// Close stops the version poller and the migration scheduler.
+func (r *SchemaRegistry) Close() {
+	r.stopOnce.Do(func() { close(r.stop) })
+	r.wg.Wait()
+	if r.migrations != nil {
+		r.migrations.Close()
+	}
+}
+
+// Migrations returns the engine that runs the shadow-table rebuilds of
+// the registry's collections. Its scheduler is started separately.
+func (r *SchemaRegistry) Migrations() *ShadowMigrator {
+	return r.migrations
+}
+
+// pollVersion makes one poller check: a pending publish is retried,
+// otherwise the shared version is read and the registry refreshed when a
+// peer has changed it.
+func (r *SchemaRegistry) pollVersion(ctx context.Context) {
+	if r.PublishPending() {
+		if err := r.PublishVersion(ctx); err != nil {
+			return
+		}
+		if r.logger != nil {
+			r.logger.Info("pending schema version published")
+		}
+		return
+	}
+	r.versionMu.Lock()
+	r.lastVersionCheck = time.Now()
+	r.versionMu.Unlock()
+	if err := r.checkVersion(ctx); err != nil && r.logger != nil {
+		r.logger.Warn("schema version sync failed", "error", err)
+	}
+}
+
+// Version returns the schema version this instance last published or
+// synced, or "" when it has seen none.
+func (r *SchemaRegistry) Version() string {
+	r.versionMu.Lock()
+	defer r.versionMu.Unlock()
+	return r.version
+}
+
+// SyncVersion refreshes the registry when another instance has published
+// a newer schema version. The shared version is read at most once every
+// SchemaVersionCheckSeconds, counting the poller's reads; calls in between
+// return immediately. A missing version table is not an error.
+func (r *SchemaRegistry) SyncVersion(ctx context.Context) error {
+	r.versionMu.Lock()
+	if time.Since(r.lastVersionCheck) < SchemaVersionCheckSeconds*time.Second {
+		r.versionMu.Unlock()
+		r.versionCache.record(true)
+		return nil
+	}
+	r.versionCache.record(false)
+	r.lastVersionCheck = time.Now()
+	r.versionMu.Unlock()
+	return r.checkVersion(ctx)
+}
+
+// checkVersion reads the shared version and refreshes the registry when
+// it differs from the one this instance knows.
+func (r *SchemaRegistry) checkVersion(ctx context.Context) error {
+	r.versionMu.Lock()
+	known := r.version
+	r.versionMu.Unlock()
+
+	current, err := r.readVersion(ctx)
+	if err != nil || current == known {
+		return nil
+	}
+
+	if err := r.Refresh(); err != nil {
+		return err
+	}
+	// Results cached under the old schema may lack or carry columns.
+	if c, ok := r.db.(*CachedAdapter); ok {
+		c.reset()
+	}
+	r.versionMu.Lock()
+	r.version = current
+	r.versionMu.Unlock()
+	return nil
+}
+
+// readVersion returns the shared schema version, or "" when none has
+// been published yet.
+func (r *SchemaRegistry) readVersion(ctx context.Context) (string, error) {
+	rows, _, err := r.db.QueryRows(ctx, SchemaVersionTable, QueryOptions{
+		Filters: []Filter{{Field: "id", Op: "eq", Value: SchemaVersionRowID}},
+		Page:    1,
+		PerPage: 1,
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(rows) == 0 {
+		return "", nil
+	}
+	v, _ := rows[0]["version"].(string)
+	return v, nil
+}
+
 // ---------------------------------------------------------------------------
 // Validation helpers
 // ---------------------------------------------------------------------------
@@ -249,39 +588,94 @@ func (r *SchemaRegistry) Refresh() error {
 // collection. It checks length, pattern, reserved names, the moon_
 // prefix, and SQL keywords.
 func IsValidCollectionName(name string) bool {
+	return ValidateCollectionName(name) == nil
+}
+
+// ValidateCollectionName is IsValidCollectionName with a client-facing
+// reason and, where one exists, a suggested valid alternative.
+func ValidateCollectionName(name string) error {
 	n := len(name)
 	if n < MinCollectionNameLen || n > MaxCollectionNameLen {
-		return false
+		return fmt.Errorf("Invalid collection name %q: must be %d to %d characters",
+			name, MinCollectionNameLen, MaxCollectionNameLen)
 	}
 	if !namePattern.MatchString(name) {
-		return false
+		return nameErrorWithSuggestion("collection", name, "must be lowercase snake_case starting with a letter",
+			IsValidCollectionName, toSnakeCase(name))
 	}
 	if strings.HasPrefix(name, "moon_") {
-		return false
+		return nameErrorWithSuggestion("collection", name, "the moon_ prefix is reserved",
+			IsValidCollectionName, strings.TrimPrefix(name, "moon_"))
 	}
 	if reservedCollectionNames[name] {
-		return false
+		return nameErrorWithSuggestion("collection", name, "the name is reserved by Moon",
+			IsValidCollectionName, "app_"+name)
 	}
 	if sqlReservedKeywords[name] {
-		return false
+		return nameErrorWithSuggestion("collection", name, "the name is a SQL reserved word",
+			IsValidCollectionName, name+"s", name+"_items")
 	}
-	return true
+	return nil
 }
 
 // IsValidFieldName validates a name for use as a collection field.
 // It checks length, pattern, and SQL keywords.
 func IsValidFieldName(name string) bool {
+	return ValidateFieldName(name) == nil
+}
+
+// ValidateFieldName is IsValidFieldName with a client-facing reason and,
+// where one exists, a suggested valid alternative.
+func ValidateFieldName(name string) error {
 	n := len(name)
 	if n < MinFieldNameLen || n > MaxFieldNameLen {
-		return false
+		return fmt.Errorf("Invalid column name %q: must be %d to %d characters",
+			name, MinFieldNameLen, MaxFieldNameLen)
 	}
 	if !namePattern.MatchString(name) {
-		return false
+		return nameErrorWithSuggestion("column", name, "must be lowercase snake_case starting with a letter",
+			IsValidFieldName, toSnakeCase(name))
 	}
 	if sqlReservedKeywords[name] {
-		return false
+		return nameErrorWithSuggestion("column", name, "the name is a SQL reserved word",
+			IsValidFieldName, name+"_value", name+"_name")
 	}
-	return true
+	return nil
+}
+
+// nameErrorWithSuggestion formats a naming error and appends the first
+// candidate that passes valid.
+func nameErrorWithSuggestion(kind, name, reason string, valid func(string) bool, candidates ...string) error {
+	for _, c := range candidates {
+		if c != name && valid(c) {
+			return fmt.Errorf("Invalid %s name %q: %s; try %q", kind, name, reason, c)
+		}
+	}
+	return fmt.Errorf("Invalid %s name %q: %s", kind, name, reason)
+}
+
+// toSnakeCase converts name to lowercase snake_case, splitting camelCase
+// words and replacing other characters with underscores.
+func toSnakeCase(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r >= 'A' && r <= 'Z':
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r + ('a' - 'A'))
+		case (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9'):
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	out := strings.TrimRight(strings.TrimLeft(b.String(), "_0123456789"), "_")
+	for strings.Contains(out, "__") {
+		out = strings.ReplaceAll(out, "__", "_")
+	}
+	return out
 }
 
 // IsSQLKeyword returns true if name is a SQL reserved keyword.
@@ -335,16 +729,52 @@ func (r *SchemaRegistry) buildFromDB(ctx context.Context) (map[string]*Collectio
 			return nil, nil, err
 		}
 
+		indexes, err := r.db.ListIndexes(ctx, table)
+		if err != nil {
+			return nil, nil, fmt.Errorf("schema registry: list indexes of %q: %w", table, err)
+		}
+
 		fields = ensureIDFirst(fields)
 		isSystem := table == "users" || table == "apikeys"
-		collections[table] = &Collection{Name: table, Fields: fields, System: isSystem}
+		collections[table] = &Collection{Name: table, Fields: fields, System: isSystem, Indexes: indexes}
 		order = append(order, table)
 	}
 
+	if slices.Contains(tables, AttributesTable) {
+		if err := r.loadAttributes(ctx, collections); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	sort.Strings(order)
 	return collections, order, nil
 }
 
+// loadAttributes reads the flex attribute definitions into the collections
+// that have an _attributes column. Definitions of other collections are
+// ignored.
+func (r *SchemaRegistry) loadAttributes(ctx context.Context, collections map[string]*Collection) error {
+	for page := 1; ; page++ {
+		rows, _, err := r.db.QueryRows(ctx, AttributesTable, QueryOptions{
+			Sort:    []SortField{{Field: "collection"}, {Field: "name"}},
+			Page:    page,
+			PerPage: MaxPerPage,
+		})
+		if err != nil {
+			return fmt.Errorf("schema registry: load attributes: %w", err)
+		}
+		for _, row := range rows {
+			col, ok := collections[stringVal(row, "collection")]
+			if ok && hasAttributes(col) {
+				col.Attributes = append(col.Attributes, Field{Name: stringVal(row, "name"), Type: stringVal(row, "type"), Nullable: true})
+			}
+		}
+		if len(rows) < MaxPerPage {
+			return nil
+		}
+	}
+}
+
 // matchesCollectionPattern checks whether a table name matches the
 // naming pattern for API-visible collections (length + snake_case).
 // It does NOT check reserved names or SQL keywords, because system
@@ -373,6 +803,16 @@ func mapColumnsToFields(table string, columns []ColumnInfo) ([]Field, error) {
 			Unique:   col.Unique,
 			ReadOnly: isReadOnlyField(table, col.Name, col.PK),
 		}
+		if _, system := systemReadOnlyFields[table]; !system && (isTimestampField(field) || isVersionField(field) || isOwnerField(field)) {
+			field.ReadOnly = true
+		}
+		if col.Collation == CollationNocase {
+			field.Collation = CollationNocase
+		}
+		field.Rules = col.Rules
+		if moonType == MoonFieldTypeDecimal {
+			field.Precision, field.Scale = parseDecimalType(col.Type)
+		}
 		fields = append(fields, field)
 	}
 	return fields, nil
@@ -419,6 +859,119 @@ func isReadOnlyField(table, field string, isPK bool) bool {
 	return false
 }
 
+// isTimestampField reports whether f is a system timestamp column of a
+// dynamic collection: created_at or updated_at with the datetime type.
+// The server sets these on create and update, and clients cannot write them.
+func isTimestampField(f Field) bool {
+	return (f.Name == FieldCreatedAt || f.Name == FieldUpdatedAt) && f.Type == MoonFieldTypeDatetime
+}
+
+// isVersionField reports whether f is the optimistic concurrency column of a
+// dynamic collection: a non-nullable integer named _version. The server
+// sets it to 1 on create and increments it on every update.
+func isVersionField(f Field) bool {
+	return f.Name == FieldVersion && f.Type == MoonFieldTypeInteger && !f.Nullable
+}
+
+// isOwnerField reports whether f is the row ownership column of a dynamic
+// collection: a string named owner_id. The server sets it to the creating
+// caller's ID, and non-admin callers can only read and change their own
+// rows.
+func isOwnerField(f Field) bool {
+	return f.Name == FieldOwnerID && f.Type == MoonFieldTypeString
+}
+
+// isAttributesField reports whether f is the flex attributes column of a
+// dynamic collection: a JSON column named _attributes.
+func isAttributesField(f Field) bool {
+	return f.Name == FieldAttributes && f.Type == MoonFieldTypeJSON
+}
+
+// hasAttributes reports whether col has an _attributes column.
+func hasAttributes(col *Collection) bool {
+	if col.System {
+		return false
+	}
+	for _, f := range col.Fields {
+		if isAttributesField(f) {
+			return true
+		}
+	}
+	return false
+}
+
+// findAttribute returns the flex attribute of col named name, or nil.
+func findAttribute(col *Collection, name string) *Field {
+	for i := range col.Attributes {
+		if col.Attributes[i].Name == name {
+			return &col.Attributes[i]
+		}
+	}
+	return nil
+}
+
+// isOwnedCollection reports whether col has an owner_id column.
+func isOwnedCollection(col *Collection) bool {
+	for _, f := range col.Fields {
+		if isOwnerField(f) {
+			return true
+		}
+	}
+	return false
+}
+
+// diffCollections compares two registry states and returns the names of
+// collections that were added, removed, or whose fields changed.
+func diffCollections(oldCols, newCols map[string]*Collection) SchemaDiff {
+	diff := SchemaDiff{Added: []string{}, Removed: []string{}, Changed: []string{}}
+	for name, nc := range newCols {
+		oc, ok := oldCols[name]
+		if !ok {
+			diff.Added = append(diff.Added, name)
+			continue
+		}
+		if !collectionsEqual(oc, nc) {
+			diff.Changed = append(diff.Changed, name)
+		}
+	}
+	for name := range oldCols {
+		if _, ok := newCols[name]; !ok {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Changed)
+	return diff
+}
+
+// collectionsEqual reports whether two collections have the same system
+// flag, identical field descriptors in the same order, and the same
+// indexes and flex attributes.
+func collectionsEqual(a, b *Collection) bool {
+	if a.System != b.System || len(a.Fields) != len(b.Fields) || len(a.Indexes) != len(b.Indexes) {
+		return false
+	}
+	if !slices.EqualFunc(a.Attributes, b.Attributes, func(x, y Field) bool { return x.Name == y.Name && x.Type == y.Type }) {
+		return false
+	}
+	for i := range a.Indexes {
+		ia, ib := a.Indexes[i], b.Indexes[i]
+		if ia.Name != ib.Name || ia.Unique != ib.Unique || !slices.Equal(ia.Columns, ib.Columns) {
+			return false
+		}
+	}
+	for i := range a.Fields {
+		fa, fb := a.Fields[i], b.Fields[i]
+		if fa.Name != fb.Name || fa.Type != fb.Type || fa.Nullable != fb.Nullable ||
+			fa.Unique != fb.Unique || fa.ReadOnly != fb.ReadOnly || fa.Collation != fb.Collation ||
+			fa.Precision != fb.Precision || fa.Scale != fb.Scale || !fa.Rules.Equal(fb.Rules) {
+			return false
+		}
+	}
+	return true
+}
+
 // ensureIDFirst returns a new slice with the "id" field moved to index 0,
 // preserving the relative order of all other fields.
 func ensureIDFirst(fields []Field) []Field {
@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"context"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 )
 
 // ---------------------------------------------------------------------------
@@ -612,6 +614,189 @@ func TestSchemaRegistry_RefreshPreservesOnError(t *testing.T) {
 	}
 }
 
+func TestSchemaRegistry_RefreshWithDiff(t *testing.T) {
+	adapter := testRegistryAdapter(t)
+	ctx := context.Background()
+
+	for _, ddl := range []string{
+		`CREATE TABLE keep_me (id TEXT PRIMARY KEY, name TEXT NOT NULL)`,
+		`CREATE TABLE drop_me (id TEXT PRIMARY KEY, name TEXT NOT NULL)`,
+		`CREATE TABLE alter_me (id TEXT PRIMARY KEY, name TEXT NOT NULL)`,
+	} {
+		if err := adapter.ExecDDL(ctx, ddl); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reg, err := NewSchemaRegistry(adapter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ddl := range []string{
+		`DROP TABLE drop_me`,
+		`ALTER TABLE alter_me ADD COLUMN note TEXT`,
+		`CREATE TABLE new_one (id TEXT PRIMARY KEY)`,
+	} {
+		if err := adapter.ExecDDL(ctx, ddl); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	diff, err := reg.RefreshWithDiff()
+	if err != nil {
+		t.Fatalf("RefreshWithDiff: %v", err)
+	}
+	if !reflect.DeepEqual(diff.Added, []string{"new_one"}) {
+		t.Errorf("added: got %v", diff.Added)
+	}
+	if !reflect.DeepEqual(diff.Removed, []string{"drop_me"}) {
+		t.Errorf("removed: got %v", diff.Removed)
+	}
+	if !reflect.DeepEqual(diff.Changed, []string{"alter_me"}) {
+		t.Errorf("changed: got %v", diff.Changed)
+	}
+
+	// A second refresh with no out-of-band changes reports nothing.
+	diff, err = reg.RefreshWithDiff()
+	if err != nil {
+		t.Fatalf("RefreshWithDiff: %v", err)
+	}
+	if len(diff.Added)+len(diff.Removed)+len(diff.Changed) != 0 {
+		t.Errorf("expected empty diff, got %+v", diff)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Shared schema version
+// ---------------------------------------------------------------------------
+
+func TestSchemaRegistry_SyncVersion_PicksUpPeerChange(t *testing.T) {
+	adapter := testRegistryAdapter(t)
+	ctx := context.Background()
+
+	local, err := NewSchemaRegistry(adapter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer, err := NewSchemaRegistry(adapter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := adapter.ExecDDL(ctx, `CREATE TABLE shared (id TEXT PRIMARY KEY)`); err != nil {
+		t.Fatal(err)
+	}
+	if err := local.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if err := local.PublishVersion(ctx); err != nil {
+		t.Fatalf("PublishVersion: %v", err)
+	}
+
+	// Within the check interval the peer keeps its cached state.
+	if err := peer.SyncVersion(ctx); err != nil {
+		t.Fatalf("SyncVersion: %v", err)
+	}
+	if _, ok := peer.Get("shared"); ok {
+		t.Fatal("peer should not re-check before the interval elapses")
+	}
+
+	peer.lastVersionCheck = time.Time{}
+	if err := peer.SyncVersion(ctx); err != nil {
+		t.Fatalf("SyncVersion: %v", err)
+	}
+	if _, ok := peer.Get("shared"); !ok {
+		t.Fatal("peer should see the collection after syncing")
+	}
+}
+
+func TestSchemaRegistry_SyncVersion_MissingTable(t *testing.T) {
+	adapter := testRegistryAdapter(t)
+	ctx := context.Background()
+	if err := adapter.ExecDDL(ctx, "DROP TABLE "+SchemaVersionTable); err != nil {
+		t.Fatal(err)
+	}
+
+	reg, err := NewSchemaRegistry(adapter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg.lastVersionCheck = time.Time{}
+	if err := reg.SyncVersion(ctx); err != nil {
+		t.Fatalf("expected missing version table to be ignored, got %v", err)
+	}
+}
+
+func TestSchemaRegistry_VersionPollPicksUpPeerChange(t *testing.T) {
+	adapter := testRegistryAdapter(t)
+	ctx := context.Background()
+
+	local, err := NewSchemaRegistry(adapter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer, err := NewSchemaRegistry(adapter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer.StartVersionPoll(10 * time.Millisecond)
+	defer peer.Close()
+
+	if err := adapter.ExecDDL(ctx, `CREATE TABLE polled (id TEXT PRIMARY KEY)`); err != nil {
+		t.Fatal(err)
+	}
+	if err := local.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	local.AnnounceChange(ctx)
+
+	// The peer serves no requests, so only the poller can refresh it.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := peer.Get("polled"); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the poller to pick up the peer's change")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSchemaRegistry_AnnounceChangeRetriesFailedPublish(t *testing.T) {
+	adapter := testRegistryAdapter(t)
+	ctx := context.Background()
+	reg, err := NewSchemaRegistry(adapter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs bytes.Buffer
+	reg.SetLogger(NewTestLogger(&logs))
+
+	if err := adapter.ExecDDL(ctx, "DROP TABLE "+SchemaVersionTable); err != nil {
+		t.Fatal(err)
+	}
+	reg.AnnounceChange(ctx)
+	if !reg.PublishPending() {
+		t.Fatal("expected a failed publish to stay pending")
+	}
+	if !strings.Contains(logs.String(), "schema version not published") {
+		t.Errorf("expected the failure to be logged, got %q", logs.String())
+	}
+
+	if err := adapter.ExecDDL(ctx, ddlSchemaVersionTable); err != nil {
+		t.Fatal(err)
+	}
+	reg.pollVersion(ctx)
+	if reg.PublishPending() {
+		t.Fatal("expected the poller to publish the pending version")
+	}
+	if current, err := reg.readVersion(ctx); err != nil || current == "" || current != reg.Version() {
+		t.Errorf("expected version %q to be stored, got %q (%v)", reg.Version(), current, err)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Concurrency safety
 // ---------------------------------------------------------------------------
@@ -700,6 +885,7 @@ func TestIsValidCollectionName(t *testing.T) {
 		{"auth", false},
 		{"doc", false},
 		{"health", false},
+		{"batch", false},
 
 		// moon_ prefix.
 		{"moon_custom", false},
@@ -716,6 +902,11 @@ func TestIsValidCollectionName(t *testing.T) {
 		{"index", false},
 		{"where", false},
 		{"from", false},
+
+		// Reserved only in PostgreSQL or MySQL.
+		{"user", false},
+		{"schema", false},
+		{"lock", false},
 	}
 
 	for _, tt := range tests {
@@ -745,6 +936,30 @@ func TestIsValidCollectionName_MaxLen(t *testing.T) {
 	}
 }
 
+func TestValidateCollectionName_Messages(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"order", `Invalid collection name "order": the name is a SQL reserved word; try "orders"`},
+		{"user", `Invalid collection name "user": the name is a SQL reserved word; try "user_items"`},
+		{"health", `Invalid collection name "health": the name is reserved by Moon; try "app_health"`},
+		{"moon_events", `Invalid collection name "moon_events": the moon_ prefix is reserved; try "events"`},
+		{"OrderItems", `Invalid collection name "OrderItems": must be lowercase snake_case starting with a letter; try "order_items"`},
+		{"1-tables2", `Invalid collection name "1-tables2": must be lowercase snake_case starting with a letter; try "tables2"`},
+		{"a", `Invalid collection name "a": must be 2 to 63 characters`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateCollectionName(tt.name)
+			if err == nil || err.Error() != tt.want {
+				t.Fatalf("ValidateCollectionName(%q) = %v, want %q", tt.name, err, tt.want)
+			}
+		})
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Field naming validation
 // ---------------------------------------------------------------------------
@@ -775,6 +990,8 @@ func TestIsValidFieldName(t *testing.T) {
 		{"select", false},
 		{"table", false},
 		{"where", false},
+		{"read", false},
+		{"interval", false},
 	}
 
 	for _, tt := range tests {
@@ -787,6 +1004,26 @@ func TestIsValidFieldName(t *testing.T) {
 	}
 }
 
+func TestValidateFieldName_Messages(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"order", `Invalid column name "order": the name is a SQL reserved word; try "order_value"`},
+		{"createdAt", `Invalid column name "createdAt": must be lowercase snake_case starting with a letter; try "created_at"`},
+		{"ab", `Invalid column name "ab": must be 3 to 63 characters`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateFieldName(tt.name)
+			if err == nil || err.Error() != tt.want {
+				t.Fatalf("ValidateFieldName(%q) = %v, want %q", tt.name, err, tt.want)
+			}
+		})
+	}
+}
+
 func TestIsValidFieldName_MaxLen(t *testing.T) {
 	name := "abc" + repeatStr("d", 60)
 	if len(name) != 63 {
@@ -15,20 +15,22 @@ import (
 // NewRouter builds the HTTP mux with all routes registered under the
 // configured server prefix.
 func NewRouter(prefix string, logger *Logger, db DatabaseAdapter, cfg *AppConfig, registry ...*SchemaRegistry) *http.ServeMux {
-	return NewRouterWithJTI(prefix, logger, db, cfg, nil, nil, registry...)
+	return NewRouterWithJTI(prefix, logger, db, cfg, nil, nil, nil, registry...)
 }
 
 // NewRouterWithJTI builds the HTTP mux like NewRouter but also accepts
-// a JTI revocation store and an optional RateLimiter for use by the auth handler.
-func NewRouterWithJTI(prefix string, logger *Logger, db DatabaseAdapter, cfg *AppConfig, jtiStore *JTIRevocationStore, rl *RateLimiter, registry ...*SchemaRegistry) *http.ServeMux {
+// a JTI revocation store and an optional RateLimiter for use by the auth
+// handler, and an optional PermissionStore for the admin permission routes.
+func NewRouterWithJTI(prefix string, logger *Logger, db DatabaseAdapter, cfg *AppConfig, jtiStore *JTIRevocationStore, rl *RateLimiter, perms *PermissionStore, registry ...*SchemaRegistry) *http.ServeMux {
 	mux := http.NewServeMux()
 
 	p := strings.TrimRight(prefix, "/")
+	rt := newRouter(mux, p)
 
 	// Public routes
-	mux.HandleFunc(fmt.Sprintf("GET %s/health", p), handleHealth)
+	rt.Handle(http.MethodGet, "/health", handleHealth)
 	if p == "" {
-		mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+		rt.Handle(http.MethodGet, "/", func(w http.ResponseWriter, r *http.Request) {
 			if r.URL.Path != "/" {
 				WriteError(w, http.StatusNotFound, "Not found")
 				return
@@ -37,8 +39,8 @@ func NewRouterWithJTI(prefix string, logger *Logger, db DatabaseAdapter, cfg *Ap
 		})
 	} else {
 		// With prefix: GET /prefix → health, GET /prefix/ → health
-		mux.HandleFunc(fmt.Sprintf("GET %s", p), handleHealth)
-		mux.HandleFunc(fmt.Sprintf("GET %s/", p), func(w http.ResponseWriter, r *http.Request) {
+		rt.Handle(http.MethodGet, "", handleHealth)
+		rt.Handle(http.MethodGet, "/", func(w http.ResponseWriter, r *http.Request) {
 			if r.URL.Path != p+"/" {
 				WriteError(w, http.StatusNotFound, "Not found")
 				return
@@ -47,38 +49,204 @@ func NewRouterWithJTI(prefix string, logger *Logger, db DatabaseAdapter, cfg *Ap
 		})
 	}
 
+	if cfg != nil && cfg.WellKnown.RobotsTxt != "" {
+		rt.Handle(http.MethodGet, "/robots.txt", handleTextFile(cfg.WellKnown.RobotsTxt))
+	}
+	if cfg != nil && cfg.WellKnown.SecurityTxt != "" {
+		rt.Handle(http.MethodGet, "/.well-known/security.txt", handleTextFile(cfg.WellKnown.SecurityTxt))
+	}
+
+	if cfg != nil && cfg.TokenKeys().Asymmetric() {
+		rt.Handle(http.MethodGet, "/.well-known/jwks.json", handleJWKS(cfg.TokenKeys()))
+	}
+
 	// Auth routes
 	authHandler := newAuthSessionHandler(db, cfg, logger, rl)
-	mux.HandleFunc(fmt.Sprintf("POST %s/auth:session", p), authHandler.HandleSession)
+	rt.Handle(http.MethodPost, "/auth:session", authHandler.HandleSession)
+
+	if cfg != nil && cfg.OIDC.Issuer != "" {
+		authOIDCHandler := NewAuthOIDCHandler(authHandler, NewOIDCProvider(cfg.OIDC, cfg.JWTSecret))
+		rt.Handle(http.MethodPost, "/auth:oidc", authOIDCHandler.HandleOIDC)
+	}
+
+	if cfg != nil && cfg.Mail.Enabled() {
+		resetHandler := NewAuthPasswordResetHandler(db, cfg, NewMailer(cfg.Mail, logger), logger, rl)
+		rt.Handle(http.MethodPost, "/auth:forgot", resetHandler.HandleForgot)
+		rt.Handle(http.MethodPost, "/auth:reset", resetHandler.HandleReset)
+	}
+
+	if db != nil {
+		invitationHandler := NewAuthInvitationHandler(db, cfg, logger)
+		rt.Handle(http.MethodPost, "/auth:accept_invite", invitationHandler.HandleAccept)
+	}
 
 	authMeHandler := NewAuthMeHandler(db, cfg)
-	mux.HandleFunc(fmt.Sprintf("GET %s/auth:me", p), authMeHandler.GetMe)
-	mux.HandleFunc(fmt.Sprintf("POST %s/auth:me", p), authMeHandler.UpdateMe)
+	rt.Handle(http.MethodGet, "/auth:me", authMeHandler.GetMe)
+	rt.Handle(http.MethodPost, "/auth:me", authMeHandler.UpdateMe)
+
+	authKeysHandler := NewAuthKeysHandler(db, logger)
+	rt.Handle(http.MethodGet, "/auth:keys", authKeysHandler.HandleQuery)
+	rt.Handle(http.MethodPost, "/auth:keys", authKeysHandler.HandleMutate)
+
+	authSessionsHandler := NewAuthSessionsHandler(db, logger)
+	rt.Handle(http.MethodGet, "/auth:sessions", authSessionsHandler.HandleQuery)
+	rt.Handle(http.MethodPost, "/auth:sessions", authSessionsHandler.HandleMutate)
+
+	authTwoFactorHandler := NewAuthTwoFactorHandler(db, cfg, logger)
+	rt.Handle(http.MethodGet, "/auth:2fa", authTwoFactorHandler.HandleQuery)
+	rt.Handle(http.MethodPost, "/auth:2fa", authTwoFactorHandler.HandleMutate)
+
+	// Admin actions and record changes are also stored for /admin:audit.
+	var audit *AuditLog
+	if db != nil {
+		audit = NewAuditLog(db, logger)
+		aah := NewAdminAuditHandler(db, p)
+		rt.Handle(http.MethodGet, "/admin:audit", aah.HandleQuery)
+	}
+
+	var validators *ValidatorStore
+	if db != nil {
+		validators = NewValidatorStore(db, logger)
+	}
+
+	// Admin routes
+	if rl != nil {
+		arl := NewAdminRateLimitHandler(rl, logger)
+		arl.SetAuditLog(audit)
+		rt.Handle(http.MethodGet, "/admin:ratelimits", arl.HandleQuery)
+		rt.Handle(http.MethodPost, "/admin:ratelimits", arl.HandleMutate)
+	}
 
-	// Collection routes
 	var reg *SchemaRegistry
 	if len(registry) > 0 {
 		reg = registry[0]
 	}
+	rt.Handle(http.MethodGet, "/version", handleVersion(reg))
+
+	if perms != nil && reg != nil {
+		aph := NewAdminPermissionHandler(perms, reg, logger)
+		aph.SetAuditLog(audit)
+		rt.Handle(http.MethodGet, "/admin:permissions", aph.HandleQuery)
+		rt.Handle(http.MethodPost, "/admin:permissions", aph.HandleMutate)
+	}
+	if perms != nil && db != nil {
+		arh := NewAdminRoleHandler(perms, db, logger)
+		arh.SetAuditLog(audit)
+		rt.Handle(http.MethodGet, "/admin:roles", arh.HandleQuery)
+		rt.Handle(http.MethodPost, "/admin:roles", arh.HandleMutate)
+	}
+	if reg != nil && db != nil {
+		ath := NewAdminTemplateHandler(db, reg, logger)
+		ath.SetAuditLog(audit)
+		rt.Handle(http.MethodGet, "/admin:templates", ath.HandleQuery)
+		rt.Handle(http.MethodPost, "/admin:templates", ath.HandleMutate)
+
+		avh := NewAdminValidatorHandler(db, reg, logger)
+		avh.SetAuditLog(audit)
+		rt.Handle(http.MethodGet, "/admin:validators", avh.HandleQuery)
+		rt.Handle(http.MethodPost, "/admin:validators", avh.HandleMutate)
+	}
+
+	// Collection routes
 	if reg != nil && db != nil {
 		ch := NewCollectionHandler(db, reg, cfg)
-		mux.HandleFunc(fmt.Sprintf("GET %s/collections:query", p), ch.HandleQuery)
-		mux.HandleFunc(fmt.Sprintf("POST %s/collections:mutate", p), ch.HandleMutate)
+		ch.SetPermissions(perms)
+		rt.Handle(http.MethodGet, "/collections:query", ch.HandleQuery)
+		rt.Handle(http.MethodPost, "/collections:mutate", ch.HandleMutate)
+		rt.Handle(http.MethodPost, "/collections:refresh", ch.HandleRefresh)
+		rt.Handle(http.MethodPost, "/collections:rename", ch.HandleRename)
+		rt.Handle(http.MethodGet, "/collections:indexes", ch.HandleIndexes)
+		rt.Handle(http.MethodPost, "/collections:indexes", ch.HandleIndexesMutate)
+		rt.Handle(http.MethodPost, "/collections:infer", ch.HandleInfer)
+		rt.Handle(http.MethodGet, "/collections:migrations", ch.HandleMigrations)
 	} else {
-		mux.HandleFunc(fmt.Sprintf("GET %s/collections:query", p), handleCollectionsQuery)
-		mux.HandleFunc(fmt.Sprintf("POST %s/collections:mutate", p), handleCollectionsMutate)
+		rt.Handle(http.MethodGet, "/collections:query", handleCollectionsQuery)
+		rt.Handle(http.MethodPost, "/collections:mutate", handleCollectionsMutate)
+		rt.Handle(http.MethodPost, "/collections:refresh", handleCollectionsRefresh)
+	}
+
+	if reg != nil && db != nil {
+		bh := NewBatchHandler(db, reg)
+		bh.SetPermissions(perms)
+		bh.SetAuditLog(audit)
+		bh.SetValidators(validators)
+		rt.Handle(http.MethodPost, "/batch", bh.HandleBatch)
 	}
 
-	// Resource routes — use a catch-all pattern for /data/ paths
-	rqh := newResourceQueryHandlerOrNil(db, reg, cfg)
-	rmh := newResourceMutateHandlerOrNil(db, reg, cfg, jtiStore)
-	rsh := newResourceSchemaHandlerOrNil(reg, p)
-	mux.HandleFunc(fmt.Sprintf("GET %s/data/", p), func(w http.ResponseWriter, r *http.Request) {
-		routeDataRequest(w, r, p, http.MethodGet, rqh, rmh, rsh)
-	})
-	mux.HandleFunc(fmt.Sprintf("POST %s/data/", p), func(w http.ResponseWriter, r *http.Request) {
-		routeDataRequest(w, r, p, http.MethodPost, rqh, rmh, rsh)
-	})
+	if reg != nil {
+		oh := NewOpenAPIHandler(reg, p)
+		rt.Handle(http.MethodGet, "/openapi.json", oh.HandleSpec)
+	}
+
+	// Resource routes: /data/{collection}:{action}
+	query, mutate, schema := handleResourceQuery, handleResourceMutate, handleResourceSchema
+	upsert, updateWhere, destroyWhere := handleNotImplemented, handleNotImplemented, handleNotImplemented
+	if rqh := newResourceQueryHandlerOrNil(db, reg, cfg); rqh != nil {
+		query = rqh.HandleQuery
+	}
+	if rmh := newResourceMutateHandlerOrNil(db, reg, cfg, jtiStore); rmh != nil {
+		rmh.SetAuditLog(audit)
+		rmh.SetValidators(validators)
+		if cfg.Mail.Enabled() {
+			rmh.SetMailer(NewMailer(cfg.Mail, logger))
+		}
+		mutate, upsert = rmh.HandleMutate, rmh.HandleUpsert
+		updateWhere, destroyWhere = rmh.HandleUpdateWhere, rmh.HandleDestroyWhere
+	}
+	if rsh := newResourceSchemaHandlerOrNil(reg, p); rsh != nil {
+		schema = rsh.HandleSchema
+	}
+	rt.HandleAction(http.MethodGet, "query", query)
+	rt.HandleAction(http.MethodPost, "mutate", mutate)
+	rt.HandleAction(http.MethodPost, "upsert", upsert)
+	rt.HandleAction(http.MethodPost, "updateWhere", updateWhere)
+	rt.HandleAction(http.MethodPost, "destroyWhere", destroyWhere)
+	rt.HandleAction(http.MethodGet, "schema", schema)
+
+	attributes := handleNotImplemented
+	if rah := newResourceAttributesHandlerOrNil(db, reg); rah != nil {
+		attributes = rah.HandleMutate
+	}
+	rt.HandleAction(http.MethodPost, "attributes", attributes)
+
+	histogram, timeseries, pivot := handleNotImplemented, handleNotImplemented, handleNotImplemented
+	if rst := newResourceStatsHandlerOrNil(db, reg); rst != nil {
+		if cfg != nil {
+			rst.SetAggregatePrivacy(cfg.AggregatePrivacy)
+			if cfg.JWTSecret != "" {
+				rst.SetNoiseSecret(cfg.JWTSecret)
+			}
+		}
+		histogram, timeseries, pivot = rst.HandleHistogram, rst.HandleTimeSeries, rst.HandlePivot
+	}
+	rt.HandleAction(http.MethodGet, "histogram", histogram)
+	rt.HandleAction(http.MethodGet, "timeseries", timeseries)
+	rt.HandleAction(http.MethodGet, "pivot", pivot)
+
+	quality := handleNotImplemented
+	if rqh := newResourceQualityHandlerOrNil(db, reg); rqh != nil {
+		quality = rqh.HandleQuality
+	}
+	rt.HandleAction(http.MethodGet, "quality", quality)
+
+	export, importRows := handleNotImplemented, handleNotImplemented
+	if rtr := newResourceTransferHandlerOrNil(db, reg); rtr != nil {
+		if cfg != nil && cfg.BundleKey != "" {
+			rtr.SetBundleKey(cfg.BundleKey)
+		}
+		rtr.SetValidators(validators)
+		rtr.SetPasswordPolicy(cfg.Passwords())
+		export, importRows = rtr.HandleExport, rtr.HandleImport
+	}
+	rt.HandleAction(http.MethodGet, "export", export)
+	rt.HandleAction(http.MethodPost, "import", importRows)
+
+	render, qrcode := handleNotImplemented, handleNotImplemented
+	if rrh := newResourceRenderHandlerOrNil(db, reg); rrh != nil {
+		render, qrcode = rrh.HandleRender, rrh.HandleQRCode
+	}
+	rt.HandleAction(http.MethodGet, "render", render)
+	rt.HandleAction(http.MethodGet, "qrcode", qrcode)
 
 	return mux
 }
@@ -110,59 +278,49 @@ func newResourceSchemaHandlerOrNil(reg *SchemaRegistry, prefix string) *Resource
 	return NewResourceSchemaHandler(reg, prefix)
 }
 
-// routeDataRequest dispatches /data/{resource}:{action} paths to the
-// appropriate handler based on the action suffix.
-func routeDataRequest(w http.ResponseWriter, r *http.Request, prefix, method string, rqh *ResourceQueryHandler, rmh *ResourceMutateHandler, rsh *ResourceSchemaHandler) {
-	path := r.URL.Path
-	dataPrefix := prefix + "/data/"
-	if !strings.HasPrefix(path, dataPrefix) {
-		WriteError(w, http.StatusNotFound, "Not found")
-		return
+// newResourceAttributesHandlerOrNil creates a ResourceAttributesHandler if
+// dependencies are available, otherwise returns nil.
+func newResourceAttributesHandlerOrNil(db DatabaseAdapter, reg *SchemaRegistry) *ResourceAttributesHandler {
+	if db == nil || reg == nil {
+		return nil
 	}
+	return NewResourceAttributesHandler(db, reg)
+}
 
-	rest := path[len(dataPrefix):]
-
-	colonIdx := strings.LastIndex(rest, ":")
-	if colonIdx < 0 {
-		WriteError(w, http.StatusNotFound, "Not found")
-		return
+// newResourceStatsHandlerOrNil creates a ResourceStatsHandler if dependencies
+// are available, otherwise returns nil.
+func newResourceStatsHandlerOrNil(db DatabaseAdapter, reg *SchemaRegistry) *ResourceStatsHandler {
+	if db == nil || reg == nil {
+		return nil
 	}
+	return NewResourceStatsHandler(db, reg)
+}
 
-	resource := rest[:colonIdx]
-	action := rest[colonIdx+1:]
-
-	if resource == "" {
-		WriteError(w, http.StatusBadRequest, "Missing resource name")
-		return
+// newResourceQualityHandlerOrNil creates a ResourceQualityHandler if
+// dependencies are available, otherwise returns nil.
+func newResourceQualityHandlerOrNil(db DatabaseAdapter, reg *SchemaRegistry) *ResourceQualityHandler {
+	if db == nil || reg == nil {
+		return nil
 	}
+	return NewResourceQualityHandler(db, reg)
+}
 
-	if strings.HasPrefix(resource, "moon_") {
-		WriteError(w, http.StatusBadRequest, fmt.Sprintf("Resource name %q is reserved", resource))
-		return
+// newResourceTransferHandlerOrNil creates a ResourceTransferHandler if
+// dependencies are available, otherwise returns nil.
+func newResourceTransferHandlerOrNil(db DatabaseAdapter, reg *SchemaRegistry) *ResourceTransferHandler {
+	if db == nil || reg == nil {
+		return nil
 	}
+	return NewResourceTransferHandler(db, reg)
+}
 
-	switch {
-	case method == http.MethodGet && action == "query":
-		if rqh != nil {
-			rqh.HandleQuery(w, r)
-		} else {
-			handleResourceQuery(w, r)
-		}
-	case method == http.MethodPost && action == "mutate":
-		if rmh != nil {
-			rmh.HandleMutate(w, r)
-		} else {
-			handleResourceMutate(w, r)
-		}
-	case method == http.MethodGet && action == "schema":
-		if rsh != nil {
-			rsh.HandleSchema(w, r)
-		} else {
-			handleResourceSchema(w, r)
-		}
-	default:
-		WriteError(w, http.StatusNotFound, "Not found")
+// newResourceRenderHandlerOrNil creates a ResourceRenderHandler if
+// dependencies are available, otherwise returns nil.
+func newResourceRenderHandlerOrNil(db DatabaseAdapter, reg *SchemaRegistry) *ResourceRenderHandler {
+	if db == nil || reg == nil {
+		return nil
 	}
+	return NewResourceRenderHandler(db, reg)
 }
 
 // BuildHandler wraps the router with the full middleware chain in the order
@@ -177,9 +335,15 @@ func BuildHandler(mux *http.ServeMux, cfg *AppConfig, logger *Logger, opts ...Bu
 
 	// Middleware wraps from inside out, so we apply in reverse order.
 	// Final request order:
-	//   method validation → CORS → panic recovery → audit context → auth → website origin → rate limit → captcha → authz → handler
+	//   request ID → HSTS → compression → tracing → method validation → body limit → CORS → SLO timing → error sampling → panic recovery → database health → audit context → auth → load shedding → website origin → rate limit → captcha → collection alias → authz → schema sync → handler
+	if bo.schemaRegistry != nil {
+		handler = schemaSyncMiddleware(bo.schemaRegistry, handler)
+	}
 	if bo.authMiddleware != nil {
-		handler = Authorize(cfg.Server.Prefix, handler)
+		handler = AuthorizeWithPermissions(cfg.Server.Prefix, bo.permissions, handler)
+		if bo.aliasDB != nil && bo.aliasRegistry != nil {
+			handler = collectionAliasMiddleware(cfg.Server.Prefix, bo.aliasDB, bo.aliasRegistry, handler)
+		}
 		if bo.captchaStore != nil {
 			handler = captchaMiddleware(bo.captchaStore, handler)
 		}
@@ -187,12 +351,37 @@ func BuildHandler(mux *http.ServeMux, cfg *AppConfig, logger *Logger, opts ...Bu
 			handler = rateLimitMiddleware(bo.rateLimiter, logger, handler)
 		}
 		handler = websiteAPIKeyMiddleware(handler)
+		handler = NewLoadShedder(strings.TrimRight(cfg.Server.Prefix, "/")).Middleware(handler)
 		handler = bo.authMiddleware.Authenticate(handler)
 	}
 	handler = auditContextMiddleware(logger, handler)
-	handler = panicRecoveryMiddleware(logger, handler)
-	handler = corsMiddleware(cfg.CORS, handler)
+	if bo.dbHealth != nil {
+		handler = bo.dbHealth.Middleware(handler)
+	}
+	handler = panicRecoveryMiddleware(logger, bo.errorReporter, handler)
+	if bo.diagnostics != nil {
+		handler = errorSampleMiddleware(bo.diagnostics, handler)
+		if bo.diagnostics.slo != nil {
+			handler = sloMiddleware(bo.diagnostics.slo, handler)
+		}
+	}
+	corsPolicy := bo.corsPolicy
+	if corsPolicy == nil {
+		corsPolicy = NewCORSPolicy(cfg.CORS)
+	}
+	handler = corsMiddleware(corsPolicy, handler)
+	handler = bodyLimitMiddleware(handler)
 	handler = methodValidationMiddleware(handler)
+	if bo.tracer != nil {
+		handler = tracingMiddleware(bo.tracer, handler)
+	}
+	if cfg.Server.Compression {
+		handler = compressionMiddleware(handler)
+	}
+	if cfg.Server.TLS.Enabled() && cfg.Server.TLS.HSTSMaxAge > 0 {
+		handler = hstsMiddleware(cfg.Server.TLS.HSTSMaxAge, handler)
+	}
+	handler = requestIDMiddleware(handler)
 
 	return handler
 }
@@ -202,6 +391,15 @@ type buildHandlerOptions struct {
 	authMiddleware *AuthMiddleware
 	rateLimiter    *RateLimiter
 	captchaStore   *CaptchaStore
+	schemaRegistry *SchemaRegistry
+	permissions    *PermissionStore
+	aliasDB        DatabaseAdapter
+	aliasRegistry  *SchemaRegistry
+	diagnostics    *Diagnostics
+	errorReporter  ErrorReporter
+	tracer         *Tracer
+	corsPolicy     *CORSPolicy
+	dbHealth       *DBHealth
 }
 
 // BuildHandlerOption configures optional BuildHandler dependencies.
@@ -228,6 +426,88 @@ func WithCaptchaStore(store *CaptchaStore) BuildHandlerOption {
 	}
 }
 
+// WithSchemaSync refreshes the registry when another instance sharing the
+// database publishes a schema change.
+func WithSchemaSync(registry *SchemaRegistry) BuildHandlerOption {
+	return func(o *buildHandlerOptions) {
+		o.schemaRegistry = registry
+	}
+}
+
+// WithPermissions enforces per-collection permission rules on data routes.
+func WithPermissions(store *PermissionStore) BuildHandlerOption {
+	return func(o *buildHandlerOptions) {
+		o.permissions = store
+	}
+}
+
+// WithCollectionAliases redirects data requests for the old names of
+// renamed collections.
+func WithCollectionAliases(db DatabaseAdapter, registry *SchemaRegistry) BuildHandlerOption {
+	return func(o *buildHandlerOptions) {
+		o.aliasDB = db
+		o.aliasRegistry = registry
+	}
+}
+
+// WithDiagnostics records server error responses for /admin:diagnostics.
+func WithDiagnostics(diag *Diagnostics) BuildHandlerOption {
+	return func(o *buildHandlerOptions) {
+		o.diagnostics = diag
+	}
+}
+
+// WithErrorReporter passes panics recovered while serving requests to
+// reporter.
+func WithErrorReporter(reporter ErrorReporter) BuildHandlerOption {
+	return func(o *buildHandlerOptions) {
+		o.errorReporter = reporter
+	}
+}
+
+// WithTracer records a span for every request, and for the database
+// operations made while serving it, and exports them through tracer.
+func WithTracer(tracer *Tracer) BuildHandlerOption {
+	return func(o *buildHandlerOptions) {
+		o.tracer = tracer
+	}
+}
+
+// WithDBHealth answers requests that fail while the database does not
+// respond with 503 instead of 500.
+func WithDBHealth(health *DBHealth) BuildHandlerOption {
+	return func(o *buildHandlerOptions) {
+		o.dbHealth = health
+	}
+}
+
+// WithCORSPolicy applies policy in place of a fixed policy built from
+// cfg.CORS, so the CORS settings can be replaced while the server runs.
+func WithCORSPolicy(policy *CORSPolicy) BuildHandlerOption {
+	return func(o *buildHandlerOptions) {
+		o.corsPolicy = policy
+	}
+}
+
+// RegisterDiagnosticsRoutes adds GET /admin:diagnostics and, when
+// server.pprof is true, the admin-only /admin:pprof/ profiles to mux.
+func RegisterDiagnosticsRoutes(mux *http.ServeMux, cfg *AppConfig, db DatabaseAdapter, registry *SchemaRegistry, perms *PermissionStore, diag *Diagnostics) {
+	p := strings.TrimRight(cfg.Server.Prefix, "/")
+	rt := newRouter(mux, p)
+	adh := NewAdminDiagnosticsHandler(db, registry, perms, diag)
+	rt.Handle(http.MethodGet, "/admin:diagnostics", adh.HandleQuery)
+	if cfg.Server.Pprof {
+		rt.Handle(http.MethodGet, "/admin:pprof/", handlePprof(p))
+	}
+}
+
+// RegisterSetupRoutes registers the first-run setup routes served by setup.
+func RegisterSetupRoutes(mux *http.ServeMux, cfg *AppConfig, setup *SetupHandler) {
+	rt := newRouter(mux, strings.TrimRight(cfg.Server.Prefix, "/"))
+	rt.Handle(http.MethodGet, "/setup", setup.HandleStatus)
+	rt.Handle(http.MethodPost, "/setup", setup.HandleComplete)
+}
+
 // StartServer creates and starts the HTTP server with graceful shutdown.
 // It blocks until the server shuts down.
 func StartServer(cfg *AppConfig, logger *Logger, db ...DatabaseAdapter) error {
@@ -236,6 +516,12 @@ func StartServer(cfg *AppConfig, logger *Logger, db ...DatabaseAdapter) error {
 		adapter = db[0]
 	}
 
+	cache, err := NewCache(cfg.Cache)
+	if err != nil {
+		return fmt.Errorf("create cache: %w", err)
+	}
+	defer cache.Close()
+
 	var handlerOpts []BuildHandlerOption
 	var jtiStore *JTIRevocationStore
 	var rl *RateLimiter
@@ -244,12 +530,24 @@ func StartServer(cfg *AppConfig, logger *Logger, db ...DatabaseAdapter) error {
 		jtiStore = NewJTIRevocationStore()
 		rl = NewRateLimiter()
 		captchaStore = NewCaptchaStore()
+		captchaStore.SetCache(cache)
+		rl.SetLoginChallenge(NewCaptchaLoginChallenge(captchaStore))
 		am := NewAuthMiddleware(adapter, cfg.JWTSecret, cfg.Server.Prefix, jtiStore)
+		am.SetStaleClaims(cfg.JWTStaleClaims)
+		am.SetTokenKeys(cfg.TokenKeys())
+		am.SetLogger(logger)
 		handlerOpts = append(handlerOpts, WithAuthMiddleware(am))
 		handlerOpts = append(handlerOpts, WithRateLimiter(rl))
 		handlerOpts = append(handlerOpts, WithCaptchaStore(captchaStore))
 	}
 
+	if adapter != nil {
+		health := NewDBHealth(adapter, logger)
+		health.Start(cfg.Database.HealthInterval)
+		defer health.Close()
+		handlerOpts = append(handlerOpts, WithDBHealth(health))
+	}
+
 	var reg *SchemaRegistry
 	if adapter != nil {
 		var err error
@@ -259,7 +557,68 @@ func StartServer(cfg *AppConfig, logger *Logger, db ...DatabaseAdapter) error {
 		}
 	}
 
-	mux := NewRouterWithJTI(cfg.Server.Prefix, logger, adapter, cfg, jtiStore, rl, reg)
+	if reg != nil {
+		reg.SetLogger(logger)
+		reg.StartVersionPoll(SchemaVersionCheckSeconds * time.Second)
+		reg.Migrations().Start(ShadowBatchIntervalMs * time.Millisecond)
+		defer reg.Close()
+		handlerOpts = append(handlerOpts, WithSchemaSync(reg))
+		handlerOpts = append(handlerOpts, WithCollectionAliases(adapter, reg))
+	}
+
+	var perms *PermissionStore
+	if adapter != nil && cfg.JWTSecret != "" {
+		var err error
+		perms, err = NewPermissionStore(context.Background(), adapter)
+		if err != nil {
+			return fmt.Errorf("load permissions: %w", err)
+		}
+		handlerOpts = append(handlerOpts, WithPermissions(perms))
+	}
+
+	diag := NewDiagnostics()
+	diag.SetSLO(cfg.SLO, logger)
+	handlerOpts = append(handlerOpts, WithDiagnostics(diag))
+
+	if dsn := cfg.ErrorReporting.SentryDSN; dsn != "" {
+		reporter, err := NewSentryReporter(dsn, cfg.ErrorReporting.Environment, logger)
+		if err != nil {
+			return fmt.Errorf("create error reporter: %w", err)
+		}
+		defer reporter.Close()
+		handlerOpts = append(handlerOpts, WithErrorReporter(reporter))
+	}
+
+	if endpoint := cfg.Tracing.OTLPEndpoint; endpoint != "" {
+		tracer, err := NewTracer(endpoint, cfg.Tracing.ServiceName, logger)
+		if err != nil {
+			return fmt.Errorf("create tracer: %w", err)
+		}
+		defer tracer.Close()
+		handlerOpts = append(handlerOpts, WithTracer(tracer))
+	}
+
+	corsPolicy := NewCORSPolicy(cfg.CORS)
+	handlerOpts = append(handlerOpts, WithCORSPolicy(corsPolicy))
+	reloader := NewConfigReloader(cfg, logger, corsPolicy, rl, adapter)
+	reloader.Apply(cfg)
+
+	mux := NewRouterWithJTI(cfg.Server.Prefix, logger, adapter, cfg, jtiStore, rl, perms, reg)
+	RegisterDiagnosticsRoutes(mux, cfg, adapter, reg, perms, diag)
+	if adapter != nil {
+		setup, err := NewSetupHandler(context.Background(), adapter, logger)
+		if err != nil {
+			return fmt.Errorf("create setup handler: %w", err)
+		}
+		setup.SetPasswordPolicy(cfg.Passwords())
+		RegisterSetupRoutes(mux, cfg, setup)
+		if token := setup.Token(); token != "" {
+			// The token goes to the console only; it is never logged.
+			path := strings.TrimRight(cfg.Server.Prefix, "/") + "/setup"
+			logger.Warn("no admin user exists; first-run setup is open", "path", path)
+			fmt.Printf("moon: no admin user exists; complete setup with POST %s and setup token %s\n", path, token)
+		}
+	}
 	handler := BuildHandler(mux, cfg, logger, handlerOpts...)
 
 	addr := net.JoinHostPort(cfg.Server.Host, fmt.Sprintf("%d", cfg.Server.Port))
@@ -270,12 +629,28 @@ func StartServer(cfg *AppConfig, logger *Logger, db ...DatabaseAdapter) error {
 		WriteTimeout: 30 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
+	scheme := "http"
+	if cfg.Server.TLS.Enabled() {
+		tlsConfig, err := newTLSConfig(cfg.Server.TLS)
+		if err != nil {
+			return fmt.Errorf("configure tls: %w", err)
+		}
+		srv.TLSConfig = tlsConfig
+		scheme = "https"
+	}
 
 	errCh := make(chan error, 1)
 	go func() {
-		logger.Info("server starting", "addr", addr, "prefix", cfg.Server.Prefix)
+		logger.Info("server starting", "addr", addr, "scheme", scheme, "prefix", cfg.Server.Prefix)
 		logger.AuditEvent(AuditStartupSuccess, "addr", addr)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if srv.TLSConfig != nil {
+			// The certificates come from srv.TLSConfig.
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			errCh <- err
 		}
 		close(errCh)
@@ -283,22 +658,60 @@ func StartServer(cfg *AppConfig, logger *Logger, db ...DatabaseAdapter) error {
 
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
-
-	select {
-	case err := <-errCh:
-		return fmt.Errorf("server failed: %w", err)
-	case sig := <-sigCh:
-		logger.Info("shutdown signal received", "signal", sig.String())
-		logger.AuditEvent(AuditShutdown, "reason", sig.String())
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	defer signal.Stop(hupCh)
+
+wait:
+	for {
+		select {
+		case err := <-errCh:
+			return fmt.Errorf("server failed: %w", err)
+		case <-hupCh:
+			if cfg.Path == "" {
+				logger.Warn("SIGHUP received but the configuration was not loaded from a file; nothing to reload")
+				continue
+			}
+			logger.Info("SIGHUP received; reloading configuration", "path", cfg.Path)
+			_ = reloader.Reload() // failures are logged and leave the configuration unchanged
+		case sig := <-sigCh:
+			logger.Info("shutdown signal received", "signal", sig.String())
+			logger.AuditEvent(AuditShutdown, "reason", sig.String())
+			break wait
+		}
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Server.ShutdownTimeout)*time.Second)
 	defer cancel()
 
-	if err := srv.Shutdown(ctx); err != nil {
-		return fmt.Errorf("graceful shutdown failed: %w", err)
-	}
+	// A second signal gives up on the remaining drain time.
+	go func() {
+		select {
+		case sig := <-sigCh:
+			logger.Warn("second shutdown signal received; closing open connections", "signal", sig.String())
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
 
+	// Deferred calls stop the tracer and error reporter after the server;
+	// the caller closes the database last.
+	if err := shutdownServer(ctx, srv, logger); err != nil {
+		return err
+	}
 	logger.Info("server stopped gracefully")
 	return nil
 }
+
+// shutdownServer stops srv accepting connections and waits for in-flight
+// requests to finish until ctx is done. Connections still open then are
+// closed, cutting off their requests.
+func shutdownServer(ctx context.Context, srv *http.Server, logger *Logger) error {
+	err := srv.Shutdown(ctx)
+	if err == nil {
+		return nil
+	}
+	logger.Warn("in-flight requests did not finish in time; closing their connections", "error", err.Error())
+	srv.Close()
+	return fmt.Errorf("graceful shutdown failed: %w", err)
+}
@@ -2,9 +2,11 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"runtime"
 	"testing"
 	"time"
 )
@@ -118,6 +120,66 @@ func TestHealthEndpoint_WithPrefix(t *testing.T) {
 	}
 }
 
+func TestWellKnownFiles(t *testing.T) {
+	handler := buildTestServer(t, defaultTestConfig())
+	for _, path := range []string{"/robots.txt", "/.well-known/security.txt"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("%s: expected 404 when not configured, got %d", path, w.Code)
+		}
+	}
+
+	cfg := defaultTestConfig()
+	cfg.Server.Prefix = "/api"
+	cfg.WellKnown = WellKnownConfig{
+		RobotsTxt:   "User-agent: *\nDisallow: /\n",
+		SecurityTxt: "Contact: mailto:security@example.com\nExpires: 2030-01-01T00:00:00Z\n",
+	}
+	handler = buildTestServer(t, cfg)
+	for path, want := range map[string]string{
+		"/api/robots.txt":               cfg.WellKnown.RobotsTxt,
+		"/api/.well-known/security.txt": cfg.WellKnown.SecurityTxt,
+	} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", path, w.Code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+			t.Errorf("%s: unexpected Content-Type %q", path, ct)
+		}
+		if w.Body.String() != want {
+			t.Errorf("%s: expected %q, got %q", path, want, w.Body.String())
+		}
+	}
+}
+
+func TestVersionEndpoint(t *testing.T) {
+	reg := &SchemaRegistry{version: "01SCHEMAVERSION0000000001", publishPending: true}
+
+	w := httptest.NewRecorder()
+	handleVersion(reg)(w, httptest.NewRequest(http.MethodGet, "/version", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	data := decodeResponse(t, w)["data"].([]any)[0].(map[string]any)
+	if data["moon"] != MoonVersion || data["go"] != runtime.Version() {
+		t.Errorf("unexpected build info: %v", data)
+	}
+	if data["schema_version"] != "01SCHEMAVERSION0000000001" {
+		t.Errorf("expected schema_version from the registry, got %v", data["schema_version"])
+	}
+	if data["schema_version_pending"] != true {
+		t.Errorf("expected the pending publish to be reported, got %v", data["schema_version_pending"])
+	}
+	if _, ok := data["revision"].(string); !ok {
+		t.Errorf("expected revision to be a string, got %v", data["revision"])
+	}
+}
+
 // --- Method validation tests ---
 
 func TestMethodNotAllowed(t *testing.T) {
@@ -379,6 +441,26 @@ func TestCORS_OptionsPreflightOnRoute(t *testing.T) {
 	}
 }
 
+func TestCORS_PreflightOnActionRoute(t *testing.T) {
+	cfg := defaultTestConfig()
+	cfg.CORS.AllowedMethods = DefaultCORSAllowedMethods
+	handler := buildTestServer(t, cfg)
+
+	// No credentials: a preflight is answered before authentication.
+	req := httptest.NewRequest(http.MethodOptions, "/data/products:mutate", nil)
+	req.Header.Set("Origin", "http://example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Methods"); got != "GET, POST, OPTIONS" {
+		t.Fatalf("expected the allowed methods, got %q", got)
+	}
+}
+
 // --- Panic recovery integration ---
 
 func TestPanicRecoveryIntegration(t *testing.T) {
@@ -404,14 +486,16 @@ func TestPanicRecoveryIntegration(t *testing.T) {
 func TestWrongMethodOnRoute(t *testing.T) {
 	handler := buildTestServer(t, defaultTestConfig())
 
-	// GET on auth:session — only POST is registered, so this is 404 or 405
+	// GET on auth:session — only POST is registered
 	req := httptest.NewRequest(http.MethodGet, "/auth:session", nil)
 	w := httptest.NewRecorder()
 	handler.ServeHTTP(w, req)
 
-	// ServeMux may return 404 when pattern doesn't match method
-	if w.Code != http.StatusNotFound && w.Code != http.StatusMethodNotAllowed {
-		t.Fatalf("expected 404 or 405, got %d", w.Code)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %d", w.Code)
+	}
+	if got := w.Header().Get("Allow"); got != "POST" {
+		t.Fatalf("expected Allow: POST, got %q", got)
 	}
 }
 
@@ -534,3 +618,74 @@ func TestHandleResourceSchema_DirectValidResource(t *testing.T) {
 		t.Fatalf("expected 501, got %d", w.Code)
 	}
 }
+
+func TestShutdownServer_DrainsInFlightRequests(t *testing.T) {
+	started := make(chan struct{})
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	srv.Start()
+	defer srv.Close()
+
+	result := make(chan int, 1)
+	go func() {
+		resp, err := http.Get(srv.URL)
+		if err != nil {
+			result <- 0
+			return
+		}
+		resp.Body.Close()
+		result <- resp.StatusCode
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownServer(ctx, srv.Config, NewTestLogger(&bytes.Buffer{})); err != nil {
+		t.Fatalf("shutdownServer: %v", err)
+	}
+	if code := <-result; code != http.StatusNoContent {
+		t.Fatalf("expected the in-flight request to complete with 204, got %d", code)
+	}
+}
+
+func TestShutdownServer_ClosesConnectionsAfterTimeout(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	result := make(chan error, 1)
+	go func() {
+		resp, err := http.Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		result <- err
+	}()
+	<-started
+
+	var logs bytes.Buffer
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := shutdownServer(ctx, srv.Config, NewTestLogger(&logs)); err == nil {
+		t.Fatal("expected a shutdown error after the timeout")
+	}
+	select {
+	case err := <-result:
+		if err == nil {
+			t.Fatal("expected the cut-off request to fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection was not closed after the timeout")
+	}
+	if !bytes.Contains(logs.Bytes(), []byte("did not finish in time")) {
+		t.Errorf("expected a warning about unfinished requests, got %s", logs.String())
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// SetupHandler implements GET /setup and POST /setup, the first-run setup
+// flow. While no admin user exists, POST /setup creates the first admin
+// when it presents the one-time setup token printed at startup. Once an
+// admin exists, setup is locked and POST /setup returns 409.
+type SetupHandler struct {
+	db        DatabaseAdapter
+	logger    *Logger
+	passwords PasswordPolicy
+
+	mu    sync.Mutex
+	token string // empty once setup is complete
+}
+
+// NewSetupHandler creates a SetupHandler. If db has no admin user yet, a
+// new setup token is generated and returned by Token.
+func NewSetupHandler(ctx context.Context, db DatabaseAdapter, logger *Logger) (*SetupHandler, error) {
+	exists, err := adminExists(ctx, db)
+	if err != nil {
+		return nil, fmt.Errorf("setup: %w", err)
+	}
+	h := &SetupHandler{db: db, logger: logger, passwords: DefaultPasswordPolicy()}
+	if !exists {
+		b := make([]byte, SetupTokenBytes)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("setup: generate token: %w", err)
+		}
+		h.token = hex.EncodeToString(b)
+	}
+	return h, nil
+}
+
+// SetPasswordPolicy sets the policy the admin password must meet.
+func (h *SetupHandler) SetPasswordPolicy(policy PasswordPolicy) {
+	h.passwords = policy
+}
+
+// Token returns the setup token, or "" when setup is complete.
+func (h *SetupHandler) Token() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.token
+}
+
+// HandleStatus reports whether first-run setup is still required.
+func (h *SetupHandler) HandleStatus(w http.ResponseWriter, r *http.Request) {
+	required := h.Token() != ""
+	WriteSuccess(w, http.StatusOK, "Setup status retrieved successfully", []any{
+		map[string]any{"required": required},
+	})
+}
+
+// HandleComplete creates the first admin user and locks setup.
+func (h *SetupHandler) HandleComplete(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	if body.Data == nil {
+		WriteError(w, http.StatusBadRequest, "Missing required field: data")
+		return
+	}
+
+	// Holding the lock for the whole request means two concurrent
+	// requests cannot both create an admin.
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.token == "" {
+		WriteError(w, http.StatusConflict, "Setup has already been completed")
+		return
+	}
+
+	token, _ := body.Data["token"].(string)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+		WriteError(w, http.StatusForbidden, "Invalid setup token")
+		return
+	}
+
+	username, _ := body.Data["username"].(string)
+	email, _ := body.Data["email"].(string)
+	password, _ := body.Data["password"].(string)
+	for _, f := range []struct{ name, value string }{{"username", username}, {"email", email}, {"password", password}} {
+		if f.value == "" {
+			WriteError(w, http.StatusBadRequest, fmt.Sprintf("Field '%s' is required", f.name))
+			return
+		}
+	}
+	if !isValidEmail(email) {
+		WriteError(w, http.StatusBadRequest, "Invalid email address")
+		return
+	}
+	if err := h.passwords.Validate(password); err != nil {
+		WriteError(w, http.StatusBadRequest, passwordPolicyViolation(err))
+		return
+	}
+
+	// An admin created some other way, such as by the bootstrap fields of
+	// another instance sharing the database, also locks setup.
+	ctx := r.Context()
+	exists, err := adminExists(ctx, h.db)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if exists {
+		h.token = ""
+		WriteError(w, http.StatusConflict, "Setup has already been completed")
+		return
+	}
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	row := newUserRow(username, email, "admin", true, hash)
+	if err := h.db.InsertRow(ctx, "users", row); err != nil {
+		writeDBError(w, err)
+		return
+	}
+	h.token = ""
+
+	if h.logger != nil {
+		h.logger.AuditEventContext(ctx, AuditAdminUserManagement,
+			"action", "setup.complete",
+			"actor", row["id"],
+			"target", row["username"],
+		)
+	}
+	WriteSuccess(w, http.StatusCreated, "Setup completed successfully", []any{buildUserResponse(row)})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func doSetupRequest(t *testing.T, h *SetupHandler, data map[string]any) *httptest.ResponseRecorder {
+	t.Helper()
+	b, err := json.Marshal(map[string]any{"data": data})
+	if err != nil {
+		t.Fatalf("marshal body: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/setup", bytes.NewReader(b))
+	w := httptest.NewRecorder()
+	h.HandleComplete(w, req)
+	return w
+}
+
+func setupStatus(t *testing.T, h *SetupHandler) bool {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.HandleStatus(w, httptest.NewRequest(http.MethodGet, "/setup", nil))
+	return decodeResponse(t, w)["data"].([]any)[0].(map[string]any)["required"].(bool)
+}
+
+func TestSetup_CreatesFirstAdminAndLocks(t *testing.T) {
+	_, adapter, _ := setupMutateTest(t)
+	h, err := NewSetupHandler(context.Background(), adapter, nil)
+	if err != nil {
+		t.Fatalf("NewSetupHandler: %v", err)
+	}
+	token := h.Token()
+	if len(token) != 2*SetupTokenBytes || !setupStatus(t, h) {
+		t.Fatalf("expected pending setup with a token, got %q", token)
+	}
+
+	admin := map[string]any{"token": token, "username": "Root", "email": "root@example.com", "password": "Str0ngPassword"}
+	for name, tc := range map[string]struct {
+		field string
+		value any
+		code  int
+	}{
+		"wrong token":    {"token", "nope", http.StatusForbidden},
+		"missing email":  {"email", "", http.StatusBadRequest},
+		"weak password":  {"password", "short", http.StatusBadRequest},
+		"invalid email":  {"email", "root", http.StatusBadRequest},
+		"missing fields": {"username", nil, http.StatusBadRequest},
+	} {
+		data := map[string]any{}
+		for k, v := range admin {
+			data[k] = v
+		}
+		data[tc.field] = tc.value
+		if w := doSetupRequest(t, h, data); w.Code != tc.code {
+			t.Fatalf("%s: expected %d, got %d: %s", name, tc.code, w.Code, w.Body.String())
+		}
+	}
+
+	w := doSetupRequest(t, h, admin)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	user := decodeResponse(t, w)["data"].([]any)[0].(map[string]any)
+	if user["username"] != "root" || user["role"] != "admin" || user["can_write"] != true {
+		t.Fatalf("unexpected admin %v", user)
+	}
+	if _, ok := user["password_hash"]; ok {
+		t.Fatal("password_hash must not be returned")
+	}
+
+	if w := doSetupRequest(t, h, admin); w.Code != http.StatusConflict {
+		t.Fatalf("second setup: expected 409, got %d", w.Code)
+	}
+	if setupStatus(t, h) {
+		t.Fatal("expected setup to be locked")
+	}
+
+	// A restarted server finds the admin and stays locked.
+	h, err = NewSetupHandler(context.Background(), adapter, nil)
+	if err != nil {
+		t.Fatalf("NewSetupHandler: %v", err)
+	}
+	if h.Token() != "" {
+		t.Fatal("expected no setup token once an admin exists")
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Shadow migration states reported by GET /collections:migrations.
+const (
+	ShadowMigrationBackfilling = "backfilling"
+	ShadowMigrationSwapping    = "swapping"
+	ShadowMigrationDone        = "done"
+	ShadowMigrationFailed      = "failed"
+)
+
+// errMigrationInProgress is returned when a collection already has a
+// shadow migration running.
+var errMigrationInProgress = errors.New("collection has a schema migration in progress")
+
+// errMigratorClosed fails the migrations still running when the
+// migrator is closed.
+var errMigratorClosed = errors.New("server shut down before the migration finished")
+
+// ShadowMigration reports the progress of one shadow-table rebuild.
+// RowsTotal is the row count when the migration started; rows written
+// during the copy are tracked separately and copied at the swap.
+type ShadowMigration struct {
+	ID         string `json:"id"`
+	Collection string `json:"collection"`
+	State      string `json:"state"`
+	RowsCopied int    `json:"rows_copied"`
+	RowsTotal  int    `json:"rows_total"`
+	StartedAt  string `json:"started_at"`
+	FinishedAt string `json:"finished_at,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// shadowJob is a migration and the state the scheduler needs to resume it.
+type shadowJob struct {
+	info      ShadowMigration
+	shadow    ShadowTable
+	rb        ShadowRebuilder
+	last      string // id of the last row copied
+	scheduled bool   // copied by the scheduler rather than by Run
+}
+
+// ShadowMigrator is the migration engine for column modifications. Each
+// migration creates the new table shape under a private name, records
+// the ids of rows written to the collection from then on, copies the
+// collection into it ShadowTableBatchSize rows at a time, and finally
+// has the adapter copy the recorded rows again and swap the tables.
+// Scheduled migrations are copied one batch per tick of the scheduler
+// started by Start, so the collection stays writable throughout.
+type ShadowMigrator struct {
+	db       DatabaseAdapter
+	registry *SchemaRegistry
+
+	mu     sync.Mutex
+	jobs   []*shadowJob          // in start order; finished ones are trimmed
+	active map[string]*shadowJob // by collection
+
+	running  atomic.Bool
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+
+	// batchDone, when set, is called after each batch is copied. Tests
+	// use it to write to the collection mid-copy.
+	batchDone func()
+}
+
+// NewShadowMigrator creates a ShadowMigrator for the collections of
+// registry. Until Start is called, only Run makes progress.
+func NewShadowMigrator(db DatabaseAdapter, registry *SchemaRegistry) *ShadowMigrator {
+	return &ShadowMigrator{
+		db:       db,
+		registry: registry,
+		active:   make(map[string]*shadowJob),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start runs the scheduler, which copies the next batch of every
+// scheduled migration each interval, until Close.
+func (m *ShadowMigrator) Start(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	m.running.Store(true)
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+				m.tick(context.Background())
+			}
+		}
+	}()
+}
+
+// Close stops the scheduler and discards the scheduled migrations it had
+// not finished, leaving their collections unchanged.
+func (m *ShadowMigrator) Close() {
+	m.stopOnce.Do(func() { close(m.stop) })
+	m.wg.Wait()
+	m.running.Store(false)
+	for _, job := range m.pending() {
+		m.finish(context.Background(), job, errMigratorClosed)
+	}
+}
+
+// Running reports whether the scheduler is running, so that Schedule
+// will make progress.
+func (m *ShadowMigrator) Running() bool {
+	return m.running.Load()
+}
+
+// Run carries out the migration of s in the calling goroutine and
+// returns once the shadow table has replaced s.Table or been discarded.
+func (m *ShadowMigrator) Run(ctx context.Context, s ShadowTable, createDDL string) (ShadowMigration, error) {
+	job, err := m.begin(ctx, s, createDDL, false)
+	if err != nil {
+		return ShadowMigration{}, err
+	}
+	for {
+		done, err := m.step(ctx, job)
+		if err != nil || done {
+			m.finish(ctx, job, err)
+			return m.snapshot(job), err
+		}
+	}
+}
+
+// Schedule prepares the migration of s and leaves the copy and the swap
+// to the scheduler. Writes to s.Table are tracked once it returns.
+func (m *ShadowMigrator) Schedule(ctx context.Context, s ShadowTable, createDDL string) (ShadowMigration, error) {
+	job, err := m.begin(ctx, s, createDDL, true)
+	if err != nil {
+		return ShadowMigration{}, err
+	}
+	return m.snapshot(job), nil
+}
+
+// Active returns the migration in progress for collection, if any.
+func (m *ShadowMigrator) Active(collection string) (ShadowMigration, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.active[collection]
+	if !ok {
+		return ShadowMigration{}, false
+	}
+	return job.info, true
+}
+
+// List returns the migrations in progress and the last
+// ShadowMigrationHistory finished ones, oldest first.
+func (m *ShadowMigrator) List() []ShadowMigration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := make([]ShadowMigration, len(m.jobs))
+	for i, job := range m.jobs {
+		list[i] = job.info
+	}
+	return list
+}
+
+// begin creates the shadow table of s and starts tracking writes to
+// s.Table. On failure nothing is left behind.
+func (m *ShadowMigrator) begin(ctx context.Context, s ShadowTable, createDDL string, scheduled bool) (*shadowJob, error) {
+	rb, ok := m.db.(ShadowRebuilder)
+	if !ok {
+		return nil, errShadowUnsupported
+	}
+	job := &shadowJob{
+		info: ShadowMigration{
+			ID:         GenerateULID(),
+			Collection: s.Table,
+			State:      ShadowMigrationBackfilling,
+			StartedAt:  time.Now().UTC().Format(time.RFC3339),
+		},
+		shadow:    s,
+		rb:        rb,
+		scheduled: scheduled,
+	}
+
+	m.mu.Lock()
+	if _, busy := m.active[s.Table]; busy {
+		m.mu.Unlock()
+		return nil, errMigrationInProgress
+	}
+	m.active[s.Table] = job
+	m.mu.Unlock()
+
+	total, err := m.db.CountRows(ctx, s.Table)
+	if err == nil {
+		m.mu.Lock()
+		job.info.RowsTotal = total
+		m.mu.Unlock()
+		err = m.db.ExecDDL(ctx, createDDL)
+	}
+	if err == nil {
+		err = rb.TrackShadowChanges(ctx, s)
+	}
+	if err != nil {
+		rb.DropShadowTable(ctx, s)
+		m.mu.Lock()
+		delete(m.active, s.Table)
+		m.mu.Unlock()
+		return nil, err
+	}
+
+	m.mu.Lock()
+	m.jobs = append(m.jobs, job)
+	m.mu.Unlock()
+	m.logInfo("shadow migration started", job)
+	return job, nil
+}
+
+// step copies the next batch of job, or swaps the shadow table in once
+// the copy is complete. It reports whether job is done.
+func (m *ShadowMigrator) step(ctx context.Context, job *shadowJob) (bool, error) {
+	last, n, err := job.rb.CopyShadowBatch(ctx, job.shadow, job.last, ShadowTableBatchSize)
+	if err != nil {
+		return false, err
+	}
+	if n > 0 {
+		m.mu.Lock()
+		job.last = last
+		job.info.RowsCopied += n
+		m.mu.Unlock()
+		if m.batchDone != nil {
+			m.batchDone()
+		}
+		return false, nil
+	}
+
+	m.mu.Lock()
+	job.info.State = ShadowMigrationSwapping
+	m.mu.Unlock()
+	var indexes []IndexInfo
+	if col, ok := m.registry.Get(job.shadow.Table); ok {
+		indexes = col.Indexes
+	}
+	return true, job.rb.SwapShadowTable(ctx, job.shadow, indexes)
+}
+
+// tick advances every scheduled migration by one step.
+func (m *ShadowMigrator) tick(ctx context.Context) {
+	for _, job := range m.pending() {
+		done, err := m.step(ctx, job)
+		if err != nil || done {
+			m.finish(ctx, job, err)
+		}
+	}
+}
+
+// pending returns the scheduled migrations in progress.
+func (m *ShadowMigrator) pending() []*shadowJob {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var jobs []*shadowJob
+	for _, job := range m.jobs {
+		if job.scheduled && m.active[job.info.Collection] == job {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+// finish records the outcome of job. A failed migration has its shadow
+// table discarded; a successful one has changed the collection, so the
+// registry is refreshed and the change announced.
+func (m *ShadowMigrator) finish(ctx context.Context, job *shadowJob, err error) {
+	if err != nil {
+		job.rb.DropShadowTable(ctx, job.shadow)
+	} else {
+		if rerr := m.registry.Refresh(); rerr != nil {
+			err = fmt.Errorf("refresh schema registry: %w", rerr)
+		}
+		m.registry.AnnounceChange(ctx)
+	}
+
+	m.mu.Lock()
+	job.info.FinishedAt = time.Now().UTC().Format(time.RFC3339)
+	job.info.State = ShadowMigrationDone
+	if err != nil {
+		job.info.State = ShadowMigrationFailed
+		job.info.Error = err.Error()
+	}
+	delete(m.active, job.info.Collection)
+	m.trimLocked()
+	m.mu.Unlock()
+
+	if err != nil {
+		if logger := m.registry.logger; logger != nil {
+			logger.ErrorContext(ctx, "shadow migration failed", "id", job.info.ID, "collection", job.info.Collection, "error", err)
+		}
+		return
+	}
+	m.logInfo("shadow migration finished", job)
+}
+
+// trimLocked drops the oldest finished migrations beyond
+// ShadowMigrationHistory. m.mu must be held.
+func (m *ShadowMigrator) trimLocked() {
+	finished := 0
+	for _, job := range m.jobs {
+		if m.active[job.info.Collection] != job {
+			finished++
+		}
+	}
+	kept := m.jobs[:0]
+	for _, job := range m.jobs {
+		if finished > ShadowMigrationHistory && m.active[job.info.Collection] != job {
+			finished--
+			continue
+		}
+		kept = append(kept, job)
+	}
+	clear(m.jobs[len(kept):])
+	m.jobs = kept
+}
+
+// snapshot returns a copy of the progress of job.
+func (m *ShadowMigrator) snapshot(job *shadowJob) ShadowMigration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return job.info
+}
+
+// logInfo logs msg with the progress of job.
+func (m *ShadowMigrator) logInfo(msg string, job *shadowJob) {
+	logger := m.registry.logger
+	if logger == nil {
+		return
+	}
+	info := m.snapshot(job)
+	logger.Info(msg, "id", info.ID, "collection", info.Collection, "rows_copied", info.RowsCopied, "rows_total", info.RowsTotal)
+}
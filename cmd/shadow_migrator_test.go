@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// seedPricedProducts creates a products collection holding rows rows.
+func seedPricedProducts(t *testing.T, adapter *SQLiteAdapter, registry *SchemaRegistry, rows int) {
+	t.Helper()
+	ctx := context.Background()
+	if err := adapter.ExecDDL(ctx, `CREATE TABLE products (id TEXT PRIMARY KEY, price TEXT NOT NULL)`); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	seed := fmt.Sprintf(`WITH RECURSIVE seq(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM seq WHERE n < %d)
+		INSERT INTO products (id, price) SELECT printf('p%%06d', n), n || '.50' FROM seq`, rows)
+	if err := adapter.ExecDDL(ctx, seed); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	if err := registry.Refresh(); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+}
+
+func collectionRequest(t *testing.T, handler http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+adminToken(t, collectionTestSecret))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestShadowMigrator_ScheduledMigrationReportsProgress(t *testing.T) {
+	handler, adapter, registry := buildAuthenticatedCollectionHandler(t)
+	rowCount := ShadowTableBatchSize*2 + 7
+	seedPricedProducts(t, adapter, registry, rowCount)
+
+	// Hold the scheduler after the first batch.
+	migrations := registry.Migrations()
+	release := make(chan struct{})
+	var once sync.Once
+	migrations.batchDone = func() { once.Do(func() { <-release }) }
+	migrations.Start(time.Millisecond)
+	t.Cleanup(registry.Close)
+
+	w := collectionRequest(t, handler, http.MethodPost, "/collections:mutate",
+		`{"op":"update","data":[{"name":"products","modify_columns":[{"name":"price","type":"decimal"}]}]}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var accepted struct {
+		Data []struct {
+			Migration ShadowMigration `json:"migration"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &accepted); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(accepted.Data) != 1 || accepted.Data[0].Migration.State != ShadowMigrationBackfilling ||
+		accepted.Data[0].Migration.RowsTotal != rowCount {
+		t.Fatalf("accepted = %s", w.Body.String())
+	}
+
+	// Other schema changes wait for the swap; row writes do not.
+	w = collectionRequest(t, handler, http.MethodPost, "/collections:mutate",
+		`{"op":"update","data":[{"name":"products","add_columns":[{"name":"label","type":"string","nullable":true}]}]}`)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected 409 during migration, got %d: %s", w.Code, w.Body.String())
+	}
+	if err := adapter.InsertRow(context.Background(), "products", map[string]any{"id": "a-new", "price": "1.25"}); err != nil {
+		t.Fatalf("insert during migration: %v", err)
+	}
+
+	w = collectionRequest(t, handler, http.MethodGet, "/collections:migrations?name=products", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"state":"backfilling"`) {
+		t.Fatalf("progress = %d: %s", w.Code, w.Body.String())
+	}
+
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := migrations.Active("products"); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("migration did not finish")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// a-new is copied by a batch only when it was inserted before the first.
+	list := migrations.List()
+	if len(list) != 1 || list[0].State != ShadowMigrationDone || list[0].RowsCopied < rowCount || list[0].FinishedAt == "" {
+		t.Fatalf("migrations = %+v", list)
+	}
+	col, _ := registry.Get("products")
+	for _, f := range col.Fields {
+		if f.Name == "price" && f.Type != MoonFieldTypeDecimal {
+			t.Errorf("price type = %s after swap", f.Type)
+		}
+	}
+	if count, _ := adapter.CountRows(context.Background(), "products"); count != rowCount+1 {
+		t.Errorf("expected %d rows after swap, got %d", rowCount+1, count)
+	}
+}
+
+func TestShadowMigrator_CloseDiscardsUnfinished(t *testing.T) {
+	adapter, registry, _, _ := setupCollectionTest(t)
+	seedPricedProducts(t, adapter, registry, 10)
+	ctx := context.Background()
+
+	migrations := registry.Migrations()
+	col, _ := registry.Get("products")
+	shadow, createDDL := shadowTableFor("products", col, []collectionColumn{{Name: "price", Type: MoonFieldTypeDecimal}})
+	if _, err := migrations.Schedule(ctx, shadow, createDDL); err != nil {
+		t.Fatalf("Schedule: %v", err)
+	}
+	if _, err := migrations.Run(ctx, shadow, createDDL); err != errMigrationInProgress {
+		t.Fatalf("second migration: %v, want errMigrationInProgress", err)
+	}
+
+	registry.Close()
+
+	list := migrations.List()
+	if len(list) != 1 || list[0].State != ShadowMigrationFailed || list[0].Error == "" {
+		t.Fatalf("migrations = %+v", list)
+	}
+	tables, err := adapter.ListTables(ctx)
+	if err != nil {
+		t.Fatalf("ListTables: %v", err)
+	}
+	for _, tbl := range tables {
+		if strings.HasPrefix(tbl, ShadowTablePrefix) {
+			t.Errorf("table %q left behind", tbl)
+		}
+	}
+	// Writes would fail if a trigger still referred to the dropped log.
+	if err := adapter.InsertRow(ctx, "products", map[string]any{"id": "z", "price": "1.50"}); err != nil {
+		t.Errorf("insert after discard: %v", err)
+	}
+	col, _ = registry.Get("products")
+	for _, f := range col.Fields {
+		if f.Name == "price" && f.Type != MoonFieldTypeString {
+			t.Errorf("price type = %s, want unchanged", f.Type)
+		}
+	}
+}
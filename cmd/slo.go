@@ -0,0 +1,186 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ---------------------------------------------------------------------------
+// Response-time SLOs
+//
+// Requests to routes matching an slo.targets pattern are timed and counted
+// per pattern. /admin:diagnostics reports latency percentiles and the
+// error-budget burn rate, and a target whose burn rate gets too high is
+// logged once as an slo.at_risk audit event. There is no background
+// evaluation: state changes only when a matching request completes.
+// ---------------------------------------------------------------------------
+
+// sloTracker tracks response times against the slo.targets of one instance.
+type sloTracker struct {
+	objective float64
+	targets   map[string]int
+	logger    *Logger
+
+	mu     sync.Mutex
+	routes map[string]*sloRoute
+}
+
+// sloRoute is the state of one slo.targets pattern.
+type sloRoute struct {
+	latencies []float64 // ring buffer of SLOLatencySamples, in milliseconds
+	next      int
+	minutes   [SLOWindowMinutes]sloMinute
+	atRisk    bool
+}
+
+// sloMinute counts the requests completed in one minute.
+type sloMinute struct {
+	minute int64 // Unix time in minutes
+	total  int64
+	good   int64 // requests that met the target
+}
+
+// sloTargetReport is the /admin:diagnostics view of one target.
+type sloTargetReport struct {
+	Route        string   `json:"route"`
+	TargetMS     int      `json:"target_ms"`
+	Requests     int64    `json:"requests"`
+	WithinTarget int64    `json:"within_target"`
+	P50MS        *float64 `json:"p50_ms"`
+	P95MS        *float64 `json:"p95_ms"`
+	P99MS        *float64 `json:"p99_ms"`
+	BurnRate     float64  `json:"burn_rate"`
+	AtRisk       bool     `json:"at_risk"`
+}
+
+// newSLOTracker creates a tracker for cfg, or returns nil when cfg has no
+// targets.
+func newSLOTracker(cfg SLOConfig, logger *Logger) *sloTracker {
+	if len(cfg.Targets) == 0 {
+		return nil
+	}
+	return &sloTracker{
+		objective: cfg.Objective,
+		targets:   cfg.Targets,
+		logger:    logger,
+		routes:    make(map[string]*sloRoute),
+	}
+}
+
+// burnRate is how fast the error budget is being spent: the share of
+// requests that missed the target divided by the share the objective
+// allows. A burn rate of 1 spends the budget exactly.
+func (t *sloTracker) burnRate(total, good int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(total-good) / float64(total) / (1 - t.objective)
+}
+
+// window sums the per-minute counts of route within SLOWindowMinutes of
+// minute.
+func (route *sloRoute) window(minute int64) (total, good int64) {
+	for _, m := range route.minutes {
+		if m.minute > minute-SLOWindowMinutes {
+			total += m.total
+			good += m.good
+		}
+	}
+	return total, good
+}
+
+// record adds one request to the target matching route, if any, and
+// reports the target as at risk when its burn rate crosses
+// SLOAlertBurnRate.
+func (t *sloTracker) record(route string, elapsed time.Duration, now time.Time) {
+	pattern, targetMS := matchRoutePattern(t.targets, route)
+	if pattern == "" {
+		return
+	}
+	ms := float64(elapsed) / float64(time.Millisecond)
+	minute := now.Unix() / 60
+
+	t.mu.Lock()
+	state := t.routes[pattern]
+	if state == nil {
+		state = &sloRoute{}
+		t.routes[pattern] = state
+	}
+	if len(state.latencies) < SLOLatencySamples {
+		state.latencies = append(state.latencies, ms)
+	} else {
+		state.latencies[state.next] = ms
+		state.next = (state.next + 1) % SLOLatencySamples
+	}
+	m := &state.minutes[minute%SLOWindowMinutes]
+	if m.minute != minute {
+		*m = sloMinute{minute: minute}
+	}
+	m.total++
+	if ms <= float64(targetMS) {
+		m.good++
+	}
+	total, good := state.window(minute)
+	burn := t.burnRate(total, good)
+	wasAtRisk := state.atRisk
+	state.atRisk = total >= SLOMinRequests && burn >= SLOAlertBurnRate
+	alert := state.atRisk && !wasAtRisk
+	t.mu.Unlock()
+
+	if alert && t.logger != nil {
+		t.logger.AuditEvent(AuditSLOAtRisk,
+			"route", pattern,
+			"target_ms", targetMS,
+			"objective", t.objective,
+			"burn_rate", burn,
+			"requests", total,
+		)
+	}
+}
+
+// report returns every target, ordered by pattern, with its state at now.
+func (t *sloTracker) report(now time.Time) []sloTargetReport {
+	minute := now.Unix() / 60
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	out := make([]sloTargetReport, 0, len(t.targets))
+	for pattern, targetMS := range t.targets {
+		r := sloTargetReport{Route: pattern, TargetMS: targetMS}
+		if state := t.routes[pattern]; state != nil {
+			r.Requests, r.WithinTarget = state.window(minute)
+			r.BurnRate = math.Round(t.burnRate(r.Requests, r.WithinTarget)*1000) / 1000
+			r.AtRisk = r.Requests >= SLOMinRequests && r.BurnRate >= SLOAlertBurnRate
+			sorted := append([]float64(nil), state.latencies...)
+			sort.Float64s(sorted)
+			r.P50MS, r.P95MS, r.P99MS = percentile(sorted, 0.50), percentile(sorted, 0.95), percentile(sorted, 0.99)
+		}
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Route < out[j].Route })
+	return out
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted values,
+// rounded to hundredths of a millisecond, or nil when there are none.
+func percentile(sorted []float64, p float64) *float64 {
+	if len(sorted) == 0 {
+		return nil
+	}
+	i := max(int(math.Ceil(p*float64(len(sorted))))-1, 0)
+	v := math.Round(sorted[i]*100) / 100
+	return &v
+}
+
+// sloMiddleware times every request and records it against the matching
+// slo.targets pattern.
+func sloMiddleware(t *sloTracker, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		t.record(routeName(r.URL.Path), time.Since(start), time.Now())
+	})
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSLOTracker_BurnRateAndAlert(t *testing.T) {
+	var buf bytes.Buffer
+	tracker := newSLOTracker(SLOConfig{
+		Objective: 0.9,
+		Targets:   map[string]int{"*:query": 100, "orders:mutate": 50},
+	}, NewTestLogger(&buf))
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	// 18 fast and 2 slow reads: 10% misses against a 10% budget.
+	for i := range 20 {
+		elapsed := 10 * time.Millisecond
+		if i < 2 {
+			elapsed = 300 * time.Millisecond
+		}
+		tracker.record("products:query", elapsed, now)
+	}
+	tracker.record("health", time.Second, now) // no action, not tracked
+
+	report := tracker.report(now)
+	if len(report) != 2 || report[0].Route != "*:query" || report[1].Route != "orders:mutate" {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	q := report[0]
+	if q.Requests != 20 || q.WithinTarget != 18 || q.BurnRate != 1 || q.AtRisk {
+		t.Errorf("unexpected *:query report: %+v", q)
+	}
+	if *q.P50MS != 10 || *q.P99MS != 300 {
+		t.Errorf("unexpected percentiles: p50 %v, p99 %v", *q.P50MS, *q.P99MS)
+	}
+	if m := report[1]; m.Requests != 0 || m.P50MS != nil {
+		t.Errorf("expected an empty orders:mutate report, got %+v", m)
+	}
+	if strings.Contains(buf.String(), AuditSLOAtRisk) {
+		t.Fatalf("did not expect an alert at burn rate 1: %s", buf.String())
+	}
+
+	// Three more slow reads push the burn rate over SLOAlertBurnRate; the
+	// alert is logged once.
+	for range 3 {
+		tracker.record("orders:query", 300*time.Millisecond, now)
+	}
+	if n := strings.Count(buf.String(), AuditSLOAtRisk); n != 1 {
+		t.Fatalf("expected one %s event, got %d: %s", AuditSLOAtRisk, n, buf.String())
+	}
+	if !tracker.report(now)[0].AtRisk {
+		t.Error("expected *:query to be at risk")
+	}
+
+	// Requests older than the window no longer count.
+	later := now.Add(SLOWindowMinutes * time.Minute)
+	tracker.record("products:query", 10*time.Millisecond, later)
+	if q := tracker.report(later)[0]; q.Requests != 1 || q.AtRisk {
+		t.Errorf("expected the window to have moved on, got %+v", q)
+	}
+}
+
+func TestSLOMiddleware(t *testing.T) {
+	tracker := newSLOTracker(SLOConfig{Objective: 0.99, Targets: map[string]int{"*:query": 1000}}, nil)
+	handler := sloMiddleware(tracker, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	for _, target := range []string{"/data/products:query", "/data/products:mutate", "/health"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+	if r := tracker.report(time.Now())[0]; r.Requests != 1 || r.WithinTarget != 1 {
+		t.Errorf("expected one request within target, got %+v", r)
+	}
+	if newSLOTracker(SLOConfig{Objective: 0.99}, nil) != nil {
+		t.Error("expected no tracker without targets")
+	}
+}
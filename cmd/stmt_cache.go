@@ -0,0 +1,208 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// ---------------------------------------------------------------------------
+// Prepared statement cache
+//
+// The data path builds the same INSERT, UPDATE, DELETE, and SELECT text
+// for every request with the same shape. stmtCache prepares each text once
+// and reuses the statement, so the database does not parse it again, and
+// MySQL does not prepare and close it around every call. database/sql
+// prepares a cached statement again on each pooled connection that runs it.
+// ---------------------------------------------------------------------------
+
+// stmtCache holds up to StmtCacheSize prepared statements of one *sql.DB,
+// keyed by SQL text, and closes the least recently used when full.
+type stmtCache struct {
+	db      *sql.DB
+	size    int
+	counter cacheCounter
+
+	mu    sync.Mutex
+	stmts map[string]*list.Element // of *cachedStmt
+	order *list.List               // most recently used first
+}
+
+// cachedStmt is a cached statement. It is closed once it has left the
+// cache and no caller holds it.
+type cachedStmt struct {
+	query   string
+	stmt    *sql.Stmt
+	refs    int
+	dropped bool
+}
+
+// newStmtCache creates an empty cache of statements prepared on db.
+func newStmtCache(db *sql.DB, size int) *stmtCache {
+	return &stmtCache{db: db, size: size, stmts: make(map[string]*list.Element), order: list.New()}
+}
+
+// acquire returns the statement for query, preparing it on a miss. The
+// caller must release it.
+func (c *stmtCache) acquire(ctx context.Context, query string) (*cachedStmt, error) {
+	c.mu.Lock()
+	if el, ok := c.stmts[query]; ok {
+		cs := el.Value.(*cachedStmt)
+		cs.refs++
+		c.order.MoveToFront(el)
+		c.mu.Unlock()
+		c.counter.record(true)
+		return cs, nil
+	}
+	c.mu.Unlock()
+	c.counter.record(false)
+
+	stmt, err := c.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.stmts[query]; ok {
+		// Another caller prepared the same text meanwhile.
+		stmt.Close()
+		cs := el.Value.(*cachedStmt)
+		cs.refs++
+		return cs, nil
+	}
+	cs := &cachedStmt{query: query, stmt: stmt, refs: 1}
+	c.stmts[query] = c.order.PushFront(cs)
+	for c.order.Len() > c.size {
+		c.dropLocked(c.order.Back())
+	}
+	return cs, nil
+}
+
+// release gives back a statement from acquire.
+func (c *stmtCache) release(cs *cachedStmt) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cs.refs--
+	if cs.dropped && cs.refs == 0 {
+		cs.stmt.Close()
+	}
+}
+
+// reset empties the cache. It is called after a schema change, which can
+// leave a prepared statement naming a column that no longer exists.
+func (c *stmtCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.order.Len() > 0 {
+		c.dropLocked(c.order.Back())
+	}
+}
+
+// dropLocked removes el from the cache, closing its statement unless a
+// caller still holds it. c.mu must be held.
+func (c *stmtCache) dropLocked(el *list.Element) {
+	cs := c.order.Remove(el).(*cachedStmt)
+	delete(c.stmts, cs.query)
+	cs.dropped = true
+	if cs.refs == 0 {
+		cs.stmt.Close()
+	}
+}
+
+// len returns the number of cached statements.
+func (c *stmtCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// stats reports the hits, misses, and size of the cache for
+// /admin:diagnostics.
+func (c *stmtCache) stats() map[string]any {
+	stats := c.counter.stats()
+	stats["size"] = c.len()
+	return stats
+}
+
+// exec runs query through its cached statement, inside tx when tx is not
+// nil.
+func (c *stmtCache) exec(ctx context.Context, tx *sql.Tx, query string, args ...any) (sql.Result, error) {
+	cs, err := c.acquire(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer c.release(cs)
+	if tx != nil {
+		return tx.StmtContext(ctx, cs.stmt).ExecContext(ctx, args...)
+	}
+	return cs.stmt.ExecContext(ctx, args...)
+}
+
+// query runs query through its cached statement, inside tx when tx is not
+// nil. The rows stay valid after the statement leaves the cache.
+func (c *stmtCache) query(ctx context.Context, tx *sql.Tx, query string, args ...any) (*sql.Rows, error) {
+	cs, err := c.acquire(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer c.release(cs)
+	if tx != nil {
+		return tx.StmtContext(ctx, cs.stmt).QueryContext(ctx, args...)
+	}
+	return cs.stmt.QueryContext(ctx, args...)
+}
+
+// scanRow runs query through its cached statement and scans its single
+// row into dest, inside tx when tx is not nil.
+func (c *stmtCache) scanRow(ctx context.Context, tx *sql.Tx, query string, args []any, dest ...any) error {
+	cs, err := c.acquire(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer c.release(cs)
+	stmt := cs.stmt
+	if tx != nil {
+		stmt = tx.StmtContext(ctx, stmt)
+	}
+	return stmt.QueryRowContext(ctx, args...).Scan(dest...)
+}
+
+// txStmts reuses statements for the writes of one transaction, so a batch
+// binds each distinct statement to the transaction once.
+type txStmts struct {
+	cache *stmtCache
+	tx    *sql.Tx
+	stmts map[string]*sql.Stmt
+	held  []*cachedStmt
+}
+
+// inTx returns a txStmts for tx. The caller must close it once the
+// transaction ends.
+func (c *stmtCache) inTx(tx *sql.Tx) *txStmts {
+	return &txStmts{cache: c, tx: tx, stmts: make(map[string]*sql.Stmt)}
+}
+
+// exec runs query inside the transaction.
+func (t *txStmts) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	stmt, ok := t.stmts[query]
+	if !ok {
+		cs, err := t.cache.acquire(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		t.held = append(t.held, cs)
+		stmt = t.tx.StmtContext(ctx, cs.stmt)
+		t.stmts[query] = stmt
+	}
+	return stmt.ExecContext(ctx, args...)
+}
+
+// close releases the statements used by the transaction.
+func (t *txStmts) close() {
+	for _, cs := range t.held {
+		t.cache.release(cs)
+	}
+	t.held = nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestSQLiteInsertStatement_StableColumnOrder(t *testing.T) {
+	data := map[string]any{"name": "a", "id": "1", "quantity": int64(2), "active": int64(1)}
+	want, wantValues := sqliteInsertStatement("items", data)
+	for range 20 {
+		got, values := sqliteInsertStatement("items", data)
+		if got != want {
+			t.Fatalf("query = %q, want %q", got, want)
+		}
+		if fmt.Sprint(values) != fmt.Sprint(wantValues) {
+			t.Fatalf("values = %v, want %v", values, wantValues)
+		}
+	}
+	if want != `INSERT INTO "items" ("active", "id", "name", "quantity") VALUES (?, ?, ?, ?)` {
+		t.Errorf("query = %q", want)
+	}
+}
+
+func TestStmtCache_ReusesStatements(t *testing.T) {
+	adapter := testSQLiteAdapter(t)
+	seedTestTable(t, adapter)
+	ctx := context.Background()
+
+	before := adapter.stmts.counter.stats()["misses"].(int64)
+	for i := range 5 {
+		if err := adapter.UpdateRow(ctx, "items", "001", map[string]any{"quantity": int64(i)}); err != nil {
+			t.Fatalf("UpdateRow: %v", err)
+		}
+	}
+	stats := adapter.StatementCacheStats()
+	if got := stats["misses"].(int64) - before; got != 1 {
+		t.Errorf("misses = %d, want 1", got)
+	}
+	if stats["hits"].(int64) < 4 {
+		t.Errorf("hits = %v, want at least 4", stats["hits"])
+	}
+
+	rows, _, err := adapter.QueryRows(ctx, "items", QueryOptions{Filters: []Filter{{Field: "id", Op: "eq", Value: "001"}}})
+	if err != nil {
+		t.Fatalf("QueryRows: %v", err)
+	}
+	if len(rows) != 1 || fmt.Sprint(rows[0]["quantity"]) != "4" {
+		t.Errorf("rows = %v", rows)
+	}
+}
+
+func TestStmtCache_ResetOnSchemaChange(t *testing.T) {
+	adapter := testSQLiteAdapter(t)
+	seedTestTable(t, adapter)
+	ctx := context.Background()
+
+	if _, _, err := adapter.QueryRows(ctx, "items", QueryOptions{}); err != nil {
+		t.Fatalf("QueryRows: %v", err)
+	}
+	if adapter.stmts.len() == 0 {
+		t.Fatal("expected cached statements after a query")
+	}
+
+	// SELECT * must see a column added after the statement was prepared.
+	if err := adapter.ExecDDL(ctx, `ALTER TABLE items ADD COLUMN note TEXT`); err != nil {
+		t.Fatalf("ExecDDL: %v", err)
+	}
+	if n := adapter.stmts.len(); n != 0 {
+		t.Errorf("cached statements after DDL = %d, want 0", n)
+	}
+	rows, _, err := adapter.QueryRows(ctx, "items", QueryOptions{})
+	if err != nil {
+		t.Fatalf("QueryRows: %v", err)
+	}
+	if _, ok := rows[0]["note"]; !ok {
+		t.Errorf("row = %v, want the new note column", rows[0])
+	}
+}
+
+func TestStmtCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	adapter := testSQLiteAdapter(t)
+	seedTestTable(t, adapter)
+	ctx := context.Background()
+	cache := newStmtCache(adapter.db, 2)
+	t.Cleanup(cache.reset)
+
+	held, err := cache.acquire(ctx, `SELECT 1`)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	for _, q := range []string{`SELECT 2`, `SELECT 3`} {
+		cs, err := cache.acquire(ctx, q)
+		if err != nil {
+			t.Fatalf("acquire: %v", err)
+		}
+		cache.release(cs)
+	}
+	if n := cache.len(); n != 2 {
+		t.Errorf("len = %d, want 2", n)
+	}
+
+	// An evicted statement stays usable until its holder releases it.
+	var v int
+	if err := held.stmt.QueryRowContext(ctx).Scan(&v); err != nil || v != 1 {
+		t.Fatalf("evicted statement: v=%d err=%v", v, err)
+	}
+	cache.release(held)
+	if err := held.stmt.QueryRowContext(ctx).Scan(&v); err == nil {
+		t.Error("expected the released evicted statement to be closed")
+	}
+}
+
+func TestStmtCache_BatchPreparesOnce(t *testing.T) {
+	adapter := testSQLiteAdapter(t)
+	seedTestTable(t, adapter)
+	ctx := context.Background()
+
+	rows := make([]map[string]any, 50)
+	for i := range rows {
+		rows[i] = map[string]any{"id": fmt.Sprintf("b%03d", i), "name": "batch", "quantity": int64(i)}
+	}
+	before := adapter.stmts.counter.stats()["misses"].(int64)
+	if err := adapter.InsertRows(ctx, "items", rows); err != nil {
+		t.Fatalf("InsertRows: %v", err)
+	}
+	if got := adapter.stmts.counter.stats()["misses"].(int64) - before; got != 1 {
+		t.Errorf("misses = %d, want 1", got)
+	}
+
+	writes := make([]BatchWrite, 0, 20)
+	for i := range 10 {
+		id := fmt.Sprintf("b%03d", i)
+		writes = append(writes,
+			BatchWrite{Op: BatchUpdate, Table: "items", ID: id, Data: map[string]any{"name": "updated"}},
+			BatchWrite{Op: BatchDelete, Table: "items", ID: id})
+	}
+	if idx, err := adapter.ExecWriteBatch(ctx, writes); err != nil {
+		t.Fatalf("ExecWriteBatch at %d: %v", idx, err)
+	}
+	_, total, err := adapter.QueryRows(ctx, "items", QueryOptions{})
+	if err != nil {
+		t.Fatalf("QueryRows: %v", err)
+	}
+	if total != 3+40 {
+		t.Errorf("total = %d, want 43", total)
+	}
+}
@@ -21,6 +21,7 @@ const ddlUsersTable = `CREATE TABLE IF NOT EXISTS users (
     password_hash TEXT NOT NULL,
     role TEXT NOT NULL,
     can_write BOOLEAN NOT NULL DEFAULT 0,
+    enabled BOOLEAN NOT NULL DEFAULT 1,
     created_at TEXT NOT NULL,
     updated_at TEXT NOT NULL,
     last_login_at TEXT,
@@ -36,11 +37,15 @@ const ddlApikeysTable = `CREATE TABLE IF NOT EXISTS apikeys (
     role TEXT NOT NULL,
     can_write BOOLEAN NOT NULL DEFAULT 0,
     collections JSON NOT NULL DEFAULT '[]',
+    scopes JSON,
     is_website BOOLEAN NOT NULL DEFAULT 0,
     allowed_origins JSON,
     rate_limit INTEGER NOT NULL DEFAULT 15,
     captcha_required BOOLEAN NOT NULL DEFAULT 0,
+    noisy_aggregates BOOLEAN NOT NULL DEFAULT 0,
     enabled BOOLEAN NOT NULL DEFAULT 1,
+    user_id TEXT,
+    expires_at TEXT,
     key_hash TEXT NOT NULL,
     created_at TEXT NOT NULL,
     updated_at TEXT NOT NULL,
@@ -57,6 +62,10 @@ const ddlRefreshTokensTable = `CREATE TABLE IF NOT EXISTS moon_auth_refresh_toke
     refresh_token_hash TEXT NOT NULL,
     expires_at TEXT NOT NULL,
     created_at TEXT NOT NULL,
+    session_started_at TEXT,
+    session_id TEXT,
+    user_agent TEXT,
+    client_ip TEXT,
     last_used_at TEXT,
     revoked_at TEXT,
     revocation_reason TEXT
@@ -68,6 +77,147 @@ const ddlRefreshTokensUserRevokedIndex = `CREATE INDEX IF NOT EXISTS idx_refresh
 
 const ddlRefreshTokensExpiresIndex = `CREATE INDEX IF NOT EXISTS idx_refresh_tokens_expires_at ON moon_auth_refresh_tokens(expires_at)`
 
+const ddlTOTPTable = `CREATE TABLE IF NOT EXISTS moon_auth_totp (
+    id TEXT PRIMARY KEY,
+    secret TEXT NOT NULL,
+    recovery_codes TEXT NOT NULL DEFAULT '',
+    last_step INTEGER NOT NULL DEFAULT 0,
+    enabled_at TEXT,
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL
+)`
+
+const ddlIdentitiesTable = `CREATE TABLE IF NOT EXISTS moon_auth_identities (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    issuer TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    email TEXT NOT NULL DEFAULT '',
+    created_at TEXT NOT NULL,
+    last_login_at TEXT,
+    CONSTRAINT moon_auth_identities_subject_unique UNIQUE (issuer, subject)
+)`
+
+const ddlPasswordHistoryTable = `CREATE TABLE IF NOT EXISTS moon_auth_password_history (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    password_hash TEXT NOT NULL,
+    created_at TEXT NOT NULL
+)`
+
+const ddlLockoutsTable = `CREATE TABLE IF NOT EXISTS moon_auth_lockouts (
+    id TEXT PRIMARY KEY,
+    failed_count INTEGER NOT NULL DEFAULT 0,
+    last_failed_at TEXT NOT NULL,
+    locked_until TEXT
+)`
+
+const ddlPasswordResetsTable = `CREATE TABLE IF NOT EXISTS moon_auth_password_resets (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    token_hash TEXT NOT NULL,
+    expires_at TEXT NOT NULL,
+    used_at TEXT,
+    created_at TEXT NOT NULL
+)`
+
+const ddlPasswordResetsHashIndex = `CREATE UNIQUE INDEX IF NOT EXISTS idx_password_resets_token_hash ON moon_auth_password_resets(token_hash)`
+
+const ddlInvitationsTable = `CREATE TABLE IF NOT EXISTS moon_auth_invitations (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    token_hash TEXT NOT NULL,
+    expires_at TEXT NOT NULL,
+    invited_by TEXT NOT NULL,
+    created_at TEXT NOT NULL
+)`
+
+const ddlInvitationsHashIndex = `CREATE UNIQUE INDEX IF NOT EXISTS idx_invitations_token_hash ON moon_auth_invitations(token_hash)`
+
+const ddlSchemaVersionTable = `CREATE TABLE IF NOT EXISTS moon_schema_version (
+    id TEXT PRIMARY KEY,
+    version TEXT NOT NULL,
+    updated_at TEXT NOT NULL
+)`
+
+const ddlPermissionsTable = `CREATE TABLE IF NOT EXISTS moon_permissions (
+    id TEXT PRIMARY KEY,
+    collection TEXT NOT NULL,
+    subject_type TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    operations JSON NOT NULL DEFAULT '[]',
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL,
+    CONSTRAINT moon_permissions_subject_unique UNIQUE (collection, subject_type, subject)
+)`
+
+const ddlRolesTable = `CREATE TABLE IF NOT EXISTS moon_roles (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    permissions JSON NOT NULL DEFAULT '{}',
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL
+)`
+
+const ddlTemplatesTable = `CREATE TABLE IF NOT EXISTS moon_templates (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    collection TEXT NOT NULL,
+    format TEXT NOT NULL,
+    body TEXT NOT NULL,
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL
+)`
+
+const ddlValidatorsTable = `CREATE TABLE IF NOT EXISTS moon_validators (
+    id TEXT PRIMARY KEY,
+    collection TEXT NOT NULL UNIQUE,
+    module TEXT NOT NULL,
+    sha256 TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL
+)`
+
+const ddlCollectionAliasesTable = `CREATE TABLE IF NOT EXISTS moon_collection_aliases (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    target TEXT NOT NULL,
+    expires_at TEXT NOT NULL,
+    created_at TEXT NOT NULL
+)`
+
+const ddlAttributesTable = `CREATE TABLE IF NOT EXISTS moon_attributes (
+    id TEXT PRIMARY KEY,
+    collection TEXT NOT NULL,
+    name TEXT NOT NULL,
+    type TEXT NOT NULL,
+    created_at TEXT NOT NULL,
+    CONSTRAINT moon_attributes_name_unique UNIQUE (collection, name)
+)`
+
+const ddlAuditTable = `CREATE TABLE IF NOT EXISTS moon_audit (
+    id TEXT PRIMARY KEY,
+    event TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    action TEXT NOT NULL,
+    collection TEXT NOT NULL,
+    record_id TEXT NOT NULL,
+    changes JSON NOT NULL DEFAULT '{}',
+    request_id TEXT NOT NULL,
+    created_at TEXT NOT NULL
+)`
+
+const ddlAuditRecordIndex = `CREATE INDEX IF NOT EXISTS idx_moon_audit_record ON moon_audit(collection, record_id)`
+
+const ddlLayoutVersionTable = `CREATE TABLE IF NOT EXISTS moon_layout_version (
+    id TEXT PRIMARY KEY,
+    version INTEGER NOT NULL,
+    moon_version TEXT NOT NULL,
+    updated_at TEXT NOT NULL
+)`
+
 // systemDDL lists every DDL statement executed during startup reconciliation,
 // in the order they must run.
 var systemDDL = []string{
@@ -79,11 +229,48 @@ var systemDDL = []string{
 	ddlRefreshTokensHashIndex,
 	ddlRefreshTokensUserRevokedIndex,
 	ddlRefreshTokensExpiresIndex,
+	ddlTOTPTable,
+	ddlIdentitiesTable,
+	ddlPasswordHistoryTable,
+	ddlLockoutsTable,
+	ddlPasswordResetsTable,
+	ddlPasswordResetsHashIndex,
+	ddlInvitationsTable,
+	ddlInvitationsHashIndex,
+	ddlSchemaVersionTable,
+	ddlPermissionsTable,
+	ddlRolesTable,
+	ddlTemplatesTable,
+	ddlValidatorsTable,
+	ddlCollectionAliasesTable,
+	ddlAttributesTable,
+	ddlAuditTable,
+	ddlAuditRecordIndex,
+	ddlLayoutVersionTable,
+}
+
+// systemColumnAdditions lists columns added to system tables after the
+// tables were first released. Databases created before then lack them.
+var systemColumnAdditions = []struct {
+	table  string
+	column string
+	ddl    string
+}{
+	{"users", "enabled", `ALTER TABLE users ADD COLUMN enabled BOOLEAN NOT NULL DEFAULT 1`},
+	{"apikeys", "user_id", `ALTER TABLE apikeys ADD COLUMN user_id TEXT`},
+	{"apikeys", "noisy_aggregates", `ALTER TABLE apikeys ADD COLUMN noisy_aggregates BOOLEAN NOT NULL DEFAULT 0`},
+	{"apikeys", "expires_at", `ALTER TABLE apikeys ADD COLUMN expires_at TEXT`},
+	{"apikeys", "scopes", `ALTER TABLE apikeys ADD COLUMN scopes JSON`},
+	{"moon_auth_refresh_tokens", "session_started_at", `ALTER TABLE moon_auth_refresh_tokens ADD COLUMN session_started_at TEXT`},
+	{"moon_auth_refresh_tokens", "session_id", `ALTER TABLE moon_auth_refresh_tokens ADD COLUMN session_id TEXT`},
+	{"moon_auth_refresh_tokens", "user_agent", `ALTER TABLE moon_auth_refresh_tokens ADD COLUMN user_agent TEXT`},
+	{"moon_auth_refresh_tokens", "client_ip", `ALTER TABLE moon_auth_refresh_tokens ADD COLUMN client_ip TEXT`},
 }
 
 // ---------------------------------------------------------------------------
-// EnsureSystemTables creates the required system tables if they do not exist.
-// All DDL uses IF NOT EXISTS so calls are idempotent.
+// EnsureSystemTables creates the required system tables if they do not exist
+// and adds any system columns an existing table is missing. All DDL is
+// conditional so calls are idempotent.
 // ---------------------------------------------------------------------------
 
 func EnsureSystemTables(ctx context.Context, db DatabaseAdapter) error {
@@ -92,9 +279,30 @@ func EnsureSystemTables(ctx context.Context, db DatabaseAdapter) error {
 			return fmt.Errorf("ensure system tables: %w", err)
 		}
 	}
+	for _, add := range systemColumnAdditions {
+		columns, err := db.DescribeTable(ctx, add.table)
+		if err != nil {
+			return fmt.Errorf("ensure system tables: describe %s: %w", add.table, err)
+		}
+		if hasColumn(columns, add.column) {
+			continue
+		}
+		if err := db.ExecDDL(ctx, add.ddl); err != nil {
+			return fmt.Errorf("ensure system tables: add %s.%s: %w", add.table, add.column, err)
+		}
+	}
 	return nil
 }
 
+func hasColumn(columns []ColumnInfo, name string) bool {
+	for _, c := range columns {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 // ---------------------------------------------------------------------------
 // CreateBootstrapAdmin creates the initial admin user when all bootstrap
 // fields are configured and no admin user exists yet.
@@ -108,16 +316,11 @@ func CreateBootstrapAdmin(ctx context.Context, db DatabaseAdapter, cfg *AppConfi
 	logger.Warn("bootstrap admin fields are present in config; remove them after initial setup",
 		"event", "bootstrap admin fields")
 
-	// Check whether an admin already exists.
-	rows, _, err := db.QueryRows(ctx, "users", QueryOptions{
-		Filters: []Filter{{Field: "role", Op: "eq", Value: "admin"}},
-		Page:    1,
-		PerPage: 1,
-	})
+	exists, err := adminExists(ctx, db)
 	if err != nil {
-		return fmt.Errorf("bootstrap admin: check existing: %w", err)
+		return fmt.Errorf("bootstrap admin: %w", err)
 	}
-	if len(rows) > 0 {
+	if exists {
 		logger.Info("admin user already exists; skipping bootstrap")
 		return nil
 	}
@@ -148,6 +351,19 @@ func CreateBootstrapAdmin(ctx context.Context, db DatabaseAdapter, cfg *AppConfi
 	return nil
 }
 
+// adminExists reports whether the users table holds an admin user.
+func adminExists(ctx context.Context, db DatabaseAdapter) (bool, error) {
+	rows, _, err := db.QueryRows(ctx, "users", QueryOptions{
+		Filters: []Filter{{Field: "role", Op: "eq", Value: "admin"}},
+		Page:    1,
+		PerPage: 1,
+	})
+	if err != nil {
+		return false, fmt.Errorf("check existing admin: %w", err)
+	}
+	return len(rows) > 0, nil
+}
+
 // ---------------------------------------------------------------------------
 // GenerateULID returns a new ULID string using crypto/rand.
 // ---------------------------------------------------------------------------
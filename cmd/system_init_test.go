@@ -114,6 +114,12 @@ func TestEnsureSystemTables_CreatesAllTables(t *testing.T) {
 		"users":                    false,
 		"apikeys":                  false,
 		"moon_auth_refresh_tokens": false,
+		"moon_permissions":         false,
+		"moon_roles":               false,
+		"moon_templates":           false,
+		"moon_validators":          false,
+		"moon_collection_aliases":  false,
+		"moon_attributes":          false,
 	}
 	for _, tbl := range tables {
 		if _, ok := want[tbl]; ok {
@@ -153,7 +159,7 @@ func TestEnsureSystemTables_UsersColumns(t *testing.T) {
 	}
 
 	wantCols := []string{"id", "username", "email", "password_hash", "role",
-		"can_write", "created_at", "updated_at", "last_login_at"}
+		"can_write", "enabled", "created_at", "updated_at", "last_login_at"}
 	got := make(map[string]bool)
 	for _, c := range cols {
 		got[c.Name] = true
@@ -165,6 +171,38 @@ func TestEnsureSystemTables_UsersColumns(t *testing.T) {
 	}
 }
 
+func TestEnsureSystemTables_AddsMissingUsersEnabled(t *testing.T) {
+	adapter := testAdapter(t)
+	ctx := context.Background()
+
+	legacy := `CREATE TABLE users (id TEXT PRIMARY KEY, username TEXT NOT NULL, email TEXT NOT NULL,
+		password_hash TEXT NOT NULL, role TEXT NOT NULL, can_write BOOLEAN NOT NULL DEFAULT 0,
+		created_at TEXT NOT NULL, updated_at TEXT NOT NULL, last_login_at TEXT)`
+	if err := adapter.ExecDDL(ctx, legacy); err != nil {
+		t.Fatalf("ExecDDL: %v", err)
+	}
+	if err := adapter.InsertRow(ctx, "users", map[string]any{
+		"id": "U1", "username": "old", "email": "old@example.com", "password_hash": "x",
+		"role": "user", "created_at": "2024-01-01T00:00:00Z", "updated_at": "2024-01-01T00:00:00Z",
+	}); err != nil {
+		t.Fatalf("InsertRow: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := EnsureSystemTables(ctx, adapter); err != nil {
+			t.Fatalf("EnsureSystemTables run %d: %v", i+1, err)
+		}
+	}
+
+	rows, _, err := adapter.QueryRows(ctx, "users", QueryOptions{Page: 1, PerPage: 1})
+	if err != nil {
+		t.Fatalf("QueryRows: %v", err)
+	}
+	if v, ok := rows[0]["enabled"]; !ok || !toBool(v) {
+		t.Errorf("expected existing user to be enabled, got %v", rows[0])
+	}
+}
+
 func TestEnsureSystemTables_ApikeysColumns(t *testing.T) {
 	adapter := testAdapter(t)
 	ctx := context.Background()
@@ -179,7 +217,7 @@ func TestEnsureSystemTables_ApikeysColumns(t *testing.T) {
 	}
 
 	wantCols := []string{"id", "name", "role", "can_write", "collections", "is_website",
-		"allowed_origins", "rate_limit", "captcha_required", "enabled",
+		"allowed_origins", "rate_limit", "captcha_required", "noisy_aggregates", "enabled", "user_id",
 		"key_hash", "created_at", "updated_at", "last_used_at"}
 	got := make(map[string]bool)
 	for _, c := range cols {
@@ -206,7 +244,7 @@ func TestEnsureSystemTables_RefreshTokensColumns(t *testing.T) {
 	}
 
 	wantCols := []string{"id", "user_id", "refresh_token_hash", "expires_at",
-		"created_at", "last_used_at", "revoked_at", "revocation_reason"}
+		"created_at", "session_started_at", "last_used_at", "revoked_at", "revocation_reason"}
 	got := make(map[string]bool)
 	for _, c := range cols {
 		got[c.Name] = true
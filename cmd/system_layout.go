@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// ---------------------------------------------------------------------------
+// System layout version
+//
+// The layout version numbers the shape of Moon's own tables. It is stored
+// in LayoutVersionTable together with the Moon version that wrote it. A
+// binary refuses to start against a database whose layout is newer than
+// the one it knows, and against one whose layout is older until
+// `moon upgrade` has applied the missing migrations.
+// ---------------------------------------------------------------------------
+
+// layoutMigration moves the system tables from the previous layout
+// version to version. apply must be idempotent, so an upgrade interrupted
+// before its version was recorded can be run again.
+type layoutMigration struct {
+	version     int
+	description string
+	apply       func(ctx context.Context, db DatabaseAdapter) error
+}
+
+// layoutMigrations lists every migration in version order. The last
+// version must equal CurrentLayoutVersion.
+var layoutMigrations = []layoutMigration{
+	{1, "create the system tables and add the columns introduced since their first release", EnsureSystemTables},
+}
+
+// layoutVersion is the layout recorded in a database.
+type layoutVersion struct {
+	version     int    // 0 when no layout has been recorded
+	moonVersion string // Moon version that recorded it
+}
+
+// readLayoutVersion returns the recorded layout, or the zero layoutVersion
+// for databases created before layouts were recorded.
+func readLayoutVersion(ctx context.Context, db DatabaseAdapter) (layoutVersion, error) {
+	tables, err := db.ListTables(ctx)
+	if err != nil {
+		return layoutVersion{}, fmt.Errorf("read layout version: %w", err)
+	}
+	if !slices.Contains(tables, LayoutVersionTable) {
+		return layoutVersion{}, nil
+	}
+	rows, _, err := db.QueryRows(ctx, LayoutVersionTable, QueryOptions{
+		Filters: []Filter{{Field: "id", Op: "eq", Value: LayoutVersionRowID}},
+		Page:    1,
+		PerPage: 1,
+	})
+	if err != nil {
+		return layoutVersion{}, fmt.Errorf("read layout version: %w", err)
+	}
+	if len(rows) == 0 {
+		return layoutVersion{}, nil
+	}
+	v, ok := toInt64(rows[0]["version"])
+	if !ok {
+		return layoutVersion{}, fmt.Errorf("read layout version: invalid version %v", rows[0]["version"])
+	}
+	return layoutVersion{version: int(v), moonVersion: stringVal(rows[0], "moon_version")}, nil
+}
+
+// writeLayoutVersion records version as the database layout.
+func writeLayoutVersion(ctx context.Context, db DatabaseAdapter, version int) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	err := db.ExecDDLBatch(ctx, []string{
+		fmt.Sprintf("DELETE FROM %s", LayoutVersionTable),
+		fmt.Sprintf("INSERT INTO %s (id, version, moon_version, updated_at) VALUES ('%s', %d, '%s', '%s')",
+			LayoutVersionTable, LayoutVersionRowID, version, MoonVersion, now),
+	})
+	if err != nil {
+		return fmt.Errorf("record layout version %d: %w", version, err)
+	}
+	return nil
+}
+
+// errLayoutTooNew reports a database written by a newer Moon.
+func errLayoutTooNew(stored layoutVersion) error {
+	return fmt.Errorf("database layout version %d (written by Moon %s) is newer than this binary supports (%d); run Moon %s or later, or restore a backup taken before the upgrade",
+		stored.version, stored.moonVersion, CurrentLayoutVersion, stored.moonVersion)
+}
+
+// PrepareSystemTables checks the database layout at startup and reconciles
+// the system tables. A fresh database is created at CurrentLayoutVersion.
+// Startup fails if the layout is newer than this binary supports, or older
+// and in need of `moon upgrade`.
+//
+// Layout 1 is the layout startup has always created and reconciled on its
+// own, so databases from before layouts were recorded are marked as layout
+// 1 and reconciled here without an upgrade.
+func PrepareSystemTables(ctx context.Context, db DatabaseAdapter) error {
+	stored, err := readLayoutVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+	if stored.version > CurrentLayoutVersion {
+		return errLayoutTooNew(stored)
+	}
+	if stored.version == 0 {
+		tables, err := db.ListTables(ctx)
+		if err != nil {
+			return fmt.Errorf("prepare system tables: %w", err)
+		}
+		if !slices.Contains(tables, "users") {
+			_, _, err := UpgradeSystemTables(ctx, db)
+			return err
+		}
+		if err := db.ExecDDL(ctx, ddlLayoutVersionTable); err != nil {
+			return fmt.Errorf("prepare system tables: %w", err)
+		}
+		if err := writeLayoutVersion(ctx, db, 1); err != nil {
+			return err
+		}
+		stored.version = 1
+	}
+	if stored.version < CurrentLayoutVersion {
+		return fmt.Errorf("database layout version %d is older than this binary's (%d); back up the database and run `moon upgrade` to migrate it",
+			stored.version, CurrentLayoutVersion)
+	}
+	return EnsureSystemTables(ctx, db)
+}
+
+// UpgradeSystemTables applies the migrations after the recorded layout in
+// order, recording each version once its migration has succeeded. It
+// returns the layout versions before and after the upgrade.
+func UpgradeSystemTables(ctx context.Context, db DatabaseAdapter) (from, to int, err error) {
+	stored, err := readLayoutVersion(ctx, db)
+	if err != nil {
+		return 0, 0, err
+	}
+	if stored.version > CurrentLayoutVersion {
+		return stored.version, stored.version, errLayoutTooNew(stored)
+	}
+	to = stored.version
+	for _, m := range layoutMigrations {
+		if m.version <= stored.version {
+			continue
+		}
+		if err := m.apply(ctx, db); err != nil {
+			return stored.version, to, fmt.Errorf("migrate to layout %d (%s): %w", m.version, m.description, err)
+		}
+		if err := writeLayoutVersion(ctx, db, m.version); err != nil {
+			return stored.version, to, err
+		}
+		to = m.version
+	}
+	return stored.version, to, nil
+}
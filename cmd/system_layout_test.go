@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestLayoutMigrations_EndAtCurrentVersion(t *testing.T) {
+	for i, m := range layoutMigrations {
+		if m.version != i+1 {
+			t.Fatalf("migration %d has version %d; versions must be consecutive from 1", i, m.version)
+		}
+	}
+	if last := layoutMigrations[len(layoutMigrations)-1].version; last != CurrentLayoutVersion {
+		t.Fatalf("last migration is version %d; want CurrentLayoutVersion %d", last, CurrentLayoutVersion)
+	}
+}
+
+func TestPrepareSystemTables_FreshDatabase(t *testing.T) {
+	adapter := testAdapter(t)
+	ctx := context.Background()
+
+	if err := PrepareSystemTables(ctx, adapter); err != nil {
+		t.Fatalf("PrepareSystemTables: %v", err)
+	}
+	stored, err := readLayoutVersion(ctx, adapter)
+	if err != nil {
+		t.Fatalf("readLayoutVersion: %v", err)
+	}
+	if stored.version != CurrentLayoutVersion || stored.moonVersion != MoonVersion {
+		t.Fatalf("unexpected layout %+v", stored)
+	}
+	// A second start finds the layout it recorded.
+	if err := PrepareSystemTables(ctx, adapter); err != nil {
+		t.Fatalf("PrepareSystemTables again: %v", err)
+	}
+}
+
+func TestPrepareSystemTables_UnversionedDatabase(t *testing.T) {
+	adapter := testAdapter(t)
+	ctx := context.Background()
+
+	if err := EnsureSystemTables(ctx, adapter); err != nil {
+		t.Fatalf("EnsureSystemTables: %v", err)
+	}
+	if err := adapter.ExecDDL(ctx, "DROP TABLE "+LayoutVersionTable); err != nil {
+		t.Fatalf("drop layout table: %v", err)
+	}
+	if err := PrepareSystemTables(ctx, adapter); err != nil {
+		t.Fatalf("PrepareSystemTables: %v", err)
+	}
+	if stored, _ := readLayoutVersion(ctx, adapter); stored.version != 1 {
+		t.Fatalf("expected layout 1, got %+v", stored)
+	}
+}
+
+func TestPrepareSystemTables_RefusesNewerLayout(t *testing.T) {
+	adapter := testAdapter(t)
+	ctx := context.Background()
+
+	if err := PrepareSystemTables(ctx, adapter); err != nil {
+		t.Fatalf("PrepareSystemTables: %v", err)
+	}
+	if err := writeLayoutVersion(ctx, adapter, CurrentLayoutVersion+1); err != nil {
+		t.Fatalf("writeLayoutVersion: %v", err)
+	}
+	err := PrepareSystemTables(ctx, adapter)
+	if err == nil || !strings.Contains(err.Error(), "newer than this binary supports") {
+		t.Fatalf("expected newer layout error, got %v", err)
+	}
+	if _, _, err := UpgradeSystemTables(ctx, adapter); err == nil {
+		t.Fatal("expected upgrade to refuse a newer layout")
+	}
+}
+
+func TestUpgradeSystemTables(t *testing.T) {
+	adapter := testAdapter(t)
+	ctx := context.Background()
+
+	from, to, err := UpgradeSystemTables(ctx, adapter)
+	if err != nil {
+		t.Fatalf("UpgradeSystemTables: %v", err)
+	}
+	if from != 0 || to != CurrentLayoutVersion {
+		t.Fatalf("expected upgrade from 0 to %d, got %d to %d", CurrentLayoutVersion, from, to)
+	}
+	from, to, err = UpgradeSystemTables(ctx, adapter)
+	if err != nil || from != CurrentLayoutVersion || to != CurrentLayoutVersion {
+		t.Fatalf("expected no-op upgrade, got %d to %d, err %v", from, to, err)
+	}
+}
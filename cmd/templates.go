@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"net/http"
+	texttemplate "text/template"
+)
+
+// DocumentTemplate is an admin-managed template that renders one record of
+// a collection as an HTML or Markdown document, such as an invoice.
+type DocumentTemplate struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Collection string `json:"collection"`
+	Format     string `json:"format"`
+	Body       string `json:"body"`
+	CreatedAt  string `json:"created_at"`
+	UpdatedAt  string `json:"updated_at"`
+}
+
+// templateExecutor is the method shared by html/template and text/template.
+type templateExecutor interface {
+	Execute(w io.Writer, data any) error
+}
+
+// parse compiles the template body. HTML templates escape record values
+// for their context; Markdown templates insert them verbatim.
+func (t DocumentTemplate) parse() (templateExecutor, error) {
+	if t.Format == "html" {
+		tmpl, err := htmltemplate.New(t.Name).Parse(t.Body)
+		if err != nil {
+			return nil, err
+		}
+		return tmpl, nil
+	}
+	tmpl, err := texttemplate.New(t.Name).Parse(t.Body)
+	if err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// contentType returns the Content-Type of a rendered document.
+func (t DocumentTemplate) contentType() string {
+	if t.Format == "html" {
+		return "text/html; charset=utf-8"
+	}
+	return "text/markdown; charset=utf-8"
+}
+
+func documentTemplateFromRow(row map[string]any) DocumentTemplate {
+	return DocumentTemplate{
+		ID:         stringVal(row, "id"),
+		Name:       stringVal(row, "name"),
+		Collection: stringVal(row, "collection"),
+		Format:     stringVal(row, "format"),
+		Body:       stringVal(row, "body"),
+		CreatedAt:  stringVal(row, "created_at"),
+		UpdatedAt:  stringVal(row, "updated_at"),
+	}
+}
+
+// findTemplate returns the template named name, or nil when none exists.
+func findTemplate(ctx context.Context, db DatabaseAdapter, name string) (*DocumentTemplate, error) {
+	rows, _, err := db.QueryRows(ctx, TemplatesTable, QueryOptions{
+		Filters: []Filter{{Field: "name", Op: "eq", Value: name}},
+		Page:    1,
+		PerPage: 1,
+	})
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	t := documentTemplateFromRow(rows[0])
+	return &t, nil
+}
+
+// removeCollectionTemplates deletes every template of collection. It is
+// called when the collection is destroyed so a later collection with the
+// same name does not inherit stale templates.
+func removeCollectionTemplates(ctx context.Context, db DatabaseAdapter, collection string) error {
+	for {
+		rows, _, err := db.QueryRows(ctx, TemplatesTable, QueryOptions{
+			Filters: []Filter{{Field: "collection", Op: "eq", Value: collection}},
+			Page:    1,
+			PerPage: MaxPerPage,
+		})
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if err := db.DeleteRow(ctx, TemplatesTable, stringVal(row, "id")); err != nil {
+				return err
+			}
+		}
+		if len(rows) < MaxPerPage {
+			return nil
+		}
+	}
+}
+
+// renameCollectionTemplates moves every template of from to the
+// collection to. It is called when a collection is renamed.
+func renameCollectionTemplates(ctx context.Context, db DatabaseAdapter, from, to string) error {
+	for {
+		rows, _, err := db.QueryRows(ctx, TemplatesTable, QueryOptions{
+			Filters: []Filter{{Field: "collection", Op: "eq", Value: from}},
+			Page:    1,
+			PerPage: MaxPerPage,
+		})
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if err := db.UpdateRow(ctx, TemplatesTable, stringVal(row, "id"), map[string]any{"collection": to}); err != nil {
+				return err
+			}
+		}
+		if len(rows) < MaxPerPage {
+			return nil
+		}
+	}
+}
+
+// ResourceRenderHandler implements GET /data/{resource}:render, which
+// merges one record into a document template.
+type ResourceRenderHandler struct {
+	db       DatabaseAdapter
+	registry *SchemaRegistry
+}
+
+// NewResourceRenderHandler creates a ResourceRenderHandler with the given dependencies.
+func NewResourceRenderHandler(db DatabaseAdapter, registry *SchemaRegistry) *ResourceRenderHandler {
+	return &ResourceRenderHandler{db: db, registry: registry}
+}
+
+// knownRenderParams lists the query parameters accepted by :render.
+var knownRenderParams = map[string]bool{
+	"id":       true,
+	"template": true,
+}
+
+// HandleRender renders the record named by id with the template named by
+// template. The template must belong to the resource. The record is
+// available to the template as .Record, with the same fields :query
+// returns, and the collection name as .Collection. The response is the
+// rendered document, not the JSON envelope.
+func (h *ResourceRenderHandler) HandleRender(w http.ResponseWriter, r *http.Request) {
+	resource := extractResource(r.URL.Path)
+	col, ok := h.registry.Get(resource)
+	if !ok {
+		WriteError(w, http.StatusNotFound, fmt.Sprintf("Resource '%s' not found", resource))
+		return
+	}
+	if col.System {
+		WriteError(w, http.StatusBadRequest, fmt.Sprintf("Rendering is not supported for '%s'", resource))
+		return
+	}
+
+	q := r.URL.Query()
+	for key := range q {
+		if !knownRenderParams[key] {
+			WriteError(w, http.StatusBadRequest, fmt.Sprintf("Unknown query parameter %q", key))
+			return
+		}
+	}
+	id, name := q.Get("id"), q.Get("template")
+	if id == "" {
+		WriteError(w, http.StatusBadRequest, "Missing required parameter: id")
+		return
+	}
+	if name == "" {
+		WriteError(w, http.StatusBadRequest, "Missing required parameter: template")
+		return
+	}
+
+	ctx := r.Context()
+	tmpl, err := findTemplate(ctx, h.db, name)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if tmpl == nil || tmpl.Collection != resource {
+		WriteError(w, http.StatusNotFound, fmt.Sprintf("Template '%s' not found", name))
+		return
+	}
+
+	rows, _, err := h.db.QueryRows(ctx, resource, QueryOptions{
+		Filters: append([]Filter{{Field: "id", Op: "eq", Value: id}}, ownerFilters(r, col)...),
+		Page:    1,
+		PerPage: 1,
+	})
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if len(rows) == 0 {
+		WriteError(w, http.StatusNotFound, "Resource not found")
+		return
+	}
+
+	exec, err := tmpl.parse()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Sprintf("Template '%s' failed to render", name))
+		return
+	}
+	var buf bytes.Buffer
+	data := map[string]any{
+		"Collection": resource,
+		"Record":     filterHiddenFields(resource, formatRecord(rows[0], col)),
+	}
+	if err := exec.Execute(&buf, data); err != nil {
+		WriteError(w, http.StatusInternalServerError, fmt.Sprintf("Template '%s' failed to render", name))
+		return
+	}
+
+	if writeNotModified(w, r, contentETag(buf.Bytes())) {
+		return
+	}
+	w.Header().Set("Content-Type", tmpl.contentType())
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
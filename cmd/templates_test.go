@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResourceRender(t *testing.T) {
+	adapter, registry := setupTemplateTest(t)
+	seedProducts(t, adapter)
+	admin := NewAdminTemplateHandler(adapter, registry, nil)
+	w := doAdminTemplateMutate(t, admin, map[string]any{"op": "set", "data": []any{
+		map[string]any{"name": "label", "collection": "products", "format": "html", "body": "<h1>{{.Record.title}}</h1><p>{{.Record.description}}</p>"},
+		map[string]any{"name": "note", "collection": "products", "format": "markdown", "body": "# {{.Record.title}} ({{.Collection}})"},
+	}}, adminIdentity())
+	if w.Code != http.StatusOK {
+		t.Fatalf("set templates: %d %s", w.Code, w.Body.String())
+	}
+	if err := adapter.UpdateRow(context.Background(), "products", "01J0001", map[string]any{"description": "<b>bold</b>"}); err != nil {
+		t.Fatalf("UpdateRow: %v", err)
+	}
+
+	h := NewResourceRenderHandler(adapter, registry)
+	render := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/data/products:render?"+query, nil)
+		req = req.WithContext(SetAuthIdentity(req.Context(), adminIdentity()))
+		w := httptest.NewRecorder()
+		h.HandleRender(w, req)
+		return w
+	}
+
+	w = render("id=01J0001&template=label")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("html: %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if got := w.Body.String(); got != "<h1>Widget</h1><p>&lt;b&gt;bold&lt;/b&gt;</p>" {
+		t.Errorf("expected escaped html, got %q", got)
+	}
+
+	etag := w.Header().Get("ETag")
+	req := httptest.NewRequest(http.MethodGet, "/data/products:render?id=01J0001&template=label", nil)
+	req = req.WithContext(SetAuthIdentity(req.Context(), adminIdentity()))
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	h.HandleRender(w, req)
+	if etag == "" || w.Code != http.StatusNotModified {
+		t.Errorf("expected 304 for ETag %q, got %d", etag, w.Code)
+	}
+
+	w = render("id=01J0002&template=note")
+	if got := w.Body.String(); w.Code != http.StatusOK || got != "# Gadget (products)" {
+		t.Errorf("markdown: %d %q", w.Code, got)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/markdown") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+
+	for query, want := range map[string]int{
+		"id=01J0001":                  http.StatusBadRequest,
+		"template=label":              http.StatusBadRequest,
+		"id=01J0001&template=label&x": http.StatusBadRequest,
+		"id=01J0001&template=missing": http.StatusNotFound,
+		"id=01J9999&template=label":   http.StatusNotFound,
+	} {
+		if w := render(query); w.Code != want {
+			t.Errorf("%s: expected %d, got %d", query, want, w.Code)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// newTLSConfig returns the TLS settings for serving HTTPS: the certificate
+// from cfg.CertFile and cfg.KeyFile, or, with cfg.ACMEHosts, certificates
+// obtained and renewed from Let's Encrypt for those hosts only. ACME uses
+// the TLS-ALPN-01 challenge, so the server must be reachable on port 443
+// under each host name.
+func newTLSConfig(cfg TLSConfig) (*tls.Config, error) {
+	if len(cfg.ACMEHosts) > 0 {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.ACMEHosts...),
+			Cache:      autocert.DirCache(cfg.ACMECacheDir),
+			Email:      cfg.ACMEEmail,
+		}
+		tlsConfig := m.TLSConfig()
+		tlsConfig.MinVersion = tls.VersionTLS12
+		return tlsConfig, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load certificate: %w", err)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
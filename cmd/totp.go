@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ---------------------------------------------------------------------------
+// TOTP (RFC 6238)
+// ---------------------------------------------------------------------------
+
+// totpEncoding is the unpadded base32 alphabet authenticator apps expect
+// for secrets.
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateTOTPSecret returns a new random TOTP secret.
+func generateTOTPSecret() ([]byte, error) {
+	secret := make([]byte, TOTPSecretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("generate totp secret: %w", err)
+	}
+	return secret, nil
+}
+
+// totpStep returns the TOTP time step containing t.
+func totpStep(t time.Time) int64 {
+	return t.Unix() / TOTPPeriodSeconds
+}
+
+// totpCode returns the code for secret at step.
+func totpCode(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	mod := uint32(1)
+	for range TOTPDigits {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", TOTPDigits, value%mod)
+}
+
+// verifyTOTP checks code against secret within TOTPSkewSteps of now and
+// returns the step it matched. Steps at or before lastStep are rejected so
+// that a code cannot be replayed.
+func verifyTOTP(secret []byte, code string, now time.Time, lastStep int64) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != TOTPDigits {
+		return 0, false
+	}
+	current := totpStep(now)
+	for step := current - TOTPSkewSteps; step <= current+TOTPSkewSteps; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(secret, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpURI returns the otpauth:// provisioning URI that authenticator apps
+// read from a QR code.
+func totpURI(account string, secret []byte) string {
+	label := url.PathEscape(TOTPIssuer + ":" + account)
+	q := url.Values{
+		"secret":    {totpEncoding.EncodeToString(secret)},
+		"issuer":    {TOTPIssuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(TOTPDigits)},
+		"period":    {fmt.Sprint(TOTPPeriodSeconds)},
+	}
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+// ---------------------------------------------------------------------------
+// Recovery codes
+// ---------------------------------------------------------------------------
+
+// generateRecoveryCodes returns TOTPRecoveryCodes new recovery codes, such
+// as "3f9a1-c07e2", and their hashes for storage.
+func generateRecoveryCodes() (codes, hashes []string, err error) {
+	for range TOTPRecoveryCodes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, fmt.Errorf("generate recovery codes: %w", err)
+		}
+		s := hex.EncodeToString(b)
+		code := s[:5] + "-" + s[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode returns the stored form of a recovery code. Case and
+// the separating dash are ignored.
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPCode_RFC6238(t *testing.T) {
+	// Test vectors from RFC 6238 Appendix B (SHA1), truncated to six digits.
+	secret := []byte("12345678901234567890")
+	for _, tt := range []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	} {
+		if got := totpCode(secret, totpStep(time.Unix(tt.unix, 0))); got != tt.want {
+			t.Errorf("T=%d: expected %s, got %s", tt.unix, tt.want, got)
+		}
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	now := time.Unix(1111111109, 0)
+	step := totpStep(now)
+
+	if got, ok := verifyTOTP(secret, totpCode(secret, step-1), now, 0); !ok || got != step-1 {
+		t.Errorf("expected the previous step to be accepted, got %d %v", got, ok)
+	}
+	if _, ok := verifyTOTP(secret, totpCode(secret, step-2), now, 0); ok {
+		t.Error("expected a code two steps old to be rejected")
+	}
+	if _, ok := verifyTOTP(secret, totpCode(secret, step), now, step); ok {
+		t.Error("expected a used step to be rejected")
+	}
+	if _, ok := verifyTOTP(secret, "12345", now, 0); ok {
+		t.Error("expected a short code to be rejected")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := totpURI("jane doe", []byte("12345678901234567890"))
+	u, err := url.Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Moon:jane doe" {
+		t.Errorf("unexpected uri %s", uri)
+	}
+	if q := u.Query(); q.Get("secret") != "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" || q.Get("issuer") != "Moon" {
+		t.Errorf("unexpected query %v", q)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != TOTPRecoveryCodes || len(hashes) != TOTPRecoveryCodes {
+		t.Fatalf("expected %d codes, got %d", TOTPRecoveryCodes, len(codes))
+	}
+	if hashRecoveryCode(strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))) != hashes[0] {
+		t.Error("expected case and dashes to be ignored")
+	}
+}
+
+func TestSealSecret(t *testing.T) {
+	sealed, err := sealSecret("secret-one", "totp", []byte("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sealed, "payload") {
+		t.Fatal("sealed value contains the plain data")
+	}
+	if got, err := openSecret("secret-one", "totp", sealed); err != nil || string(got) != "payload" {
+		t.Fatalf("round trip failed: %q %v", got, err)
+	}
+	if _, err := openSecret("secret-two", "totp", sealed); err != errSealedValue {
+		t.Errorf("expected errSealedValue with another secret, got %v", err)
+	}
+	if _, err := openSecret("secret-one", "oidc", sealed); err != errSealedValue {
+		t.Errorf("expected errSealedValue for another purpose, got %v", err)
+	}
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------------------------------------------------------------------------
+// Tracing
+//
+// Moon records a server span for each request and a client span for each
+// database operation made while serving it, and exports them to an
+// OpenTelemetry collector over OTLP/HTTP with JSON encoding. An inbound W3C
+// traceparent header makes the request span a child of the caller's span;
+// a caller that did not sample its trace is not traced here either.
+// ---------------------------------------------------------------------------
+
+// OTLP span kinds and status codes.
+const (
+	spanKindServer = 2
+	spanKindClient = 3
+
+	spanStatusError = 2
+)
+
+const spanKey contextKey = "span"
+
+// Span is one timed operation in a trace. A nil *Span records nothing, so
+// callers need not check whether tracing is enabled.
+type Span struct {
+	tracer   *Tracer
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	name     string
+	kind     int
+	start    time.Time
+
+	mu    sync.Mutex
+	attrs map[string]any
+	err   bool
+}
+
+// SpanFromContext returns the span stored in ctx, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey).(*Span)
+	return s
+}
+
+// TraceID returns the span's trace ID in hex, or "" for a nil span.
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.traceID[:])
+}
+
+// SetAttr sets a span attribute. value must be a string, bool, or integer.
+func (s *Span) SetAttr(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.attrs[key] = value
+	s.mu.Unlock()
+}
+
+// SetError marks the span as failed.
+func (s *Span) SetError() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.err = true
+	s.mu.Unlock()
+}
+
+// End finishes the span now and queues it for export.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.tracer.enqueue(s.finish(time.Now()))
+}
+
+func (s *Span) finish(end time.Time) otlpSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	span := otlpSpan{
+		TraceID:           hex.EncodeToString(s.traceID[:]),
+		SpanID:            hex.EncodeToString(s.spanID[:]),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(end.UnixNano(), 10),
+		Attributes:        otlpAttributes(s.attrs),
+	}
+	if s.parentID != [8]byte{} {
+		span.ParentSpanID = hex.EncodeToString(s.parentID[:])
+	}
+	if s.err {
+		span.Status = &otlpStatus{Code: spanStatusError}
+	}
+	return span
+}
+
+// childSpan returns a span under the span in ctx, or nil if ctx has none.
+func childSpan(ctx context.Context, name string, kind int, start time.Time) *Span {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return nil
+	}
+	s := &Span{
+		tracer:   parent.tracer,
+		traceID:  parent.traceID,
+		parentID: parent.spanID,
+		name:     name,
+		kind:     kind,
+		start:    start,
+		attrs:    make(map[string]any),
+	}
+	_, _ = rand.Read(s.spanID[:])
+	return s
+}
+
+// recordQuerySpan records a database operation that began at start as a
+// child of the span in ctx. It is called by logSlowQuery, which every
+// adapter operation reports to.
+func recordQuerySpan(ctx context.Context, table, op string, start time.Time) {
+	name := "db " + op
+	if table != "" {
+		name += " " + table
+	}
+	s := childSpan(ctx, name, spanKindClient, start)
+	if s == nil {
+		return
+	}
+	s.attrs["db.operation.name"] = op
+	if table != "" {
+		s.attrs["db.collection.name"] = table
+	}
+	s.End()
+}
+
+// parseTraceparent parses a W3C traceparent header of the form
+// version-traceid-parentid-flags. ok is false if the header is malformed.
+func parseTraceparent(header string) (traceID [16]byte, parentID [8]byte, sampled, ok bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return traceID, parentID, false, false
+	}
+	// Version 00 has exactly four fields; later versions may append more.
+	if parts[0] == "00" && len(parts) != 4 {
+		return traceID, parentID, false, false
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return traceID, parentID, false, false
+	}
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil {
+		return traceID, parentID, false, false
+	}
+	if _, err := hex.Decode(parentID[:], []byte(parts[2])); err != nil {
+		return traceID, parentID, false, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || traceID == [16]byte{} || parentID == [8]byte{} {
+		return traceID, parentID, false, false
+	}
+	return traceID, parentID, flags[0]&1 == 1, true
+}
+
+// tracingMiddleware records a server span for each request. The span is
+// named after the route, with the collection of data routes replaced by
+// {collection} and recorded as an attribute, and is stored in the request
+// context for the spans of the database operations below it.
+func tracingMiddleware(tracer *Tracer, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := &Span{
+			tracer: tracer,
+			kind:   spanKindServer,
+			start:  time.Now(),
+			attrs:  make(map[string]any),
+		}
+		if traceID, parentID, sampled, ok := parseTraceparent(r.Header.Get("traceparent")); ok {
+			if !sampled {
+				next.ServeHTTP(w, r)
+				return
+			}
+			s.traceID, s.parentID = traceID, parentID
+		} else {
+			_, _ = rand.Read(s.traceID[:])
+		}
+		_, _ = rand.Read(s.spanID[:])
+
+		route := r.URL.Path
+		if collection := extractResource(r.URL.Path); collection != "" {
+			route = strings.Replace(route, "/data/"+collection, "/data/{collection}", 1)
+			s.attrs["moon.collection"] = collection
+		}
+		s.name = r.Method + " " + route
+		s.attrs["http.request.method"] = r.Method
+		s.attrs["http.route"] = route
+		s.attrs["url.path"] = r.URL.Path
+		if id := RequestIDFromContext(r.Context()); id != "" {
+			s.attrs["moon.request_id"] = id
+		}
+
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			status := rec.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			s.attrs["http.response.status_code"] = status
+			if status >= 500 {
+				s.err = true
+			}
+			s.End()
+		}()
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), spanKey, s)))
+	})
+}
+
+// ---------------------------------------------------------------------------
+// OTLP export
+// ---------------------------------------------------------------------------
+
+// Tracer exports ended spans to an OTLP/HTTP endpoint. Spans are queued and
+// sent in batches by one background goroutine; when the queue is full new
+// spans are dropped.
+type Tracer struct {
+	endpoint string
+	service  string
+	client   *http.Client
+	logger   *Logger
+	queue    chan otlpSpan
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+// NewTracer creates a Tracer that exports to endpoint, the full URL of the
+// collector's traces route, and starts its export goroutine. logger may be
+// nil.
+func NewTracer(endpoint, service string, logger *Logger) (*Tracer, error) {
+	if err := validateOTLPEndpoint(endpoint); err != nil {
+		return nil, err
+	}
+	t := &Tracer{
+		endpoint: endpoint,
+		service:  service,
+		client:   &http.Client{Timeout: TraceExportTimeoutSeconds * time.Second},
+		logger:   logger,
+		queue:    make(chan otlpSpan, TraceQueueSize),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go t.run()
+	return t, nil
+}
+
+// validateOTLPEndpoint checks that endpoint is an http or https URL.
+func validateOTLPEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid OTLP endpoint: must be an http or https URL")
+	}
+	return nil
+}
+
+// Close exports the spans still queued and stops the export goroutine.
+// Spans ended after Close are dropped.
+func (t *Tracer) Close() {
+	t.once.Do(func() { close(t.stop) })
+	<-t.done
+}
+
+func (t *Tracer) enqueue(span otlpSpan) {
+	select {
+	case <-t.stop:
+		return
+	default:
+	}
+	select {
+	case t.queue <- span:
+	default:
+		if t.logger != nil {
+			t.logger.Warn("span dropped: queue full", "span", span.Name)
+		}
+	}
+}
+
+func (t *Tracer) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(TraceExportIntervalSeconds * time.Second)
+	defer ticker.Stop()
+
+	var batch []otlpSpan
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.send(batch); err != nil && t.logger != nil {
+			t.logger.Warn("spans not exported", "count", len(batch), "error", err.Error())
+		}
+		batch = nil
+	}
+	for {
+		select {
+		case span := <-t.queue:
+			batch = append(batch, span)
+			if len(batch) >= TraceBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-t.stop:
+			for {
+				select {
+				case span := <-t.queue:
+					batch = append(batch, span)
+					if len(batch) >= TraceBatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// send posts one batch as an OTLP ExportTraceServiceRequest.
+func (t *Tracer) send(spans []otlpSpan) error {
+	body, err := json.Marshal(map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{
+				"attributes": otlpAttributes(map[string]any{
+					"service.name":    t.service,
+					"service.version": MoonVersion,
+				}),
+			},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]any{"name": "moon", "version": MoonVersion},
+				"spans": spans,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), TraceExportTimeoutSeconds*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+// otlpSpan is a span in the OTLP/JSON encoding.
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	Code int `json:"code"`
+}
+
+type otlpAttribute struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+// otlpAttributes encodes attrs as OTLP key-value pairs. OTLP/JSON carries
+// integers as strings.
+func otlpAttributes(attrs map[string]any) []otlpAttribute {
+	out := make([]otlpAttribute, 0, len(attrs))
+	for k, v := range attrs {
+		var value map[string]any
+		switch v := v.(type) {
+		case bool:
+			value = map[string]any{"boolValue": v}
+		case int:
+			value = map[string]any{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]any{"intValue": strconv.FormatInt(v, 10)}
+		default:
+			value = map[string]any{"stringValue": fmt.Sprint(v)}
+		}
+		out = append(out, otlpAttribute{Key: k, Value: value})
+	}
+	return out
+}
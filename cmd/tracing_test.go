@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	traceID, parentID, sampled, ok := parseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if !ok || !sampled {
+		t.Fatalf("expected a sampled traceparent, got ok=%v sampled=%v", ok, sampled)
+	}
+	if hex.EncodeToString(traceID[:]) != "4bf92f3577b34da6a3ce929d0e0e4736" || hex.EncodeToString(parentID[:]) != "00f067aa0ba902b7" {
+		t.Fatalf("unexpected ids %x %x", traceID, parentID)
+	}
+	if _, _, sampled, ok := parseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"); !ok || sampled {
+		t.Fatalf("expected an unsampled traceparent, got ok=%v sampled=%v", ok, sampled)
+	}
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		if _, _, _, ok := parseTraceparent(bad); ok {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestTracing_ExportsRequestAndQuerySpans(t *testing.T) {
+	var mu sync.Mutex
+	var spans []map[string]any
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []map[string]any `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode export: %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, rs := range body.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}))
+	defer collector.Close()
+
+	tracer, err := NewTracer(collector.URL+"/v1/traces", "moon-test", nil)
+	if err != nil {
+		t.Fatalf("NewTracer: %v", err)
+	}
+	mutate, adapter, registry := setupMutateTest(t)
+	query := NewResourceQueryHandler(adapter, registry, &AppConfig{})
+	serve := func(h http.HandlerFunc, method, target, traceparent string, body io.Reader) {
+		req := httptest.NewRequest(method, target, body)
+		req = req.WithContext(SetAuthIdentity(req.Context(), adminIdentity()))
+		req.Header.Set("traceparent", traceparent)
+		w := httptest.NewRecorder()
+		tracingMiddleware(tracer, h).ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s %s: expected 200, got %d: %s", method, target, w.Code, w.Body.String())
+		}
+	}
+
+	const sampled = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	serve(query.HandleQuery, http.MethodGet, "/data/products:query", sampled, nil)
+	serve(mutate.HandleDestroyWhere, http.MethodPost, "/data/products:destroyWhere", sampled,
+		strings.NewReader(`{"filter":{"quantity[gt]":100},"confirm_count":0}`))
+	serve(query.HandleQuery, http.MethodGet, "/data/products:query",
+		"00-11111111111111111111111111111111-00f067aa0ba902b7-00", nil)
+	tracer.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	byName := make(map[string]map[string]any)
+	for _, s := range spans {
+		if s["traceId"] != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Fatalf("unexpected span from another trace: %v", s)
+		}
+		byName[s["name"].(string)] = s
+	}
+	server := byName["GET /data/{collection}:query"]
+	if server == nil || server["parentSpanId"] != "00f067aa0ba902b7" || server["kind"] != float64(spanKindServer) {
+		t.Fatalf("missing or unexpected server span in %v", spans)
+	}
+	child := func(name string, parent map[string]any) map[string]any {
+		for _, s := range spans {
+			if s["name"] == name && parent != nil && s["parentSpanId"] == parent["spanId"] {
+				return s
+			}
+		}
+		return nil
+	}
+	if read := child("db QueryRows products", server); read == nil || read["kind"] != float64(spanKindClient) {
+		t.Fatalf("missing or unexpected query span in %v", spans)
+	}
+	if child("db DeleteWhere products", byName["POST /data/{collection}:destroyWhere"]) == nil {
+		t.Fatalf("missing write span in %v", spans)
+	}
+	attrs := map[string]any{}
+	for _, a := range server["attributes"].([]any) {
+		kv := a.(map[string]any)
+		attrs[kv["key"].(string)] = kv["value"]
+	}
+	if v := attrs["moon.collection"].(map[string]any); v["stringValue"] != "products" {
+		t.Errorf("expected moon.collection products, got %v", v)
+	}
+	if v := attrs["http.response.status_code"].(map[string]any); v["intValue"] != "200" {
+		t.Errorf("expected status 200, got %v", v)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// exampleULID is the id shown in example update items.
+const exampleULID = "01ARZ3NDEKTSV4RRFFQ69G5FAV"
+
+// withExamples adds examples to a validation error about an op=create or
+// op=update item of col, so a client can correct the request without the
+// docs: each detail naming a writable field gets a valid value for it, and
+// a "data" detail shows a minimal valid item. Errors that are not an
+// APIError, and errors about system collections, are returned unchanged.
+func withExamples(err error, col *Collection, op string) error {
+	var ae *APIError
+	if !errors.As(err, &ae) || col.System {
+		return err
+	}
+	fieldMap := buildFieldMap(col)
+	readonly := readonlyFieldsForResource(col.Name, col)
+	details := make([]ErrorDetail, 0, len(ae.Details)+1)
+	for _, d := range ae.Details {
+		if f, ok := fieldMap[d.Field]; ok && !readonly[d.Field] {
+			d.Example = exampleValue(f)
+		}
+		details = append(details, d)
+	}
+	details = append(details, ErrorDetail{
+		Field:   "data",
+		Message: fmt.Sprintf("Example of a valid %s item", op),
+		Example: exampleItem(col, op),
+	})
+	return &APIError{Code: ae.Code, Message: ae.Message, Details: details}
+}
+
+// exampleItem returns a minimal valid item of col for op. A create item
+// sets every writable field that cannot be null; an update item names a
+// record and sets the first writable field.
+func exampleItem(col *Collection, op string) map[string]any {
+	readonly := readonlyFieldsForResource(col.Name, col)
+	item := make(map[string]any)
+	if op == "update" {
+		item["id"] = exampleULID
+	}
+	for _, f := range col.Fields {
+		if readonly[f.Name] || f.Name == FieldAttributes {
+			continue
+		}
+		if op == "update" {
+			item[f.Name] = exampleValue(f)
+			break
+		}
+		if !f.Nullable {
+			item[f.Name] = exampleValue(f)
+		}
+	}
+	return item
+}
+
+// exampleValue returns a value of f's type that passes its rules.
+func exampleValue(f Field) any {
+	switch f.Type {
+	case MoonFieldTypeInteger:
+		switch {
+		case f.Rules.Min != nil:
+			return *f.Rules.Min
+		case f.Rules.Max != nil && *f.Rules.Max < 1:
+			return *f.Rules.Max
+		}
+		return int64(1)
+	case MoonFieldTypeDecimal:
+		if f.Scale > 0 {
+			return "1." + strings.Repeat("0", f.Scale)
+		}
+		return "1"
+	case MoonFieldTypeBoolean:
+		return true
+	case MoonFieldTypeDatetime:
+		return "2024-01-01T00:00:00Z"
+	case MoonFieldTypeJSON:
+		return map[string]any{}
+	case MoonFieldTypeID:
+		return exampleULID
+	}
+	if len(f.Rules.Enum) > 0 {
+		return f.Rules.Enum[0]
+	}
+	s := "example"
+	if f.Rules.MinLength != nil && len(s) < *f.Rules.MinLength {
+		s += strings.Repeat("x", *f.Rules.MinLength-len(s))
+	}
+	if f.Rules.MaxLength != nil && len(s) > *f.Rules.MaxLength {
+		s = s[:*f.Rules.MaxLength]
+	}
+	return s
+}
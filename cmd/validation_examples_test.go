@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestExampleValue_PassesFieldValidation(t *testing.T) {
+	minusFive, three, twenty := int64(-5), 3, 20
+	fields := []Field{
+		{Name: "s", Type: MoonFieldTypeString},
+		{Name: "s_long", Type: MoonFieldTypeString, Rules: FieldRules{MinLength: &twenty}},
+		{Name: "s_short", Type: MoonFieldTypeString, Rules: FieldRules{MaxLength: &three}},
+		{Name: "s_enum", Type: MoonFieldTypeString, Rules: FieldRules{Enum: []string{"draft", "live"}}},
+		{Name: "i", Type: MoonFieldTypeInteger},
+		{Name: "i_neg", Type: MoonFieldTypeInteger, Rules: FieldRules{Max: &minusFive}},
+		{Name: "d", Type: MoonFieldTypeDecimal, Precision: 6, Scale: 2},
+		{Name: "b", Type: MoonFieldTypeBoolean},
+		{Name: "t", Type: MoonFieldTypeDatetime},
+		{Name: "j", Type: MoonFieldTypeJSON},
+	}
+	fieldMap := make(map[string]Field, len(fields))
+	for _, f := range fields {
+		fieldMap[f.Name] = f
+	}
+	for _, f := range fields {
+		t.Run(f.Name, func(t *testing.T) {
+			// Examples reach clients as JSON, so check the decoded value.
+			raw, err := json.Marshal(exampleValue(f))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var v any
+			if err := json.Unmarshal(raw, &v); err != nil {
+				t.Fatal(err)
+			}
+			if err := validateFieldTypes(map[string]any{f.Name: v}, fieldMap); err != nil {
+				t.Errorf("example %s rejected: %v", raw, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,505 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aquaflamingo/moon/internal/wasmrt"
+	"github.com/tetratelabs/wazero/api"
+)
+
+// CollectionValidator is an admin-managed WebAssembly module that accepts
+// or rejects every record written to a collection. Module is the base64
+// module binary; it is accepted on op=set and never returned.
+type CollectionValidator struct {
+	ID         string `json:"id"`
+	Collection string `json:"collection"`
+	Module     string `json:"module,omitempty"`
+	SHA256     string `json:"sha256"`
+	Size       int64  `json:"size"`
+	CreatedAt  string `json:"created_at"`
+	UpdatedAt  string `json:"updated_at"`
+}
+
+func collectionValidatorFromRow(row map[string]any) CollectionValidator {
+	size, _ := toInt64(row["size"])
+	return CollectionValidator{
+		ID:         stringVal(row, "id"),
+		Collection: stringVal(row, "collection"),
+		SHA256:     stringVal(row, "sha256"),
+		Size:       size,
+		CreatedAt:  stringVal(row, "created_at"),
+		UpdatedAt:  stringVal(row, "updated_at"),
+	}
+}
+
+// findValidator returns the validator of collection without its module,
+// or nil when none exists.
+func findValidator(ctx context.Context, db DatabaseAdapter, collection string) (*CollectionValidator, error) {
+	rows, _, err := db.QueryRows(ctx, ValidatorsTable, QueryOptions{
+		Filters: []Filter{{Field: "collection", Op: "eq", Value: collection}},
+		Fields:  []string{"id", "collection", "sha256", "size", "created_at", "updated_at"},
+		Page:    1,
+		PerPage: 1,
+	})
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	v := collectionValidatorFromRow(rows[0])
+	return &v, nil
+}
+
+// removeCollectionValidator deletes the validator of collection. It is
+// called when the collection is destroyed so a later collection with the
+// same name does not inherit it.
+func removeCollectionValidator(ctx context.Context, db DatabaseAdapter, collection string) error {
+	v, err := findValidator(ctx, db, collection)
+	if err != nil || v == nil {
+		return err
+	}
+	return db.DeleteRow(ctx, ValidatorsTable, v.ID)
+}
+
+// renameCollectionValidator moves the validator of from to the collection
+// to. It is called when a collection is renamed.
+func renameCollectionValidator(ctx context.Context, db DatabaseAdapter, from, to string) error {
+	v, err := findValidator(ctx, db, from)
+	if err != nil || v == nil {
+		return err
+	}
+	return db.UpdateRow(ctx, ValidatorsTable, v.ID, map[string]any{"collection": to})
+}
+
+// ---------------------------------------------------------------------------
+// Running validators
+// ---------------------------------------------------------------------------
+
+// A validator module exports its memory as "memory" and two functions:
+//
+//	alloc(len i32) i32             reserves len bytes for the input
+//	validate(ptr i32, len i32) i64 checks the input at ptr
+//
+// The input is the JSON object {"op", "collection", "record"}. validate
+// returns the address of its JSON result in the high 32 bits and the
+// length in the low 32 bits. The result is {"valid": bool, "errors":
+// [string]}.
+const (
+	validatorExportMemory   = "memory"
+	validatorExportAlloc    = "alloc"
+	validatorExportValidate = "validate"
+)
+
+// validatorInput is the JSON document passed to a validator.
+type validatorInput struct {
+	Op         string         `json:"op"`
+	Collection string         `json:"collection"`
+	Record     map[string]any `json:"record"`
+}
+
+// validatorOutput is the JSON document a validator returns.
+type validatorOutput struct {
+	Valid  *bool    `json:"valid"`
+	Errors []string `json:"errors"`
+}
+
+// compileValidator validates and compiles a validator module.
+func compileValidator(ctx context.Context, bin []byte) (*wasmrt.Module, error) {
+	return wasmrt.Compile(ctx, bin, ValidatorMaxMemoryPages)
+}
+
+// checkValidatorExports reports whether m has the exports a validator
+// needs, with the expected signatures.
+func checkValidatorExports(m *wasmrt.Module) error {
+	if !m.ExportsMemory(validatorExportMemory) {
+		return fmt.Errorf("module must export its memory as %q", validatorExportMemory)
+	}
+	want := map[string][2][]api.ValueType{
+		validatorExportAlloc:    {{wasmrt.I32}, {wasmrt.I32}},
+		validatorExportValidate: {{wasmrt.I32, wasmrt.I32}, {wasmrt.I64}},
+	}
+	for _, name := range []string{validatorExportAlloc, validatorExportValidate} {
+		if !m.ExportsFunc(name, want[name][0], want[name][1]) {
+			return fmt.Errorf("module must export function %q with the validator signature", name)
+		}
+	}
+	return nil
+}
+
+// runValidator runs a compiled validator on one record in a fresh
+// instance and returns the messages of a rejection, or nil when the
+// record is accepted. The run is stopped after ValidatorTimeoutMs.
+func runValidator(ctx context.Context, m *wasmrt.Module, op, collection string, record map[string]any) ([]string, error) {
+	input, err := json.Marshal(validatorInput{Op: op, Collection: collection, Record: record})
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, ValidatorTimeoutMs*time.Millisecond)
+	defer cancel()
+	in, err := m.Instantiate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close(context.Background())
+
+	res, err := in.Call(ctx, validatorExportAlloc, uint64(len(input)))
+	if err != nil {
+		return nil, err
+	}
+	ptr := uint32(res[0])
+	if err := in.Write(validatorExportMemory, ptr, input); err != nil {
+		return nil, errors.New("validator: alloc returned memory out of bounds")
+	}
+
+	res, err = in.Call(ctx, validatorExportValidate, uint64(ptr), uint64(len(input)))
+	if err != nil {
+		return nil, err
+	}
+	outPtr, outLen := uint32(res[0]>>32), uint32(res[0])
+	if outLen > MaxValidatorOutputBytes {
+		return nil, fmt.Errorf("validator: result exceeds %d bytes", MaxValidatorOutputBytes)
+	}
+	result, err := in.Read(validatorExportMemory, outPtr, outLen)
+	if err != nil {
+		return nil, errors.New("validator: result out of bounds")
+	}
+	var out validatorOutput
+	if err := json.Unmarshal(result, &out); err != nil || out.Valid == nil {
+		return nil, errors.New("validator: result is not a valid result object")
+	}
+	if *out.Valid {
+		return nil, nil
+	}
+	if len(out.Errors) == 0 {
+		return []string{"record is invalid"}, nil
+	}
+	return out.Errors, nil
+}
+
+// validatorRejection formats the client message for a rejected record.
+func validatorRejection(messages []string) string {
+	return "Record rejected by validator: " + strings.Join(messages, "; ")
+}
+
+// ValidatorStore runs the validators attached to collections. Validators
+// are looked up on every write, so a change made through any instance
+// applies at once; compiled modules are cached by collection and content
+// hash. A replaced module is left to the garbage collector rather than
+// closed, as runs may still be using it. A nil *ValidatorStore accepts
+// every record.
+type ValidatorStore struct {
+	db     DatabaseAdapter
+	logger *Logger
+
+	mu      sync.Mutex
+	modules map[string]cachedValidator
+}
+
+type cachedValidator struct {
+	sha    string
+	module *wasmrt.Module
+}
+
+// NewValidatorStore creates a ValidatorStore. logger may be nil.
+func NewValidatorStore(db DatabaseAdapter, logger *Logger) *ValidatorStore {
+	return &ValidatorStore{db: db, logger: logger, modules: make(map[string]cachedValidator)}
+}
+
+// Lookup returns the compiled validator of collection, or nil when it has
+// none. Errors are logged.
+func (s *ValidatorStore) Lookup(ctx context.Context, collection string) (*wasmrt.Module, error) {
+	if s == nil {
+		return nil, nil
+	}
+	m, err := s.lookup(ctx, collection)
+	if err != nil && s.logger != nil {
+		s.logger.Error("validator lookup failed", "collection", collection, "error", err.Error())
+	}
+	return m, err
+}
+
+func (s *ValidatorStore) lookup(ctx context.Context, collection string) (*wasmrt.Module, error) {
+	v, err := findValidator(ctx, s.db, collection)
+	if err != nil || v == nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	cached, ok := s.modules[collection]
+	s.mu.Unlock()
+	if ok && cached.sha == v.SHA256 {
+		return cached.module, nil
+	}
+
+	rows, _, err := s.db.QueryRows(ctx, ValidatorsTable, QueryOptions{
+		Filters: []Filter{{Field: "id", Op: "eq", Value: v.ID}},
+		Fields:  []string{"module", "sha256"},
+		Page:    1,
+		PerPage: 1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	bin, err := base64.StdEncoding.DecodeString(stringVal(rows[0], "module"))
+	if err != nil {
+		return nil, fmt.Errorf("validator for %s: %w", collection, err)
+	}
+	m, err := compileValidator(ctx, bin)
+	if err != nil {
+		return nil, fmt.Errorf("validator for %s: %w", collection, err)
+	}
+
+	s.mu.Lock()
+	s.modules[collection] = cachedValidator{sha: stringVal(rows[0], "sha256"), module: m}
+	s.mu.Unlock()
+	return m, nil
+}
+
+// Run runs m, as returned by Lookup, on record. A validator that fails to
+// run is logged and reported as an error, so the write is refused.
+func (s *ValidatorStore) Run(ctx context.Context, m *wasmrt.Module, op, collection string, record map[string]any) ([]string, error) {
+	if m == nil {
+		return nil, nil
+	}
+	messages, err := runValidator(ctx, m, op, collection, record)
+	if err != nil && s.logger != nil {
+		s.logger.Error("validator failed", "collection", collection, "error", err.Error())
+	}
+	return messages, err
+}
+
+// Check runs the validator of collection, if any, on record and returns
+// the messages of a rejection.
+func (s *ValidatorStore) Check(ctx context.Context, op, collection string, record map[string]any) ([]string, error) {
+	m, err := s.Lookup(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+	return s.Run(ctx, m, op, collection, record)
+}
+
+// ---------------------------------------------------------------------------
+// Admin API
+// ---------------------------------------------------------------------------
+
+// AdminValidatorHandler implements GET /admin:validators and
+// POST /admin:validators for managing collection validators.
+type AdminValidatorHandler struct {
+	db       DatabaseAdapter
+	registry *SchemaRegistry
+	logger   *Logger
+	audit    *AuditLog
+}
+
+// NewAdminValidatorHandler creates an AdminValidatorHandler. logger may be
+// nil.
+func NewAdminValidatorHandler(db DatabaseAdapter, registry *SchemaRegistry, logger *Logger) *AdminValidatorHandler {
+	return &AdminValidatorHandler{db: db, registry: registry, logger: logger}
+}
+
+// SetAuditLog records each validator change in audit.
+func (h *AdminValidatorHandler) SetAuditLog(audit *AuditLog) {
+	h.audit = audit
+}
+
+// adminValidatorMutateRequest is the JSON body for POST /admin:validators.
+type adminValidatorMutateRequest struct {
+	Op   string                `json:"op"`
+	Data []CollectionValidator `json:"data"`
+}
+
+// HandleQuery lists the validators ordered by collection, without their
+// modules.
+func (h *AdminValidatorHandler) HandleQuery(w http.ResponseWriter, r *http.Request) {
+	identity, ok := GetAuthIdentity(r.Context())
+	if !ok || identity.Role != "admin" {
+		WriteError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	ctx := r.Context()
+	data := make([]any, 0)
+	for page := 1; ; page++ {
+		rows, _, err := h.db.QueryRows(ctx, ValidatorsTable, QueryOptions{
+			Fields:  []string{"id", "collection", "sha256", "size", "created_at", "updated_at"},
+			Sort:    []SortField{{Field: "collection"}},
+			Page:    page,
+			PerPage: MaxPerPage,
+		})
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		for _, row := range rows {
+			data = append(data, collectionValidatorFromRow(row))
+		}
+		if len(rows) < MaxPerPage {
+			break
+		}
+	}
+	meta := map[string]any{"total": len(data)}
+
+	WriteSuccessFull(w, http.StatusOK, "Validators retrieved successfully", data, meta, nil)
+}
+
+// HandleMutate sets or destroys validators by collection. op=set attaches
+// a module to a collection or replaces its module; op=destroy detaches
+// it.
+func (h *AdminValidatorHandler) HandleMutate(w http.ResponseWriter, r *http.Request) {
+	identity, ok := GetAuthIdentity(r.Context())
+	if !ok || identity.Role != "admin" {
+		WriteError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, MaxValidatorModuleBytes*2)
+	var req adminValidatorMutateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Op != "set" && req.Op != "destroy" {
+		WriteError(w, http.StatusBadRequest, "Invalid op: must be set or destroy")
+		return
+	}
+	if len(req.Data) == 0 {
+		WriteError(w, http.StatusBadRequest, "Missing required field: data")
+		return
+	}
+	modules := make([][]byte, len(req.Data))
+	for i, v := range req.Data {
+		bin, err := h.validateValidator(r.Context(), v, req.Op == "set")
+		if err != nil {
+			WriteErrorFrom(w, http.StatusBadRequest, err)
+			return
+		}
+		modules[i] = bin
+	}
+
+	ctx := r.Context()
+	results := make([]any, 0, len(req.Data))
+	success, failed := 0, 0
+	for i, v := range req.Data {
+		existing, err := findValidator(ctx, h.db, v.Collection)
+		if err != nil {
+			failed++
+			continue
+		}
+		if req.Op == "set" {
+			saved, err := h.save(ctx, v.Collection, modules[i], existing)
+			if err != nil {
+				failed++
+				continue
+			}
+			results = append(results, saved)
+		} else {
+			if existing == nil || h.db.DeleteRow(ctx, ValidatorsTable, existing.ID) != nil {
+				failed++
+				continue
+			}
+			results = append(results, map[string]any{"collection": v.Collection})
+		}
+		success++
+		if h.logger != nil {
+			h.logger.AuditEventContext(r.Context(), AuditPrivilegedMutation,
+				"action", "validator."+req.Op,
+				"actor", identity.CallerID,
+				"target", v.Collection,
+				"timestamp", time.Now().UTC().Format(time.RFC3339),
+			)
+		}
+		h.audit.Record(ctx, AuditEntry{
+			Event:      AuditPrivilegedMutation,
+			Actor:      identity.CallerID,
+			Action:     "validator." + req.Op,
+			Collection: v.Collection,
+			RecordID:   v.Collection,
+			RequestID:  requestID(w),
+		})
+	}
+
+	meta := map[string]any{"success": success, "failed": failed}
+	WriteSuccessFull(w, http.StatusOK, "Validators updated successfully", results, meta, nil)
+}
+
+// save stores bin as the validator of collection, replacing existing when
+// the collection already has one.
+func (h *AdminValidatorHandler) save(ctx context.Context, collection string, bin []byte, existing *CollectionValidator) (CollectionValidator, error) {
+	sum := sha256.Sum256(bin)
+	now := time.Now().UTC().Format(time.RFC3339)
+	v := CollectionValidator{
+		Collection: collection,
+		SHA256:     hex.EncodeToString(sum[:]),
+		Size:       int64(len(bin)),
+		UpdatedAt:  now,
+	}
+	module := base64.StdEncoding.EncodeToString(bin)
+	if existing != nil {
+		v.ID, v.CreatedAt = existing.ID, existing.CreatedAt
+		return v, h.db.UpdateRow(ctx, ValidatorsTable, v.ID, map[string]any{
+			"module":     module,
+			"sha256":     v.SHA256,
+			"size":       v.Size,
+			"updated_at": now,
+		})
+	}
+	v.ID, v.CreatedAt = GenerateULID(), now
+	return v, h.db.InsertRow(ctx, ValidatorsTable, map[string]any{
+		"id":         v.ID,
+		"collection": v.Collection,
+		"module":     module,
+		"sha256":     v.SHA256,
+		"size":       v.Size,
+		"created_at": now,
+		"updated_at": now,
+	})
+}
+
+// validateValidator checks the collection and, for op=set, decodes and
+// compiles the module and checks its exports. It returns the module
+// binary.
+func (h *AdminValidatorHandler) validateValidator(ctx context.Context, v CollectionValidator, full bool) ([]byte, error) {
+	if v.Collection == "" {
+		return nil, fmt.Errorf("Missing required field: data.collection")
+	}
+	if !full {
+		return nil, nil
+	}
+	col, ok := h.registry.Get(v.Collection)
+	if !ok {
+		return nil, fmt.Errorf("Collection '%s' not found", v.Collection)
+	}
+	if col.System {
+		return nil, fmt.Errorf("Validators are not supported for '%s'", v.Collection)
+	}
+	if v.Module == "" {
+		return nil, fmt.Errorf("Missing required field: data.module")
+	}
+	bin, err := base64.StdEncoding.DecodeString(v.Module)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid module: must be base64")
+	}
+	if len(bin) > MaxValidatorModuleBytes {
+		return nil, fmt.Errorf("Module exceeds %d bytes", MaxValidatorModuleBytes)
+	}
+	m, err := compileValidator(ctx, bin)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid module: %v", err)
+	}
+	defer m.Close(ctx)
+	if err := checkValidatorExports(m); err != nil {
+		return nil, fmt.Errorf("Invalid module: %v", err)
+	}
+	return bin, nil
+}
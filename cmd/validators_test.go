@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aquaflamingo/moon/internal/wasmrt"
+	"github.com/aquaflamingo/moon/internal/wasmrt/wasmtest"
+	"github.com/tetratelabs/wazero/api"
+)
+
+// shoutValidatorModule assembles a validator that rejects any input
+// containing '!' and accepts everything else.
+func shoutValidatorModule() []byte {
+	reject := `{"valid":false,"errors":["no shouting"]}`
+	accept := `{"valid":true}`
+	const rejectAt, acceptAt = 0, 256
+	packed := func(at, n int) []byte { return append([]byte{0x42}, wasmtest.SLEB(int64(at)<<32|int64(n))...) }
+	segment := func(at int, s string) []byte {
+		b := append([]byte{0x00, 0x41}, wasmtest.SLEB(int64(at))...)
+		b = append(append(b, 0x0B), wasmtest.ULEB(uint64(len(s)))...)
+		return append(b, s...)
+	}
+
+	alloc := wasmtest.Code(0, append([]byte{0x41}, wasmtest.SLEB(1024)...), []byte{0x0B})
+	validate := wasmtest.Code(1,
+		[]byte{0x02, 0x40, 0x03, 0x40},                         // block; loop
+		[]byte{0x20, 0x02, 0x20, 0x01, 0x4F, 0x0D, 0x01},       // i >= len: br_if 1
+		[]byte{0x20, 0x00, 0x20, 0x02, 0x6A, 0x2D, 0x00, 0x00}, // i32.load8_u ptr+i
+		[]byte{0x41, 0x21, 0x46, 0x04, 0x40},                   // == '!': if
+		packed(rejectAt, len(reject)),
+		[]byte{0x0F, 0x0B},                               // return; end
+		[]byte{0x20, 0x02, 0x41, 0x01, 0x6A, 0x21, 0x02}, // i++
+		[]byte{0x0C, 0x00, 0x0B, 0x0B},                   // br 0; end; end
+		packed(acceptAt, len(accept)),
+		[]byte{0x0B},
+	)
+	return wasmtest.Module{
+		Types: [][]byte{
+			wasmtest.FuncType([]api.ValueType{wasmrt.I32}, []api.ValueType{wasmrt.I32}),
+			wasmtest.FuncType([]api.ValueType{wasmrt.I32, wasmrt.I32}, []api.ValueType{wasmrt.I64}),
+		},
+		Codes:  [][]byte{alloc, validate},
+		Memory: []byte{0x00, 0x01},
+		Exports: [][]byte{
+			wasmtest.Export("memory", wasmtest.ExportMemory, 0),
+			wasmtest.Export("alloc", wasmtest.ExportFunc, 0),
+			wasmtest.Export("validate", wasmtest.ExportFunc, 1),
+		},
+		Data: [][]byte{segment(rejectAt, reject), segment(acceptAt, accept)},
+	}.Bytes()
+}
+
+func doAdminValidatorMutate(t *testing.T, h *AdminValidatorHandler, body any, identity *AuthIdentity) *httptest.ResponseRecorder {
+	t.Helper()
+	b, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, "/admin:validators", strings.NewReader(string(b)))
+	req = req.WithContext(SetAuthIdentity(req.Context(), identity))
+	w := httptest.NewRecorder()
+	h.HandleMutate(w, req)
+	return w
+}
+
+func TestRunValidator(t *testing.T) {
+	ctx := context.Background()
+	m, err := compileValidator(ctx, shoutValidatorModule())
+	if err != nil {
+		t.Fatalf("compileValidator: %v", err)
+	}
+	defer m.Close(ctx)
+	if err := checkValidatorExports(m); err != nil {
+		t.Fatalf("checkValidatorExports: %v", err)
+	}
+	messages, err := runValidator(ctx, m, "create", "products", map[string]any{"title": "Lamp"})
+	if err != nil || messages != nil {
+		t.Fatalf("expected the record to be accepted, got %v, %v", messages, err)
+	}
+	messages, err = runValidator(ctx, m, "create", "products", map[string]any{"title": "Lamp!"})
+	if err != nil || len(messages) != 1 || messages[0] != "no shouting" {
+		t.Fatalf("expected the record to be rejected, got %v, %v", messages, err)
+	}
+}
+
+func TestRunValidator_Timeout(t *testing.T) {
+	spin := wasmtest.Module{
+		Types: [][]byte{
+			wasmtest.FuncType([]api.ValueType{wasmrt.I32}, []api.ValueType{wasmrt.I32}),
+			wasmtest.FuncType([]api.ValueType{wasmrt.I32, wasmrt.I32}, []api.ValueType{wasmrt.I64}),
+		},
+		Codes: [][]byte{
+			wasmtest.Code(0, []byte{0x41, 0x00, 0x0B}),                               // i32.const 0
+			wasmtest.Code(0, []byte{0x03, 0x40, 0x0C, 0x00, 0x0B, 0x42, 0x00, 0x0B}), // loop br 0 end; i64.const 0
+		},
+		Memory: []byte{0x00, 0x01},
+		Exports: [][]byte{
+			wasmtest.Export("memory", wasmtest.ExportMemory, 0),
+			wasmtest.Export("alloc", wasmtest.ExportFunc, 0),
+			wasmtest.Export("validate", wasmtest.ExportFunc, 1),
+		},
+	}.Bytes()
+	ctx := context.Background()
+	m, err := compileValidator(ctx, spin)
+	if err != nil {
+		t.Fatalf("compileValidator: %v", err)
+	}
+	defer m.Close(ctx)
+	if _, err := runValidator(ctx, m, "create", "products", map[string]any{}); err == nil {
+		t.Fatal("expected a validator that never returns to be stopped")
+	}
+}
+
+func TestAdminValidators_SetQueryDestroy(t *testing.T) {
+	_, adapter, registry := setupMutateTest(t)
+	h := NewAdminValidatorHandler(adapter, registry, nil)
+	module := shoutValidatorModule()
+
+	set := map[string]any{"op": "set", "data": []any{map[string]any{
+		"collection": "products",
+		"module":     base64.StdEncoding.EncodeToString(module),
+	}}}
+	w := doAdminValidatorMutate(t, h, set, adminIdentity())
+	if w.Code != http.StatusOK {
+		t.Fatalf("set: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin:validators", nil)
+	req = req.WithContext(SetAuthIdentity(req.Context(), adminIdentity()))
+	w = httptest.NewRecorder()
+	h.HandleQuery(w, req)
+	data := decodeResponse(t, w)["data"].([]any)
+	sum := sha256.Sum256(module)
+	if len(data) != 1 {
+		t.Fatalf("expected one validator, got %v", data)
+	}
+	v := data[0].(map[string]any)
+	if v["collection"] != "products" || v["sha256"] != hex.EncodeToString(sum[:]) || v["size"] != float64(len(module)) {
+		t.Errorf("unexpected validator %v", v)
+	}
+	if _, ok := v["module"]; ok {
+		t.Error("expected the module to be left out of the listing")
+	}
+
+	destroy := map[string]any{"op": "destroy", "data": []any{map[string]any{"collection": "products"}}}
+	w = doAdminValidatorMutate(t, h, destroy, adminIdentity())
+	if meta := decodeResponse(t, w)["meta"].(map[string]any); meta["success"] != float64(1) {
+		t.Fatalf("expected destroy to succeed, meta %v", meta)
+	}
+	if v, err := findValidator(context.Background(), adapter, "products"); err != nil || v != nil {
+		t.Fatalf("expected no validator after destroy, got %v, %v", v, err)
+	}
+}
+
+func TestAdminValidators_Validation(t *testing.T) {
+	_, adapter, registry := setupMutateTest(t)
+	h := NewAdminValidatorHandler(adapter, registry, nil)
+
+	noExports := wasmtest.Module{
+		Types: [][]byte{wasmtest.FuncType(nil, nil)},
+		Codes: [][]byte{wasmtest.Code(0, []byte{0x0B})},
+	}.Bytes()
+	module := base64.StdEncoding.EncodeToString(shoutValidatorModule())
+	tests := []struct {
+		name       string
+		collection string
+		module     string
+	}{
+		{"missing collection", "", module},
+		{"unknown collection", "missing", module},
+		{"system collection", "users", module},
+		{"missing module", "products", ""},
+		{"not base64", "products", "%%%"},
+		{"not wasm", "products", base64.StdEncoding.EncodeToString([]byte("hello"))},
+		{"missing exports", "products", base64.StdEncoding.EncodeToString(noExports)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := map[string]any{"collection": tt.collection, "module": tt.module}
+			w := doAdminValidatorMutate(t, h, map[string]any{"op": "set", "data": []any{item}}, adminIdentity())
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+
+	item := map[string]any{"collection": "products", "module": module}
+	w := doAdminValidatorMutate(t, h, map[string]any{"op": "set", "data": []any{item}}, userWriteIdentity())
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a non-admin, got %d", w.Code)
+	}
+}
+
+func TestResourceMutate_Validator(t *testing.T) {
+	handler, adapter, registry := setupMutateTest(t)
+	handler.SetValidators(NewValidatorStore(adapter, nil))
+	ah := NewAdminValidatorHandler(adapter, registry, nil)
+	set := map[string]any{"op": "set", "data": []any{map[string]any{
+		"collection": "products",
+		"module":     base64.StdEncoding.EncodeToString(shoutValidatorModule()),
+	}}}
+	if w := doAdminValidatorMutate(t, ah, set, adminIdentity()); w.Code != http.StatusOK {
+		t.Fatalf("set: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	create := map[string]any{"op": "create", "data": []any{map[string]any{"title": "Lamp", "price": "9.99"}}}
+	w := doMutateRequest(t, handler, "products", create, adminIdentity())
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	id := decodeResponse(t, w)["data"].([]any)[0].(map[string]any)["id"].(string)
+
+	create = map[string]any{"op": "create", "data": []any{map[string]any{"title": "Lamp!", "price": "9.99"}}}
+	w = doMutateRequest(t, handler, "products", create, adminIdentity())
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "Record rejected by validator: no shouting") {
+		t.Fatalf("create: expected a validator rejection, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// An update is checked against the whole record after the change.
+	update := map[string]any{"op": "update", "data": []any{map[string]any{"id": id, "description": "Bright!"}}}
+	w = doMutateRequest(t, handler, "products", update, adminIdentity())
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("update: expected a validator rejection, got %d: %s", w.Code, w.Body.String())
+	}
+	update = map[string]any{"op": "update", "data": []any{map[string]any{"id": id, "description": "Bright"}}}
+	w = doMutateRequest(t, handler, "products", update, adminIdentity())
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+}
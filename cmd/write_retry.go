@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// transientDBErrors are fragments of driver error messages for failures
+// that a later attempt of the same write can succeed at: SQLite busy and
+// locked errors, PostgreSQL serialization failures and deadlocks, and
+// MySQL deadlocks and lock wait timeouts.
+var transientDBErrors = []string{
+	"database is locked",
+	"database table is locked",
+	"could not serialize access",
+	"deadlock detected",
+	"deadlock found",
+	"lock wait timeout exceeded",
+}
+
+// isTransientDBError reports whether err is a transient database error.
+func isTransientDBError(err error) bool {
+	for _, msg := range errorMessages(err) {
+		lower := strings.ToLower(msg)
+		for _, fragment := range transientDBErrors {
+			if strings.Contains(lower, fragment) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeRetrier retries writes that fail with a transient database error,
+// with jittered exponential backoff and a shared retry budget. The zero
+// value is not ready for use; call newWriteRetrier.
+type writeRetrier struct {
+	mu     sync.Mutex
+	tokens float64
+
+	retries   atomic.Int64 // retry attempts made
+	recovered atomic.Int64 // writes that succeeded after a retry
+	exhausted atomic.Int64 // writes that failed on their last attempt
+	throttled atomic.Int64 // retries skipped because the budget was empty
+}
+
+// newWriteRetrier creates a writeRetrier with a full retry budget.
+func newWriteRetrier() *writeRetrier {
+	return &writeRetrier{tokens: WriteRetryBudgetMax}
+}
+
+// do runs write, retrying it while it fails with a transient error. write
+// must leave nothing behind when it fails, such as a transaction that
+// rolls back, so a retry starts from the same state. do gives up when ctx
+// is done and returns the last error.
+func (r *writeRetrier) do(ctx context.Context, write func() error) error {
+	r.earn()
+	for attempt := 1; ; attempt++ {
+		err := write()
+		if err == nil {
+			if attempt > 1 {
+				r.recovered.Add(1)
+			}
+			return nil
+		}
+		if !isTransientDBError(err) {
+			return err
+		}
+		if attempt == WriteRetryMaxAttempts {
+			r.exhausted.Add(1)
+			return err
+		}
+		if !r.spend() {
+			r.throttled.Add(1)
+			return err
+		}
+		r.retries.Add(1)
+
+		timer := time.NewTimer(retryDelay(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// retryDelay returns the jittered delay before retry attempt, counting
+// from 1.
+func retryDelay(attempt int) time.Duration {
+	ceiling := min(WriteRetryBaseDelayMs<<(attempt-1), WriteRetryMaxDelayMs)
+	return time.Duration(rand.Int64N(int64(ceiling)*int64(time.Millisecond) + 1))
+}
+
+// earn adds the retry tokens one write is worth.
+func (r *writeRetrier) earn() {
+	r.mu.Lock()
+	r.tokens = min(r.tokens+WriteRetryBudgetRatio, WriteRetryBudgetMax)
+	r.mu.Unlock()
+}
+
+// spend takes one retry token, reporting false when none is left.
+func (r *writeRetrier) spend() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.tokens < 1 {
+		return false
+	}
+	r.tokens--
+	return true
+}
+
+// stats returns the retry counters for /admin:diagnostics.
+func (r *writeRetrier) stats() map[string]int64 {
+	return map[string]int64{
+		"retries":   r.retries.Load(),
+		"recovered": r.recovered.Load(),
+		"exhausted": r.exhausted.Load(),
+		"throttled": r.throttled.Load(),
+	}
+}
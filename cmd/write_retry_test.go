@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+var errLocked = errors.New("database is locked")
+
+func TestIsTransientDBError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{errLocked, true},
+		{newAdapterError("InsertRow", "products", "insert failed", errLocked), true},
+		{errors.New("database table is locked: products"), true},
+		{errors.New("pq: could not serialize access due to concurrent update"), true},
+		{errors.New("ERROR: deadlock detected (SQLSTATE 40P01)"), true},
+		{errors.New("Error 1213: Deadlock found when trying to get lock"), true},
+		{errors.New("UNIQUE constraint failed: products.title"), false},
+		{ErrNoRowAffected, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := isTransientDBError(tt.err); got != tt.want {
+			t.Errorf("isTransientDBError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestWriteRetrier_Recovers(t *testing.T) {
+	r := newWriteRetrier()
+	calls := 0
+	err := r.do(context.Background(), func() error {
+		calls++
+		if calls < 3 {
+			return fmt.Errorf("insert failed: %w", errLocked)
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Fatalf("expected success on the third attempt, got err=%v after %d calls", err, calls)
+	}
+	if stats := r.stats(); stats["retries"] != 2 || stats["recovered"] != 1 || stats["exhausted"] != 0 {
+		t.Errorf("unexpected stats: %v", stats)
+	}
+}
+
+func TestWriteRetrier_GivesUp(t *testing.T) {
+	r := newWriteRetrier()
+
+	calls := 0
+	unique := errors.New("UNIQUE constraint failed: products.title")
+	if err := r.do(context.Background(), func() error { calls++; return unique }); err != unique || calls != 1 {
+		t.Fatalf("expected a non-transient error to be returned at once, got %v after %d calls", err, calls)
+	}
+
+	calls = 0
+	if err := r.do(context.Background(), func() error { calls++; return errLocked }); err != errLocked || calls != WriteRetryMaxAttempts {
+		t.Fatalf("expected %d attempts, got %d (err=%v)", WriteRetryMaxAttempts, calls, err)
+	}
+	if stats := r.stats(); stats["exhausted"] != 1 {
+		t.Errorf("expected one exhausted write, got %v", stats)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls = 0
+	if err := r.do(ctx, func() error { calls++; return errLocked }); err != errLocked || calls != 1 {
+		t.Fatalf("expected a cancelled context to stop retries, got %d calls", calls)
+	}
+}
+
+func TestWriteRetrier_Budget(t *testing.T) {
+	r := newWriteRetrier()
+	r.tokens = 0
+
+	calls := 0
+	if err := r.do(context.Background(), func() error { calls++; return errLocked }); err != errLocked || calls != 1 {
+		t.Fatalf("expected no retry with an empty budget, got %d calls", calls)
+	}
+	if stats := r.stats(); stats["throttled"] != 1 || stats["retries"] != 0 {
+		t.Errorf("unexpected stats: %v", stats)
+	}
+}
@@ -0,0 +1,132 @@
+// Package wasmrt runs untrusted WebAssembly modules in the wazero
+// interpreter. A module is fully validated when it is compiled, may not
+// import anything, and runs each call in a fresh instance whose memory is
+// capped and whose execution stops when its context is done.
+package wasmrt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+)
+
+// Value types of function parameters and results.
+const (
+	I32 = api.ValueTypeI32
+	I64 = api.ValueTypeI64
+	F32 = api.ValueTypeF32
+	F64 = api.ValueTypeF64
+)
+
+// Features are the WebAssembly features a module may use: WebAssembly
+// 1.0 with the sign-extension, non-trapping float-to-int, and bulk memory
+// extensions.
+const Features = api.CoreFeaturesV1 |
+	api.CoreFeatureSignExtensionOps |
+	api.CoreFeatureNonTrappingFloatToIntConversion |
+	api.CoreFeatureBulkMemoryOperations
+
+// Module is a compiled module. It is safe for concurrent use.
+type Module struct {
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+}
+
+// Compile validates bin and compiles it. Memory may grow to at most
+// maxPages 64 KiB pages.
+func Compile(ctx context.Context, bin []byte, maxPages uint32) (*Module, error) {
+	cfg := wazero.NewRuntimeConfigInterpreter().
+		WithCoreFeatures(Features).
+		WithMemoryLimitPages(maxPages).
+		WithCloseOnContextDone(true)
+	rt := wazero.NewRuntimeWithConfig(ctx, cfg)
+	compiled, err := rt.CompileModule(ctx, bin)
+	if err != nil {
+		rt.Close(ctx)
+		return nil, err
+	}
+	if len(compiled.ImportedFunctions()) > 0 || len(compiled.ImportedMemories()) > 0 {
+		rt.Close(ctx)
+		return nil, errors.New("module may not import anything")
+	}
+	return &Module{runtime: rt, compiled: compiled}, nil
+}
+
+// Close releases the module. Instances still running are closed too.
+func (m *Module) Close(ctx context.Context) error {
+	return m.runtime.Close(ctx)
+}
+
+// ExportsMemory reports whether the module exports a memory as name.
+func (m *Module) ExportsMemory(name string) bool {
+	_, ok := m.compiled.ExportedMemories()[name]
+	return ok
+}
+
+// ExportsFunc reports whether the module exports a function as name with
+// the given parameter and result types.
+func (m *Module) ExportsFunc(name string, params, results []api.ValueType) bool {
+	def, ok := m.compiled.ExportedFunctions()[name]
+	return ok && slices.Equal(def.ParamTypes(), params) && slices.Equal(def.ResultTypes(), results)
+}
+
+// Instance is a running instance of a Module. It is not safe for
+// concurrent use.
+type Instance struct {
+	mod api.Module
+}
+
+// Instantiate creates a fresh instance of the module. The instance is
+// closed, and any call in progress fails, once ctx is done. Importing
+// tables or globals fails here, as nothing provides them.
+func (m *Module) Instantiate(ctx context.Context) (*Instance, error) {
+	mod, err := m.runtime.InstantiateModule(ctx, m.compiled, wazero.NewModuleConfig().WithName("").WithStartFunctions())
+	if err != nil {
+		return nil, err
+	}
+	return &Instance{mod: mod}, nil
+}
+
+// Close releases the instance.
+func (in *Instance) Close(ctx context.Context) error {
+	return in.mod.Close(ctx)
+}
+
+// Call calls the exported function name.
+func (in *Instance) Call(ctx context.Context, name string, args ...uint64) ([]uint64, error) {
+	fn := in.mod.ExportedFunction(name)
+	if fn == nil {
+		return nil, fmt.Errorf("function %q is not exported", name)
+	}
+	return fn.Call(ctx, args...)
+}
+
+// Read returns a copy of n bytes of the memory exported as name, from
+// offset.
+func (in *Instance) Read(name string, offset, n uint32) ([]byte, error) {
+	mem := in.mod.ExportedMemory(name)
+	if mem == nil {
+		return nil, fmt.Errorf("memory %q is not exported", name)
+	}
+	b, ok := mem.Read(offset, n)
+	if !ok {
+		return nil, errors.New("read out of memory bounds")
+	}
+	return slices.Clone(b), nil
+}
+
+// Write copies b into the memory exported as name, at offset.
+func (in *Instance) Write(name string, offset uint32, b []byte) error {
+	mem := in.mod.ExportedMemory(name)
+	if mem == nil {
+		return fmt.Errorf("memory %q is not exported", name)
+	}
+	if !mem.Write(offset, b) {
+		return errors.New("write out of memory bounds")
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package wasmrt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aquaflamingo/moon/internal/wasmrt/wasmtest"
+	"github.com/tetratelabs/wazero/api"
+)
+
+const testMaxPages = 4
+
+func mustCompile(t *testing.T, b []byte) *Module {
+	t.Helper()
+	m, err := Compile(context.Background(), b, testMaxPages)
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	t.Cleanup(func() { m.Close(context.Background()) })
+	return m
+}
+
+func mustInstantiate(t *testing.T, ctx context.Context, m *Module) *Instance {
+	t.Helper()
+	in, err := m.Instantiate(ctx)
+	if err != nil {
+		t.Fatalf("Instantiate: %v", err)
+	}
+	t.Cleanup(func() { in.Close(context.Background()) })
+	return in
+}
+
+func TestRecursiveCall(t *testing.T) {
+	// fac(n i64) i64 = n == 0 ? 1 : n * fac(n-1)
+	fac := wasmtest.Code(0,
+		[]byte{0x20, 0x00, 0x50},             // local.get 0; i64.eqz
+		[]byte{0x04, I64},                    // if (result i64)
+		[]byte{0x42, 0x01},                   // i64.const 1
+		[]byte{0x05},                         // else
+		[]byte{0x20, 0x00},                   // local.get 0
+		[]byte{0x20, 0x00, 0x42, 0x01, 0x7D}, // local.get 0; i64.const 1; i64.sub
+		[]byte{0x10, 0x00},                   // call 0
+		[]byte{0x7E},                         // i64.mul
+		[]byte{0x0B, 0x0B},                   // end; end
+	)
+	m := mustCompile(t, wasmtest.Module{
+		Types:   [][]byte{wasmtest.FuncType([]api.ValueType{I64}, []api.ValueType{I64})},
+		Codes:   [][]byte{fac},
+		Exports: [][]byte{wasmtest.Export("fac", wasmtest.ExportFunc, 0)},
+	}.Bytes())
+	if !m.ExportsFunc("fac", []api.ValueType{I64}, []api.ValueType{I64}) || m.ExportsFunc("fac", []api.ValueType{I32}, []api.ValueType{I64}) {
+		t.Fatal("ExportsFunc does not match the signature of fac")
+	}
+
+	ctx := context.Background()
+	in := mustInstantiate(t, ctx, m)
+	res, err := in.Call(ctx, "fac", 20)
+	if err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if res[0] != 2432902008176640000 {
+		t.Fatalf("fac(20): got %d", res[0])
+	}
+	if _, err := in.Call(ctx, "fac", 1<<40); err == nil {
+		t.Fatal("expected unbounded recursion to trap")
+	}
+}
+
+func TestTraps(t *testing.T) {
+	i32i32 := wasmtest.FuncType([]api.ValueType{I32, I32}, []api.ValueType{I32})
+	m := mustCompile(t, wasmtest.Module{
+		Types: [][]byte{i32i32, wasmtest.FuncType(nil, nil), wasmtest.FuncType([]api.ValueType{I32}, []api.ValueType{I32})},
+		Codes: [][]byte{
+			wasmtest.Code(0, []byte{0x20, 0x00, 0x20, 0x01, 0x6D, 0x0B}), // i32.div_s
+			wasmtest.Code(0, []byte{0x03, 0x40, 0x0C, 0x00, 0x0B, 0x0B}), // loop br 0 end
+			wasmtest.Code(0, []byte{0x20, 0x00, 0x28, 0x00, 0x00, 0x0B}), // i32.load
+		},
+		Memory: []byte{0x00, 0x01},
+		Exports: [][]byte{
+			wasmtest.Export("div", wasmtest.ExportFunc, 0),
+			wasmtest.Export("spin", wasmtest.ExportFunc, 1),
+			wasmtest.Export("load", wasmtest.ExportFunc, 2),
+		},
+	}.Bytes())
+
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		fn      string
+		args    []uint64
+	}{
+		{"divide by zero", time.Second, "div", []uint64{1, 0}},
+		{"overflow", time.Second, "div", []uint64{0x80000000, 0xFFFFFFFF}},
+		{"deadline", 20 * time.Millisecond, "spin", nil},
+		{"memory bounds", time.Second, "load", []uint64{65536 - 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			in := mustInstantiate(t, ctx, m)
+			if _, err := in.Call(ctx, tt.fn, tt.args...); err == nil {
+				t.Fatal("expected a trap")
+			}
+		})
+	}
+
+	ctx := context.Background()
+	in := mustInstantiate(t, ctx, m)
+	if res, err := in.Call(ctx, "div", 0xFFFFFFF9, 2); err != nil || int32(res[0]) != -3 {
+		t.Fatalf("div(-7, 2): got %v, %v", res, err)
+	}
+}
+
+func TestInstancesDoNotShareMemory(t *testing.T) {
+	m := mustCompile(t, wasmtest.Module{
+		Types:   [][]byte{wasmtest.FuncType(nil, nil)},
+		Codes:   [][]byte{wasmtest.Code(0, []byte{0x0B})},
+		Memory:  []byte{0x00, 0x01},
+		Exports: [][]byte{wasmtest.Export("memory", wasmtest.ExportMemory, 0)},
+	}.Bytes())
+	if !m.ExportsMemory("memory") {
+		t.Fatal("expected the memory export")
+	}
+
+	ctx := context.Background()
+	a := mustInstantiate(t, ctx, m)
+	b := mustInstantiate(t, ctx, m)
+	if err := a.Write("memory", 10, []byte("hi")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if got, err := b.Read("memory", 10, 2); err != nil || string(got) != "\x00\x00" {
+		t.Fatalf("second instance memory = %q, %v", got, err)
+	}
+	if err := a.Write("memory", 65535, []byte("hi")); err == nil {
+		t.Fatal("expected a write past the end of memory to fail")
+	}
+	if _, err := a.Read("memory", 65535, 2); err == nil {
+		t.Fatal("expected a read past the end of memory to fail")
+	}
+}
+
+func TestCompileRejects(t *testing.T) {
+	i32 := []api.ValueType{I32}
+	valid := wasmtest.Module{
+		Types:   [][]byte{wasmtest.FuncType(nil, nil)},
+		Codes:   [][]byte{wasmtest.Code(0, []byte{0x0B})},
+		Exports: [][]byte{wasmtest.Export("f", wasmtest.ExportFunc, 0)},
+	}
+	mustCompile(t, valid.Bytes())
+
+	// (import "env" "f" (func (type 0)))
+	withImport := valid
+	withImport.Imports = wasmtest.Vec([]byte{0x03, 'e', 'n', 'v', 0x01, 'f', 0x00, 0x00})
+	unknownOp := valid
+	unknownOp.Codes = [][]byte{wasmtest.Code(0, []byte{0xFE, 0x0B})}
+	badLocal := valid
+	badLocal.Codes = [][]byte{wasmtest.Code(0, []byte{0x20, 0x00, 0x1A, 0x0B})}
+	hugeMemory := valid
+	hugeMemory.Memory = append([]byte{0x00}, wasmtest.ULEB(testMaxPages+1)...)
+	// i32.const 0; i64.const 0; i32.add: operands of the wrong type.
+	mistyped := valid
+	mistyped.Types = [][]byte{wasmtest.FuncType(nil, i32)}
+	mistyped.Codes = [][]byte{wasmtest.Code(0, []byte{0x41, 0x00, 0x42, 0x00, 0x6A, 0x0B})}
+	// A block declared to return i32 that leaves nothing on the stack.
+	emptyBlock := valid
+	emptyBlock.Types = [][]byte{wasmtest.FuncType(nil, i32)}
+	emptyBlock.Codes = [][]byte{wasmtest.Code(0, []byte{0x02, I32, 0x0B, 0x0B})}
+	// i32.load with no memory.
+	noMemory := valid
+	noMemory.Types = [][]byte{wasmtest.FuncType(nil, i32)}
+	noMemory.Codes = [][]byte{wasmtest.Code(0, []byte{0x41, 0x00, 0x28, 0x02, 0x00, 0x0B})}
+	// v128.const is outside the enabled features.
+	simd := valid
+	simd.Codes = [][]byte{wasmtest.Code(0, append(append([]byte{0xFD, 0x0C}, make([]byte, 16)...), 0x1A, 0x0B))}
+
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{"not wasm", []byte("hello, world")},
+		{"truncated", valid.Bytes()[:20]},
+		{"import", withImport.Bytes()},
+		{"unsupported instruction", unknownOp.Bytes()},
+		{"unknown local", badLocal.Bytes()},
+		{"memory over the limit", hugeMemory.Bytes()},
+		{"mistyped operands", mistyped.Bytes()},
+		{"block result missing", emptyBlock.Bytes()},
+		{"load without memory", noMemory.Bytes()},
+		{"simd", simd.Bytes()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if m, err := Compile(context.Background(), tt.b, testMaxPages); err == nil {
+				m.Close(context.Background())
+				t.Fatal("expected the module to be rejected")
+			}
+		})
+	}
+}
+
+// TestCompileEveryTruncation checks that every prefix of a module using
+// most sections is either rejected or compiles.
+func TestCompileEveryTruncation(t *testing.T) {
+	b := []byte("\x00asm\x01\x00\x00\x00")
+	b = append(b, wasmtest.Section(1, wasmtest.Vec(wasmtest.FuncType([]api.ValueType{I32}, []api.ValueType{I32})))...)
+	b = append(b, wasmtest.Section(3, wasmtest.Vec(wasmtest.ULEB(0)))...)
+	b = append(b, wasmtest.Section(4, wasmtest.Vec([]byte{0x70, 0x00, 0x01}))...)
+	b = append(b, wasmtest.Section(5, wasmtest.Vec([]byte{0x00, 0x01}))...)
+	b = append(b, wasmtest.Section(6, wasmtest.Vec([]byte{I32, 0x01, 0x41, 0x07, 0x0B}))...)
+	b = append(b, wasmtest.Section(7, wasmtest.Vec(wasmtest.Export("f", wasmtest.ExportFunc, 0)))...)
+	b = append(b, wasmtest.Section(9, wasmtest.Vec(append([]byte{0x00, 0x41, 0x00, 0x0B}, wasmtest.Vec(wasmtest.ULEB(0))...)))...)
+	b = append(b, wasmtest.Section(10, wasmtest.Vec(wasmtest.Code(1,
+		[]byte{0x02, I32, 0x20, 0x00, 0x0B},        // block (result i32) local.get 0 end
+		[]byte{0x23, 0x00, 0x6A, 0x21, 0x01},       // global.get 0 i32.add local.set 1
+		[]byte{0x41, 0x00, 0x28, 0x02, 0x00, 0x1A}, // i32.const 0 i32.load drop
+		[]byte{0x20, 0x01, 0x0B},                   // local.get 1 end
+	)))...)
+	b = append(b, wasmtest.Section(11, wasmtest.Vec(append([]byte{0x00, 0x41, 0x00, 0x0B}, wasmtest.Vec([]byte{0x2A})...)))...)
+	mustCompile(t, b)
+
+	for n := 8; n < len(b); n++ {
+		if m, err := Compile(context.Background(), b[:n], testMaxPages); err == nil {
+			m.Close(context.Background())
+		}
+	}
+}
@@ -0,0 +1,116 @@
+// Package wasmtest assembles small WebAssembly modules for tests.
+package wasmtest
+
+import "github.com/tetratelabs/wazero/api"
+
+// Export kinds.
+const (
+	ExportFunc   byte = 0x00
+	ExportMemory byte = 0x02
+)
+
+// ULEB encodes v as unsigned LEB128.
+func ULEB(v uint64) []byte {
+	var b []byte
+	for {
+		c := byte(v & 0x7F)
+		v >>= 7
+		if v != 0 {
+			b = append(b, c|0x80)
+			continue
+		}
+		return append(b, c)
+	}
+}
+
+// SLEB encodes v as signed LEB128.
+func SLEB(v int64) []byte {
+	var b []byte
+	for {
+		c := byte(v & 0x7F)
+		v >>= 7
+		if (v == 0 && c&0x40 == 0) || (v == -1 && c&0x40 != 0) {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+// Vec encodes items as a vector: a count followed by the items.
+func Vec(items ...[]byte) []byte {
+	b := ULEB(uint64(len(items)))
+	for _, it := range items {
+		b = append(b, it...)
+	}
+	return b
+}
+
+// Section encodes a section with the given id.
+func Section(id byte, body []byte) []byte {
+	return append(append([]byte{id}, ULEB(uint64(len(body)))...), body...)
+}
+
+// Code encodes a function body with n extra i32 locals.
+func Code(locals int, instrs ...[]byte) []byte {
+	body := Vec()
+	if locals > 0 {
+		body = Vec(append(ULEB(uint64(locals)), api.ValueTypeI32))
+	}
+	for _, in := range instrs {
+		body = append(body, in...)
+	}
+	return append(ULEB(uint64(len(body))), body...)
+}
+
+// FuncType encodes a function type.
+func FuncType(params, results []api.ValueType) []byte {
+	return append(append([]byte{0x60}, Vec(each(params)...)...), Vec(each(results)...)...)
+}
+
+func each(b []byte) [][]byte {
+	out := make([][]byte, len(b))
+	for i, c := range b {
+		out[i] = []byte{c}
+	}
+	return out
+}
+
+// Export encodes an export of the given kind.
+func Export(name string, kind byte, index uint32) []byte {
+	b := append(ULEB(uint64(len(name))), name...)
+	return append(append(b, kind), ULEB(uint64(index))...)
+}
+
+// Module assembles a module from one function type per function, their
+// bodies, and optional memory, exports, and sections.
+type Module struct {
+	Types   [][]byte
+	Codes   [][]byte
+	Memory  []byte
+	Exports [][]byte
+	Data    [][]byte
+	Imports []byte
+}
+
+// Bytes returns the module binary.
+func (m Module) Bytes() []byte {
+	b := []byte("\x00asm\x01\x00\x00\x00")
+	b = append(b, Section(1, Vec(m.Types...))...)
+	if m.Imports != nil {
+		b = append(b, Section(2, m.Imports)...)
+	}
+	funcs := make([][]byte, len(m.Codes))
+	for i := range funcs {
+		funcs[i] = ULEB(uint64(i))
+	}
+	b = append(b, Section(3, Vec(funcs...))...)
+	if m.Memory != nil {
+		b = append(b, Section(5, Vec(m.Memory))...)
+	}
+	b = append(b, Section(7, Vec(m.Exports...))...)
+	b = append(b, Section(10, Vec(m.Codes...))...)
+	if m.Data != nil {
+		b = append(b, Section(11, Vec(m.Data...))...)
+	}
+	return b
+}